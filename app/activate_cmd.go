@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"github.com/pkg/errors"
 
@@ -17,9 +18,10 @@ import (
 )
 
 type activateCmd struct {
-	Dir         string `arg:"" help:"Directory of environment to activate (${default})" default:"${env}"`
-	Prompt      string `enum:"env,short,none" default:"env" help:"Include hermit environment, just icon or nothing in shell prompt"`
-	ShortPrompt bool   `help:"Use a minimal prompt in active environments." hidden:""`
+	Dir         string   `arg:"" help:"Directory of environment to activate (${default})" default:"${env}"`
+	Prompt      string   `enum:"env,short,none" default:"env" help:"Include hermit environment, just icon or nothing in shell prompt"`
+	ShortPrompt bool     `help:"Use a minimal prompt in active environments." hidden:""`
+	Profile     []string `help:"Profiles of the environment to activate, making their packages available." env:"HERMIT_PROFILES"`
 }
 
 func (a *activateCmd) Run(l *ui.UI, sta *state.State, globalState GlobalState, config Config, defaultClient *http.Client) error {
@@ -31,6 +33,15 @@ func (a *activateCmd) Run(l *ui.UI, sta *state.State, globalState GlobalState, c
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	if err := env.LinkInherited(l); err != nil {
+		return errors.WithStack(err)
+	}
+	for _, name := range env.SetProfiles(a.Profile) {
+		l.Warnf("%s has no profile %q, available profiles: %s", realdir, name, strings.Join(env.Profiles(), ", "))
+	}
+	if err := env.EnsureProfilePackages(l); err != nil {
+		return errors.WithStack(err)
+	}
 	messages, err := env.Trigger(l, manifest.EventEnvActivate)
 	if err != nil {
 		return errors.WithStack(err)
@@ -42,6 +53,10 @@ func (a *activateCmd) Run(l *ui.UI, sta *state.State, globalState GlobalState, c
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	roots, err := env.Roots(l)
+	if err != nil {
+		return errors.WithStack(err)
+	}
 	pkgs, err := env.ListInstalled(l)
 	if err != nil {
 		return errors.WithStack(err)
@@ -53,15 +68,20 @@ func (a *activateCmd) Run(l *ui.UI, sta *state.State, globalState GlobalState, c
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	environ := envars.Parse(os.Environ()).Apply(env.Root(), ops).Changed(true)
+	completions, err := env.UpdateCompletions(l)
+	if err != nil {
+		l.Warnf("Could not update package completions: %s", err)
+	}
+	environ := envars.Parse(os.Environ()).ApplyWithRoots(env.Root(), roots, ops).Changed(true)
 	prompt := a.Prompt
 	if a.ShortPrompt {
 		prompt = "short"
 	}
 	return shell.ActivateHermit(os.Stdout, sh, shell.ActivationConfig{
-		Env:    environ,
-		Root:   env.Root(),
-		Prompt: prompt,
+		Env:         environ,
+		Root:        env.Root(),
+		Prompt:      prompt,
+		Completions: completions,
 	})
 }
 
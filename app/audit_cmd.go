@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/audit"
+	"github.com/cashapp/hermit/ui"
+)
+
+type auditCmd struct {
+	OSVURL string `help:"Base URL of the OSV API." default:"https://api.osv.dev" env:"HERMIT_OSV_URL"`
+	NVDURL string `help:"Base URL of the NVD API." default:"https://services.nvd.nist.gov" env:"HERMIT_NVD_URL"`
+}
+
+func (a *auditCmd) Run(ctx context.Context, l *ui.UI, env *hermit.Env, defaultHTTPClient *http.Client) error {
+	pkgs, err := env.ListInstalled(l)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	client := audit.New(defaultHTTPClient, audit.WithOSVURL(a.OSVURL), audit.WithNVDURL(a.NVDURL))
+	report, err := client.Audit(ctx, pkgs)
+	if err != nil {
+		return errors.Wrap(err, "audit failed")
+	}
+	for _, pkg := range report.Unaudited {
+		l.Debugf("%s: not audited, no OSV package, CPE name or version", pkg)
+	}
+	for _, vuln := range report.Vulnerabilities {
+		id := vuln.ID
+		if len(vuln.Aliases) > 0 {
+			id += " (" + strings.Join(vuln.Aliases, ", ") + ")"
+		}
+		severity := vuln.Severity
+		if severity == "" {
+			severity = "UNKNOWN"
+		}
+		fmt.Printf("%s: %s [%s] %s\n", vuln.Package, id, severity, vuln.Summary)
+		if len(vuln.Fixed) > 0 {
+			fmt.Printf("  fixed in %s\n", strings.Join(vuln.Fixed, ", "))
+		}
+	}
+	if len(report.Vulnerabilities) > 0 {
+		return errors.Errorf("%d known vulnerabilities found", len(report.Vulnerabilities))
+	}
+	return nil
+}
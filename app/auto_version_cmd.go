@@ -1,9 +1,11 @@
 package app
 
 import (
+	"context"
 	"net/http"
 
 	"github.com/cashapp/hermit/github"
+	"github.com/cashapp/hermit/gitlab"
 	"github.com/cashapp/hermit/manifest/autoversion"
 	"github.com/cashapp/hermit/ui"
 )
@@ -12,10 +14,14 @@ type autoVersionCmd struct {
 	Manifest []string `arg:"" type:"existingfile" required:"" help:"Manifests to upgrade." predictor:"hclfile"`
 }
 
-func (s *autoVersionCmd) Run(l *ui.UI, hclient *http.Client, client *github.Client) error {
+func (s *autoVersionCmd) Run(ctx context.Context, l *ui.UI, hclient *http.Client, client *github.Client, glClient *gitlab.Client) error {
+	// Retrieve all the latest releases up front, in as few requests as possible.
+	if err := client.PrefetchLatestReleases(ctx, autoversion.GitHubRepos(s.Manifest)); err != nil {
+		l.Warnf("could not prefetch GitHub releases: %s", err)
+	}
 	for _, path := range s.Manifest {
 		l.Debugf("Auto-versioning %s", path)
-		version, err := autoversion.AutoVersion(hclient, client, path)
+		version, err := autoversion.AutoVersion(ctx, hclient, client, glClient, path)
 		if err != nil {
 			l.Warnf("could not auto-version %q: %s", path, err)
 			continue
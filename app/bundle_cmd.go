@@ -0,0 +1,70 @@
+package app
+
+import (
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/state"
+	"github.com/cashapp/hermit/ui"
+)
+
+type bundleCmd struct {
+	Export bundleExportCmd `cmd:"" default:"withargs" help:"Export the packages and manifests required by the environment to a bundle (default)."`
+	Import bundleImportCmd `cmd:"" help:"Import a bundle for use with --offline."`
+}
+
+type bundleExportCmd struct {
+	Output string `short:"o" help:"File to write the bundle to, defaults to stdout." placeholder:"FILE"`
+}
+
+func (b *bundleExportCmd) Help() string {
+	return `
+Export the sources of all packages installed in the environment, along with all manifest sources, into a single
+gzipped tarball. Import it on another machine with "hermit bundle import", then install with "hermit --offline install".
+`
+}
+
+func (b *bundleExportCmd) Run(l *ui.UI, env *hermit.Env, sta *state.State) error {
+	refs, err := env.ListInstalledReferences()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := env.Sync(l, false); err != nil {
+		return errors.WithStack(err)
+	}
+	pkgs := make([]*manifest.Package, 0, len(refs))
+	for _, ref := range refs {
+		pkg, err := env.Resolve(l, manifest.ExactSelector(ref), false)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	var w io.Writer = os.Stdout
+	if b.Output != "" {
+		f, err := os.Create(b.Output)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer f.Close() // nolint: gosec
+		w = f
+	}
+	return errors.WithStack(sta.ExportBundle(l, pkgs, w))
+}
+
+type bundleImportCmd struct {
+	Bundle string `arg:"" type:"existingfile" help:"Bundle to import."`
+}
+
+func (b *bundleImportCmd) Run(l *ui.UI, sta *state.State) error {
+	f, err := os.Open(b.Bundle)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close() // nolint: gosec
+	return errors.Wrap(sta.ImportBundle(l, f), b.Bundle)
+}
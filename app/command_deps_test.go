@@ -0,0 +1,75 @@
+package app
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/hermittest"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/manifest/manifesttest"
+	"github.com/cashapp/hermit/ui"
+)
+
+func TestDeps(t *testing.T) {
+	f := hermittest.NewEnvTestFixture(t, nil).WithManifests(map[string]string{
+		"terraform.hcl": `
+			description = ""
+			binaries = ["darwin_exe", "linux_exe"]
+			version "1.5.7" "1.6.0" {
+			  source = "www.example.com"
+			}
+		`,
+		"terragrunt.hcl": `
+			description = ""
+			binaries = ["darwin_exe", "linux_exe"]
+			requires = ["terraform-1.5*", "tflint"]
+			version "0.50.0" {
+			  source = "www.example.com"
+			}
+		`,
+		"tflint.hcl": `
+			description = ""
+			binaries = ["darwin_exe", "linux_exe"]
+			requires = ["terraform"]
+			version "0.48.0" {
+			  source = "www.example.com"
+			}
+		`,
+	})
+	defer f.Clean()
+	pkg := manifesttest.NewPkgBuilder(filepath.Join(f.RootDir(), "terraform-1.5.7")).
+		WithName("terraform").
+		WithVersion("1.5.7").
+		WithSource("../archive/testdata/archive.tar.gz").
+		Result()
+	_, err := f.Env.Install(f.P, pkg)
+	require.NoError(t, err)
+
+	l, buf := ui.NewForTesting()
+	cmd := depsCmd{Packages: []manifest.GlobSelector{manifest.MustParseGlobSelector("terragrunt")}}
+	require.NoError(t, cmd.Run(l, f.Env, GlobalState{}))
+	require.Equal(t, `terragrunt-0.50.0
+  terraform-1.5.7 (terraform-1.5*, installed)
+  tflint-0.48.0
+    terraform-1.5.7 (installed)
+`, buf.String())
+
+	l, buf = ui.NewForTesting()
+	require.NoError(t, cmd.Run(l, f.Env, GlobalState{JSON: true}))
+	require.JSONEq(t, `{
+		"schemaVersion": 1,
+		"packages": [{
+			"reference": "terragrunt-0.50.0",
+			"requirement": "terragrunt",
+			"installed": false,
+			"dependencies": [
+				{"reference": "terraform-1.5.7", "requirement": "terraform-1.5*", "installed": true},
+				{"reference": "tflint-0.48.0", "requirement": "tflint", "installed": false, "dependencies": [
+					{"reference": "terraform-1.5.7", "requirement": "terraform", "installed": true}
+				]}
+			]
+		}]
+	}`, buf.String())
+}
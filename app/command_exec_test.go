@@ -0,0 +1,25 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/hermittest"
+	"github.com/cashapp/hermit/ui"
+)
+
+func TestExecEphemeralUnknownPackage(t *testing.T) {
+	l, _ := ui.NewForTesting()
+	f := hermittest.NewEnvTestFixture(t, nil)
+	defer f.Clean()
+
+	cmd := execCmd{Binary: "missing@1.0"}
+	err := cmd.Run(l, f.State, f.Env, GlobalState{}, Config{}, nil)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown package")
+
+	cmd = execCmd{Binary: "jq@1.7"}
+	err = cmd.runEphemeral(l, nil)
+	require.EqualError(t, err, "jq@1.7 is not a binary, and running packages that aren't installed requires an active environment")
+}
@@ -25,8 +25,8 @@ func TestCommandInfoJson(t *testing.T) {
 	})
 	defer f.Clean()
 
-	cmd := infoCmd{Packages: []manifest.GlobSelector{manifest.MustParseGlobSelector("test-version-1.1")}, JSON: true}
-	require.NoError(t, cmd.Run(l, f.Env, f.State))
+	cmd := infoCmd{Packages: []manifest.GlobSelector{manifest.MustParseGlobSelector("test-version-1.1")}}
+	require.NoError(t, cmd.Run(l, f.Env, f.State, GlobalState{JSON: true}))
 
 	var jss []map[string]json.RawMessage
 	require.NoError(t, json.Unmarshal(buf.Bytes(), &jss))
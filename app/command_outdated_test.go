@@ -0,0 +1,52 @@
+package app
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/hermittest"
+	"github.com/cashapp/hermit/manifest/manifesttest"
+	"github.com/cashapp/hermit/ui"
+)
+
+func TestOutdated(t *testing.T) {
+	f := hermittest.NewEnvTestFixture(t, nil).WithManifests(map[string]string{
+		"test.hcl": `
+			description = "test package"
+			binaries = ["darwin_exe", "linux_exe"]
+			version "1.0.0" "1.1.0" "2.0.0" {
+			  source = "www.example.com"
+			}
+		`,
+	})
+	defer f.Clean()
+	f.State.SetOffline(true)
+	pkg := manifesttest.NewPkgBuilder(filepath.Join(f.RootDir(), "test-1.0.0")).
+		WithVersion("1.0.0").
+		WithSource("../archive/testdata/archive.tar.gz").
+		Result()
+	_, err := f.Env.Install(f.P, pkg)
+	require.NoError(t, err)
+
+	l, buf := ui.NewForTesting()
+	cmd := outdatedCmd{}
+	err = cmd.Run(context.Background(), l, f.Env, f.State, GlobalState{JSON: true}, nil, nil, nil)
+	require.EqualError(t, err, "1 of 1 packages are outdated")
+	require.JSONEq(t, `{
+		"schemaVersion": 1,
+		"packages": [{
+			"name": "test",
+			"current": "1.0.0",
+			"latest": "1.1.0",
+			"outdated": true
+		}]
+	}`, buf.String())
+
+	l, buf = ui.NewForTesting()
+	err = cmd.Run(context.Background(), l, f.Env, f.State, GlobalState{}, nil, nil, nil)
+	require.Error(t, err)
+	require.Equal(t, "PACKAGE  CURRENT  LATEST  UPSTREAM  \ntest     1.0.0    1.1.0   -         \n", buf.String())
+}
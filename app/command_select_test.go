@@ -0,0 +1,75 @@
+package app
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/hermittest"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+)
+
+func TestSelect(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "../archive/testdata/archive.tar.gz")
+	})
+	f := hermittest.NewEnvTestFixture(t, handler)
+	jdk := func(versions string) string {
+		return `
+			description = ""
+			binaries = ["darwin_exe", "linux_exe"]
+			provides = ["jdk"]
+			version ` + versions + ` {
+			  source = "` + f.Server.URL + `/archive.tar.gz"
+			}
+		`
+	}
+	f.WithManifests(map[string]string{
+		"openjdk.hcl":  jdk(`"11.0.2" "17.0.2"`),
+		"corretto.hcl": jdk(`"17.0.8"`),
+		"gradle.hcl": `
+			description = ""
+			binaries = ["gradle"]
+			requires = ["jdk"]
+			version "8.4" {
+			  source = "www.example.com"
+			}
+		`,
+	})
+	defer f.Clean()
+	installedRefs := func() (out []string) {
+		refs, err := f.Env.ListInstalledReferences()
+		require.NoError(t, err)
+		for _, ref := range refs {
+			out = append(out, ref.String())
+		}
+		return out
+	}
+
+	// With two providers a requirement on jdk is ambiguous until one is selected.
+	_, err := f.Env.DependencyGraph(f.P, nil, manifest.NameSelector("gradle"))
+	require.Error(t, err)
+
+	cmd := selectCmd{Virtual: "jdk", Provider: "corretto"}
+	require.NoError(t, cmd.Run(f.P, f.Env, f.State))
+	require.Equal(t, []string{"corretto-17.0.8"}, installedRefs())
+
+	cmd = selectCmd{Virtual: "jdk", Provider: "openjdk-17.0.2"}
+	require.NoError(t, cmd.Run(f.P, f.Env, f.State))
+	require.Equal(t, []string{"openjdk-17.0.2"}, installedRefs())
+	require.Equal(t, "openjdk", f.Env.SelectedProvider("jdk"))
+
+	graph, err := f.Env.DependencyGraph(f.P, nil, manifest.NameSelector("gradle"))
+	require.NoError(t, err)
+	require.Equal(t, "openjdk-17.0.2", graph[0].Dependencies[0].Package.Reference.String())
+
+	l, buf := ui.NewForTesting()
+	cmd = selectCmd{Virtual: "jdk"}
+	require.NoError(t, cmd.Run(l, f.Env, f.State))
+	require.Equal(t, "  corretto\n* openjdk (openjdk-17.0.2 installed)\n", buf.String())
+
+	cmd = selectCmd{Virtual: "jdk", Provider: "gradle"}
+	require.EqualError(t, cmd.Run(f.P, f.Env, f.State), "gradle does not provide jdk")
+}
@@ -1,6 +1,8 @@
 package app
 
 import (
+	"time"
+
 	"github.com/alecthomas/kong"
 
 	"github.com/cashapp/hermit/envars"
@@ -9,7 +11,8 @@ import (
 
 // GlobalState configurable by user to be passed through to Hermit.
 type GlobalState struct {
-	Env envars.Envars `help:"Extra environment variables to apply to environments."`
+	Env  envars.Envars `help:"Extra environment variables to apply to environments."`
+	JSON bool          `help:"Output JSON documents instead of human-readable text, where supported." env:"HERMIT_JSON"`
 }
 
 type cliCommon interface {
@@ -19,18 +22,27 @@ type cliCommon interface {
 	getTrace() bool
 	getQuiet() bool
 	getLevel() ui.Level
+	getOffline() bool
+	getInsecureSkipVerify() bool
+	getInsecureNoSandbox() bool
+	getLockTimeout() time.Duration
 	getGlobalState() GlobalState
 }
 
 // CLI structure.
 type unactivated struct {
-	VersionFlag kong.VersionFlag `help:"Show version." name:"version"`
-	CPUProfile  string           `placeholder:"PATH" name:"cpu-profile" help:"Enable CPU profiling to PATH." hidden:""`
-	MemProfile  string           `placeholder:"PATH" name:"mem-profile" help:"Enable memory profiling to PATH." hidden:""`
-	Debug       bool             `help:"Enable debug logging." short:"d"`
-	Trace       bool             `help:"Enable trace logging." short:"t"`
-	Quiet       bool             `help:"Disable logging and progress UI, except fatal errors." env:"HERMIT_QUIET" short:"q"`
-	Level       ui.Level         `help:"Set minimum log level." env:"HERMIT_LOG" default:"info" enum:"trace,debug,info,warn,error,fatal"`
+	VersionFlag        kong.VersionFlag `help:"Show version." name:"version"`
+	CPUProfile         string           `placeholder:"PATH" name:"cpu-profile" help:"Enable CPU profiling to PATH." hidden:""`
+	MemProfile         string           `placeholder:"PATH" name:"mem-profile" help:"Enable memory profiling to PATH." hidden:""`
+	Debug              bool             `help:"Enable debug logging." short:"d"`
+	Trace              bool             `help:"Enable trace logging." short:"t"`
+	Quiet              bool             `help:"Disable logging and progress UI, except fatal errors." env:"HERMIT_QUIET" short:"q"`
+	Level              ui.Level         `help:"Set minimum log level." env:"HERMIT_LOG" default:"info" enum:"trace,debug,info,warn,error,fatal"`
+	Offline            bool             `help:"Only use manifests and packages that are already available locally, without accessing the network." env:"HERMIT_OFFLINE"`
+	InsecureSkipVerify bool             `help:"Install packages without verifying their cosign signatures." env:"HERMIT_INSECURE_SKIP_VERIFY"`
+	InsecureNoSandbox  bool             `help:"Run commands of packages unconfined if they can't be sandboxed on this system, and apply install actions outside of the package, instead of failing." env:"HERMIT_INSECURE_NO_SANDBOX"`
+	LockTimeout        time.Duration    `help:"How long to wait for locks on the shared state held by other Hermit processes." env:"HERMIT_LOCK_TIMEOUT" default:"30s"`
+	ShowLocks          showLocksFlag    `help:"Show which processes hold locks on the shared state, then exit."`
 	GlobalState
 
 	Init       initCmd       `cmd:"" help:"Initialise an environment (idempotent)." group:"env"`
@@ -47,28 +59,46 @@ type unactivated struct {
 	DumpDB               dumpDBCmd            `cmd:"" help:"Dump state database." hidden:""`
 	DumpUserConfigSchema dumpUserConfigSchema `cmd:"" help:"Dump user configuration schema." hidden:""`
 	Validate             validateCmd          `cmd:"" help:"Hermit validation." group:"global"`
+	Telemetry            telemetryCmd         `cmd:"" help:"Inspect recorded package telemetry." group:"global"`
 
 	kong.Plugins
 }
 
-func (u *unactivated) getCPUProfile() string       { return u.CPUProfile }
-func (u *unactivated) getMemProfile() string       { return u.MemProfile }
-func (u *unactivated) getTrace() bool              { return u.Trace }
-func (u *unactivated) getDebug() bool              { return u.Debug }
-func (u *unactivated) getQuiet() bool              { return u.Quiet }
-func (u *unactivated) getLevel() ui.Level          { return u.Level }
-func (u *unactivated) getGlobalState() GlobalState { return u.GlobalState }
+func (u *unactivated) getCPUProfile() string         { return u.CPUProfile }
+func (u *unactivated) getMemProfile() string         { return u.MemProfile }
+func (u *unactivated) getTrace() bool                { return u.Trace }
+func (u *unactivated) getDebug() bool                { return u.Debug }
+func (u *unactivated) getQuiet() bool                { return u.Quiet }
+func (u *unactivated) getLevel() ui.Level            { return u.Level }
+func (u *unactivated) getOffline() bool              { return u.Offline }
+func (u *unactivated) getInsecureSkipVerify() bool   { return u.InsecureSkipVerify }
+func (u *unactivated) getInsecureNoSandbox() bool    { return u.InsecureNoSandbox }
+func (u *unactivated) getLockTimeout() time.Duration { return u.LockTimeout }
+func (u *unactivated) getGlobalState() GlobalState   { return u.GlobalState }
 
 type activated struct {
 	unactivated
 
-	Status    statusCmd    `cmd:"" help:"Show status of Hermit environment." group:"env"`
-	Install   installCmd   `cmd:"" help:"Install packages." group:"env"`
-	Uninstall uninstallCmd `cmd:"" help:"Uninstall packages." group:"env"`
-	Upgrade   upgradeCmd   `cmd:"" help:"Upgrade packages" group:"env"`
-	List      listCmd      `cmd:"" help:"List local packages." group:"env"`
-	Exec      execCmd      `cmd:"" help:"Directly execute a binary in a package." group:"env"`
-	Env       envCmd       `cmd:"" help:"Manage environment variables." group:"env"`
+	Status       statusCmd       `cmd:"" help:"Show status of Hermit environment." group:"env"`
+	Install      installCmd      `cmd:"" help:"Install packages." group:"env"`
+	Uninstall    uninstallCmd    `cmd:"" help:"Uninstall packages." group:"env"`
+	Select       selectCmd       `cmd:"" help:"Select the package providing a virtual package." group:"env"`
+	Upgrade      upgradeCmd      `cmd:"" help:"Upgrade packages" group:"env"`
+	Rollback     rollbackCmd     `cmd:"" help:"Restore the version of a package installed before its last upgrade." group:"env"`
+	Outdated     outdatedCmd     `cmd:"" help:"Show installed packages with newer versions available." group:"env"`
+	List         listCmd         `cmd:"" help:"List local packages." group:"env"`
+	Exec         execCmd         `cmd:"" help:"Directly execute a binary in a package." group:"env"`
+	Env          envCmd          `cmd:"" help:"Manage environment variables." group:"env"`
+	SBOM         sbomCmd         `cmd:"" name:"sbom" help:"Generate a software bill of materials for installed packages." group:"env"`
+	Audit        auditCmd        `cmd:"" help:"Check installed packages for known vulnerabilities." group:"env"`
+	Lock         lockCmd         `cmd:"" help:"Lock installed packages to their exact sources and checksums." group:"env"`
+	Bundle       bundleCmd       `cmd:"" help:"Export or import packages for offline use." group:"env"`
+	DockerExport dockerExportCmd `cmd:"" help:"Export the environment as a Docker build context or devcontainer feature." group:"env"`
+	DU           duCmd           `cmd:"" name:"du" help:"Show disk usage of installed packages." group:"env"`
+	Deps         depsCmd         `cmd:"" help:"Show the dependency graph of packages." group:"env"`
+	Why          whyCmd          `cmd:"" help:"Explain how a package was installed." group:"env"`
+	SelfUpgrade  selfUpgradeCmd  `cmd:"" help:"Upgrade Hermit, or switch the release channel this environment uses." group:"env"`
+	SelfPin      selfPinCmd      `cmd:"" help:"Pin this environment to a version of Hermit." group:"env"`
 
 	Clean cleanCmd `cmd:"" help:"Clean hermit cache." group:"global"`
 	GC    gcCmd    `cmd:"" help:"Garbage collect unused Hermit packages and clean the download cache." group:"global"`
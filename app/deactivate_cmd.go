@@ -18,10 +18,14 @@ func (a *deactivateCmd) Run(env *hermit.Env, p *ui.UI) error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	roots, err := env.Roots(p)
+	if err != nil {
+		return errors.WithStack(err)
+	}
 	sh, err := shell.Detect()
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	environ := envars.Parse(os.Environ()).Revert(env.Root(), ops).Changed(true)
+	environ := envars.Parse(os.Environ()).RevertWithRoots(env.Root(), roots, ops).Changed(true)
 	return shell.DeactivateHermit(os.Stdout, sh, environ)
 }
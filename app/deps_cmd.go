@@ -0,0 +1,85 @@
+package app
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+)
+
+type depsCmd struct {
+	Packages []manifest.GlobSelector `arg:"" optional:"" name:"package" help:"Packages to show the dependencies of. If omitted, shows the dependencies of all installed packages." predictor:"package"`
+}
+
+// A package in the dependency graph as output with --json.
+type jsonDependency struct {
+	Reference    string           `json:"reference"`
+	Requirement  string           `json:"requirement"`
+	Installed    bool             `json:"installed"`
+	Dependencies []jsonDependency `json:"dependencies,omitempty"`
+}
+
+type jsonDependencies struct {
+	jsonDocument
+	Packages []jsonDependency `json:"packages"`
+}
+
+func newJSONDependencies(deps hermit.Dependencies) []jsonDependency {
+	out := make([]jsonDependency, 0, len(deps))
+	for _, dep := range deps {
+		out = append(out, jsonDependency{
+			Reference:    dep.Package.Reference.String(),
+			Requirement:  dep.Requirement,
+			Installed:    dep.Installed,
+			Dependencies: newJSONDependencies(dep.Dependencies),
+		})
+	}
+	return out
+}
+
+func (d *depsCmd) Run(l *ui.UI, env *hermit.Env, globalState GlobalState) error {
+	installed, err := env.ListInstalledReferences()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	selectors := make([]manifest.Selector, 0, len(d.Packages))
+	for _, selector := range d.Packages {
+		selectors = append(selectors, selector)
+	}
+	if len(selectors) == 0 {
+		for _, ref := range installed {
+			selectors = append(selectors, manifest.ExactSelector(ref))
+		}
+	}
+	graph, err := env.DependencyGraph(l, installed, selectors...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if globalState.JSON {
+		return printJSON(l, jsonDependencies{jsonDocument: newJSONDocument(), Packages: newJSONDependencies(graph)})
+	}
+	printDependencies(l, graph, 0)
+	return nil
+}
+
+func printDependencies(l *ui.UI, deps hermit.Dependencies, depth int) {
+	for _, dep := range deps {
+		ref := dep.Package.Reference.String()
+		var notes []string
+		if depth > 0 && dep.Requirement != ref && dep.Requirement != dep.Package.Reference.Name {
+			notes = append(notes, dep.Requirement)
+		}
+		if dep.Installed {
+			notes = append(notes, "installed")
+		}
+		line := strings.Repeat("  ", depth) + ref
+		if len(notes) > 0 {
+			line += " (" + strings.Join(notes, ", ") + ")"
+		}
+		l.Printf("%s\n", line)
+		printDependencies(l, dep.Dependencies, depth+1)
+	}
+}
@@ -0,0 +1,86 @@
+package app
+
+import (
+	"io"
+	"os"
+	"runtime"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/docker"
+	"github.com/cashapp/hermit/platform"
+	"github.com/cashapp/hermit/state"
+	"github.com/cashapp/hermit/ui"
+)
+
+type dockerExportCmd struct {
+	Output   string `short:"o" help:"Directory to write the build context to." default:"hermit-docker" placeholder:"DIR"`
+	Format   string `short:"f" help:"Export format, one of ${enum}." enum:"dockerfile,devcontainer" default:"dockerfile"`
+	Platform string `help:"Platform of the image, as linux-<arch>. Defaults to the architecture of this machine." placeholder:"PLATFORM"`
+	Base     string `help:"Base image of the Dockerfile stage. It must provide bash." default:"debian:stable-slim"`
+	Stage    string `help:"Name of the Dockerfile stage." default:"hermit"`
+	Dir      string `help:"Directory to install the environment to in the image." default:"/opt/hermit/env"`
+	StateDir string `help:"Hermit state directory in the image." default:"/opt/hermit/state"`
+}
+
+func (d *dockerExportCmd) Help() string {
+	return `
+Write a Docker build context that installs exactly the packages installed in this environment into an image. The
+packages are resolved for the platform of the image and exported from the Hermit cache into a bundle alongside a copy
+of the environment's bin directory, so the image is built without downloading them again.
+
+By default a Dockerfile stage is written, to build with "docker build <dir>" or to build other stages FROM. With
+--format=devcontainer the directory is a devcontainer feature instead.
+`
+}
+
+func (d *dockerExportCmd) Run(l *ui.UI, env *hermit.Env, sta *state.State) error {
+	target := platform.Platform{OS: "linux", Arch: runtime.GOARCH}
+	if d.Platform != "" {
+		parsed, err := platform.Parse(d.Platform)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		target = parsed
+	}
+	refs, err := env.ListInstalledReferences()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := env.Sync(l, false); err != nil {
+		return errors.WithStack(err)
+	}
+	installed, err := env.ResolveForPlatform(l, target, refs)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	bundled := installed
+	// Include the Hermit release the environment uses, so that the image doesn't download it.
+	if ref, ok := env.HermitReference(); ok {
+		if bundled, err = env.ResolveForPlatform(l, target, append(refs, ref)); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	executable := ""
+	if target.OS == runtime.GOOS && target.Arch == runtime.GOARCH {
+		if executable, err = os.Executable(); err != nil {
+			return errors.WithStack(err)
+		}
+	} else {
+		l.Warnf("This Hermit can't run on %s, so the image will download Hermit, which requires curl in the base image", target)
+	}
+	err = docker.Write(d.Output, docker.Format(d.Format), docker.Export{
+		Env:         env.Root(),
+		BinDir:      env.BinDir(),
+		EnvDirs:     env.EnvSourceDirs(),
+		Packages:    installed,
+		WriteBundle: func(w io.Writer) error { return sta.ExportBundle(l, bundled, w) },
+		Executable:  executable,
+		Base:        d.Base,
+		Stage:       d.Stage,
+		Dir:         d.Dir,
+		StateDir:    d.StateDir,
+	})
+	return errors.Wrap(err, "failed to export environment")
+}
@@ -0,0 +1,67 @@
+package app
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/state"
+	"github.com/cashapp/hermit/ui"
+)
+
+type duCmd struct {
+	Bytes bool `short:"b" help:"Report sizes in bytes."`
+}
+
+func (d *duCmd) Run(l *ui.UI, env *hermit.Env, sta *state.State) error {
+	pkgs, err := env.ListInstalled(l)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	format := formatBytes
+	if d.Bytes {
+		format = func(size int64) string { return strconv.FormatInt(size, 10) }
+	}
+	type row struct {
+		name  string
+		usage state.PackageDiskUsage
+	}
+	rows := make([]row, 0, len(pkgs))
+	var shared, local, downloads int64
+	for _, pkg := range pkgs {
+		usage, err := sta.DiskUsage(l.Task(pkg.Reference.String()), pkg)
+		if err != nil {
+			return errors.Wrap(err, pkg.String())
+		}
+		if usage.Shared {
+			shared += usage.Extracted
+		} else {
+			local += usage.Extracted
+		}
+		downloads += usage.Download
+		rows = append(rows, row{pkg.Reference.String(), usage})
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		return rows[i].usage.Extracted+rows[i].usage.Download > rows[j].usage.Extracted+rows[j].usage.Download
+	})
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PACKAGE\tEXTRACTED\tLOCATION\tDOWNLOAD\tENVIRONMENTS\t")
+	for _, r := range rows {
+		location := "env"
+		if r.usage.Shared {
+			location = "shared"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t\n", r.name, format(r.usage.Extracted), location, format(r.usage.Download), r.usage.Environments)
+	}
+	if err := w.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+	fmt.Printf("\nShared packages: %s, environment-local packages: %s, downloads: %s\n", format(shared), format(local), format(downloads))
+	return nil
+}
@@ -60,7 +60,15 @@ func (e *envCmd) Run(l *ui.UI, env *hermit.Env) error {
 		if err != nil {
 			return errors.WithStack(err)
 		}
-		environ := envars.Parse(os.Environ()).Apply(env.Root(), ops).Changed(true)
+		roots, err := env.Roots(l)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		// Packages may have changed, which the activation script picks up after applying the environment.
+		if _, err := env.UpdateCompletions(l); err != nil {
+			l.Warnf("Could not update package completions: %s", err)
+		}
+		environ := envars.Parse(os.Environ()).ApplyWithRoots(env.Root(), roots, ops).Changed(true)
 		return errors.WithStack(sh.ApplyEnvars(os.Stdout, environ))
 	}
 
@@ -73,7 +81,11 @@ func (e *envCmd) Run(l *ui.UI, env *hermit.Env) error {
 		if err != nil {
 			return errors.WithStack(err)
 		}
-		environ := envars.Parse(os.Environ()).Revert(env.Root(), ops).Changed(true)
+		roots, err := env.Roots(l)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		environ := envars.Parse(os.Environ()).RevertWithRoots(env.Root(), roots, ops).Changed(true)
 		return errors.WithStack(sh.ApplyEnvars(os.Stdout, environ))
 	}
 
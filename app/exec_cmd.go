@@ -5,7 +5,6 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/pkg/errors"
@@ -14,15 +13,28 @@ import (
 	"github.com/cashapp/hermit/manifest"
 	"github.com/cashapp/hermit/state"
 	"github.com/cashapp/hermit/ui"
+	"github.com/cashapp/hermit/util"
 	"github.com/cashapp/hermit/util/debug"
 )
 
 type execCmd struct {
-	Binary string   `arg:"" help:"Binary symlink to execute."`
+	Binary string   `arg:"" help:"Binary symlink to execute, or a package (<name>[-<version>] or <name>@<channel>) to run without installing it."`
 	Args   []string `arg:"" help:"Arguments to pass to executable (use -- to separate)." optional:""`
+	Bin    string   `placeholder:"NAME" help:"Binary to run from a package that isn't installed, if it isn't named after the package."`
+}
+
+func (e *execCmd) Help() string {
+	return `
+When given a package rather than a binary in the environment, eg. "hermit exec jq-1.7 -- .foo file.json",
+the package is downloaded to the shared state and its binary run with the environment applied, without
+installing it into the environment.
+`
 }
 
 func (e *execCmd) Run(l *ui.UI, sta *state.State, env *hermit.Env, globalState GlobalState, config Config, defaultHTTPClient *http.Client) error {
+	if _, err := os.Lstat(e.Binary); err != nil {
+		return e.runEphemeral(l, env)
+	}
 	envDir, err := hermit.EnvDirFromProxyLink(e.Binary)
 	if err != nil {
 		return errors.WithStack(err)
@@ -44,6 +56,13 @@ func (e *execCmd) Run(l *ui.UI, sta *state.State, env *hermit.Env, globalState G
 		return errors.WithStack(err)
 	}
 
+	// Switch to the Hermit release the environment uses, if it isn't this one.
+	if exe, err := env.HermitExecutable(l); err != nil {
+		l.Warnf("Could not switch to the Hermit release configured for this environment: %s", err)
+	} else if exe != "" && !sameFile(exe, self) {
+		return util.Exec(exe, append([]string{exe}, os.Args[1:]...), os.Environ())
+	}
+
 	// Upgrade hermit if necessary
 	pkgRef := filepath.Base(filepath.Dir(self))
 	if strings.HasPrefix(pkgRef, "hermit@") {
@@ -53,11 +72,19 @@ func (e *execCmd) Run(l *ui.UI, sta *state.State, env *hermit.Env, globalState G
 		}
 	}
 
+	// Skip resolving the package if this binary was executed with the same environment before,
+	// once the Hermit release the environment uses is running and up to date.
+	if !debug.Flags.NoExecSnapshots {
+		if binary, environ, ok := env.ExecSnapshot(e.Binary); ok {
+			return util.Exec(binary, args, environ)
+		}
+	}
+
 	// Special-case executing Hermit itself.
 	if filepath.Base(e.Binary) == "hermit" {
 		env := os.Environ()
 		env = append(env, "HERMIT_ENV="+envDir)
-		return syscall.Exec(self, args, env)
+		return util.Exec(self, args, env)
 	}
 
 	pkg, binary, err := env.ResolveLink(l, e.Binary)
@@ -83,6 +110,34 @@ func (e *execCmd) Run(l *ui.UI, sta *state.State, env *hermit.Env, globalState G
 	return env.Exec(l, pkg, binary, args, deps)
 }
 
+// Run a binary from a package that isn't installed in the environment.
+func (e *execCmd) runEphemeral(l *ui.UI, env *hermit.Env) error {
+	if env == nil {
+		return errors.Errorf("%s is not a binary, and running packages that aren't installed requires an active environment", e.Binary)
+	}
+	selector, err := manifest.ParseGlobSelector(e.Binary)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	pkg, err := env.Resolve(l, selector, true)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := pkg.EnsureSupported(); err != nil {
+		return errors.Wrapf(err, "execution failed")
+	}
+	installed, err := env.ListInstalledReferences()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	deps := map[string]*manifest.Package{}
+	err = env.ResolveWithDeps(l, installed, manifest.ExactSelector(pkg.Reference), deps)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return env.ExecEphemeral(l, pkg, e.Bin, e.Args, deps)
+}
+
 func updateHermit(l *ui.UI, env *hermit.Env, pkgRef string, force bool) error {
 	l.Tracef("Checking if %s needs to be updated", pkgRef)
 	pkg, err := env.Resolve(l, manifest.ExactSelector(manifest.ParseReference(pkgRef)), false)
@@ -106,3 +161,16 @@ func updateHermit(l *ui.UI, env *hermit.Env, pkgRef string, force bool) error {
 	}
 	return errors.WithStack(env.EnsureChannelIsUpToDate(l, pkg))
 }
+
+// Returns true if "a" and "b" are the same file.
+func sameFile(a, b string) bool {
+	ainfo, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	binfo, err := os.Stat(b)
+	if err != nil {
+		return false
+	}
+	return os.SameFile(ainfo, binfo)
+}
@@ -1,16 +1,75 @@
 package app
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/pkg/errors"
+
 	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/state"
 	"github.com/cashapp/hermit/ui"
 )
 
 type gcCmd struct {
-	Age time.Duration `help:"Age of packages to garbage collect." default:"168h"`
+	UnusedFor unusedFor     `help:"Remove packages and downloads not used for this long, eg. 12h or 90d." default:"7d"`
+	Age       time.Duration `help:"Deprecated, use --unused-for." hidden:""`
+	DryRun    bool          `help:"Report what would be removed without removing anything."`
 }
 
 func (g *gcCmd) Run(l *ui.UI, env *hermit.Env) error {
-	return env.GC(l, g.Age)
+	options := state.GCOptions{UnusedFor: time.Duration(g.UnusedFor), DryRun: g.DryRun}
+	if g.Age != 0 {
+		options.UnusedFor = g.Age
+	}
+	report, err := env.GC(l, options)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	verb := "Reclaimed"
+	if g.DryRun {
+		verb = "Would reclaim"
+		for _, pkg := range report.Packages {
+			l.Infof("Would remove %s", pkg)
+		}
+	}
+	l.Infof("%s %s from %d packages and %d downloads", verb, formatBytes(report.Reclaimed), len(report.Packages), report.Downloads)
+	return nil
+}
+
+// A duration that also accepts a number of days, eg. "90d".
+type unusedFor time.Duration
+
+func (u *unusedFor) UnmarshalText(text []byte) error {
+	s := string(text)
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.Atoi(strings.TrimSuffix(s, "d"))
+		if err != nil {
+			return errors.Errorf("invalid duration %q", s)
+		}
+		*u = unusedFor(time.Duration(days) * 24 * time.Hour)
+		return nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	*u = unusedFor(d)
+	return nil
+}
+
+// Format a size in bytes for humans.
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
 }
@@ -20,10 +20,9 @@ import (
 
 type infoCmd struct {
 	Packages []manifest.GlobSelector `arg:"" required:"" help:"Packages to retrieve information for" predictor:"package"`
-	JSON     bool                    `help:"Format information as a JSON array" default:"false"`
 }
 
-func (i *infoCmd) Run(l *ui.UI, env *hermit.Env, sta *state.State) error {
+func (i *infoCmd) Run(l *ui.UI, env *hermit.Env, sta *state.State, globalState GlobalState) error {
 	var installed map[string]*manifest.Package
 	var err error
 	packages := []*manifest.Package{}
@@ -58,7 +57,8 @@ func (i *infoCmd) Run(l *ui.UI, env *hermit.Env, sta *state.State) error {
 		envroot = env.Root()
 	}
 
-	if i.JSON {
+	// This predates the other JSON documents and is used as is by the IntelliJ plugin.
+	if globalState.JSON {
 		js, err := json.Marshal(packages)
 		if err != nil {
 			return errors.WithStack(err)
@@ -9,6 +9,7 @@ type initCmd struct {
 	NoGit   bool     `help:"Disable Hermit's automatic management of Git'"`
 	Idea    bool     `help:"Enable Hermit's automatic addition of its IntelliJ IDEA plugin"`
 	Sources []string `help:"Sources to sync package manifests from."`
+	Inherit string   `help:"Parent environment to inherit packages, sources and environment variables from, relative to the new environment." placeholder:"DIR"`
 	Dir     string   `arg:"" help:"Directory to create environment in (${default})." default:"${env}" predictor:"dir"`
 }
 
@@ -17,5 +18,6 @@ func (i *initCmd) Run(w *ui.UI, config Config) error {
 		Sources:     i.Sources,
 		ManageGit:   !i.NoGit,
 		AddIJPlugin: i.Idea,
+		Inherit:     i.Inherit,
 	})
 }
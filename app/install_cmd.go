@@ -3,12 +3,15 @@ package app
 import (
 	"fmt"
 	"os"
+	"runtime"
 
 	"github.com/pkg/errors"
 
 	"github.com/cashapp/hermit"
 	"github.com/cashapp/hermit/envars"
+	"github.com/cashapp/hermit/lockfile"
 	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/platform"
 	"github.com/cashapp/hermit/shell"
 	"github.com/cashapp/hermit/state"
 	"github.com/cashapp/hermit/ui"
@@ -16,12 +19,16 @@ import (
 
 type installCmd struct {
 	Packages []manifest.GlobSelector `arg:"" optional:"" name:"package" help:"Packages to install (<name>[-<version>]). Version can be a glob to find the latest version with." predictor:"package"`
+	Parallel int                     `help:"Maximum number of concurrent downloads." default:"4" env:"HERMIT_PARALLEL_DOWNLOADS"`
+	Locked   bool                    `help:"Refuse to install packages that deviate from bin/hermit.lock." env:"HERMIT_LOCKED"`
 }
 
 func (i *installCmd) Help() string {
 	return `
 Add the specified set of packages to the environment. If no packages are specified, all existing packages linked
 into the environment will be downloaded and installed. Packages will be pinned to the version resolved at install time.
+
+With --locked, every package must match the source and SHA256 recorded for it by "hermit lock".
 `
 }
 
@@ -30,7 +37,6 @@ func (i *installCmd) Run(l *ui.UI, env *hermit.Env, state *state.State) error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	pkgs := map[string]*manifest.Package{}
 	selectors := i.Packages
 
 	err = env.Sync(l, false)
@@ -38,22 +44,43 @@ func (i *installCmd) Run(l *ui.UI, env *hermit.Env, state *state.State) error {
 		return errors.WithStack(err)
 	}
 
+	var lock *lockfile.Lock
+	if i.Locked {
+		if lock, err = lockfile.Load(env.LockPath()); err != nil {
+			return errors.Wrap(err, "--locked requires a lock file, create one with \"hermit lock\"")
+		}
+	}
+
 	if len(selectors) == 0 {
 		// Checking that all the packages are downloaded and unarchived
+		resolved := make([]*manifest.Package, 0, len(installed))
 		for _, ref := range installed {
-			task := l.Task(ref.String())
 			pkg, err := env.Resolve(l, manifest.ExactSelector(ref), false)
 			if err != nil {
 				return errors.WithStack(err)
 			}
+			resolved = append(resolved, pkg)
+		}
+		if err := applyLock(lock, resolved); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := state.DownloadAll(l, resolved, i.Parallel); err != nil {
+			return errors.WithStack(err)
+		}
+		for _, pkg := range resolved {
+			task := l.Task(pkg.Reference.String())
 			err = state.CacheAndUnpack(task, pkg)
 			pkg.LogWarnings(l)
 			task.Done()
 			if err != nil {
 				return errors.WithStack(err)
 			}
+			// Stubs aren't committed, so may be missing from a fresh checkout.
+			if err := env.RestoreStubs(l, pkg); err != nil {
+				return errors.WithStack(err)
+			}
 		}
-		return nil
+		return errors.WithStack(env.LinkInherited(l))
 	}
 	// Check that we are not installing an already existing package
 	for _, selector := range selectors {
@@ -63,29 +90,40 @@ func (i *installCmd) Run(l *ui.UI, env *hermit.Env, state *state.State) error {
 			}
 		}
 	}
-	for i, search := range selectors {
-		err := env.ResolveWithDeps(l, installed, selectors[i], pkgs)
-		if err != nil {
-			return errors.Wrap(err, search.String())
-		}
+	requested := make([]manifest.Selector, 0, len(selectors))
+	for _, selector := range selectors {
+		requested = append(requested, selector)
+	}
+	graph, err := env.DependencyGraph(l, installed, requested...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// Skip possible dependencies that have already been installed
+	toInstall := graph.Uninstalled()
+	if err := applyLock(lock, toInstall); err != nil {
+		return errors.WithStack(err)
+	}
+	return installPackages(l, env, state, toInstall, graph.Dependents(), i.Parallel)
+}
+
+// Download packages, then install them in order and trigger their install events.
+//
+// Packages in "dependents" are recorded as installed for the package they map to.
+func installPackages(l *ui.UI, env *hermit.Env, state *state.State, pkgs []*manifest.Package, dependents map[string]*manifest.Package, parallel int) error {
+	if err := state.DownloadAll(l, pkgs, parallel); err != nil {
+		return errors.WithStack(err)
 	}
 	changes := shell.NewChanges(envars.Parse(os.Environ()))
 	w := l.WriterAt(ui.LevelInfo)
 	defer w.Sync() // nolint
 	for _, pkg := range pkgs {
-		// Skip possible dependencies that have already been installed
-		exists := false
-		for _, ref := range installed {
-			if ref.String() == pkg.Reference.String() {
-				exists = true
-				break
-			}
+		var c *shell.Changes
+		var err error
+		if dependent, ok := dependents[pkg.Reference.String()]; ok {
+			c, err = env.InstallDependency(l, pkg, dependent)
+		} else {
+			c, err = env.Install(l, pkg)
 		}
-		if exists {
-			continue
-		}
-
-		c, err := env.Install(l, pkg)
 		if err != nil {
 			return errors.WithStack(err)
 		}
@@ -101,3 +139,17 @@ func (i *installCmd) Run(l *ui.UI, env *hermit.Env, state *state.State) error {
 	}
 	return nil
 }
+
+// Verify that packages match the lock, if any, for the current platform.
+func applyLock(lock *lockfile.Lock, pkgs []*manifest.Package) error {
+	if lock == nil {
+		return nil
+	}
+	current := platform.Platform{OS: runtime.GOOS, Arch: runtime.GOARCH}
+	for _, pkg := range pkgs {
+		if err := lock.Apply(pkg, current); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
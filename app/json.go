@@ -0,0 +1,97 @@
+package app
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+)
+
+// The version of the documents output with --json.
+//
+// This must be incremented when fields are removed, renamed or change
+// meaning. Adding fields is not a breaking change.
+const jsonSchemaVersion = 1
+
+// Common to all documents output with --json.
+type jsonDocument struct {
+	SchemaVersion int `json:"schemaVersion"`
+}
+
+func newJSONDocument() jsonDocument { return jsonDocument{SchemaVersion: jsonSchemaVersion} }
+
+// A package as output with --json.
+type jsonPackage struct {
+	Reference   string `json:"reference"`
+	Name        string `json:"name"`
+	Version     string `json:"version,omitempty"`
+	Channel     string `json:"channel,omitempty"`
+	Description string `json:"description"`
+	Homepage    string `json:"homepage,omitempty"`
+	State       string `json:"state"`
+	Installed   bool   `json:"installed"`
+	Supported   bool   `json:"supported"`
+}
+
+func newJSONPackage(pkg *manifest.Package) jsonPackage {
+	return jsonPackage{
+		Reference:   pkg.Reference.String(),
+		Name:        pkg.Reference.Name,
+		Version:     pkg.Reference.Version.String(),
+		Channel:     pkg.Reference.Channel,
+		Description: pkg.Description,
+		Homepage:    pkg.Homepage,
+		State:       pkg.State.String(),
+		Installed:   pkg.Linked,
+		Supported:   !pkg.Unsupported(),
+	}
+}
+
+type jsonPackages struct {
+	jsonDocument
+	Packages []jsonPackage `json:"packages"`
+}
+
+func newJSONPackages(pkgs manifest.Packages) jsonPackages {
+	doc := jsonPackages{jsonDocument: newJSONDocument(), Packages: make([]jsonPackage, 0, len(pkgs))}
+	for _, pkg := range pkgs {
+		doc.Packages = append(doc.Packages, newJSONPackage(pkg))
+	}
+	return doc
+}
+
+// Print a document to stdout as indented JSON.
+func printJSON(l *ui.UI, doc interface{}) error {
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	l.Printf("%s\n", data)
+	return nil
+}
+
+// The result of a validation command as output with --json.
+type jsonValidation struct {
+	jsonDocument
+	Valid  bool                  `json:"valid"`
+	Issues []jsonValidationIssue `json:"issues"`
+}
+
+type jsonValidationIssue struct {
+	Path    string `json:"path"`
+	Line    int    `json:"line,omitempty"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+	// Set by "hermit manifest lint".
+	Check string `json:"check,omitempty"`
+	Fixed bool   `json:"fixed,omitempty"`
+}
+
+func newJSONValidation(issues []jsonValidationIssue) jsonValidation {
+	if issues == nil {
+		issues = []jsonValidationIssue{}
+	}
+	return jsonValidation{jsonDocument: newJSONDocument(), Valid: len(issues) == 0, Issues: issues}
+}
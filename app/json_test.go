@@ -0,0 +1,66 @@
+package app
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/hermittest"
+	"github.com/cashapp/hermit/manifest/manifesttest"
+	"github.com/cashapp/hermit/ui"
+)
+
+func TestListJSON(t *testing.T) {
+	l, buf := ui.NewForTesting()
+	f := hermittest.NewEnvTestFixture(t, nil).WithManifests(map[string]string{
+		"test.hcl": `
+			description = "test package"
+			binaries = ["darwin_exe", "linux_exe"]
+			version "1" {
+			  source = "www.example.com"
+			}
+		`,
+	})
+	defer f.Clean()
+	pkg := manifesttest.NewPkgBuilder(filepath.Join(f.RootDir(), "test-1")).
+		WithVersion("1").
+		WithSource("../archive/testdata/archive.tar.gz").
+		Result()
+	_, err := f.Env.Install(f.P, pkg)
+	require.NoError(t, err)
+
+	cmd := listCmd{}
+	require.NoError(t, cmd.Run(l, f.Env, GlobalState{JSON: true}))
+	require.JSONEq(t, `{
+		"schemaVersion": 1,
+		"packages": [{
+			"reference": "test-1",
+			"name": "test",
+			"version": "1",
+			"description": "test package",
+			"state": "installed",
+			"installed": true,
+			"supported": true
+		}]
+	}`, buf.String())
+}
+
+func TestValidateScriptJSON(t *testing.T) {
+	l, buf := ui.NewForTesting()
+	script := filepath.Join(t.TempDir(), "script.sh")
+	require.NoError(t, ioutil.WriteFile(script, []byte("echo hello\ncurl example.com\n"), 0600))
+
+	cmd := validateScriptCmd{Script: []string{script}}
+	require.Error(t, cmd.Run(l, nil, GlobalState{JSON: true}))
+	doc := jsonValidation{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &doc))
+	require.Equal(t, 1, doc.SchemaVersion)
+	require.False(t, doc.Valid)
+	require.Len(t, doc.Issues, 1)
+	require.Equal(t, 2, doc.Issues[0].Line)
+	require.Equal(t, 1, doc.Issues[0].Column)
+	require.Equal(t, "unsupported external command: curl", doc.Issues[0].Message)
+}
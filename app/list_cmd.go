@@ -20,11 +20,14 @@ type listCmd struct {
 	Short bool `short:"s" help:"Short listing."`
 }
 
-func (cmd *listCmd) Run(l *ui.UI, env *hermit.Env) error {
+func (cmd *listCmd) Run(l *ui.UI, env *hermit.Env, globalState GlobalState) error {
 	pkgs, err := env.ListInstalled(l)
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	if globalState.JSON {
+		return printJSON(l, newJSONPackages(pkgs))
+	}
 	if cmd.Short {
 		for _, pkg := range pkgs {
 			fmt.Println(pkg)
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/platform"
+	"github.com/cashapp/hermit/ui"
+)
+
+type lockCmd struct {
+	Platform []string `help:"Platforms to lock packages for, as <os>-<arch>." default:"${platforms}"`
+}
+
+// The platforms packages are locked for by default, as a comma separated
+// list: every combination of the OSes and architectures of the core platforms.
+func corePlatforms() string {
+	platforms := []string{}
+	seen := map[string]bool{}
+	for _, o := range platform.Core {
+		for _, a := range platform.Core {
+			p := platform.Platform{OS: o.OS, Arch: a.Arch}.String()
+			if !seen[p] {
+				seen[p] = true
+				platforms = append(platforms, p)
+			}
+		}
+	}
+	return strings.Join(platforms, ",")
+}
+
+func (c *lockCmd) Help() string {
+	return `
+Record the exact source and SHA256 that each installed package resolves to on each platform in bin/hermit.lock.
+Sources without a known SHA256 are downloaded to compute it. Install with "hermit install --locked" to refuse to
+deviate from the lock file.
+`
+}
+
+func (c *lockCmd) Run(l *ui.UI, env *hermit.Env) error {
+	platforms := make([]platform.Platform, 0, len(c.Platform))
+	for _, p := range c.Platform {
+		parsed, err := platform.Parse(p)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		platforms = append(platforms, parsed)
+	}
+	if err := env.Sync(l, false); err != nil {
+		return errors.WithStack(err)
+	}
+	lock, err := env.Lock(l, platforms)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(lock.Save(env.LockPath()))
+}
@@ -32,10 +32,10 @@ func TestLogs(t *testing.T) {
 			require.NoError(t, err)
 		},
 		tmpl: `
+			debug:tpkg-0.9.0:download: Downloading {{.Source}}
 			info:tpkg-0.9.0:install: Installing tpkg-0.9.0
 			debug:tpkg-0.9.0:install: From {{.Source}}
 			debug:tpkg-0.9.0:install: To {{.State}}/pkg/tpkg-0.9.0
-			debug:tpkg-0.9.0:download: Downloading {{.Source}}
 			debug:tpkg-0.9.0:unpack: Extracting {{.Cache}} to {{.State}}/pkg/tpkg-0.9.0
 			debug:tpkg-0.9.0:link: Linking binaries for tpkg-0.9.0
 			debug:tpkg-0.9.0:link: ln -s "hermit" "{{.Bin}}/.tpkg-0.9.0.pkg"
@@ -66,12 +66,17 @@ func TestLogs(t *testing.T) {
 			require.NoError(t, err)
 		},
 		tmpl: `
-			debug: rm -rf "{{.State}}/cache"
 			info:tpkg-0.9.0: Clearing tpkg-0.9.0
 			debug:tpkg-0.9.0:remove: chmod -R +w {{.State}}/binaries/tpkg-0.9.0
 			debug:tpkg-0.9.0:remove: rm -rf {{.State}}/binaries/tpkg-0.9.0
 			debug:tpkg-0.9.0:remove: chmod -R +w {{.State}}/pkg/tpkg-0.9.0
-			debug:tpkg-0.9.0:remove: rm -rf {{.State}}/pkg/tpkg-0.9.0`,
+			debug:tpkg-0.9.0:remove: rm -rf {{.State}}/pkg/tpkg-0.9.0
+			debug:cache: Clearing download {{.CacheName}}
+			debug:cache:remove: chmod -R +w {{.Cache}}
+			debug:cache:remove: rm -rf {{.Cache}}
+			debug:cache:remove: chmod -R +w {{.Cache}}.lock
+			debug:cache:remove: rm -rf {{.Cache}}.lock
+			info: Reclaimed 15.9 KiB from 1 packages and 1 downloads`,
 	}, {
 		name: "uninstall",
 		fn: func(l *ui.UI, f *hermittest.EnvTestFixture) {
@@ -122,11 +127,12 @@ func testLogsFor(
 	l.SetLevel(ui.LevelDebug)
 
 	type state struct {
-		Source string
-		Cache  string
-		State  string
-		Env    string
-		Bin    string
+		Source    string
+		Cache     string
+		CacheName string
+		State     string
+		Env       string
+		Bin       string
 	}
 
 	trimmed := strings.TrimSpace(trimLines(tmpl))
@@ -136,11 +142,12 @@ func testLogsFor(
 	tbuf := bytes.Buffer{}
 	uri := f.Server.URL + "/archive.tar.gz"
 	err = expected.Execute(&tbuf, state{
-		Source: uri,
-		State:  f.State.Root(),
-		Cache:  filepath.Join(f.State.Root(), "cache", cache.BasePath("", uri)),
-		Env:    f.Env.EnvDir(),
-		Bin:    f.Env.BinDir(),
+		Source:    uri,
+		State:     f.State.Root(),
+		Cache:     filepath.Join(f.State.Root(), "cache", cache.BasePath("", uri)),
+		CacheName: filepath.Base(cache.BasePath("", uri)),
+		Env:       f.Env.EnvDir(),
+		Bin:       f.Env.BinDir(),
 	})
 	require.NoError(t, err)
 
@@ -2,24 +2,39 @@ package app
 
 import (
 	"bufio"
+	"context"
 	"log"
 	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"runtime/pprof"
+	"strconv"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kong"
 	"github.com/mattn/go-isatty"
+	"github.com/pkg/errors"
 	"github.com/posener/complete"
 	"github.com/willabides/kongplete"
 
 	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/buckets"
 	"github.com/cashapp/hermit/cache"
 	"github.com/cashapp/hermit/github"
+	"github.com/cashapp/hermit/gitlab"
+	"github.com/cashapp/hermit/httpsource"
+	"github.com/cashapp/hermit/oci"
+	"github.com/cashapp/hermit/retry"
+	"github.com/cashapp/hermit/sandbox"
+	"github.com/cashapp/hermit/sources"
 	"github.com/cashapp/hermit/state"
+	"github.com/cashapp/hermit/telemetry"
 	"github.com/cashapp/hermit/ui"
 	"github.com/cashapp/hermit/util/debug"
 )
@@ -90,8 +105,20 @@ func (c Config) defaultHTTPClient() *http.Client {
 	return c.makeHTTPClient(HTTPTransportConfig{})
 }
 
+// Built-in manifest source backends, eg. for OCI registries, are used unless a custom build provides its own.
+func registerBackend(scheme string, backend sources.Backend) {
+	for _, registered := range sources.Schemes() {
+		if registered == scheme {
+			return
+		}
+	}
+	sources.Register(scheme, backend)
+}
+
 // Main runs the Hermit command-line application with the given config.
 func Main(config Config) {
+	// Programs embedding Hermit may not have initialised the sandbox themselves.
+	sandbox.Init()
 	if config.HTTP == nil {
 		config.HTTP = func(config HTTPTransportConfig) *http.Client {
 			transport := &http.Transport{
@@ -171,15 +198,25 @@ func Main(config Config) {
 		log.Printf("%s: %s", userConfigPath, err)
 	}
 
-	githubToken := os.Getenv("HERMIT_GITHUB_TOKEN")
-	if githubToken == "" {
-		githubToken = os.Getenv("GITHUB_TOKEN")
+	gitlabToken := os.Getenv("HERMIT_GITLAB_TOKEN")
+	if gitlabToken == "" {
+		gitlabToken = os.Getenv("GITLAB_TOKEN")
+	}
+	gitlabURL := os.Getenv("HERMIT_GITLAB_URL")
+	if gitlabURL == "" {
+		gitlabURL = gitlab.DefaultBaseURL
 	}
 
 	hermitHelp := help
 	hermitHelp += "\n\nConfiguration format for ~/.hermit.hcl:\n"
 	hermitHelp += "    " + strings.Join(strings.Split(userConfigSchema, "\n"), "\n    ")
-	hermitHelp += "\nGITHUB_TOKEN can be set to retrieve private GitHub release assets."
+	hermitHelp += "\nGITHUB_TOKEN can be set to retrieve private GitHub release assets, otherwise gh CLI and ~/.netrc credentials are used."
+	hermitHelp += "\nHERMIT_GITHUB_URL (and optionally HERMIT_GITHUB_API_URL, default $HERMIT_GITHUB_URL/api/v3) select a GitHub Enterprise Server instance."
+	hermitHelp += "\nHERMIT_GITHUB_VERIFICATION (off, warn or require) controls handling of private GitHub release assets"
+	hermitHelp += "\nwithout checksums, when downloaded via the GitHub API using GITHUB_TOKEN."
+	hermitHelp += "\nHERMIT_RETRY_ATTEMPTS, HERMIT_RETRY_MIN_BACKOFF, HERMIT_RETRY_MAX_BACKOFF and HERMIT_RETRY_STATUS_CODES (comma separated)"
+	hermitHelp += "\noverride the policy for retrying network operations, including the retry block of bin/hermit.hcl."
+	hermitHelp += "\nGITLAB_TOKEN can be set to retrieve private GitLab release assets from HERMIT_GITLAB_URL (default " + gitlab.DefaultBaseURL + ")."
 
 	kongOptions := []kong.Option{
 		kong.Groups{
@@ -192,8 +229,10 @@ func Main(config Config) {
 		kong.BindTo(cli, (*cliCommon)(nil)),
 		kong.Bind(userConfig, config),
 		kong.Vars{
-			"version": config.Version,
-			"env":     envPath,
+			"version":   config.Version,
+			"env":       envPath,
+			"state":     hermit.UserStateDir,
+			"platforms": corePlatforms(),
 		},
 		kong.HelpOptions{
 			Compact: true,
@@ -207,27 +246,114 @@ func Main(config Config) {
 	}
 
 	downloadStrategies := config.DownloadStrategies
-	defaultHTTPClient := config.defaultHTTPClient()
+	// Mirrors are configured once the environment has been opened.
+	mirrors := cache.NewMirrors()
+	// As is the retry policy, which environment variables override.
+	retryPolicy, err := retryPolicyFromEnv(retry.DefaultPolicy)
+	if err != nil {
+		log.Fatalf("%s", err)
+	}
+	retrier := retry.New(retryPolicy)
+	verification, err := github.ParseVerificationLevel(os.Getenv("HERMIT_GITHUB_VERIFICATION"))
+	if err != nil {
+		log.Fatalf("HERMIT_GITHUB_VERIFICATION: %s", err)
+	}
+	ghOptions := []github.Option{
+		github.WithLogger(p),
+		github.WithRequireVerification(verification),
+		// Under the download cache so that "hermit clean --cache" removes it too.
+		github.WithCache(filepath.Join(hermit.UserStateDir, "cache", "github-api")),
+		github.WithTransportWrapper(func(transport http.RoundTripper) http.RoundTripper {
+			return mirrors.WithTransport(retrier.WithTransport(transport))
+		}),
+	}
+	githubWebHost, githubAPIHost := "github.com", "api.github.com"
+	if githubURL := os.Getenv("HERMIT_GITHUB_URL"); githubURL != "" {
+		githubAPIURL := os.Getenv("HERMIT_GITHUB_API_URL")
+		if githubAPIURL == "" {
+			githubAPIURL = strings.TrimSuffix(githubURL, "/") + "/api/v3"
+		}
+		ghOptions = append(ghOptions, github.WithBaseURL(githubAPIURL, githubURL))
+		githubWebHost, githubAPIHost = urlHost(githubURL), urlHost(githubAPIURL)
+	}
+	ghOptions = append(ghOptions, github.WithTokenSource(github.DefaultTokenSource(githubWebHost, githubAPIHost)))
+	ghClient := github.New(userConfig.GitHubToken, ghOptions...)
 
-	ghClient := github.New(githubToken)
-	if githubToken != "" {
+	ociClient := oci.New(mirrors.Wrap(retrier.Wrap(config.defaultHTTPClient())))
+	// Throttled requests are retried by the shared retry policy instead.
+	bucketsClient := buckets.New(mirrors.Wrap(retrier.Wrap(config.defaultHTTPClient())), buckets.WithRetries(0, 0, 0))
+	httpSourceClient := httpsource.New(mirrors.Wrap(retrier.Wrap(config.defaultHTTPClient())))
+	wrap := func(client *http.Client) *http.Client {
+		client = httpSourceClient.Wrap(bucketsClient.Wrap(ociClient.Wrap(client)))
+		withAssets := *client
+		withAssets.Transport = cache.GitHubAssetTransport(ghClient, client.Transport)
+		return mirrors.Wrap(&withAssets)
+	}
+	defaultHTTPClient := wrap(retrier.Wrap(config.defaultHTTPClient()))
+	fastHTTPClient := wrap(config.fastHTTPClient())
+	registerBackend("oci", ociClient.Backend())
+	registerBackend("s3", bucketsClient.Backend())
+	registerBackend("gs", bucketsClient.Backend())
+	registerBackend("http", httpSourceClient.Backend())
+	registerBackend("https", httpSourceClient.Backend())
+	// Only try private releases if there may be a token, as resolving one can run "gh auth token".
+	if userConfig.GitHubToken != "" || github.DefaultTokenAvailable(githubWebHost, githubAPIHost) {
 		downloadStrategies = append(downloadStrategies, cache.GitHubPrivateReleaseDownloadStrategy(ghClient))
 	}
+	glClient := gitlab.New(gitlabToken, gitlab.WithBaseURL(gitlabURL))
+	if gitlabToken != "" {
+		downloadStrategies = append(downloadStrategies, cache.GitLabPrivateReleaseDownloadStrategy(glClient))
+	}
 
-	cache, err := cache.Open(hermit.UserStateDir, downloadStrategies, defaultHTTPClient, config.fastHTTPClient())
+	cache, err := cache.Open(hermit.UserStateDir, downloadStrategies, defaultHTTPClient, fastHTTPClient)
 	if err != nil {
 		log.Fatalf("failed to open cache: %s", err)
 	}
+	// Cancel in-flight HTTP work on the first interrupt, and restore the default
+	// behaviour so that a second interrupt terminates immediately.
+	interruptCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-interruptCtx.Done()
+		stop()
+	}()
+	cache = cache.WithContext(interruptCtx)
+	config.State.Retrier = retrier
 	sta, err = state.Open(hermit.UserStateDir, config.State, cache)
 	if err != nil {
 		log.Fatalf("failed to open state: %s", err)
 	}
 
+	var recorder *telemetry.Recorder
+	if userConfig.Telemetry {
+		recorder = telemetry.New(telemetryLogPath(), userConfig.TelemetryURL, fastHTTPClient)
+	}
+
 	if isActivated {
 		env, err = hermit.OpenEnv(envPath, sta, cli.getGlobalState().Env, defaultHTTPClient)
 		if err != nil {
 			log.Fatalf("failed to open environment: %s", err)
 		}
+		env.SetTelemetry(recorder)
+		// Profiles activated with "hermit activate --profile".
+		env.SetProfiles(strings.Split(os.Getenv("HERMIT_PROFILES"), ","))
+		envMirrors, err := env.Mirrors()
+		if err != nil {
+			log.Fatalf("%s: %s", envPath, err)
+		}
+		if err := mirrors.SetMirrors(envMirrors); err != nil {
+			log.Fatalf("%s: %s", envPath, err)
+		}
+		envRetryPolicy, err := env.RetryPolicy(retry.DefaultPolicy)
+		if err != nil {
+			log.Fatalf("%s: %s", envPath, err)
+		}
+		if envRetryPolicy, err = retryPolicyFromEnv(envRetryPolicy); err != nil {
+			log.Fatalf("%s", err)
+		}
+		if err := retrier.SetPolicy(envRetryPolicy); err != nil {
+			log.Fatalf("%s: %s", envPath, err)
+		}
 	}
 
 	packagePredictor := hermit.NewPackagePredictor(sta, env, p)
@@ -239,9 +365,19 @@ func Main(config Config) {
 		kongplete.WithPredictor("hclfile", complete.PredictFiles("*.hcl")),
 	)
 
-	ctx, err := parser.Parse(os.Args[1:])
+	args := os.Args[1:]
+	// On Windows package binaries are .exe stubs, which are copies of Hermit itself.
+	if self, err := os.Executable(); err == nil && hermit.IsExeStub(self) {
+		args = append([]string{"--level=fatal", "exec", self, "--"}, args...)
+	}
+	ctx, err := parser.Parse(args)
 	parser.FatalIfErrorf(err)
 	configureLogging(cli, ctx.Command(), p)
+	sta.SetOffline(cli.getOffline())
+	sta.SetInsecureSkipVerify(cli.getInsecureSkipVerify())
+	sandbox.AllowUnconfined(cli.getInsecureNoSandbox())
+	sta.SetLockTimeout(cli.getLockTimeout())
+	ctx.BindTo(interruptCtx, (*context.Context)(nil))
 
 	if pprofPath := cli.getCPUProfile(); pprofPath != "" {
 		f, err := os.Create(pprofPath)
@@ -260,7 +396,12 @@ func Main(config Config) {
 		err = pprof.WriteHeapProfile(f)
 		fatalIfError(p, err)
 	}
-	err = ctx.Run(env, p, sta, config, cli.getGlobalState(), ghClient, defaultHTTPClient)
+	err = ctx.Run(env, p, sta, config, cli.getGlobalState(), ghClient, glClient, defaultHTTPClient)
+	if !sta.Offline() {
+		if err := recorder.Push(interruptCtx); err != nil {
+			p.Debugf("Failed to push telemetry: %s", err)
+		}
+	}
 	if err != nil && p.WillLog(ui.LevelDebug) {
 		p.Fatalf("%+v", err)
 	} else {
@@ -304,3 +445,46 @@ func fatalIfError(logger *ui.UI, err error) {
 		logger.Task("hermit").Fatalf("%s", err)
 	}
 }
+
+// Returns the host of "uri", or "" if it isn't a valid URL.
+func urlHost(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// Returns "policy" with the overrides from HERMIT_RETRY_* environment variables applied.
+func retryPolicyFromEnv(policy retry.Policy) (retry.Policy, error) {
+	if value := os.Getenv("HERMIT_RETRY_ATTEMPTS"); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil {
+			return policy, errors.Wrap(err, "HERMIT_RETRY_ATTEMPTS")
+		}
+		policy.Attempts = attempts
+	}
+	for name, backoff := range map[string]*time.Duration{
+		"HERMIT_RETRY_MIN_BACKOFF": &policy.MinBackoff,
+		"HERMIT_RETRY_MAX_BACKOFF": &policy.MaxBackoff,
+	} {
+		if value := os.Getenv(name); value != "" {
+			duration, err := time.ParseDuration(value)
+			if err != nil {
+				return policy, errors.Wrap(err, name)
+			}
+			*backoff = duration
+		}
+	}
+	if value := os.Getenv("HERMIT_RETRY_STATUS_CODES"); value != "" {
+		policy.StatusCodes = nil
+		for _, code := range strings.Split(value, ",") {
+			status, err := strconv.Atoi(strings.TrimSpace(code))
+			if err != nil {
+				return policy, errors.Wrap(err, "HERMIT_RETRY_STATUS_CODES")
+			}
+			policy.StatusCodes = append(policy.StatusCodes, status)
+		}
+	}
+	return policy, errors.Wrap(policy.Validate(), "HERMIT_RETRY_*")
+}
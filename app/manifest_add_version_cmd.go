@@ -0,0 +1,35 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/github"
+	"github.com/cashapp/hermit/manifest/autoversion"
+	"github.com/cashapp/hermit/ui"
+)
+
+type manifestAddVersionCmd struct {
+	PkgVersion []string `help:"Versions to add. If omitted, adds all releases newer than the highest version in the manifest."`
+	Repo       string   `help:"GitHub <owner>/<repo> to discover releases from, if it can't be inferred from the manifest."`
+	Manifest   string   `arg:"" type:"existingfile" help:"Manifest to add versions to." predictor:"hclfile"`
+}
+
+func (m *manifestAddVersionCmd) Run(ctx context.Context, l *ui.UI, defaultHTTPClient *http.Client, ghClient *github.Client) error {
+	added, err := autoversion.AddVersions(ctx, l, defaultHTTPClient, ghClient, m.Manifest, autoversion.AddVersionOptions{
+		Versions: m.PkgVersion,
+		Repo:     m.Repo,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(added) == 0 {
+		l.Infof("%s is up to date", m.Manifest)
+		return nil
+	}
+	l.Infof("Added %s to %s", strings.Join(added, ", "), m.Manifest)
+	return nil
+}
@@ -1,7 +1,10 @@
 package app
 
 type manifestCmd struct {
-	Validate    validateSourceCmd `cmd:"" help:"Check a package manifest source for errors." group:"global"`
-	AutoVersion autoVersionCmd    `cmd:"" help:"Upgrade manifest versions automatically where possible." group:"global"`
-	Create      manifestCreateCmd `cmd:"" help:"Create a new manifest from an existing package artefact URL." group:"global"`
+	Validate    validateSourceCmd     `cmd:"" help:"Check a package manifest source for errors." group:"global"`
+	AutoVersion autoVersionCmd        `cmd:"" help:"Upgrade manifest versions automatically where possible." group:"global"`
+	Create      manifestCreateCmd     `cmd:"" help:"Create a new manifest from an existing package artefact URL." group:"global"`
+	AddVersion  manifestAddVersionCmd `cmd:"" help:"Add versions released on GitHub to a manifest, with the SHA256 of each source." group:"global"`
+	Test        manifestTestCmd       `cmd:"" help:"Download, verify and unpack every version of a package on every platform." group:"global"`
+	Lint        manifestLintCmd       `cmd:"" help:"Check manifests for problems beyond errors, optionally fixing them." group:"global"`
 }
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"net/http"
 
@@ -17,8 +18,8 @@ type manifestCreateCmd struct {
 	URL        string `arg:"" required:"" help:"URL of a package artefact."`
 }
 
-func (m *manifestCreateCmd) Run(p *ui.UI, defaultHTTPClient *http.Client, ghClient *github.Client) error {
-	pkg, err := manifest.InferFromArtefact(p, defaultHTTPClient, ghClient, m.URL, m.PkgVersion)
+func (m *manifestCreateCmd) Run(ctx context.Context, p *ui.UI, defaultHTTPClient *http.Client, ghClient *github.Client) error {
+	pkg, err := manifest.InferFromArtefact(ctx, p, defaultHTTPClient, ghClient, m.URL, m.PkgVersion)
 	if err != nil {
 		return errors.WithStack(err)
 	}
@@ -0,0 +1,77 @@
+package app
+
+import (
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest/lint"
+	"github.com/cashapp/hermit/state"
+	"github.com/cashapp/hermit/ui"
+)
+
+type manifestLintCmd struct {
+	Fix      bool     `help:"Rewrite manifests to fix mechanical problems."`
+	SkipURLs bool     `name:"skip-urls" help:"Don't check that source URLs are reachable."`
+	Manifest []string `arg:"" type:"existingfile" required:"" help:"Manifests to lint." predictor:"hclfile"`
+}
+
+func (m *manifestLintCmd) Help() string {
+	return `
+Each manifest is checked against the schema for every version on each of the
+core platforms. Problems reported are:
+
+  schema           the manifest doesn't match the schema
+  unused-platform  platform blocks or attributes that never apply
+  missing-sha256   versions whose source has no sha256 on some platform
+  version-order    versions that aren't in ascending order, or are repeated
+  unreachable-url  sources that respond to a HEAD request with an error
+  deprecated       deprecated attributes or blocks
+
+With --fix, empty platform blocks and ignored "arch" attributes are removed,
+versions are sorted, and deprecated attributes are renamed to their
+replacements. Other problems must be fixed by hand.
+`
+}
+
+func (m *manifestLintCmd) Run(l *ui.UI, defaultHTTPClient *http.Client, sta *state.State, globalState GlobalState) error {
+	options := lint.Options{Fix: m.Fix}
+	if !m.SkipURLs && !sta.Offline() {
+		options.HTTPClient = defaultHTTPClient
+	}
+	var issues []jsonValidationIssue
+	remaining := 0
+	for _, path := range m.Manifest {
+		found, err := lint.Lint(l, path, options)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, issue := range found {
+			if !issue.Fixed {
+				remaining++
+			}
+			if !globalState.JSON {
+				l.Printf("%s:%s\n", path, issue)
+			}
+			issues = append(issues, jsonValidationIssue{
+				Path:    path,
+				Line:    issue.Pos.Line,
+				Column:  issue.Pos.Column,
+				Check:   string(issue.Check),
+				Message: issue.Message,
+				Fixed:   issue.Fixed,
+			})
+		}
+	}
+	if globalState.JSON {
+		doc := newJSONValidation(issues)
+		doc.Valid = remaining == 0
+		if err := printJSON(l, doc); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if remaining > 0 {
+		return errors.Errorf("%d problems found", remaining)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/ui"
+)
+
+type manifestTestCmd struct {
+	Packages []string `arg:"" name:"package" help:"Packages to test every version and platform of." predictor:"package"`
+}
+
+// The result of testing a package on a platform, as output by "hermit manifest test".
+type manifestTestResult struct {
+	Package  string   `json:"package"`
+	Platform string   `json:"platform"`
+	Source   string   `json:"source,omitempty"`
+	Binaries []string `json:"binaries,omitempty"`
+	Tested   bool     `json:"tested"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type jsonManifestTest struct {
+	jsonDocument
+	Results []manifestTestResult `json:"results"`
+}
+
+func (m *manifestTestCmd) Help() string {
+	return `
+For each version of each package, and each platform it has a source for, the
+source is downloaded and its SHA256 verified, then it is unpacked into a
+temporary directory and the package's binaries are checked to exist. On the
+native platform the package's test command is also run.
+`
+}
+
+func (m *manifestTestCmd) Run(l *ui.UI, env *hermit.Env, globalState GlobalState) error {
+	if env == nil {
+		return errors.New("hermit manifest test must be run in a Hermit environment")
+	}
+	var results []manifestTestResult
+	failed := 0
+	for _, name := range m.Packages {
+		tests, err := env.TestManifest(l, name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, test := range tests {
+			result := manifestTestResult{
+				Package:  test.Reference.String(),
+				Platform: test.Platform.String(),
+				Source:   test.Source,
+				Binaries: test.Binaries,
+				Tested:   test.Tested,
+			}
+			if test.Err != nil {
+				result.Error = test.Err.Error()
+				failed++
+			}
+			results = append(results, result)
+		}
+	}
+
+	if globalState.JSON {
+		if err := printJSON(l, jsonManifestTest{jsonDocument: newJSONDocument(), Results: results}); err != nil {
+			return errors.WithStack(err)
+		}
+	} else {
+		out := &strings.Builder{}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PACKAGE\tPLATFORM\tRESULT\t")
+		for _, r := range results {
+			status := "ok"
+			switch {
+			case r.Error != "":
+				status = "FAIL: " + r.Error
+			case r.Tested:
+				status = "ok (tested)"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t\n", r.Package, r.Platform, status)
+		}
+		if err := w.Flush(); err != nil {
+			return errors.WithStack(err)
+		}
+		l.Printf("%s", out.String())
+	}
+	if failed > 0 {
+		return errors.Errorf("%d of %d package platforms failed", failed, len(results))
+	}
+	return nil
+}
@@ -0,0 +1,166 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/github"
+	"github.com/cashapp/hermit/gitlab"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/manifest/autoversion"
+	"github.com/cashapp/hermit/state"
+	"github.com/cashapp/hermit/ui"
+)
+
+type outdatedCmd struct {
+	Packages []string `arg:"" optional:"" name:"package" help:"Packages to check. If omitted, checks all installed packages." predictor:"installed-package"`
+}
+
+// An installed package as output by "hermit outdated".
+type outdatedPackage struct {
+	Name    string `json:"name"`
+	Current string `json:"current"`
+	// The version "hermit upgrade" would upgrade to.
+	Latest string `json:"latest,omitempty"`
+	// The newest version released upstream, from the package's auto-version configuration.
+	Upstream string `json:"upstream,omitempty"`
+	Outdated bool   `json:"outdated"`
+}
+
+type jsonOutdated struct {
+	jsonDocument
+	Packages []outdatedPackage `json:"packages"`
+}
+
+func (o *outdatedCmd) Run(
+	ctx context.Context, l *ui.UI, env *hermit.Env, sta *state.State, globalState GlobalState,
+	defaultHTTPClient *http.Client, ghClient *github.Client, glClient *gitlab.Client,
+) error {
+	if err := env.Sync(l, false); err != nil {
+		return errors.WithStack(err)
+	}
+	installed, err := env.ListInstalled(l)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	pkgs := installed
+	if len(o.Packages) > 0 {
+		byName := map[string]*manifest.Package{}
+		for _, pkg := range installed {
+			byName[pkg.Reference.Name] = pkg
+		}
+		pkgs = nil
+		for _, name := range o.Packages {
+			if byName[name] == nil {
+				return errors.Errorf("no installed package '%s' found.", name)
+			}
+			pkgs = append(pkgs, byName[name])
+		}
+	}
+
+	if !sta.Offline() {
+		prefetchUpstreamReleases(ctx, l, env, pkgs, ghClient)
+	}
+
+	results := make([]outdatedPackage, 0, len(pkgs))
+	outdated := 0
+	for _, pkg := range pkgs {
+		result := outdatedPackage{Name: pkg.Reference.Name, Current: pkg.Reference.StringNoName()}
+		// Channels track their upstream themselves and are updated by "hermit upgrade" according to their
+		// update interval, so there is nothing to compare.
+		if pkg.Reference.IsChannel() {
+			results = append(results, result)
+			continue
+		}
+		task := l.Task(pkg.Reference.Name)
+		latest, err := env.LatestVersion(l, pkg)
+		if err != nil {
+			return errors.Wrap(err, pkg.Reference.String())
+		}
+		result.Latest = latest.Reference.Version.String()
+		if pkg.Reference.Version.Less(latest.Reference.Version) {
+			result.Outdated = true
+		}
+		if !sta.Offline() {
+			upstream, err := upstreamVersion(ctx, l, env, pkg, defaultHTTPClient, ghClient, glClient)
+			if err != nil {
+				task.Warnf("could not check for upstream releases: %s", err)
+			} else if upstream != "" {
+				result.Upstream = upstream
+				if pkg.Reference.Version.Less(manifest.ParseVersion(upstream)) {
+					result.Outdated = true
+				}
+			}
+		}
+		if result.Outdated {
+			outdated++
+		}
+		results = append(results, result)
+	}
+
+	if globalState.JSON {
+		if err := printJSON(l, jsonOutdated{jsonDocument: newJSONDocument(), Packages: results}); err != nil {
+			return errors.WithStack(err)
+		}
+	} else {
+		out := &strings.Builder{}
+		w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "PACKAGE\tCURRENT\tLATEST\tUPSTREAM\t")
+		for _, r := range results {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", r.Name, r.Current, orDash(r.Latest), orDash(r.Upstream))
+		}
+		if err := w.Flush(); err != nil {
+			return errors.WithStack(err)
+		}
+		l.Printf("%s", out.String())
+	}
+	if outdated > 0 {
+		return errors.Errorf("%d of %d packages are outdated", outdated, len(results))
+	}
+	return nil
+}
+
+// Returns the newest upstream version of a package, or "" if its manifest has no auto-version configuration.
+func upstreamVersion(
+	ctx context.Context, l *ui.UI, env *hermit.Env, pkg *manifest.Package,
+	defaultHTTPClient *http.Client, ghClient *github.Client, glClient *gitlab.Client,
+) (string, error) {
+	block, err := env.AutoVersion(l, pkg.Reference.Name)
+	if err != nil || block == nil {
+		return "", errors.WithStack(err)
+	}
+	return autoversion.LatestVersion(ctx, defaultHTTPClient, ghClient, glClient, block)
+}
+
+// Retrieve the latest GitHub releases of all of "pkgs" up front, in as few requests as possible.
+func prefetchUpstreamReleases(ctx context.Context, l *ui.UI, env *hermit.Env, pkgs []*manifest.Package, ghClient *github.Client) {
+	var repos []string
+	for _, pkg := range pkgs {
+		if pkg.Reference.IsChannel() {
+			continue
+		}
+		block, err := env.AutoVersion(l, pkg.Reference.Name)
+		if err != nil || block == nil {
+			continue
+		}
+		if repo := autoversion.GitHubRepo(block); repo != "" {
+			repos = append(repos, repo)
+		}
+	}
+	if err := ghClient.PrefetchLatestReleases(ctx, repos); err != nil {
+		l.Warnf("could not prefetch GitHub releases: %s", err)
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -0,0 +1,80 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+)
+
+type rollbackCmd struct {
+	Package string `arg:"" help:"Package to roll back." predictor:"installed-package"`
+	List    bool   `short:"l" help:"Show the recorded version changes of the package instead of rolling it back."`
+}
+
+func (r *rollbackCmd) Help() string {
+	return `
+Restore the version of a package that was installed before it was last upgraded or
+changed in this environment. Versions are recorded in a history log per environment,
+so rolling back repeatedly restores progressively older versions.
+`
+}
+
+type jsonHistory struct {
+	jsonDocument
+	History []hermit.HistoryEntry `json:"history"`
+}
+
+func (r *rollbackCmd) Run(l *ui.UI, env *hermit.Env, globalState GlobalState) error {
+	if r.List {
+		return r.list(l, env, globalState)
+	}
+	pkg, _, err := env.Rollback(l, r.Package)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	messages, err := env.TriggerForPackage(l, manifest.EventInstall, pkg)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	w := l.WriterAt(ui.LevelInfo)
+	defer w.Sync() // nolint
+	for _, message := range messages {
+		fmt.Fprintln(w, message)
+	}
+	pkg.LogWarnings(l)
+	return nil
+}
+
+func (r *rollbackCmd) list(l *ui.UI, env *hermit.Env, globalState GlobalState) error {
+	entries, err := env.History()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	history := []hermit.HistoryEntry{}
+	for _, entry := range entries {
+		if entry.Package == r.Package {
+			history = append(history, entry)
+		}
+	}
+	if globalState.JSON {
+		return printJSON(l, jsonHistory{jsonDocument: newJSONDocument(), History: history})
+	}
+	out := &strings.Builder{}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tOPERATION\tFROM\tTO\t")
+	for _, entry := range history {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t\n", entry.Time.Local().Format(time.RFC3339), entry.Operation, entry.From, entry.To)
+	}
+	if err := w.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+	l.Printf("%s", out.String())
+	return nil
+}
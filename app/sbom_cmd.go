@@ -0,0 +1,44 @@
+package app
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/sbom"
+	"github.com/cashapp/hermit/ui"
+)
+
+type sbomCmd struct {
+	Format string `short:"f" help:"SBOM format, one of ${enum}." enum:"cyclonedx,spdx" default:"cyclonedx"`
+	Output string `short:"o" help:"File to write the SBOM to, defaults to stdout." placeholder:"FILE"`
+}
+
+func (s *sbomCmd) Run(l *ui.UI, env *hermit.Env) error {
+	pkgs, err := env.ListInstalled(l)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	var w io.Writer = os.Stdout
+	if s.Output != "" {
+		f, err := os.Create(s.Output)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer f.Close() // nolint: gosec
+		w = f
+	}
+	doc := sbom.Document{
+		Name:     filepath.Base(env.Root()),
+		Created:  time.Now(),
+		Packages: pkgs,
+	}
+	if err := sbom.Write(w, sbom.Format(s.Format), doc); err != nil {
+		return errors.Wrap(err, "failed to write SBOM")
+	}
+	return nil
+}
@@ -16,7 +16,7 @@ type searchCmd struct {
 	Constraint string `arg:"" help:"Package regex." optional:""`
 }
 
-func (s *searchCmd) Run(l *ui.UI, env *hermit.Env, state *state.State) error {
+func (s *searchCmd) Run(l *ui.UI, env *hermit.Env, state *state.State, globalState GlobalState) error {
 	var (
 		pkgs manifest.Packages
 		err  error
@@ -44,6 +44,9 @@ func (s *searchCmd) Run(l *ui.UI, env *hermit.Env, state *state.State) error {
 			return errors.WithStack(err)
 		}
 	}
+	if globalState.JSON {
+		return printJSON(l, newJSONPackages(pkgs))
+	}
 	if s.Short {
 		for _, pkg := range pkgs {
 			fmt.Println(pkg)
@@ -0,0 +1,83 @@
+package app
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/state"
+	"github.com/cashapp/hermit/ui"
+)
+
+type selectCmd struct {
+	Virtual  string `arg:"" help:"Virtual package, eg. jdk."`
+	Provider string `arg:"" optional:"" help:"Package to provide it (<name>[-<version>]). If omitted, lists the available providers." predictor:"package"`
+	Parallel int    `help:"Maximum number of concurrent downloads." default:"4" env:"HERMIT_PARALLEL_DOWNLOADS"`
+}
+
+func (s *selectCmd) Help() string {
+	return `
+Select the package that provides a virtual package in this environment. Other installed providers of the virtual
+package are uninstalled and the selected package is installed, along with its dependencies, replacing their
+binaries. The selection is recorded in bin/hermit.hcl and used when installing packages that require the virtual
+package.
+`
+}
+
+func (s *selectCmd) Run(l *ui.UI, env *hermit.Env, state *state.State) error {
+	if err := env.Sync(l, false); err != nil {
+		return errors.WithStack(err)
+	}
+	if s.Provider == "" {
+		return s.listProviders(l, env)
+	}
+	selector, err := manifest.ParseGlobSelector(s.Provider)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	pkg, err := env.Resolve(l, selector, false)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := env.SelectProvider(l, s.Virtual, pkg); err != nil {
+		return errors.WithStack(err)
+	}
+	installed, err := env.ListInstalledReferences()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	graph, err := env.DependencyGraph(l, installed, manifest.ExactSelector(pkg.Reference))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return installPackages(l, env, state, graph.Uninstalled(), graph.Dependents(), s.Parallel)
+}
+
+func (s *selectCmd) listProviders(l *ui.UI, env *hermit.Env) error {
+	providers, err := env.ResolveVirtual(l, s.Virtual)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	installed, err := env.ListInstalledReferences()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	sort.Slice(providers, func(i, j int) bool { return providers[i].Reference.Name < providers[j].Reference.Name })
+	selected := env.SelectedProvider(s.Virtual)
+	for _, provider := range providers {
+		marker := " "
+		if provider.Reference.Name == selected {
+			marker = "*"
+		}
+		line := marker + " " + provider.Reference.Name
+		for _, ref := range installed {
+			if ref.Name == provider.Reference.Name {
+				line += " (" + ref.String() + " installed)"
+			}
+		}
+		l.Printf("%s\n", line)
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package app
+
+import (
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/ui"
+)
+
+type selfPinCmd struct {
+	Version string `arg:"" help:"Hermit version to pin this environment to, eg. 0.39.0."`
+}
+
+func (s *selfPinCmd) Help() string {
+	return `
+Pin this environment to a version of Hermit, recorded in bin/hermit.hcl.
+
+Hermit switches to the pinned version whenever it is run in this environment,
+and no longer upgrades itself. Use "hermit self-upgrade --channel <channel>" to
+track a release channel again.
+`
+}
+
+func (s *selfPinCmd) Run(l *ui.UI, env *hermit.Env) error {
+	pkg, err := env.PinHermit(l, s.Version)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	l.Infof("This environment is now pinned to %s", pkg)
+	return nil
+}
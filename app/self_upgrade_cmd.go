@@ -0,0 +1,51 @@
+package app
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+)
+
+type selfUpgradeCmd struct {
+	Channel string `help:"Switch this environment to a Hermit release channel, eg. stable or canary. This removes any pin set with \"hermit self-pin\"." placeholder:"CHANNEL"`
+}
+
+func (s *selfUpgradeCmd) Run(l *ui.UI, env *hermit.Env) error {
+	if s.Channel != "" {
+		pkg, err := env.SetHermitChannel(l, s.Channel)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		l.Infof("This environment now uses %s", pkg)
+		return nil
+	}
+	channel := ""
+	if ref, ok := env.HermitReference(); ok {
+		if !ref.IsChannel() {
+			return errors.Errorf("this environment is pinned to %s, use --channel to track a release channel instead", ref)
+		}
+		channel = ref.Channel
+	} else {
+		self, err := os.Executable()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		pkgRef := filepath.Base(filepath.Dir(self))
+		if !strings.HasPrefix(pkgRef, "hermit@") {
+			return errors.Errorf("%s is not a Hermit release, use --channel to select a release channel", self)
+		}
+		channel = manifest.ParseReference(pkgRef).Channel
+	}
+	pkg, err := env.UpgradeHermitChannel(l, channel)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	l.Infof("%s is up to date", pkg)
+	return nil
+}
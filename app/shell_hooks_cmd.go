@@ -8,9 +8,12 @@ import (
 )
 
 type shellHooksCmd struct {
-	Zsh   bool `xor:"shell" help:"Update Zsh hooks."`
-	Bash  bool `xor:"shell" help:"Update Bash hooks."`
-	Print bool `help:"Prints out the hook configuration code" hidden:"" `
+	Zsh        bool `xor:"shell" help:"Update Zsh hooks."`
+	Bash       bool `xor:"shell" help:"Update Bash hooks."`
+	Fish       bool `xor:"shell" help:"Update fish hooks."`
+	Nushell    bool `xor:"shell" help:"Update nushell hooks."`
+	PowerShell bool `xor:"shell" name:"powershell" help:"Update PowerShell hooks."`
+	Print      bool `help:"Prints out the hook configuration code" hidden:"" `
 }
 
 func (s *shellHooksCmd) Run(l *ui.UI, config Config) error {
@@ -22,6 +25,12 @@ func (s *shellHooksCmd) Run(l *ui.UI, config Config) error {
 		sh = &shell.Bash{}
 	} else if s.Zsh {
 		sh = &shell.Zsh{}
+	} else if s.Fish {
+		sh = &shell.Fish{}
+	} else if s.Nushell {
+		sh = &shell.Nushell{}
+	} else if s.PowerShell {
+		sh = &shell.PowerShell{}
 	} else {
 		sh, err = shell.Detect()
 		if err != nil {
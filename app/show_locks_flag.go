@@ -0,0 +1,42 @@
+package app
+
+import (
+	"fmt"
+	"text/tabwriter"
+	"time"
+
+	"github.com/alecthomas/kong"
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/state"
+)
+
+// A flag that lists the locks held on the shared state, for finding out which process another is waiting for.
+type showLocksFlag bool
+
+// BeforeApply lists the locks held on the state directory in the "state" variable and terminates with a 0 exit status.
+func (s showLocksFlag) BeforeApply(app *kong.Kong, vars kong.Vars) error {
+	locks, err := state.Locks(vars["state"])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(locks) == 0 {
+		fmt.Fprintln(app.Stdout, "No locks are held")
+		app.Exit(0)
+		return nil
+	}
+	w := tabwriter.NewWriter(app.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "LOCK\tPID\tSINCE\tCOMMAND\t")
+	for _, lock := range locks {
+		if lock.Holder == nil {
+			fmt.Fprintf(w, "%s\t-\t-\t(shared, or unknown)\t\n", lock.Name)
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\t%s\t\n", lock.Name, lock.Holder.PID, lock.Holder.Since.Local().Format(time.RFC3339), lock.Holder.Command)
+	}
+	if err := w.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+	app.Exit(0)
+	return nil
+}
@@ -13,9 +13,14 @@ import (
 	"github.com/cashapp/hermit/ui"
 )
 
-type syncCmd struct{}
+type syncCmd struct {
+	Packages []string `arg:"" optional:"" name:"package" help:"Installed channel packages to check for updates. If given, only these are refreshed, regardless of their update interval." predictor:"installed-package"`
+}
 
 func (s *syncCmd) Run(l *ui.UI, env *hermit.Env, state *state.State) error {
+	if len(s.Packages) > 0 {
+		return s.syncPackages(l, env, state)
+	}
 	self, err := os.Executable()
 	if err != nil {
 		return errors.WithStack(err)
@@ -47,3 +52,35 @@ func (s *syncCmd) Run(l *ui.UI, env *hermit.Env, state *state.State) error {
 	}
 	return nil
 }
+
+// Refresh the channels of the given packages only.
+func (s *syncCmd) syncPackages(l *ui.UI, env *hermit.Env, state *state.State) error {
+	if env == nil {
+		return errors.New("refreshing packages requires an active environment")
+	}
+	installed, err := env.ListInstalledReferences()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	refs := map[string]manifest.Reference{}
+	for _, ref := range installed {
+		refs[ref.Name] = ref
+	}
+	for _, name := range s.Packages {
+		ref, ok := refs[name]
+		if !ok {
+			return errors.Errorf("no installed package '%s' found", name)
+		}
+		if !ref.IsChannel() {
+			return errors.Errorf("%s is not installed from a channel", ref)
+		}
+		pkg, err := env.Resolve(l, manifest.ExactSelector(ref), false)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := state.UpgradeChannel(l.Task(ref.String()), pkg); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package app
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/telemetry"
+	"github.com/cashapp/hermit/ui"
+)
+
+// The local log of telemetry events.
+func telemetryLogPath() string {
+	return filepath.Join(hermit.UserStateDir, "telemetry.jsonl")
+}
+
+type telemetryCmd struct {
+	Log     telemetryLogCmd     `cmd:"" help:"Show the package operations recorded in the local telemetry log."`
+	Metrics telemetryMetricsCmd `cmd:"" help:"Show counters of the recorded package operations in the Prometheus text format."`
+}
+
+func (t *telemetryCmd) Help() string {
+	return `
+Telemetry is opt-in, by setting "telemetry = true" in ~/.hermit.hcl. Hermit then
+records the package installs, upgrades and uninstalls performed in environments
+to a local log, and pushes them to "telemetry-url" if it is set. Events contain
+only the operation, the package name and version, and the OS and architecture.
+
+Environments can opt out by setting "no-telemetry = true" in bin/hermit.hcl.
+`
+}
+
+type telemetryLogCmd struct{}
+
+type jsonTelemetryLog struct {
+	jsonDocument
+	Events []telemetry.LogEntry `json:"events"`
+}
+
+func (t *telemetryLogCmd) Run(l *ui.UI, globalState GlobalState) error {
+	entries, err := telemetry.ReadLog(telemetryLogPath())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if globalState.JSON {
+		if entries == nil {
+			entries = []telemetry.LogEntry{}
+		}
+		return printJSON(l, jsonTelemetryLog{jsonDocument: newJSONDocument(), Events: entries})
+	}
+	out := &strings.Builder{}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TIME\tEVENT\tPACKAGE\tVERSION\tPLATFORM\t")
+	for _, entry := range entries {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s-%s\t\n", entry.Time.Local().Format(time.RFC3339), entry.Operation, entry.Package, entry.Version, entry.OS, entry.Arch)
+	}
+	if err := w.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+	l.Printf("%s", out.String())
+	return nil
+}
+
+type telemetryMetricsCmd struct{}
+
+func (t *telemetryMetricsCmd) Run(l *ui.UI) error {
+	entries, err := telemetry.ReadLog(telemetryLogPath())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	out := &strings.Builder{}
+	if err := telemetry.WriteMetrics(out, entries); err != nil {
+		return errors.WithStack(err)
+	}
+	l.Printf("%s", out.String())
+	return nil
+}
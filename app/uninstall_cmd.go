@@ -29,11 +29,7 @@ next:
 	for _, selector := range u.Packages {
 		for _, pkg := range installed {
 			if selector.Matches(pkg.Reference) {
-				c, err := env.Uninstall(l, pkg)
-				if err != nil {
-					return errors.WithStack(err)
-				}
-				changes = changes.Merge(c)
+				// Uninstall actions run while the package is still installed.
 				messages, err := env.TriggerForPackage(l, manifest.EventUninstall, pkg)
 				if err != nil {
 					return errors.WithStack(err)
@@ -41,6 +37,11 @@ next:
 				for _, message := range messages {
 					fmt.Fprintln(w, message)
 				}
+				c, err := env.Uninstall(l, pkg)
+				if err != nil {
+					return errors.WithStack(err)
+				}
+				changes = changes.Merge(c)
 				continue next
 			}
 		}
@@ -25,10 +25,13 @@ var userConfigSchema = func() string {
 
 // UserConfig is stored in ~/.hermit.hcl
 type UserConfig struct {
-	Prompt      string `hcl:"prompt,optional" default:"env" enum:"env,short,none" help:"Modify prompt to include hermit environment (env), just an icon (short) or nothing (none)"`
-	ShortPrompt bool   `hcl:"short-prompt,optional" help:"If true use a short prompt when an environment is activated."`
-	NoGit       bool   `hcl:"no-git,optional" help:"If true Hermit will never add/remove files from Git automatically."`
-	Idea        bool   `hcl:"idea,optional" help:"If true Hermit will try to add the IntelliJ IDEA plugin automatically."`
+	Prompt       string `hcl:"prompt,optional" default:"env" enum:"env,short,none" help:"Modify prompt to include hermit environment (env), just an icon (short) or nothing (none)"`
+	ShortPrompt  bool   `hcl:"short-prompt,optional" help:"If true use a short prompt when an environment is activated."`
+	NoGit        bool   `hcl:"no-git,optional" help:"If true Hermit will never add/remove files from Git automatically."`
+	Idea         bool   `hcl:"idea,optional" help:"If true Hermit will try to add the IntelliJ IDEA plugin automatically."`
+	Telemetry    bool   `hcl:"telemetry,optional" help:"If true Hermit will record package installs, upgrades and uninstalls to a local log."`
+	TelemetryURL string `hcl:"telemetry-url,optional" help:"If set, telemetry events are also pushed to this HTTP endpoint."`
+	GitHubToken  string `hcl:"github-token,optional" help:"GitHub token used to access private releases, instead of $HERMIT_GITHUB_TOKEN, $GITHUB_TOKEN, the gh CLI or ~/.netrc."`
 }
 
 // LoadUserConfig from disk.
@@ -3,6 +3,7 @@ package app
 import (
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -16,31 +17,56 @@ type validateEnvCmd struct {
 	Env string `arg:"" type:"existingdir" help:"Path to environment root."`
 }
 
-func (v *validateEnvCmd) Run(l *ui.UI, config Config) error {
-next:
+func (v *validateEnvCmd) Run(l *ui.UI, config Config, globalState GlobalState) error {
+	var issues []jsonValidationIssue
 	for _, path := range []string{"bin/activate-hermit", "bin/hermit"} {
 		path = filepath.Join(v.Env, path)
-		hasher := sha256.New()
-		r, err := os.Open(path)
-		if os.IsNotExist(err) {
-			return errors.Errorf("%s is missing, not a Hermit environment?", path)
-		} else if err != nil {
+		problem, err := v.validateScript(l, path, config.SHA256Sums)
+		if err != nil {
 			return errors.WithStack(err)
 		}
-		_, err = io.Copy(hasher, r)
-		if err != nil {
+		if problem == "" {
+			continue
+		}
+		if !globalState.JSON {
+			return errors.New(problem)
+		}
+		issues = append(issues, jsonValidationIssue{Path: path, Message: problem})
+	}
+	if globalState.JSON {
+		if err := printJSON(l, newJSONValidation(issues)); err != nil {
 			return errors.WithStack(err)
 		}
-		hash := hex.EncodeToString(hasher.Sum(nil))
-		l.Debugf("%s %s\n", hash, path)
-		for _, candidate := range config.SHA256Sums {
-			if hash == candidate {
-				l.Infof("%s validated as %s", path, hash)
-				continue next
-			}
+		if len(issues) > 0 {
+			return errors.Errorf("%s is not a valid Hermit environment", v.Env)
 		}
-		return errors.Errorf("%s has an unknown SHA256 signature (%s); verify that you trust this environment and run 'hermit init %s'", path, hash, v.Env)
+		return nil
 	}
 	l.Infof("%s ok", v.Env)
 	return nil
 }
+
+// Returns a description of the problem if the script at "path" is not one of the known scripts.
+func (v *validateEnvCmd) validateScript(l *ui.UI, path string, sha256sums []string) (problem string, err error) {
+	hasher := sha256.New()
+	r, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return fmt.Sprintf("%s is missing, not a Hermit environment?", path), nil
+	} else if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer r.Close() // nolint: gosec
+	_, err = io.Copy(hasher, r)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	l.Debugf("%s %s\n", hash, path)
+	for _, candidate := range sha256sums {
+		if hash == candidate {
+			l.Infof("%s validated as %s", path, hash)
+			return "", nil
+		}
+	}
+	return fmt.Sprintf("%s has an unknown SHA256 signature (%s); verify that you trust this environment and run 'hermit init %s'", path, hash, v.Env), nil
+}
@@ -69,7 +69,7 @@ Builtin commands:
 	` + strings.ReplaceAll(builtins(70), "\n", "\n  ")
 }
 
-func (v *validateScriptCmd) Run(l *ui.UI, env *hermit.Env) error {
+func (v *validateScriptCmd) Run(l *ui.UI, env *hermit.Env, globalState GlobalState) error {
 	validCommands := make(map[string]bool, len(builtinCommands)+len(v.Cmds))
 	if env != nil {
 		validCommands["hermit"] = true
@@ -117,13 +117,38 @@ func (v *validateScriptCmd) Run(l *ui.UI, env *hermit.Env) error {
 		issues = append(issues, pissues...)
 	}
 
+	jsonIssues := []jsonValidationIssue{}
 	for _, issue := range issues {
 		path, err := filepath.Rel(pwd, issue.path)
 		if err != nil {
 			return errors.WithStack(err)
 		}
+		if globalState.JSON {
+			jsonIssues = append(jsonIssues, jsonValidationIssue{
+				Path:    path,
+				Line:    int(issue.pos.Line()),
+				Column:  int(issue.pos.Col()),
+				Message: strings.TrimPrefix(issue.message, issue.pos.String()+": "),
+			})
+			continue
+		}
 		fmt.Fprintf(os.Stderr, "%s:%s: %s\n", path, issue.pos, issue.message)
 	}
+	if globalState.JSON {
+		sort.Slice(jsonIssues, func(i, j int) bool {
+			a, b := jsonIssues[i], jsonIssues[j]
+			if a.Path != b.Path {
+				return a.Path < b.Path
+			}
+			if a.Line != b.Line {
+				return a.Line < b.Line
+			}
+			return a.Column < b.Column
+		})
+		if err := printJSON(l, newJSONValidation(jsonIssues)); err != nil {
+			return errors.WithStack(err)
+		}
+	}
 	if len(issues) != 0 {
 		return fmt.Errorf("%d errors encountered", len(issues))
 	}
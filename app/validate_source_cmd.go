@@ -2,6 +2,7 @@ package app
 
 import (
 	"runtime"
+	"sort"
 	"strconv"
 
 	"github.com/pkg/errors"
@@ -17,7 +18,7 @@ type validateSourceCmd struct {
 	Source string `arg:"" optional:"" name:"source" help:"The manifest source to validate."`
 }
 
-func (g *validateSourceCmd) Run(l *ui.UI, env *hermit.Env, sta *state.State) error {
+func (g *validateSourceCmd) Run(l *ui.UI, env *hermit.Env, sta *state.State, globalState GlobalState) error {
 	var (
 		srcs    *sources.Sources
 		err     error
@@ -47,6 +48,11 @@ func (g *validateSourceCmd) Run(l *ui.UI, env *hermit.Env, sta *state.State) err
 		}
 	}
 
+	if globalState.JSON {
+		if err := printJSON(l, newJSONValidation(manifestIssues(merrors))); err != nil {
+			return errors.WithStack(err)
+		}
+	}
 	if len(merrors) > 0 {
 		merrors.LogErrors(l)
 		return errors.New("the source had " + strconv.Itoa(len(merrors)) + " broken manifest files")
@@ -55,3 +61,18 @@ func (g *validateSourceCmd) Run(l *ui.UI, env *hermit.Env, sta *state.State) err
 	l.Infof("No errors found")
 	return nil
 }
+
+func manifestIssues(merrors manifest.ManifestErrors) []jsonValidationIssue {
+	paths := make([]string, 0, len(merrors))
+	for path := range merrors {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	issues := []jsonValidationIssue{}
+	for _, path := range paths {
+		for _, err := range merrors[path] {
+			issues = append(issues, jsonValidationIssue{Path: path, Message: err.Error()})
+		}
+	}
+	return issues
+}
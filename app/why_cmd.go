@@ -0,0 +1,124 @@
+package app
+
+import (
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/state"
+	"github.com/cashapp/hermit/ui"
+)
+
+type whyCmd struct {
+	Package string `arg:"" help:"Package to explain." predictor:"installed-package"`
+}
+
+func (w *whyCmd) Help() string {
+	return `
+Explain how a package came to be installed in this environment: whether it was installed directly,
+as a dependency of another package, by an upgrade or rollback, or is inherited from a parent
+environment, along with the manifest it was resolved from and the command that installed it.
+
+If the package was installed as a dependency, the packages it was installed for are explained in turn.
+`
+}
+
+// A package as output by "hermit why" with --json.
+type jsonOrigin struct {
+	Reference string `json:"reference"`
+	Env       string `json:"env"`
+	Inherited bool   `json:"inherited"`
+	// Manifest the package currently resolves from.
+	Manifest         string            `json:"manifest,omitempty"`
+	Provenance       *state.Provenance `json:"provenance,omitempty"`
+	ChannelUpdatedAt *time.Time        `json:"channelUpdatedAt,omitempty"`
+	RequiredBy       []string          `json:"requiredBy"`
+}
+
+type jsonWhy struct {
+	jsonDocument
+	Packages []jsonOrigin `json:"packages"`
+}
+
+func (w *whyCmd) Run(l *ui.UI, env *hermit.Env, globalState GlobalState) error {
+	origins, err := env.Why(l, w.Package)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if globalState.JSON {
+		doc := jsonWhy{jsonDocument: newJSONDocument(), Packages: []jsonOrigin{}}
+		for _, origin := range origins {
+			out := jsonOrigin{
+				Reference:  origin.Package.Reference.String(),
+				Env:        origin.EnvDir,
+				Inherited:  origin.Inherited,
+				Manifest:   origin.Package.Manifest,
+				Provenance: origin.Provenance,
+				RequiredBy: origin.RequiredBy,
+			}
+			if origin.Provenance != nil && !origin.Provenance.ChannelUpdatedAt.IsZero() {
+				out.ChannelUpdatedAt = &origin.Provenance.ChannelUpdatedAt
+			}
+			doc.Packages = append(doc.Packages, out)
+		}
+		return printJSON(l, doc)
+	}
+	out := &strings.Builder{}
+	tw := tabwriter.NewWriter(out, 0, 0, 1, ' ', 0)
+	for _, origin := range origins {
+		fmt.Fprintf(tw, "%s\n", origin.Package.Reference)
+		if origin.Inherited {
+			fmt.Fprintf(tw, "  Inherited from:\t%s\n", origin.EnvDir)
+		}
+		manifest := origin.Package.Manifest
+		provenance := origin.Provenance
+		if provenance == nil {
+			fmt.Fprintf(tw, "  Installed:\tnot recorded, it was installed before Hermit recorded how packages are installed\n")
+		} else {
+			fmt.Fprintf(tw, "  Installed:\t%s\n", describeProvenance(provenance))
+			fmt.Fprintf(tw, "  Command:\t%s\n", provenance.Command)
+			fmt.Fprintf(tw, "  Time:\t%s\n", provenance.Time.Local().Format(time.RFC3339))
+			if !provenance.ChannelUpdatedAt.IsZero() {
+				fmt.Fprintf(tw, "  Channel updated:\t%s\n", provenance.ChannelUpdatedAt.Local().Format(time.RFC3339))
+			}
+			if provenance.Manifest != "" {
+				manifest = provenance.Manifest
+			}
+		}
+		if manifest != "" {
+			fmt.Fprintf(tw, "  Manifest:\t%s\n", manifest)
+		}
+		if len(origin.RequiredBy) > 0 {
+			fmt.Fprintf(tw, "  Required by:\t%s\n", strings.Join(origin.RequiredBy, ", "))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return errors.WithStack(err)
+	}
+	l.Printf("%s", out.String())
+	return nil
+}
+
+func describeProvenance(provenance *state.Provenance) string {
+	dependency := ""
+	if provenance.RequiredBy != "" {
+		dependency = ", as a dependency of " + provenance.RequiredBy
+	}
+	switch provenance.Reason {
+	case state.ProvenanceDependency:
+		return "as a dependency of " + provenance.RequiredBy
+	case state.ProvenanceUpgrade:
+		return "by upgrading " + provenance.Replaced + dependency
+	case state.ProvenanceRollback:
+		return "by rolling back " + provenance.Replaced + dependency
+	default:
+		if provenance.Replaced != "" {
+			return "directly, replacing " + provenance.Replaced
+		}
+		return "directly"
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"bytes"
 	"compress/bzip2"
 	"compress/gzip"
+	"encoding/binary"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -19,6 +20,7 @@ import (
 	bufra "github.com/avvmoto/buf-readerat"
 	"github.com/blakesmith/ar"
 	"github.com/gabriel-vasile/mimetype"
+	"github.com/klauspost/compress/zstd"
 	"github.com/pkg/errors"
 	"github.com/saracen/go7z"
 	"github.com/sassoftware/go-rpmutils"
@@ -279,7 +281,7 @@ func extractExecutable(r io.Reader, dest, executableName string) error {
 	destExe := filepath.Join(dest, executableName)
 	ext := filepath.Ext(destExe)
 	switch ext {
-	case ".gz", ".bz2", ".xz":
+	case ".gz", ".bz2", ".xz", ".zst", ".lz4":
 		destExe = strings.TrimSuffix(destExe, ext)
 	}
 
@@ -310,7 +312,12 @@ func openArchive(source string) (f *os.File, r io.Reader, mime *mimetype.MIME, e
 		}
 	}()
 	r = f
-	switch mime.String() {
+	kind := mime.String()
+	// mimetype doesn't recognise LZ4 frames.
+	if kind == "application/octet-stream" && isLZ4(f) {
+		kind = "application/x-lz4"
+	}
+	switch kind {
 	case "application/gzip":
 		zr, err := gzip.NewReader(r)
 		if err != nil {
@@ -328,6 +335,16 @@ func openArchive(source string) (f *os.File, r io.Reader, mime *mimetype.MIME, e
 		}
 		r = xr
 
+	case "application/zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, mime, errors.WithStack(err)
+		}
+		r = &zstdReader{zr}
+
+	case "application/x-lz4":
+		r = newLZ4Reader(r)
+
 	default:
 		// Assume it's uncompressed?
 		return f, r, mime, nil
@@ -344,6 +361,27 @@ func openArchive(source string) (f *os.File, r io.Reader, mime *mimetype.MIME, e
 	return f, io.MultiReader(bytes.NewReader(buf), r), mime, nil
 }
 
+func isLZ4(f *os.File) bool {
+	magic := make([]byte, 4)
+	if _, err := f.ReadAt(magic, 0); err != nil {
+		return false
+	}
+	return binary.LittleEndian.Uint32(magic) == lz4FrameMagic
+}
+
+// Releases the decoder's resources once the stream has been read.
+type zstdReader struct {
+	*zstd.Decoder
+}
+
+func (z *zstdReader) Read(p []byte) (int, error) {
+	n, err := z.Decoder.Read(p)
+	if errors.Is(err, io.EOF) {
+		z.Decoder.Close()
+	}
+	return n, err
+}
+
 const extractMacPkgChangesXML = `
 <?xml version="1.0" encoding="UTF-8"?>
 <!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
@@ -575,8 +613,26 @@ func extract7Zip(r io.ReaderAt, size int64, dest string, strip int) error {
 			return errors.WithStack(err)
 		}
 
+		mode, hasMode := sevenZipMode(hdr.Attrib)
+		if hasMode && mode&os.ModeSymlink != 0 {
+			// The content of a symlink is its target.
+			target, err := ioutil.ReadAll(sz)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if err := os.Symlink(string(target), destFile); err != nil {
+				return errors.Wrapf(err, "%s: failed to create symlink to %s", destFile, target)
+			}
+			continue
+		}
+		// Archives created on Windows have no permissions, so assume everything may be executable.
+		perm := os.FileMode(0755)
+		if hasMode {
+			perm = mode.Perm() &^ 0077
+		}
+
 		// Create file
-		f, err := os.OpenFile(destFile, os.O_CREATE|os.O_RDWR, 0755) // nolint: gosec
+		f, err := os.OpenFile(destFile, os.O_CREATE|os.O_RDWR, perm) // nolint: gosec
 		if err != nil {
 			return errors.WithStack(err)
 		}
@@ -592,6 +648,24 @@ func extract7Zip(r io.ReaderAt, size int64, dest string, strip int) error {
 	return nil
 }
 
+// 7z archives created on Unix record the file mode in the high 16 bits of the
+// Windows attributes, flagged by FILE_ATTRIBUTE_UNIX_EXTENSION.
+func sevenZipMode(attrib uint32) (os.FileMode, bool) {
+	const unixExtension = 0x8000
+	if attrib&unixExtension == 0 {
+		return 0, false
+	}
+	unixMode := attrib >> 16
+	mode := os.FileMode(unixMode & 0777)
+	switch unixMode & syscall.S_IFMT {
+	case syscall.S_IFLNK:
+		mode |= os.ModeSymlink
+	case syscall.S_IFDIR:
+		mode |= os.ModeDir
+	}
+	return mode, true
+}
+
 func extractRpmPackage(r io.Reader, dest string, pkg *manifest.Package) error {
 	rpm, err := rpmutils.ReadRpm(r)
 	if err != nil {
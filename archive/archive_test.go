@@ -1,9 +1,12 @@
 package archive
 
 import (
+	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -22,6 +25,8 @@ func TestExtract(t *testing.T) {
 		{"archive.tar.bz2", []string{"darwin_exe", "linux_exe"}},
 		{"archive.tar.gz", []string{"darwin_exe", "linux_exe"}},
 		{"archive.tar.xz", []string{"darwin_exe", "linux_exe"}},
+		{"archive.tar.zst", []string{"darwin_exe", "linux_exe"}},
+		{"archive.tar.lz4", []string{"darwin_exe", "linux_exe"}},
 		{"archive.zip", []string{"darwin_exe", "linux_exe"}},
 		{"darwin_exe", []string{"darwin_exe"}},
 		{"linux_exe", []string{"linux_exe"}},
@@ -55,3 +60,62 @@ func TestExtract(t *testing.T) {
 		})
 	}
 }
+
+func TestLZ4ReaderLinkedBlocks(t *testing.T) {
+	// Compressed with "lz4 -B4 -BD --content-size -BX", ie. 64KB blocks that refer to previous blocks, with checksums.
+	f, err := os.Open("testdata/lz4-linked.txt.lz4")
+	require.NoError(t, err)
+	defer f.Close()
+	data, err := ioutil.ReadAll(newLZ4Reader(f))
+	require.NoError(t, err)
+	expected := &strings.Builder{}
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(expected, "hermit line %d\n", i%300)
+	}
+	require.Equal(t, expected.String(), string(data))
+}
+
+func TestLZ4ReaderRejectsCorruptInput(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"Magic":         {0x00, 0x01, 0x02, 0x03},
+		"Truncated":     {0x04, 0x22, 0x4d, 0x18, 0x64, 0x40, 0xa7, 0x10, 0x00},
+		"InvalidOffset": {0x04, 0x22, 0x4d, 0x18, 0x64, 0x40, 0xa7, 0x04, 0x00, 0x00, 0x00, 0x10, 0x61, 0x05, 0x00},
+		"BlockMaxSize":  {0x04, 0x22, 0x4d, 0x18, 0x64, 0x00, 0xa7, 0x04, 0x00, 0x00, 0x00, 0x10, 0x61, 0x01, 0x00},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ioutil.ReadAll(newLZ4Reader(bytes.NewReader(data)))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestLZ4ReaderLimitsBlockSize(t *testing.T) {
+	header := []byte{0x04, 0x22, 0x4d, 0x18, 0x64, 0x40, 0xa7} // 64KB blocks.
+
+	// The block size is rejected before the block is read.
+	data := append(append([]byte{}, header...), 0xff, 0xff, 0xff, 0x7f)
+	_, err := ioutil.ReadAll(newLZ4Reader(bytes.NewReader(data)))
+	require.EqualError(t, err, "lz4: block size 2147483647 exceeds the frame's maximum of 65536")
+
+	// As is a block that decompresses to more than the maximum: a literal followed by a 64KB+19 byte match.
+	block := append([]byte{0x1f, 'a', 0x01, 0x00}, bytes.Repeat([]byte{0xff}, 257)...)
+	block = append(block, 0x00)
+	data = append(append([]byte{}, header...), byte(len(block)), byte(len(block)>>8), 0x00, 0x00)
+	data = append(data, block...)
+	_, err = ioutil.ReadAll(newLZ4Reader(bytes.NewReader(data)))
+	require.EqualError(t, err, "lz4: corrupt block")
+}
+
+func TestSevenZipMode(t *testing.T) {
+	mode, ok := sevenZipMode(0x20)
+	require.False(t, ok, "Windows attributes only")
+	require.Equal(t, os.FileMode(0), mode)
+
+	mode, ok = sevenZipMode(0o100755<<16 | 0x8000 | 0x20)
+	require.True(t, ok)
+	require.Equal(t, os.FileMode(0755), mode)
+
+	mode, ok = sevenZipMode(0o120777<<16 | 0x8000)
+	require.True(t, ok)
+	require.Equal(t, os.ModeSymlink|0777, mode)
+}
@@ -0,0 +1,234 @@
+package archive
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// Magic numbers of LZ4 frames.
+const (
+	lz4FrameMagic     = 0x184D2204
+	lz4SkippableMagic = 0x184D2A50 // The low nibble is ignored.
+)
+
+// Matches may refer back at most this far.
+const lz4WindowSize = 64 * 1024
+
+// A reader for the LZ4 frame format, as written by the lz4 CLI.
+//
+// See https://github.com/lz4/lz4/blob/dev/doc/lz4_Frame_format.md
+//
+// klauspost/compress, used for zstd, has no LZ4 support, and decoding is
+// simple enough not to warrant another dependency just for it.
+//
+// Header, block and content checksums are not verified, as package sources
+// are verified by their SHA256 checksum.
+type lz4Reader struct {
+	r io.Reader
+	// Decompressed data, including up to lz4WindowSize of history.
+	buf []byte
+	// Offset in buf of data not yet read.
+	pos           int
+	blockMaxSize  uint32
+	blockChecksum bool
+	frameChecksum bool
+	inFrame       bool
+}
+
+func newLZ4Reader(r io.Reader) *lz4Reader {
+	return &lz4Reader{r: r}
+}
+
+func (z *lz4Reader) Read(p []byte) (int, error) {
+	for z.pos == len(z.buf) {
+		if err := z.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, z.buf[z.pos:])
+	z.pos += n
+	return n, nil
+}
+
+// Decode the next block, reading a new frame header if necessary.
+func (z *lz4Reader) next() error {
+	if !z.inFrame {
+		if err := z.readFrameHeader(); err != nil {
+			return err
+		}
+	}
+	var size uint32
+	if err := binary.Read(z.r, binary.LittleEndian, &size); err != nil {
+		return errors.Wrap(unexpectedEOF(err), "lz4")
+	}
+	if size == 0 {
+		z.inFrame = false
+		if z.frameChecksum {
+			return z.skip(4)
+		}
+		return nil
+	}
+	uncompressed := size&0x80000000 != 0
+	size &^= 0x80000000
+	if size > z.blockMaxSize {
+		return errors.Errorf("lz4: block size %d exceeds the frame's maximum of %d", size, z.blockMaxSize)
+	}
+	block := make([]byte, size)
+	if _, err := io.ReadFull(z.r, block); err != nil {
+		return errors.Wrap(unexpectedEOF(err), "lz4")
+	}
+	if z.blockChecksum {
+		if err := z.skip(4); err != nil {
+			return err
+		}
+	}
+	// Retain history that later blocks may refer to.
+	if z.pos > lz4WindowSize {
+		z.buf = append(z.buf[:0], z.buf[z.pos-lz4WindowSize:z.pos]...)
+		z.pos = lz4WindowSize
+	}
+	if uncompressed {
+		z.buf = append(z.buf, block...)
+		return nil
+	}
+	var err error
+	z.buf, err = lz4DecodeBlock(block, z.buf, int(z.blockMaxSize))
+	return err
+}
+
+func (z *lz4Reader) readFrameHeader() error {
+	for {
+		var magic uint32
+		if err := binary.Read(z.r, binary.LittleEndian, &magic); err != nil {
+			// EOF between frames is the end of the stream.
+			return err
+		}
+		if magic&0xFFFFFFF0 == lz4SkippableMagic {
+			var size uint32
+			if err := binary.Read(z.r, binary.LittleEndian, &size); err != nil {
+				return errors.Wrap(unexpectedEOF(err), "lz4")
+			}
+			if err := z.skip(int64(size)); err != nil {
+				return err
+			}
+			continue
+		}
+		if magic != lz4FrameMagic {
+			return errors.Errorf("lz4: invalid frame magic %#x", magic)
+		}
+		break
+	}
+	header := make([]byte, 2)
+	if _, err := io.ReadFull(z.r, header); err != nil {
+		return errors.Wrap(unexpectedEOF(err), "lz4")
+	}
+	flags := header[0]
+	if flags>>6 != 1 {
+		return errors.Errorf("lz4: unsupported frame version %d", flags>>6)
+	}
+	// Blocks are at most 64KB, 256KB, 1MB or 4MB, compressed or not.
+	switch blockMaxSize := header[1] >> 4 & 0x07; blockMaxSize {
+	case 4, 5, 6, 7:
+		z.blockMaxSize = 1 << (8 + 2*blockMaxSize)
+	default:
+		return errors.Errorf("lz4: invalid block maximum size %d", blockMaxSize)
+	}
+	z.blockChecksum = flags&0x10 != 0
+	z.frameChecksum = flags&0x04 != 0
+	// Content size, dictionary ID and header checksum.
+	skip := int64(1)
+	if flags&0x08 != 0 {
+		skip += 8
+	}
+	if flags&0x01 != 0 {
+		return errors.New("lz4: frames with dictionaries are not supported")
+	}
+	if err := z.skip(skip); err != nil {
+		return err
+	}
+	z.inFrame = true
+	return nil
+}
+
+func (z *lz4Reader) skip(n int64) error {
+	_, err := io.CopyN(io.Discard, z.r, n)
+	return errors.Wrap(unexpectedEOF(err), "lz4")
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// Decode an LZ4 block of at most "max" bytes, appending it to "dst", which
+// contains the history matches may refer to.
+//
+// See https://github.com/lz4/lz4/blob/dev/doc/lz4_Block_format.md
+func lz4DecodeBlock(src, dst []byte, max int) ([]byte, error) {
+	max += len(dst)
+	// Read a length whose initial value is 15, continued by bytes until one is not 255.
+	readLength := func(i int, length int) (int, int, error) {
+		if length != 15 {
+			return i, length, nil
+		}
+		for {
+			if i >= len(src) {
+				return i, 0, errors.New("lz4: corrupt block")
+			}
+			b := src[i]
+			i++
+			length += int(b)
+			if b != 255 {
+				return i, length, nil
+			}
+		}
+	}
+	for i := 0; i < len(src); {
+		token := src[i]
+		i++
+		var (
+			literals int
+			err      error
+		)
+		i, literals, err = readLength(i, int(token>>4))
+		if err != nil {
+			return nil, err
+		}
+		if i+literals > len(src) || len(dst)+literals > max {
+			return nil, errors.New("lz4: corrupt block")
+		}
+		dst = append(dst, src[i:i+literals]...)
+		i += literals
+		// The last sequence has no match.
+		if i == len(src) {
+			break
+		}
+		if i+2 > len(src) {
+			return nil, errors.New("lz4: corrupt block")
+		}
+		offset := int(src[i]) | int(src[i+1])<<8
+		i += 2
+		if offset == 0 || offset > len(dst) {
+			return nil, errors.New("lz4: corrupt block")
+		}
+		var length int
+		i, length, err = readLength(i, int(token&0x0F))
+		if err != nil {
+			return nil, err
+		}
+		length += 4
+		if len(dst)+length > max {
+			return nil, errors.New("lz4: corrupt block")
+		}
+		// Matches may overlap the data being written, so copy a byte at a time.
+		start := len(dst) - offset
+		for j := 0; j < length; j++ {
+			dst = append(dst, dst[start+j])
+		}
+	}
+	return dst, nil
+}
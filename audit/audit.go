@@ -0,0 +1,297 @@
+// Package audit checks installed packages for known vulnerabilities.
+//
+// Packages are matched against the OSV database (https://osv.dev) if their
+// manifest declares an OSV package, or against the NVD
+// (https://nvd.nist.gov) if it declares a CPE name.
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+)
+
+// Default API endpoints.
+const (
+	DefaultOSVURL = "https://api.osv.dev"
+	DefaultNVDURL = "https://services.nvd.nist.gov"
+)
+
+// Vulnerability affecting an installed package.
+type Vulnerability struct {
+	Package  *manifest.Package
+	ID       string
+	Aliases  []string
+	Summary  string
+	Severity string   // eg. "HIGH", or a CVSS vector if no rating is available.
+	Fixed    []string // Versions in which the vulnerability is fixed, if known.
+}
+
+// Report of an audit.
+type Report struct {
+	Vulnerabilities []Vulnerability
+	// Unaudited packages have no OSV package or CPE name, or no version (eg. channels).
+	Unaudited manifest.Packages
+}
+
+// Option for the audit Client.
+type Option func(*Client)
+
+// WithOSVURL overrides the base URL of the OSV API.
+func WithOSVURL(url string) Option {
+	return func(c *Client) { c.osvURL = strings.TrimSuffix(url, "/") }
+}
+
+// WithNVDURL overrides the base URL of the NVD API.
+func WithNVDURL(url string) Option {
+	return func(c *Client) { c.nvdURL = strings.TrimSuffix(url, "/") }
+}
+
+// Client for vulnerability databases.
+type Client struct {
+	client *http.Client
+	osvURL string
+	nvdURL string
+}
+
+// New creates a new audit Client.
+func New(client *http.Client, options ...Option) *Client {
+	c := &Client{client: client, osvURL: DefaultOSVURL, nvdURL: DefaultNVDURL}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Audit "pkgs" for known vulnerabilities.
+func (c *Client) Audit(ctx context.Context, pkgs manifest.Packages) (*Report, error) {
+	report := &Report{}
+	for _, pkg := range pkgs {
+		version := pkg.Reference.Version.String()
+		var (
+			vulns []Vulnerability
+			err   error
+		)
+		switch {
+		case version == "":
+			report.Unaudited = append(report.Unaudited, pkg)
+			continue
+		case pkg.OSV != nil:
+			vulns, err = c.queryOSV(ctx, pkg, version)
+		case pkg.CPE != "":
+			vulns, err = c.queryNVD(ctx, pkg, version)
+		default:
+			report.Unaudited = append(report.Unaudited, pkg)
+			continue
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, pkg.String())
+		}
+		report.Vulnerabilities = append(report.Vulnerabilities, vulns...)
+	}
+	return report, nil
+}
+
+type osvQuery struct {
+	Version   string     `json:"version"`
+	Package   osvPackage `json:"package"`
+	PageToken string     `json:"page_token,omitempty"`
+}
+
+type osvPackage struct {
+	Ecosystem string `json:"ecosystem"`
+	Name      string `json:"name"`
+}
+
+type osvResponse struct {
+	Vulns         []osvVuln `json:"vulns"`
+	NextPageToken string    `json:"next_page_token"`
+}
+
+type osvVuln struct {
+	ID       string   `json:"id"`
+	Summary  string   `json:"summary"`
+	Details  string   `json:"details"`
+	Aliases  []string `json:"aliases"`
+	Severity []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected []struct {
+		Package osvPackage `json:"package"`
+		Ranges  []struct {
+			Events []struct {
+				Fixed string `json:"fixed"`
+			} `json:"events"`
+		} `json:"ranges"`
+	} `json:"affected"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+func (c *Client) queryOSV(ctx context.Context, pkg *manifest.Package, version string) ([]Vulnerability, error) {
+	query := osvQuery{Version: version, Package: osvPackage{Ecosystem: pkg.OSV.Ecosystem, Name: pkg.OSV.Name}}
+	var out []Vulnerability
+	for {
+		body, err := json.Marshal(query)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		resp := osvResponse{}
+		if err := c.do(ctx, http.MethodPost, c.osvURL+"/v1/query", body, &resp); err != nil {
+			return nil, err
+		}
+		for _, vuln := range resp.Vulns {
+			out = append(out, osvVulnerability(pkg, query.Package, vuln))
+		}
+		if resp.NextPageToken == "" {
+			return out, nil
+		}
+		query.PageToken = resp.NextPageToken
+	}
+}
+
+func osvVulnerability(pkg *manifest.Package, osvPkg osvPackage, vuln osvVuln) Vulnerability {
+	out := Vulnerability{
+		Package:  pkg,
+		ID:       vuln.ID,
+		Aliases:  vuln.Aliases,
+		Summary:  vuln.Summary,
+		Severity: strings.ToUpper(vuln.DatabaseSpecific.Severity),
+	}
+	if out.Summary == "" {
+		out.Summary = firstLine(vuln.Details)
+	}
+	if out.Severity == "" && len(vuln.Severity) > 0 {
+		out.Severity = vuln.Severity[0].Score
+	}
+	fixed := map[string]bool{}
+	for _, affected := range vuln.Affected {
+		if affected.Package != osvPkg {
+			continue
+		}
+		for _, r := range affected.Ranges {
+			for _, event := range r.Events {
+				if event.Fixed != "" && !fixed[event.Fixed] {
+					fixed[event.Fixed] = true
+					out.Fixed = append(out.Fixed, event.Fixed)
+				}
+			}
+		}
+	}
+	sort.Strings(out.Fixed)
+	return out
+}
+
+type nvdResponse struct {
+	ResultsPerPage  int `json:"resultsPerPage"`
+	StartIndex      int `json:"startIndex"`
+	TotalResults    int `json:"totalResults"`
+	Vulnerabilities []struct {
+		CVE struct {
+			ID           string `json:"id"`
+			Descriptions []struct {
+				Lang  string `json:"lang"`
+				Value string `json:"value"`
+			} `json:"descriptions"`
+			Metrics struct {
+				CVSSMetricV31 []struct {
+					CVSSData struct {
+						BaseSeverity string `json:"baseSeverity"`
+					} `json:"cvssData"`
+				} `json:"cvssMetricV31"`
+				CVSSMetricV2 []struct {
+					BaseSeverity string `json:"baseSeverity"`
+				} `json:"cvssMetricV2"`
+			} `json:"metrics"`
+		} `json:"cve"`
+	} `json:"vulnerabilities"`
+}
+
+func (c *Client) queryNVD(ctx context.Context, pkg *manifest.Package, version string) ([]Vulnerability, error) {
+	cpe, err := cpeForVersion(pkg.CPE, version)
+	if err != nil {
+		return nil, err
+	}
+	var out []Vulnerability
+	for start := 0; ; {
+		resp := nvdResponse{}
+		uri := c.nvdURL + "/rest/json/cves/2.0?" + url.Values{
+			"virtualMatchString": {cpe},
+			"startIndex":         {strconv.Itoa(start)},
+		}.Encode()
+		if err := c.do(ctx, http.MethodGet, uri, nil, &resp); err != nil {
+			return nil, err
+		}
+		for _, vuln := range resp.Vulnerabilities {
+			v := Vulnerability{Package: pkg, ID: vuln.CVE.ID}
+			for _, description := range vuln.CVE.Descriptions {
+				if description.Lang == "en" {
+					v.Summary = firstLine(description.Value)
+					break
+				}
+			}
+			if metrics := vuln.CVE.Metrics.CVSSMetricV31; len(metrics) > 0 {
+				v.Severity = metrics[0].CVSSData.BaseSeverity
+			} else if metrics := vuln.CVE.Metrics.CVSSMetricV2; len(metrics) > 0 {
+				v.Severity = metrics[0].BaseSeverity
+			}
+			out = append(out, v)
+		}
+		start += len(resp.Vulnerabilities)
+		if len(resp.Vulnerabilities) == 0 || start >= resp.TotalResults {
+			return out, nil
+		}
+	}
+}
+
+// Fill in the version of a CPE 2.3 formatted string name, eg. "cpe:2.3:a:jqlang:jq".
+func cpeForVersion(cpe, version string) (string, error) {
+	parts := strings.Split(cpe, ":")
+	if len(parts) < 5 || len(parts) > 13 || parts[0] != "cpe" || parts[1] != "2.3" {
+		return "", errors.Errorf("invalid CPE 2.3 name %q", cpe)
+	}
+	for len(parts) < 13 {
+		parts = append(parts, "*")
+	}
+	parts[5] = version
+	return strings.Join(parts, ":"), nil
+}
+
+func (c *Client) do(ctx context.Context, method, uri string, body []byte, dest interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, uri, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s %s failed: %s", method, req.URL.Host, resp.Status)
+	}
+	return errors.Wrap(json.NewDecoder(resp.Body).Decode(dest), uri)
+}
+
+func firstLine(s string) string {
+	s = strings.TrimSpace(s)
+	if i := strings.IndexByte(s, '\n'); i >= 0 {
+		return strings.TrimSpace(s[:i])
+	}
+	return s
+}
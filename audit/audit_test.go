@@ -0,0 +1,89 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/manifest/manifesttest"
+)
+
+func TestAudit(t *testing.T) {
+	var (
+		lock       sync.Mutex
+		osvQueries []osvQuery
+		nvdQueries []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		defer lock.Unlock()
+		switch r.URL.Path {
+		case "/v1/query":
+			query := osvQuery{}
+			_ = json.NewDecoder(r.Body).Decode(&query)
+			osvQueries = append(osvQueries, query)
+			if query.PageToken == "" {
+				fmt.Fprint(w, `{"vulns": [{
+					"id": "GO-2023-0001",
+					"summary": "Bad things",
+					"aliases": ["CVE-2023-0001"],
+					"database_specific": {"severity": "high"},
+					"affected": [
+						{"package": {"ecosystem": "Go", "name": "stdlib"}, "ranges": [{"events": [{"introduced": "0"}, {"fixed": "1.21.1"}, {"introduced": "1.22.0"}, {"fixed": "1.22.1"}]}]},
+						{"package": {"ecosystem": "Go", "name": "other"}, "ranges": [{"events": [{"fixed": "9.9.9"}]}]}
+					]
+				}], "next_page_token": "next"}`)
+				return
+			}
+			fmt.Fprint(w, `{"vulns": [{"id": "GO-2023-0002", "details": "More bad things\n\nDetails.", "severity": [{"type": "CVSS_V3", "score": "CVSS:3.1/AV:N"}]}]}`)
+		case "/rest/json/cves/2.0":
+			nvdQueries = append(nvdQueries, r.URL.Query().Get("virtualMatchString"))
+			fmt.Fprint(w, `{"totalResults": 1, "vulnerabilities": [{"cve": {
+				"id": "CVE-2023-0003",
+				"descriptions": [{"lang": "es", "value": "Cosas malas"}, {"lang": "en", "value": "Bad jq things"}],
+				"metrics": {"cvssMetricV31": [{"cvssData": {"baseSeverity": "CRITICAL"}}]}
+			}}]}`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	goPkg := manifesttest.NewPkgBuilder("/pkg/go-1.21.0").WithName("go").WithVersion("1.21.0").Result()
+	goPkg.OSV = &manifest.OSVBlock{Ecosystem: "Go", Name: "stdlib"}
+	jqPkg := manifesttest.NewPkgBuilder("/pkg/jq-1.6").WithName("jq").WithVersion("1.6").Result()
+	jqPkg.CPE = "cpe:2.3:a:jqlang:jq"
+	channelPkg := manifesttest.NewPkgBuilder("/pkg/go@stable").WithName("go").WithChannel("stable").Result()
+	channelPkg.OSV = goPkg.OSV
+	unmappedPkg := manifesttest.NewPkgBuilder("/pkg/protoc-3.14.0").WithName("protoc").WithVersion("3.14.0").Result()
+
+	client := New(srv.Client(), WithOSVURL(srv.URL), WithNVDURL(srv.URL+"/"))
+	report, err := client.Audit(context.Background(), manifest.Packages{goPkg, jqPkg, channelPkg, unmappedPkg})
+	require.NoError(t, err)
+	require.Equal(t, []Vulnerability{
+		{Package: goPkg, ID: "GO-2023-0001", Aliases: []string{"CVE-2023-0001"}, Summary: "Bad things", Severity: "HIGH", Fixed: []string{"1.21.1", "1.22.1"}},
+		{Package: goPkg, ID: "GO-2023-0002", Summary: "More bad things", Severity: "CVSS:3.1/AV:N"},
+		{Package: jqPkg, ID: "CVE-2023-0003", Summary: "Bad jq things", Severity: "CRITICAL"},
+	}, report.Vulnerabilities)
+	require.Equal(t, manifest.Packages{channelPkg, unmappedPkg}, report.Unaudited)
+	require.Equal(t, []osvQuery{
+		{Version: "1.21.0", Package: osvPackage{Ecosystem: "Go", Name: "stdlib"}},
+		{Version: "1.21.0", Package: osvPackage{Ecosystem: "Go", Name: "stdlib"}, PageToken: "next"},
+	}, osvQueries)
+	require.Equal(t, []string{"cpe:2.3:a:jqlang:jq:1.6:*:*:*:*:*:*:*"}, nvdQueries)
+}
+
+func TestCPEForVersion(t *testing.T) {
+	cpe, err := cpeForVersion("cpe:2.3:a:jqlang:jq:*:*:*:*:*:*:*:*", "1.7")
+	require.NoError(t, err)
+	require.Equal(t, "cpe:2.3:a:jqlang:jq:1.7:*:*:*:*:*:*:*", cpe)
+	_, err = cpeForVersion("cpe:/a:jqlang:jq", "1.7")
+	require.Error(t, err)
+}
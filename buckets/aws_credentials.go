@@ -0,0 +1,307 @@
+package buckets
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// AWSCredentials are credentials for AWS.
+type AWSCredentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// Expires is when temporary credentials expire, or zero.
+	Expires time.Time
+}
+
+// An AWSCredentialProvider retrieves credentials for AWS.
+//
+// It returns nil credentials if none are available, in which case requests are anonymous.
+type AWSCredentialProvider func(ctx context.Context) (*AWSCredentials, error)
+
+// How long to wait for instance and container metadata services, which don't exist outside AWS.
+const metadataTimeout = time.Second
+
+// DefaultAWSCredentials returns an AWSCredentialProvider that uses the first
+// credentials found, in the same order as the AWS CLI:
+//
+//  1. $AWS_ACCESS_KEY_ID, $AWS_SECRET_ACCESS_KEY and $AWS_SESSION_TOKEN.
+//  2. A web identity token in $AWS_WEB_IDENTITY_TOKEN_FILE exchanged for
+//     credentials for $AWS_ROLE_ARN, eg. an EKS service account's IAM role.
+//  3. The $AWS_PROFILE (or "default") profile in ~/.aws/credentials, or
+//     $AWS_SHARED_CREDENTIALS_FILE.
+//  4. The ECS container credentials endpoint.
+//  5. The IAM role of the EC2 instance, from the instance metadata service.
+//
+// "client" is used to retrieve temporary credentials.
+func DefaultAWSCredentials(client *http.Client) AWSCredentialProvider {
+	return func(ctx context.Context) (*AWSCredentials, error) {
+		if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+			return &AWSCredentials{
+				AccessKeyID:     id,
+				SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+				SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+			}, nil
+		}
+		if tokenFile, role := os.Getenv("AWS_WEB_IDENTITY_TOKEN_FILE"), os.Getenv("AWS_ROLE_ARN"); tokenFile != "" && role != "" {
+			endpoint := "https://sts.amazonaws.com"
+			if region := os.Getenv("AWS_REGION"); region != "" {
+				endpoint = "https://sts." + region + ".amazonaws.com"
+			}
+			return webIdentityCredentials(ctx, client, endpoint, tokenFile, role)
+		}
+		creds, err := sharedCredentials(sharedCredentialsFile(), awsProfile())
+		if creds != nil || err != nil {
+			return creds, err
+		}
+		if uri, token := containerCredentialsEndpoint(); uri != "" {
+			return containerCredentials(ctx, client, uri, token)
+		}
+		if strings.EqualFold(os.Getenv("AWS_EC2_METADATA_DISABLED"), "true") {
+			return nil, nil
+		}
+		endpoint := os.Getenv("AWS_EC2_METADATA_SERVICE_ENDPOINT")
+		if endpoint == "" {
+			endpoint = "http://169.254.169.254"
+		}
+		return instanceCredentials(ctx, client, endpoint)
+	}
+}
+
+func cacheAWSCredentials(provider AWSCredentialProvider, now func() time.Time) AWSCredentialProvider {
+	cache := &cached{now: now}
+	var creds *AWSCredentials
+	return func(ctx context.Context) (*AWSCredentials, error) {
+		cache.lock.Lock()
+		defer cache.lock.Unlock()
+		if cache.fresh() {
+			return creds, nil
+		}
+		fresh, err := provider(ctx)
+		if err != nil {
+			return nil, err
+		}
+		creds = fresh
+		expires := time.Time{}
+		if creds != nil {
+			expires = creds.Expires
+		}
+		cache.set(expires)
+		return creds, nil
+	}
+}
+
+func awsProfile() string {
+	if profile := os.Getenv("AWS_PROFILE"); profile != "" {
+		return profile
+	}
+	return "default"
+}
+
+func sharedCredentialsFile() string {
+	if path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".aws", "credentials")
+}
+
+// Read the static credentials of "profile" from an AWS shared credentials file.
+func sharedCredentials(path, profile string) (*AWSCredentials, error) {
+	if path == "" {
+		return nil, nil
+	}
+	r, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer r.Close()
+	var (
+		creds   *AWSCredentials
+		section string
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if creds == nil {
+			creds = &AWSCredentials{}
+		}
+		value := strings.TrimSpace(parts[1])
+		switch strings.TrimSpace(parts[0]) {
+		case "aws_access_key_id":
+			creds.AccessKeyID = value
+		case "aws_secret_access_key":
+			creds.SecretAccessKey = value
+		case "aws_session_token":
+			creds.SessionToken = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	if creds == nil || creds.AccessKeyID == "" {
+		return nil, nil
+	}
+	return creds, nil
+}
+
+// Exchange a web identity token for credentials of an IAM role with STS' AssumeRoleWithWebIdentity.
+func webIdentityCredentials(ctx context.Context, client *http.Client, endpoint, tokenFile, role string) (*AWSCredentials, error) {
+	token, err := os.ReadFile(tokenFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	query := url.Values{
+		"Action":           {"AssumeRoleWithWebIdentity"},
+		"Version":          {"2011-06-15"},
+		"RoleArn":          {role},
+		"RoleSessionName":  {"hermit"},
+		"WebIdentityToken": {strings.TrimSpace(string(token))},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/?"+query.Encode(), nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, "AssumeRoleWithWebIdentity failed")
+	}
+	result := struct {
+		Credentials struct {
+			AccessKeyID     string    `xml:"AccessKeyId"`
+			SecretAccessKey string    `xml:"SecretAccessKey"`
+			SessionToken    string    `xml:"SessionToken"`
+			Expiration      time.Time `xml:"Expiration"`
+		} `xml:"AssumeRoleWithWebIdentityResult>Credentials"`
+	}{}
+	if err := decodeAWSResponse(resp, &result); err != nil {
+		return nil, errors.Wrapf(err, "AssumeRoleWithWebIdentity for %s failed", role)
+	}
+	return &AWSCredentials{
+		AccessKeyID:     result.Credentials.AccessKeyID,
+		SecretAccessKey: result.Credentials.SecretAccessKey,
+		SessionToken:    result.Credentials.SessionToken,
+		Expires:         result.Credentials.Expiration,
+	}, nil
+}
+
+func containerCredentialsEndpoint() (uri, token string) {
+	if relative := os.Getenv("AWS_CONTAINER_CREDENTIALS_RELATIVE_URI"); relative != "" {
+		return "http://169.254.170.2" + relative, os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+	}
+	return os.Getenv("AWS_CONTAINER_CREDENTIALS_FULL_URI"), os.Getenv("AWS_CONTAINER_AUTHORIZATION_TOKEN")
+}
+
+// Credentials as returned by the container and instance metadata services.
+type metadataCredentials struct {
+	AccessKeyID     string    `json:"AccessKeyId"`
+	SecretAccessKey string    `json:"SecretAccessKey"`
+	Token           string    `json:"Token"`
+	Expiration      time.Time `json:"Expiration"`
+}
+
+func (m *metadataCredentials) credentials() *AWSCredentials {
+	return &AWSCredentials{
+		AccessKeyID:     m.AccessKeyID,
+		SecretAccessKey: m.SecretAccessKey,
+		SessionToken:    m.Token,
+		Expires:         m.Expiration,
+	}
+}
+
+// Retrieve the credentials of an ECS task's IAM role.
+func containerCredentials(ctx context.Context, client *http.Client, uri, token string) (*AWSCredentials, error) {
+	header := http.Header{}
+	if token != "" {
+		header.Set("Authorization", token)
+	}
+	data, err := metadataRequest(ctx, client, http.MethodGet, uri, header)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not retrieve container credentials")
+	}
+	creds := &metadataCredentials{}
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil, errors.Wrap(err, "invalid container credentials")
+	}
+	return creds.credentials(), nil
+}
+
+// Retrieve the credentials of an EC2 instance's IAM role with IMDSv2.
+//
+// Returns nil credentials if there is no instance metadata service, or the
+// instance has no IAM role.
+func instanceCredentials(ctx context.Context, client *http.Client, endpoint string) (*AWSCredentials, error) {
+	token, err := metadataRequest(ctx, client, http.MethodPut, endpoint+"/latest/api/token",
+		http.Header{"X-Aws-Ec2-Metadata-Token-Ttl-Seconds": {"21600"}})
+	if err != nil {
+		return nil, nil // nolint: nilerr
+	}
+	header := http.Header{"X-Aws-Ec2-Metadata-Token": {string(token)}}
+	base := endpoint + "/latest/meta-data/iam/security-credentials/"
+	roles, err := metadataRequest(ctx, client, http.MethodGet, base, header)
+	if err != nil {
+		return nil, nil // nolint: nilerr
+	}
+	role := strings.TrimSpace(strings.SplitN(string(roles), "\n", 2)[0])
+	if role == "" {
+		return nil, nil
+	}
+	data, err := metadataRequest(ctx, client, http.MethodGet, base+role, header)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not retrieve instance credentials")
+	}
+	creds := &metadataCredentials{}
+	if err := json.Unmarshal(data, creds); err != nil {
+		return nil, errors.Wrap(err, "invalid instance credentials")
+	}
+	return creds.credentials(), nil
+}
+
+func metadataRequest(ctx context.Context, client *http.Client, method, uri string, header http.Header) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, metadataTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, method, uri, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header = header
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s: %s", uri, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1024*1024))
+	return data, errors.WithStack(err)
+}
@@ -0,0 +1,109 @@
+package buckets
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/sources"
+	"github.com/cashapp/hermit/ui"
+)
+
+// Backend returns a sources.Backend that synchronises manifests from
+// "s3://<bucket>/<prefix>" and "gs://<bucket>/<prefix>" sources.
+//
+// Each ".hcl" object below the prefix is added to the source, or if the
+// prefix itself ends in ".hcl", only that object.
+func (c *Client) Backend() sources.Backend {
+	return &backend{client: c}
+}
+
+type backend struct {
+	client *Client
+}
+
+func (b *backend) Resolve(uri *url.URL, sourcesDir string) (string, error) {
+	if b.client.store(uri.Scheme) == nil {
+		return "", errors.Errorf("unsupported scheme %q", uri.Scheme)
+	}
+	if uri.Host == "" {
+		return "", errors.New("missing bucket")
+	}
+	return sources.DefaultBackendDir(uri, sourcesDir), nil
+}
+
+func (b *backend) Sync(task *ui.Task, uri *url.URL, dir string) error {
+	ctx := context.Background()
+	store := b.client.store(uri.Scheme)
+	bucket, prefix := uri.Host, strings.TrimPrefix(uri.Path, "/")
+	var keys []string
+	if strings.HasSuffix(prefix, ".hcl") {
+		keys = []string{prefix}
+	} else {
+		if prefix != "" && !strings.HasSuffix(prefix, "/") {
+			prefix += "/"
+		}
+		all, err := store.list(ctx, bucket, prefix)
+		if err != nil {
+			return err
+		}
+		for _, key := range all {
+			if strings.HasSuffix(key, ".hcl") {
+				keys = append(keys, key)
+			}
+		}
+	}
+	task.Debugf("Syncing %d manifests from %s", len(keys), uri)
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	for _, key := range keys {
+		if err := b.syncObject(ctx, store, bucket, key, tmpDir); err != nil {
+			return errors.Wrapf(err, "%s://%s/%s", uri.Scheme, bucket, key)
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmpDir, dir))
+}
+
+func (b *backend) syncObject(ctx context.Context, store store, bucket, key, dir string) error {
+	resp, err := store.object(ctx, http.MethodGet, bucket, key, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("failed to retrieve object: %s", resp.Status)
+	}
+	// Manifests are looked up by file name, so flatten the hierarchy.
+	w, err := os.Create(filepath.Join(dir, path.Base(key)))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer w.Close()
+	_, err = io.Copy(w, resp.Body)
+	return errors.WithStack(err)
+}
+
+func (b *backend) Fetch(_ *url.URL, dir string) (fs.FS, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return os.DirFS(dir), nil
+}
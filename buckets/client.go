@@ -0,0 +1,205 @@
+// Package buckets retrieves packages and manifest sources from cloud storage
+// buckets, "s3://<bucket>/<key>" in Amazon S3 and "gs://<bucket>/<object>" in
+// Google Cloud Storage, using ambient cloud credentials.
+package buckets
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultRetries    = 4
+	defaultMinBackoff = 250 * time.Millisecond
+	defaultMaxBackoff = 5 * time.Second
+)
+
+// Option for the Client.
+type Option func(*Client)
+
+// WithAWSCredentials sets the provider of credentials for S3.
+//
+// Defaults to DefaultAWSCredentials().
+func WithAWSCredentials(provider AWSCredentialProvider) Option {
+	return func(c *Client) { c.awsCredentials = provider }
+}
+
+// WithGCPCredentials sets the source of access tokens for Google Cloud Storage.
+//
+// Defaults to DefaultGCPCredentials().
+func WithGCPCredentials(source GCPTokenSource) Option {
+	return func(c *Client) { c.gcpCredentials = source }
+}
+
+// WithS3Endpoint sets the base URL of an S3 compatible service, eg.
+// "http://localhost:9000" for MinIO, that buckets are addressed by path in.
+//
+// Defaults to $AWS_ENDPOINT_URL_S3 or $AWS_ENDPOINT_URL, or AWS itself if neither is set.
+func WithS3Endpoint(endpoint string) Option {
+	return func(c *Client) { c.s3.endpoint = endpoint }
+}
+
+// WithRegion sets the AWS region requests are initially made to.
+//
+// Defaults to $AWS_REGION or $AWS_DEFAULT_REGION, or "us-east-1". Requests to
+// buckets in other regions are redirected to their region.
+func WithRegion(region string) Option {
+	return func(c *Client) { c.s3.region = region }
+}
+
+// WithGCSEndpoint sets the base URL of the Google Cloud Storage API.
+func WithGCSEndpoint(endpoint string) Option {
+	return func(c *Client) { c.gcs.endpoint = endpoint }
+}
+
+// WithRetries sets how many times requests that are throttled, or fail
+// because the service is temporarily unavailable, are retried.
+//
+// Retries back off exponentially from "minBackoff" to "maxBackoff", unless
+// the service asks for a specific delay.
+func WithRetries(retries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.retries = retries
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// Client for cloud storage buckets.
+type Client struct {
+	client         *http.Client
+	awsCredentials AWSCredentialProvider
+	gcpCredentials GCPTokenSource
+	s3             *s3Store
+	gcs            *gcsStore
+	retries        int
+	minBackoff     time.Duration
+	maxBackoff     time.Duration
+	now            func() time.Time
+}
+
+// New creates a new Client.
+func New(client *http.Client, options ...Option) *Client {
+	c := &Client{
+		client:     client,
+		retries:    defaultRetries,
+		minBackoff: defaultMinBackoff,
+		maxBackoff: defaultMaxBackoff,
+		now:        time.Now,
+	}
+	c.s3 = &s3Store{client: c, endpoint: awsEndpoint(), region: awsRegion(), regions: map[string]string{}}
+	c.gcs = &gcsStore{client: c, endpoint: "https://storage.googleapis.com"}
+	for _, option := range options {
+		option(c)
+	}
+	if c.awsCredentials == nil {
+		c.awsCredentials = DefaultAWSCredentials(client)
+	}
+	if c.gcpCredentials == nil {
+		c.gcpCredentials = DefaultGCPCredentials(client)
+	}
+	c.awsCredentials = cacheAWSCredentials(c.awsCredentials, c.now)
+	c.gcpCredentials = cacheGCPCredentials(c.gcpCredentials, c.now)
+	return c
+}
+
+// A store of objects in the buckets of a cloud storage service.
+type store interface {
+	// Retrieve an object with a GET or HEAD request.
+	object(ctx context.Context, method, bucket, key string, header http.Header) (*http.Response, error)
+	// List the keys of the objects whose keys start with "prefix".
+	list(ctx context.Context, bucket, prefix string) ([]string, error)
+}
+
+// Returns the store for a URI scheme, or nil.
+func (c *Client) store(scheme string) store {
+	switch scheme {
+	case "s3":
+		return c.s3
+	case "gs":
+		return c.gcs
+	default:
+		return nil
+	}
+}
+
+// Send the request made by "newRequest", retrying if the service is
+// throttling requests or temporarily unavailable.
+//
+// Requests are recreated for each attempt so that they can be signed afresh.
+func (c *Client) do(ctx context.Context, newRequest func() (*http.Request, error)) (*http.Response, error) {
+	for attempt := 0; ; attempt++ {
+		req, err := newRequest()
+		if err != nil {
+			return nil, err
+		}
+		resp, err := c.client.Do(req.WithContext(ctx))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if !isThrottled(resp) || attempt >= c.retries {
+			return resp, nil
+		}
+		delay := c.backoff(attempt, resp)
+		_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+		resp.Body.Close()
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		}
+	}
+}
+
+// Both S3 ("SlowDown") and GCS throttle with these statuses, and recommend retrying server errors.
+func isThrottled(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	default:
+		return false
+	}
+}
+
+// Compute the delay before retry "attempt" (0 based), with "equal jitter".
+func (c *Client) backoff(attempt int, resp *http.Response) time.Duration {
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		delay := time.Duration(seconds) * time.Second
+		if delay > c.maxBackoff {
+			delay = c.maxBackoff
+		}
+		return delay
+	}
+	delay := c.minBackoff << uint(attempt)
+	if delay > c.maxBackoff || delay <= 0 {
+		delay = c.maxBackoff
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Float64()*float64(half)) // nolint: gosec
+}
+
+// Cache credentials until shortly before they expire.
+type cached struct {
+	lock    sync.Mutex
+	expires time.Time
+	now     func() time.Time
+	valid   bool
+}
+
+// Returns true if the cached value is still valid.
+func (c *cached) fresh() bool {
+	return c.valid && (c.expires.IsZero() || c.now().Add(5*time.Minute).Before(c.expires))
+}
+
+func (c *cached) set(expires time.Time) {
+	c.valid = true
+	c.expires = expires
+}
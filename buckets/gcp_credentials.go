@@ -0,0 +1,230 @@
+package buckets
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// OAuth2 scope requested for Google Cloud Storage.
+const gcsScope = "https://www.googleapis.com/auth/devstorage.read_only"
+
+const googleTokenURL = "https://oauth2.googleapis.com/token"
+
+// A GCPTokenSource returns an OAuth2 access token for Google Cloud and when it expires.
+//
+// It returns an empty token if no credentials are available, in which case requests are anonymous.
+type GCPTokenSource func(ctx context.Context) (token string, expires time.Time, err error)
+
+// DefaultGCPCredentials returns a GCPTokenSource that uses the first
+// credentials found, in the same order as Google's client libraries:
+//
+//  1. A service account key or user credentials in the file named by
+//     $GOOGLE_APPLICATION_CREDENTIALS.
+//  2. User credentials created by "gcloud auth application-default login".
+//  3. The service account of the GCE instance or GKE workload (workload
+//     identity), from the metadata server.
+//
+// "client" is used to retrieve access tokens.
+func DefaultGCPCredentials(client *http.Client) GCPTokenSource {
+	return func(ctx context.Context) (string, time.Time, error) {
+		if path := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"); path != "" {
+			return fileCredentials(ctx, client, path)
+		}
+		if path := gcloudCredentialsFile(); path != "" {
+			if _, err := os.Stat(path); err == nil {
+				return fileCredentials(ctx, client, path)
+			}
+		}
+		host := os.Getenv("GCE_METADATA_HOST")
+		if host == "" {
+			host = "metadata.google.internal"
+		}
+		return metadataServerToken(ctx, client, "http://"+host)
+	}
+}
+
+func cacheGCPCredentials(source GCPTokenSource, now func() time.Time) GCPTokenSource {
+	cache := &cached{now: now}
+	var token string
+	return func(ctx context.Context) (string, time.Time, error) {
+		cache.lock.Lock()
+		defer cache.lock.Unlock()
+		if cache.fresh() {
+			return token, cache.expires, nil
+		}
+		fresh, expires, err := source(ctx)
+		if err != nil {
+			return "", time.Time{}, err
+		}
+		token = fresh
+		cache.set(expires)
+		return token, expires, nil
+	}
+}
+
+func gcloudCredentialsFile() string {
+	dir := os.Getenv("CLOUDSDK_CONFIG")
+	if dir == "" {
+		if runtime.GOOS == "windows" {
+			dir = filepath.Join(os.Getenv("APPDATA"), "gcloud")
+		} else if home, err := os.UserHomeDir(); err == nil {
+			dir = filepath.Join(home, ".config", "gcloud")
+		} else {
+			return ""
+		}
+	}
+	return filepath.Join(dir, "application_default_credentials.json")
+}
+
+// The fields of a credentials file used for service account keys and user credentials.
+type credentialsFile struct {
+	Type string `json:"type"`
+	// Service account keys.
+	ClientEmail  string `json:"client_email"`
+	PrivateKeyID string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	TokenURI     string `json:"token_uri"`
+	// User credentials.
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func fileCredentials(ctx context.Context, client *http.Client, path string) (string, time.Time, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", time.Time{}, errors.WithStack(err)
+	}
+	creds := &credentialsFile{}
+	if err := json.Unmarshal(data, creds); err != nil {
+		return "", time.Time{}, errors.Wrapf(err, "%s: invalid credentials", path)
+	}
+	tokenURI := creds.TokenURI
+	if tokenURI == "" {
+		tokenURI = googleTokenURL
+	}
+	var form url.Values
+	switch creds.Type {
+	case "service_account":
+		assertion, err := creds.assertion(time.Now())
+		if err != nil {
+			return "", time.Time{}, errors.Wrap(err, path)
+		}
+		form = url.Values{
+			"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+			"assertion":  {assertion},
+		}
+	case "authorized_user":
+		form = url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {creds.ClientID},
+			"client_secret": {creds.ClientSecret},
+			"refresh_token": {creds.RefreshToken},
+		}
+	default:
+		return "", time.Time{}, errors.Errorf("%s: unsupported credentials type %q", path, creds.Type)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", time.Time{}, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return requestToken(client, req)
+}
+
+// Create a signed JWT asserting the identity of a service account.
+//
+// See https://developers.google.com/identity/protocols/oauth2/service-account#authorizingrequests
+func (c *credentialsFile) assertion(now time.Time) (string, error) {
+	block, _ := pem.Decode([]byte(c.PrivateKey))
+	if block == nil {
+		return "", errors.New("invalid service account private key")
+	}
+	var key *rsa.PrivateKey
+	if parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		rsaKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return "", errors.New("service account private key is not an RSA key")
+		}
+		key = rsaKey
+	} else if key, err = x509.ParsePKCS1PrivateKey(block.Bytes); err != nil {
+		return "", errors.Wrap(err, "invalid service account private key")
+	}
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": c.PrivateKeyID})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	tokenURI := c.TokenURI
+	if tokenURI == "" {
+		tokenURI = googleTokenURL
+	}
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   c.ClientEmail,
+		"scope": gcsScope,
+		"aud":   tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	encoding := base64.RawURLEncoding
+	payload := encoding.EncodeToString(header) + "." + encoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(payload))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return payload + "." + encoding.EncodeToString(signature), nil
+}
+
+// Retrieve the access token of the default service account from the metadata server.
+//
+// Returns an empty token if there is no metadata server.
+func metadataServerToken(ctx context.Context, client *http.Client, endpoint string) (string, time.Time, error) {
+	uri := endpoint + "/computeMetadata/v1/instance/service-accounts/default/token?scopes=" + url.QueryEscape(gcsScope)
+	data, err := metadataRequest(ctx, client, http.MethodGet, uri, http.Header{"Metadata-Flavor": {"Google"}})
+	if err != nil {
+		return "", time.Time{}, nil // nolint: nilerr
+	}
+	return decodeToken(data)
+}
+
+func requestToken(client *http.Client, req *http.Request) (string, time.Time, error) {
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", time.Time{}, errors.WithStack(err)
+	}
+	raw := json.RawMessage{}
+	if err := decodeGCPResponse(resp, &raw); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "could not retrieve access token")
+	}
+	return decodeToken(raw)
+}
+
+func decodeToken(data []byte) (string, time.Time, error) {
+	token := struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}{}
+	if err := json.Unmarshal(data, &token); err != nil {
+		return "", time.Time{}, errors.Wrap(err, "invalid access token response")
+	}
+	return token.AccessToken, time.Now().Add(time.Duration(token.ExpiresIn) * time.Second), nil
+}
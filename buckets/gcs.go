@@ -0,0 +1,100 @@
+package buckets
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type gcsStore struct {
+	client *Client
+	// Base URL of the Google Cloud Storage API.
+	endpoint string
+}
+
+func (g *gcsStore) send(ctx context.Context, method, uri string, header http.Header) (*http.Response, error) {
+	token, _, err := g.client.gcpCredentials(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not retrieve Google Cloud credentials")
+	}
+	return g.client.do(ctx, func() (*http.Request, error) {
+		req, err := http.NewRequest(method, uri, nil)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return req, nil
+	})
+}
+
+func (g *gcsStore) object(ctx context.Context, method, bucket, key string, header http.Header) (*http.Response, error) {
+	// The XML API supports HEAD requests, unlike the JSON API.
+	path := (&url.URL{Path: "/" + bucket + "/" + key}).EscapedPath()
+	return g.send(ctx, method, g.endpoint+path, header)
+}
+
+func (g *gcsStore) list(ctx context.Context, bucket, prefix string) ([]string, error) {
+	var keys []string
+	query := url.Values{"prefix": {prefix}, "fields": {"items(name),nextPageToken"}}
+	for {
+		uri := g.endpoint + "/storage/v1/b/" + url.PathEscape(bucket) + "/o?" + query.Encode()
+		resp, err := g.send(ctx, http.MethodGet, uri, nil)
+		if err != nil {
+			return nil, err
+		}
+		result := struct {
+			Items []struct {
+				Name string `json:"name"`
+			} `json:"items"`
+			NextPageToken string `json:"nextPageToken"`
+		}{}
+		err = decodeGCPResponse(resp, &result)
+		if err != nil {
+			return nil, errors.Wrapf(err, "gs://%s/%s", bucket, prefix)
+		}
+		for _, item := range result.Items {
+			keys = append(keys, item.Name)
+		}
+		if result.NextPageToken == "" {
+			return keys, nil
+		}
+		query.Set("pageToken", result.NextPageToken)
+	}
+}
+
+func decodeGCPResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return gcpError(resp)
+	}
+	return errors.WithStack(json.NewDecoder(resp.Body).Decode(v))
+}
+
+// Return an error including the message of a Google Cloud error response.
+func gcpError(resp *http.Response) error {
+	body := struct {
+		Error json.RawMessage `json:"error"`
+	}{}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body)
+	// JSON APIs return an object, OAuth endpoints a string.
+	message := struct {
+		Message string `json:"message"`
+	}{}
+	if err := json.Unmarshal(body.Error, &message); err != nil {
+		_ = json.Unmarshal(body.Error, &message.Message)
+	}
+	if message.Message == "" {
+		return errors.Errorf("Google Cloud request failed with %s", resp.Status)
+	}
+	return errors.Errorf("Google Cloud request failed with %s: %s", resp.Status, strings.TrimSpace(message.Message))
+}
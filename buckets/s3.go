@@ -0,0 +1,285 @@
+package buckets
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+func awsRegion() string {
+	for _, envar := range []string{"AWS_REGION", "AWS_DEFAULT_REGION"} {
+		if region := os.Getenv(envar); region != "" {
+			return region
+		}
+	}
+	return "us-east-1"
+}
+
+func awsEndpoint() string {
+	for _, envar := range []string{"AWS_ENDPOINT_URL_S3", "AWS_ENDPOINT_URL"} {
+		if endpoint := os.Getenv(envar); endpoint != "" {
+			return endpoint
+		}
+	}
+	return ""
+}
+
+type s3Store struct {
+	client *Client
+	// Base URL of an S3 compatible service using path-style addressing, if not AWS.
+	endpoint string
+	// Default region.
+	region string
+
+	lock sync.Mutex
+	// Regions of buckets outside the default region, discovered from redirects.
+	regions map[string]string
+}
+
+func (s *s3Store) bucketRegion(bucket string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if region, ok := s.regions[bucket]; ok {
+		return region
+	}
+	return s.region
+}
+
+// URL of an object in a bucket.
+func (s *s3Store) url(region, bucket, key string) (*url.URL, error) {
+	var base string
+	switch {
+	case s.endpoint != "":
+		base = strings.TrimSuffix(s.endpoint, "/") + "/" + bucket
+	case strings.Contains(bucket, "."):
+		// Virtual hosted buckets with dots in their name don't match AWS's TLS certificates.
+		base = fmt.Sprintf("https://s3.%s.amazonaws.com/%s", region, bucket)
+	default:
+		base = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region)
+	}
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid S3 endpoint %q", s.endpoint)
+	}
+	u.Path += "/" + key
+	u.RawPath = awsEscape(u.Path, false)
+	return u, nil
+}
+
+// Send a signed request for "key" in "bucket".
+//
+// If the bucket is in a different region, the request is retried in that region.
+func (s *s3Store) send(ctx context.Context, method, bucket, key string, query url.Values, header http.Header) (*http.Response, error) {
+	creds, err := s.client.awsCredentials(ctx)
+	if err != nil {
+		return nil, errors.Wrap(err, "could not retrieve AWS credentials")
+	}
+	region := s.bucketRegion(bucket)
+	for redirects := 0; ; redirects++ {
+		u, err := s.url(region, bucket, key)
+		if err != nil {
+			return nil, err
+		}
+		u.RawQuery = awsCanonicalQuery(query)
+		resp, err := s.client.do(ctx, func() (*http.Request, error) {
+			req, err := http.NewRequest(method, u.String(), nil)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			for name, values := range header {
+				req.Header[name] = values
+			}
+			if creds != nil {
+				signV4(req, creds, region, "s3", s.client.now())
+			}
+			return req, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		actual := resp.Header.Get("X-Amz-Bucket-Region")
+		if redirects > 0 || actual == "" || actual == region || resp.StatusCode < 300 {
+			return resp, nil
+		}
+		resp.Body.Close()
+		region = actual
+		s.lock.Lock()
+		s.regions[bucket] = region
+		s.lock.Unlock()
+	}
+}
+
+func (s *s3Store) object(ctx context.Context, method, bucket, key string, header http.Header) (*http.Response, error) {
+	header = header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	// Ask for the object's SHA256, if it was uploaded with one, so downloads can be verified.
+	header.Set("X-Amz-Checksum-Mode", "ENABLED")
+	return s.send(ctx, method, bucket, key, nil, header)
+}
+
+func (s *s3Store) list(ctx context.Context, bucket, prefix string) ([]string, error) {
+	var keys []string
+	query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+	for {
+		resp, err := s.send(ctx, http.MethodGet, bucket, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+		result := struct {
+			Contents []struct {
+				Key string
+			}
+			IsTruncated           bool
+			NextContinuationToken string
+		}{}
+		err = decodeAWSResponse(resp, &result)
+		if err != nil {
+			return nil, errors.Wrapf(err, "s3://%s/%s", bucket, prefix)
+		}
+		for _, object := range result.Contents {
+			keys = append(keys, object.Key)
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return keys, nil
+		}
+		query.Set("continuation-token", result.NextContinuationToken)
+	}
+}
+
+func decodeAWSResponse(resp *http.Response, v interface{}) error {
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return awsError(resp)
+	}
+	return errors.WithStack(xml.NewDecoder(resp.Body).Decode(v))
+}
+
+// Return an error including the code and message of an AWS error response.
+func awsError(resp *http.Response) error {
+	body := struct {
+		Code    string
+		Message string
+	}{}
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body)
+	if body.Code == "" {
+		return errors.Errorf("AWS request failed with %s", resp.Status)
+	}
+	return errors.Errorf("AWS request failed with %s: %s: %s", resp.Status, body.Code, body.Message)
+}
+
+// Sign a request with AWS Signature Version 4.
+//
+// The payload is not signed unless the request already has an
+// X-Amz-Content-Sha256 header. See
+// https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func signV4(req *http.Request, creds *AWSCredentials, region, service string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = unsignedPayload
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+	if creds.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for key, values := range req.Header {
+		key = strings.ToLower(key)
+		if strings.HasPrefix(key, "x-amz-") || key == "range" || key == "content-type" {
+			headers[key] = strings.Join(values, ",")
+		}
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	canonicalHeaders := &strings.Builder{}
+	for _, name := range names {
+		fmt.Fprintf(canonicalHeaders, "%s:%s\n", name, strings.TrimSpace(headers[name]))
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		awsEscape(req.URL.Path, false),
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	scope := strings.Join([]string{date, region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, sha256Hex([]byte(canonicalRequest))}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	for _, part := range []string{region, service, "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		creds.AccessKeyID, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	_, _ = h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func awsCanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	parts := []string{}
+	for _, key := range keys {
+		values := append([]string{}, query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, awsEscape(key, true)+"="+awsEscape(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// URI encode "s" as AWS requires, escaping everything but unreserved
+// characters, and "/" if "escapeSlash" is true.
+func awsEscape(s string, escapeSlash bool) string {
+	out := &strings.Builder{}
+	for _, b := range []byte(s) {
+		switch {
+		case 'a' <= b && b <= 'z', 'A' <= b && b <= 'Z', '0' <= b && b <= '9',
+			b == '-', b == '_', b == '.', b == '~', b == '/' && !escapeSlash:
+			out.WriteByte(b)
+		default:
+			fmt.Fprintf(out, "%%%02X", b)
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,64 @@
+package buckets
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/cache"
+)
+
+// WithTransport returns a RoundTripper that serves GET and HEAD requests for
+// "s3://" and "gs://" URIs from their bucket, and passes all other requests
+// through to "transport".
+//
+// Objects uploaded to S3 with a SHA256 checksum are verified against it.
+func (c *Client) WithTransport(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &bucketTransport{client: c, rt: transport}
+}
+
+// Wrap returns a copy of "client" whose transport is wrapped with WithTransport.
+func (c *Client) Wrap(client *http.Client) *http.Client {
+	out := *client
+	out.Transport = c.WithTransport(client.Transport)
+	return &out
+}
+
+type bucketTransport struct {
+	client *Client
+	rt     http.RoundTripper
+}
+
+func (b *bucketTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	store := b.client.store(req.URL.Scheme)
+	if store == nil {
+		return b.rt.RoundTrip(req)
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return nil, errors.Errorf("%s %s: only GET and HEAD requests are supported", req.Method, req.URL)
+	}
+	header := http.Header{}
+	for _, name := range []string{"Range", "If-None-Match", "If-Range"} {
+		if value := req.Header.Get(name); value != "" {
+			header.Set(name, value)
+		}
+	}
+	resp, err := store.object(req.Context(), req.Method, req.URL.Host, strings.TrimPrefix(req.URL.Path, "/"), header)
+	if err != nil {
+		return nil, err
+	}
+	resp.Request = req
+	if sum := resp.Header.Get("X-Amz-Checksum-Sha256"); sum != "" {
+		// Checksums of multipart uploads are checksums of checksums, and end in "-<parts>".
+		if raw, err := base64.StdEncoding.DecodeString(sum); err == nil && len(raw) == 32 {
+			cache.SetExpectedDigest(resp, "sha256:"+hex.EncodeToString(raw))
+		}
+	}
+	return resp, nil
+}
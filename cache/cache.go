@@ -6,7 +6,6 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -25,8 +24,19 @@ type Cache struct {
 	httpClient         *http.Client
 	fastFailHTTPClient *http.Client
 	strategies         []DownloadStrategy
+	ctx                context.Context
+	inflight           *inflight
+	offline            bool
+	progress           ProgressFunc
 }
 
+// A ProgressFunc is called as "uri" downloads, with the number of bytes
+// downloaded so far and the total size of the download, or -1 if unknown.
+type ProgressFunc func(uri string, downloaded, total int64)
+
+// ErrOffline is returned when the cache is offline and a remote artifact is not already cached.
+var ErrOffline = errors.New("offline and not in the local cache")
+
 // DownloadStrategy defines a strategy for downloading URLs.
 //
 // Typically useful for packages behind authenticated endpoints, etc.
@@ -57,12 +67,42 @@ func Open(stateDir string, strategies []DownloadStrategy, client *http.Client, f
 		root:               stateDir,
 		httpClient:         client,
 		fastFailHTTPClient: fastFailClient,
+		ctx:                context.Background(),
+		inflight:           &inflight{calls: map[string]*inflightDownload{}},
 	}
 	c.strategies = append(c.strategies, c.defaultDownloadStrategy)
 	c.strategies = append(c.strategies, strategies...)
 	return c, nil
 }
 
+// WithContext returns a shallow copy of the Cache whose downloads are cancelled when ctx is.
+func (c *Cache) WithContext(ctx context.Context) *Cache {
+	out := *c
+	out.ctx = ctx
+	return &out
+}
+
+// Context returns the context that downloads are cancelled with.
+func (c *Cache) Context() context.Context {
+	return c.ctx
+}
+
+// SetProgress sets a function called with the progress of each download.
+func (c *Cache) SetProgress(progress ProgressFunc) {
+	c.progress = progress
+}
+
+// SetOffline prevents the cache from accessing the network. Only local
+// files and previously cached remote artifacts can then be retrieved.
+func (c *Cache) SetOffline(offline bool) {
+	c.offline = offline
+}
+
+// Offline returns true if the cache may not access the network.
+func (c *Cache) Offline() bool {
+	return c.offline
+}
+
 // Root directory of the cache.
 func (c *Cache) Root() string {
 	return c.root
@@ -128,7 +168,11 @@ func (c *Cache) Download(b *ui.Task, checksum, uri string, mirrors ...string) (p
 		if err != nil {
 			return "", "", errors.WithStack(err)
 		}
-		path, etag, err = source.Download(b, c, checksum)
+		if _, local := source.(*fileSource); c.offline && !local {
+			path, err = c.offlinePath(checksum, uri)
+		} else {
+			path, etag, err = source.Download(b, c, checksum)
+		}
 		if err == nil {
 			return path, etag, nil
 		}
@@ -141,9 +185,23 @@ func (c *Cache) Download(b *ui.Task, checksum, uri string, mirrors ...string) (p
 	return "", "", errors.Wrap(lastError, uris[len(uris)-1])
 }
 
+// The path of a previously cached artifact, or ErrOffline.
+func (c *Cache) offlinePath(checksum, uri string) (string, error) {
+	path := c.Path(checksum, uri)
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return "", errors.WithStack(ErrOffline)
+	} else if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return path, nil
+}
+
 // ETag fetches the etag from given URI if available.
 // Otherwise an empty string is returned
 func (c *Cache) ETag(b *ui.Task, uri string, mirrors ...string) (etag string, err error) {
+	if c.offline {
+		return "", errors.WithStack(ErrOffline)
+	}
 	for _, uri := range append([]string{uri}, mirrors...) {
 		source, err := GetSource(uri)
 		if err != nil {
@@ -186,67 +244,121 @@ func (c *Cache) Path(checksum, uri string) string {
 	return filepath.Join(c.root, base)
 }
 
+// Download uri to cachePath.
+//
+// Concurrent downloads of the same file are coalesced, both within this
+// process and, via a lock file, across processes.
 func (c *Cache) downloadHTTP(b *ui.Task, checksum string, uri string, cachePath string) (string, string, error) {
-	task := b.SubTask("download")
-	cacheDir := filepath.Dir(cachePath)
-	_ = os.MkdirAll(cacheDir, os.ModePerm)
+	return c.inflight.do(cachePath, func() (string, string, error) {
+		task := b.SubTask("download")
+		_, statErr := os.Stat(cachePath)
+		_ = os.MkdirAll(filepath.Dir(cachePath), os.ModePerm)
+		lock := util.NewLock(cachePath+".lock", lockCheckInterval)
+		if err := lock.Acquire(c.ctx, task); err != nil {
+			return "", "", errors.WithStack(err)
+		}
+		defer lock.Release(task)
+		// Another process downloaded it while we were waiting for the lock.
+		if _, err := os.Stat(cachePath); os.IsNotExist(statErr) && err == nil {
+			task.Debugf("Downloaded concurrently by another process: %s", uri)
+			return cachePath, "", nil
+		}
+		return c.downloadHTTPLocked(task, checksum, uri, cachePath)
+	})
+}
 
-	w, err := ioutil.TempFile(cacheDir, filepath.Base(cachePath)+".*.hermit.tmp.download")
+// Download uri to cachePath, resuming a previous partial download if the server supports it.
+//
+// The caller must hold the download lock for cachePath.
+func (c *Cache) downloadHTTPLocked(task *ui.Task, checksum string, uri string, cachePath string) (string, string, error) {
+	w, err := openPartial(cachePath)
 	if err != nil {
-		return "", "", errors.Wrap(err, "couldn't create temporary for download")
+		return "", "", err
 	}
 	defer w.Close() // nolint: gosec
-	defer os.Remove(w.Name())
+
+	// Hash any existing partial content so the final checksum covers the whole file.
+	h := sha256.New()
+	resumed, err := io.Copy(h, w)
+	if err != nil {
+		w.remove()
+		return "", "", errors.WithStack(err)
+	}
+	// Without a validator there's no way to tell if the file changed since, so start again.
+	validator := w.validator()
+	if resumed > 0 && validator == "" {
+		task.Debugf("Partial download of %s has no ETag or Last-Modified date, downloading from the start", uri)
+		h.Reset()
+		resumed = 0
+		if err := w.reset(); err != nil {
+			return "", "", err
+		}
+	}
 
 	// For HTTP files we download and cache them, then return the cached file.
-	task.Debugf("Downloading %s", uri)
+	if resumed > 0 {
+		task.Debugf("Resuming download of %s from byte %d", uri, resumed)
+	} else {
+		task.Debugf("Downloading %s", uri)
+	}
 
-	ctx := context.Background()
-	var errs error
-	var response *http.Response
-	for _, strategy := range c.strategies {
-		resp, err := strategy(ctx, uri)
-		if err != nil {
-			errs = multierror.Append(errs, err)
-			task.Debugf("Download strategy failed: %s", err)
-		} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
-			errs = multierror.Append(errs, errors.New(resp.Status))
-			task.Debugf("Download strategy failed: %s", resp.Status)
-		} else {
-			response = resp
-			defer response.Body.Close()
-			break
-		}
+	ctx := c.ctx
+	if checksum == "" {
+		ctx = withUnpinnedChecksum(ctx)
+	}
+	response, err := c.fetch(withResume(ctx, resumed, validator), task, uri)
+	if err != nil && resumed > 0 {
+		// Eg. 416 Range Not Satisfiable, so try again from the start.
+		task.Debugf("Resuming download failed, downloading from the start: %s", err)
+		response, err = c.fetch(ctx, task, uri)
+	}
+	if err != nil {
+		return "", "", err
 	}
-	if response == nil {
-		return "", "", errors.Wrap(errs, "all download strategies failed")
+	defer response.Body.Close()
+	if !isResumed(response, resumed) {
+		if resumed > 0 {
+			task.Debugf("Server did not resume %s, downloading from the start", uri)
+		}
+		h.Reset()
+		resumed = 0
+		if err := w.reset(); err != nil {
+			return "", "", err
+		}
 	}
 	etag := response.Header.Get("ETag")
+	if err := w.setValidator(response); err != nil {
+		return "", "", err
+	}
 
-	info, err := w.Stat()
-	if err != nil {
-		return "", "", errors.WithStack(err)
+	if err := checkFreeSpace(filepath.Dir(cachePath), response.ContentLength); err != nil {
+		return "", "", err
 	}
-	resumed := info.Size()
 	task.Size(int(response.ContentLength + resumed))
 	task.Add(int(resumed))
 	defer task.Done()
 
-	h := sha256.New()
 	r := io.TeeReader(response.Body, h)
 	r = io.TeeReader(r, task.ProgressWriter())
+	if c.progress != nil {
+		total := int64(-1)
+		if response.ContentLength >= 0 {
+			total = response.ContentLength + resumed
+		}
+		r = io.TeeReader(r, &progressWriter{uri: uri, downloaded: resumed, total: total, progress: c.progress})
+	}
+	// On failure the partial download is kept, so that it can be resumed.
 	_, err = io.Copy(w, r)
 	if err != nil {
-		_ = w.Close()
 		return "", "", errors.WithStack(err)
 	}
 	err = w.Close()
 	if err != nil {
 		return "", "", errors.WithStack(err)
 	}
-	// TODO: We'll need to checksum the existing content when resuming.
 	actualChecksum := hex.EncodeToString(h.Sum(nil))
-	if checksum != "" && checksum != actualChecksum {
+	if checksum := expectedChecksum(checksum, response); checksum != "" && checksum != actualChecksum {
+		w.remove()
 		return "", "", errors.Errorf("%s: checksum %s should have been %s", uri, actualChecksum, checksum)
 	}
 
@@ -260,17 +372,52 @@ func (c *Cache) downloadHTTP(b *ui.Task, checksum string, uri string, cachePath
 	if err != nil {
 		return "", "", errors.WithStack(err)
 	}
+	w.remove()
 	return cachePath, etag, nil
 }
 
+// Try each download strategy in turn, returning the first successful response.
+func (c *Cache) fetch(ctx context.Context, task *ui.Task, uri string) (*http.Response, error) {
+	var errs error
+	for _, strategy := range c.strategies {
+		resp, err := strategy(ctx, uri)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			task.Debugf("Download strategy failed: %s", err)
+		} else if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			_ = resp.Body.Close()
+			errs = multierror.Append(errs, errors.New(resp.Status))
+			task.Debugf("Download strategy failed: %s", resp.Status)
+		} else {
+			return resp, nil
+		}
+	}
+	return nil, errors.Wrap(errs, "all download strategies failed")
+}
+
 func (c *Cache) defaultDownloadStrategy(ctx context.Context, url string) (*http.Response, error) {
 	req, err := http.NewRequestWithContext(ctx, "GET", url, &bytes.Reader{})
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	SetResumeHeaders(req)
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
 		return nil, errors.Wrap(err, "default HTTP client failed")
 	}
 	return resp, nil
 }
+
+// Reports the bytes written to it to a ProgressFunc.
+type progressWriter struct {
+	uri        string
+	downloaded int64
+	total      int64
+	progress   ProgressFunc
+}
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	p.downloaded += int64(len(b))
+	p.progress(p.uri, p.downloaded, p.total)
+	return len(b), nil
+}
@@ -0,0 +1,187 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/ui"
+)
+
+func TestDownloadResumesPartialDownload(t *testing.T) {
+	content := []byte(strings.Repeat("hermit", 1024))
+	sum := sha256.Sum256(content)
+	var (
+		lock   sync.Mutex
+		ranges []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		ranges = append(ranges, r.Header.Get("Range"))
+		lock.Unlock()
+		w.Header().Set("ETag", `"v1"`)
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	c, err := Open(t.TempDir(), nil, srv.Client(), srv.Client())
+	require.NoError(t, err)
+	uri := srv.URL + "/file.tar.gz"
+	checksum := hex.EncodeToString(sum[:])
+	cachePath := c.Path(checksum, uri)
+	require.NoError(t, os.MkdirAll(filepath.Dir(cachePath), 0700))
+	require.NoError(t, os.WriteFile(cachePath+".partial", content[:1000], 0600))
+	require.NoError(t, os.WriteFile(cachePath+".partial.etag", []byte(`"v1"`), 0600))
+
+	p, _ := ui.NewForTesting()
+	path, _, err := c.Download(p.Task("test"), checksum, uri)
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+	require.Equal(t, []string{"bytes=1000-"}, ranges)
+	require.NoFileExists(t, cachePath+".partial")
+}
+
+func TestDownloadResumesWithLastModified(t *testing.T) {
+	content := []byte(strings.Repeat("hermit", 1024))
+	modified := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var ifRange []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifRange = append(ifRange, r.Header.Get("If-Range"))
+		http.ServeContent(w, r, "file", modified, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	c, err := Open(t.TempDir(), nil, srv.Client(), srv.Client())
+	require.NoError(t, err)
+	uri := srv.URL + "/file.tar.gz"
+	cachePath := c.Path("", uri)
+	require.NoError(t, os.MkdirAll(filepath.Dir(cachePath), 0700))
+	require.NoError(t, os.WriteFile(cachePath+".partial", content[:1000], 0600))
+	require.NoError(t, os.WriteFile(cachePath+".partial.etag", []byte(modified.Format(http.TimeFormat)), 0600))
+
+	p, _ := ui.NewForTesting()
+	path, _, err := c.Download(p.Task("test"), "", uri)
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+	require.Equal(t, []string{modified.Format(http.TimeFormat)}, ifRange)
+}
+
+func TestDownloadRestartsWithoutValidator(t *testing.T) {
+	content := []byte(strings.Repeat("hermit", 1024))
+	var ranges []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		http.ServeContent(w, r, "file", time.Time{}, bytes.NewReader(content))
+	}))
+	defer srv.Close()
+
+	c, err := Open(t.TempDir(), nil, srv.Client(), srv.Client())
+	require.NoError(t, err)
+	uri := srv.URL + "/file.tar.gz"
+	cachePath := c.Path("", uri)
+	require.NoError(t, os.MkdirAll(filepath.Dir(cachePath), 0700))
+	// The file has changed since the partial download.
+	require.NoError(t, os.WriteFile(cachePath+".partial", []byte(strings.Repeat("stale!", 100)), 0600))
+
+	p, _ := ui.NewForTesting()
+	path, _, err := c.Download(p.Task("test"), "", uri)
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+	require.Equal(t, []string{""}, ranges)
+}
+
+func TestDownloadRestartsWhenRangeIgnored(t *testing.T) {
+	content := []byte(strings.Repeat("hermit", 1024))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	c, err := Open(t.TempDir(), nil, srv.Client(), srv.Client())
+	require.NoError(t, err)
+	uri := srv.URL + "/file.tar.gz"
+	cachePath := c.Path("", uri)
+	require.NoError(t, os.MkdirAll(filepath.Dir(cachePath), 0700))
+	require.NoError(t, os.WriteFile(cachePath+".partial", []byte("garbage"), 0600))
+
+	p, _ := ui.NewForTesting()
+	path, _, err := c.Download(p.Task("test"), "", uri)
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+}
+
+func TestDownloadVerifiesDigestReportedByOrigin(t *testing.T) {
+	content := []byte(strings.Repeat("hermit", 1024))
+	sum := sha256.Sum256(content)
+	// Only respond to the test strategy, not the default strategy that precedes it.
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Strategy") == "" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(content)
+	}))
+	defer srv.Close()
+
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	strategy := func(ctx context.Context, uri string) (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("X-Strategy", "digest")
+		resp, err := srv.Client().Do(req)
+		if err != nil {
+			return nil, err
+		}
+		SetExpectedDigest(resp, digest)
+		return resp, nil
+	}
+	c, err := Open(t.TempDir(), []DownloadStrategy{strategy}, srv.Client(), srv.Client())
+	require.NoError(t, err)
+	p, _ := ui.NewForTesting()
+
+	path, _, err := c.Download(p.Task("test"), "", srv.URL+"/good.tar.gz")
+	require.NoError(t, err)
+	require.FileExists(t, path)
+
+	digest = "sha256:" + strings.Repeat("0", 64)
+	uri := srv.URL + "/bad.tar.gz"
+	_, _, err = c.Download(p.Task("test"), "", uri)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "should have been "+strings.Repeat("0", 64))
+	require.NoFileExists(t, c.Path("", uri))
+	require.NoFileExists(t, c.Path("", uri)+".partial")
+
+	// Other digest algorithms are ignored.
+	digest = "sha512:" + strings.Repeat("0", 128)
+	_, _, err = c.Download(p.Task("test"), "", srv.URL+"/other.tar.gz")
+	require.NoError(t, err)
+}
+
+func TestCheckFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, checkFreeSpace(dir, -1))
+	require.NoError(t, checkFreeSpace(dir, 1))
+	require.Error(t, checkFreeSpace(dir, math.MaxInt64))
+}
@@ -0,0 +1,70 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/util"
+)
+
+// Response header used by download strategies to pass the SHA256 checksum the
+// origin reports for a file back to the cache. It is only used when the
+// manifest does not pin a checksum of its own.
+const expectedSHA256Header = "X-Hermit-Expected-Sha256"
+
+// SetExpectedDigest records the checksum an origin reports for the file in "resp".
+//
+// "digest" is in the form "<algorithm>:<hex>"; digests using algorithms other
+// than sha256 are ignored.
+func SetExpectedDigest(resp *http.Response, digest string) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 || !strings.EqualFold(parts[0], "sha256") || parts[1] == "" {
+		return
+	}
+	if resp.Header == nil {
+		resp.Header = http.Header{}
+	}
+	resp.Header.Set(expectedSHA256Header, strings.ToLower(parts[1]))
+}
+
+type unpinnedKey struct{}
+
+// Mark a download as having no checksum pinned by its manifest, so that the
+// transport may look up the checksum the origin reports for it.
+func withUnpinnedChecksum(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unpinnedKey{}, true)
+}
+
+// Returns true if the download in ctx has no pinned checksum.
+func isChecksumUnpinned(ctx context.Context) bool {
+	unpinned, _ := ctx.Value(unpinnedKey{}).(bool)
+	return unpinned
+}
+
+// The checksum a download must match: the pinned checksum if there is one, otherwise any reported by the origin.
+func expectedChecksum(checksum string, resp *http.Response) string {
+	if checksum != "" {
+		return checksum
+	}
+	return resp.Header.Get(expectedSHA256Header)
+}
+
+// Refuse to start a download of "size" bytes into "dir" if it clearly won't fit.
+//
+// Failure to determine the free space is not an error.
+func checkFreeSpace(dir string, size int64) error {
+	if size <= 0 {
+		return nil
+	}
+	free, err := util.FreeSpace(dir)
+	if err != nil {
+		return nil // nolint: nilerr
+	}
+	if uint64(size) > free {
+		return errors.Errorf("not enough disk space in %s: need %d bytes but only %d are available", dir, size, free)
+	}
+	return nil
+}
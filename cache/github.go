@@ -6,39 +6,152 @@ import (
 	"net/http"
 	"net/url"
 	"regexp"
+	"strconv"
 
 	"github.com/pkg/errors"
 
 	"github.com/cashapp/hermit/github"
 )
 
-// matches: https://github.com/{OWNER}/{REPO}/releases/download/{TAG}/{ASSET}
-var githubRe = regexp.MustCompile(`^https\://github.com/([^/]+)/([^/]+)/releases/download/([^/]+)/([^/]+)$`)
+// matches: https://{HOST}/{OWNER}/{REPO}/releases/download/{TAG}/{ASSET}
+var githubRe = regexp.MustCompile(`^https\://([^/]+)/([^/]+)/([^/]+)/releases/download/([^/]+)/([^/]+)$`)
 
 // GitHubPrivateReleaseDownloadStrategy can download private release assets from GitHub using an authenticated GitHub client.
+//
+// It only applies if the client has a token.
 func GitHubPrivateReleaseDownloadStrategy(client *github.Client) DownloadStrategy {
 	return func(ctx context.Context, url string) (*http.Response, error) {
-		info, ok := getGitHubReleaseInfo(url)
+		info, ok := getGitHubReleaseInfo(url, client.WebHost())
 		if !ok {
 			return nil, errors.Errorf("not a GitHub URL: %s", url)
 		}
-		return downloadGHPrivate(client, info)
+		if !client.Authenticated() {
+			return nil, errors.Errorf("no GitHub token to retrieve %s with", url)
+		}
+		return downloadGHPrivate(ctx, client, info)
 	}
 }
 
-func downloadGHPrivate(client *github.Client, ghi *githubReleaseInfo) (response *http.Response, err error) {
-	r, err := client.Releases(fmt.Sprintf("%s/%s", ghi.owner, ghi.repo))
+// GitHubAssetTransport returns a RoundTripper that serves GET and HEAD
+// requests for "github-asset://" URIs, created by github.AssetURI, from the
+// matching release asset, and passes all other requests through to "transport".
+//
+// Downloads are verified against the digest GitHub reports for the asset.
+// So are downloads of release assets from the GitHub web host whose manifest
+// doesn't pin a checksum.
+func GitHubAssetTransport(client *github.Client, transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &githubAssetTransport{client: client, rt: transport}
+}
+
+type githubAssetTransport struct {
+	client *github.Client
+	rt     http.RoundTripper
+}
+
+func (g *githubAssetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != github.AssetScheme {
+		return g.roundTripRelease(req)
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return nil, errors.Errorf("%s %s: only GET and HEAD requests are supported", req.Method, req.URL)
+	}
+	ref, err := github.ParseAssetURI(req.URL)
 	if err != nil {
-		return nil, errors.WithStack(err)
+		return nil, err
+	}
+	release, asset, err := g.client.MatchAsset(req.Context(), ref.Repo, ref.Tag, ref.Pattern, ref.Target)
+	if err != nil {
+		return nil, err
+	}
+	var resp *http.Response
+	if req.Method == http.MethodHead {
+		resp = &http.Response{
+			Status:        "200 OK",
+			StatusCode:    http.StatusOK,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{},
+			Body:          http.NoBody,
+			ContentLength: asset.Size,
+		}
+	} else {
+		offset := ResumeOffset(req.Context())
+		resp, err = g.client.DownloadReleaseAsset(req.Context(), release, asset, offset)
+		if err != nil {
+			return nil, errors.Wrap(err, asset.Name)
+		}
+		if resp.ContentLength < 0 && asset.Size > 0 && resp.StatusCode == http.StatusOK {
+			resp.ContentLength = asset.Size
+		}
+	}
+	resp.Request = req
+	resp.Header.Set("ETag", strconv.Quote(github.AssetCacheKey(asset)))
+	SetExpectedDigest(resp, asset.Digest)
+	return resp, nil
+}
+
+// Pass a request through, and if it downloads a release asset from the web
+// host without a pinned checksum, verify it against the asset GitHub reports.
+//
+// Failing to look up the asset isn't an error, as the verification is opportunistic.
+func (g *githubAssetTransport) roundTripRelease(req *http.Request) (*http.Response, error) {
+	resp, err := g.rt.RoundTrip(req)
+	if err != nil || req.Method != http.MethodGet || !isChecksumUnpinned(req.Context()) {
+		return resp, err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return resp, nil
+	}
+	info, ok := getGitHubReleaseInfo(req.URL.String(), g.client.WebHost())
+	if !ok {
+		return resp, nil
+	}
+	release, err := g.client.ReleaseByTag(req.Context(), info.owner+"/"+info.repo, info.tag)
+	if err != nil {
+		return resp, nil // nolint: nilerr
+	}
+	for _, asset := range release.Assets {
+		if asset.Name != info.asset {
+			continue
+		}
+		if resp.StatusCode == http.StatusOK && asset.Size > 0 && resp.ContentLength >= 0 && resp.ContentLength != asset.Size {
+			_ = resp.Body.Close()
+			return nil, errors.Errorf("%s: size %d should have been %d", req.URL, resp.ContentLength, asset.Size)
+		}
+		SetExpectedDigest(resp, asset.Digest)
+		break
 	}
-	asset, err := getAssetURL(r, ghi.tag, ghi.asset)
+	return resp, nil
+}
+
+func downloadGHPrivate(ctx context.Context, client *github.Client, ghi *githubReleaseInfo) (response *http.Response, err error) {
+	repo := fmt.Sprintf("%s/%s", ghi.owner, ghi.repo)
+	release, err := client.ReleaseByTag(ctx, repo, ghi.tag)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s@%s", repo, ghi.tag)
+	}
+	asset, err := findAsset(release, ghi.asset)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	resp, err := client.Download(asset)
+	offset := ResumeOffset(ctx)
+	resp, err := client.DownloadReleaseAsset(ctx, release, asset, offset)
 	if err != nil {
 		return nil, errors.Wrap(err, "GitHub release API download failed")
 	}
+	// Fill in what GitHub already told us about the asset, for progress
+	// reporting and for verification if the manifest has no checksum.
+	if resp.ContentLength < 0 && asset.Size > 0 {
+		resp.ContentLength = asset.Size
+		if resp.StatusCode == http.StatusPartialContent {
+			resp.ContentLength -= offset
+		}
+	}
+	SetExpectedDigest(resp, asset.Digest)
 	return resp, nil
 }
 
@@ -46,12 +159,14 @@ type githubReleaseInfo struct {
 	owner, repo, tag, asset string
 }
 
-func getGitHubReleaseInfo(uri string) (*githubReleaseInfo, bool) {
+// Extract release information from a release download URL on the GitHub web host "host".
+func getGitHubReleaseInfo(uri, host string) (*githubReleaseInfo, bool) {
 	g := &githubReleaseInfo{}
 	m := githubRe.FindStringSubmatch(uri)
-	if len(m) != 5 {
+	if len(m) != 6 || m[1] != host {
 		return nil, false
 	}
+	m = m[1:]
 	var err error
 	if g.owner, err = url.PathUnescape(m[1]); err != nil {
 		return nil, false
@@ -68,16 +183,11 @@ func getGitHubReleaseInfo(uri string) (*githubReleaseInfo, bool) {
 	return g, true
 }
 
-func getAssetURL(releases []github.Release, tag, assetName string) (github.Asset, error) {
-	for _, r := range releases {
-		if r.TagName != tag {
-			continue
-		}
-		for _, a := range r.Assets {
-			if a.Name == assetName {
-				return a, nil
-			}
+func findAsset(release *github.Release, assetName string) (github.Asset, error) {
+	for _, a := range release.Assets {
+		if a.Name == assetName {
+			return a, nil
 		}
 	}
-	return github.Asset{}, errors.Errorf("cannot find asset %s %s", tag, assetName)
+	return github.Asset{}, errors.Errorf("cannot find asset %s %s", release.TagName, assetName)
 }
@@ -0,0 +1,141 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/github"
+	"github.com/cashapp/hermit/platform"
+	"github.com/cashapp/hermit/ui"
+)
+
+func TestGitHubAssetTransport(t *testing.T) {
+	content := []byte("tool for linux")
+	sum := sha256.Sum256(content)
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/example/tool/releases/tags/v1.0.0":
+			fmt.Fprintf(w, `{"tag_name": "v1.0.0", "assets": [
+				{"id": 1, "name": "tool-linux-amd64.tar.gz", "url": "%[1]s/assets/1", "size": %[2]d, "digest": "sha256:%[3]s"},
+				{"id": 2, "name": "tool-darwin-amd64.tar.gz", "url": "%[1]s/assets/2", "size": 1}
+			]}`, srv.URL, len(content), hex.EncodeToString(sum[:]))
+		case "/assets/1":
+			_, _ = w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	gh := github.New("", github.WithBaseURL(srv.URL, srv.URL))
+	client := &http.Client{Transport: GitHubAssetTransport(gh, srv.Client().Transport)}
+	c, err := Open(t.TempDir(), nil, client, client)
+	require.NoError(t, err)
+	p, _ := ui.NewForTesting()
+
+	uri := github.AssetURI("example/tool", "v1.0.0", "tool-*.tar.gz", platform.Platform{OS: platform.Linux, Arch: platform.Amd64})
+	source, err := GetSource(uri)
+	require.NoError(t, err)
+	etag, err := source.ETag(p.Task("test"), c)
+	require.NoError(t, err)
+	require.Equal(t, `"sha256-`+hex.EncodeToString(sum[:])+`"`, etag)
+	path, _, err := source.Download(p.Task("test"), c, "")
+	require.NoError(t, err)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+
+	uri = github.AssetURI("example/tool", "v1.0.0", "tool-*.tar.gz", platform.Platform{OS: "windows", Arch: platform.Amd64})
+	_, err = client.Get(uri)
+	require.Error(t, err)
+}
+
+func TestGitHubAssetTransportVerifiesReleaseDownloads(t *testing.T) {
+	content := []byte("tool for linux")
+	sum := sha256.Sum256(content)
+	lookups := 0
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/example/tool/releases/tags/v1.0.0":
+			lookups++
+			fmt.Fprintf(w, `{"tag_name": "v1.0.0", "assets": [
+				{"id": 1, "name": "tool.tar.gz", "size": %[1]d, "digest": "sha256:%[2]s"},
+				{"id": 2, "name": "corrupt.tar.gz", "size": %[1]d, "digest": "sha256:%[2]s"},
+				{"id": 3, "name": "truncated.tar.gz", "size": %[3]d}
+			]}`, len(content), hex.EncodeToString(sum[:]), len(content)+1)
+		case "/example/tool/releases/download/v1.0.0/tool.tar.gz", "/example/tool/releases/download/v1.0.0/truncated.tar.gz":
+			_, _ = w.Write(content)
+		case "/example/tool/releases/download/v1.0.0/corrupt.tar.gz":
+			_, _ = w.Write([]byte("tool for linuX"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	gh := github.New("", github.WithBaseURL(srv.URL, srv.URL), github.WithTransportWrapper(func(http.RoundTripper) http.RoundTripper {
+		return srv.Client().Transport
+	}))
+	client := &http.Client{Transport: GitHubAssetTransport(gh, srv.Client().Transport)}
+	c, err := Open(t.TempDir(), nil, client, client)
+	require.NoError(t, err)
+	p, _ := ui.NewForTesting()
+
+	release := srv.URL + "/example/tool/releases/download/v1.0.0/"
+	_, _, err = c.Download(p.Task("test"), "", release+"tool.tar.gz")
+	require.NoError(t, err)
+	require.Equal(t, 1, lookups)
+
+	_, _, err = c.Download(p.Task("test"), "", release+"corrupt.tar.gz")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "should have been "+hex.EncodeToString(sum[:]))
+
+	_, _, err = c.Download(p.Task("test"), "", release+"truncated.tar.gz")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), fmt.Sprintf("size %d should have been %d", len(content), len(content)+1))
+
+	// A pinned checksum doesn't need looking up.
+	lookups = 0
+	_, _, err = c.Download(p.Task("test"), hex.EncodeToString(sum[:]), release+"tool.tar.gz")
+	require.NoError(t, err)
+	require.Equal(t, 0, lookups)
+}
+
+func TestDownloadGHPrivateFetchesReleaseByTag(t *testing.T) {
+	content := []byte("private tool")
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/example/tool/releases/tags/v1.0.0":
+			fmt.Fprintf(w, `{"tag_name": "v1.0.0", "assets": [
+				{"id": 1, "name": "tool.tar.gz", "url": "%s/assets/1", "size": %d}
+			]}`, srv.URL, len(content))
+		case "/assets/1":
+			_, _ = w.Write(content)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	gh := github.New("token", github.WithBaseURL(srv.URL, srv.URL))
+	resp, err := downloadGHPrivate(context.Background(), gh, &githubReleaseInfo{owner: "example", repo: "tool", tag: "v1.0.0", asset: "tool.tar.gz"})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+
+	_, err = downloadGHPrivate(context.Background(), gh, &githubReleaseInfo{owner: "example", repo: "tool", tag: "v1.0.0", asset: "missing.tar.gz"})
+	require.EqualError(t, err, "cannot find asset v1.0.0 missing.tar.gz")
+}
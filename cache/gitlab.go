@@ -0,0 +1,24 @@
+package cache
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/gitlab"
+)
+
+// GitLabPrivateReleaseDownloadStrategy can download private release assets from GitLab using an authenticated GitLab client.
+func GitLabPrivateReleaseDownloadStrategy(client *gitlab.Client) DownloadStrategy {
+	return func(ctx context.Context, uri string) (*http.Response, error) {
+		if client.ProjectForURL(uri) == "" {
+			return nil, errors.Errorf("not a GitLab project URL: %s", uri)
+		}
+		resp, err := client.DownloadURL(ctx, uri, ResumeOffset(ctx))
+		if err != nil {
+			return nil, errors.Wrap(err, "GitLab release download failed")
+		}
+		return resp, nil
+	}
+}
@@ -0,0 +1,42 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// How often to check whether a download lock held by another process has been released.
+const lockCheckInterval = 100 * time.Millisecond
+
+// inflight coalesces concurrent downloads of the same file within a process.
+type inflight struct {
+	lock  sync.Mutex
+	calls map[string]*inflightDownload
+}
+
+type inflightDownload struct {
+	done       chan struct{}
+	path, etag string
+	err        error
+}
+
+// Call fn at most once for concurrent callers with the same key, returning its result to all of them.
+func (i *inflight) do(key string, fn func() (path, etag string, err error)) (string, string, error) {
+	i.lock.Lock()
+	if call, ok := i.calls[key]; ok {
+		i.lock.Unlock()
+		<-call.done
+		return call.path, call.etag, call.err
+	}
+	call := &inflightDownload{done: make(chan struct{})}
+	i.calls[key] = call
+	i.lock.Unlock()
+
+	call.path, call.etag, call.err = fn()
+
+	i.lock.Lock()
+	delete(i.calls, key)
+	i.lock.Unlock()
+	close(call.done)
+	return call.path, call.etag, call.err
+}
@@ -0,0 +1,103 @@
+package cache
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Mirror rewrites URLs starting with Prefix to start with URL instead.
+type Mirror struct {
+	Prefix string
+	URL    string
+	// Header is added to requests sent to the mirror, eg. for credentials.
+	Header http.Header
+}
+
+// Mirrors sends HTTP requests for mirrored URLs to their mirror instead.
+//
+// The longest matching prefix wins. Mirrors may be changed at any time with
+// SetMirrors, and apply to all transports wrapped by WithTransport.
+type Mirrors struct {
+	lock    sync.RWMutex
+	mirrors []Mirror
+}
+
+// NewMirrors creates a new, empty, set of Mirrors.
+func NewMirrors() *Mirrors {
+	return &Mirrors{}
+}
+
+// SetMirrors replaces the configured mirrors.
+func (m *Mirrors) SetMirrors(mirrors []Mirror) error {
+	for _, mirror := range mirrors {
+		if _, err := url.Parse(mirror.URL); err != nil || mirror.Prefix == "" || mirror.URL == "" {
+			return errors.Errorf("invalid mirror %q = %q", mirror.Prefix, mirror.URL)
+		}
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.mirrors = mirrors
+	return nil
+}
+
+// WithTransport returns a HTTP transport that sends requests for mirrored
+// URLs to their mirror via "transport", or http.DefaultTransport if nil.
+func (m *Mirrors) WithTransport(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &mirrorTransport{mirrors: m, rt: transport}
+}
+
+// Wrap returns a copy of client whose transport is wrapped with WithTransport.
+func (m *Mirrors) Wrap(client *http.Client) *http.Client {
+	out := *client
+	out.Transport = m.WithTransport(client.Transport)
+	return &out
+}
+
+func (m *Mirrors) match(uri string) (Mirror, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	var (
+		best  Mirror
+		found bool
+	)
+	for _, mirror := range m.mirrors {
+		if strings.HasPrefix(uri, mirror.Prefix) && len(mirror.Prefix) > len(best.Prefix) {
+			best, found = mirror, true
+		}
+	}
+	return best, found
+}
+
+type mirrorTransport struct {
+	mirrors *Mirrors
+	rt      http.RoundTripper
+}
+
+func (m *mirrorTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	mirror, ok := m.mirrors.match(req.URL.String())
+	if !ok {
+		return m.rt.RoundTrip(req)
+	}
+	u, err := url.Parse(mirror.URL + strings.TrimPrefix(req.URL.String(), mirror.Prefix))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid mirrored URL")
+	}
+	req = req.Clone(req.Context()) // The stdlib docs recommend not mutating the request in place.
+	if u.Host != req.URL.Host {
+		// Never send credentials intended for the origin to the mirror.
+		req.Header.Del("Authorization")
+	}
+	req.URL = u
+	req.Host = u.Host
+	for key, values := range mirror.Header {
+		req.Header[key] = values
+	}
+	return m.rt.RoundTrip(req)
+}
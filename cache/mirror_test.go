@@ -0,0 +1,45 @@
+package cache
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMirrors(t *testing.T) {
+	type request struct{ path, authorization string }
+	var requests []request
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, request{r.URL.Path, r.Header.Get("Authorization")})
+	}))
+	defer srv.Close()
+
+	mirrors := NewMirrors()
+	require.NoError(t, mirrors.SetMirrors([]Mirror{
+		{Prefix: "https://github.com/", URL: srv.URL + "/github/"},
+		{Prefix: "https://github.com/private/", URL: srv.URL + "/private/", Header: http.Header{"Authorization": []string{"Bearer mirror"}}},
+	}))
+	client := mirrors.Wrap(srv.Client())
+
+	for _, uri := range []string{
+		"https://github.com/owner/repo/releases/download/v1.0.0/tool.tar.gz",
+		"https://github.com/private/repo/releases/download/v1.0.0/tool.tar.gz",
+		srv.URL + "/unmirrored",
+	} {
+		req, err := http.NewRequest(http.MethodGet, uri, nil) // nolint: noctx
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "token origin")
+		resp, err := client.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	require.Equal(t, []request{
+		{"/github/owner/repo/releases/download/v1.0.0/tool.tar.gz", ""},
+		{"/private/repo/releases/download/v1.0.0/tool.tar.gz", "Bearer mirror"},
+		{"/unmirrored", "token origin"},
+	}, requests)
+
+	require.Error(t, mirrors.SetMirrors([]Mirror{{Prefix: "https://github.com/"}}))
+}
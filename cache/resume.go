@@ -0,0 +1,110 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+type resumeKey struct{}
+
+type resume struct {
+	offset int64
+	// The ETag or Last-Modified date the partial download was retrieved with.
+	validator string
+}
+
+func withResume(ctx context.Context, offset int64, validator string) context.Context {
+	return context.WithValue(ctx, resumeKey{}, resume{offset: offset, validator: validator})
+}
+
+// ResumeOffset returns the byte offset from which a DownloadStrategy may
+// resume a partial download, or 0 if the download should start from the
+// beginning.
+//
+// Strategies that resume must respond with 206 Partial Content and a
+// matching Content-Range. Any other successful response is treated as the
+// complete file.
+func ResumeOffset(ctx context.Context) int64 {
+	r, _ := ctx.Value(resumeKey{}).(resume)
+	return r.offset
+}
+
+// SetResumeHeaders sets the Range and If-Range headers on req required to
+// resume a partial download, if the request's context carries one.
+//
+// A download is only resumed with a validator, so that a changed file is
+// downloaded in full rather than appended to the stale partial content.
+func SetResumeHeaders(req *http.Request) {
+	r, _ := req.Context().Value(resumeKey{}).(resume)
+	if r.offset <= 0 || r.validator == "" {
+		return
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-", r.offset))
+	req.Header.Set("If-Range", r.validator)
+}
+
+// Returns true if resp resumes a download at "offset".
+func isResumed(resp *http.Response, offset int64) bool {
+	if offset <= 0 || resp.StatusCode != http.StatusPartialContent {
+		return false
+	}
+	// Content-Range: bytes <start>-<end>/<size>
+	rng := strings.TrimPrefix(resp.Header.Get("Content-Range"), "bytes ")
+	start, err := strconv.ParseInt(strings.SplitN(rng, "-", 2)[0], 10, 64)
+	return err == nil && start == offset
+}
+
+// A partially downloaded file and the validator it was retrieved with.
+type partialDownload struct {
+	*os.File
+	validatorPath string
+}
+
+// Open, or create, the partial download for cachePath.
+func openPartial(cachePath string) (*partialDownload, error) {
+	w, err := os.OpenFile(cachePath+".partial", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't create partial download")
+	}
+	return &partialDownload{File: w, validatorPath: cachePath + ".partial.etag"}, nil
+}
+
+// The ETag or Last-Modified date the partial download was retrieved with, or "" if it has neither.
+func (p *partialDownload) validator() string {
+	validator, _ := os.ReadFile(p.validatorPath)
+	return string(validator)
+}
+
+// Record the validator of resp, preferring its ETag to its Last-Modified date.
+func (p *partialDownload) setValidator(resp *http.Response) error {
+	validator := resp.Header.Get("ETag")
+	if validator == "" {
+		validator = resp.Header.Get("Last-Modified")
+	}
+	if validator == "" {
+		return errors.WithStack(os.RemoveAll(p.validatorPath))
+	}
+	return errors.WithStack(os.WriteFile(p.validatorPath, []byte(validator), 0600))
+}
+
+// Discard any partial content, to download from the start.
+func (p *partialDownload) reset() error {
+	if _, err := p.Seek(0, io.SeekStart); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(p.Truncate(0))
+}
+
+// Discard the partial download.
+func (p *partialDownload) remove() {
+	_ = p.Close()
+	_ = os.Remove(p.Name())
+	_ = os.Remove(p.validatorPath)
+}
@@ -37,7 +37,10 @@ func GetSource(uri string) (PackageSource, error) {
 	case "", "file":
 		return &fileSource{Path: u.Path}, nil
 
-	case "http", "https":
+	case "http", "https", "oci", "s3", "gs", "github-asset":
+		// oci:// URIs are served by the transport from the oci package,
+		// s3:// and gs:// URIs by the transport from the buckets package, and
+		// github-asset:// URIs by GitHubAssetTransport.
 		return &httpSource{uri}, errors.WithStack(err)
 	default:
 		return nil, errors.Errorf("unsupported URI %s", uri)
@@ -84,7 +87,7 @@ func (s *httpSource) Download(b *ui.Task, cache *Cache, checksum string) (path s
 
 func (s *httpSource) ETag(_ *ui.Task, c *Cache) (etag string, err error) {
 	uri := s.URL
-	req, err := http.NewRequestWithContext(context.Background(), http.MethodHead, uri, nil)
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodHead, uri, nil)
 	if err != nil {
 		return "", errors.Wrap(err, uri)
 	}
@@ -0,0 +1,76 @@
+// Package checksums parses and verifies checksum files, such as SHA256SUMS or
+// checksums.txt, published alongside release artefacts.
+package checksums
+
+import (
+	"bufio"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned by Sums.Lookup when a file has no checksum.
+var ErrNotFound = errors.New("no checksum found")
+
+// Sums maps file names to lower-case hex encoded SHA256 checksums.
+type Sums map[string]string
+
+// matches: SHA256 (<name>) = <hash>
+var bsdRe = regexp.MustCompile(`^SHA256 \((.+)\) = ([0-9a-fA-F]{64})$`)
+
+// Parse a checksum file.
+//
+// Both the GNU coreutils format ("<hash>  <name>" or "<hash> *<name>") and
+// the BSD format ("SHA256 (<name>) = <hash>") are supported. Blank lines and
+// lines starting with "#" are ignored.
+func Parse(r io.Reader) (Sums, error) {
+	sums := Sums{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		var hash, name string
+		if m := bsdRe.FindStringSubmatch(text); m != nil {
+			name, hash = m[1], m[2]
+		} else {
+			fields := strings.SplitN(text, " ", 2)
+			if len(fields) != 2 {
+				return nil, errors.Errorf("line %d: expected \"<sha256> <name>\"", line)
+			}
+			hash, name = fields[0], strings.TrimPrefix(strings.TrimLeft(fields[1], " "), "*")
+		}
+		if _, err := hex.DecodeString(hash); err != nil || len(hash) != 64 {
+			return nil, errors.Errorf("line %d: invalid SHA256 %q", line, hash)
+		}
+		sums[strings.TrimPrefix(name, "./")] = strings.ToLower(hash)
+	}
+	return sums, errors.WithStack(scanner.Err())
+}
+
+// Lookup the checksum of the artefact at "source", which may be a URL or a file name.
+//
+// An exact match on the name is preferred, falling back to the base name of
+// the entries in the checksum file.
+func (s Sums) Lookup(source string) (string, error) {
+	name := source
+	if u, err := url.Parse(source); err == nil && u.Path != "" {
+		name = u.Path
+	}
+	name = path.Base(name)
+	if hash, ok := s[name]; ok {
+		return hash, nil
+	}
+	for entry, hash := range s {
+		if path.Base(entry) == name {
+			return hash, nil
+		}
+	}
+	return "", errors.Wrap(ErrNotFound, name)
+}
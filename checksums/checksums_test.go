@@ -0,0 +1,50 @@
+package checksums
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	hashA = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	hashB = "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae"
+)
+
+func TestParse(t *testing.T) {
+	sums, err := Parse(strings.NewReader(`
+# Generated by goreleaser
+` + hashA + `  tool-linux-amd64.tar.gz
+` + strings.ToUpper(hashB) + ` *./dist/tool-darwin-arm64.tar.gz
+SHA256 (tool-windows-amd64.zip) = ` + hashA + `
+`))
+	require.NoError(t, err)
+	require.Equal(t, Sums{
+		"tool-linux-amd64.tar.gz":       hashA,
+		"dist/tool-darwin-arm64.tar.gz": hashB,
+		"tool-windows-amd64.zip":        hashA,
+	}, sums)
+
+	_, err = Parse(strings.NewReader("notahash  tool.tar.gz\n"))
+	require.EqualError(t, err, `line 1: invalid SHA256 "notahash"`)
+}
+
+func TestLookup(t *testing.T) {
+	sums := Sums{
+		"tool-linux-amd64.tar.gz":       hashA,
+		"dist/tool-darwin-arm64.tar.gz": hashB,
+	}
+	hash, err := sums.Lookup("https://github.com/owner/tool/releases/download/v1.0.0/tool-linux-amd64.tar.gz")
+	require.NoError(t, err)
+	require.Equal(t, hashA, hash)
+
+	hash, err = sums.Lookup("tool-darwin-arm64.tar.gz")
+	require.NoError(t, err)
+	require.Equal(t, hashB, hash)
+
+	_, err = sums.Lookup("https://example.com/tool-linux-arm64.tar.gz")
+	require.True(t, errors.Is(err, ErrNotFound), "%+v", err)
+}
@@ -0,0 +1,109 @@
+package checksums
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/openpgp" // nolint: staticcheck
+)
+
+// ErrBadSignature is returned by VerifySignature when a signature does not match.
+var ErrBadSignature = errors.New("signature verification failed")
+
+// VerifySignature verifies the detached signature "sig" of "data" with "key".
+//
+// "key" is either an ASCII armoured PGP public key block, in which case
+// "sig" must be an armoured or binary PGP signature, or a minisign public
+// key, in which case "sig" must be a minisign signature file.
+func VerifySignature(data, sig []byte, key string) error {
+	if strings.Contains(key, "-----BEGIN PGP PUBLIC KEY BLOCK-----") {
+		return verifyPGP(data, sig, key)
+	}
+	return verifyMinisign(data, sig, key)
+}
+
+func verifyPGP(data, sig []byte, key string) error {
+	keyring, err := openpgp.ReadArmoredKeyRing(strings.NewReader(key))
+	if err != nil {
+		return errors.Wrap(err, "invalid PGP public key")
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN")) {
+		_, err = openpgp.CheckArmoredDetachedSignature(keyring, bytes.NewReader(data), bytes.NewReader(sig))
+	} else {
+		_, err = openpgp.CheckDetachedSignature(keyring, bytes.NewReader(data), bytes.NewReader(sig))
+	}
+	if err != nil {
+		return errors.Wrap(ErrBadSignature, err.Error())
+	}
+	return nil
+}
+
+// Verify a minisign signature.
+//
+// See https://jedisct1.github.io/minisign/#signature-format
+func verifyMinisign(data, sig []byte, key string) error {
+	pk, err := decodeMinisign(lastLine(key), ed25519.PublicKeySize)
+	if err != nil {
+		return errors.Wrap(err, "invalid minisign public key")
+	}
+	lines := strings.Split(strings.TrimSpace(string(sig)), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("invalid minisign signature: expected 4 lines")
+	}
+	signature, err := decodeMinisign(strings.TrimSpace(lines[1]), ed25519.SignatureSize)
+	if err != nil {
+		return errors.Wrap(err, "invalid minisign signature")
+	}
+	if signature.algorithm != "Ed" && signature.algorithm != "ED" {
+		return errors.Errorf("unsupported minisign signature algorithm %q", signature.algorithm)
+	}
+	if !bytes.Equal(signature.keyID, pk.keyID) {
+		return errors.Wrap(ErrBadSignature, "signed by a different minisign key")
+	}
+	message := data
+	if signature.algorithm == "ED" {
+		prehashed := blake2b.Sum512(data)
+		message = prehashed[:]
+	}
+	if !ed25519.Verify(pk.value, message, signature.value) {
+		return errors.WithStack(ErrBadSignature)
+	}
+	// The global signature covers the signature and the trusted comment.
+	global, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(global) != ed25519.SignatureSize {
+		return errors.New("invalid minisign global signature")
+	}
+	trusted := append(append([]byte{}, signature.value...), strings.TrimPrefix(strings.TrimRight(lines[2], "\r"), "trusted comment: ")...)
+	if !ed25519.Verify(pk.value, trusted, global) {
+		return errors.Wrap(ErrBadSignature, "trusted comment")
+	}
+	return nil
+}
+
+type minisignValue struct {
+	algorithm string
+	keyID     []byte
+	value     []byte
+}
+
+// Decode a base64 minisign key or signature consisting of a 2 byte algorithm, an 8 byte key ID and "size" bytes of value.
+func decodeMinisign(encoded string, size int) (*minisignValue, error) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(raw) != 10+size {
+		return nil, errors.Errorf("expected %d bytes but got %d", 10+size, len(raw))
+	}
+	return &minisignValue{algorithm: string(raw[:2]), keyID: raw[2:10], value: raw[10:]}, nil
+}
+
+// Minisign public keys may be provided with or without their "untrusted comment" line.
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
@@ -0,0 +1,78 @@
+package checksums
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/blake2b"
+	"golang.org/x/crypto/openpgp"       // nolint: staticcheck
+	"golang.org/x/crypto/openpgp/armor" // nolint: staticcheck
+)
+
+var sums = []byte(hashA + "  tool-linux-amd64.tar.gz\n")
+
+// Sign "data" in the minisign format, returning the public key and signature file.
+func minisign(t *testing.T, data []byte, algorithm string) (key string, sig []byte) {
+	t.Helper()
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyID := []byte("hermitid")
+	key = "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pk...))
+	message := data
+	if algorithm == "ED" {
+		prehashed := blake2b.Sum512(data)
+		message = prehashed[:]
+	}
+	signature := ed25519.Sign(sk, message)
+	trusted := "timestamp:1600000000\tfile:SHA256SUMS"
+	global := ed25519.Sign(sk, append(append([]byte{}, signature...), trusted...))
+	sig = []byte(fmt.Sprintf("untrusted comment: signature\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte(algorithm), keyID...), signature...)),
+		trusted,
+		base64.StdEncoding.EncodeToString(global)))
+	return key, sig
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	for _, algorithm := range []string{"Ed", "ED"} {
+		t.Run(algorithm, func(t *testing.T) {
+			key, sig := minisign(t, sums, algorithm)
+			require.NoError(t, VerifySignature(sums, sig, key))
+
+			err := VerifySignature(append(sums, '\n'), sig, key)
+			require.True(t, errors.Is(err, ErrBadSignature), "%+v", err)
+
+			otherKey, _ := minisign(t, sums, algorithm)
+			err = VerifySignature(sums, sig, otherKey)
+			require.True(t, errors.Is(err, ErrBadSignature), "%+v", err)
+		})
+	}
+}
+
+func TestVerifyPGP(t *testing.T) {
+	entity, err := openpgp.NewEntity("Hermit", "", "hermit@example.com", nil)
+	require.NoError(t, err)
+	keyBuf := &bytes.Buffer{}
+	w, err := armor.Encode(keyBuf, openpgp.PublicKeyType, nil)
+	require.NoError(t, err)
+	require.NoError(t, entity.Serialize(w))
+	require.NoError(t, w.Close())
+	key := keyBuf.String()
+
+	armoured := &bytes.Buffer{}
+	require.NoError(t, openpgp.ArmoredDetachSign(armoured, entity, bytes.NewReader(sums), nil))
+	require.NoError(t, VerifySignature(sums, armoured.Bytes(), key))
+
+	binary := &bytes.Buffer{}
+	require.NoError(t, openpgp.DetachSign(binary, entity, bytes.NewReader(sums), nil))
+	require.NoError(t, VerifySignature(sums, binary.Bytes(), key))
+
+	err = VerifySignature(append(sums, '\n'), binary.Bytes(), key)
+	require.True(t, errors.Is(err, ErrBadSignature), "%+v", err)
+}
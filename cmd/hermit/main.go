@@ -7,6 +7,7 @@ import (
 	"os"
 
 	"github.com/cashapp/hermit/app"
+	"github.com/cashapp/hermit/sandbox"
 	"github.com/cashapp/hermit/sources"
 	"github.com/cashapp/hermit/state"
 	"github.com/cashapp/hermit/ui"
@@ -21,6 +22,7 @@ var (
 )
 
 func main() {
+	sandbox.Init()
 	level, err := ui.LevelFromString(envOrDefault("HERMIT_LOG", "info"))
 	if err != nil {
 		level = ui.LevelInfo
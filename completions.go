@@ -0,0 +1,126 @@
+package hermit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+
+	"github.com/kballard/go-shellquote"
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+)
+
+// Completion scripts declared by the installed packages of an environment
+// are collected into a directory per shell, which activation adds to the
+// shell's completion path. The directories are regenerated whenever the
+// installed packages change, identified by a key recorded alongside them.
+
+// Names of completion scripts in each shell's directory, for the command "name".
+var completionFileNames = map[string]func(name string) string{
+	"bash": func(name string) string { return name },
+	"zsh":  func(name string) string { return "_" + name },
+	"fish": func(name string) string { return name + ".fish" },
+}
+
+// UpdateCompletions collects the completion scripts of the packages
+// installed in the environment into the "bash", "zsh" and "fish"
+// subdirectories of the returned directory, if they changed since the last
+// update.
+//
+// Packages that haven't been downloaded yet are skipped, and scripts that
+// can't be generated are logged and skipped, as they shouldn't prevent
+// activation.
+func (e *Env) UpdateCompletions(l *ui.UI) (string, error) {
+	dir := e.completionsDir()
+	pkgs, err := e.ListInstalled(l)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	var withCompletions []*manifest.Package
+	for _, pkg := range pkgs {
+		if len(pkg.Completions) > 0 && pkg.State == manifest.PackageStateInstalled {
+			withCompletions = append(withCompletions, pkg)
+		}
+	}
+	sort.Slice(withCompletions, func(i, j int) bool { return withCompletions[i].Reference.Less(withCompletions[j].Reference) })
+	key := completionsKey(withCompletions)
+	if current, err := os.ReadFile(filepath.Join(dir, ".key")); err == nil && string(current) == key {
+		return dir, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return "", errors.WithStack(err)
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+".*")
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer os.RemoveAll(tmpDir) // nolint: errcheck
+	for shell := range completionFileNames {
+		if err := os.Mkdir(filepath.Join(tmpDir, shell), 0700); err != nil {
+			return "", errors.WithStack(err)
+		}
+	}
+	for _, pkg := range withCompletions {
+		for _, completion := range pkg.Completions {
+			script, err := completionScript(pkg, completion)
+			if err != nil {
+				l.Warnf("Skipping %s completions for %s: %s", completion.Shell, completion.Name, err)
+				continue
+			}
+			path := filepath.Join(tmpDir, completion.Shell, completionFileNames[completion.Shell](completion.Name))
+			if err := os.WriteFile(path, script, 0600); err != nil {
+				return "", errors.WithStack(err)
+			}
+		}
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, ".key"), []byte(key), 0600); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return dir, errors.WithStack(os.Rename(tmpDir, dir))
+}
+
+// Read or generate the completion script of a package.
+func completionScript(pkg *manifest.Package, completion manifest.Completion) ([]byte, error) {
+	if completion.File != "" {
+		data, err := os.ReadFile(completion.File)
+		return data, errors.WithStack(err)
+	}
+	args, err := shellquote.Split(completion.Command)
+	if err != nil || len(args) == 0 {
+		return nil, errors.Errorf("invalid shell command %q", completion.Command)
+	}
+	cmd := exec.Command(args[0], args[1:]...) // nolint: gosec
+	cmd.Dir = pkg.Root
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to execute %q", completion.Command)
+	}
+	return out, nil
+}
+
+func completionsKey(pkgs []*manifest.Package) string {
+	h := sha256.New()
+	for _, pkg := range pkgs {
+		fmt.Fprintf(h, "%s\x00%s\x00", pkg.Reference, pkg.Root)
+		for _, completion := range pkg.Completions {
+			fmt.Fprintf(h, "%s\x00%s\x00%s\x00%s\x00", completion.Shell, completion.Name, completion.File, completion.Command)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// The completions are kept in the shared state, rather than the environment, so that they aren't committed.
+func (e *Env) completionsDir() string {
+	sum := sha256.Sum256([]byte(e.envDir))
+	return filepath.Join(e.state.Root(), "completions", hex.EncodeToString(sum[:16]))
+}
@@ -0,0 +1,68 @@
+package hermit_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/envars"
+	"github.com/cashapp/hermit/hermittest"
+	"github.com/cashapp/hermit/manifest"
+)
+
+func TestUpdateCompletions(t *testing.T) {
+	fixture := hermittest.NewEnvTestFixture(t, nil)
+	defer fixture.Clean()
+	envDir := fixture.EnvDirs[0]
+	srcDir := filepath.Join(envDir, "sources")
+	require.NoError(t, os.MkdirAll(srcDir, 0700))
+	err := os.WriteFile(filepath.Join(srcDir, "test.hcl"), []byte(`
+		description = ""
+		binaries = ["linux_exe"]
+		source = "archive/testdata/archive.tar.gz"
+		version "1" {}
+		completion "bash" {
+		  file = "file"
+		}
+		completion "fish" {
+		  name = "tool"
+		  cmd = "echo complete -c tool"
+		}
+	`), 0600)
+	require.NoError(t, err)
+	err = os.WriteFile(filepath.Join(envDir, "bin", "hermit.hcl"), []byte(`sources = ["env:///sources"]`), 0600)
+	require.NoError(t, err)
+	env, err := hermit.OpenEnv(envDir, fixture.State, envars.Envars{}, fixture.Server.Client())
+	require.NoError(t, err)
+
+	dir, err := env.UpdateCompletions(fixture.P)
+	require.NoError(t, err)
+	entries, err := os.ReadDir(filepath.Join(dir, "bash"))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+
+	pkg, err := env.Resolve(fixture.P, manifest.ExactSelector(manifest.ParseReference("test-1")), false)
+	require.NoError(t, err)
+	_, err = env.Install(fixture.P, pkg)
+	require.NoError(t, err)
+	dir, err = env.UpdateCompletions(fixture.P)
+	require.NoError(t, err)
+	expected, err := os.ReadFile(filepath.Join(pkg.Root, "file"))
+	require.NoError(t, err)
+	actual, err := os.ReadFile(filepath.Join(dir, "bash", "test"))
+	require.NoError(t, err)
+	require.Equal(t, expected, actual)
+	actual, err = os.ReadFile(filepath.Join(dir, "fish", "tool.fish"))
+	require.NoError(t, err)
+	require.Equal(t, "complete -c tool\n", string(actual))
+
+	_, err = env.Uninstall(fixture.P, pkg)
+	require.NoError(t, err)
+	_, err = env.UpdateCompletions(fixture.P)
+	require.NoError(t, err)
+	_, err = os.Stat(filepath.Join(dir, "bash", "test"))
+	require.True(t, os.IsNotExist(err))
+}
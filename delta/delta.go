@@ -0,0 +1,163 @@
+// Package delta applies binary patches between versions of package sources.
+package delta
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"encoding/binary"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// Patch formats.
+const (
+	// BSDiff patches are created by "bsdiff" (the classic BSDIFF40 format).
+	BSDiff = "bsdiff"
+	// Zstd patches are created by "zstd --patch-from=<old> <new>", and require zstd to be installed.
+	Zstd = "zstd"
+)
+
+// Apply "patch" to "old", writing the result to "new".
+func Apply(format, old, patch, new string) error {
+	switch format {
+	case BSDiff, "":
+		return applyBSDiff(old, patch, new)
+	case Zstd:
+		return applyZstd(old, patch, new)
+	default:
+		return errors.Errorf("unsupported patch format %q", format)
+	}
+}
+
+func applyZstd(old, patch, new string) error {
+	zstd, err := exec.LookPath("zstd")
+	if err != nil {
+		return errors.New("zstd patches require zstd to be installed")
+	}
+	// Patches may use a window as large as the old file, beyond zstd's default limit.
+	info, err := os.Stat(old)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	windowLog := 10
+	for int64(1)<<windowLog < info.Size() && windowLog < 31 {
+		windowLog++
+	}
+	cmd := exec.Command(zstd, "-q", "-d", "-f", "--long="+strconv.Itoa(windowLog), "--patch-from="+old, patch, "-o", new) // nolint: gosec
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		return errors.Wrapf(err, "zstd: %s", bytes.TrimSpace(out))
+	}
+	return nil
+}
+
+// Apply a BSDIFF40 patch.
+//
+// The patch consists of a 32 byte header followed by three bzip2 compressed
+// blocks: control triples, "diff" bytes that are added to bytes of the old
+// file, and "extra" bytes that are copied verbatim.
+//
+// See http://www.daemonology.net/bsdiff/
+func applyBSDiff(old, patch, new string) error {
+	data, err := os.ReadFile(patch)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if len(data) < 32 || string(data[:8]) != "BSDIFF40" {
+		return errors.New("bsdiff: invalid patch header")
+	}
+	ctrlLen, diffLen, newSize := offtin(data[8:]), offtin(data[16:]), offtin(data[24:])
+	if ctrlLen < 0 || diffLen < 0 || newSize < 0 || 32+ctrlLen+diffLen > int64(len(data)) {
+		return errors.New("bsdiff: corrupt patch")
+	}
+	ctrl := bzip2.NewReader(bytes.NewReader(data[32 : 32+ctrlLen]))
+	diff := bzip2.NewReader(bytes.NewReader(data[32+ctrlLen : 32+ctrlLen+diffLen]))
+	extra := bzip2.NewReader(bytes.NewReader(data[32+ctrlLen+diffLen:]))
+
+	oldFile, err := os.Open(old)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer oldFile.Close() // nolint: gosec
+	info, err := oldFile.Stat()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	oldSize := info.Size()
+
+	newFile, err := os.Create(new)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer newFile.Close() // nolint: gosec
+	w := bufio.NewWriter(newFile)
+
+	var (
+		newPos, oldPos int64
+		triple         = make([]byte, 24)
+		buf            = make([]byte, 32*1024)
+		oldBuf         = make([]byte, 32*1024)
+	)
+	for newPos < newSize {
+		if _, err := io.ReadFull(ctrl, triple); err != nil {
+			return errors.Wrap(err, "bsdiff: corrupt control block")
+		}
+		add, copyLen, seek := offtin(triple), offtin(triple[8:]), offtin(triple[16:])
+		if add < 0 || copyLen < 0 || newPos+add+copyLen > newSize {
+			return errors.New("bsdiff: corrupt patch")
+		}
+		// Add diff bytes to old bytes.
+		for remaining := add; remaining > 0; {
+			n := int64(len(buf))
+			if remaining < n {
+				n = remaining
+			}
+			if _, err := io.ReadFull(diff, buf[:n]); err != nil {
+				return errors.Wrap(err, "bsdiff: corrupt diff block")
+			}
+			// Bytes beyond the end of the old file are treated as zero.
+			for i := range oldBuf[:n] {
+				oldBuf[i] = 0
+			}
+			if oldPos < oldSize && oldPos+n > 0 {
+				start, offset := oldPos, int64(0)
+				if start < 0 {
+					start, offset = 0, -oldPos
+				}
+				if _, err := oldFile.ReadAt(oldBuf[offset:n], start); err != nil && !errors.Is(err, io.EOF) {
+					return errors.WithStack(err)
+				}
+			}
+			for i := int64(0); i < n; i++ {
+				buf[i] += oldBuf[i]
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return errors.WithStack(err)
+			}
+			remaining -= n
+			oldPos += n
+			newPos += n
+		}
+		// Copy extra bytes.
+		if _, err := io.CopyN(w, extra, copyLen); err != nil {
+			return errors.Wrap(err, "bsdiff: corrupt extra block")
+		}
+		newPos += copyLen
+		oldPos += seek
+	}
+	return errors.WithStack(w.Flush())
+}
+
+// Decode a bsdiff integer: little endian sign-magnitude.
+func offtin(b []byte) int64 {
+	v := int64(binary.LittleEndian.Uint64(b[:8]) &^ (1 << 63))
+	if b[7]&0x80 != 0 {
+		return -v
+	}
+	return v
+}
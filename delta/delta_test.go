@@ -0,0 +1,52 @@
+package delta
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		format string
+		patch  string
+	}{
+		{BSDiff, "testdata/old-to-new.bsdiff"},
+		{Zstd, "testdata/old-to-new.zst"},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			if test.format == Zstd {
+				if _, err := exec.LookPath("zstd"); err != nil {
+					t.Skip("zstd is not installed")
+				}
+			}
+			out := filepath.Join(t.TempDir(), "new.txt")
+			require.NoError(t, Apply(test.format, "testdata/old.txt", test.patch, out))
+			expected, err := os.ReadFile("testdata/new.txt")
+			require.NoError(t, err)
+			actual, err := os.ReadFile(out)
+			require.NoError(t, err)
+			require.Equal(t, string(expected), string(actual))
+		})
+	}
+}
+
+func TestApplyBSDiffRejectsCorruptPatches(t *testing.T) {
+	dir := t.TempDir()
+	patch, err := os.ReadFile("testdata/old-to-new.bsdiff")
+	require.NoError(t, err)
+	for name, data := range map[string][]byte{
+		"Header":    append([]byte("BSDIFF41"), patch[8:]...),
+		"Truncated": patch[:len(patch)-20],
+	} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name)
+			require.NoError(t, os.WriteFile(path, data, 0600))
+			require.Error(t, Apply(BSDiff, "testdata/old.txt", path, filepath.Join(dir, name+".out")))
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package hermit
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/envars"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/shell"
+	"github.com/cashapp/hermit/ui"
+)
+
+// Dependency is a package in a dependency graph, as resolved by DependencyGraph.
+type Dependency struct {
+	// Requirement is the entry in the requiring package's "requires" that selected this package, or the
+	// selector the package was requested with if it is a root of the graph.
+	Requirement string
+	Package     *manifest.Package
+	// Installed is true if the package is already installed in the environment.
+	Installed bool
+	// Dependencies are the packages this package requires. They are only listed the first time a package
+	// appears in the graph.
+	Dependencies Dependencies
+}
+
+// Dependencies is a dependency graph.
+type Dependencies []*Dependency
+
+// Uninstalled returns the packages in the graph that are not installed, dependencies before the packages
+// requiring them.
+func (d Dependencies) Uninstalled() []*manifest.Package {
+	seen := map[string]bool{}
+	var out []*manifest.Package
+	var walk func(deps Dependencies)
+	walk = func(deps Dependencies) {
+		for _, dep := range deps {
+			walk(dep.Dependencies)
+			ref := dep.Package.Reference.String()
+			if !dep.Installed && !seen[ref] {
+				seen[ref] = true
+				out = append(out, dep.Package)
+			}
+		}
+	}
+	walk(d)
+	return out
+}
+
+// Dependents returns the package that first requires each dependency in the graph, keyed by reference.
+// Packages at the root of the graph were requested, so are not included.
+func (d Dependencies) Dependents() map[string]*manifest.Package {
+	out := map[string]*manifest.Package{}
+	requested := map[string]bool{}
+	for _, dep := range d {
+		requested[dep.Package.Reference.String()] = true
+	}
+	var walk func(from *manifest.Package, deps Dependencies)
+	walk = func(from *manifest.Package, deps Dependencies) {
+		for _, dep := range deps {
+			ref := dep.Package.Reference.String()
+			if _, ok := out[ref]; !ok && !requested[ref] {
+				out[ref] = from
+			}
+			walk(dep.Package, dep.Dependencies)
+		}
+	}
+	for _, dep := range d {
+		walk(dep.Package, dep.Dependencies)
+	}
+	return out
+}
+
+// DependencyGraph resolves packages along with their transitive dependencies.
+//
+// Dependencies are declared in a package's "requires", either as a selector such as "go" or "go-1.21*", or
+// as a virtual package listed in other packages' "provides". Requirements are satisfied by installed
+// packages where possible. An error is returned if requirements on the same package conflict, or conflict
+// with an installed version of it.
+func (e *Env) DependencyGraph(l *ui.UI, installed []manifest.Reference, selectors ...manifest.Selector) (Dependencies, error) {
+	pinned := map[string]manifest.Reference{}
+	for {
+		graph, err := newDepResolver(e, l, installed, pinned).resolve(selectors)
+		var retry *retryWithVersion
+		if errors.As(err, &retry) {
+			if _, ok := pinned[retry.ref.Name]; ok {
+				return nil, retry.err
+			}
+			pinned[retry.ref.Name] = retry.ref
+			continue
+		}
+		return graph, err
+	}
+}
+
+// ResolveWithDeps collect packages and their dependencies based on the given manifest.Selector into a map
+func (e *Env) ResolveWithDeps(l *ui.UI, installed []manifest.Reference, selector manifest.Selector, out map[string]*manifest.Package) (err error) {
+	for _, existing := range installed {
+		if existing.String() == selector.Name() {
+			return nil
+		}
+	}
+	graph, err := e.DependencyGraph(l, installed, selector)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, root := range graph {
+		out[root.Package.Reference.String()] = root.Package
+		for _, pkg := range root.Dependencies.Uninstalled() {
+			out[pkg.Reference.String()] = pkg
+		}
+	}
+	return nil
+}
+
+// SelectedProvider returns the name of the package selected with SelectProvider to provide the virtual
+// package "virtual", or "" if none has been selected.
+func (e *Env) SelectedProvider(virtual string) string {
+	return e.config.Providers[virtual]
+}
+
+// SelectProvider selects "pkg" to provide the virtual package "virtual" in this environment.
+//
+// Other installed providers of "virtual" are uninstalled, so that once "pkg" is installed its binaries are
+// the ones linked into the environment. The selection is recorded in the environment's configuration and
+// takes precedence when resolving requirements on "virtual".
+func (e *Env) SelectProvider(l *ui.UI, virtual string, pkg *manifest.Package) (*shell.Changes, error) {
+	provides := false
+	for _, name := range pkg.Provides {
+		provides = provides || name == virtual
+	}
+	if !provides {
+		return nil, errors.Errorf("%s does not provide %s", pkg.Reference.Name, virtual)
+	}
+	providers, err := e.ResolveVirtual(l, virtual)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	installed, err := e.ListInstalled(l)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	changes := shell.NewChanges(envars.Parse(os.Environ()))
+	for _, ipkg := range installed {
+		if ipkg.Reference.Name == pkg.Reference.Name {
+			continue
+		}
+		for _, provider := range providers {
+			if provider.Reference.Name != ipkg.Reference.Name {
+				continue
+			}
+			c, err := e.uninstall(l.Task(ipkg.Reference.String()), ipkg)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			changes = changes.Merge(c)
+		}
+	}
+	if e.config.Providers == nil {
+		e.config.Providers = map[string]string{}
+	}
+	e.config.Providers[virtual] = pkg.Reference.Name
+	return changes, e.writeConfig()
+}
+
+// Returned when conflicting requirements can all be satisfied by another version of a package, so
+// resolution should be retried with that version.
+type retryWithVersion struct {
+	ref manifest.Reference
+	err error // The conflict, if retrying doesn't resolve it.
+}
+
+func (r *retryWithVersion) Error() string { return r.err.Error() }
+
+// A requirement on a package.
+type constraint struct {
+	// Describes where the requirement came from, eg. "foo-1.0.0 requires go-1.21*".
+	source   string
+	selector manifest.Selector
+}
+
+type depResolver struct {
+	env       *Env
+	l         *ui.UI
+	installed map[string]manifest.Reference
+	pinned    map[string]manifest.Reference
+	// Packages selected so far, by name.
+	selected    map[string]*manifest.Package
+	constraints map[string][]constraint
+}
+
+func newDepResolver(env *Env, l *ui.UI, installed []manifest.Reference, pinned map[string]manifest.Reference) *depResolver {
+	r := &depResolver{
+		env:         env,
+		l:           l,
+		installed:   map[string]manifest.Reference{},
+		pinned:      pinned,
+		selected:    map[string]*manifest.Package{},
+		constraints: map[string][]constraint{},
+	}
+	for _, ref := range installed {
+		r.installed[ref.Name] = ref
+	}
+	return r
+}
+
+func (r *depResolver) resolve(selectors []manifest.Selector) (Dependencies, error) {
+	// Select all requested packages first, so that they take precedence over installed versions.
+	roots := make(Dependencies, 0, len(selectors))
+	for _, selector := range selectors {
+		pkg, err := r.env.Resolve(r.l, selector, false)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		name := pkg.Reference.Name
+		r.constraints[name] = append(r.constraints[name], constraint{selector.String() + " was requested", selector})
+		r.selected[name] = pkg
+		roots = append(roots, &Dependency{Requirement: selector.String(), Package: pkg, Installed: r.isInstalled(pkg)})
+	}
+	for _, root := range roots {
+		deps, err := r.requirements(root.Package)
+		if err != nil {
+			return nil, err
+		}
+		root.Dependencies = deps
+	}
+	return roots, nil
+}
+
+// Resolve the requirements of a package.
+func (r *depResolver) requirements(pkg *manifest.Package) (Dependencies, error) {
+	deps := make(Dependencies, 0, len(pkg.Requires))
+	for _, req := range pkg.Requires {
+		dep, err := r.require(pkg, req)
+		if err != nil {
+			return nil, err
+		}
+		deps = append(deps, dep)
+	}
+	return deps, nil
+}
+
+func (r *depResolver) require(from *manifest.Package, req string) (*Dependency, error) {
+	selector, err := manifest.ParseGlobSelector(req)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s: invalid requirement %q", from, req)
+	}
+	var sel manifest.Selector = selector
+	if !sel.IsFullyQualified() {
+		provider, err := r.resolveVirtual(req)
+		if err != nil && !errors.Is(err, manifest.ErrUnknownPackage) {
+			return nil, errors.WithStack(err)
+		} else if err == nil {
+			sel = manifest.NameSelector(provider)
+		}
+	}
+	name := sel.Name()
+	r.constraints[name] = append(r.constraints[name], constraint{fmt.Sprintf("%s requires %s", from, req), sel})
+
+	if pkg, ok := r.selected[name]; ok {
+		if !r.satisfies(name, pkg.Reference) {
+			return nil, r.conflict(name, pkg.Reference)
+		}
+		return &Dependency{Requirement: req, Package: pkg, Installed: r.isInstalled(pkg)}, nil
+	}
+	installed, isInstalled := r.installed[name]
+	if isInstalled {
+		if !sel.Matches(installed) {
+			return nil, r.conflict(name, installed)
+		}
+		sel = manifest.ExactSelector(installed)
+	} else if ref, ok := r.pinned[name]; ok && sel.Matches(ref) {
+		sel = manifest.ExactSelector(ref)
+	}
+	pkg, err := r.env.Resolve(r.l, sel, false)
+	if isInstalled && errors.Is(err, manifest.ErrUnknownPackage) {
+		// The installed version is no longer in the manifests, but still satisfies the requirement.
+		pkg, err = &manifest.Package{Reference: installed}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s: %s", from, req)
+	}
+	r.selected[name] = pkg
+	deps, err := r.requirements(pkg)
+	if err != nil {
+		return nil, err
+	}
+	return &Dependency{Requirement: req, Package: pkg, Installed: r.isInstalled(pkg), Dependencies: deps}, nil
+}
+
+// Resolve a virtual package to the name of the package providing it.
+func (r *depResolver) resolveVirtual(name string) (string, error) {
+	virtual, err := r.env.ResolveVirtual(r.l, name)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	candidates := []string{}
+	for _, vpkg := range virtual {
+		if vpkg.Reference.Name == r.env.SelectedProvider(name) {
+			return vpkg.Reference.Name, nil
+		}
+	}
+	for _, vpkg := range virtual {
+		candidates = append(candidates, vpkg.Reference.Name)
+		if _, ok := r.selected[vpkg.Reference.Name]; ok {
+			return vpkg.Reference.Name, nil
+		}
+		if _, ok := r.installed[vpkg.Reference.Name]; ok {
+			return vpkg.Reference.Name, nil
+		}
+	}
+	if len(candidates) == 1 {
+		return candidates[0], nil
+	}
+	return "", errors.Errorf("multiple packages satisfy the required dependency %q, please install one of the following manually: %s", name, strings.Join(candidates, ", "))
+}
+
+// Returns true if "ref" satisfies every requirement on the package "name".
+func (r *depResolver) satisfies(name string, ref manifest.Reference) bool {
+	for _, c := range r.constraints[name] {
+		if !c.selector.Matches(ref) {
+			return false
+		}
+	}
+	return true
+}
+
+// Returns the error for requirements on "name" that "ref" does not satisfy.
+//
+// If another version satisfies every requirement and "ref" is neither installed nor requested, resolution
+// is retried with that version.
+func (r *depResolver) conflict(name string, ref manifest.Reference) error {
+	constraints := r.constraints[name]
+	selectors := make([]manifest.Selector, 0, len(constraints))
+	sources := make([]string, 0, len(constraints))
+	requested := false
+	for _, c := range constraints {
+		selectors = append(selectors, c.selector)
+		sources = append(sources, c.source)
+		requested = requested || strings.HasSuffix(c.source, " was requested")
+	}
+	installed, ok := r.installed[name]
+	if ok && installed.String() == ref.String() {
+		sources = append(sources, ref.String()+" is installed")
+	}
+	err := errors.Errorf("conflicting requirements for %s: %s", name, strings.Join(sources, ", "))
+	if ok || requested {
+		return err
+	}
+	pkg, rerr := r.env.Resolve(r.l, manifest.AllSelector(selectors...), false)
+	if rerr != nil {
+		return err
+	}
+	return &retryWithVersion{ref: pkg.Reference, err: err}
+}
+
+func (r *depResolver) isInstalled(pkg *manifest.Package) bool {
+	ref, ok := r.installed[pkg.Reference.Name]
+	return ok && ref.String() == pkg.Reference.String()
+}
@@ -0,0 +1,260 @@
+// Package docker exports Hermit environments as Docker build contexts, so
+// that images can be built with exactly the packages of an environment.
+package docker
+
+import (
+	_ "embed" // Embedding files.
+	"encoding/json"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/lockfile"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/shell"
+)
+
+// Format of an exported build context.
+type Format string
+
+// Supported export formats.
+const (
+	// A Dockerfile stage.
+	Dockerfile Format = "dockerfile"
+	// A devcontainer feature.
+	Devcontainer Format = "devcontainer"
+)
+
+// Formats lists the supported export formats.
+var Formats = []Format{Dockerfile, Devcontainer}
+
+// Names of the files in an exported build context.
+const (
+	bundleName     = "bundle.tgz"
+	envName        = "env"
+	scriptName     = "install.sh"
+	executableName = "hermit"
+	featureName    = "devcontainer-feature.json"
+	dockerfileName = "Dockerfile"
+)
+
+// Where the Hermit executable is installed in the image, if it is included in the build context.
+const executablePath = "/usr/local/bin/hermit"
+
+var (
+	//go:embed files/Dockerfile.tmpl
+	dockerfile     string
+	dockerfileTmpl = template.Must(template.New("Dockerfile").Parse(dockerfile))
+
+	//go:embed files/install.sh.tmpl
+	script     string
+	scriptTmpl = template.Must(template.New("install.sh").
+			Funcs(template.FuncMap{"quote": shell.Quote}).
+			Parse(script))
+)
+
+// Export describes the build context to write.
+type Export struct {
+	// Directory of the exported environment.
+	Env string
+	// bin directory of the exported environment, which is copied into the build context.
+	BinDir string
+	// Directories within Env that are copied into the build context, eg. "env:///" manifest sources.
+	EnvDirs []string
+	// Packages installed in the environment.
+	Packages manifest.Packages
+	// WriteBundle writes a bundle of the packages and manifests, as "hermit bundle export" does.
+	WriteBundle func(w io.Writer) error
+	// Hermit executable for the platform of the image, or "" to download Hermit while building the image.
+	Executable string
+	// Base image of the Dockerfile stage.
+	Base string
+	// Name of the Dockerfile stage.
+	Stage string
+	// Directory the environment is installed to in the image.
+	Dir string
+	// Hermit state directory in the image.
+	StateDir string
+}
+
+type templateContext struct {
+	Env            string
+	Packages       []string
+	Base           string
+	Stage          string
+	Dir            string
+	StateDir       string
+	Executable     string
+	ExecutablePath string
+	Script         string
+	Bundle         string
+	EnvFiles       string
+	Locked         bool
+}
+
+type feature struct {
+	ID           string            `json:"id"`
+	Version      string            `json:"version"`
+	Name         string            `json:"name"`
+	Description  string            `json:"description"`
+	ContainerEnv map[string]string `json:"containerEnv"`
+}
+
+// Write the build context for "export" to the directory "dir" in the given format.
+//
+// The build context contains the bundle, copies of the environment's bin
+// directory and EnvDirs, an install.sh script that installs the packages
+// offline, and either a Dockerfile or a devcontainer-feature.json running it.
+func Write(dir string, format Format, export Export) error {
+	if format != Dockerfile && format != Devcontainer {
+		return errors.Errorf("unsupported export format %q", format)
+	}
+	for _, p := range []string{export.Dir, export.StateDir} {
+		if !path.IsAbs(p) || strings.ContainsAny(p, " \t\n") {
+			return errors.Errorf("%q must be an absolute path without whitespace", p)
+		}
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	ctx := templateContext{
+		Env:      export.Env,
+		Packages: make([]string, 0, len(export.Packages)),
+		Base:     export.Base,
+		Stage:    export.Stage,
+		Dir:      export.Dir,
+		StateDir: export.StateDir,
+		Script:   scriptName,
+		Bundle:   bundleName,
+		EnvFiles: envName,
+	}
+	for _, pkg := range export.Packages {
+		ctx.Packages = append(ctx.Packages, pkg.Reference.String())
+	}
+	if err := writeBundle(filepath.Join(dir, bundleName), export.WriteBundle); err != nil {
+		return err
+	}
+	envDir := filepath.Join(dir, envName)
+	if err := os.RemoveAll(envDir); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := copyDir(export.BinDir, filepath.Join(envDir, "bin")); err != nil {
+		return err
+	}
+	for _, rel := range export.EnvDirs {
+		if err := copyDir(filepath.Join(export.Env, rel), filepath.Join(envDir, rel)); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(filepath.Join(export.BinDir, lockfile.Name)); err == nil {
+		ctx.Locked = true
+	}
+	if export.Executable != "" {
+		if err := copyFile(export.Executable, filepath.Join(dir, executableName), 0755); err != nil {
+			return err
+		}
+		ctx.Executable = executableName
+		ctx.ExecutablePath = executablePath
+	}
+	if err := writeTemplate(filepath.Join(dir, scriptName), 0755, scriptTmpl, ctx); err != nil {
+		return err
+	}
+	if format == Dockerfile {
+		return writeTemplate(filepath.Join(dir, dockerfileName), 0600, dockerfileTmpl, ctx)
+	}
+	return writeFeature(filepath.Join(dir, featureName), ctx)
+}
+
+func writeFeature(dest string, ctx templateContext) error {
+	env := map[string]string{
+		"HERMIT_STATE_DIR": ctx.StateDir,
+		"PATH":             ctx.Dir + "/bin:${PATH}",
+	}
+	if ctx.Executable != "" {
+		env["HERMIT_EXE"] = ctx.ExecutablePath
+	}
+	out, err := json.MarshalIndent(feature{
+		ID:           "hermit",
+		Version:      "1.0.0",
+		Name:         "Hermit environment " + filepath.Base(ctx.Env),
+		Description:  "Installs the packages of the Hermit environment " + ctx.Env + ": " + strings.Join(ctx.Packages, ", "),
+		ContainerEnv: env,
+	}, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.WriteFile(dest, append(out, '\n'), 0600))
+}
+
+func writeTemplate(dest string, mode os.FileMode, tmpl *template.Template, ctx templateContext) error {
+	w, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer w.Close() // nolint: gosec
+	if err := tmpl.Execute(w, ctx); err != nil {
+		return errors.Wrap(err, dest)
+	}
+	return errors.WithStack(w.Close())
+}
+
+func writeBundle(dest string, write func(w io.Writer) error) error {
+	w, err := os.Create(dest)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer w.Close() // nolint: gosec
+	if err := write(w); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(w.Close())
+}
+
+// Recursively copy the directories, files and symlinks in "src" to "dest".
+func copyDir(src, dest string) error {
+	return filepath.Walk(src, func(from string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		rel, err := filepath.Rel(src, from)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		to := filepath.Join(dest, rel)
+		switch {
+		case info.IsDir():
+			return errors.WithStack(os.MkdirAll(to, info.Mode().Perm()))
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(from)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			return errors.WithStack(os.Symlink(link, to))
+		case info.Mode().IsRegular():
+			return copyFile(from, to, info.Mode().Perm())
+		}
+		return nil
+	})
+}
+
+func copyFile(src, dest string, mode os.FileMode) error {
+	r, err := os.Open(src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer r.Close() // nolint: gosec
+	w, err := os.OpenFile(dest, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer w.Close() // nolint: gosec
+	if _, err := io.Copy(w, r); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(w.Close())
+}
@@ -0,0 +1,102 @@
+package docker
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/manifest/manifesttest"
+)
+
+func testExport(t *testing.T) Export {
+	t.Helper()
+	binDir := filepath.Join(t.TempDir(), "bin")
+	require.NoError(t, os.Mkdir(binDir, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "hermit"), []byte("#!/bin/bash\n"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, ".go-1.21.0.pkg"), nil, 0600))
+	require.NoError(t, os.Symlink("hermit", filepath.Join(binDir, "go")))
+	pkg := manifesttest.NewPkgBuilder("/pkg/go-1.21.0").WithName("go").WithVersion("1.21.0").Result()
+	return Export{
+		Env:         "/home/user/project",
+		BinDir:      binDir,
+		Packages:    manifest.Packages{pkg},
+		WriteBundle: func(w io.Writer) error { _, err := w.Write([]byte("bundle")); return err },
+		Base:        "debian:stable-slim",
+		Stage:       "hermit",
+		Dir:         "/opt/hermit/env",
+		StateDir:    "/opt/hermit/state",
+	}
+}
+
+func TestWriteDockerfile(t *testing.T) {
+	dir := t.TempDir()
+	export := testExport(t)
+	require.NoError(t, Write(dir, Dockerfile, export))
+
+	bundle, err := os.ReadFile(filepath.Join(dir, bundleName))
+	require.NoError(t, err)
+	require.Equal(t, "bundle", string(bundle))
+	require.FileExists(t, filepath.Join(dir, envName, "bin", ".go-1.21.0.pkg"))
+	link, err := os.Readlink(filepath.Join(dir, envName, "bin", "go"))
+	require.NoError(t, err)
+	require.Equal(t, "hermit", link)
+	require.NoFileExists(t, filepath.Join(dir, executableName))
+	require.NoFileExists(t, filepath.Join(dir, featureName))
+
+	dockerfile, err := os.ReadFile(filepath.Join(dir, dockerfileName))
+	require.NoError(t, err)
+	require.Contains(t, string(dockerfile), "#   go-1.21.0\n")
+	require.Contains(t, string(dockerfile), "FROM debian:stable-slim AS hermit\nENV HERMIT_STATE_DIR=/opt/hermit/state\nRUN ")
+	require.Contains(t, string(dockerfile), "ENV PATH=/opt/hermit/env/bin:${PATH}\n")
+	require.NotContains(t, string(dockerfile), "HERMIT_EXE")
+
+	script, err := os.ReadFile(filepath.Join(dir, scriptName))
+	require.NoError(t, err)
+	require.Contains(t, string(script), "./bin/hermit --offline install\n")
+	require.Contains(t, string(script), "bin/hermit downloads it")
+	require.NoError(t, exec.Command("bash", "-n", filepath.Join(dir, scriptName)).Run())
+}
+
+func TestWriteDevcontainerFeature(t *testing.T) {
+	dir := t.TempDir()
+	export := testExport(t)
+	export.Executable = filepath.Join(export.BinDir, "hermit")
+	require.NoError(t, os.WriteFile(filepath.Join(export.BinDir, "hermit.lock"), nil, 0600))
+	require.NoError(t, Write(dir, Devcontainer, export))
+
+	require.FileExists(t, filepath.Join(dir, executableName))
+	require.NoFileExists(t, filepath.Join(dir, dockerfileName))
+	data, err := os.ReadFile(filepath.Join(dir, featureName))
+	require.NoError(t, err)
+	actual := feature{}
+	require.NoError(t, json.Unmarshal(data, &actual))
+	require.Equal(t, feature{
+		ID:          "hermit",
+		Version:     "1.0.0",
+		Name:        "Hermit environment project",
+		Description: "Installs the packages of the Hermit environment /home/user/project: go-1.21.0",
+		ContainerEnv: map[string]string{
+			"HERMIT_STATE_DIR": "/opt/hermit/state",
+			"HERMIT_EXE":       "/usr/local/bin/hermit",
+			"PATH":             "/opt/hermit/env/bin:${PATH}",
+		},
+	}, actual)
+
+	script, err := os.ReadFile(filepath.Join(dir, scriptName))
+	require.NoError(t, err)
+	require.Contains(t, string(script), "export HERMIT_EXE='/usr/local/bin/hermit'\n")
+	require.Contains(t, string(script), "./bin/hermit --offline install --locked\n")
+	require.NoError(t, exec.Command("bash", "-n", filepath.Join(dir, scriptName)).Run())
+}
+
+func TestWriteRejectsRelativeDir(t *testing.T) {
+	export := testExport(t)
+	export.Dir = "env"
+	require.EqualError(t, Write(t.TempDir(), Dockerfile, export), `"env" must be an absolute path without whitespace`)
+}
@@ -6,3 +6,9 @@ short-prompt = boolean # (optional)
 no-git = boolean # (optional)
 # If true Hermit will try to add the IntelliJ IDEA plugin automatically.
 idea = boolean # (optional)
+# If true Hermit will record package installs, upgrades and uninstalls to a local log.
+telemetry = boolean # (optional)
+# If set, telemetry events are also pushed to this HTTP endpoint.
+telemetry-url = string # (optional)
+# GitHub token used to access private releases, instead of $HERMIT_GITHUB_TOKEN, $GITHUB_TOKEN, the gh CLI or ~/.netrc.
+github-token = string # (optional)
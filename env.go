@@ -3,16 +3,17 @@ package hermit
 import (
 	"bytes"
 	"embed"
+	"encoding/base64"
 	"fmt"
 	"io/fs"
 	"io/ioutil"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
-	"syscall"
 	"time"
 
 	"github.com/cashapp/hermit/platform"
@@ -21,10 +22,15 @@ import (
 	"github.com/kballard/go-shellquote"
 	"github.com/pkg/errors"
 
+	"github.com/cashapp/hermit/cache"
 	"github.com/cashapp/hermit/envars"
+	"github.com/cashapp/hermit/events"
+	"github.com/cashapp/hermit/lockfile"
 	"github.com/cashapp/hermit/state"
+	"github.com/cashapp/hermit/telemetry"
 
 	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/retry"
 	"github.com/cashapp/hermit/shell"
 	"github.com/cashapp/hermit/sources"
 	"github.com/cashapp/hermit/ui"
@@ -57,6 +63,9 @@ var envBinFiles = map[string]os.FileMode{
 	"README.hermit.md": 0600,
 	"activate-hermit":  0700,
 	"hermit":           0700,
+	// For PowerShell, on Windows in particular.
+	"activate-hermit.ps1": 0700,
+	"hermit.ps1":          0700,
 }
 
 //go:generate stringer -linecomment -type CleanMask
@@ -75,10 +84,36 @@ const (
 
 // Config for a Hermit environment.
 type Config struct {
-	Envars      envars.Envars `hcl:"env,optional" help:"Extra environment variables."`
-	Sources     []string      `hcl:"sources,optional" help:"Package manifest sources."`
-	ManageGit   bool          `hcl:"manage-git,optional" default:"true" help:"Whether Hermit should automatically 'git add' new packages."`
-	AddIJPlugin bool          `hcl:"idea,optional" default:"false" help:"Whether Hermit should automatically add the IntelliJ IDEA plugin."`
+	Envars        envars.Envars     `hcl:"env,optional" help:"Extra environment variables."`
+	Sources       []string          `hcl:"sources,optional" help:"Package manifest sources."`
+	ManageGit     bool              `hcl:"manage-git,optional" default:"true" help:"Whether Hermit should automatically 'git add' new packages."`
+	AddIJPlugin   bool              `hcl:"idea,optional" default:"false" help:"Whether Hermit should automatically add the IntelliJ IDEA plugin."`
+	Mirrors       []*MirrorConfig   `hcl:"mirror,block" help:"Download URLs starting with <prefix> from a mirror instead."`
+	Providers     map[string]string `hcl:"providers,optional" help:"Packages selected with \"hermit select\" to provide virtual packages, keyed by virtual package."`
+	HermitChannel string            `hcl:"hermit-channel,optional" help:"Hermit release channel this environment uses, as set by \"hermit self-upgrade --channel\"."`
+	HermitVersion string            `hcl:"hermit-version,optional" help:"Hermit version this environment is pinned to, as set by \"hermit self-pin\"."`
+	NoTelemetry   bool              `hcl:"no-telemetry,optional" help:"If true Hermit will not record telemetry for package operations in this environment."`
+	Inherit       string            `hcl:"inherit,optional" help:"Path to a parent environment, relative to this environment, to inherit packages, sources and environment variables from."`
+	Profiles      []*ProfileConfig  `hcl:"profile,block" help:"Named sets of packages and environment variables, activated with \"hermit activate --profile\"."`
+	// Durations are validated when the config is read.
+	UpdateIntervals map[string]string `hcl:"update-intervals,optional" help:"How often to check channels for updates, keyed by <package> or <package>@<channel>, eg. {\"rust@nightly\": \"168h\"}. \"0s\" disables updates."`
+	Retry           *RetryConfig      `hcl:"retry,block" help:"Policy for retrying network operations that fail transiently."`
+}
+
+// RetryConfig overrides the default policy for retrying network operations.
+type RetryConfig struct {
+	Attempts    int           `hcl:"attempts,optional" help:"Maximum number of attempts of each network operation, including the first."`
+	MinBackoff  time.Duration `hcl:"min-backoff,optional" help:"Delay before the first retry, doubling with each subsequent retry."`
+	MaxBackoff  time.Duration `hcl:"max-backoff,optional" help:"Maximum delay between retries."`
+	StatusCodes []int         `hcl:"status-codes,optional" help:"HTTP response statuses to retry."`
+}
+
+// MirrorConfig rewrites download URLs starting with Prefix to start with URL instead.
+type MirrorConfig struct {
+	Prefix       string `hcl:"prefix,label" help:"URL prefix to mirror, eg. https://github.com/"`
+	URL          string `hcl:"url" help:"Mirror URL to replace the prefix with."`
+	TokenEnv     string `hcl:"token-env,optional" help:"Environment variable containing a bearer token to send to the mirror."`
+	BasicAuthEnv string `hcl:"basic-auth-env,optional" help:"Environment variable containing <username>:<password> to send to the mirror."`
 }
 
 // Env is a Hermit environment.
@@ -91,6 +126,9 @@ type Env struct {
 	config          *Config
 	configFile      string
 	httpClient      *http.Client
+	telemetry       *telemetry.Recorder
+	parent          *Env // The environment this one inherits from, if any.
+	profiles        []*ProfileConfig
 
 	// Lazily initialized fields
 	lazyResolver *manifest.Resolver
@@ -192,8 +230,15 @@ For more information please refer to https://github.com/cashapp/hermit
 	return nil
 }
 
-// EnvDirFromProxyLink finds a Hermit environment given a proxy symlink.
+// EnvDirFromProxyLink finds a Hermit environment given a proxy symlink, or an .exe stub on Windows.
 func EnvDirFromProxyLink(executable string) (string, error) {
+	if IsExeStub(executable) {
+		abs, err := filepath.Abs(executable)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		return filepath.Dir(filepath.Dir(abs)), nil
+	}
 	links, err := util.ResolveSymlinks(executable)
 	if err != nil {
 		return "", errors.WithStack(err)
@@ -209,9 +254,8 @@ func EnvDirFromProxyLink(executable string) (string, error) {
 	return envDir, nil
 }
 
-func getSources(l *ui.UI, envDir string, config *Config, state *state.State, defaultSources []string) (*sources.Sources, error) {
-	configuredSources := config.Sources
-	if config.Sources == nil {
+func getSources(l *ui.UI, envDir string, configuredSources []string, state *state.State, defaultSources []string) (*sources.Sources, error) {
+	if configuredSources == nil {
 		configuredSources = defaultSources
 	}
 	ss, err := sources.ForURIs(l, state.SourcesDir(), envDir, configuredSources)
@@ -220,6 +264,9 @@ func getSources(l *ui.UI, envDir string, config *Config, state *state.State, def
 	}
 	// Always include the builtin sources required by Hermit.
 	ss.Prepend(state.Config().Builtin)
+	ss.SetOffline(state.Offline())
+	ss.SetRetrier(state.Config().Retrier)
+	ss.SetContext(state.Context())
 	return ss, nil
 }
 
@@ -235,6 +282,11 @@ func readConfig(configFile string) (*Config, error) {
 			return nil, errors.Wrap(err, configFile)
 		}
 	}
+	for key, value := range config.UpdateIntervals {
+		if _, err := time.ParseDuration(value); err != nil {
+			return nil, errors.Wrapf(err, "update-intervals: %s", key)
+		}
+	}
 	return config, nil
 }
 
@@ -242,6 +294,10 @@ func readConfig(configFile string) (*Config, error) {
 //
 // The environment may not exist, in which case this will succeed but subsequent operations will fail.
 func OpenEnv(envDir string, state *state.State, ephemeral envars.Envars, httpClient *http.Client) (*Env, error) {
+	return openEnv(envDir, state, ephemeral, httpClient, map[string]bool{})
+}
+
+func openEnv(envDir string, state *state.State, ephemeral envars.Envars, httpClient *http.Client, seen map[string]bool) (*Env, error) {
 	binDir := filepath.Join(envDir, "bin")
 	configFile := filepath.Join(binDir, "hermit.hcl")
 	config, err := readConfig(configFile)
@@ -262,9 +318,61 @@ func OpenEnv(envDir string, state *state.State, ephemeral envars.Envars, httpCli
 		ephemeralEnvars: envars.Infer(ephemeral.System()),
 		httpClient:      httpClient,
 	}
+	seen[envDir] = true
+	if err := e.openParent(seen, ephemeral); err != nil {
+		return nil, err
+	}
 	return e, nil
 }
 
+// Mirrors configured for the environment, with their credentials resolved from the environment.
+func (e *Env) Mirrors() ([]cache.Mirror, error) {
+	mirrors := make([]cache.Mirror, 0, len(e.config.Mirrors))
+	for _, config := range e.config.Mirrors {
+		mirror := cache.Mirror{Prefix: config.Prefix, URL: config.URL, Header: http.Header{}}
+		if config.TokenEnv != "" {
+			token := os.Getenv(config.TokenEnv)
+			if token == "" {
+				return nil, errors.Errorf("mirror %q: %s is not set", config.Prefix, config.TokenEnv)
+			}
+			mirror.Header.Set("Authorization", "Bearer "+token)
+		}
+		if config.BasicAuthEnv != "" {
+			credentials := os.Getenv(config.BasicAuthEnv)
+			if !strings.Contains(credentials, ":") {
+				return nil, errors.Errorf("mirror %q: %s must be set to <username>:<password>", config.Prefix, config.BasicAuthEnv)
+			}
+			mirror.Header.Set("Authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte(credentials)))
+		}
+		mirrors = append(mirrors, mirror)
+	}
+	return mirrors, nil
+}
+
+// RetryPolicy returns "policy" with the overrides configured for the environment applied.
+func (e *Env) RetryPolicy(policy retry.Policy) (retry.Policy, error) {
+	config := e.config.Retry
+	if config == nil {
+		return policy, nil
+	}
+	if config.Attempts != 0 {
+		policy.Attempts = config.Attempts
+	}
+	if config.MinBackoff != 0 {
+		policy.MinBackoff = config.MinBackoff
+	}
+	if config.MaxBackoff != 0 {
+		policy.MaxBackoff = config.MaxBackoff
+	}
+	if config.StatusCodes != nil {
+		policy.StatusCodes = config.StatusCodes
+	}
+	if err := policy.Validate(); err != nil {
+		return policy, errors.Wrap(err, "retry")
+	}
+	return policy, nil
+}
+
 // Root directory of the environment.
 func (e *Env) Root() string {
 	return e.envDir
@@ -288,7 +396,7 @@ func (e *Env) Trigger(l *ui.UI, event manifest.Event) (messages []string, err er
 
 // TriggerForPackage triggers an event for a single package.
 func (e *Env) TriggerForPackage(l *ui.UI, event manifest.Event, pkg *manifest.Package) (messages []string, err error) {
-	messages, err = pkg.Trigger(l, event)
+	messages, err = pkg.Trigger(l, event, e.envDir)
 	if err != nil {
 		return nil, errors.Wrapf(err, "%s: on %s", pkg, event)
 	}
@@ -308,12 +416,15 @@ func (e *Env) ValidateManifests(l *ui.UI) (manifest.ManifestErrors, error) {
 }
 
 // GC can be used to clean up unused packages, and clear the download cache.
-func (e *Env) GC(l *ui.UI, age time.Duration) error {
-	return e.state.GC(l, age, e.Resolve)
+func (e *Env) GC(l *ui.UI, options state.GCOptions) (*state.GCReport, error) {
+	return e.state.GC(l, options, e.Resolve)
 }
 
 // LinkedBinaries lists just the binaries installed in the environment.
 func (e *Env) LinkedBinaries(pkg *manifest.Package) (binaries []string, err error) {
+	if useExeStubs {
+		return e.linkedStubs(pkg)
+	}
 	files, err := ioutil.ReadDir(e.binDir)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -334,7 +445,17 @@ func (e *Env) LinkedBinaries(pkg *manifest.Package) (binaries []string, err erro
 
 // Uninstall uninstalls a single package.
 func (e *Env) Uninstall(l *ui.UI, pkg *manifest.Package) (*shell.Changes, error) {
-	return e.uninstall(l.Task(pkg.Reference.String()), pkg)
+	changes, err := e.uninstall(l.Task(pkg.Reference.String()), pkg)
+	if err != nil {
+		return nil, err
+	}
+	e.recordTelemetry(l, telemetry.Uninstall, pkg)
+	e.state.Events().EmitUninstall(events.PackageEvent{Env: e.envDir, Package: pkg})
+	if err := e.refreshDependents(l, pkg); err != nil {
+		return nil, err
+	}
+	// Restore the inherited package the uninstalled package overrode, if any.
+	return changes, e.LinkInherited(l)
 }
 
 func (e *Env) uninstall(l *ui.Task, pkg *manifest.Package) (*shell.Changes, error) {
@@ -386,7 +507,13 @@ func (e *Env) unlinkPackage(l *ui.Task, pkg *manifest.Package) error {
 	task.Add(1)
 
 	for _, link := range binaries {
-		err := e.unlink(task, link)
+		var err error
+		if useExeStubs {
+			// Stubs aren't added to git.
+			err = os.Remove(link)
+		} else {
+			err = e.unlink(task, link)
+		}
 		task.Add(1)
 		if err != nil && !os.IsNotExist(err) {
 			return errors.WithStack(err)
@@ -419,6 +546,10 @@ func (e *Env) Test(l *ui.UI, pkg *manifest.Package) error {
 	if err = e.state.CacheAndUnpack(task, pkg); err != nil {
 		return errors.WithStack(err)
 	}
+	// The package may not be installed, so record its use to keep GC from removing it.
+	if err = e.state.WritePackageState(pkg, e.binDir); err != nil {
+		return errors.WithStack(err)
+	}
 	bins, err := pkg.ResolveBinaries()
 	if err != nil {
 		return errors.WithStack(err)
@@ -455,6 +586,18 @@ func (e *Env) Unpack(l *ui.Task, p *manifest.Package) error {
 
 // Install package. If a package with same name exists, uninstall it first.
 func (e *Env) Install(l *ui.UI, pkg *manifest.Package) (*shell.Changes, error) {
+	return e.installReplacing(l, pkg, HistoryInstall, state.Provenance{Reason: state.ProvenanceDirect})
+}
+
+// InstallDependency installs "pkg" as Install does, recording that it was installed as a dependency of "dependent".
+func (e *Env) InstallDependency(l *ui.UI, pkg *manifest.Package, dependent *manifest.Package) (*shell.Changes, error) {
+	return e.installReplacing(l, pkg, HistoryInstall, state.Provenance{Reason: state.ProvenanceDependency, RequiredBy: dependent.Reference.String()})
+}
+
+// Install "pkg", replacing any installed version of it, which is recorded in the history as "operation".
+//
+// "provenance" records why the package was installed.
+func (e *Env) installReplacing(l *ui.UI, pkg *manifest.Package, operation HistoryOperation, provenance state.Provenance) (*shell.Changes, error) {
 	task := l.Task(pkg.Reference.String())
 
 	installed, err := e.ListInstalled(l)
@@ -468,14 +611,19 @@ func (e *Env) Install(l *ui.UI, pkg *manifest.Package) (*shell.Changes, error) {
 	allChanges := shell.NewChanges(envars.Parse(os.Environ()))
 
 	didUninstall := false
+	var replaced *manifest.Package
 	for _, ipkg := range installed {
 		if ipkg.Reference.Name == pkg.Reference.Name {
+			if provenance.Reason == state.ProvenanceRollback {
+				provenance.RequiredBy = e.recordedDependent(ipkg)
+			}
 			changes, err := e.uninstall(task, ipkg)
 			if err != nil {
 				return nil, errors.WithStack(err)
 			}
 			allChanges = allChanges.Merge(changes)
 			didUninstall = true
+			replaced = ipkg
 		}
 	}
 
@@ -494,6 +642,13 @@ func (e *Env) Install(l *ui.UI, pkg *manifest.Package) (*shell.Changes, error) {
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	e.recordTelemetry(l, telemetry.Install, pkg)
+	if replaced != nil && replaced.Reference.Compare(pkg.Reference) != 0 {
+		e.recordHistory(l, operation, replaced, pkg)
+		provenance.Replaced = replaced.Reference.String()
+	}
+	e.recordProvenance(l, pkg, provenance)
+	e.state.Events().EmitInstall(events.PackageEvent{Env: e.envDir, Package: pkg})
 
 	return allChanges.Merge(changes), nil
 }
@@ -572,6 +727,9 @@ func (e *Env) install(l *ui.UI, p *manifest.Package) (*shell.Changes, error) {
 		if err = e.state.WritePackageState(p, e.binDir); err != nil {
 			return nil, errors.WithStack(err)
 		}
+		if err = e.refreshDependents(l, p); err != nil {
+			return nil, errors.WithStack(err)
+		}
 	}
 	ops := e.envarsForPackages(p)
 	changes := shell.NewChanges(envars.Parse(os.Environ()))
@@ -596,24 +754,31 @@ func (e *Env) Upgrade(l *ui.UI, pkg *manifest.Package) (*shell.Changes, error) {
 // Link chains are in the form
 //
 //     <binary> -> <pkg>-<version>.pkg -> hermit
+//
+// On Windows "executable" is instead an .exe stub, and the .pkg file lists its binary.
 func (e *Env) ResolveLink(l *ui.UI, executable string) (pkg *manifest.Package, binary string, err error) {
-	links, err := util.ResolveSymlinks(executable)
-	if err != nil {
-		return nil, "", errors.WithStack(err)
-	}
-	var (
-		link  string
-		found bool
-	)
-	for _, link = range links {
-		if strings.HasSuffix(link, ".pkg") {
-			found = true
-			break
+	var link string
+	if useExeStubs {
+		link, binary, err = findStubPackageLink(executable)
+		if err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+	} else {
+		links, err := util.ResolveSymlinks(executable)
+		if err != nil {
+			return nil, "", errors.WithStack(err)
+		}
+		found := false
+		for _, link = range links {
+			if strings.HasSuffix(link, ".pkg") {
+				found = true
+				break
+			}
+			binary = link
+		}
+		if !found {
+			return nil, "", errors.Errorf("%s: could not find Hermit .pkg in symlink chain", executable)
 		}
-		binary = link
-	}
-	if !found {
-		return nil, "", errors.Errorf("%s: could not find Hermit .pkg in symlink chain", executable)
 	}
 	ref := e.referenceFromBinLink(link)
 	pkg, err = e.Resolve(l, manifest.ExactSelector(ref), true)
@@ -630,6 +795,24 @@ func (e *Env) ResolveLink(l *ui.UI, executable string) (pkg *manifest.Package, b
 //
 // The missing dependencies are downloaded and unpacked.
 func (e *Env) Exec(l *ui.UI, pkg *manifest.Package, binary string, args []string, deps map[string]*manifest.Package) error {
+	return e.exec(l, pkg, binary, args, deps, false)
+}
+
+// ExecEphemeral executes a binary from a package that doesn't have to be
+// installed in the environment, replacing this process, as for Exec.
+//
+// The package and its dependencies are downloaded and unpacked into the shared
+// state, and the binary is executed with the environment variables of the
+// installed packages and "pkg", in place of any installed version of it. The
+// environment's configuration is left untouched.
+//
+// If "binary" is empty, the binary named after the package is executed, or
+// the package's only binary. Unlike for Exec, "args" exclude the binary name.
+func (e *Env) ExecEphemeral(l *ui.UI, pkg *manifest.Package, binary string, args []string, deps map[string]*manifest.Package) error {
+	return e.exec(l, pkg, binary, append([]string{""}, args...), deps, true)
+}
+
+func (e *Env) exec(l *ui.UI, pkg *manifest.Package, binary string, args []string, deps map[string]*manifest.Package, ephemeral bool) error {
 	b := l.Task(pkg.Reference.String())
 	timer := ui.LogElapsed(l, "exec")
 	err := e.state.CacheAndUnpack(l.Task(pkg.Reference.String()), pkg)
@@ -644,6 +827,12 @@ func (e *Env) Exec(l *ui.UI, pkg *manifest.Package, binary string, args []string
 		if err != nil {
 			return errors.WithStack(err)
 		}
+		// Dependencies of packages that aren't installed aren't otherwise known to GC.
+		if ephemeral {
+			if err := e.state.WritePackageState(dep, e.binDir); err != nil {
+				return errors.WithStack(err)
+			}
+		}
 	}
 	pkg, err = e.Resolve(l, manifest.ExactSelector(pkg.Reference), true)
 	if err != nil {
@@ -665,11 +854,23 @@ func (e *Env) Exec(l *ui.UI, pkg *manifest.Package, binary string, args []string
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	env := e.allEnvarsForPackages(true, runtimeDeps, installed...)
-
-	if err != nil {
-		return errors.WithStack(err)
+	if ephemeral {
+		active := []*manifest.Package{pkg}
+		for _, installed := range installed {
+			if installed.Reference.Name != pkg.Reference.Name {
+				active = append(active, installed)
+			}
+		}
+		installed = active
+		if binary == "" {
+			if binary, err = defaultBinary(pkg, binaries); err != nil {
+				return err
+			}
+		}
 	}
+	transform := e.envarTransformForPackages(runtimeDeps, installed...)
+	env := transform.Combined().System()
+
 	for _, bin := range binaries {
 		if filepath.Base(bin) != filepath.Base(binary) {
 			continue
@@ -678,16 +879,44 @@ func (e *Env) Exec(l *ui.UI, pkg *manifest.Package, binary string, args []string
 		if err != nil {
 			return errors.WithStack(err)
 		}
+		if !ephemeral {
+			if err := e.writeExecSnapshot(args[0], bin, env, append(runtimeDeps, pkg)); err != nil {
+				b.Debugf("Could not write exec snapshot: %s", err)
+			}
+		}
+		if ephemeral {
+			args[0] = bin
+		}
 		b.Tracef("exec %s", shellquote.Join(append([]string{bin}, args...)...))
 		l.Clear()
 		timer()
 
-		err = syscall.Exec(bin, args, env)
+		err = util.Exec(bin, args, env)
 		return errors.Wrapf(err, "%s: failed to execute %q", pkg, bin)
 	}
 	return errors.Errorf("%s: could not find binary %q", pkg, binary)
 }
 
+// The binary of "pkg" to execute if none is specified: the one named after the package, or its only binary.
+func defaultBinary(pkg *manifest.Package, binaries []string) (string, error) {
+	names := make([]string, 0, len(binaries))
+	for _, bin := range binaries {
+		name := filepath.Base(bin)
+		if name == pkg.Reference.Name || name == pkg.Reference.Name+".exe" {
+			return name, nil
+		}
+		names = append(names, name)
+	}
+	switch len(names) {
+	case 0:
+		return "", errors.Errorf("%s: package has no binaries", pkg)
+	case 1:
+		return names[0], nil
+	default:
+		return "", errors.Errorf("%s: package has multiple binaries, select one of: %s", pkg, strings.Join(names, ", "))
+	}
+}
+
 // Resolve package reference.
 //
 // If "syncOnMissing" is true, sources will be synced if the selector cannot
@@ -852,7 +1081,7 @@ func (e *Env) ListInstalled(l *ui.UI) ([]*manifest.Package, error) {
 // only variables defined in Hermit itself will be available.
 func (e *Env) Envars(l *ui.UI, inherit bool) ([]string, error) {
 	defer ui.LogElapsed(l, "envars")()
-	pkgs, err := e.ListInstalled(l)
+	pkgs, err := e.listActive(l)
 	if err != nil {
 		return nil, err
 	}
@@ -863,16 +1092,27 @@ func (e *Env) Envars(l *ui.UI, inherit bool) ([]string, error) {
 //
 // PATH, HERMIT_BIN and HERMIT_ENV will always be explicitly set, plus all
 // environment variables defined in the packages installed in the environment,
-// and finally any environment variables explicitly configured in the environment.
+// any environment variables explicitly configured in the environment, and finally the
+// packages and environment variables of the active profiles.
 func (e *Env) EnvOps(l *ui.UI) (envars.Ops, error) {
-	pkgs, err := e.ListInstalled(l)
+	pkgs, err := e.listActive(l)
+	if err != nil {
+		return nil, err
+	}
+	profilePkgs, err := e.ProfilePackages(l)
+	if err != nil {
+		return nil, err
+	}
+	profileOps, err := e.profileEnvarOps(profilePkgs)
 	if err != nil {
 		return nil, err
 	}
 	ops := e.envarsForPackages(pkgs...)
+	ops = append(ops, e.inheritedPathEnvars()...)
 	ops = append(ops, e.hermitPathEnvar())
 	ops = append(ops, e.hermitEnvarOps()...)
 	ops = append(ops, e.localEnvarOps()...)
+	ops = append(ops, profileOps...)
 	ops = append(ops, e.ephemeralEnvars...)
 	return ops, nil
 }
@@ -880,16 +1120,16 @@ func (e *Env) EnvOps(l *ui.UI) (envars.Ops, error) {
 // SetEnv sets an extra environment variable.
 func (e *Env) SetEnv(key, value string) error {
 	e.config.Envars[key] = value
-	data, err := hcl.Marshal(e.config)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	return ioutil.WriteFile(e.configFile, data, 0600)
+	return e.writeConfig()
 }
 
 // DelEnv deletes a custom environment variable.
 func (e *Env) DelEnv(key string) error {
 	delete(e.config.Envars, key)
+	return e.writeConfig()
+}
+
+func (e *Env) writeConfig() error {
 	data, err := hcl.Marshal(e.config)
 	if err != nil {
 		return errors.WithStack(err)
@@ -897,6 +1137,22 @@ func (e *Env) DelEnv(key string) error {
 	return ioutil.WriteFile(e.configFile, data, 0600)
 }
 
+// SetTelemetry records package operations in this environment with "recorder".
+//
+// Nothing is recorded if the environment opts out of telemetry.
+func (e *Env) SetTelemetry(recorder *telemetry.Recorder) {
+	e.telemetry = recorder
+}
+
+func (e *Env) recordTelemetry(l *ui.UI, operation telemetry.Operation, pkg *manifest.Package) {
+	if e.config.NoTelemetry {
+		return
+	}
+	if err := e.telemetry.Record(telemetry.NewEvent(operation, pkg.Reference)); err != nil {
+		l.Debugf("Failed to record telemetry: %s", err)
+	}
+}
+
 // Clean parts of the hermit system.
 func (e *Env) Clean(l *ui.UI, level CleanMask) error {
 	if level&CleanBin != 0 {
@@ -985,16 +1241,114 @@ func (e *Env) BinDir() string {
 	return e.binDir
 }
 
-// upgradeVersion upgrades the package to its latest version.
+// LockPath returns the path to the environment's lock file.
+func (e *Env) LockPath() string {
+	return filepath.Join(e.binDir, lockfile.Name)
+}
+
+// Lock resolves the installed packages for each of "platforms", recording
+// their exact source and SHA256.
 //
-// If the package is already at its latest version, this is a no-op.
-func (e *Env) upgradeVersion(l *ui.UI, pkg *manifest.Package) (*shell.Changes, error) {
+// Sources without a known SHA256 are downloaded to compute it. Packages that
+// are not available for a platform are skipped on that platform.
+func (e *Env) Lock(l *ui.UI, platforms []platform.Platform) (*lockfile.Lock, error) {
+	refs, err := e.ListInstalledReferences()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	srcs, err := e.sources(l)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	lock := &lockfile.Lock{Packages: []lockfile.Entry{}}
+	for _, p := range platforms {
+		resolver, err := manifest.New(srcs, manifest.Config{
+			Env:   e.envDir,
+			State: e.state.Root(),
+			OS:    p.OS,
+			Arch:  p.Arch,
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, ref := range refs {
+			pkg, err := resolver.Resolve(l, manifest.ExactSelector(ref))
+			if errors.Is(err, manifest.ErrNoSource) {
+				l.Debugf("%s: not available on %s", ref, p)
+				continue
+			} else if err != nil {
+				return nil, errors.Wrapf(err, "%s: %s", ref, p)
+			}
+			task := l.Task(fmt.Sprintf("%s (%s)", ref, p))
+			sha256, err := e.state.Digest(task, pkg)
+			task.Done()
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s: %s", ref, p)
+			}
+			lock.Packages = append(lock.Packages, lockfile.Entry{
+				Reference: ref.String(),
+				OS:        p.OS,
+				Arch:      p.Arch,
+				Source:    pkg.Source,
+				SHA256:    sha256,
+			})
+		}
+	}
+	return lock, nil
+}
+
+// ResolveForPlatform resolves "refs" as they would be on the platform "p".
+func (e *Env) ResolveForPlatform(l *ui.UI, p platform.Platform, refs []manifest.Reference) (manifest.Packages, error) {
+	srcs, err := e.sources(l)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	resolver, err := manifest.New(srcs, manifest.Config{
+		Env:   e.envDir,
+		State: e.state.Root(),
+		OS:    p.OS,
+		Arch:  p.Arch,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	pkgs := make(manifest.Packages, 0, len(refs))
+	for _, ref := range refs {
+		pkg, err := resolver.Resolve(l, manifest.ExactSelector(ref))
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s: %s", ref, p)
+		}
+		pkgs = append(pkgs, pkg)
+	}
+	return pkgs, nil
+}
+
+// LatestVersion returns the latest version of a package with the same major version, which is what
+// Upgrade upgrades it to.
+func (e *Env) LatestVersion(l *ui.UI, pkg *manifest.Package) (*manifest.Package, error) {
 	resolver, err := e.resolver(l)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	// Get the latest version of the package
 	resolved, err := resolver.Resolve(l, manifest.PrefixSelector(pkg.Reference.Major()))
+	return resolved, errors.WithStack(err)
+}
+
+// AutoVersion returns the auto-version configuration of the package "name", or nil if it has none.
+func (e *Env) AutoVersion(l *ui.UI, name string) (*manifest.AutoVersionBlock, error) {
+	resolver, err := e.resolver(l)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return resolver.AutoVersion(l, name)
+}
+
+// upgradeVersion upgrades the package to its latest version.
+//
+// If the package is already at its latest version, this is a no-op.
+func (e *Env) upgradeVersion(l *ui.UI, pkg *manifest.Package) (*shell.Changes, error) {
+	// Get the latest version of the package
+	resolved, err := e.LatestVersion(l, pkg)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -1003,6 +1357,11 @@ func (e *Env) upgradeVersion(l *ui.UI, pkg *manifest.Package) (*shell.Changes, e
 	}
 	if !resolved.Reference.Version.Match(pkg.Reference.Version) {
 		l.Task(pkg.Reference.Name).SubTask("upgrade").Infof("Upgrading %s to %s", pkg, resolved)
+		// Before uninstalling, while the old source is still cached.
+		if err := e.state.FetchDelta(l.Task(resolved.Reference.String()), pkg, resolved); err != nil {
+			l.Task(resolved.Reference.String()).Warnf("Delta upgrade failed, downloading in full: %s", err)
+		}
+		dependent := e.recordedDependent(pkg)
 		uc, err := e.uninstall(l.Task(pkg.Reference.String()), pkg)
 		if err != nil {
 			return nil, errors.WithStack(err)
@@ -1011,6 +1370,11 @@ func (e *Env) upgradeVersion(l *ui.UI, pkg *manifest.Package) (*shell.Changes, e
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
+		e.recordTelemetry(l, telemetry.Upgrade, resolved)
+		e.recordHistory(l, HistoryUpgrade, pkg, resolved)
+		e.recordProvenance(l, resolved, state.Provenance{Reason: state.ProvenanceUpgrade, RequiredBy: dependent, Replaced: pkg.Reference.String()})
+		previous := *pkg
+		e.state.Events().EmitUpgrade(events.PackageEvent{Env: e.envDir, Package: resolved, Previous: &previous})
 		// Update the package.
 		*pkg = *resolved
 		return uc.Merge(ic), nil
@@ -1022,6 +1386,26 @@ func (e *Env) readPackageState(pkg *manifest.Package) {
 	_, err := os.Stat(e.pkgLink(pkg))
 	pkg.Linked = err == nil
 	e.state.ReadPackageState(pkg)
+	if interval, ok := e.updateInterval(pkg.Reference); ok {
+		pkg.UpdateInterval = interval
+	}
+}
+
+// The update interval configured for the channel "ref" in this environment
+// or those it inherits from, overriding the manifest's.
+func (e *Env) updateInterval(ref manifest.Reference) (time.Duration, bool) {
+	if !ref.IsChannel() {
+		return 0, false
+	}
+	for env := e; env != nil; env = env.parent {
+		for _, key := range []string{ref.String(), ref.Name} {
+			if value, ok := env.config.UpdateIntervals[key]; ok {
+				interval, _ := time.ParseDuration(value)
+				return interval, true
+			}
+		}
+	}
+	return 0, false
 }
 
 func (e *Env) referenceFromBinLink(pkgLink string) manifest.Reference {
@@ -1033,6 +1417,9 @@ func (e *Env) checkForConflicts(files []string, pkg *manifest.Package) error {
 	conflicts := []string{}
 	for _, file := range files {
 		link := filepath.Join(e.binDir, filepath.Base(file))
+		if useExeStubs {
+			link = filepath.Join(e.binDir, stubName(file))
+		}
 		if _, err := os.Lstat(link); !os.IsNotExist(err) {
 			if err != nil {
 				return errors.WithStack(err)
@@ -1053,6 +1440,9 @@ func (e *Env) linkPackage(l *ui.Task, pkg *manifest.Package) error {
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	if err := e.unlinkInherited(task, files); err != nil {
+		return err
+	}
 	err = e.checkForConflicts(files, pkg)
 	if err != nil {
 		return err
@@ -1063,16 +1453,22 @@ func (e *Env) linkPackage(l *ui.Task, pkg *manifest.Package) error {
 	task.Size(len(files) + 1)
 	defer task.Done()
 	task.Add(1)
-	err = e.linkIntoEnv(task, "hermit", pkgLink)
-	if err != nil {
-		return errors.Wrapf(err, "failed to create binary link %s", util.RelPathCWD(pkgLink))
-	}
-	for _, file := range files {
-		task.Add(1)
-		link := filepath.Join(e.binDir, filepath.Base(file))
-		err = e.linkIntoEnv(task, filepath.Base(pkgLink), link)
+	if useExeStubs {
+		if err := e.linkStubs(task, pkg, files); err != nil {
+			return err
+		}
+	} else {
+		err = e.linkIntoEnv(task, "hermit", pkgLink)
 		if err != nil {
-			return errors.Wrapf(err, "failed to create binary link %s", util.RelPathCWD(link))
+			return errors.Wrapf(err, "failed to create binary link %s", util.RelPathCWD(pkgLink))
+		}
+		for _, file := range files {
+			task.Add(1)
+			link := filepath.Join(e.binDir, filepath.Base(file))
+			err = e.linkIntoEnv(task, filepath.Base(pkgLink), link)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create binary link %s", util.RelPathCWD(link))
+			}
 		}
 	}
 	for _, app := range pkg.Apps {
@@ -1103,19 +1499,26 @@ func (e *Env) pkgLink(pkg *manifest.Package) string {
 //
 // If "inherit" is true, system envars will be included.
 func (e *Env) allEnvarsForPackages(inherit bool, runtimeDeps []*manifest.Package, pkgs ...*manifest.Package) []string {
+	transform := e.envarTransformForPackages(runtimeDeps, pkgs...)
+	if inherit {
+		return transform.Combined().System()
+	}
+	return transform.Changed(false).System()
+}
+
+// envarTransformForPackages returns the transformation of the inherited environment for the given packages.
+func (e *Env) envarTransformForPackages(runtimeDeps []*manifest.Package, pkgs ...*manifest.Package) *envars.Transform {
 	var ops envars.Ops
 	system := envars.Parse(os.Environ())
 	ops = append(ops, e.envarsForPackages(pkgs...)...)
 	ops = append(ops, e.localEnvarOps()...)
+	ops = append(ops, e.inheritedPathEnvars()...)
 	ops = append(ops, e.hermitPathEnvar())
 	ops = append(ops, e.hermitRuntimeDepOps(runtimeDeps)...)
 	ops = append(ops, e.hermitEnvarOps()...)
 	ops = append(ops, e.ephemeralEnvars...)
-	transform := system.Apply(e.Root(), ops)
-	if inherit {
-		return transform.Combined().System()
-	}
-	return transform.Changed(false).System()
+	roots := e.packageRoots(append(append([]*manifest.Package{}, runtimeDeps...), pkgs...)...)
+	return system.ApplyWithRoots(e.Root(), roots, ops)
 }
 
 func (e *Env) hermitPathEnvar() envars.Op {
@@ -1131,9 +1534,85 @@ func (e *Env) envarsForPackages(pkgs ...*manifest.Package) envars.Ops {
 	return out
 }
 
+// Roots returns the roots of the packages installed in this environment, to
+// resolve ${root:<pkg>} references in their environment variables.
+func (e *Env) Roots(l *ui.UI) (envars.Roots, error) {
+	pkgs, err := e.listActive(l)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	profilePkgs, err := e.ProfilePackages(l)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return e.packageRoots(append(pkgs, profilePkgs...)...), nil
+}
+
+// packageRoots returns the roots of "pkgs", by name and by the virtual packages they provide.
+func (e *Env) packageRoots(pkgs ...*manifest.Package) envars.Roots {
+	roots := envars.Roots{}
+	for _, pkg := range pkgs {
+		roots[pkg.Reference.Name] = pkg.Root
+	}
+	for _, pkg := range pkgs {
+		for _, virtual := range pkg.Provides {
+			if _, ok := roots[virtual]; !ok || e.SelectedProvider(virtual) == pkg.Reference.Name {
+				roots[virtual] = pkg.Root
+			}
+		}
+	}
+	return roots
+}
+
+// Refresh the links of installed packages whose environment references "pkg"
+// with ${root:<pkg>}, as it has been installed, upgraded or uninstalled.
+//
+// This recreates their stubs, and updates the bin directory so that activated
+// environments are re-evaluated.
+func (e *Env) refreshDependents(l *ui.UI, pkg *manifest.Package) error {
+	installed, err := e.ListInstalled(l)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	names := append([]string{pkg.Reference.Name}, pkg.Provides...)
+	for _, ipkg := range installed {
+		if ipkg.Reference.Name == pkg.Reference.Name || !referencesAny(ipkg, names) {
+			continue
+		}
+		task := l.Task(ipkg.Reference.String())
+		task.Debugf("Refreshing links of %s, which references %s", ipkg, pkg.Reference.Name)
+		if useExeStubs {
+			if err := e.RestoreStubs(l, ipkg); err != nil {
+				return errors.WithStack(err)
+			}
+			continue
+		}
+		pkgLink := e.pkgLink(ipkg)
+		if err := os.Remove(pkgLink); err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+		if err := os.Symlink("hermit", pkgLink); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Returns true if the environment of "pkg" references any of the packages "names".
+func referencesAny(pkg *manifest.Package, names []string) bool {
+	for _, ref := range envars.RootReferences(pkg.Env) {
+		for _, name := range names {
+			if ref == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 // localEnvarOps returns the environment variables defined in the local configuration
 func (e *Env) localEnvarOps() envars.Ops {
-	return envars.Infer(e.config.Envars.System())
+	return envars.Infer(e.configuredEnvars().System())
 }
 
 // hermitEnvarOps returns the environment variables created and required by hermit itself
@@ -1186,59 +1665,6 @@ func (e *Env) Sources(l *ui.UI) ([]string, error) {
 	return sources.Sources(), nil
 }
 
-// ResolveWithDeps collect packages and their dependencies based on the given manifest.Selector into a map
-func (e *Env) ResolveWithDeps(l *ui.UI, installed []manifest.Reference, selector manifest.Selector, out map[string]*manifest.Package) (err error) {
-	for _, existing := range installed {
-		if existing.String() == selector.Name() {
-			return nil
-		}
-	}
-	pkg, err := e.Resolve(l, selector, false)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	out[pkg.Reference.String()] = pkg
-	for _, req := range pkg.Requires {
-		// First search from virtual providers
-		ref, err := e.resolveVirtual(l, req)
-		if err != nil && errors.Is(err, manifest.ErrUnknownPackage) {
-			// Secondly search by the package name
-			if err = e.ResolveWithDeps(l, installed, manifest.NameSelector(req), out); err != nil {
-				return errors.WithStack(err)
-			}
-		} else if err != nil {
-			return errors.WithStack(err)
-		} else {
-			err = e.ResolveWithDeps(l, installed, manifest.ExactSelector(ref), out)
-			if err != nil {
-				return errors.WithStack(err)
-			}
-		}
-	}
-	return nil
-}
-
-func (e *Env) resolveVirtual(l *ui.UI, name string) (manifest.Reference, error) {
-	virtual, err := e.ResolveVirtual(l, name)
-	if err != nil {
-		return manifest.Reference{}, errors.WithStack(err)
-	}
-	installed, err := e.ListInstalledReferences()
-	if err != nil {
-		return manifest.Reference{}, errors.WithStack(err)
-	}
-	candidates := []string{}
-	for _, vpkg := range virtual {
-		candidates = append(candidates, vpkg.Reference.Name)
-		for _, ref := range installed {
-			if ref.Name == vpkg.Reference.Name {
-				return ref, nil
-			}
-		}
-	}
-	return manifest.Reference{}, errors.Errorf("multiple packages satisfy the required dependency %q, please install one of the following manually: %s", name, strings.Join(candidates, ", "))
-}
-
 func isEnvAGitRepo(env string) bool {
 	_, err := os.Stat(filepath.Join(env, ".git"))
 	return err == nil
@@ -1265,11 +1691,22 @@ func writeFileToEnvBin(l *ui.Task, useGit bool, src, envDir string, vars map[str
 	return nil
 }
 
+// EnvSourceDirs returns the directories of the environment's "env:///" manifest sources, relative to the environment.
+func (e *Env) EnvSourceDirs() []string {
+	dirs := []string{}
+	for _, uri := range e.config.Sources {
+		if u, err := url.Parse(uri); err == nil && u.Scheme == "env" && u.Path != "" {
+			dirs = append(dirs, filepath.FromSlash(strings.TrimPrefix(u.Path, "/")))
+		}
+	}
+	return dirs
+}
+
 func (e *Env) sources(l *ui.UI) (*sources.Sources, error) {
 	if e.lazySources != nil {
 		return e.lazySources, nil
 	}
-	sources, err := getSources(l, e.envDir, e.config, e.state, e.state.Config().Sources)
+	sources, err := getSources(l, e.envDir, e.sourceURIs(), e.state, e.state.Config().Sources)
 	if err != nil {
 		return nil, errors.Wrap(err, e.configFile)
 	}
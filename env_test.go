@@ -1,6 +1,8 @@
 package hermit_test
 
 import (
+	"bytes"
+	"fmt"
 	"github.com/cashapp/hermit"
 	"io/ioutil"
 	"net/http"
@@ -14,14 +16,28 @@ import (
 	bolt "go.etcd.io/bbolt"
 
 	"github.com/cashapp/hermit/envars"
+	"github.com/cashapp/hermit/events"
 	"github.com/cashapp/hermit/hermittest"
 	"github.com/cashapp/hermit/internal/dao"
+	"github.com/cashapp/hermit/lockfile"
 	"github.com/cashapp/hermit/manifest"
 	"github.com/cashapp/hermit/manifest/manifesttest"
+	"github.com/cashapp/hermit/platform"
+	"github.com/cashapp/hermit/retry"
+	"github.com/cashapp/hermit/sandbox"
+	"github.com/cashapp/hermit/sources"
+	"github.com/cashapp/hermit/state"
+	"github.com/cashapp/hermit/telemetry"
 )
 
 // Test that when installing a package that has binaries conflicting
 // with an existing package, we get an error
+func TestMain(m *testing.M) {
+	// Commands run on unpack, install and uninstall fail if they can't be sandboxed.
+	sandbox.Init()
+	os.Exit(m.Run())
+}
+
 func TestConflictingBinariesError(t *testing.T) {
 	fixture := hermittest.NewEnvTestFixture(t, nil)
 	defer fixture.Clean()
@@ -43,6 +59,64 @@ func TestConflictingBinariesError(t *testing.T) {
 	require.Errorf(t, err, "test2-1 can not be installed, the following binaries already exist: darwin_exe, linux_exe")
 }
 
+// Test that binaries are linked as .exe stubs on Windows
+func TestExeStubs(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "hermit.exe")
+	require.NoError(t, ioutil.WriteFile(source, []byte("hermit"), 0700))
+	defer hermit.UseExeStubs(source)()
+
+	fixture := hermittest.NewEnvTestFixture(t, nil).WithManifests(map[string]string{
+		"test.hcl": `
+			description = ""
+			binaries = ["darwin_exe", "linux_exe"]
+			version "1" {
+			  source = "www.example.com"
+			}
+		`,
+	})
+	defer fixture.Clean()
+	binDir := filepath.Join(fixture.EnvDirs[0], "bin")
+
+	pkg := manifesttest.NewPkgBuilder(filepath.Join(fixture.RootDir(), "test-1")).
+		WithVersion("1").
+		WithSource("archive/testdata/archive.tar.gz").
+		Result()
+	_, err := fixture.Env.Install(fixture.P, pkg)
+	require.NoError(t, err)
+
+	pkgLink, err := ioutil.ReadFile(filepath.Join(binDir, ".test-1.pkg"))
+	require.NoError(t, err)
+	require.Equal(t, "darwin_exe\nlinux_exe\n", string(pkgLink))
+	stub := filepath.Join(binDir, "linux_exe.exe")
+	data, err := ioutil.ReadFile(stub)
+	require.NoError(t, err)
+	require.Equal(t, "hermit", string(data))
+
+	require.True(t, hermit.IsExeStub(stub))
+	require.False(t, hermit.IsExeStub(filepath.Join(binDir, "hermit")))
+	envDir, err := hermit.EnvDirFromProxyLink(stub)
+	require.NoError(t, err)
+	require.Equal(t, fixture.EnvDirs[0], envDir)
+	resolved, binary, err := fixture.Env.ResolveLink(fixture.P, stub)
+	require.NoError(t, err)
+	require.Equal(t, "test-1", resolved.Reference.String())
+	require.Equal(t, filepath.Join(binDir, "linux_exe"), binary)
+
+	binaries, err := fixture.Env.LinkedBinaries(pkg)
+	require.NoError(t, err)
+	require.Equal(t, []string{filepath.Join(binDir, "darwin_exe.exe"), stub}, binaries)
+
+	// Stubs aren't committed, so are recreated by "hermit install".
+	require.NoError(t, os.Remove(stub))
+	require.NoError(t, fixture.Env.RestoreStubs(fixture.P, pkg))
+	require.FileExists(t, stub)
+
+	_, err = fixture.Env.Uninstall(fixture.P, pkg)
+	require.NoError(t, err)
+	require.NoFileExists(t, stub)
+	require.NoFileExists(t, filepath.Join(binDir, ".test-1.pkg"))
+}
+
 // Test that the update timestamp and etag are written to the DB correctly when
 // installing a package with an update interval
 func TestUpdateTimestampOnInstall(t *testing.T) {
@@ -209,8 +283,38 @@ func TestGC(t *testing.T) {
 	err = os.RemoveAll(anotherEnv.EnvDir())
 	require.NoError(t, err)
 
-	err = fixture.Env.GC(fixture.P, time.Hour)
+	// An extracted package Hermit doesn't know about, and downloads of different ages.
+	old := time.Now().Add(-2 * time.Hour)
+	orphan := filepath.Join(fixture.State.PkgDir(), "orphan-1")
+	require.NoError(t, os.MkdirAll(orphan, 0700))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(orphan, "bin"), []byte("orphan"), 0600))
+	require.NoError(t, os.Chtimes(orphan, old, old))
+	cacheDir := filepath.Join(filepath.Dir(fixture.State.PkgDir()), "cache", "ab")
+	require.NoError(t, os.MkdirAll(cacheDir, 0700))
+	staleDownload := filepath.Join(cacheDir, "ab12-stale.tar.gz")
+	require.NoError(t, ioutil.WriteFile(staleDownload, []byte("stale"), 0600))
+	require.NoError(t, os.Chtimes(staleDownload, old, old))
+	freshDownload := filepath.Join(cacheDir, "ab34-fresh.tar.gz")
+	require.NoError(t, ioutil.WriteFile(freshDownload, []byte("fresh"), 0600))
+
+	// A dry run reports what would be removed, but doesn't remove it.
+	report, err := fixture.Env.GC(fixture.P, state.GCOptions{UnusedFor: time.Hour, DryRun: true})
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{pkg2.Reference.String(), "orphan-1"}, report.Packages)
+	require.Equal(t, 1, report.Downloads)
+	require.GreaterOrEqual(t, report.Reclaimed, int64(len("orphan")+len("stale")))
+	p, err := d.GetPackage(pkg2.Reference.String())
+	require.NoError(t, err)
+	require.NotNil(t, p)
+	_, err = os.Stat(orphan)
+	require.NoError(t, err)
+	_, err = os.Stat(staleDownload)
+	require.NoError(t, err)
+
+	dryRun := report
+	report, err = fixture.Env.GC(fixture.P, state.GCOptions{UnusedFor: time.Hour})
 	require.NoError(t, err)
+	require.Equal(t, dryRun, report)
 
 	usages1, err := d.GetKnownUsages(pkg1.Reference.String())
 	require.NoError(t, err)
@@ -221,7 +325,7 @@ func TestGC(t *testing.T) {
 	require.Equal(t, 0, len(usages2))
 
 	// Test that cleared packages are also removed from the DB
-	p, err := d.GetPackage(pkg1.Reference.String())
+	p, err = d.GetPackage(pkg1.Reference.String())
 	require.NoError(t, err)
 	require.NotNil(t, p)
 	p, _ = d.GetPackage(pkg2.Reference.String())
@@ -237,6 +341,13 @@ func TestGC(t *testing.T) {
 	// Test that the package not in use was removed
 	_, err = os.Stat(filepath.Join(fixture.State.PkgDir(), pkg2.Reference.String()))
 	require.Equal(t, true, os.IsNotExist(err))
+	_, err = os.Stat(orphan)
+	require.Equal(t, true, os.IsNotExist(err))
+	// Test that only stale downloads were removed
+	_, err = os.Stat(staleDownload)
+	require.Equal(t, true, os.IsNotExist(err))
+	_, err = os.Stat(freshDownload)
+	require.NoError(t, err)
 }
 
 // Test that files referred in the Files map are copied correctly
@@ -453,6 +564,73 @@ func TestDependencyResolution(t *testing.T) {
 	require.Errorf(t, err, "multiple packages satisfy the required dependency \"virtual2\", please install one of the following manually: pkg1, pkg2")
 }
 
+func TestDependencyConflicts(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tar := TestTarGz{map[string]string{"bin1": "foo"}}
+		tar.Write(t, w)
+	})
+	f := hermittest.NewEnvTestFixture(t, handler)
+	pkg := func(requires string) string {
+		return `
+			description = ""
+			binaries = ["bin1"]
+			version "1.0.0" {
+			  source = "` + f.Server.URL + `"
+			}
+			requires = [` + requires + `]
+		`
+	}
+	f.WithManifests(map[string]string{
+		"lib.hcl": `
+			description = ""
+			binaries = ["bin1"]
+			version "1.0.0" "1.1.0" "2.0.0" {
+			  source = "` + f.Server.URL + `"
+			}
+		`,
+		"any.hcl":  pkg(`"lib"`),
+		"one.hcl":  pkg(`"lib-1*"`),
+		"old.hcl":  pkg(`"lib-1.0*"`),
+		"two.hcl":  pkg(`"lib-2*"`),
+		"both.hcl": pkg(`"one", "two"`),
+	})
+	defer f.Clean()
+
+	refs := func(pkgs []*manifest.Package) (out []string) {
+		for _, pkg := range pkgs {
+			out = append(out, pkg.Reference.String())
+		}
+		return out
+	}
+
+	graph, err := f.Env.DependencyGraph(f.P, nil, manifest.NameSelector("one"), manifest.NameSelector("any"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"lib-1.1.0", "one-1.0.0", "any-1.0.0"}, refs(graph.Uninstalled()))
+
+	// The first requirement selects lib-1.1.0, which is then retried as lib-1.0.0 to satisfy both.
+	graph, err = f.Env.DependencyGraph(f.P, nil, manifest.NameSelector("one"), manifest.NameSelector("old"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"lib-1.0.0", "one-1.0.0", "old-1.0.0"}, refs(graph.Uninstalled()))
+	dependents := map[string]string{}
+	for ref, pkg := range graph.Dependents() {
+		dependents[ref] = pkg.Reference.String()
+	}
+	require.Equal(t, map[string]string{"lib-1.0.0": "one-1.0.0"}, dependents)
+
+	_, err = f.Env.DependencyGraph(f.P, nil, manifest.NameSelector("both"))
+	require.EqualError(t, err, "conflicting requirements for lib: one-1.0.0 requires lib-1*, two-1.0.0 requires lib-2*")
+
+	_, err = f.Env.DependencyGraph(f.P, nil, manifest.MustParseGlobSelector("lib-2*"), manifest.NameSelector("one"))
+	require.EqualError(t, err, "conflicting requirements for lib: lib-2* was requested, one-1.0.0 requires lib-1*")
+
+	installed := []manifest.Reference{manifest.ParseReference("lib-2.0.0")}
+	graph, err = f.Env.DependencyGraph(f.P, installed, manifest.NameSelector("any"))
+	require.NoError(t, err)
+	require.Equal(t, []string{"any-1.0.0"}, refs(graph.Uninstalled()))
+	_, err = f.Env.DependencyGraph(f.P, installed, manifest.NameSelector("one"))
+	require.EqualError(t, err, "conflicting requirements for lib: one-1.0.0 requires lib-1*, lib-2.0.0 is installed")
+}
+
 func TestManifestValidation(t *testing.T) {
 	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/bar" {
@@ -482,3 +660,424 @@ func TestManifestValidation(t *testing.T) {
 	_, err = f.Env.ValidateManifest(f.P, "test", &hermit.ValidationOptions{CheckSources: false})
 	require.NoError(t, err)
 }
+
+func TestLock(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tar := TestTarGz{map[string]string{"bin1": "foo"}}
+		tar.Write(t, w)
+	})
+	f := hermittest.NewEnvTestFixture(t, handler)
+	f.WithManifests(map[string]string{
+		"pkg.hcl": `
+			description = ""
+			binaries = ["bin1"]
+			darwin {
+			  source = "` + f.Server.URL + `/pkg-${version}-darwin-${arch}.tar.gz"
+			}
+			linux {
+			  arch = "amd64"
+			  source = "` + f.Server.URL + `/pkg-${version}-linux.tar.gz"
+			}
+			version "1.0.0" {}
+		`,
+	})
+	defer f.Clean()
+
+	pkg, err := f.Env.Resolve(f.P, manifest.NameSelector("pkg"), false)
+	require.NoError(t, err)
+	_, err = f.Env.Install(f.P, pkg)
+	require.NoError(t, err)
+
+	lock, err := f.Env.Lock(f.P, []platform.Platform{
+		{OS: "linux", Arch: "amd64"},
+		{OS: "linux", Arch: "arm64"},
+		{OS: "darwin", Arch: "arm64"},
+	})
+	require.NoError(t, err)
+	require.Len(t, lock.Packages, 2)
+	linux, darwin := lock.Packages[0], lock.Packages[1]
+	require.Equal(t, "pkg-1.0.0", linux.Reference)
+	require.Equal(t, f.Server.URL+"/pkg-1.0.0-linux.tar.gz", linux.Source)
+	require.Equal(t, "darwin", darwin.OS)
+	require.Equal(t, f.Server.URL+"/pkg-1.0.0-darwin-arm64.tar.gz", darwin.Source)
+	require.Len(t, linux.SHA256, 64)
+	require.Equal(t, linux.SHA256, darwin.SHA256)
+
+	require.NoError(t, lock.Save(f.Env.LockPath()))
+	loaded, err := lockfile.Load(f.Env.LockPath())
+	require.NoError(t, err)
+	require.Equal(t, lock, loaded)
+}
+
+func TestCrossPackageEnvars(t *testing.T) {
+	fixture := hermittest.NewEnvTestFixture(t, nil).WithManifests(map[string]string{
+		"openjdk.hcl": `
+			description = ""
+			binaries = ["darwin_exe"]
+			provides = ["jdk"]
+			version "17" {
+			  source = "www.example.com"
+			}
+		`,
+		"maven.hcl": `
+			description = ""
+			binaries = ["linux_exe"]
+			requires = ["jdk"]
+			env = {
+			  JAVA_HOME: "${root:jdk}",
+			}
+			version "3" {
+			  source = "www.example.com"
+			}
+		`,
+	})
+	defer fixture.Clean()
+
+	jdk := manifesttest.NewPkgBuilder(filepath.Join(fixture.RootDir(), "openjdk-17")).
+		WithName("openjdk").
+		WithVersion("17").
+		WithBinaries("darwin_exe").
+		WithSource("archive/testdata/archive.tar.gz").
+		Result()
+	maven := manifesttest.NewPkgBuilder(filepath.Join(fixture.RootDir(), "maven-3")).
+		WithName("maven").
+		WithVersion("3").
+		WithBinaries("linux_exe").
+		WithSource("archive/testdata/archive.tar.gz").
+		Result()
+	_, err := fixture.Env.Install(fixture.P, maven)
+	require.NoError(t, err)
+	_, err = fixture.Env.Install(fixture.P, jdk)
+	require.NoError(t, err)
+
+	resolved, err := fixture.Env.Resolve(fixture.P, manifest.ExactSelector(jdk.Reference), false)
+	require.NoError(t, err)
+	environ, err := fixture.Env.Envars(fixture.P, false)
+	require.NoError(t, err)
+	require.Contains(t, environ, "JAVA_HOME="+resolved.Root)
+
+	_, err = fixture.Env.Uninstall(fixture.P, jdk)
+	require.NoError(t, err)
+	environ, err = fixture.Env.Envars(fixture.P, false)
+	require.NoError(t, err)
+	for _, envar := range environ {
+		require.NotContains(t, envar, "JAVA_HOME=")
+	}
+	require.FileExists(t, filepath.Join(fixture.EnvDirs[0], "bin", ".maven-3.pkg"))
+}
+
+func TestTelemetry(t *testing.T) {
+	fixture := hermittest.NewEnvTestFixture(t, nil)
+	defer fixture.Clean()
+	path := filepath.Join(fixture.RootDir(), "telemetry.jsonl")
+	fixture.Env.SetTelemetry(telemetry.New(path, "", nil))
+
+	pkg := manifesttest.NewPkgBuilder(fixture.RootDir()).
+		WithName("test").
+		WithVersion("1").
+		WithSource("archive/testdata/archive.tar.gz").
+		Result()
+	_, err := fixture.Env.Install(fixture.P, pkg)
+	require.NoError(t, err)
+	_, err = fixture.Env.Uninstall(fixture.P, pkg)
+	require.NoError(t, err)
+
+	entries, err := telemetry.ReadLog(path)
+	require.NoError(t, err)
+	events := []string{}
+	for _, entry := range entries {
+		events = append(events, fmt.Sprintf("%s %s %s", entry.Operation, entry.Package, entry.Version))
+	}
+	require.Equal(t, []string{"install test 1", "uninstall test 1"}, events)
+}
+
+func TestPackageEvents(t *testing.T) {
+	fixture := hermittest.NewEnvTestFixture(t, nil)
+	defer fixture.Clean()
+	received := []string{}
+	record := func(operation string) func(events.PackageEvent) {
+		return func(event events.PackageEvent) {
+			require.Equal(t, fixture.EnvDirs[0], event.Env)
+			received = append(received, operation+" "+event.Package.Reference.String())
+		}
+	}
+	fixture.State.Events().OnInstall(record("install"))
+	fixture.State.Events().OnUninstall(record("uninstall"))
+
+	pkg := manifesttest.NewPkgBuilder(fixture.RootDir()).
+		WithName("test").
+		WithVersion("1").
+		WithSource("archive/testdata/archive.tar.gz").
+		Result()
+	_, err := fixture.Env.Install(fixture.P, pkg)
+	require.NoError(t, err)
+	_, err = fixture.Env.Uninstall(fixture.P, pkg)
+	require.NoError(t, err)
+	require.Equal(t, []string{"install test-1", "uninstall test-1"}, received)
+}
+
+func TestTestManifest(t *testing.T) {
+	pkg := &bytes.Buffer{}
+	(&TestTarGz{map[string]string{"bin1": "foo"}}).Write(t, pkg)
+	other := &bytes.Buffer{}
+	(&TestTarGz{map[string]string{"bin2": "foo"}}).Write(t, other)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/pkg.tar.gz":
+			_, _ = w.Write(pkg.Bytes())
+		case "/other.tar.gz":
+			_, _ = w.Write(other.Bytes())
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+	f := hermittest.NewEnvTestFixture(t, handler)
+	f.WithManifests(map[string]string{
+		"test.hcl": `
+			description = ""
+			binaries = ["bin1"]
+			version "1.0.0" {
+			  linux { source = "` + f.Server.URL + `/pkg.tar.gz" }
+			  darwin {
+			    arch = "amd64"
+			    source = "` + f.Server.URL + `/missing.tar.gz"
+			  }
+			  darwin {
+			    arch = "arm64"
+			    source = "` + f.Server.URL + `/other.tar.gz"
+			  }
+			}
+		`,
+	})
+	defer f.Clean()
+
+	results, err := f.Env.TestManifest(f.P, "test")
+	require.NoError(t, err)
+	require.Len(t, results, 3)
+	linux, darwinAmd64, darwinArm64 := results[0], results[1], results[2]
+	require.NoError(t, linux.Err)
+	require.Equal(t, []string{"bin1"}, baseNames(linux.Binaries))
+	require.Error(t, darwinAmd64.Err)
+	require.Contains(t, darwinAmd64.Err.Error(), "404 Not Found")
+	require.Error(t, darwinArm64.Err)
+	require.Contains(t, darwinArm64.Err.Error(), "bin1")
+
+	// Nothing is installed into the state directory.
+	_, err = os.Stat(filepath.Join(f.State.PkgDir(), "test-1.0.0"))
+	require.True(t, os.IsNotExist(err))
+}
+
+func baseNames(paths []string) []string {
+	out := make([]string, 0, len(paths))
+	for _, path := range paths {
+		out = append(out, filepath.Base(path))
+	}
+	return out
+}
+
+func TestInheritedEnvironment(t *testing.T) {
+	fixture := hermittest.NewEnvTestFixture(t, nil)
+	defer fixture.Clean()
+	parentDir := fixture.EnvDirs[0]
+	srcDir := filepath.Join(parentDir, "sources")
+	require.NoError(t, os.MkdirAll(srcDir, 0700))
+	for name, binary := range map[string]string{"one": "darwin_exe", "two": "linux_exe"} {
+		err := os.WriteFile(filepath.Join(srcDir, name+".hcl"), []byte(`
+			description = ""
+			binaries = ["`+binary+`"]
+			env = { `+strings.ToUpper(name)+`_HOME: "${root}" }
+			source = "archive/testdata/archive.tar.gz"
+			version "1" "2" {}
+		`), 0600)
+		require.NoError(t, err)
+	}
+	err := os.WriteFile(filepath.Join(parentDir, "bin", "hermit.hcl"), []byte(`
+		sources = ["env:///sources"]
+		env = { FOO: "parent", BAR: "parent" }
+	`), 0600)
+	require.NoError(t, err)
+	parent, err := hermit.OpenEnv(parentDir, fixture.State, envars.Envars{}, fixture.Server.Client())
+	require.NoError(t, err)
+	for _, name := range []string{"one-1", "two-1"} {
+		pkg, err := parent.Resolve(fixture.P, manifest.ExactSelector(manifest.ParseReference(name)), false)
+		require.NoError(t, err)
+		_, err = parent.Install(fixture.P, pkg)
+		require.NoError(t, err)
+	}
+
+	childDir := filepath.Join(parentDir, "child")
+	require.NoError(t, os.Mkdir(childDir, 0700))
+	err = hermit.Init(fixture.P, childDir, "", fixture.State.Root(), hermit.Config{Inherit: "..", Envars: envars.Envars{"BAR": "child"}})
+	require.NoError(t, err)
+	child, err := hermit.OpenEnv(childDir, fixture.State, envars.Envars{}, fixture.Server.Client())
+	require.NoError(t, err)
+
+	// The child overrides the parent's "two" with its own version.
+	two, err := child.Resolve(fixture.P, manifest.ExactSelector(manifest.ParseReference("two-2")), false)
+	require.NoError(t, err)
+	_, err = child.Install(fixture.P, two)
+	require.NoError(t, err)
+
+	inherited, err := child.Inherited(fixture.P)
+	require.NoError(t, err)
+	require.Len(t, inherited, 1)
+	require.Equal(t, "one-1", inherited[0].Reference.String())
+
+	environ, err := child.Envars(fixture.P, false)
+	require.NoError(t, err)
+	require.Contains(t, environ, "FOO=parent")
+	require.Contains(t, environ, "BAR=child")
+	require.Contains(t, environ, "ONE_HOME="+inherited[0].Root)
+	require.Contains(t, environ, "TWO_HOME="+two.Root)
+
+	require.NoError(t, child.LinkInherited(fixture.P))
+	link, err := os.Readlink(filepath.Join(childDir, "bin", "darwin_exe"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join("..", "..", "bin", "darwin_exe"), link)
+	link, err = os.Readlink(filepath.Join(childDir, "bin", "linux_exe"))
+	require.NoError(t, err)
+	require.Equal(t, ".two-2.pkg", link)
+
+	// Uninstalling the override restores the inherited package.
+	_, err = child.Uninstall(fixture.P, two)
+	require.NoError(t, err)
+	link, err = os.Readlink(filepath.Join(childDir, "bin", "linux_exe"))
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join("..", "..", "bin", "linux_exe"), link)
+
+	// Inheritance cycles are detected.
+	err = os.WriteFile(filepath.Join(parentDir, "bin", "hermit.hcl"), []byte(`inherit = "child"`), 0600)
+	require.NoError(t, err)
+	_, err = hermit.OpenEnv(childDir, fixture.State, envars.Envars{}, fixture.Server.Client())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "creates a cycle")
+}
+
+func TestUpdateIntervals(t *testing.T) {
+	fixture := hermittest.NewEnvTestFixture(t, nil)
+	defer fixture.Clean()
+	envDir := fixture.EnvDirs[0]
+	srcDir := filepath.Join(envDir, "sources")
+	require.NoError(t, os.MkdirAll(srcDir, 0700))
+	for _, name := range []string{"one", "two"} {
+		err := os.WriteFile(filepath.Join(srcDir, name+".hcl"), []byte(`
+			description = ""
+			binaries = ["bin"]
+			source = "archive/testdata/archive.tar.gz"
+			version "1.0.0" {}
+			channel "stable" {
+			  update = "1h"
+			  version = "1.*"
+			}
+		`), 0600)
+		require.NoError(t, err)
+	}
+	configFile := filepath.Join(envDir, "bin", "hermit.hcl")
+	err := os.WriteFile(configFile, []byte(`
+		sources = ["env:///sources"]
+		update-intervals = { "one": "168h", "two@latest": "0s" }
+	`), 0600)
+	require.NoError(t, err)
+	env, err := hermit.OpenEnv(envDir, fixture.State, envars.Envars{}, fixture.Server.Client())
+	require.NoError(t, err)
+
+	for ref, expected := range map[string]time.Duration{
+		"one@stable": time.Hour * 168,
+		"one@latest": time.Hour * 168,
+		"two@stable": time.Hour,
+		"two@latest": 0,
+		"two@1":      time.Hour * 24,
+	} {
+		pkg, err := env.Resolve(fixture.P, manifest.ExactSelector(manifest.ParseReference(ref)), false)
+		require.NoError(t, err)
+		require.Equal(t, expected, pkg.UpdateInterval, ref)
+	}
+
+	err = os.WriteFile(configFile, []byte(`update-intervals = { "one": "weekly" }`), 0600)
+	require.NoError(t, err)
+	_, err = hermit.OpenEnv(envDir, fixture.State, envars.Envars{}, fixture.Server.Client())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "update-intervals: one")
+}
+
+func TestProfiles(t *testing.T) {
+	fixture := hermittest.NewEnvTestFixture(t, nil)
+	defer fixture.Clean()
+	envDir := fixture.EnvDirs[0]
+	err := os.WriteFile(filepath.Join(envDir, "bin", "hermit.hcl"), []byte(`
+		profile "ci" {
+		  packages = ["lint"]
+		  env = { CI_MODE: "1" }
+		}
+	`), 0600)
+	require.NoError(t, err)
+	env, err := hermit.OpenEnv(envDir, fixture.State, envars.Envars{}, fixture.Server.Client())
+	require.NoError(t, err)
+	err = env.AddSource(fixture.P, sources.NewMemSource("lint.hcl", `
+		description = ""
+		binaries = ["linux_exe"]
+		env = { LINT_HOME: "${root}" }
+		source = "archive/testdata/archive.tar.gz"
+		version "1.2.0" {}
+	`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"ci"}, env.Profiles())
+
+	// Without an active profile, its packages are unavailable.
+	ops, err := env.EnvOps(fixture.P)
+	require.NoError(t, err)
+	environ := envars.Parse(nil).Apply(env.Root(), ops).Combined()
+	require.NotContains(t, environ, "CI_MODE")
+
+	require.Equal(t, []string{"frontend"}, env.SetProfiles([]string{"ci", "frontend"}))
+	require.NoError(t, env.EnsureProfilePackages(fixture.P))
+	pkgs, err := env.ProfilePackages(fixture.P)
+	require.NoError(t, err)
+	require.Len(t, pkgs, 1)
+	require.Equal(t, "lint-1.2.0", pkgs[0].Reference.String())
+
+	ops, err = env.EnvOps(fixture.P)
+	require.NoError(t, err)
+	environ = envars.Parse(nil).Apply(env.Root(), ops).Combined()
+	require.Equal(t, "1", environ["CI_MODE"])
+	require.Equal(t, "ci", environ["HERMIT_PROFILES"])
+	require.Equal(t, pkgs[0].Root, environ["LINT_HOME"])
+	require.True(t, strings.HasPrefix(environ["PATH"], pkgs[0].Root+string(os.PathListSeparator)))
+
+	// Profile packages aren't installed into the environment.
+	installed, err := env.ListInstalledReferences()
+	require.NoError(t, err)
+	require.Empty(t, installed)
+}
+
+func TestRetryPolicy(t *testing.T) {
+	fixture := hermittest.NewEnvTestFixture(t, nil)
+	defer fixture.Clean()
+	envDir := fixture.EnvDirs[0]
+	configFile := filepath.Join(envDir, "bin", "hermit.hcl")
+	err := os.WriteFile(configFile, []byte(`
+		retry {
+		  attempts = 5
+		  max-backoff = "30s"
+		  status-codes = [503]
+		}
+	`), 0600)
+	require.NoError(t, err)
+	env, err := hermit.OpenEnv(envDir, fixture.State, envars.Envars{}, fixture.Server.Client())
+	require.NoError(t, err)
+	policy, err := env.RetryPolicy(retry.DefaultPolicy)
+	require.NoError(t, err)
+	require.Equal(t, retry.Policy{
+		Attempts:    5,
+		MinBackoff:  retry.DefaultPolicy.MinBackoff,
+		MaxBackoff:  30 * time.Second,
+		StatusCodes: []int{503},
+	}, policy)
+
+	err = os.WriteFile(configFile, []byte(`retry { max-backoff = "1ms" }`), 0600)
+	require.NoError(t, err)
+	env, err = hermit.OpenEnv(envDir, fixture.State, envars.Envars{}, fixture.Server.Client())
+	require.NoError(t, err)
+	_, err = env.RetryPolicy(retry.DefaultPolicy)
+	require.EqualError(t, err, "retry: min backoff 500ms is greater than max backoff 1ms")
+}
@@ -3,7 +3,9 @@ package envars
 import (
 	"fmt"
 	"hash/fnv"
+	"os"
 	"reflect"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -32,11 +34,24 @@ func (e Envars) System() []string {
 	return out
 }
 
+// Roots maps the names of packages to the directories they are installed in.
+//
+// It resolves ${root:<pkg>} references, which let a package's environment
+// refer to another package, eg. JAVA_HOME="${root:openjdk}". References to
+// packages that are not in Roots expand to "".
+type Roots map[string]string
+
 // Apply ops to these Envars and return the resulting Transform.
 //
 // Envars are not modified.
 func (e Envars) Apply(envRoot string, ops Ops) *Transform {
+	return e.ApplyWithRoots(envRoot, nil, ops)
+}
+
+// ApplyWithRoots applies ops to these Envars like Apply, resolving ${root:<pkg>} references with roots.
+func (e Envars) ApplyWithRoots(envRoot string, roots Roots, ops Ops) *Transform {
 	transform := transform(envRoot, e)
+	transform.roots = roots
 	for _, op := range ops {
 		op.Apply(transform)
 	}
@@ -47,13 +62,51 @@ func (e Envars) Apply(envRoot string, ops Ops) *Transform {
 //
 // Envars are not modified.
 func (e Envars) Revert(envRoot string, ops Ops) *Transform {
+	return e.RevertWithRoots(envRoot, nil, ops)
+}
+
+// RevertWithRoots reverts ops like Revert, resolving ${root:<pkg>} references with roots.
+func (e Envars) RevertWithRoots(envRoot string, roots Roots, ops Ops) *Transform {
 	transform := transform(envRoot, e)
+	transform.roots = roots
 	for i := len(ops) - 1; i >= 0; i-- {
 		ops[i].Revert(transform)
 	}
 	return transform
 }
 
+var rootReferenceRe = regexp.MustCompile(`\$\{root:([^}]+)\}`)
+
+// RootReferences returns the names of the packages referenced by ${root:<pkg>} in ops.
+func RootReferences(ops Ops) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, op := range ops {
+		var value string
+		switch op := op.(type) {
+		case *Append:
+			value = op.Value
+		case *Prepend:
+			value = op.Value
+		case *Prefix:
+			value = op.Prefix
+		case *Set:
+			value = op.Value
+		case *Force:
+			value = op.Value
+		case *Unset:
+			continue
+		}
+		for _, match := range rootReferenceRe.FindAllStringSubmatch(value, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				out = append(out, match[1])
+			}
+		}
+	}
+	return out
+}
+
 // go:sumtype decl Op
 
 // Op is an operation on an environment variable.
@@ -76,6 +129,8 @@ type Ops []Op
 // Infer uses simple heuristics to build a sequence of transformations for environment variables.
 //
 // Currently this consists of detecting prepend/append to :-separated lists, set and unset.
+// The elements prepended or appended are converted to the list and path separators of
+// this platform.
 func Infer(env []string) Ops {
 	ops := make(Ops, 0, len(env))
 	for _, envar := range env {
@@ -88,13 +143,13 @@ func Infer(env []string) Ops {
 			insertion := value[strings.Index(value, ":")+1:]
 			op = &Append{
 				Name:  key,
-				Value: insertion,
+				Value: nativeList(insertion),
 			}
 		case strings.HasSuffix(value, ":${"+key+"}") || strings.HasSuffix(value, ":$"+key): // Prepend
 			insertion := value[:strings.LastIndex(value, ":")]
 			op = &Prepend{
 				Name:  key,
-				Value: insertion,
+				Value: nativeList(insertion),
 			}
 
 		case value == "":
@@ -132,14 +187,14 @@ func (e *Append) Apply(transform *Transform) { // nolint: golint
 	value, _ := transform.get(e.Name)
 	out := splitAndDrop(value, e.Value)
 	out = append(out, e.Value)
-	transform.set(e.Name, strings.Join(out, ":"))
+	transform.set(e.Name, strings.Join(out, listSeparator))
 	return
 }
 
 func (e *Append) Revert(transform *Transform) { // nolint: golint
 	value, _ := transform.get(e.Name)
 	out := splitAndDrop(value, e.Value)
-	transform.set(e.Name, strings.Join(out, ":"))
+	transform.set(e.Name, strings.Join(out, listSeparator))
 	return
 }
 
@@ -159,14 +214,14 @@ func (e *Prepend) Apply(transform *Transform) { // nolint: golint
 	prepend := transform.expand(e.Value)
 	out := splitAndDrop(value, prepend)
 	out = append([]string{prepend}, out...)
-	transform.set(e.Name, strings.Join(out, ":"))
+	transform.set(e.Name, strings.Join(out, listSeparator))
 	return
 }
 func (e *Prepend) Revert(transform *Transform) { // nolint: golint
 	value, _ := transform.get(e.Name)
 	prepend := transform.expand(e.Value)
 	out := splitAndDrop(value, prepend)
-	transform.set(e.Name, strings.Join(out, ":"))
+	transform.set(e.Name, strings.Join(out, listSeparator))
 	return
 }
 
@@ -272,10 +327,47 @@ func (f *Force) Revert(transform *Transform) { // nolint: golint
 	return
 }
 
-// Split "envar" by ":" and drop "value" from it.
+// Separators for list variables such as PATH, and for the elements of a path, on this platform.
+//
+// Lists in manifests and configuration always use ":" and "/", which Infer
+// converts with nativeList.
+var (
+	listSeparator = string(os.PathListSeparator)
+	pathSeparator = string(os.PathSeparator)
+)
+
+// Convert a :-separated list of /-separated paths, as written in manifests, to
+// the conventions of this platform, eg. ";" and "\" on Windows.
+//
+// This must be applied before variable expansion, as expanded values are
+// already native and may contain ":", such as in C:\. Likewise, it is not
+// applied to ops created with native paths. ${...} references are left as is.
+func nativeList(value string) string {
+	if listSeparator == ":" && pathSeparator == "/" {
+		return value
+	}
+	replacer := strings.NewReplacer(":", listSeparator, "/", pathSeparator)
+	out := strings.Builder{}
+	for {
+		start := strings.Index(value, "${")
+		end := -1
+		if start != -1 {
+			end = closingBrace(value, start+2)
+		}
+		if end == -1 {
+			out.WriteString(replacer.Replace(value))
+			return out.String()
+		}
+		out.WriteString(replacer.Replace(value[:start]))
+		out.WriteString(value[start : end+1])
+		value = value[end+1:]
+	}
+}
+
+// Split "envar" by the list separator and drop "value" from it.
 func splitAndDrop(envar string, value string) []string {
-	parts := strings.Split(envar, ":")
-	values := strings.Split(value, ":")
+	parts := strings.Split(envar, listSeparator)
+	values := strings.Split(value, listSeparator)
 	out := make([]string, 0, len(parts))
 skip:
 	for _, elem := range parts {
@@ -116,3 +116,38 @@ func TestIssue47(t *testing.T) {
 	reverted := expected.Revert("/home/user/project", ops).Combined()
 	require.Equal(t, original, reverted)
 }
+
+func TestInferNativeLists(t *testing.T) {
+	oldList, oldPath := listSeparator, pathSeparator
+	listSeparator, pathSeparator = ";", `\`
+	defer func() { listSeparator, pathSeparator = oldList, oldPath }()
+
+	ops := Infer([]string{
+		"PATH=${HERMIT_ENV}/node_modules/.bin:${HERMIT_ENV}/bin:${PATH}",
+		"LD_LIBRARY_PATH=${LD_LIBRARY_PATH}:${LIB_DIR:-/usr/lib}/x",
+	})
+	require.Equal(t, Ops{
+		&Prepend{Name: "PATH", Value: `${HERMIT_ENV}\node_modules\.bin;${HERMIT_ENV}\bin`},
+		&Append{Name: "LD_LIBRARY_PATH", Value: `${LIB_DIR:-/usr/lib}\x`},
+	}, ops)
+
+	tr := transform("", Envars{"HERMIT_ENV": `C:\env`, "PATH": `C:\Windows;C:\env\bin`})
+	ops[0].Apply(tr)
+	require.Equal(t, `C:\env\node_modules\.bin;C:\env\bin;C:\Windows`, tr.Combined()["PATH"])
+}
+
+func TestRootReferences(t *testing.T) {
+	original := Envars{"JAVA_HOME": "/usr/lib/jvm", "PATH": "/bin"}
+	ops := Infer([]string{"JAVA_HOME=${root:jdk}", "PATH=${root:jdk}/bin:${PATH}", "MAVEN_OPTS=-Xmx1g"})
+	require.Equal(t, []string{"jdk"}, RootReferences(ops))
+
+	roots := Roots{"jdk": "/hermit/pkg/openjdk-17"}
+	actual := original.ApplyWithRoots("", roots, ops).Combined()
+	require.Equal(t, "/hermit/pkg/openjdk-17", actual["JAVA_HOME"])
+	require.Equal(t, "/hermit/pkg/openjdk-17/bin:/bin", actual["PATH"])
+	require.Equal(t, original, actual.RevertWithRoots("", roots, ops).Combined())
+
+	// References to unknown packages expand to nothing.
+	actual = Envars{}.Apply("", ops[:1]).Combined()
+	require.Equal(t, Envars{}, actual)
+}
@@ -0,0 +1,190 @@
+package envars
+
+import (
+	"os"
+	"runtime"
+	"strings"
+
+	"github.com/cashapp/hermit/platform"
+)
+
+// Functions available in ${<name>:<arg>,<arg>,...} references.
+//
+// Arguments are expanded before the function is called.
+var templateFuncs = map[string]func(args []string) string{
+	// ${join:<sep>,<value>,...} joins the non-empty values with <sep>, which may not be a comma.
+	"join": func(args []string) string {
+		if len(args) == 0 {
+			return ""
+		}
+		return strings.Join(nonEmpty(args[1:]), args[0])
+	},
+	// ${path:<list>,...} joins the non-empty elements of lists separated by the
+	// platform's list separator, dropping duplicates.
+	"path": func(args []string) string {
+		seen := map[string]bool{}
+		out := []string{}
+		for _, arg := range args {
+			for _, elem := range strings.Split(arg, listSeparator) {
+				if elem == "" || seen[elem] {
+					continue
+				}
+				seen[elem] = true
+				out = append(out, elem)
+			}
+		}
+		return strings.Join(out, listSeparator)
+	},
+}
+
+// Expand ${X} references in value, along with the template extensions
+// below. $X references are expanded as by os.Expand.
+//
+//	${os}, ${arch}, ${xarch}  The host platform, as in manifests.
+//	${root:<pkg>}             The root of the package <pkg>, see Roots.
+//	${X:-default}             X if it is set and non-empty, otherwise default.
+//	${X:+value}               value if X is set and non-empty, otherwise empty.
+//	${if:<cond>,<a>[,<b>]}    a if cond is true, otherwise b. cond is either <x>==<y>, <x>!=<y>, or
+//	                          true if non-empty.
+//	${<func>:<arg>,...}       The result of one of the templateFuncs.
+//
+// References may be nested, eg. ${path:${HERMIT_ENV}/lib,${LD_LIBRARY_PATH}}.
+func expandTemplate(value string, lookup func(string) string) string {
+	out := strings.Builder{}
+	for {
+		start := strings.Index(value, "${")
+		if start == -1 {
+			out.WriteString(os.Expand(value, lookup))
+			return out.String()
+		}
+		out.WriteString(os.Expand(value[:start], lookup))
+		end := closingBrace(value, start+2)
+		if end == -1 {
+			// Unterminated, leave it as is.
+			out.WriteString(value[start:])
+			return out.String()
+		}
+		out.WriteString(evalTemplate(value[start+2:end], lookup))
+		value = value[end+1:]
+	}
+}
+
+// Evaluate the contents of a ${...} reference.
+func evalTemplate(expr string, lookup func(string) string) string {
+	if colon := strings.Index(expr, ":"); colon != -1 {
+		name, rest := expr[:colon], expr[colon+1:]
+		if name == "if" {
+			return evalIf(splitArgs(rest), lookup)
+		}
+		if fn, ok := templateFuncs[name]; ok {
+			args := splitArgs(rest)
+			for i, arg := range args {
+				args[i] = expandTemplate(arg, lookup)
+			}
+			return fn(args)
+		}
+		switch {
+		case strings.HasPrefix(rest, "-"):
+			if v := lookup(name); v != "" {
+				return v
+			}
+			return expandTemplate(rest[1:], lookup)
+		case strings.HasPrefix(rest, "+"):
+			if lookup(name) == "" {
+				return ""
+			}
+			return expandTemplate(rest[1:], lookup)
+		}
+	}
+	switch expr {
+	case "os":
+		return runtime.GOOS
+	case "arch":
+		return runtime.GOARCH
+	case "xarch":
+		if xarch := platform.ArchToXArch(runtime.GOARCH); xarch != "" {
+			return xarch
+		}
+		return runtime.GOARCH
+	}
+	return lookup(expr)
+}
+
+func evalIf(args []string, lookup func(string) string) string {
+	if len(args) < 2 {
+		return ""
+	}
+	var cond bool
+	if lhs, rhs, ok := cut(args[0], "=="); ok {
+		cond = expandTemplate(lhs, lookup) == expandTemplate(rhs, lookup)
+	} else if lhs, rhs, ok := cut(args[0], "!="); ok {
+		cond = expandTemplate(lhs, lookup) != expandTemplate(rhs, lookup)
+	} else {
+		cond = expandTemplate(args[0], lookup) != ""
+	}
+	if cond {
+		return expandTemplate(args[1], lookup)
+	}
+	if len(args) > 2 {
+		return expandTemplate(args[2], lookup)
+	}
+	return ""
+}
+
+// Split s at sep, outside of any nested ${...} reference.
+func cut(s, sep string) (string, string, bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "${"):
+			depth++
+			i++
+		case s[i] == '}' && depth > 0:
+			depth--
+		case depth == 0 && strings.HasPrefix(s[i:], sep):
+			return s[:i], s[i+len(sep):], true
+		}
+	}
+	return s, "", false
+}
+
+// Split function arguments at commas outside of any nested ${...} reference.
+func splitArgs(s string) []string {
+	args := []string{}
+	for {
+		arg, rest, ok := cut(s, ",")
+		args = append(args, arg)
+		if !ok {
+			return args
+		}
+		s = rest
+	}
+}
+
+// Returns the index of the "}" closing a reference whose contents start at "start", or -1.
+func closingBrace(s string, start int) int {
+	depth := 1
+	for i := start; i < len(s); i++ {
+		switch {
+		case strings.HasPrefix(s[i:], "${"):
+			depth++
+			i++
+		case s[i] == '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func nonEmpty(values []string) []string {
+	out := make([]string, 0, len(values))
+	for _, value := range values {
+		if value != "" {
+			out = append(out, value)
+		}
+	}
+	return out
+}
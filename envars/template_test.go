@@ -0,0 +1,40 @@
+package envars
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestExpandTemplate(t *testing.T) {
+	env := Envars{"HERMIT_ENV": "/project", "PATH": "/bin:/usr/bin", "EMPTY": ""}
+	tests := []struct {
+		value    string
+		expected string
+	}{
+		{"${HERMIT_ENV}/bin:$PATH", "/project/bin:/bin:/usr/bin"},
+		{"${MISSING}", ""},
+		{"${os}-${arch}", runtime.GOOS + "-" + runtime.GOARCH},
+		{"${MISSING:-${HERMIT_ENV}/default}", "/project/default"},
+		{"${EMPTY:-default}", "default"},
+		{"${HERMIT_ENV:-default}", "/project"},
+		{"${HERMIT_ENV:+set}", "set"},
+		{"${MISSING:+set}", ""},
+		{"${join:-,a,,b}", "a-b"},
+		{"${join: ,${HERMIT_ENV},${MISSING},c}", "/project c"},
+		{"${path:${HERMIT_ENV}/lib,${LD_LIBRARY_PATH}}", "/project/lib"},
+		{"${path:/usr/bin,${PATH}}", "/usr/bin:/bin"},
+		{"${if:${os}==" + runtime.GOOS + ",yes,no}", "yes"},
+		{"${if:${os}!=" + runtime.GOOS + ",yes,no}", "no"},
+		{"${if:${MISSING},yes}", ""},
+		{"${if:${HERMIT_ENV},${join:/,${HERMIT_ENV},lib}}", "/project/lib"},
+		{"${unterminated", "${unterminated"},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			actual := expandTemplate(test.value, func(s string) string { return env[s] })
+			require.Equal(t, test.expected, actual)
+		})
+	}
+}
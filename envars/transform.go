@@ -1,7 +1,6 @@
 package envars
 
 import (
-	"os"
 	"strings"
 )
 
@@ -10,6 +9,7 @@ type Transform struct {
 	seed    Envars
 	dest    Envars
 	envRoot string
+	roots   Roots
 }
 
 // Changed returns the set of changed Envars.
@@ -68,8 +68,12 @@ func (t *Transform) unset(key string) {
 	t.dest[key] = ""
 }
 
+// Expand variable references and templates in value, see expandTemplate.
 func (t *Transform) expand(value string) string {
-	return os.Expand(value, func(s string) string {
+	return expandTemplate(value, func(s string) string {
+		if pkg := strings.TrimPrefix(s, "root:"); pkg != s {
+			return t.roots[pkg]
+		}
 		v, _ := t.get(s)
 		return v
 	})
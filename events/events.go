@@ -0,0 +1,115 @@
+// Package events lets applications embedding Hermit react to package
+// operations, eg. for auditing, caching or their own UI.
+package events
+
+import (
+	"sync"
+
+	"github.com/cashapp/hermit/manifest"
+)
+
+// PackageEvent describes a package installed, upgraded or uninstalled in an environment.
+type PackageEvent struct {
+	// Env is the root directory of the environment.
+	Env     string
+	Package *manifest.Package
+	// Previous is the package an upgrade replaced, and nil for other operations.
+	Previous *manifest.Package
+}
+
+// DownloadProgress reports the progress of a package source download.
+type DownloadProgress struct {
+	URL        string
+	Downloaded int64
+	// Total size of the download, or -1 if unknown.
+	Total int64
+}
+
+// Bus dispatches events to the handlers registered with it.
+//
+// Handlers are called synchronously, in the order they were registered, from
+// the goroutine performing the operation, so they should return promptly.
+// Events are only delivered once an operation has succeeded.
+//
+// The Emit methods may be called on a nil Bus, in which case events are dropped.
+type Bus struct {
+	lock      sync.RWMutex
+	install   []func(PackageEvent)
+	upgrade   []func(PackageEvent)
+	uninstall []func(PackageEvent)
+	progress  []func(DownloadProgress)
+}
+
+// New creates a Bus with no handlers.
+func New() *Bus {
+	return &Bus{}
+}
+
+// OnInstall registers a handler called after a package is installed.
+func (b *Bus) OnInstall(handler func(PackageEvent)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.install = append(b.install, handler)
+}
+
+// OnUpgrade registers a handler called after a package is upgraded to a new version.
+func (b *Bus) OnUpgrade(handler func(PackageEvent)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.upgrade = append(b.upgrade, handler)
+}
+
+// OnUninstall registers a handler called after a package is uninstalled.
+func (b *Bus) OnUninstall(handler func(PackageEvent)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.uninstall = append(b.uninstall, handler)
+}
+
+// OnDownloadProgress registers a handler called as package sources are downloaded.
+func (b *Bus) OnDownloadProgress(handler func(DownloadProgress)) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.progress = append(b.progress, handler)
+}
+
+// EmitInstall delivers an install event to the OnInstall handlers.
+func (b *Bus) EmitInstall(event PackageEvent) {
+	b.emit(func() []func(PackageEvent) { return b.install }, event)
+}
+
+// EmitUpgrade delivers an upgrade event to the OnUpgrade handlers.
+func (b *Bus) EmitUpgrade(event PackageEvent) {
+	b.emit(func() []func(PackageEvent) { return b.upgrade }, event)
+}
+
+// EmitUninstall delivers an uninstall event to the OnUninstall handlers.
+func (b *Bus) EmitUninstall(event PackageEvent) {
+	b.emit(func() []func(PackageEvent) { return b.uninstall }, event)
+}
+
+// EmitDownloadProgress delivers download progress to the OnDownloadProgress handlers.
+func (b *Bus) EmitDownloadProgress(progress DownloadProgress) {
+	if b == nil {
+		return
+	}
+	b.lock.RLock()
+	handlers := b.progress
+	b.lock.RUnlock()
+	for _, handler := range handlers {
+		handler(progress)
+	}
+}
+
+// Call the handlers returned by "list" without holding the lock, so that they may register further handlers.
+func (b *Bus) emit(list func() []func(PackageEvent), event PackageEvent) {
+	if b == nil {
+		return
+	}
+	b.lock.RLock()
+	handlers := list()
+	b.lock.RUnlock()
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
@@ -0,0 +1,50 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/manifest"
+)
+
+func TestBus(t *testing.T) {
+	bus := New()
+	received := []string{}
+	record := func(prefix string) func(PackageEvent) {
+		return func(event PackageEvent) {
+			received = append(received, prefix+" "+event.Package.Reference.String())
+		}
+	}
+	bus.OnInstall(record("install1"))
+	bus.OnInstall(record("install2"))
+	bus.OnUpgrade(func(event PackageEvent) {
+		received = append(received, "upgrade "+event.Previous.Reference.String()+" -> "+event.Package.Reference.String())
+	})
+	bus.OnUninstall(record("uninstall"))
+	bus.OnDownloadProgress(func(progress DownloadProgress) {
+		received = append(received, "progress "+progress.URL)
+	})
+
+	v1 := &manifest.Package{Reference: manifest.ParseReference("test-1")}
+	v2 := &manifest.Package{Reference: manifest.ParseReference("test-2")}
+	bus.EmitInstall(PackageEvent{Package: v1})
+	bus.EmitUpgrade(PackageEvent{Package: v2, Previous: v1})
+	bus.EmitUninstall(PackageEvent{Package: v2})
+	bus.EmitDownloadProgress(DownloadProgress{URL: "https://example.com/test.tgz", Downloaded: 1, Total: -1})
+	require.Equal(t, []string{
+		"install1 test-1",
+		"install2 test-1",
+		"upgrade test-1 -> test-2",
+		"uninstall test-2",
+		"progress https://example.com/test.tgz",
+	}, received)
+}
+
+func TestNilBus(t *testing.T) {
+	var bus *Bus
+	bus.EmitInstall(PackageEvent{})
+	bus.EmitUpgrade(PackageEvent{})
+	bus.EmitUninstall(PackageEvent{})
+	bus.EmitDownloadProgress(DownloadProgress{})
+}
@@ -0,0 +1,18 @@
+package hermit
+
+import (
+	"github.com/cashapp/hermit/manifest"
+)
+
+// UseExeStubs links binaries as .exe stubs of "source", as on Windows, until the returned function is called.
+func UseExeStubs(source string) (restore func()) {
+	oldUse, oldSource := useExeStubs, stubSource
+	useExeStubs = true
+	stubSource = func() (string, error) { return source, nil }
+	return func() { useExeStubs, stubSource = oldUse, oldSource }
+}
+
+// WriteExecSnapshot records an exec snapshot as Exec does before executing "binary".
+func (e *Env) WriteExecSnapshot(link, binary string, env []string, pkgs ...*manifest.Package) error {
+	return e.writeExecSnapshot(link, binary, env, pkgs)
+}
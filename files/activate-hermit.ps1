@@ -0,0 +1,8 @@
+# This file must be run from PowerShell with "bin\activate-hermit.ps1".
+
+$HermitScript = Join-Path $PSScriptRoot hermit.ps1
+& $HermitScript noop | Out-Null
+if ($LASTEXITCODE -eq 0) {
+  & $HermitScript activate (Split-Path -Parent $PSScriptRoot) | Out-String | Invoke-Expression
+  Write-Host "Hermit environment $(& (Join-Path $env:HERMIT_ENV bin/hermit.ps1) env HERMIT_ENV) activated"
+}
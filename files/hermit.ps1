@@ -0,0 +1,44 @@
+# Hermit bootstrap script for PowerShell, the equivalent of bin/hermit.
+
+$ErrorActionPreference = "Stop"
+
+# PowerShell Core on Linux and macOS can use the regular script.
+if ($PSVersionTable.PSEdition -eq "Core" -and -not $IsWindows) {
+  & (Join-Path $PSScriptRoot hermit) @args
+  exit $LASTEXITCODE
+}
+
+if (-not $env:HERMIT_STATE_DIR) {
+  $env:HERMIT_STATE_DIR = Join-Path $env:LOCALAPPDATA hermit
+}
+
+if (-not $env:HERMIT_DIST_URL) {
+  $env:HERMIT_DIST_URL = "HERMIT_DEFAULT_DIST_URL"
+}
+$env:HERMIT_CHANNEL = Split-Path -Leaf $env:HERMIT_DIST_URL
+if (-not $env:HERMIT_EXE) {
+  $env:HERMIT_EXE = Join-Path $env:HERMIT_STATE_DIR "pkg\hermit@$($env:HERMIT_CHANNEL)\hermit.exe"
+}
+
+if (-not (Test-Path $env:HERMIT_EXE)) {
+  $arch = if ($env:PROCESSOR_ARCHITECTURE -eq "ARM64") { "arm64" } else { "amd64" }
+  $url = "$($env:HERMIT_DIST_URL)/hermit-windows-$arch.gz"
+  [Console]::Error.WriteLine("Bootstrapping $($env:HERMIT_EXE) from $url")
+  New-Item -ItemType Directory -Force -Path (Split-Path -Parent $env:HERMIT_EXE) | Out-Null
+  $tmp = "$($env:HERMIT_EXE).download"
+  Invoke-WebRequest -UseBasicParsing -Uri $url -OutFile "$tmp.gz"
+  $in = [IO.File]::OpenRead("$tmp.gz")
+  $out = [IO.File]::Create($tmp)
+  try {
+    $gzip = New-Object IO.Compression.GZipStream($in, [IO.Compression.CompressionMode]::Decompress)
+    $gzip.CopyTo($out)
+  } finally {
+    $out.Close()
+    $in.Close()
+  }
+  Remove-Item "$tmp.gz"
+  Move-Item -Force $tmp $env:HERMIT_EXE
+}
+
+& $env:HERMIT_EXE --level=fatal exec (Join-Path $PSScriptRoot hermit) -- @args
+exit $LASTEXITCODE
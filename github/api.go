@@ -3,51 +3,212 @@
 package github
 
 import (
+	"context"
+	"crypto/tls"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/ui"
+	"github.com/cashapp/hermit/util"
 )
 
 // Repo information.
 type Repo struct {
 	Description string `json:"description"`
 	Homepage    string `json:"homepage"`
+	// Owner is the login of the user or organisation owning the repo.
+	Owner          string `json:"-"`
+	OwnerAvatarURL string `json:"-"`
+}
+
+// UnmarshalJSON flattens the nested "owner" object.
+func (r *Repo) UnmarshalJSON(data []byte) error {
+	type plain Repo
+	aux := struct {
+		*plain
+		Owner struct {
+			Login     string `json:"login"`
+			AvatarURL string `json:"avatar_url"`
+		} `json:"owner"`
+	}{plain: (*plain)(r)}
+	if err := json.Unmarshal(data, &aux); err != nil {
+		return err
+	}
+	r.Owner = aux.Owner.Login
+	r.OwnerAvatarURL = aux.Owner.AvatarURL
+	return nil
 }
 
 // Release is a minimal type for GitHub releases meta information retrieved via the GitHub API.
 //
 // See https://docs.github.com/en/rest/reference/repos#list-releases
 type Release struct {
-	TagName string  `json:"tag_name"`
-	Assets  []Asset `json:"assets"`
+	TagName    string  `json:"tag_name"`
+	Draft      bool    `json:"draft"`
+	Prerelease bool    `json:"prerelease"`
+	Assets     []Asset `json:"assets"`
 }
 
 // Asset is a minimal type for assets in the GitHub releases meta information retrieved via the GitHub API.
 //
 // See https://docs.github.com/en/rest/reference/repos#list-releases
 type Asset struct {
-	Name string `json:"name"`
-	URL  string `json:"url"`
+	ID                 int64  `json:"id"`
+	Name               string `json:"name"`
+	URL                string `json:"url"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+	ContentType        string `json:"content_type"`
+	Size               int64  `json:"size"`
+	// Digest of the asset in the form "<algorithm>:<hex>", if GitHub has computed one.
+	Digest string `json:"digest"`
+}
+
+// AssetCacheKey returns a stable key for an asset, suitable for use in a content-addressed store.
+//
+// If GitHub has provided a digest for the asset the key is derived from it,
+// otherwise it falls back to a hash of the asset's repo, tag, name and size
+// (as encoded in its browser download URL). The fallback is only as stable as
+// the release itself: if an asset is re-uploaded under the same tag and name
+// with an identical size, the key will not change, so callers should still
+// verify content where possible.
+func AssetCacheKey(asset Asset) string {
+	if algorithm, digest := splitDigest(asset.Digest); digest != "" {
+		return algorithm + "-" + digest
+	}
+	source := asset.BrowserDownloadURL
+	if source == "" {
+		source = asset.URL + "/" + asset.Name
+	}
+	return "asset-" + util.Hash(source, asset.Size)
+}
+
+// Split a "<algorithm>:<hex>" digest into its components.
+func splitDigest(digest string) (algorithm, hex string) {
+	parts := strings.SplitN(digest, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", ""
+	}
+	return strings.ToLower(parts[0]), strings.ToLower(parts[1])
 }
 
+const (
+	defaultAPIURL       = "https://api.github.com"
+	defaultWebURL       = "https://github.com"
+	defaultMaxRedirects = 10
+	defaultBufferSize   = 32 * 1024
+)
+
+// ErrTooManyRedirects is returned when a request exceeds the configured maximum number of redirects.
+var ErrTooManyRedirects = errors.New("too many redirects")
+
 // Client for GitHub.
 type Client struct {
-	client *http.Client
+	client        *http.Client
+	apiURL        string
+	webURL        string
+	maxRedirects  int
+	verification  VerificationLevel
+	logger        ui.Logger
+	language      string
+	bufferSize    int
+	maxRetries    int
+	minBackoff    time.Duration
+	maxBackoff    time.Duration
+	clock         Clock
+	rand          func() float64
+	parallelPages int
+	minTLSVersion uint16
+	maxPages      int
+	rateLimitWait time.Duration
+	etags         *etagCache
+	wrapTransport func(http.RoundTripper) http.RoundTripper
+
+	probeLock sync.Mutex
+	route     downloadRoute
+	tokens    TokenSource
+	tokenOnce sync.Once
+	token     string
+
+	prefetchLock sync.Mutex
+	prefetched   map[string]*Release
 }
 
 // New creates a new GitHub API client.
-func New(token string) *Client {
-	var client *http.Client
-	if token == "" {
-		client = http.DefaultClient
-	} else {
-		client = &http.Client{Transport: TokenAuthenticatedTransport(nil, token)}
+func New(token string, options ...Option) *Client {
+	c := &Client{
+		apiURL:        defaultAPIURL,
+		webURL:        defaultWebURL,
+		maxRedirects:  defaultMaxRedirects,
+		verification:  VerificationOff,
+		bufferSize:    defaultBufferSize,
+		maxRetries:    defaultMaxRetries,
+		minBackoff:    defaultMinBackoff,
+		maxBackoff:    defaultMaxBackoff,
+		clock:         realClock{},
+		rand:          defaultRand,
+		minTLSVersion: tls.VersionTLS12,
+		maxPages:      defaultMaxPages,
+		rateLimitWait: defaultMaxRateLimitWait,
+	}
+	for _, option := range options {
+		option(c)
+	}
+	if token != "" {
+		c.tokens = StaticToken(token)
+	}
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	base.TLSClientConfig = &tls.Config{MinVersion: c.minTLSVersion} // nolint: gosec
+	var transport http.RoundTripper = base
+	if c.tokens != nil {
+		transport = tokenAuthenticatedTransport(base, c.resolveToken, hostOf(c.apiURL), c.WebHost())
+	}
+	if c.wrapTransport != nil {
+		transport = c.wrapTransport(transport)
+	}
+	c.client = &http.Client{Transport: transport, CheckRedirect: c.checkRedirect}
+	return c
+}
+
+// Authenticated returns true if the client has a token, resolving it if necessary.
+func (a *Client) Authenticated() bool {
+	return a.resolveToken() != ""
+}
+
+// Resolve the client's token on first use, as the token source may be slow (eg. "gh auth token").
+func (a *Client) resolveToken() string {
+	a.tokenOnce.Do(func() {
+		if a.tokens == nil {
+			return
+		}
+		token, err := a.tokens()
+		if err != nil && a.logger != nil {
+			a.logger.Warnf("could not retrieve GitHub token: %s", err)
+		}
+		a.token = token
+	})
+	return a.token
+}
+
+// WebHost is the host of the GitHub web UI, eg. "github.com".
+func (a *Client) WebHost() string {
+	return hostOf(a.webURL)
+}
+
+func hostOf(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return ""
 	}
-	return &Client{client: client}
+	return u.Host
 }
 
 // ProjectForURL returns the <repo>/<project> for the given URL if it is a GitHub project.
@@ -56,7 +217,7 @@ func (a *Client) ProjectForURL(sourceURL string) string {
 	if err != nil {
 		return ""
 	}
-	if u.Host != "github.com" {
+	if u.Host != a.WebHost() {
 		return ""
 	}
 	parts := strings.Split(u.Path, "/")
@@ -67,59 +228,300 @@ func (a *Client) ProjectForURL(sourceURL string) string {
 }
 
 // Repo information.
-func (a *Client) Repo(repo string) (*Repo, error) {
+func (a *Client) Repo(ctx context.Context, repo string) (*Repo, error) {
 	response := &Repo{}
-	url := "https://api.github.com/repos/" + repo
-	return response, a.decode(url, response)
+	url := a.apiURL + "/repos/" + repo
+	return response, a.decode(ctx, url, response)
 }
 
 // LatestRelease details for a GitHub repository.
-func (a *Client) LatestRelease(repo string) (*Release, error) {
-	url := "https://api.github.com/repos/" + repo + "/releases/latest"
+//
+// If ctx carries a release channel (see WithChannel) other than "stable", the
+// newest pre-release on that channel is returned instead, falling back to the
+// latest stable release if the channel has no releases.
+//
+// Releases retrieved by PrefetchLatestReleases are returned without a request.
+func (a *Client) LatestRelease(ctx context.Context, repo string) (*Release, error) {
+	if channel := ChannelFromContext(ctx); channel != "" && channel != "stable" {
+		var found *Release
+		err := a.ForEachRelease(ctx, repo, func(release Release) (bool, error) {
+			if !release.Draft && release.Prerelease && release.onChannel(channel) {
+				found = &release
+				return true, nil
+			}
+			return false, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if found != nil {
+			return found, nil
+		}
+	}
+	if release := a.prefetchedRelease(repo); release != nil {
+		return release, nil
+	}
+	url := a.apiURL + "/repos/" + repo + "/releases/latest"
 	release := &Release{}
-	return release, a.decode(url, release)
+	return release, a.decode(ctx, url, release)
+}
+
+// Releases for a particular repo, newest first.
+//
+// All pages are retrieved, up to the limit configured with WithMaxPages.
+func (a *Client) Releases(ctx context.Context, repo string) (releases []Release, err error) {
+	url := fmt.Sprintf("%s/repos/%s/releases?per_page=%d", a.apiURL, repo, pageSize)
+	pages, err := a.fetchPages(ctx, url, func() interface{} { return &[]Release{} })
+	if err != nil {
+		return nil, err
+	}
+	for _, page := range pages {
+		releases = append(releases, *page.(*[]Release)...)
+	}
+	return releases, nil
 }
 
-// Releases for a particular repo.
-func (a *Client) Releases(repo string) (releases []Release, err error) {
-	url := fmt.Sprintf("https://api.github.com/repos/%s/releases", repo)
-	return releases, a.decode(url, &releases)
+// AssetMeta retrieves the metadata for a single release asset directly from
+// the asset endpoint, without downloading its content.
+func (a *Client) AssetMeta(ctx context.Context, repo string, assetID int64) (*Asset, error) {
+	url := fmt.Sprintf("%s/repos/%s/releases/assets/%d", a.apiURL, repo, assetID)
+	asset := &Asset{}
+	return asset, a.decode(ctx, url, asset)
+}
+
+// ForEachRelease calls fn for each release in a repo, newest first.
+//
+// Pages are retrieved lazily, so if fn returns stop=true no further pages
+// are fetched. At most WithMaxPages pages are retrieved.
+func (a *Client) ForEachRelease(ctx context.Context, repo string, fn func(Release) (stop bool, err error)) error {
+	url := fmt.Sprintf("%s/repos/%s/releases?per_page=%d", a.apiURL, repo, pageSize)
+	for pages := 1; url != "" && a.withinPageLimit(pages); pages++ {
+		var page []Release
+		links, err := a.decodePage(ctx, url, &page)
+		if err != nil {
+			return err
+		}
+		for _, release := range page {
+			stop, err := fn(release)
+			if err != nil {
+				return err
+			}
+			if stop {
+				return nil
+			}
+		}
+		url = links["next"]
+	}
+	return nil
 }
 
 // Download creates a download request for retrieving a release asset from GitHub.
-func (a *Client) Download(asset Asset) (resp *http.Response, err error) {
-	req, err := a.request(asset.URL, http.Header{
-		"Accept": []string{"application/octet-stream"},
-	})
+func (a *Client) Download(ctx context.Context, asset Asset) (resp *http.Response, err error) {
+	return a.DownloadFrom(ctx, asset, 0)
+}
+
+// DownloadFrom retrieves a release asset from GitHub starting at byte "offset", to resume a partial download.
+//
+// If offset is greater than zero a successful response is 206 Partial
+// Content, unless the server ignored the Range request and returned the
+// whole asset.
+//
+// Assets are downloaded via the API asset URL, which GitHub redirects to
+// its storage backend. If that is rejected, as happens in some organisation
+// configurations, or does not negotiate a binary response, the download falls
+// back to the asset's browser download URL.
+func (a *Client) DownloadFrom(ctx context.Context, asset Asset, offset int64) (resp *http.Response, err error) {
+	headers := http.Header{"Accept": []string{"application/octet-stream"}}
+	if offset > 0 {
+		headers.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	if asset.URL == "" {
+		return a.download(ctx, asset.BrowserDownloadURL, headers)
+	}
+	resp, err = a.download(ctx, asset.URL, headers)
+	if err != nil || asset.BrowserDownloadURL == "" || asset.BrowserDownloadURL == asset.URL || !shouldFallBackToBrowserURL(resp) {
+		return resp, err
+	}
+	_ = resp.Body.Close()
+	headers.Del("Accept")
+	return a.download(ctx, asset.BrowserDownloadURL, headers)
+}
+
+func (a *Client) download(ctx context.Context, url string, headers http.Header) (*http.Response, error) {
+	req, err := a.request(ctx, url, headers)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 	return a.client.Do(req)
 }
 
-func (a *Client) decode(url string, dest interface{}) error {
-	req, err := a.request(url, http.Header{})
+// Returns true if an asset API response can't be used.
+//
+// That is, either access was denied, or the API ignored the Accept header and
+// returned asset metadata rather than the asset.
+func shouldFallBackToBrowserURL(resp *http.Response) bool {
+	switch resp.StatusCode {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden, http.StatusNotFound:
+		return true
+	}
+	return resp.StatusCode >= 200 && resp.StatusCode <= 299 && strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json")
+}
+
+// DownloadTo downloads a release asset from GitHub into w, returning the number of bytes written.
+//
+// The body is copied using a buffer of the size configured with WithDownloadBufferSize.
+func (a *Client) DownloadTo(ctx context.Context, asset Asset, w io.Writer) (int64, error) {
+	resp, err := a.Download(ctx, asset)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, errors.Errorf("%s: GitHub download failed with %s", asset.URL, resp.Status)
+	}
+	// Hide any io.ReaderFrom/io.WriterTo implementations so that the configured buffer is always used.
+	n, err := io.CopyBuffer(struct{ io.Writer }{w}, struct{ io.Reader }{resp.Body}, make([]byte, a.bufferSize))
+	return n, errors.Wrap(err, asset.URL)
+}
+
+// DownloadReliable downloads a release asset from GitHub into w like
+// DownloadTo, but if the download fails transiently it is resumed from the
+// bytes already written, following the policy configured with WithRetries.
+func (a *Client) DownloadReliable(ctx context.Context, asset Asset, w io.Writer) (int64, error) {
+	var written int64
+	buf := make([]byte, a.bufferSize)
+	err := a.retry(ctx, func() error {
+		resp, err := a.DownloadFrom(ctx, asset, written)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			return newStatusError(asset.URL, resp)
+		}
+		if written > 0 && resp.StatusCode != http.StatusPartialContent {
+			return errors.Errorf("%s: GitHub did not resume the download at byte %d", asset.URL, written)
+		}
+		n, err := io.CopyBuffer(struct{ io.Writer }{w}, struct{ io.Reader }{resp.Body}, buf)
+		written += n
+		return errors.Wrap(err, asset.URL)
+	})
+	return written, err
+}
+
+func (a *Client) decode(ctx context.Context, url string, dest interface{}) error {
+	_, err := a.decodePage(ctx, url, dest)
+	return err
+}
+
+// Decode a single page of an API response into dest, returning the
+// pagination links from the response's Link header.
+func (a *Client) decodePage(ctx context.Context, url string, dest interface{}) (links map[string]string, err error) {
+	err = a.retry(ctx, func() error {
+		links, err = a.decodePageOnce(ctx, url, dest)
+		return err
+	})
+	return links, err
+}
+
+func (a *Client) decodePageOnce(ctx context.Context, url string, dest interface{}) (links map[string]string, err error) {
+	req, err := a.request(ctx, url, a.metadataHeaders())
 	if err != nil {
-		return errors.Wrap(err, url)
+		return nil, errors.Wrap(err, url)
+	}
+	var cached *etagEntry
+	if a.etags != nil {
+		if cached = a.etags.load(req); cached != nil {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
 	}
 	resp, err := a.client.Do(req)
 	if err != nil {
-		return errors.Wrap(err, url)
+		return nil, errors.Wrap(err, url)
 	}
 	defer resp.Body.Close()
-	if resp.StatusCode < 200 || resp.StatusCode > 299 {
-		return errors.Errorf("%s: GitHub API request failed with %s", url, resp.Status)
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		return parseLinks(cached.Link), a.decodeBody(url, cached.Body, dest)
 	}
-	dec := json.NewDecoder(resp.Body)
-	err = dec.Decode(dest)
+	if err := checkResponse(url, resp); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	etag := resp.Header.Get("ETag")
+	if a.etags == nil || etag == "" {
+		err = json.NewDecoder(resp.Body).Decode(dest)
+		if err != nil {
+			return nil, errors.Wrap(describeDecodeError(err), url)
+		}
+		return parseLinks(resp.Header.Get("Link")), nil
+	}
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return errors.Wrap(err, url)
+		return nil, errors.Wrap(err, url)
+	}
+	if err := a.decodeBody(url, body, dest); err != nil {
+		return nil, err
+	}
+	entry := &etagEntry{ETag: etag, Link: resp.Header.Get("Link"), Body: body}
+	if err := a.etags.store(req, entry); err != nil && a.logger != nil {
+		a.logger.Warnf("%s: could not cache response: %s", url, err)
+	}
+	return parseLinks(entry.Link), nil
+}
+
+func (a *Client) decodeBody(url string, body []byte, dest interface{}) error {
+	if err := json.Unmarshal(body, dest); err != nil {
+		return errors.Wrap(describeDecodeError(err), url)
+	}
+	return nil
+}
+
+// Make JSON errors caused by changes in the shape of API responses (eg. an
+// object where an array was expected) easier to diagnose.
+func describeDecodeError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	if !errors.As(err, &typeErr) || (typeErr.Value != "object" && typeErr.Value != "array") {
+		return err
+	}
+	expected := describeJSONType(typeErr.Type)
+	if typeErr.Field != "" {
+		return errors.Wrapf(err, "unexpected response shape for field %q: expected %s, got %s", typeErr.Field, expected, typeErr.Value)
+	}
+	return errors.Wrapf(err, "unexpected response shape: expected %s, got %s", expected, typeErr.Value)
+}
+
+func describeJSONType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		return "array of " + t.Elem().String()
+	case reflect.Struct, reflect.Map:
+		return "object " + t.String()
+	default:
+		return t.String()
+	}
+}
+
+func (a *Client) checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) > a.maxRedirects {
+		return errors.Wrapf(ErrTooManyRedirects, "stopped after %d redirects", a.maxRedirects)
+	}
+	// Never leak credentials to a different host, eg. when GitHub redirects an asset download to S3.
+	if req.URL.Host != via[0].URL.Host {
+		req.Header.Del("Authorization")
 	}
 	return nil
 }
 
-func (a *Client) request(url string, headers http.Header) (*http.Request, error) {
-	req, err := http.NewRequest("GET", url, nil) // nolint: noctx
+// Headers sent with API metadata requests.
+func (a *Client) metadataHeaders() http.Header {
+	headers := http.Header{"Accept": []string{"application/vnd.github.v3+json"}}
+	if a.language != "" {
+		headers.Set("Accept-Language", a.language)
+	}
+	return headers
+}
+
+func (a *Client) request(ctx context.Context, url string, headers http.Header) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
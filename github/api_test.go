@@ -0,0 +1,384 @@
+package github
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadMaxRedirects(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n, err := strconv.Atoi(strings.TrimPrefix(r.URL.Path, "/redirect/"))
+		if err != nil {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		if n == 0 {
+			_, _ = io.WriteString(w, "asset")
+			return
+		}
+		http.Redirect(w, r, fmt.Sprintf("/redirect/%d", n-1), http.StatusFound)
+	}))
+	defer srv.Close()
+
+	client := New("", WithMaxRedirects(3))
+
+	resp, err := client.Download(context.Background(), Asset{URL: srv.URL + "/redirect/3"})
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "asset", string(body))
+
+	_, err = client.Download(context.Background(), Asset{URL: srv.URL + "/redirect/4"})
+	require.Error(t, err)
+	require.True(t, errors.Is(err, ErrTooManyRedirects), "%+v", err)
+}
+
+func TestAssetCacheKey(t *testing.T) {
+	asset := Asset{
+		Name:               "tool-linux-amd64.tar.gz",
+		URL:                "https://api.github.com/repos/owner/tool/releases/assets/1",
+		BrowserDownloadURL: "https://github.com/owner/tool/releases/download/v1.0.0/tool-linux-amd64.tar.gz",
+		Size:               1024,
+	}
+	key := AssetCacheKey(asset)
+	require.Equal(t, key, AssetCacheKey(asset))
+
+	resized := asset
+	resized.Size = 2048
+	require.NotEqual(t, key, AssetCacheKey(resized))
+
+	digested := asset
+	digested.Digest = "sha256:ABCDEF"
+	require.Equal(t, "sha256-abcdef", AssetCacheKey(digested))
+
+	redigested := digested
+	redigested.Digest = "sha256:123456"
+	require.NotEqual(t, AssetCacheKey(digested), AssetCacheKey(redigested))
+}
+
+// Create a Client that sends API requests to a test server.
+func newTestClient(t *testing.T, handler http.Handler, options ...Option) *Client {
+	t.Helper()
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+	client := New("", options...)
+	client.apiURL = srv.URL
+	return client
+}
+
+func TestDecodeUnexpectedShape(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"message": "Moved Permanently"}`)
+	}))
+	_, err := client.Releases(context.Background(), "owner/repo")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "/repos/owner/repo/releases?per_page=100: unexpected response shape: expected array of github.Release, got object")
+}
+
+func TestAcceptLanguage(t *testing.T) {
+	var language string
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		language = r.Header.Get("Accept-Language")
+		fmt.Fprint(w, `{"description": "A tool"}`)
+	}), WithAcceptLanguage("fr-CA"))
+	repo, err := client.Repo(context.Background(), "owner/repo")
+	require.NoError(t, err)
+	require.Equal(t, "A tool", repo.Description)
+	require.Equal(t, "fr-CA", language)
+}
+
+func TestAssetMeta(t *testing.T) {
+	var path, accept string
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		accept = r.Header.Get("Accept")
+		fmt.Fprint(w, `{
+			"id": 42,
+			"name": "tool-linux-amd64.tar.gz",
+			"url": "https://api.github.com/repos/owner/repo/releases/assets/42",
+			"browser_download_url": "https://github.com/owner/repo/releases/download/v1.0.0/tool-linux-amd64.tar.gz",
+			"content_type": "application/gzip",
+			"size": 123456,
+			"digest": "sha256:0123456789abcdef"
+		}`)
+	}))
+	asset, err := client.AssetMeta(context.Background(), "owner/repo", 42)
+	require.NoError(t, err)
+	require.Equal(t, "/repos/owner/repo/releases/assets/42", path)
+	require.NotEqual(t, "application/octet-stream", accept)
+	require.Equal(t, int64(42), asset.ID)
+	require.Equal(t, int64(123456), asset.Size)
+	require.Equal(t, "application/gzip", asset.ContentType)
+	require.Equal(t, "sha256:0123456789abcdef", asset.Digest)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// Records the size of the buffer passed to each Read.
+type readSizeRecorder struct {
+	io.Reader
+	sizes []int
+}
+
+func (r *readSizeRecorder) Read(p []byte) (int, error) {
+	r.sizes = append(r.sizes, len(p))
+	return r.Reader.Read(p)
+}
+
+func (r *readSizeRecorder) Close() error { return nil }
+
+func TestDownloadBufferSize(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		size     int
+		expected int
+	}{
+		{"Default", 0, 32 * 1024},
+		{"Invalid", -1, 32 * 1024},
+		{"Custom", 1024 * 1024, 1024 * 1024},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			body := &readSizeRecorder{Reader: strings.NewReader(strings.Repeat("x", 100000))}
+			client := New("", WithDownloadBufferSize(test.size))
+			client.client.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				return &http.Response{StatusCode: http.StatusOK, Body: body, Request: req}, nil
+			})
+			w := &strings.Builder{}
+			n, err := client.DownloadTo(context.Background(), Asset{URL: "https://api.github.com/asset"}, w)
+			require.NoError(t, err)
+			require.Equal(t, int64(100000), n)
+			require.Equal(t, 100000, w.Len())
+			require.NotEmpty(t, body.sizes)
+			for _, size := range body.sizes {
+				require.Equal(t, test.expected, size)
+			}
+		})
+	}
+}
+
+// Fails with an unexpected EOF once its Reader is exhausted.
+type truncatedBody struct {
+	*readSizeRecorder
+}
+
+func (t truncatedBody) Read(p []byte) (int, error) {
+	n, err := t.readSizeRecorder.Read(p)
+	if err == io.EOF {
+		return n, io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func TestDownloadReliableResumes(t *testing.T) {
+	content := strings.Repeat("x", 100000)
+	var ranges []string
+	first := &readSizeRecorder{Reader: strings.NewReader(content[:60000])}
+	rest := &readSizeRecorder{Reader: strings.NewReader(content[60000:])}
+	client := New("", WithDownloadBufferSize(1024), WithRetries(1, time.Millisecond, time.Millisecond))
+	client.client.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		if len(ranges) == 1 {
+			return &http.Response{StatusCode: http.StatusOK, Body: truncatedBody{first}, Request: req}, nil
+		}
+		return &http.Response{StatusCode: http.StatusPartialContent, Body: rest, Request: req}, nil
+	})
+	w := &strings.Builder{}
+	n, err := client.DownloadReliable(context.Background(), Asset{URL: "https://api.github.com/asset"}, w)
+	require.NoError(t, err)
+	require.Equal(t, int64(100000), n)
+	require.Equal(t, content, w.String())
+	require.Equal(t, []string{"", "bytes=60000-"}, ranges)
+	for _, size := range append(first.sizes, rest.sizes...) {
+		require.Equal(t, 1024, size)
+	}
+
+	// A resumed download that restarts from the beginning can't be appended.
+	ranges = nil
+	first = &readSizeRecorder{Reader: strings.NewReader(content[:60000])}
+	client.client.Transport = roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		if len(ranges) == 1 {
+			return &http.Response{StatusCode: http.StatusOK, Body: truncatedBody{first}, Request: req}, nil
+		}
+		return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(content)), Request: req}, nil
+	})
+	_, err = client.DownloadReliable(context.Background(), Asset{URL: "https://api.github.com/asset"}, &strings.Builder{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "did not resume the download at byte 60000")
+}
+
+func TestRepoOwner(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{
+			"id": 1296269,
+			"name": "hermit",
+			"full_name": "cashapp/hermit",
+			"owner": {
+				"login": "cashapp",
+				"id": 1,
+				"avatar_url": "https://avatars.githubusercontent.com/u/1?v=4",
+				"type": "Organization"
+			},
+			"private": false,
+			"description": "Hermit manages isolated, self-bootstrapping sets of tools",
+			"homepage": "https://cashapp.github.io/hermit"
+		}`)
+	}))
+	repo, err := client.Repo(context.Background(), "cashapp/hermit")
+	require.NoError(t, err)
+	require.Equal(t, &Repo{
+		Description:    "Hermit manages isolated, self-bootstrapping sets of tools",
+		Homepage:       "https://cashapp.github.io/hermit",
+		Owner:          "cashapp",
+		OwnerAvatarURL: "https://avatars.githubusercontent.com/u/1?v=4",
+	}, repo)
+}
+
+func TestMinTLSVersion(t *testing.T) {
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "asset")
+	}))
+	srv.TLS = &tls.Config{MinVersion: tls.VersionTLS10, MaxVersion: tls.VersionTLS11} // nolint: gosec
+	srv.Config.ErrorLog = log.New(io.Discard, "", 0)
+	srv.StartTLS()
+	defer srv.Close()
+	pool := x509.NewCertPool()
+	pool.AddCert(srv.Certificate())
+
+	for _, test := range []struct {
+		name    string
+		options []Option
+		err     bool
+	}{
+		{name: "Default", err: true},
+		{name: "TLS13", options: []Option{WithMinTLSVersion(tls.VersionTLS13)}, err: true},
+		{name: "TLS10", options: []Option{WithMinTLSVersion(tls.VersionTLS10)}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := New("", test.options...)
+			client.client.Transport.(*http.Transport).TLSClientConfig.RootCAs = pool
+			resp, err := client.Download(context.Background(), Asset{URL: srv.URL})
+			if test.err {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "protocol version")
+				return
+			}
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+		})
+	}
+}
+
+func TestEnterpriseBaseURL(t *testing.T) {
+	var authorization []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = append(authorization, r.Header.Get("Authorization"))
+		if r.URL.Path != "/api/v3/repos/owner/repo" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, `{"description": "A tool"}`)
+	}))
+	defer srv.Close()
+
+	client := New("secret", WithBaseURL(srv.URL+"/api/v3/", srv.URL))
+	require.Equal(t, "owner/repo", client.ProjectForURL(srv.URL+"/owner/repo/releases/download/v1.0.0/tool.tar.gz"))
+	require.Equal(t, "", client.ProjectForURL("https://github.com/owner/repo"))
+
+	repo, err := client.Repo(context.Background(), "owner/repo")
+	require.NoError(t, err)
+	require.Equal(t, "A tool", repo.Description)
+	require.Equal(t, []string{"token secret"}, authorization)
+}
+
+func TestDownloadFromOffset(t *testing.T) {
+	var ranges []string
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ranges = append(ranges, r.Header.Get("Range"))
+		w.WriteHeader(http.StatusPartialContent)
+	}))
+	for _, offset := range []int64{0, 1024} {
+		resp, err := client.DownloadFrom(context.Background(), Asset{URL: client.apiURL + "/asset"}, offset)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+	require.Equal(t, []string{"", "bytes=1024-"}, ranges)
+}
+
+func TestDownloadFallsBackToBrowserDownloadURL(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		requests []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests = append(requests, r.URL.Path+" "+r.Header.Get("Authorization"))
+		lock.Unlock()
+		switch r.URL.Path {
+		case "/api/asset":
+			// Simulate a storage backend rejecting the redirected request.
+			http.Redirect(w, r, "/storage/asset", http.StatusFound)
+		case "/storage/asset":
+			w.WriteHeader(http.StatusBadRequest)
+		case "/api/metadata":
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprint(w, `{"name": "asset"}`)
+		case "/web/asset":
+			fmt.Fprint(w, "asset")
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	client := New("", WithBaseURL(srv.URL+"/api", srv.URL+"/web"))
+	for _, path := range []string{"/api/asset", "/api/metadata"} {
+		resp, err := client.Download(context.Background(), Asset{URL: srv.URL + path, BrowserDownloadURL: srv.URL + "/web/asset"})
+		require.NoError(t, err)
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		resp.Body.Close()
+		require.Equal(t, "asset", string(body))
+	}
+	require.Equal(t, []string{"/api/asset ", "/storage/asset ", "/web/asset ", "/api/metadata ", "/web/asset "}, requests)
+}
+
+func TestDownloadStripsAuthorizationOnCrossHostRedirect(t *testing.T) {
+	var storageAuthorization []string
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storageAuthorization = append(storageAuthorization, r.Header.Get("Authorization"))
+		fmt.Fprint(w, "asset")
+	}))
+	defer storage.Close()
+	var apiAuthorization []string
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiAuthorization = append(apiAuthorization, r.Header.Get("Authorization"))
+		http.Redirect(w, r, storage.URL+"/asset", http.StatusFound)
+	}))
+	defer api.Close()
+
+	client := New("secret", WithBaseURL(api.URL, api.URL))
+	resp, err := client.Download(context.Background(), Asset{URL: api.URL + "/asset"})
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, []string{"token secret"}, apiAuthorization)
+	require.Equal(t, []string{""}, storageAuthorization)
+}
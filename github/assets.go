@@ -0,0 +1,154 @@
+package github
+
+import (
+	"context"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/gobwas/glob"
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/platform"
+)
+
+// AssetScheme is the URI scheme of release assets selected by pattern, as created by AssetURI.
+const AssetScheme = "github-asset"
+
+// MatchAssets returns the assets of "release" whose names match "pattern"
+// and that target the platform "target".
+//
+// "pattern" is a glob (eg. "protoc-*.zip") unless it's enclosed in slashes,
+// in which case it's a regular expression (eg. "/^protoc-.*\.zip$/").
+// Checksums and signatures never match. If more than one asset matches, only
+// those whose names identify "target" are returned (see ClassifyAsset), or
+// failing that, those naming its OS but no architecture (eg. universal macOS
+// binaries). A single pattern can therefore select the right asset for every
+// platform.
+func MatchAssets(release *Release, pattern string, target platform.Platform) ([]Asset, error) {
+	match, err := compileAssetPattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	var candidates []Asset
+	for _, asset := range release.Assets {
+		if !isVerificationAsset(strings.ToLower(asset.Name)) && match(asset.Name) {
+			candidates = append(candidates, asset)
+		}
+	}
+	if len(candidates) <= 1 {
+		return candidates, nil
+	}
+	var exact, osOnly []Asset
+	for _, asset := range candidates {
+		name := strings.ToLower(asset.Name)
+		if plat, ok := ClassifyAsset(asset); ok && plat == target {
+			exact = append(exact, asset)
+		} else if classify(name, osClassifiers) == target.OS && classify(name, archClassifiers) == "" {
+			osOnly = append(osOnly, asset)
+		}
+	}
+	if len(exact) > 0 {
+		return exact, nil
+	}
+	return osOnly, nil
+}
+
+// MatchAsset returns the single asset of "release" matching "pattern" for "target", as for MatchAssets.
+func MatchAsset(release *Release, pattern string, target platform.Platform) (Asset, error) {
+	assets, err := MatchAssets(release, pattern, target)
+	if err != nil {
+		return Asset{}, err
+	}
+	switch len(assets) {
+	case 0:
+		return Asset{}, errors.Errorf("no asset in release %s matches %q for %s", release.TagName, pattern, target)
+	case 1:
+		return assets[0], nil
+	default:
+		names := make([]string, len(assets))
+		for i, asset := range assets {
+			names[i] = asset.Name
+		}
+		return Asset{}, errors.Errorf("%q matches multiple assets in release %s for %s: %s", pattern, release.TagName, target, strings.Join(names, ", "))
+	}
+}
+
+func compileAssetPattern(pattern string) (func(string) bool, error) {
+	if len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/") {
+		re, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid asset pattern %q", pattern)
+		}
+		return re.MatchString, nil
+	}
+	g, err := glob.Compile(pattern)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid asset pattern %q", pattern)
+	}
+	return g.Match, nil
+}
+
+// ReleaseByTag retrieves the release of a GitHub repository with the given tag.
+func (a *Client) ReleaseByTag(ctx context.Context, repo, tag string) (*Release, error) {
+	endpoint := a.apiURL + "/repos/" + repo + "/releases/tags/" + url.PathEscape(tag)
+	release := &Release{}
+	return release, a.decode(ctx, endpoint, release)
+}
+
+// MatchAsset retrieves the release of "repo" tagged "tag", and the single asset in it matching "pattern" for "target".
+func (a *Client) MatchAsset(ctx context.Context, repo, tag, pattern string, target platform.Platform) (*Release, Asset, error) {
+	release, err := a.ReleaseByTag(ctx, repo, tag)
+	if err != nil {
+		return nil, Asset{}, errors.Wrapf(err, "%s@%s", repo, tag)
+	}
+	asset, err := MatchAsset(release, pattern, target)
+	if err != nil {
+		return nil, Asset{}, errors.Wrap(err, repo)
+	}
+	return release, asset, nil
+}
+
+// AssetURI returns a "github-asset://<owner>/<repo>/<tag>/<pattern>?os=<os>&arch=<arch>"
+// URI identifying the asset of a release matching "pattern" for "target".
+//
+// The asset is only looked up when the URI is retrieved, see ParseAssetURI.
+// As the URI ends in the pattern, a single executable asset is installed
+// under the name of the pattern.
+func AssetURI(repo, tag, pattern string, target platform.Platform) string {
+	query := url.Values{"os": {target.OS}, "arch": {target.Arch}}
+	return AssetScheme + "://" + repo + "/" + url.PathEscape(tag) + "/" + url.PathEscape(pattern) + "?" + query.Encode()
+}
+
+// AssetRef is the release asset identified by a URI created with AssetURI.
+type AssetRef struct {
+	Repo    string
+	Tag     string
+	Pattern string
+	Target  platform.Platform
+}
+
+// ParseAssetURI parses a URI created by AssetURI.
+func ParseAssetURI(uri *url.URL) (*AssetRef, error) {
+	if uri.Scheme != AssetScheme {
+		return nil, errors.Errorf("%s: not a %s URI", uri, AssetScheme)
+	}
+	parts := strings.Split(strings.TrimPrefix(uri.EscapedPath(), "/"), "/")
+	if uri.Host == "" || len(parts) != 3 {
+		return nil, errors.Errorf("%s: expected %s://<owner>/<repo>/<tag>/<pattern>", uri, AssetScheme)
+	}
+	for i, part := range parts {
+		unescaped, err := url.PathUnescape(part)
+		if err != nil || unescaped == "" {
+			return nil, errors.Errorf("%s: expected %s://<owner>/<repo>/<tag>/<pattern>", uri, AssetScheme)
+		}
+		parts[i] = unescaped
+	}
+	query := uri.Query()
+	return &AssetRef{
+		Repo:    uri.Host + "/" + parts[0],
+		Tag:     parts[1],
+		Pattern: parts[2],
+		Target:  platform.Platform{OS: query.Get("os"), Arch: query.Get("arch")},
+	}, nil
+}
@@ -0,0 +1,68 @@
+package github
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/platform"
+)
+
+func TestMatchAssets(t *testing.T) {
+	release := &Release{TagName: "v1.0.0", Assets: []Asset{
+		{Name: "tool-1.0.0-linux-amd64.tar.gz"},
+		{Name: "tool-1.0.0-linux-arm64.tar.gz"},
+		{Name: "tool-1.0.0-linux-amd64.tar.gz.sha256"},
+		{Name: "tool-1.0.0-darwin-universal.tar.gz"},
+		{Name: "tool-1.0.0-source.zip"},
+		{Name: "checksums.txt"},
+	}}
+	tests := []struct {
+		pattern  string
+		target   platform.Platform
+		expected []string
+		err      string
+	}{
+		{"tool-*.tar.gz", platform.Platform{OS: platform.Linux, Arch: platform.Amd64}, []string{"tool-1.0.0-linux-amd64.tar.gz"}, ""},
+		{"tool-*.tar.gz", platform.Platform{OS: platform.Linux, Arch: platform.Arm64}, []string{"tool-1.0.0-linux-arm64.tar.gz"}, ""},
+		{"tool-*.tar.gz", platform.Platform{OS: platform.Darwin, Arch: platform.Arm64}, []string{"tool-1.0.0-darwin-universal.tar.gz"}, ""},
+		{"tool-*-{linux,darwin}-*", platform.Platform{OS: platform.Linux, Arch: platform.Amd64}, []string{"tool-1.0.0-linux-amd64.tar.gz"}, ""},
+		{`/^tool-[\d.]+-source\.zip$/`, platform.Platform{OS: platform.Linux, Arch: platform.Amd64}, []string{"tool-1.0.0-source.zip"}, ""},
+		{"*.txt", platform.Platform{OS: platform.Linux, Arch: platform.Amd64}, nil, ""},
+		{"/[/", platform.Platform{}, nil, `invalid asset pattern "/[/"`},
+	}
+	for _, test := range tests {
+		t.Run(test.pattern+"@"+test.target.String(), func(t *testing.T) {
+			assets, err := MatchAssets(release, test.pattern, test.target)
+			if test.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			var names []string
+			for _, asset := range assets {
+				names = append(names, asset.Name)
+			}
+			require.Equal(t, test.expected, names)
+		})
+	}
+
+	_, err := MatchAsset(release, "tool-*", platform.Platform{OS: "windows", Arch: platform.Amd64})
+	require.EqualError(t, err, `no asset in release v1.0.0 matches "tool-*" for windows-amd64`)
+}
+
+func TestAssetURI(t *testing.T) {
+	target := platform.Platform{OS: platform.Darwin, Arch: platform.Arm64}
+	uri, err := url.Parse(AssetURI("example/tool", "v1.0.0", `/^tool-.*\.(zip|tgz)$/`, target))
+	require.NoError(t, err)
+	ref, err := ParseAssetURI(uri)
+	require.NoError(t, err)
+	require.Equal(t, &AssetRef{Repo: "example/tool", Tag: "v1.0.0", Pattern: `/^tool-.*\.(zip|tgz)$/`, Target: target}, ref)
+
+	uri, err = url.Parse("github-asset://example/v1.0.0")
+	require.NoError(t, err)
+	_, err = ParseAssetURI(uri)
+	require.Error(t, err)
+}
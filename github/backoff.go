@@ -0,0 +1,126 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"math/rand"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/retry"
+)
+
+const (
+	defaultMaxRetries = 0
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 10 * time.Second
+)
+
+// Clock abstracts the passage of time so that retry behaviour can be tested deterministically.
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                         { return time.Now() }
+func (realClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// statusError is returned when the GitHub API responds with a non-2xx status.
+type statusError struct {
+	url        string
+	statusCode int
+	status     string
+	// Error message from the API response body, if any.
+	message string
+}
+
+func newStatusError(url string, resp *http.Response) *statusError {
+	body := struct {
+		Message string `json:"message"`
+	}{}
+	_ = json.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&body)
+	return &statusError{url: url, statusCode: resp.StatusCode, status: resp.Status, message: body.Message}
+}
+
+func (s *statusError) Error() string {
+	return s.url + ": GitHub API request failed with " + s.status
+}
+
+// Returns true if a failed request is worth retrying.
+func isRetryable(err error) bool {
+	var serr *statusError
+	if errors.As(err, &serr) {
+		switch serr.statusCode {
+		case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		default:
+			return false
+		}
+	}
+	// Only retry genuine network failures, never eg. malformed requests or TLS errors.
+	return retry.Transient(err)
+}
+
+// Compute the delay before retry "attempt" (0 based).
+//
+// The delay doubles with each attempt up to a maximum, with "equal jitter"
+// applied: half of the delay is fixed and the other half is random.
+func (a *Client) backoff(attempt int) time.Duration {
+	delay := a.minBackoff << uint(attempt)
+	if delay > a.maxBackoff || delay <= 0 {
+		delay = a.maxBackoff
+	}
+	half := delay / 2
+	return half + time.Duration(a.rand()*float64(half))
+}
+
+// Call fn until it succeeds, fails with a non-retryable error, or exhausts the configured retries.
+//
+// If the rate limit is exhausted and resets within the configured wait, fn is
+// retried once it has reset, independently of the retry policy.
+//
+// Waiting is abandoned if ctx is cancelled.
+func (a *Client) retry(ctx context.Context, fn func() error) error {
+	attempt, limited := 0, 0
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		var rerr *RateLimitError
+		if errors.As(err, &rerr) {
+			wait := rerr.wait(a.clock.Now())
+			if wait < 0 || wait > a.rateLimitWait || limited >= maxRateLimitRetries {
+				return err
+			}
+			limited++
+			if err := a.sleep(ctx, wait); err != nil {
+				return err
+			}
+			continue
+		}
+		if !isRetryable(err) || attempt >= a.maxRetries {
+			return err
+		}
+		if err := a.sleep(ctx, a.backoff(attempt)); err != nil {
+			return err
+		}
+		attempt++
+	}
+}
+
+func (a *Client) sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-a.clock.After(d):
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+var defaultRand = rand.Float64 // nolint: gosec
@@ -0,0 +1,133 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// A Clock that records requested delays and returns immediately.
+type fakeClock struct {
+	now    time.Time
+	sleeps []time.Duration
+}
+
+func (f *fakeClock) Now() time.Time { return f.now }
+
+func (f *fakeClock) After(d time.Duration) <-chan time.Time {
+	f.sleeps = append(f.sleeps, d)
+	f.now = f.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- f.now
+	return ch
+}
+
+func TestRetryBackoffIsDeterministic(t *testing.T) {
+	attempts := 0
+	clock := &fakeClock{}
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts <= 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"description": "A tool"}`)
+	}),
+		WithRetries(3, time.Second, 3*time.Second),
+		WithClock(clock),
+		WithRand(func() float64 { return 0.5 }))
+	repo, err := client.Repo(context.Background(), "owner/repo")
+	require.NoError(t, err)
+	require.Equal(t, "A tool", repo.Description)
+	require.Equal(t, 4, attempts)
+	// 1s, 2s, then capped at 3s; each is 50% fixed plus 50% * 0.5 jitter.
+	require.Equal(t, []time.Duration{750 * time.Millisecond, 1500 * time.Millisecond, 2250 * time.Millisecond}, clock.sleeps)
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	attempts := 0
+	clock := &fakeClock{}
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusBadGateway)
+	}), WithRetries(2, time.Second, time.Minute), WithClock(clock), WithRand(func() float64 { return 0 }))
+	_, err := client.Repo(context.Background(), "owner/repo")
+	require.EqualError(t, err, client.apiURL+"/repos/owner/repo: GitHub API request failed with 502 Bad Gateway")
+	require.Equal(t, 3, attempts)
+	require.Equal(t, []time.Duration{500 * time.Millisecond, time.Second}, clock.sleeps)
+}
+
+func TestNoRetryOnClientError(t *testing.T) {
+	attempts := 0
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusNotFound)
+	}), WithRetries(2, time.Second, time.Minute), WithClock(&fakeClock{}))
+	_, err := client.Repo(context.Background(), "owner/repo")
+	require.Error(t, err)
+	require.Equal(t, 1, attempts)
+}
+
+func TestNoRetryByDefault(t *testing.T) {
+	attempts := 0
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), WithClock(&fakeClock{}))
+	_, err := client.Repo(context.Background(), "owner/repo")
+	require.Error(t, err)
+	require.Equal(t, 1, attempts)
+}
+
+func TestNoRetryOnMalformedRequest(t *testing.T) {
+	clock := &fakeClock{}
+	client := New("", WithRetries(2, time.Second, time.Minute), WithClock(clock))
+	_, err := client.Repo(context.Background(), "owner/%zz")
+	require.Error(t, err)
+	require.Empty(t, clock.sleeps)
+}
+
+func TestRetryOnConnectionRefused(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	clock := &fakeClock{}
+	client := New("", WithRetries(2, time.Second, time.Minute), WithClock(clock), WithRand(func() float64 { return 0 }))
+	client.apiURL = srv.URL
+	_, err := client.Repo(context.Background(), "owner/repo")
+	require.Error(t, err)
+	require.Equal(t, []time.Duration{500 * time.Millisecond, time.Second}, clock.sleeps)
+}
+
+func TestNoRetryOnCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	require.False(t, isRetryable(errors.WithStack(&url.Error{Op: "Get", URL: "https://api.github.com", Err: ctx.Err()})))
+}
+
+// A Clock whose timers never fire.
+type stoppedClock struct{ fakeClock }
+
+func (s *stoppedClock) After(d time.Duration) <-chan time.Time {
+	s.sleeps = append(s.sleeps, d)
+	return nil
+}
+
+func TestCancellingContextAbandonsRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	attempts := 0
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}), WithRetries(2, time.Second, time.Minute), WithClock(&stoppedClock{}))
+	_, err := client.Repo(ctx, "owner/repo")
+	require.True(t, errors.Is(err, context.Canceled), "%+v", err)
+	require.Equal(t, 1, attempts)
+}
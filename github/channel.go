@@ -0,0 +1,36 @@
+package github
+
+import (
+	"context"
+	"strings"
+)
+
+type channelKey struct{}
+
+// WithChannel returns a context carrying the release channel (eg. "beta") used by LatestRelease.
+//
+// An empty channel or "stable" selects the latest stable release.
+func WithChannel(ctx context.Context, channel string) context.Context {
+	return context.WithValue(ctx, channelKey{}, channel)
+}
+
+// ChannelFromContext returns the release channel carried by ctx, or "" if none.
+func ChannelFromContext(ctx context.Context) string {
+	channel, _ := ctx.Value(channelKey{}).(string)
+	return channel
+}
+
+// Returns true if the release is a pre-release on the given channel.
+//
+// The channel is matched against the first identifier of the pre-release
+// component of the tag with any trailing digits removed, so "beta" matches
+// "v1.2.0-beta", "v1.2.0-beta.1" and "v1.2.0-beta2", but not "v1.2.0-betamax.1".
+func (r *Release) onChannel(channel string) bool {
+	parts := strings.SplitN(r.TagName, "-", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	identifier := strings.SplitN(parts[1], ".", 2)[0]
+	identifier = strings.TrimRight(identifier, "0123456789")
+	return strings.EqualFold(identifier, channel)
+}
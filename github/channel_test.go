@@ -0,0 +1,66 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestReleaseChannel(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/owner/repo/releases/latest":
+			fmt.Fprint(w, `{"tag_name": "v1.0.0"}`)
+		case "/repos/owner/repo/releases":
+			fmt.Fprint(w, `[
+				{"tag_name": "v1.3.0-betamax.1", "prerelease": true},
+				{"tag_name": "v1.2.0-rc.1", "prerelease": true},
+				{"tag_name": "v1.2.0-beta.3", "prerelease": true, "draft": true},
+				{"tag_name": "v1.2.0-beta.2", "prerelease": true},
+				{"tag_name": "v1.2.0-beta.1", "prerelease": true},
+				{"tag_name": "v1.0.0"}
+			]`)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	tests := []struct {
+		channel  string
+		expected string
+	}{
+		{"", "v1.0.0"},
+		{"stable", "v1.0.0"},
+		{"beta", "v1.2.0-beta.2"},
+		{"rc", "v1.2.0-rc.1"},
+		{"alpha", "v1.0.0"},
+		{"b", "v1.0.0"},
+		{"bet", "v1.0.0"},
+		{"betamax", "v1.3.0-betamax.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.channel, func(t *testing.T) {
+			release, err := client.LatestRelease(WithChannel(context.Background(), test.channel), "owner/repo")
+			require.NoError(t, err)
+			require.Equal(t, test.expected, release.TagName)
+		})
+	}
+}
+
+func TestLatestReleaseChannelStopsEarly(t *testing.T) {
+	requests := 0
+	pages := paginatedHandler("/repos/owner/repo/releases",
+		`[{"tag_name": "v1.2.0-beta.1", "prerelease": true}]`,
+		`[{"tag_name": "v1.1.0"}]`,
+	)
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		pages.ServeHTTP(w, r)
+	}))
+	release, err := client.LatestRelease(WithChannel(context.Background(), "beta"), "owner/repo")
+	require.NoError(t, err)
+	require.Equal(t, "v1.2.0-beta.1", release.TagName)
+	require.Equal(t, 1, requests)
+}
@@ -0,0 +1,106 @@
+package github
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/cashapp/hermit/platform"
+)
+
+type classifier struct {
+	re    *regexp.Regexp
+	value string
+}
+
+// Build a classifier matching any of the aliases as a delimited token.
+func tokenClassifier(value string, aliases ...string) classifier {
+	return classifier{
+		re:    regexp.MustCompile(`(?:^|[^a-z0-9])(?:` + strings.Join(aliases, "|") + `)(?:[^a-z0-9]|$)`),
+		value: value,
+	}
+}
+
+var (
+	osClassifiers = []classifier{
+		tokenClassifier(platform.Darwin, "darwin", "macos", "osx", "mac", "apple"),
+		tokenClassifier(platform.Linux, "linux"),
+		tokenClassifier("windows", "windows", "win", "win32", "win64"),
+		tokenClassifier("freebsd", "freebsd"),
+	}
+	// Order is significant: eg. "x86" is a prefix of "x86_64", and the generic
+	// bitness aliases must only be considered once the ARM variants have been ruled out.
+	archClassifiers = []classifier{
+		tokenClassifier(platform.Amd64, "amd64", "x86_64", "x86-64", "x64"),
+		tokenClassifier(platform.Arm64, "arm64", "aarch64", "armv8", "arm[-_]64bit", "arm[-_]64-bit"),
+		tokenClassifier("arm", "arm", "armv6", "armv6l", "armv7", "armv7l", "armhf"),
+		tokenClassifier("386", "386", "i386", "i686", "x86"),
+		tokenClassifier(platform.Amd64, "64bit", "64-bit"),
+		tokenClassifier("386", "32bit", "32-bit"),
+	}
+)
+
+// ClassifyAsset infers the platform a release asset targets from its name.
+//
+// Returns false if the asset is a checksum or signature, or if either the OS
+// or architecture can't be determined.
+func ClassifyAsset(asset Asset) (platform.Platform, bool) {
+	name := strings.ToLower(asset.Name)
+	if isVerificationAsset(name) {
+		return platform.Platform{}, false
+	}
+	os := classify(name, osClassifiers)
+	arch := classify(name, archClassifiers)
+	if os == "" || arch == "" {
+		return platform.Platform{}, false
+	}
+	return platform.Platform{OS: os, Arch: arch}, true
+}
+
+// MatrixReport compares the assets in a release against a matrix of expected
+// "os/arch" targets (eg. "linux/amd64").
+//
+// "missing" lists the expected targets with no corresponding asset, and
+// "extra" lists the names of assets classified as targeting a platform outside
+// of the matrix. Assets that can't be classified, such as checksums or source
+// archives, are ignored.
+func MatrixReport(release *Release, expected []string) (missing []string, extra []string) {
+	want := map[string]bool{}
+	for _, target := range expected {
+		want[strings.ToLower(target)] = true
+	}
+	found := map[string]bool{}
+	var assets []Asset
+	if release != nil {
+		assets = release.Assets
+	}
+	for _, asset := range assets {
+		plat, ok := ClassifyAsset(asset)
+		if !ok {
+			continue
+		}
+		target := plat.OS + "/" + plat.Arch
+		if want[target] {
+			found[target] = true
+		} else {
+			extra = append(extra, asset.Name)
+		}
+	}
+	for target := range want {
+		if !found[target] {
+			missing = append(missing, target)
+		}
+	}
+	sort.Strings(missing)
+	sort.Strings(extra)
+	return missing, extra
+}
+
+func classify(name string, classifiers []classifier) string {
+	for _, c := range classifiers {
+		if c.re.MatchString(name) {
+			return c.value
+		}
+	}
+	return ""
+}
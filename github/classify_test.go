@@ -0,0 +1,63 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/platform"
+)
+
+func TestClassifyAsset(t *testing.T) {
+	tests := []struct {
+		name     string
+		expected string
+	}{
+		{"tool-1.0.0-linux-amd64.tar.gz", "linux-amd64"},
+		{"tool_1.0.0_Linux_x86_64.tar.gz", "linux-amd64"},
+		{"tool-aarch64-unknown-linux-gnu.tar.gz", "linux-arm64"},
+		{"tool-x86_64-apple-darwin.tar.gz", "darwin-amd64"},
+		{"tool-macos-arm64.zip", "darwin-arm64"},
+		{"tool-windows-386.zip", "windows-386"},
+		{"tool-linux-armv7.tar.gz", "linux-arm"},
+		{"tool-linux-arm-64bit.tar.gz", "linux-arm64"},
+		{"tool-linux-64bit.tar.gz", "linux-amd64"},
+		{"tool-linux-32bit.tar.gz", "linux-386"},
+		{"tool-linux-amd64.tar.gz.sha256", ""},
+		{"checksums.txt", ""},
+		{"tool-source.tar.gz", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plat, ok := ClassifyAsset(Asset{Name: test.name})
+			if test.expected == "" {
+				require.False(t, ok, "%s", plat)
+				return
+			}
+			require.True(t, ok)
+			require.Equal(t, test.expected, plat.String())
+		})
+	}
+}
+
+func TestMatrixReport(t *testing.T) {
+	release := &Release{TagName: "v1.0.0", Assets: []Asset{
+		{Name: "tool-linux-amd64.tar.gz"},
+		{Name: "tool-darwin-amd64.tar.gz"},
+		{Name: "tool-windows-amd64.zip"},
+		{Name: "checksums.txt"},
+	}}
+	expected := []string{}
+	for _, plat := range platform.Core {
+		expected = append(expected, plat.OS+"/"+plat.Arch)
+	}
+	missing, extra := MatrixReport(release, expected)
+	require.Equal(t, []string{"darwin/arm64"}, missing)
+	require.Equal(t, []string{"tool-windows-amd64.zip"}, extra)
+}
+
+func TestMatrixReportNilRelease(t *testing.T) {
+	missing, extra := MatrixReport(nil, []string{"linux/amd64", "darwin/arm64"})
+	require.Equal(t, []string{"darwin/arm64", "linux/amd64"}, missing)
+	require.Empty(t, extra)
+}
@@ -0,0 +1,83 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// AmbiguousRefError is returned by Commit and CommitSHA when GitHub cannot
+// resolve a ref unambiguously, typically because an abbreviated SHA matches
+// multiple commits.
+type AmbiguousRefError struct {
+	Repo string
+	Ref  string
+	// Message from GitHub, if any.
+	Message string
+}
+
+func (a *AmbiguousRefError) Error() string {
+	msg := fmt.Sprintf("%s: ref %q is ambiguous, use a longer SHA", a.Repo, a.Ref)
+	if a.Message != "" {
+		msg += ": " + a.Message
+	}
+	return msg
+}
+
+// Commit retrieves the commit that ref (a SHA, branch or tag) resolves to.
+func (a *Client) Commit(ctx context.Context, repo, ref string) (*Commit, error) {
+	url := fmt.Sprintf("%s/repos/%s/commits/%s", a.apiURL, repo, url.PathEscape(ref))
+	commit := &Commit{}
+	if err := a.decode(ctx, url, commit); err != nil {
+		return nil, ambiguousRefError(repo, ref, err)
+	}
+	return commit, nil
+}
+
+// CommitSHA resolves ref (a SHA, branch or tag) to a full commit SHA.
+//
+// This is cheaper than Commit as GitHub returns only the SHA.
+func (a *Client) CommitSHA(ctx context.Context, repo, ref string) (string, error) {
+	url := fmt.Sprintf("%s/repos/%s/commits/%s", a.apiURL, repo, url.PathEscape(ref))
+	var sha string
+	err := a.retry(ctx, func() error {
+		headers := a.metadataHeaders()
+		headers.Set("Accept", "application/vnd.github.v3.sha")
+		req, err := a.request(ctx, url, headers)
+		if err != nil {
+			return errors.Wrap(err, url)
+		}
+		resp, err := a.client.Do(req)
+		if err != nil {
+			return errors.Wrap(err, url)
+		}
+		defer resp.Body.Close()
+		if err := checkResponse(url, resp); err != nil {
+			return errors.WithStack(err)
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if err != nil {
+			return errors.Wrap(err, url)
+		}
+		sha = strings.TrimSpace(string(body))
+		return nil
+	})
+	if err != nil {
+		return "", ambiguousRefError(repo, ref, err)
+	}
+	return sha, nil
+}
+
+// Convert a 422 Unprocessable Entity response into an AmbiguousRefError.
+func ambiguousRefError(repo, ref string, err error) error {
+	var serr *statusError
+	if errors.As(err, &serr) && serr.statusCode == http.StatusUnprocessableEntity {
+		return errors.WithStack(&AmbiguousRefError{Repo: repo, Ref: ref, Message: serr.message})
+	}
+	return err
+}
@@ -0,0 +1,48 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAmbiguousCommitSHA(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		fmt.Fprint(w, `{"message": "The SHA abc is ambiguous", "documentation_url": "https://docs.github.com/rest"}`)
+	}))
+	_, err := client.Commit(context.Background(), "owner/repo", "abc")
+	var aerr *AmbiguousRefError
+	require.True(t, errors.As(err, &aerr), "%+v", err)
+	require.Equal(t, "abc", aerr.Ref)
+	require.Equal(t, `owner/repo: ref "abc" is ambiguous, use a longer SHA: The SHA abc is ambiguous`, aerr.Error())
+
+	_, err = client.CommitSHA(context.Background(), "owner/repo", "abc")
+	require.True(t, errors.As(err, &aerr), "%+v", err)
+}
+
+func TestCommitSHA(t *testing.T) {
+	var accept string
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		accept = r.Header.Get("Accept")
+		fmt.Fprint(w, "0123456789abcdef0123456789abcdef01234567")
+	}))
+	sha, err := client.CommitSHA(context.Background(), "owner/repo", "0123456")
+	require.NoError(t, err)
+	require.Equal(t, "0123456789abcdef0123456789abcdef01234567", sha)
+	require.Equal(t, "application/vnd.github.v3.sha", accept)
+}
+
+func TestCommitNotFoundIsNotAmbiguous(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	_, err := client.Commit(context.Background(), "owner/repo", "abc")
+	var aerr *AmbiguousRefError
+	require.Error(t, err)
+	require.False(t, errors.As(err, &aerr))
+}
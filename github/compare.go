@@ -0,0 +1,66 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// comparePageSize is the number of commits requested per page of a comparison.
+const comparePageSize = 100
+
+// Commit is a minimal type for commit information retrieved via the GitHub API.
+//
+// See https://docs.github.com/en/rest/reference/repos#get-a-commit
+type Commit struct {
+	SHA     string       `json:"sha"`
+	HTMLURL string       `json:"html_url"`
+	Commit  CommitDetail `json:"commit"`
+}
+
+// CommitDetail is the git-level information for a Commit.
+type CommitDetail struct {
+	Message string       `json:"message"`
+	Author  CommitAuthor `json:"author"`
+}
+
+// CommitAuthor of a Commit.
+type CommitAuthor struct {
+	Name  string    `json:"name"`
+	Email string    `json:"email"`
+	Date  time.Time `json:"date"`
+}
+
+// Comparison between two refs in a repository.
+//
+// See https://docs.github.com/en/rest/reference/repos#compare-two-commits
+type Comparison struct {
+	// Status is one of "diverged", "ahead", "behind" or "identical".
+	Status       string   `json:"status"`
+	AheadBy      int      `json:"ahead_by"`
+	BehindBy     int      `json:"behind_by"`
+	TotalCommits int      `json:"total_commits"`
+	Commits      []Commit `json:"commits"`
+}
+
+// Compare two refs in a repository, returning the commits reachable from head but not from base.
+//
+// Large comparisons are paginated by GitHub, in which case all pages are retrieved.
+func (a *Client) Compare(ctx context.Context, repo, base, head string) (*Comparison, error) {
+	comparison := &Comparison{}
+	base, head = url.PathEscape(base), url.PathEscape(head)
+	for page := 1; ; page++ {
+		url := fmt.Sprintf("%s/repos/%s/compare/%s...%s?per_page=%d&page=%d", a.apiURL, repo, base, head, comparePageSize, page)
+		next := &Comparison{}
+		if err := a.decode(ctx, url, next); err != nil {
+			return nil, err
+		}
+		commits := append(comparison.Commits, next.Commits...)
+		*comparison = *next
+		comparison.Commits = commits
+		if len(next.Commits) == 0 || len(comparison.Commits) >= comparison.TotalCommits {
+			return comparison, nil
+		}
+	}
+}
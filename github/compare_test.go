@@ -0,0 +1,57 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompare(t *testing.T) {
+	pages := map[string]string{
+		"1": `{
+			"status": "ahead",
+			"ahead_by": 3,
+			"behind_by": 0,
+			"total_commits": 3,
+			"commits": [
+				{"sha": "aaa", "html_url": "https://github.com/owner/repo/commit/aaa", "commit": {"message": "First", "author": {"name": "Alice", "email": "alice@example.com", "date": "2021-01-01T00:00:00Z"}}},
+				{"sha": "bbb", "commit": {"message": "Second"}}
+			]
+		}`,
+		"2": `{
+			"status": "ahead",
+			"ahead_by": 3,
+			"behind_by": 0,
+			"total_commits": 3,
+			"commits": [
+				{"sha": "ccc", "commit": {"message": "Third"}}
+			]
+		}`,
+	}
+	paths := []string{}
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		page, ok := pages[r.URL.Query().Get("page")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		fmt.Fprint(w, page)
+	}))
+	comparison, err := client.Compare(context.Background(), "owner/repo", "v1.0.0", "main")
+	require.NoError(t, err)
+	require.Equal(t, []string{"/repos/owner/repo/compare/v1.0.0...main", "/repos/owner/repo/compare/v1.0.0...main"}, paths)
+	require.Equal(t, "ahead", comparison.Status)
+	require.Equal(t, 3, comparison.AheadBy)
+	require.Equal(t, 0, comparison.BehindBy)
+	shas := []string{}
+	for _, commit := range comparison.Commits {
+		shas = append(shas, commit.SHA)
+	}
+	require.Equal(t, []string{"aaa", "bbb", "ccc"}, shas)
+	require.Equal(t, "First", comparison.Commits[0].Commit.Message)
+	require.Equal(t, "Alice", comparison.Commits[0].Commit.Author.Name)
+}
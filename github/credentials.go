@@ -0,0 +1,176 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/util"
+)
+
+// How long to wait for "gh auth token".
+const ghCLITimeout = 5 * time.Second
+
+// A TokenSource returns a GitHub token, or "" if it has none.
+type TokenSource func() (string, error)
+
+// StaticToken returns a TokenSource that always returns "token".
+func StaticToken(token string) TokenSource {
+	return func() (string, error) { return token, nil }
+}
+
+// EnvToken returns a TokenSource that returns the value of the first of the
+// environment variables "names" that is set.
+func EnvToken(names ...string) TokenSource {
+	return func() (string, error) {
+		for _, name := range names {
+			if token := os.Getenv(name); token != "" {
+				return token, nil
+			}
+		}
+		return "", nil
+	}
+}
+
+// GHCLIToken returns a TokenSource that returns the token the gh CLI is
+// logged in to "host" with, as printed by "gh auth token".
+//
+// It has no token if gh isn't installed or isn't logged in.
+func GHCLIToken(host string) TokenSource {
+	return func() (string, error) {
+		binary, err := exec.LookPath("gh")
+		if err != nil {
+			return "", nil // nolint: nilerr
+		}
+		return ghCLIToken(binary, host), nil
+	}
+}
+
+func ghCLIToken(binary, host string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), ghCLITimeout)
+	defer cancel()
+	stdout := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, binary, "auth", "token", "--hostname", host) // nolint: gosec
+	cmd.Stdout = stdout
+	if err := cmd.Run(); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(stdout.String())
+}
+
+// NetrcToken returns a TokenSource that returns the password of the first of
+// "hosts" in the user's netrc file (see util.NetrcPath). Its "default" entry is ignored.
+func NetrcToken(hosts ...string) TokenSource {
+	return func() (string, error) {
+		return netrcToken(util.NetrcPath(), hosts...)
+	}
+}
+
+func netrcToken(path string, hosts ...string) (string, error) {
+	if path == "" {
+		return "", nil
+	}
+	for _, host := range hosts {
+		entry, err := util.Netrc(path, host)
+		if err != nil {
+			return "", errors.Wrap(err, path)
+		}
+		// A "default" entry is unlikely to be meant for GitHub, and would break access to public repositories.
+		if entry != nil && !entry.Default && entry.Password != "" {
+			return entry.Password, nil
+		}
+	}
+	return "", nil
+}
+
+// ChainTokens returns a TokenSource that returns the token of the first of "sources" that has one.
+func ChainTokens(sources ...TokenSource) TokenSource {
+	return func() (string, error) {
+		for _, source := range sources {
+			token, err := source()
+			if err != nil {
+				return "", err
+			}
+			if token != "" {
+				return token, nil
+			}
+		}
+		return "", nil
+	}
+}
+
+// DefaultTokenSource returns a TokenSource that uses the first token found for
+// the GitHub instance at "webHost" (eg. "github.com") and its API at
+// "apiHost", in order:
+//
+//  1. $HERMIT_GITHUB_TOKEN or $GITHUB_TOKEN.
+//  2. The token the gh CLI is logged in with.
+//  3. The password for either host in the user's netrc file.
+func DefaultTokenSource(webHost, apiHost string) TokenSource {
+	return ChainTokens(
+		EnvToken("HERMIT_GITHUB_TOKEN", "GITHUB_TOKEN"),
+		GHCLIToken(webHost),
+		NetrcToken(webHost, apiHost),
+	)
+}
+
+// DefaultTokenAvailable returns true if DefaultTokenSource may find a token
+// for "webHost" and "apiHost", without running the gh CLI.
+//
+// The gh CLI is assumed to have a token if its configuration lists the host.
+func DefaultTokenAvailable(webHost, apiHost string) bool {
+	if os.Getenv("HERMIT_GITHUB_TOKEN") != "" || os.Getenv("GITHUB_TOKEN") != "" {
+		return true
+	}
+	if _, err := exec.LookPath("gh"); err == nil && ghCLIConfigured(ghCLIConfigDir(), webHost) {
+		return true
+	}
+	token, err := netrcToken(util.NetrcPath(), webHost, apiHost)
+	return err != nil || token != ""
+}
+
+// The directory the gh CLI stores its configuration in.
+func ghCLIConfigDir() string {
+	if dir := os.Getenv("GH_CONFIG_DIR"); dir != "" {
+		return dir
+	}
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "gh")
+	}
+	if dir := os.Getenv("AppData"); runtime.GOOS == "windows" && dir != "" {
+		return filepath.Join(dir, "GitHub CLI")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".config", "gh")
+}
+
+// Returns true if the gh CLI has a token for "host", either from its
+// environment variables or from a login recorded in its hosts.yml.
+func ghCLIConfigured(configDir, host string) bool {
+	if os.Getenv("GH_TOKEN") != "" || os.Getenv("GH_ENTERPRISE_TOKEN") != "" {
+		return true
+	}
+	if configDir == "" {
+		return false
+	}
+	hosts, err := os.ReadFile(filepath.Join(configDir, "hosts.yml"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(hosts), "\n") {
+		if strings.TrimRight(line, " \r") == host+":" {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package github
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChainTokens(t *testing.T) {
+	calls := 0
+	counted := func(token string) TokenSource {
+		return func() (string, error) {
+			calls++
+			return token, nil
+		}
+	}
+	token, err := ChainTokens(counted(""), counted("second"), counted("third"))()
+	require.NoError(t, err)
+	require.Equal(t, "second", token)
+	require.Equal(t, 2, calls)
+
+	_, err = ChainTokens(func() (string, error) { return "", errors.New("failed") }, StaticToken("ignored"))()
+	require.EqualError(t, err, "failed")
+}
+
+func TestNetrcToken(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "netrc")
+	err := os.WriteFile(path, []byte("machine api.github.com login hermit password api-token\ndefault login anonymous password guest\n"), 0600)
+	require.NoError(t, err)
+	token, err := netrcToken(path, "github.com", "api.github.com")
+	require.NoError(t, err)
+	require.Equal(t, "api-token", token)
+	token, err = netrcToken(path, "github.example.com")
+	require.NoError(t, err)
+	require.Equal(t, "", token)
+	token, err = netrcToken(filepath.Join(t.TempDir(), "missing"), "github.com")
+	require.NoError(t, err)
+	require.Equal(t, "", token)
+}
+
+func TestGHCLIToken(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script")
+	}
+	dir := t.TempDir()
+	gh := filepath.Join(dir, "gh")
+	script := `#!/bin/sh
+if [ "$*" = "auth token --hostname github.example.com" ]; then echo gh-token; exit 0; fi
+echo "not logged in" >&2
+exit 1
+`
+	require.NoError(t, os.WriteFile(gh, []byte(script), 0700)) // nolint: gosec
+	require.Equal(t, "gh-token", ghCLIToken(gh, "github.example.com"))
+	require.Equal(t, "", ghCLIToken(gh, "github.com"))
+}
+
+func TestTokenResolvedOnFirstUse(t *testing.T) {
+	calls := 0
+	client := New("", WithTokenSource(func() (string, error) {
+		calls++
+		return "lazy", nil
+	}))
+	require.Equal(t, 0, calls)
+	require.True(t, client.Authenticated())
+	require.True(t, client.Authenticated())
+	require.Equal(t, 1, calls)
+	require.False(t, New("").Authenticated())
+}
+
+func TestGHCLIConfigured(t *testing.T) {
+	t.Setenv("GH_TOKEN", "")
+	t.Setenv("GH_ENTERPRISE_TOKEN", "")
+	dir := t.TempDir()
+	require.False(t, ghCLIConfigured(dir, "github.com"))
+	hosts := "github.example.com:\n    user: hermit\n    git_protocol: https\n"
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "hosts.yml"), []byte(hosts), 0600))
+	require.True(t, ghCLIConfigured(dir, "github.example.com"))
+	require.False(t, ghCLIConfigured(dir, "github.com"))
+	t.Setenv("GH_TOKEN", "token")
+	require.True(t, ghCLIConfigured(dir, "github.com"))
+}
@@ -0,0 +1,75 @@
+package github
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+)
+
+// A cached API response.
+type etagEntry struct {
+	ETag string `json:"etag"`
+	Link string `json:"link,omitempty"`
+	Body []byte `json:"body"`
+}
+
+// etagCache is an on-disk cache of API responses keyed by request,
+// revalidated with conditional requests.
+//
+// GitHub does not count 304 Not Modified responses against the rate limit.
+type etagCache struct {
+	dir string
+}
+
+func (e *etagCache) path(req *http.Request) string {
+	h := sha256.New()
+	for _, part := range []string{req.URL.String(), req.Header.Get("Accept"), req.Header.Get("Accept-Language")} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return filepath.Join(e.dir, hex.EncodeToString(h.Sum(nil))+".json")
+}
+
+// Load the cached response for req, if any.
+//
+// Unreadable entries are treated as missing.
+func (e *etagCache) load(req *http.Request) *etagEntry {
+	data, err := os.ReadFile(e.path(req))
+	if err != nil {
+		return nil
+	}
+	entry := &etagEntry{}
+	if err := json.Unmarshal(data, entry); err != nil || entry.ETag == "" {
+		return nil
+	}
+	return entry
+}
+
+func (e *etagCache) store(req *http.Request, entry *etagEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.MkdirAll(e.dir, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	path := e.path(req)
+	w, err := os.CreateTemp(e.dir, filepath.Base(path)+".*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(w.Name()) // nolint: errcheck
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return errors.WithStack(err)
+	}
+	if err := w.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(w.Name(), path))
+}
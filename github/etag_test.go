@@ -0,0 +1,47 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestETagCache(t *testing.T) {
+	var (
+		conditional []string
+		description = "A tool"
+	)
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conditional = append(conditional, r.Header.Get("If-None-Match"))
+		etag := fmt.Sprintf("%q", description)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprintf(w, `{"description": %q}`, description)
+	}), WithCache(t.TempDir()))
+
+	for i := 0; i < 2; i++ {
+		repo, err := client.Repo(context.Background(), "owner/repo")
+		require.NoError(t, err)
+		require.Equal(t, "A tool", repo.Description)
+	}
+	description = "A changed tool"
+	repo, err := client.Repo(context.Background(), "owner/repo")
+	require.NoError(t, err)
+	require.Equal(t, "A changed tool", repo.Description)
+
+	require.Equal(t, []string{"", `"A tool"`, `"A tool"`}, conditional)
+}
+
+func TestETagCacheNotModifiedWithoutEntry(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}), WithCache(t.TempDir()))
+	_, err := client.Repo(context.Background(), "owner/repo")
+	require.Error(t, err)
+}
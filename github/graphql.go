@@ -0,0 +1,223 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Maximum number of repositories queried in a single GraphQL request.
+const graphQLBatchSize = 50
+
+// Fields of the latest release retrieved for each repository.
+const graphQLReleaseFields = `latestRelease {
+      tagName
+      isDraft
+      isPrerelease
+      releaseAssets(first: 100) {
+        nodes { databaseId name downloadUrl contentType size }
+      }
+    }`
+
+type graphQLError struct {
+	Type    string        `json:"type"`
+	Path    []interface{} `json:"path"`
+	Message string        `json:"message"`
+}
+
+type graphQLRelease struct {
+	TagName       string `json:"tagName"`
+	IsDraft       bool   `json:"isDraft"`
+	IsPrerelease  bool   `json:"isPrerelease"`
+	ReleaseAssets struct {
+		Nodes []struct {
+			DatabaseID  int64  `json:"databaseId"`
+			Name        string `json:"name"`
+			DownloadURL string `json:"downloadUrl"`
+			ContentType string `json:"contentType"`
+			Size        int64  `json:"size"`
+		} `json:"nodes"`
+	} `json:"releaseAssets"`
+}
+
+// LatestReleases retrieves the latest release of each of "repos", keyed by repo.
+//
+// If the client has a token, releases are retrieved from the GraphQL API for
+// up to 50 repositories per request. Otherwise, as the GraphQL API requires
+// authentication, or if ctx carries a release channel other than "stable",
+// each release is retrieved with LatestRelease.
+//
+// Repositories that don't exist or have no releases are omitted. Release
+// assets retrieved via GraphQL don't carry digests.
+func (a *Client) LatestReleases(ctx context.Context, repos []string) (map[string]*Release, error) {
+	repos = uniqueRepos(repos)
+	out := map[string]*Release{}
+	if !a.Authenticated() || (ChannelFromContext(ctx) != "" && ChannelFromContext(ctx) != "stable") {
+		for _, repo := range repos {
+			release, err := a.LatestRelease(ctx, repo)
+			var serr *statusError
+			if errors.As(err, &serr) && serr.statusCode == http.StatusNotFound {
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			out[repo] = release
+		}
+		return out, nil
+	}
+	for start := 0; start < len(repos); start += graphQLBatchSize {
+		end := start + graphQLBatchSize
+		if end > len(repos) {
+			end = len(repos)
+		}
+		if err := a.latestReleasesBatch(ctx, repos[start:end], out); err != nil {
+			return nil, err
+		}
+	}
+	return out, nil
+}
+
+// PrefetchLatestReleases retrieves the latest releases of "repos" with
+// LatestReleases, so that subsequent calls to LatestRelease for them don't
+// issue a request of their own.
+func (a *Client) PrefetchLatestReleases(ctx context.Context, repos []string) error {
+	releases, err := a.LatestReleases(ctx, repos)
+	if err != nil {
+		return err
+	}
+	a.prefetchLock.Lock()
+	defer a.prefetchLock.Unlock()
+	if a.prefetched == nil {
+		a.prefetched = map[string]*Release{}
+	}
+	for repo, release := range releases {
+		a.prefetched[repo] = release
+	}
+	return nil
+}
+
+// Return the prefetched latest release of "repo", if any.
+func (a *Client) prefetchedRelease(repo string) *Release {
+	a.prefetchLock.Lock()
+	defer a.prefetchLock.Unlock()
+	release, ok := a.prefetched[repo]
+	if !ok {
+		return nil
+	}
+	copied := *release
+	copied.Assets = append([]Asset(nil), release.Assets...)
+	return &copied
+}
+
+func (a *Client) latestReleasesBatch(ctx context.Context, repos []string, out map[string]*Release) error {
+	params := []string{}
+	fields := []string{}
+	variables := map[string]interface{}{}
+	for i, repo := range repos {
+		parts := strings.Split(repo, "/")
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return errors.Errorf("invalid GitHub repository %q, expected <owner>/<repo>", repo)
+		}
+		params = append(params, fmt.Sprintf("$o%d: String!, $n%d: String!", i, i))
+		fields = append(fields, fmt.Sprintf("  r%d: repository(owner: $o%d, name: $n%d) {\n    %s\n  }", i, i, i, graphQLReleaseFields))
+		variables[fmt.Sprintf("o%d", i)] = parts[0]
+		variables[fmt.Sprintf("n%d", i)] = parts[1]
+	}
+	query := "query(" + strings.Join(params, ", ") + ") {\n" + strings.Join(fields, "\n") + "\n}"
+	response := struct {
+		Data map[string]*struct {
+			LatestRelease *graphQLRelease `json:"latestRelease"`
+		} `json:"data"`
+		Errors []graphQLError `json:"errors"`
+	}{}
+	if err := a.graphQL(ctx, query, variables, &response); err != nil {
+		return err
+	}
+	for _, gerr := range response.Errors {
+		// Missing repositories are reported as errors, but don't fail the rest of the query.
+		if gerr.Type == "NOT_FOUND" {
+			continue
+		}
+		return errors.Errorf("GitHub GraphQL query failed: %s", gerr.Message)
+	}
+	for i, repo := range repos {
+		result := response.Data[fmt.Sprintf("r%d", i)]
+		if result == nil || result.LatestRelease == nil {
+			continue
+		}
+		out[repo] = a.graphQLToRelease(repo, result.LatestRelease)
+	}
+	return nil
+}
+
+// Convert a GraphQL release to the shape returned by the REST API.
+func (a *Client) graphQLToRelease(repo string, gr *graphQLRelease) *Release {
+	release := &Release{TagName: gr.TagName, Draft: gr.IsDraft, Prerelease: gr.IsPrerelease}
+	for _, node := range gr.ReleaseAssets.Nodes {
+		release.Assets = append(release.Assets, Asset{
+			ID:                 node.DatabaseID,
+			Name:               node.Name,
+			URL:                fmt.Sprintf("%s/repos/%s/releases/assets/%d", a.apiURL, repo, node.DatabaseID),
+			BrowserDownloadURL: node.DownloadURL,
+			ContentType:        node.ContentType,
+			Size:               node.Size,
+		})
+	}
+	return release
+}
+
+// Send a GraphQL query, decoding the response into "dest".
+func (a *Client) graphQL(ctx context.Context, query string, variables map[string]interface{}, dest interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"query": query, "variables": variables})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	url := a.graphQLURL()
+	return a.retry(ctx, func() error {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		if a.language != "" {
+			req.Header.Set("Accept-Language", a.language)
+		}
+		resp, err := a.client.Do(req)
+		if err != nil {
+			return errors.Wrap(err, url)
+		}
+		defer resp.Body.Close()
+		if err := checkResponse(url, resp); err != nil {
+			return errors.WithStack(err)
+		}
+		if err := json.NewDecoder(resp.Body).Decode(dest); err != nil {
+			return errors.Wrap(describeDecodeError(err), url)
+		}
+		return nil
+	})
+}
+
+// The GraphQL endpoint, which for GitHub Enterprise Server is not below the REST API.
+func (a *Client) graphQLURL() string {
+	if strings.HasSuffix(a.apiURL, "/api/v3") {
+		return strings.TrimSuffix(a.apiURL, "/v3") + "/graphql"
+	}
+	return a.apiURL + "/graphql"
+}
+
+func uniqueRepos(repos []string) []string {
+	seen := map[string]bool{}
+	out := make([]string, 0, len(repos))
+	for _, repo := range repos {
+		if !seen[repo] {
+			seen[repo] = true
+			out = append(out, repo)
+		}
+	}
+	return out
+}
@@ -0,0 +1,112 @@
+package github
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLatestReleasesGraphQL(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		requests int
+		auth     string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests++
+		auth = r.Header.Get("Authorization")
+		lock.Unlock()
+		if r.Method != http.MethodPost || r.URL.Path != "/graphql" {
+			http.NotFound(w, r)
+			return
+		}
+		query := struct {
+			Query     string            `json:"query"`
+			Variables map[string]string `json:"variables"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&query); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		data := map[string]interface{}{}
+		errs := []map[string]interface{}{}
+		for i := 0; query.Variables[fmt.Sprintf("o%d", i)] != ""; i++ {
+			alias := fmt.Sprintf("r%d", i)
+			name := query.Variables[fmt.Sprintf("n%d", i)]
+			switch {
+			case name == "missing":
+				data[alias] = nil
+				errs = append(errs, map[string]interface{}{"type": "NOT_FOUND", "path": []string{alias}, "message": "not found"})
+			case name == "unreleased":
+				data[alias] = map[string]interface{}{"latestRelease": nil}
+			default:
+				data[alias] = map[string]interface{}{"latestRelease": map[string]interface{}{
+					"tagName": "v1.0.0-" + name,
+					"releaseAssets": map[string]interface{}{"nodes": []map[string]interface{}{
+						{"databaseId": 42, "name": name + ".tar.gz", "downloadUrl": "https://example.com/" + name + ".tar.gz", "size": 10},
+					}},
+				}}
+			}
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": data, "errors": errs})
+	}))
+	defer srv.Close()
+	client := New("", WithBaseURL(srv.URL, srv.URL), WithTokenSource(StaticToken("secret")))
+
+	repos := []string{"owner/missing", "owner/unreleased", "owner/missing"}
+	for i := 0; i < 60; i++ {
+		repos = append(repos, fmt.Sprintf("owner/repo%d", i))
+	}
+	releases, err := client.LatestReleases(context.Background(), repos)
+	require.NoError(t, err)
+	require.Equal(t, 2, requests)
+	require.Equal(t, "token secret", auth)
+	require.Len(t, releases, 60)
+	require.Equal(t, &Release{TagName: "v1.0.0-repo7", Assets: []Asset{{
+		ID:                 42,
+		Name:               "repo7.tar.gz",
+		URL:                client.apiURL + "/repos/owner/repo7/releases/assets/42",
+		BrowserDownloadURL: "https://example.com/repo7.tar.gz",
+		Size:               10,
+	}}}, releases["owner/repo7"])
+
+	require.NoError(t, client.PrefetchLatestReleases(context.Background(), []string{"owner/repo1"}))
+	release, err := client.LatestRelease(context.Background(), "owner/repo1")
+	require.NoError(t, err)
+	require.Equal(t, "v1.0.0-repo1", release.TagName)
+	require.Equal(t, 3, requests)
+}
+
+func TestLatestReleasesFallsBackToREST(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		paths []string
+	)
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		paths = append(paths, r.URL.Path)
+		lock.Unlock()
+		if r.URL.Path != "/repos/owner/tool/releases/latest" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, `{"tag_name": "v2.0.0"}`)
+	}))
+	releases, err := client.LatestReleases(context.Background(), []string{"owner/tool", "owner/missing"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]*Release{"owner/tool": {TagName: "v2.0.0"}}, releases)
+	require.Equal(t, []string{"/repos/owner/tool/releases/latest", "/repos/owner/missing/releases/latest"}, paths)
+}
+
+func TestGraphQLURL(t *testing.T) {
+	client := New("", WithBaseURL("https://github.example.com/api/v3", "https://github.example.com"))
+	require.Equal(t, "https://github.example.com/api/graphql", client.graphQLURL())
+	require.Equal(t, "https://api.github.com/graphql", New("").graphQLURL())
+}
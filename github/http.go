@@ -10,21 +10,38 @@ import (
 // Conceptually similar to
 // https://github.com/google/go-github/blob/d23570d44313ca73dbcaadec71fc43eca4d29f8b/github/github.go#L841-L875
 func TokenAuthenticatedTransport(transport http.RoundTripper, token string) http.RoundTripper {
+	return tokenAuthenticatedTransport(transport, func() string { return token }, "github.com", "api.github.com")
+}
+
+// Inject the token returned by "token" into requests to any of "hosts" only.
+func tokenAuthenticatedTransport(transport http.RoundTripper, token func() string, hosts ...string) http.RoundTripper {
 	if transport == nil {
 		transport = http.DefaultTransport
 	}
-	return &githubAuthenticatedHTTPClient{rt: transport, token: token}
+	return &githubAuthenticatedHTTPClient{rt: transport, token: token, hosts: hosts}
 }
 
 type githubAuthenticatedHTTPClient struct {
-	token string
+	token func() string
+	hosts []string
 	rt    http.RoundTripper
 }
 
 func (g *githubAuthenticatedHTTPClient) RoundTrip(req *http.Request) (*http.Response, error) {
 	req = req.Clone(req.Context()) // The stdlib docs recommend not mutating the request in place.
-	if (req.URL.Host == "github.com" || req.URL.Host == "api.github.com") && g.token != "" {
-		req.Header.Set("Authorization", "token "+g.token)
+	if g.authenticated(req.URL.Host) {
+		if token := g.token(); token != "" {
+			req.Header.Set("Authorization", "token "+token)
+		}
 	}
 	return g.rt.RoundTrip(req)
 }
+
+func (g *githubAuthenticatedHTTPClient) authenticated(host string) bool {
+	for _, h := range g.hosts {
+		if host == h {
+			return true
+		}
+	}
+	return false
+}
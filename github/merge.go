@@ -0,0 +1,29 @@
+package github
+
+import (
+	"sort"
+)
+
+// MergeReleases merges sets of releases, such as those from a primary repo and
+// its mirrors, into a single list de-duplicated by tag.
+//
+// When a tag is present in multiple sets the release from the earliest set is
+// kept. The result is sorted newest first by semantic version, with any
+// non-semver tags last.
+func MergeReleases(sets ...[]Release) []Release {
+	seen := map[string]bool{}
+	merged := []Release{}
+	for _, set := range sets {
+		for _, release := range set {
+			if seen[release.TagName] {
+				continue
+			}
+			seen[release.TagName] = true
+			merged = append(merged, release)
+		}
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return compareTags(merged[i].TagName, merged[j].TagName) > 0
+	})
+	return merged
+}
@@ -0,0 +1,37 @@
+package github
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeReleases(t *testing.T) {
+	primary := []Release{
+		{TagName: "v1.10.0", Assets: []Asset{{Name: "primary"}}},
+		{TagName: "v1.2.0"},
+		{TagName: "v1.0.0"},
+	}
+	mirror := []Release{
+		{TagName: "v1.10.0", Assets: []Asset{{Name: "mirror"}}},
+		{TagName: "v1.11.0-rc.1"},
+		{TagName: "nightly"},
+		{TagName: "v1.1.0"},
+	}
+	merged := MergeReleases(primary, mirror)
+	tags := []string{}
+	for _, release := range merged {
+		tags = append(tags, release.TagName)
+	}
+	require.Equal(t, []string{"v1.11.0-rc.1", "v1.10.0", "v1.2.0", "v1.1.0", "v1.0.0", "nightly"}, tags)
+	require.Equal(t, "primary", merged[1].Assets[0].Name)
+}
+
+func TestCompareTags(t *testing.T) {
+	ordered := []string{"v1.0.0-alpha", "v1.0.0-alpha.1", "v1.0.0-alpha.beta", "v1.0.0-beta", "v1.0.0-beta.2", "v1.0.0-beta.11", "v1.0.0-rc.1", "v1.0.0", "1.0.1", "v2.0.0"}
+	for i := 0; i < len(ordered)-1; i++ {
+		require.Equal(t, -1, compareTags(ordered[i], ordered[i+1]), "%s < %s", ordered[i], ordered[i+1])
+		require.Equal(t, 1, compareTags(ordered[i+1], ordered[i]), "%s > %s", ordered[i+1], ordered[i])
+	}
+	require.Equal(t, 0, compareTags("v1.0.0", "1.0.0"))
+}
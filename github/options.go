@@ -0,0 +1,174 @@
+package github
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cashapp/hermit/ui"
+)
+
+// Option for configuring the GitHub Client.
+type Option func(*Client)
+
+// WithMaxRedirects sets the maximum number of redirects that will be followed
+// before a request fails with ErrTooManyRedirects.
+//
+// Defaults to 10.
+func WithMaxRedirects(n int) Option {
+	return func(c *Client) {
+		c.maxRedirects = n
+	}
+}
+
+// WithLogger sets the logger used to report non-fatal problems, such as unverifiable downloads.
+func WithLogger(logger ui.Logger) Option {
+	return func(c *Client) {
+		c.logger = logger
+	}
+}
+
+// WithRequireVerification sets the policy for downloading release assets
+// that have no checksum or signature available.
+//
+// The policy is only applied by DownloadReleaseAsset.
+//
+// Defaults to VerificationOff.
+func WithRequireVerification(level VerificationLevel) Option {
+	return func(c *Client) {
+		c.verification = level
+	}
+}
+
+// WithAcceptLanguage sets the Accept-Language header sent with API metadata requests (eg. "fr-CA").
+func WithAcceptLanguage(lang string) Option {
+	return func(c *Client) {
+		c.language = lang
+	}
+}
+
+// WithDownloadBufferSize sets the size of the buffer used to copy downloads in
+// DownloadTo and DownloadReliable.
+//
+// It only affects those: responses returned by Download and
+// DownloadReleaseAsset, such as those consumed by Hermit's cache, are copied
+// by the caller. Non-positive sizes are ignored. Defaults to 32KB.
+func WithDownloadBufferSize(n int) Option {
+	return func(c *Client) {
+		if n > 0 {
+			c.bufferSize = n
+		}
+	}
+}
+
+// WithRetries sets the maximum number of times a transiently failing API request
+// is retried, and the bounds of the exponential backoff between attempts.
+//
+// Defaults to no retries, backing off from 500ms up to 10s when enabled.
+func WithRetries(retries int, minBackoff, maxBackoff time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = retries
+		c.minBackoff = minBackoff
+		c.maxBackoff = maxBackoff
+	}
+}
+
+// WithClock overrides the Clock used for backoff. Intended for tests.
+func WithClock(clock Clock) Option {
+	return func(c *Client) {
+		c.clock = clock
+	}
+}
+
+// WithRand overrides the source of randomness used for backoff jitter.
+// "rand" must return a value in the range [0, 1). Intended for tests.
+func WithRand(rand func() float64) Option {
+	return func(c *Client) {
+		c.rand = rand
+	}
+}
+
+// WithParallelPagination retrieves up to n pages of paginated endpoints such as
+// Releases and Tags concurrently, once the first page has revealed the total
+// number of pages.
+//
+// Defaults to 1, ie. pages are retrieved sequentially.
+func WithParallelPagination(n int) Option {
+	return func(c *Client) {
+		c.parallelPages = n
+	}
+}
+
+// WithMinTLSVersion sets the minimum TLS version (eg. tls.VersionTLS13) for all
+// connections made by the Client.
+//
+// Defaults to TLS 1.2.
+func WithMinTLSVersion(version uint16) Option {
+	return func(c *Client) {
+		c.minTLSVersion = version
+	}
+}
+
+// WithMaxPages limits the number of pages retrieved from paginated endpoints
+// such as Releases and Tags. A limit of zero or less retrieves all pages.
+//
+// Defaults to 100 pages, ie. 10,000 items.
+func WithMaxPages(n int) Option {
+	return func(c *Client) {
+		c.maxPages = n
+	}
+}
+
+// WithRateLimitWait sets the maximum time to wait for the API rate limit to
+// reset before retrying. If the limit resets later than this, requests fail
+// immediately with a RateLimitError.
+//
+// Defaults to one minute.
+func WithRateLimitWait(wait time.Duration) Option {
+	return func(c *Client) {
+		c.rateLimitWait = wait
+	}
+}
+
+// WithCache enables an on-disk cache of API metadata responses in dir.
+//
+// Cached responses are revalidated with If-None-Match on every request, so
+// they are never stale, but unchanged responses are cheap and do not count
+// against the GitHub rate limit.
+//
+// Disabled by default.
+func WithCache(dir string) Option {
+	return func(c *Client) {
+		c.etags = &etagCache{dir: dir}
+	}
+}
+
+// WithBaseURL configures the client for a GitHub Enterprise Server instance.
+//
+// "api" is the REST API root (eg. "https://github.example.com/api/v3") and
+// "web" is the web UI root (eg. "https://github.example.com"), which is used
+// to recognise project URLs. The token is only sent to these hosts.
+//
+// Defaults to https://api.github.com and https://github.com.
+func WithBaseURL(api, web string) Option {
+	return func(c *Client) {
+		c.apiURL = strings.TrimSuffix(api, "/")
+		c.webURL = strings.TrimSuffix(web, "/")
+	}
+}
+
+// WithTransportWrapper wraps the client's HTTP transport, which includes
+// authentication, with "wrap", eg. to rewrite request URLs.
+func WithTransportWrapper(wrap func(http.RoundTripper) http.RoundTripper) Option {
+	return func(c *Client) {
+		c.wrapTransport = wrap
+	}
+}
+
+// WithTokenSource sets where the client retrieves its token from, if New is
+// not given one. The token is only retrieved when first needed.
+func WithTokenSource(source TokenSource) Option {
+	return func(c *Client) {
+		c.tokens = source
+	}
+}
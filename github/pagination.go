@@ -0,0 +1,154 @@
+package github
+
+import (
+	"context"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// pageSize is the number of items requested per page from paginated endpoints.
+	pageSize = 100
+	// defaultMaxPages bounds the number of pages retrieved from paginated endpoints.
+	defaultMaxPages = 100
+)
+
+// Returns true if page n (1 based) may be retrieved.
+func (a *Client) withinPageLimit(n int) bool {
+	return a.maxPages <= 0 || n <= a.maxPages
+}
+
+// Retrieve every page of a paginated endpoint, starting at "first".
+//
+// "alloc" must return a pointer to a new value to decode a page into. The
+// decoded pages are returned in order.
+//
+// At most WithMaxPages pages are retrieved. If parallel pagination is enabled
+// and the first page links to the last page, the remaining pages are
+// retrieved concurrently.
+func (a *Client) fetchPages(ctx context.Context, first string, alloc func() interface{}) ([]interface{}, error) {
+	page := alloc()
+	links, err := a.decodePage(ctx, first, page)
+	if err != nil {
+		return nil, err
+	}
+	pages := []interface{}{page}
+	if urls := pageURLs(links["last"]); a.parallelPages > 1 && len(urls) > 0 {
+		if a.maxPages > 0 && len(urls) > a.maxPages-1 {
+			urls = urls[:a.maxPages-1]
+		}
+		rest, err := a.fetchPagesConcurrently(ctx, urls, alloc)
+		if err != nil {
+			return nil, err
+		}
+		return append(pages, rest...), nil
+	}
+	for next := links["next"]; next != "" && a.withinPageLimit(len(pages)+1); next = links["next"] {
+		page := alloc()
+		links, err = a.decodePage(ctx, next, page)
+		if err != nil {
+			return nil, err
+		}
+		pages = append(pages, page)
+	}
+	return pages, nil
+}
+
+// Retrieve "urls" concurrently, cancelling the remaining retrievals on the first error.
+func (a *Client) fetchPagesConcurrently(ctx context.Context, urls []string, alloc func() interface{}) ([]interface{}, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	var (
+		pages    = make([]interface{}, len(urls))
+		wg       sync.WaitGroup
+		inflight = make(chan struct{}, a.parallelPages)
+		once     sync.Once
+		firstErr error
+	)
+	for i, url := range urls {
+		i, url := i, url
+		inflight <- struct{}{}
+		if ctx.Err() != nil {
+			<-inflight
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-inflight }()
+			page := alloc()
+			if _, err := a.decodePage(ctx, url, page); err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			pages[i] = page
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return pages, nil
+}
+
+// Given the URL of the last page of a paginated endpoint, return URLs for pages 2 through last.
+//
+// Returns nil if the page number can't be determined.
+func pageURLs(last string) []string {
+	if last == "" {
+		return nil
+	}
+	u, err := url.Parse(last)
+	if err != nil {
+		return nil
+	}
+	query := u.Query()
+	count, err := strconv.Atoi(query.Get("page"))
+	if err != nil || count < 2 {
+		return nil
+	}
+	urls := make([]string, 0, count-1)
+	for page := 2; page <= count; page++ {
+		query.Set("page", strconv.Itoa(page))
+		u.RawQuery = query.Encode()
+		urls = append(urls, u.String())
+	}
+	return urls
+}
+
+// Parse a Link header into a map of rel to URL.
+//
+// See https://docs.github.com/en/rest/guides/traversing-with-pagination
+func parseLinks(header string) map[string]string {
+	links := map[string]string{}
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		if len(parts) < 2 {
+			continue
+		}
+		url := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(url, "<") || !strings.HasSuffix(url, ">") {
+			continue
+		}
+		url = url[1 : len(url)-1]
+		for _, param := range parts[1:] {
+			param = strings.TrimSpace(param)
+			if rel := strings.TrimPrefix(param, "rel="); rel != param {
+				for _, rel := range strings.Fields(strings.Trim(rel, `"`)) {
+					links[rel] = url
+				}
+			}
+		}
+	}
+	return links
+}
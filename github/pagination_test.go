@@ -0,0 +1,144 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParallelPagination(t *testing.T) {
+	pages := paginatedHandler("/repos/owner/repo/releases",
+		`[{"tag_name": "v1.5.0"}, {"tag_name": "v1.4.0"}]`,
+		`[{"tag_name": "v1.3.0"}]`,
+		`[{"tag_name": "v1.2.0"}]`,
+		`[{"tag_name": "v1.1.0"}, {"tag_name": "v1.0.0"}]`,
+	)
+	var (
+		lock        sync.Mutex
+		inflight    int
+		maxInflight int
+		// Released once two subsequent page requests are in flight concurrently.
+		concurrent = make(chan struct{})
+		release    sync.Once
+	)
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("page") != "" {
+			lock.Lock()
+			inflight++
+			if inflight > maxInflight {
+				maxInflight = inflight
+			}
+			if inflight == 2 {
+				release.Do(func() { close(concurrent) })
+			}
+			lock.Unlock()
+			select {
+			case <-concurrent:
+			case <-time.After(5 * time.Second):
+			}
+			defer func() {
+				lock.Lock()
+				inflight--
+				lock.Unlock()
+			}()
+		}
+		pages.ServeHTTP(w, r)
+	}), WithParallelPagination(3))
+	releases, err := client.Releases(context.Background(), "owner/repo")
+	require.NoError(t, err)
+	tags := []string{}
+	for _, release := range releases {
+		tags = append(tags, release.TagName)
+	}
+	require.Equal(t, []string{"v1.5.0", "v1.4.0", "v1.3.0", "v1.2.0", "v1.1.0", "v1.0.0"}, tags)
+	require.GreaterOrEqual(t, maxInflight, 2)
+	require.LessOrEqual(t, maxInflight, 3)
+}
+
+func TestSequentialPagination(t *testing.T) {
+	client := newTestClient(t, paginatedHandler("/repos/owner/repo/tags",
+		`[{"name": "v1.1.0"}]`,
+		`[{"name": "v1.0.0"}]`,
+	))
+	tags, err := client.Tags(context.Background(), "owner/repo")
+	require.NoError(t, err)
+	require.Equal(t, []Tag{{Name: "v1.1.0"}, {Name: "v1.0.0"}}, tags)
+}
+
+func TestMaxPages(t *testing.T) {
+	pages := []string{`[{"tag_name": "v1.3.0"}]`, `[{"tag_name": "v1.2.0"}]`, `[{"tag_name": "v1.1.0"}]`, `[{"tag_name": "v1.0.0"}]`}
+	for _, test := range []struct {
+		name     string
+		options  []Option
+		expected []string
+	}{
+		{"Unlimited", []Option{WithMaxPages(0)}, []string{"v1.3.0", "v1.2.0", "v1.1.0", "v1.0.0"}},
+		{"Sequential", []Option{WithMaxPages(2)}, []string{"v1.3.0", "v1.2.0"}},
+		{"Parallel", []Option{WithMaxPages(3), WithParallelPagination(4)}, []string{"v1.3.0", "v1.2.0", "v1.1.0"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			client := newTestClient(t, paginatedHandler("/repos/owner/repo/releases", pages...), test.options...)
+			releases, err := client.Releases(context.Background(), "owner/repo")
+			require.NoError(t, err)
+			tags := []string{}
+			for _, release := range releases {
+				tags = append(tags, release.TagName)
+			}
+			require.Equal(t, test.expected, tags)
+
+			tags, err = client.ReleaseTags(context.Background(), "owner/repo")
+			require.NoError(t, err)
+			require.Equal(t, test.expected, tags)
+
+			seen := 0
+			err = client.ForEachRelease(context.Background(), "owner/repo", func(Release) (bool, error) {
+				seen++
+				return false, nil
+			})
+			require.NoError(t, err)
+			require.Equal(t, len(test.expected), seen)
+		})
+	}
+}
+
+func TestParallelPaginationCancelsOnError(t *testing.T) {
+	pages := paginatedHandler("/repos/owner/repo/releases",
+		`[{"tag_name": "v1.3.0"}]`,
+		`[{"tag_name": "v1.2.0"}]`,
+		`[{"tag_name": "v1.1.0"}]`,
+		`[{"tag_name": "v1.0.0"}]`,
+	)
+	cancelled := make(chan struct{}, 2)
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("page") {
+		case "":
+			pages.ServeHTTP(w, r)
+		case "2":
+			w.WriteHeader(http.StatusNotFound)
+		default:
+			// Block until the client gives up on the request.
+			select {
+			case <-r.Context().Done():
+				cancelled <- struct{}{}
+			case <-time.After(5 * time.Second):
+				pages.ServeHTTP(w, r)
+			}
+		}
+	}), WithParallelPagination(3))
+	start := time.Now()
+	_, err := client.Releases(context.Background(), "owner/repo")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "404")
+	require.Less(t, time.Since(start), 4*time.Second)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-cancelled:
+		case <-time.After(4 * time.Second):
+			t.Fatal("page retrieval was not cancelled")
+		}
+	}
+}
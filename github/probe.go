@@ -0,0 +1,76 @@
+package github
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/pkg/errors"
+	multierror "go.uber.org/multierr"
+)
+
+type downloadRoute int
+
+const (
+	routeUnknown downloadRoute = iota
+	routeAPI
+	routeBrowser
+)
+
+// ProbeDownloadURL determines whether release assets should be downloaded via
+// the API asset URL or the browser download URL, as some networks block one
+// or the other.
+//
+// Each candidate is probed with a single byte Range request, preferring the
+// API URL. The result is cached for the lifetime of the Client, so subsequent
+// calls return the equivalent URL for "asset" without probing.
+func (a *Client) ProbeDownloadURL(ctx context.Context, asset Asset) (preferredURL string, err error) {
+	a.probeLock.Lock()
+	defer a.probeLock.Unlock()
+	switch a.route {
+	case routeAPI:
+		return asset.URL, nil
+	case routeBrowser:
+		return asset.BrowserDownloadURL, nil
+	}
+	var errs error
+	for _, candidate := range []struct {
+		route   downloadRoute
+		url     string
+		headers http.Header
+	}{
+		{routeAPI, asset.URL, http.Header{"Accept": []string{"application/octet-stream"}}},
+		{routeBrowser, asset.BrowserDownloadURL, http.Header{}},
+	} {
+		if candidate.url == "" {
+			continue
+		}
+		err := a.probe(ctx, candidate.url, candidate.headers)
+		if err != nil {
+			errs = multierror.Append(errs, err)
+			continue
+		}
+		a.route = candidate.route
+		return candidate.url, nil
+	}
+	if errs == nil {
+		return "", errors.Errorf("%s: no download URLs to probe", asset.Name)
+	}
+	return "", errors.Wrapf(errs, "%s: no usable download URL", asset.Name)
+}
+
+func (a *Client) probe(ctx context.Context, url string, headers http.Header) error {
+	headers.Set("Range", "bytes=0-0")
+	req, err := a.request(ctx, url, headers)
+	if err != nil {
+		return errors.Wrap(err, url)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("%s: probe failed with %s", url, resp.Status)
+	}
+	return nil
+}
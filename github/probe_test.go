@@ -0,0 +1,74 @@
+package github
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Create a server that serves assets if "ok" is true, counting requests.
+func probeServer(t *testing.T, ok bool, requests *int) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests++
+		if !ok {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = io.WriteString(w, "x")
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestProbeDownloadURL(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		api     bool
+		browser bool
+	}{
+		{"OnlyAPI", true, false},
+		{"OnlyBrowser", false, true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var apiRequests, browserRequests int
+			api := probeServer(t, test.api, &apiRequests)
+			browser := probeServer(t, test.browser, &browserRequests)
+			client := New("")
+			asset := Asset{Name: "tool", URL: api.URL + "/assets/1", BrowserDownloadURL: browser.URL + "/download/tool"}
+			preferred, err := client.ProbeDownloadURL(context.Background(), asset)
+			require.NoError(t, err)
+			expected := asset.URL
+			if !test.api {
+				expected = asset.BrowserDownloadURL
+			}
+			require.Equal(t, expected, preferred)
+
+			// The decision is cached.
+			before := apiRequests + browserRequests
+			other := Asset{Name: "other", URL: api.URL + "/assets/2", BrowserDownloadURL: browser.URL + "/download/other"}
+			preferred, err = client.ProbeDownloadURL(context.Background(), other)
+			require.NoError(t, err)
+			require.Equal(t, before, apiRequests+browserRequests)
+			if test.api {
+				require.Equal(t, other.URL, preferred)
+			} else {
+				require.Equal(t, other.BrowserDownloadURL, preferred)
+			}
+		})
+	}
+}
+
+func TestProbeDownloadURLNeitherWorks(t *testing.T) {
+	var requests int
+	api := probeServer(t, false, &requests)
+	browser := probeServer(t, false, &requests)
+	_, err := New("").ProbeDownloadURL(context.Background(), Asset{Name: "tool", URL: api.URL, BrowserDownloadURL: browser.URL})
+	require.Error(t, err)
+	require.Equal(t, 2, requests)
+}
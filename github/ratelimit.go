@@ -0,0 +1,83 @@
+package github
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultMaxRateLimitWait = time.Minute
+	// Maximum number of times a single request will wait for a rate limit to reset.
+	maxRateLimitRetries = 3
+)
+
+// RateLimitError is returned when the GitHub API rate limit has been exhausted
+// and the limit will not reset within the wait configured with WithRateLimitWait.
+//
+// See https://docs.github.com/en/rest/overview/resources-in-the-rest-api#rate-limiting
+type RateLimitError struct {
+	URL string
+	// Reset is when the rate limit resets, if known.
+	Reset time.Time
+	// RetryAfter is set when GitHub has requested a specific delay, eg. for secondary rate limits.
+	RetryAfter time.Duration
+}
+
+func (r *RateLimitError) Error() string {
+	msg := r.URL + ": GitHub API rate limit exceeded"
+	switch {
+	case r.RetryAfter > 0:
+		msg += fmt.Sprintf(", retry after %s", r.RetryAfter)
+	case !r.Reset.IsZero():
+		msg += fmt.Sprintf(", resets at %s", r.Reset.Local().Format(time.RFC1123))
+	}
+	return msg + " (authenticated requests have a higher limit, see GITHUB_TOKEN)"
+}
+
+// How long to wait from "now" until a request may be retried.
+func (r *RateLimitError) wait(now time.Time) time.Duration {
+	if r.RetryAfter > 0 {
+		return r.RetryAfter
+	}
+	if r.Reset.IsZero() {
+		return -1
+	}
+	// Allow a little slack for clock skew.
+	wait := r.Reset.Sub(now) + time.Second
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// Returns a RateLimitError if resp indicates the rate limit has been exhausted, or nil.
+func rateLimitError(url string, resp *http.Response) *RateLimitError {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+	rerr := &RateLimitError{URL: url}
+	if retryAfter, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+		rerr.RetryAfter = time.Duration(retryAfter) * time.Second
+		return rerr
+	}
+	if resp.Header.Get("X-RateLimit-Remaining") != "0" {
+		return nil
+	}
+	if reset, err := strconv.ParseInt(resp.Header.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+		rerr.Reset = time.Unix(reset, 0)
+	}
+	return rerr
+}
+
+// Check an API response for errors, returning a RateLimitError or statusError if the request failed.
+func checkResponse(url string, resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return nil
+	}
+	if rerr := rateLimitError(url, resp); rerr != nil {
+		return rerr
+	}
+	return newStatusError(url, resp)
+}
@@ -0,0 +1,76 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimitWaitsForReset(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	attempts := 0
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(clock.now.Add(30*time.Second).Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		fmt.Fprint(w, `{"description": "A tool"}`)
+	}), WithClock(clock))
+	repo, err := client.Repo(context.Background(), "owner/repo")
+	require.NoError(t, err)
+	require.Equal(t, "A tool", repo.Description)
+	require.Equal(t, []time.Duration{31 * time.Second}, clock.sleeps)
+}
+
+func TestRateLimitRetryAfter(t *testing.T) {
+	clock := &fakeClock{}
+	attempts := 0
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			w.Header().Set("Retry-After", "5")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}), WithClock(clock))
+	_, err := client.Repo(context.Background(), "owner/repo")
+	require.NoError(t, err)
+	require.Equal(t, []time.Duration{5 * time.Second}, clock.sleeps)
+}
+
+func TestRateLimitExhausted(t *testing.T) {
+	clock := &fakeClock{now: time.Unix(1600000000, 0)}
+	reset := clock.now.Add(time.Hour)
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(reset.Unix(), 10))
+		w.WriteHeader(http.StatusForbidden)
+	}), WithClock(clock))
+	_, err := client.Repo(context.Background(), "owner/repo")
+	var rerr *RateLimitError
+	require.True(t, errors.As(err, &rerr), "%+v", err)
+	require.Equal(t, reset, rerr.Reset)
+	require.Contains(t, err.Error(), "GitHub API rate limit exceeded, resets at "+reset.Local().Format(time.RFC1123))
+	require.Empty(t, clock.sleeps)
+}
+
+func TestForbiddenIsNotRateLimited(t *testing.T) {
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		w.WriteHeader(http.StatusForbidden)
+	}), WithClock(&fakeClock{}))
+	_, err := client.Repo(context.Background(), "owner/repo")
+	var rerr *RateLimitError
+	require.Error(t, err)
+	require.False(t, errors.As(err, &rerr))
+}
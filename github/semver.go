@@ -0,0 +1,101 @@
+package github
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var semverRe = regexp.MustCompile(`^v?(0|[1-9]\d*)\.(0|[1-9]\d*)\.(0|[1-9]\d*)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+
+// A parsed semantic version, as commonly used in GitHub tags (eg. "v1.2.3-rc.1").
+//
+// The manifest package has a much more permissive version parser, but it
+// can't be used here without an import cycle.
+type semver struct {
+	major, minor, patch int
+	prerelease          []string
+}
+
+// Parse a tag as a semantic version, returning false if it is not one.
+func parseSemver(tag string) (semver, bool) {
+	groups := semverRe.FindStringSubmatch(tag)
+	if groups == nil {
+		return semver{}, false
+	}
+	v := semver{}
+	v.major, _ = strconv.Atoi(groups[1])
+	v.minor, _ = strconv.Atoi(groups[2])
+	v.patch, _ = strconv.Atoi(groups[3])
+	if groups[4] != "" {
+		v.prerelease = strings.Split(groups[4], ".")
+	}
+	return v, true
+}
+
+// Compare returns -1, 0 or 1 if v is less than, equal to, or greater than other.
+//
+// See https://semver.org/#spec-item-11
+func (v semver) compare(other semver) int {
+	for _, d := range []int{v.major - other.major, v.minor - other.minor, v.patch - other.patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+	switch {
+	case len(v.prerelease) == 0 && len(other.prerelease) == 0:
+		return 0
+	case len(v.prerelease) == 0:
+		return 1
+	case len(other.prerelease) == 0:
+		return -1
+	}
+	for i := 0; i < len(v.prerelease) && i < len(other.prerelease); i++ {
+		if d := comparePrereleaseIdentifier(v.prerelease[i], other.prerelease[i]); d != 0 {
+			return d
+		}
+	}
+	return sign(len(v.prerelease) - len(other.prerelease))
+}
+
+func comparePrereleaseIdentifier(a, b string) int {
+	an, aerr := strconv.Atoi(a)
+	bn, berr := strconv.Atoi(b)
+	switch {
+	case aerr == nil && berr == nil:
+		return sign(an - bn)
+	case aerr == nil:
+		return -1
+	case berr == nil:
+		return 1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+// Compare two tags, ordering semantic versions before non-semver tags, which are compared lexically.
+func compareTags(a, b string) int {
+	av, aok := parseSemver(a)
+	bv, bok := parseSemver(b)
+	switch {
+	case aok && bok:
+		return av.compare(bv)
+	case aok:
+		return 1
+	case bok:
+		return -1
+	default:
+		return strings.Compare(a, b)
+	}
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,115 @@
+package github
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNoTags is returned by LatestTag when a repo has no semantically versioned tags.
+var ErrNoTags = errors.New("no semver tags found")
+
+// Tag is a minimal type for git tags retrieved via the GitHub API.
+//
+// See https://docs.github.com/en/rest/reference/repos#list-repository-tags
+type Tag struct {
+	Name   string    `json:"name"`
+	Commit TagCommit `json:"commit"`
+}
+
+// TagCommit is the commit a Tag points to.
+type TagCommit struct {
+	SHA string `json:"sha"`
+	URL string `json:"url"`
+}
+
+// ReleaseTags returns the tag names of all releases in a repo, newest first.
+//
+// This is considerably cheaper than Releases when only version information is required.
+func (a *Client) ReleaseTags(ctx context.Context, repo string) ([]string, error) {
+	type releaseTag struct {
+		TagName string `json:"tag_name"`
+	}
+	url := fmt.Sprintf("%s/repos/%s/releases?per_page=%d", a.apiURL, repo, pageSize)
+	pages, err := a.fetchPages(ctx, url, func() interface{} { return &[]releaseTag{} })
+	if err != nil {
+		return nil, err
+	}
+	tags := []string{}
+	for _, page := range pages {
+		for _, release := range *page.(*[]releaseTag) {
+			tags = append(tags, release.TagName)
+		}
+	}
+	return tags, nil
+}
+
+// Tags returns all git tags in a repo.
+func (a *Client) Tags(ctx context.Context, repo string) ([]Tag, error) {
+	url := fmt.Sprintf("%s/repos/%s/tags?per_page=%d", a.apiURL, repo, pageSize)
+	pages, err := a.fetchPages(ctx, url, func() interface{} { return &[]Tag{} })
+	if err != nil {
+		return nil, err
+	}
+	tags := []Tag{}
+	for _, page := range pages {
+		tags = append(tags, *page.(*[]Tag)...)
+	}
+	return tags, nil
+}
+
+// ForEachTag calls fn for each git tag in a repo, in the order returned by GitHub.
+//
+// Pages are retrieved lazily, so if fn returns stop=true no further pages
+// are fetched. At most WithMaxPages pages are retrieved.
+func (a *Client) ForEachTag(ctx context.Context, repo string, fn func(Tag) (stop bool, err error)) error {
+	url := fmt.Sprintf("%s/repos/%s/tags?per_page=%d", a.apiURL, repo, pageSize)
+	for pages := 1; url != "" && a.withinPageLimit(pages); pages++ {
+		var page []Tag
+		links, err := a.decodePage(ctx, url, &page)
+		if err != nil {
+			return err
+		}
+		for _, tag := range page {
+			stop, err := fn(tag)
+			if err != nil {
+				return err
+			}
+			if stop {
+				return nil
+			}
+		}
+		url = links["next"]
+	}
+	return nil
+}
+
+// LatestTag returns the git tag with the highest semantic version in a repo,
+// independent of whether any GitHub releases exist.
+//
+// Tags that are not semantic versions, or that are pre-releases, are ignored.
+func (a *Client) LatestTag(ctx context.Context, repo string) (*Tag, error) {
+	var (
+		latest        *Tag
+		latestVersion semver
+	)
+	err := a.ForEachTag(ctx, repo, func(tag Tag) (bool, error) {
+		version, ok := parseSemver(tag.Name)
+		if !ok || len(version.prerelease) > 0 {
+			return false, nil
+		}
+		if latest == nil || version.compare(latestVersion) > 0 {
+			tag := tag
+			latest, latestVersion = &tag, version
+		}
+		return false, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		return nil, errors.Wrap(ErrNoTags, repo)
+	}
+	return latest, nil
+}
@@ -0,0 +1,91 @@
+package github
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// Serves "pages" from "path" with GitHub-style Link headers.
+func paginatedHandler(path string, pages ...string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		page := 1
+		if p := r.URL.Query().Get("page"); p != "" {
+			var err error
+			if page, err = strconv.Atoi(p); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+		}
+		if page < 1 || page > len(pages) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		base := "http://" + r.Host + path
+		if page < len(pages) {
+			w.Header().Add("Link", fmt.Sprintf(`<%s?page=%d>; rel="next", <%s?page=%d>; rel="last"`, base, page+1, base, len(pages)))
+		}
+		fmt.Fprint(w, pages[page-1])
+	})
+}
+
+func TestReleaseTags(t *testing.T) {
+	client := newTestClient(t, paginatedHandler("/repos/owner/repo/releases",
+		`[{"tag_name": "v1.2.0", "assets": [{"name": "tool"}]}, {"tag_name": "v1.1.0"}]`,
+		`[{"tag_name": "v1.0.1"}, {"tag_name": "v1.0.0"}]`,
+		`[{"tag_name": "v0.9.0"}]`,
+	))
+	tags, err := client.ReleaseTags(context.Background(), "owner/repo")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.2.0", "v1.1.0", "v1.0.1", "v1.0.0", "v0.9.0"}, tags)
+}
+
+func TestForEachTagStopsEarly(t *testing.T) {
+	requests := 0
+	handler := paginatedHandler("/repos/owner/repo/tags",
+		`[{"name": "v1.2.0", "commit": {"sha": "aaa"}}, {"name": "v1.1.0", "commit": {"sha": "bbb"}}]`,
+		`[{"name": "v1.0.0", "commit": {"sha": "ccc"}}, {"name": "v0.9.0", "commit": {"sha": "ddd"}}]`,
+		`[{"name": "v0.8.0", "commit": {"sha": "eee"}}]`,
+	)
+	client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		handler.ServeHTTP(w, r)
+	}))
+	seen := []string{}
+	err := client.ForEachTag(context.Background(), "owner/repo", func(tag Tag) (bool, error) {
+		seen = append(seen, tag.Name)
+		return tag.Name == "v1.0.0", nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.2.0", "v1.1.0", "v1.0.0"}, seen)
+	require.Equal(t, 2, requests)
+
+	tags, err := client.Tags(context.Background(), "owner/repo")
+	require.NoError(t, err)
+	require.Len(t, tags, 5)
+	require.Equal(t, "eee", tags[4].Commit.SHA)
+}
+
+func TestLatestTag(t *testing.T) {
+	client := newTestClient(t, paginatedHandler("/repos/owner/repo/tags",
+		`[{"name": "nightly"}, {"name": "v1.9.0"}, {"name": "v2.0.0-rc.1"}]`,
+		`[{"name": "v1.10.0", "commit": {"sha": "abc"}}, {"name": "release-2021"}, {"name": "1.2.0"}]`,
+	))
+	tag, err := client.LatestTag(context.Background(), "owner/repo")
+	require.NoError(t, err)
+	require.Equal(t, "v1.10.0", tag.Name)
+	require.Equal(t, "abc", tag.Commit.SHA)
+
+	client = newTestClient(t, paginatedHandler("/repos/owner/repo/tags", `[{"name": "nightly"}, {"name": "latest"}]`))
+	_, err = client.LatestTag(context.Background(), "owner/repo")
+	require.True(t, errors.Is(err, ErrNoTags), "%+v", err)
+}
@@ -0,0 +1,119 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// VerificationLevel controls how the Client treats release assets that have
+// no checksum or signature available.
+type VerificationLevel string
+
+// Verification levels.
+const (
+	// VerificationOff downloads assets regardless of verification material.
+	VerificationOff VerificationLevel = "off"
+	// VerificationWarn logs a warning when an asset has no verification material.
+	VerificationWarn VerificationLevel = "warn"
+	// VerificationRequire refuses to download assets without verification material.
+	VerificationRequire VerificationLevel = "require"
+)
+
+// ParseVerificationLevel parses a VerificationLevel, treating "" as VerificationOff.
+func ParseVerificationLevel(s string) (VerificationLevel, error) {
+	switch level := VerificationLevel(s); level {
+	case "":
+		return VerificationOff, nil
+	case VerificationOff, VerificationWarn, VerificationRequire:
+		return level, nil
+	default:
+		return "", errors.Errorf("invalid verification level %q, expected one of off, warn or require", s)
+	}
+}
+
+// ErrUnverifiable is returned when VerificationRequire is configured and an asset has no checksum or signature.
+var ErrUnverifiable = errors.New("no checksum or signature available")
+
+// Suffixes of release assets that carry verification material for a sibling asset.
+var verificationSuffixes = []string{".sha256", ".sha256sum", ".sha512", ".sig", ".asc", ".minisig", ".pem"}
+
+// Names (lowercase) of release assets that carry checksums for all assets in the release.
+var checksumFileNames = []string{"sha256sums", "sha256sums.txt", "checksums.txt", "checksums.sha256", "sha512sums", "sha512sums.txt"}
+
+// HasVerification returns true if verification material is available for
+// "asset", either as a digest reported by GitHub or as a checksum or
+// signature file published alongside it in "release".
+//
+// "release" may be nil, in which case only the asset digest is considered.
+func HasVerification(release *Release, asset Asset) bool {
+	if asset.Digest != "" {
+		return true
+	}
+	if release == nil {
+		return false
+	}
+	for _, candidate := range release.Assets {
+		if isChecksumFile(strings.ToLower(candidate.Name)) {
+			return true
+		}
+		for _, suffix := range verificationSuffixes {
+			if candidate.Name == asset.Name+suffix {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Returns true if the (lowercase) asset name is a checksum or signature file.
+func isVerificationAsset(name string) bool {
+	for _, suffix := range verificationSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return isChecksumFile(name)
+}
+
+// Returns true if the (lowercase) asset name is a checksum file covering multiple assets.
+func isChecksumFile(name string) bool {
+	for _, checksumFile := range checksumFileNames {
+		if name == checksumFile || strings.HasSuffix(name, "_"+checksumFile) || strings.HasSuffix(name, "-"+checksumFile) {
+			return true
+		}
+	}
+	return false
+}
+
+// DownloadReleaseAsset downloads "asset" from "release", applying the verification policy configured with WithRequireVerification.
+//
+// Download does not apply the policy, as it has no access to the release.
+//
+// The download starts at byte "offset", as for DownloadFrom.
+func (a *Client) DownloadReleaseAsset(ctx context.Context, release *Release, asset Asset, offset int64) (*http.Response, error) {
+	if err := a.checkVerification(release, asset); err != nil {
+		return nil, err
+	}
+	return a.DownloadFrom(ctx, asset, offset)
+}
+
+func (a *Client) checkVerification(release *Release, asset Asset) error {
+	if HasVerification(release, asset) {
+		return nil
+	}
+	switch a.verification {
+	case VerificationOff, "":
+	case VerificationWarn:
+		if a.logger != nil {
+			a.logger.Warnf("%s: %s", asset.Name, ErrUnverifiable)
+		}
+	case VerificationRequire:
+		return errors.Wrap(ErrUnverifiable, asset.Name)
+	default:
+		return errors.Errorf("unknown verification level %q", a.verification)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package github
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/ui"
+)
+
+func TestRequireVerification(t *testing.T) {
+	tests := []struct {
+		name     string
+		level    VerificationLevel
+		verified bool
+		warning  bool
+		err      bool
+	}{
+		{name: "OffUnverified", level: VerificationOff},
+		{name: "OffVerified", level: VerificationOff, verified: true},
+		{name: "WarnUnverified", level: VerificationWarn, warning: true},
+		{name: "WarnVerified", level: VerificationWarn, verified: true},
+		{name: "RequireUnverified", level: VerificationRequire, err: true},
+		{name: "RequireVerified", level: VerificationRequire, verified: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			p, buf := ui.NewForTesting()
+			client := newTestClient(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = io.WriteString(w, "asset")
+			}), WithLogger(p), WithRequireVerification(test.level))
+			asset := Asset{Name: "tool-linux-amd64.tar.gz", URL: client.apiURL + "/asset"}
+			release := &Release{TagName: "v1.0.0", Assets: []Asset{asset}}
+			if test.verified {
+				release.Assets = append(release.Assets, Asset{Name: "checksums.txt"})
+			}
+			resp, err := client.DownloadReleaseAsset(context.Background(), release, asset, 0)
+			if test.err {
+				require.True(t, errors.Is(err, ErrUnverifiable), "%+v", err)
+				return
+			}
+			require.NoError(t, err)
+			_ = resp.Body.Close()
+			if test.warning {
+				require.Contains(t, buf.String(), "no checksum or signature available")
+			} else {
+				require.Empty(t, buf.String())
+			}
+		})
+	}
+}
+
+func TestHasVerification(t *testing.T) {
+	asset := Asset{Name: "tool.tar.gz"}
+	require.False(t, HasVerification(nil, asset))
+	require.True(t, HasVerification(nil, Asset{Name: "tool.tar.gz", Digest: "sha256:abc"}))
+	require.True(t, HasVerification(&Release{Assets: []Asset{asset, {Name: "tool.tar.gz.sig"}}}, asset))
+	require.True(t, HasVerification(&Release{Assets: []Asset{asset, {Name: "tool_1.0.0_SHA256SUMS"}}}, asset))
+	require.False(t, HasVerification(&Release{Assets: []Asset{asset, {Name: "other.tar.gz.sig"}}}, asset))
+}
+
+func TestParseVerificationLevel(t *testing.T) {
+	level, err := ParseVerificationLevel("")
+	require.NoError(t, err)
+	require.Equal(t, VerificationOff, level)
+	level, err = ParseVerificationLevel("require")
+	require.NoError(t, err)
+	require.Equal(t, VerificationRequire, level)
+	_, err = ParseVerificationLevel("Warn")
+	require.Error(t, err)
+}
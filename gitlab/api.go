@@ -0,0 +1,173 @@
+// Package gitlab implements a client for GitLab that includes the minimum set
+// of functions required by Hermit.
+package gitlab
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultBaseURL is the base URL of gitlab.com.
+const DefaultBaseURL = "https://gitlab.com"
+
+// Release is a minimal type for GitLab release meta information retrieved via the GitLab API.
+//
+// See https://docs.gitlab.com/ee/api/releases/
+type Release struct {
+	TagName string `json:"tag_name"`
+	Name    string `json:"name"`
+	// UpcomingRelease is true if the release date is in the future.
+	UpcomingRelease bool   `json:"upcoming_release"`
+	Assets          Assets `json:"assets"`
+}
+
+// Assets attached to a GitLab release.
+type Assets struct {
+	Links []Link `json:"links"`
+}
+
+// Link is a release asset link.
+//
+// See https://docs.gitlab.com/ee/api/releases/links.html
+type Link struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+	URL  string `json:"url"`
+	// DirectAssetURL is the permanent /-/releases/<tag>/downloads/<filepath> URL of the asset, if any.
+	DirectAssetURL string `json:"direct_asset_url"`
+}
+
+// Option for configuring the GitLab Client.
+type Option func(*Client)
+
+// WithBaseURL sets the base URL of the GitLab instance (eg. "https://gitlab.example.com").
+//
+// Defaults to DefaultBaseURL.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
+}
+
+// Client for GitLab.
+type Client struct {
+	client  *http.Client
+	baseURL string
+}
+
+// New creates a new GitLab API client.
+func New(token string, options ...Option) *Client {
+	c := &Client{baseURL: DefaultBaseURL}
+	for _, option := range options {
+		option(c)
+	}
+	client := &http.Client{}
+	if token != "" {
+		client.Transport = TokenAuthenticatedTransport(nil, c.Host(), token)
+	}
+	c.client = client
+	return c
+}
+
+// Host of the GitLab instance.
+func (a *Client) Host() string {
+	u, err := url.Parse(a.baseURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// ProjectForURL returns the <group>/<project> path for the given URL if it is
+// a URL within a project on this GitLab instance.
+//
+// GitLab projects may be nested in subgroups, so the project path is
+// everything before the "/-/" separator.
+func (a *Client) ProjectForURL(sourceURL string) string {
+	u, err := url.Parse(sourceURL)
+	if err != nil || u.Host != a.Host() {
+		return ""
+	}
+	parts := strings.SplitN(u.Path, "/-/", 2)
+	if len(parts) != 2 {
+		return ""
+	}
+	return strings.Trim(parts[0], "/")
+}
+
+// LatestRelease for a GitLab project.
+func (a *Client) LatestRelease(ctx context.Context, project string) (*Release, error) {
+	release := &Release{}
+	_, err := a.decode(ctx, a.projectURL(project)+"/releases/permalink/latest", release)
+	return release, err
+}
+
+// Releases for a GitLab project, newest first.
+func (a *Client) Releases(ctx context.Context, project string) ([]Release, error) {
+	releases := []Release{}
+	for page := "1"; page != ""; {
+		var next []Release
+		resp, err := a.decode(ctx, fmt.Sprintf("%s/releases?per_page=100&page=%s", a.projectURL(project), page), &next)
+		if err != nil {
+			return nil, err
+		}
+		releases = append(releases, next...)
+		page = resp.Get("X-Next-Page")
+	}
+	return releases, nil
+}
+
+// Download a release asset link from GitLab.
+func (a *Client) Download(ctx context.Context, link Link) (*http.Response, error) {
+	uri := link.DirectAssetURL
+	if uri == "" {
+		uri = link.URL
+	}
+	return a.DownloadURL(ctx, uri, 0)
+}
+
+// DownloadURL downloads an arbitrary URL using the GitLab client's credentials.
+//
+// If offset is greater than zero, only the content from that byte onwards is requested.
+func (a *Client) DownloadURL(ctx context.Context, uri string, offset int64) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	}
+	resp, err := a.client.Do(req)
+	return resp, errors.WithStack(err)
+}
+
+// URL for the project API endpoint, using the URL-encoded project path as its ID.
+func (a *Client) projectURL(project string) string {
+	return a.baseURL + "/api/v4/projects/" + url.PathEscape(project)
+}
+
+func (a *Client) decode(ctx context.Context, url string, dest interface{}) (http.Header, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, errors.Wrap(err, url)
+	}
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, url)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, errors.Errorf("%s: GitLab API request failed with %s", url, resp.Status)
+	}
+	err = json.NewDecoder(resp.Body).Decode(dest)
+	if err != nil {
+		return nil, errors.Wrap(err, url)
+	}
+	return resp.Header, nil
+}
@@ -0,0 +1,90 @@
+package gitlab
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReleases(t *testing.T) {
+	var (
+		paths  []string
+		tokens []string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.EscapedPath()+"?"+r.URL.RawQuery)
+		tokens = append(tokens, r.Header.Get("PRIVATE-TOKEN"))
+		switch r.URL.Query().Get("page") {
+		case "1":
+			w.Header().Set("X-Next-Page", "2")
+			_, _ = io.WriteString(w, `[{"tag_name":"v2.0.0","assets":{"links":[{"name":"tool-linux-amd64","url":"https://example.com/tool","direct_asset_url":"https://gitlab.example.com/group/sub/tool/-/releases/v2.0.0/downloads/tool-linux-amd64"}]}}]`)
+		case "2":
+			_, _ = io.WriteString(w, `[{"tag_name":"v1.0.0"}]`)
+		}
+	}))
+	defer srv.Close()
+
+	client := New("secret", WithBaseURL(srv.URL+"/"))
+	releases, err := client.Releases(context.Background(), "group/sub/tool")
+	require.NoError(t, err)
+	require.Equal(t, []Release{
+		{TagName: "v2.0.0", Assets: Assets{Links: []Link{{
+			Name:           "tool-linux-amd64",
+			URL:            "https://example.com/tool",
+			DirectAssetURL: "https://gitlab.example.com/group/sub/tool/-/releases/v2.0.0/downloads/tool-linux-amd64",
+		}}}},
+		{TagName: "v1.0.0"},
+	}, releases)
+	require.Equal(t, []string{
+		"/api/v4/projects/group%2Fsub%2Ftool/releases?per_page=100&page=1",
+		"/api/v4/projects/group%2Fsub%2Ftool/releases?per_page=100&page=2",
+	}, paths)
+	require.Equal(t, []string{"secret", "secret"}, tokens)
+}
+
+func TestLatestRelease(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		if path != "/api/v4/projects/group%2Ftool/releases/permalink/latest" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = io.WriteString(w, `{"tag_name":"v1.2.3"}`)
+	}))
+	defer srv.Close()
+
+	client := New("", WithBaseURL(srv.URL))
+	release, err := client.LatestRelease(context.Background(), "group/tool")
+	require.NoError(t, err)
+	require.Equal(t, "v1.2.3", release.TagName)
+
+	_, err = client.LatestRelease(context.Background(), "group/missing")
+	require.EqualError(t, err, fmt.Sprintf("%s/api/v4/projects/group%%2Fmissing/releases/permalink/latest: GitLab API request failed with 404 Not Found", srv.URL))
+}
+
+func TestTokenOnlySentToGitLabHost(t *testing.T) {
+	var token string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token = r.Header.Get("PRIVATE-TOKEN")
+	}))
+	defer srv.Close()
+
+	client := New("secret")
+	resp, err := client.DownloadURL(context.Background(), srv.URL, 0)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "", token)
+}
+
+func TestProjectForURL(t *testing.T) {
+	client := New("")
+	require.Equal(t, "group/sub/tool", client.ProjectForURL("https://gitlab.com/group/sub/tool/-/releases/v1.0.0/downloads/tool.tar.gz"))
+	require.Equal(t, "", client.ProjectForURL("https://gitlab.com/group/tool"))
+	require.Equal(t, "", client.ProjectForURL("https://example.com/group/tool/-/releases/v1.0.0/downloads/tool.tar.gz"))
+}
@@ -0,0 +1,28 @@
+package gitlab
+
+import (
+	"net/http"
+)
+
+// TokenAuthenticatedTransport returns a HTTP transport that will inject a
+// GitLab private or personal access token into any requests to "host".
+func TokenAuthenticatedTransport(transport http.RoundTripper, host, token string) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &gitlabAuthenticatedHTTPClient{rt: transport, host: host, token: token}
+}
+
+type gitlabAuthenticatedHTTPClient struct {
+	host  string
+	token string
+	rt    http.RoundTripper
+}
+
+func (g *gitlabAuthenticatedHTTPClient) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context()) // The stdlib docs recommend not mutating the request in place.
+	if req.URL.Host == g.host && g.token != "" {
+		req.Header.Set("PRIVATE-TOKEN", g.token)
+	}
+	return g.rt.RoundTrip(req)
+}
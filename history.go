@@ -0,0 +1,172 @@
+package hermit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/shell"
+	"github.com/cashapp/hermit/state"
+	"github.com/cashapp/hermit/ui"
+)
+
+// Changes to the installed version of a package are recorded in a history
+// log per environment, so that Rollback can restore the version a package
+// was changed from without the user having to know it.
+//
+// The history of a package is a stack of the versions it was changed from:
+// upgrades and installs of another version push the previous version, and
+// rollbacks pop it, so that repeated rollbacks walk further back.
+
+// HistoryOperation is a change to the installed version of a package.
+type HistoryOperation string
+
+// Operations recorded in the history log.
+const (
+	HistoryUpgrade  HistoryOperation = "upgrade"
+	HistoryInstall  HistoryOperation = "install"
+	HistoryRollback HistoryOperation = "rollback"
+)
+
+// HistoryEntry records that the installed version of a package changed from "From" to "To".
+type HistoryEntry struct {
+	Time      time.Time        `json:"time"`
+	Operation HistoryOperation `json:"operation"`
+	Package   string           `json:"package"`
+	// References of the versions, eg. "jq-1.6".
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// History returns the changes to installed package versions recorded for this environment, oldest first.
+func (e *Env) History() ([]HistoryEntry, error) {
+	path := e.historyPath()
+	r, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer r.Close()
+	entries := []HistoryEntry{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		entry := HistoryEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, errors.Wrapf(err, "%s:%d", path, line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, errors.WithStack(scanner.Err())
+}
+
+// PreviousVersion returns the version that the package "name" was last
+// changed from, and that Rollback would restore, if any.
+func (e *Env) PreviousVersion(name string) (manifest.Reference, bool, error) {
+	entries, err := e.History()
+	if err != nil {
+		return manifest.Reference{}, false, err
+	}
+	stack := []manifest.Reference{}
+	for _, entry := range entries {
+		if entry.Package != name {
+			continue
+		}
+		if entry.Operation == HistoryRollback {
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+			continue
+		}
+		stack = append(stack, manifest.ParseReference(entry.From))
+	}
+	if len(stack) == 0 {
+		return manifest.Reference{}, false, nil
+	}
+	return stack[len(stack)-1], true, nil
+}
+
+// Rollback replaces the installed version of the package "name" with the
+// version it was last changed from, as recorded in the environment's history.
+func (e *Env) Rollback(l *ui.UI, name string) (pkg *manifest.Package, changes *shell.Changes, err error) {
+	installed, err := e.ListInstalledReferences()
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	var current *manifest.Reference
+	for i, ref := range installed {
+		if ref.Name == name {
+			current = &installed[i]
+		}
+	}
+	if current == nil {
+		return nil, nil, errors.Errorf("no installed package '%s' found", name)
+	}
+	previous, ok, err := e.PreviousVersion(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		return nil, nil, errors.Errorf("no previous version of %s is recorded", current)
+	}
+	pkg, err = e.Resolve(l, manifest.ExactSelector(previous), true)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	changes, err = e.installReplacing(l, pkg, HistoryRollback, state.Provenance{Reason: state.ProvenanceRollback})
+	if err != nil {
+		return nil, nil, err
+	}
+	return pkg, changes, nil
+}
+
+// Record that the installed version of a package changed from "from" to "to".
+func (e *Env) recordHistory(l *ui.UI, operation HistoryOperation, from, to *manifest.Package) {
+	entry := HistoryEntry{
+		Time:      time.Now().UTC(),
+		Operation: operation,
+		Package:   to.Reference.Name,
+		From:      from.Reference.String(),
+		To:        to.Reference.String(),
+	}
+	if err := e.writeHistory(entry); err != nil {
+		l.Warnf("Failed to record the change from %s to %s in the history: %s", from, to, err)
+	}
+}
+
+func (e *Env) writeHistory(entry HistoryEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	path := e.historyPath()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	w, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		_ = w.Close()
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(w.Close())
+}
+
+// The history is kept in the shared state, rather than the environment, so that it isn't committed.
+func (e *Env) historyPath() string {
+	sum := sha256.Sum256([]byte(e.envDir))
+	return filepath.Join(e.state.Root(), "history", hex.EncodeToString(sum[:16])+".jsonl")
+}
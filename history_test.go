@@ -0,0 +1,75 @@
+package hermit_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/hermittest"
+	"github.com/cashapp/hermit/manifest"
+)
+
+func TestRollback(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tar := TestTarGz{map[string]string{"bin": "foo"}}
+		tar.Write(t, w)
+	})
+	f := hermittest.NewEnvTestFixture(t, handler)
+	f.WithManifests(map[string]string{
+		"test.hcl": `
+			description = ""
+			binaries = ["bin"]
+			version "1.0.0" "1.1.0" "2.0.0" {
+			  source = "` + f.Server.URL + `/test-${version}.tar.gz"
+			}
+		`,
+	})
+	defer f.Clean()
+
+	installed := func() []string {
+		refs, err := f.Env.ListInstalledReferences()
+		require.NoError(t, err)
+		out := []string{}
+		for _, ref := range refs {
+			out = append(out, ref.String())
+		}
+		return out
+	}
+
+	pkg, err := f.Env.Resolve(f.P, manifest.ExactSelector(manifest.ParseReference("test-1.0.0")), false)
+	require.NoError(t, err)
+	_, err = f.Env.Install(f.P, pkg)
+	require.NoError(t, err)
+	_, _, err = f.Env.Rollback(f.P, "test")
+	require.EqualError(t, err, "no previous version of test-1.0.0 is recorded")
+
+	_, err = f.Env.Upgrade(f.P, pkg)
+	require.NoError(t, err)
+	require.Equal(t, []string{"test-1.1.0"}, installed())
+	pkg, err = f.Env.Resolve(f.P, manifest.ExactSelector(manifest.ParseReference("test-2.0.0")), false)
+	require.NoError(t, err)
+	_, err = f.Env.Install(f.P, pkg)
+	require.NoError(t, err)
+
+	history, err := f.Env.History()
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	require.Equal(t, "test-1.0.0", history[0].From)
+	require.Equal(t, "test-1.1.0", history[0].To)
+
+	// Rolling back repeatedly walks back through the history.
+	pkg, _, err = f.Env.Rollback(f.P, "test")
+	require.NoError(t, err)
+	require.Equal(t, "test-1.1.0", pkg.Reference.String())
+	require.Equal(t, []string{"test-1.1.0"}, installed())
+	pkg, _, err = f.Env.Rollback(f.P, "test")
+	require.NoError(t, err)
+	require.Equal(t, "test-1.0.0", pkg.Reference.String())
+	require.Equal(t, []string{"test-1.0.0"}, installed())
+	_, _, err = f.Env.Rollback(f.P, "test")
+	require.Error(t, err)
+
+	_, _, err = f.Env.Rollback(f.P, "missing")
+	require.EqualError(t, err, "no installed package 'missing' found")
+}
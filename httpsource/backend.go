@@ -0,0 +1,171 @@
+package httpsource
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/checksums"
+	"github.com/cashapp/hermit/sources"
+	"github.com/cashapp/hermit/ui"
+)
+
+// Fragment of source URIs whose index is used without verifying its signature.
+const unsignedFragment = "unsigned"
+
+// The index is kept alongside the synchronised manifests, under a name that isn't loaded as a manifest.
+const indexFile = "index.json"
+
+// Backend returns a sources.Backend that synchronises manifests from
+// "http://" and "https://" sources pointing at an Index.
+//
+// The source URI must have a "#key=<key>" fragment, and the index a detached
+// signature at "<index>.sig" made with the PGP or minisign key "<key>",
+// unless verification is explicitly disabled with an "#unsigned" fragment.
+func (c *Client) Backend() sources.Backend {
+	return &backend{client: c}
+}
+
+type backend struct {
+	client *Client
+}
+
+func (b *backend) Resolve(uri *url.URL, sourcesDir string) (string, error) {
+	if uri.Host == "" {
+		return "", errors.New("missing host")
+	}
+	if uri.Fragment != unsignedFragment && !strings.HasPrefix(uri.Fragment, "key=") {
+		return "", errors.Errorf("%s: the index must be signed, add #key=<key> to the source to verify it, or #%s to use it without verification", uri, unsignedFragment)
+	}
+	b.client.addHost(uri)
+	return sources.DefaultBackendDir(uri, sourcesDir), nil
+}
+
+func (b *backend) Sync(task *ui.Task, uri *url.URL, dir string) error {
+	ctx := context.Background()
+	indexURL, key := splitKey(uri)
+	data, err := b.get(ctx, indexURL)
+	if err != nil {
+		return err
+	}
+	if uri.Fragment == unsignedFragment {
+		task.Warnf("Not verifying %s, as its source is marked #%s", indexURL, unsignedFragment)
+	} else {
+		sig, err := b.get(ctx, indexURL+".sig")
+		if err != nil {
+			return errors.Wrap(err, "could not retrieve index signature")
+		}
+		if err := checksums.VerifySignature(data, sig, key); err != nil {
+			return errors.Wrap(err, indexURL)
+		}
+	}
+	index, err := ParseIndex(indexURL, data)
+	if err != nil {
+		return err
+	}
+	base, err := url.Parse(indexURL)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	task.Debugf("Syncing %d manifests from %s", len(index.Manifests), indexURL)
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	for _, entry := range index.Manifests {
+		manifestURL, err := entry.resolve(base)
+		if err != nil {
+			return errors.Wrap(err, indexURL)
+		}
+		content, err := b.get(ctx, manifestURL.String())
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		if actual := hex.EncodeToString(sum[:]); !strings.EqualFold(actual, entry.SHA256) {
+			return errors.Errorf("%s: sha256 is %s but the index has %s", manifestURL, actual, entry.SHA256)
+		}
+		if err := os.WriteFile(filepath.Join(tmpDir, entry.name()), content, 0600); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	// Artifact URLs are resolved when the manifests are loaded, as syncs are infrequent.
+	resolved := &Index{Manifests: index.Manifests}
+	for _, entry := range index.Artifacts {
+		artifactURL, err := entry.resolve(base)
+		if err != nil {
+			return errors.Wrap(err, indexURL)
+		}
+		resolved.Artifacts = append(resolved.Artifacts, Entry{Path: artifactURL.String(), SHA256: entry.SHA256})
+	}
+	encoded, err := json.Marshal(resolved)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.WriteFile(filepath.Join(tmpDir, indexFile), encoded, 0600); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmpDir, dir))
+}
+
+func (b *backend) get(ctx context.Context, uri string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	resp, err := b.client.client.Do(req)
+	if err != nil {
+		return nil, errors.Wrap(err, uri)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s: %s", uri, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	return data, errors.Wrap(err, uri)
+}
+
+func (b *backend) Fetch(_ *url.URL, dir string) (fs.FS, error) {
+	data, err := os.ReadFile(filepath.Join(dir, indexFile))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	index := &Index{}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, entry := range index.Artifacts {
+		artifactURL, err := url.Parse(entry.Path)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		b.client.addArtifact(artifactURL, entry.SHA256)
+	}
+	return os.DirFS(dir), nil
+}
+
+// Split the key fragment from a source URI.
+func splitKey(uri *url.URL) (indexURL, key string) {
+	u := *uri
+	u.Fragment = ""
+	u.RawFragment = ""
+	return u.String(), strings.TrimPrefix(uri.Fragment, "key=")
+}
@@ -0,0 +1,146 @@
+package httpsource
+
+import (
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/cache"
+)
+
+// Option for the Client.
+type Option func(*Client)
+
+// WithCredentials sets the store credentials for HTTP sources are retrieved from.
+//
+// Defaults to DefaultCredentials().
+func WithCredentials(store CredentialStore) Option {
+	return func(c *Client) { c.credentials = store }
+}
+
+// Client for manifest sources served from an HTTP index.
+type Client struct {
+	client      *http.Client
+	credentials CredentialStore
+
+	lock sync.Mutex
+	// Hosts of the HTTP sources in use, which credentials are sent to.
+	hosts map[string]bool
+	// Authorization header values, keyed by host.
+	auth map[string]string
+	// SHA256 of artifacts listed in indexes, keyed by URL.
+	artifacts map[string]string
+}
+
+// New creates a new Client.
+func New(client *http.Client, options ...Option) *Client {
+	c := &Client{
+		credentials: DefaultCredentials(),
+		hosts:       map[string]bool{},
+		auth:        map[string]string{},
+		artifacts:   map[string]string{},
+	}
+	for _, option := range options {
+		option(c)
+	}
+	c.client = c.Wrap(client)
+	return c
+}
+
+// WithTransport returns a RoundTripper that authenticates requests to the
+// hosts of HTTP sources in use, and passes all requests through to
+// "transport".
+//
+// Downloads of artifacts listed in an index are verified against the SHA256
+// in the index.
+func (c *Client) WithTransport(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &authTransport{client: c, rt: transport}
+}
+
+// Wrap returns a copy of "client" whose transport is wrapped with WithTransport.
+func (c *Client) Wrap(client *http.Client) *http.Client {
+	out := *client
+	out.Transport = c.WithTransport(client.Transport)
+	return &out
+}
+
+// Send credentials to the host of "uri".
+func (c *Client) addHost(uri *url.URL) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.hosts[uri.Host] = true
+}
+
+func (c *Client) addArtifact(uri *url.URL, sha256 string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.artifacts[uri.String()] = sha256
+}
+
+// Returns the Authorization header for requests to "uri", if any.
+//
+// Credentials are never sent in the clear, so requests that are not over HTTPS have none.
+func (c *Client) authorization(uri *url.URL) (string, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if !c.hosts[uri.Host] || uri.Scheme != "https" {
+		return "", nil
+	}
+	if auth, ok := c.auth[uri.Host]; ok {
+		return auth, nil
+	}
+	creds, err := c.credentials(uri.Hostname())
+	if err != nil {
+		return "", errors.Wrapf(err, "%s: could not retrieve credentials", uri.Host)
+	}
+	auth := ""
+	switch {
+	case creds == nil:
+	case creds.Token != "":
+		auth = "Bearer " + creds.Token
+	case creds.Username != "" || creds.Password != "":
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(creds.Username, creds.Password)
+		auth = req.Header.Get("Authorization")
+	}
+	c.auth[uri.Host] = auth
+	return auth, nil
+}
+
+func (c *Client) artifactSHA256(uri *url.URL) string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.artifacts[uri.String()]
+}
+
+type authTransport struct {
+	client *Client
+	rt     http.RoundTripper
+}
+
+func (a *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return a.rt.RoundTrip(req)
+	}
+	auth, err := a.client.authorization(req.URL)
+	if err != nil {
+		return nil, err
+	}
+	if auth != "" && req.Header.Get("Authorization") == "" {
+		req = req.Clone(req.Context())
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := a.rt.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if sha := a.client.artifactSHA256(req.URL); sha != "" {
+		cache.SetExpectedDigest(resp, "sha256:"+sha)
+	}
+	return resp, nil
+}
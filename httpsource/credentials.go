@@ -0,0 +1,50 @@
+package httpsource
+
+import (
+	"os"
+
+	"github.com/cashapp/hermit/util"
+)
+
+// TokenEnvar is the environment variable containing a bearer token for HTTP sources.
+const TokenEnvar = "HERMIT_HTTP_SOURCE_TOKEN"
+
+// Credentials for an HTTP source.
+type Credentials struct {
+	Username string
+	Password string
+	// Token is sent as a bearer token, instead of the username and password, if set.
+	Token string
+}
+
+// A CredentialStore looks up credentials for a host.
+//
+// It returns nil credentials if there are none for the host.
+type CredentialStore func(host string) (*Credentials, error)
+
+// DefaultCredentials returns a CredentialStore that uses the bearer token in
+// $HERMIT_HTTP_SOURCE_TOKEN if set, or otherwise the login and password for
+// the host in $NETRC or ~/.netrc (~/_netrc on Windows).
+func DefaultCredentials() CredentialStore {
+	return func(host string) (*Credentials, error) {
+		if token := os.Getenv(TokenEnvar); token != "" {
+			return &Credentials{Token: token}, nil
+		}
+		path := util.NetrcPath()
+		if path == "" {
+			return nil, nil
+		}
+		return NetrcCredentials(path)(host)
+	}
+}
+
+// NetrcCredentials returns a CredentialStore backed by the netrc file at "path".
+func NetrcCredentials(path string) CredentialStore {
+	return func(host string) (*Credentials, error) {
+		entry, err := util.Netrc(path, host)
+		if err != nil || entry == nil {
+			return nil, err
+		}
+		return &Credentials{Username: entry.Login, Password: entry.Password}, nil
+	}
+}
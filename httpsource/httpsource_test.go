@@ -0,0 +1,164 @@
+package httpsource
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/sources"
+	"github.com/cashapp/hermit/ui"
+)
+
+// Sign "data" in the minisign format, returning the public key and signature file.
+func minisign(t *testing.T, data []byte) (key string, sig []byte) {
+	t.Helper()
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyID := []byte("hermitid")
+	key = base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pk...))
+	signature := ed25519.Sign(sk, data)
+	trusted := "timestamp:1600000000\tfile:index.json"
+	global := ed25519.Sign(sk, append(append([]byte{}, signature...), trusted...))
+	sig = []byte(fmt.Sprintf("untrusted comment: signature\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), signature...)),
+		trusted,
+		base64.StdEncoding.EncodeToString(global)))
+	return key, sig
+}
+
+func sha256Hex(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestHTTPSource(t *testing.T) {
+	manifest := `description = "Protocol buffers"`
+	artifact := "protoc binary"
+	index := fmt.Sprintf(`{
+  "manifests": [{"path": "manifests/protoc.hcl", "sha256": %q}],
+  "artifacts": [{"path": "artifacts/protoc.tar.gz", "sha256": %q}]
+}`, sha256Hex(manifest), sha256Hex(artifact))
+	key, sig := minisign(t, []byte(index))
+	files := map[string]string{
+		"/hermit/index.json":              index,
+		"/hermit/index.json.sig":          string(sig),
+		"/hermit/manifests/protoc.hcl":    manifest,
+		"/hermit/artifacts/protoc.tar.gz": artifact,
+	}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, password, ok := r.BasicAuth(); !ok || user != "hermit" || password != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		content, ok := files[r.URL.Path]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(content))
+	}))
+	defer srv.Close()
+	srvURL, err := url.Parse(srv.URL)
+	require.NoError(t, err)
+
+	netrc := filepath.Join(t.TempDir(), ".netrc")
+	err = os.WriteFile(netrc, []byte("machine "+srvURL.Hostname()+"\n  login hermit\n  password secret\n"), 0600)
+	require.NoError(t, err)
+	client := New(srv.Client(), WithCredentials(NetrcCredentials(netrc)))
+
+	p, _ := ui.NewForTesting()
+	uri, err := url.Parse(srv.URL + "/hermit/index.json#key=" + key)
+	require.NoError(t, err)
+	source, err := sources.NewBackendSource(client.Backend(), uri, t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, source.Sync(p, false))
+	data, err := fs.ReadFile(source.Bundle(), "protoc.hcl")
+	require.NoError(t, err)
+	require.Equal(t, manifest, string(data))
+
+	// Artifacts are authenticated, and verified against the SHA256 in the index.
+	resp, err := client.Wrap(srv.Client()).Get(srv.URL + "/hermit/artifacts/protoc.tar.gz")
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, sha256Hex(artifact), resp.Header.Get("X-Hermit-Expected-Sha256"))
+
+	// Indexes not signed by the key are rejected.
+	otherKey, _ := minisign(t, []byte(index))
+	uri, err = url.Parse(srv.URL + "/hermit/index.json#key=" + otherKey)
+	require.NoError(t, err)
+	source, err = sources.NewBackendSource(client.Backend(), uri, t.TempDir())
+	require.NoError(t, err)
+	require.Error(t, source.Sync(p, false))
+
+	// Indexes are only used unsigned if explicitly allowed.
+	uri, err = url.Parse(srv.URL + "/hermit/index.json")
+	require.NoError(t, err)
+	_, err = sources.NewBackendSource(client.Backend(), uri, t.TempDir())
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "the index must be signed")
+	uri, err = url.Parse(srv.URL + "/hermit/index.json#unsigned")
+	require.NoError(t, err)
+	source, err = sources.NewBackendSource(client.Backend(), uri, t.TempDir())
+	require.NoError(t, err)
+	require.NoError(t, source.Sync(p, false))
+
+	// As are manifests that don't match the index.
+	files["/hermit/manifests/protoc.hcl"] = "tampered"
+	uri, err = url.Parse(srv.URL + "/hermit/index.json#key=" + key)
+	require.NoError(t, err)
+	source, err = sources.NewBackendSource(client.Backend(), uri, t.TempDir())
+	require.NoError(t, err)
+	err = source.Sync(p, false)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "sha256")
+}
+
+func TestParseIndex(t *testing.T) {
+	index, err := ParseIndex("https://example.com/index.hcl", []byte(`
+manifest "protoc.hcl" { sha256 = "abc" }
+artifact "protoc/protoc.zip" { sha256 = "def" }
+`))
+	require.NoError(t, err)
+	require.Equal(t, &Index{
+		Manifests: []Entry{{Path: "protoc.hcl", SHA256: "abc"}},
+		Artifacts: []Entry{{Path: "protoc/protoc.zip", SHA256: "def"}},
+	}, index)
+
+	_, err = ParseIndex("index.json", []byte(`{"manifests": [{"path": "protoc.hcl"}]}`))
+	require.Error(t, err)
+	_, err = ParseIndex("index.json", []byte(`{"manifests": [{"path": "protoc", "sha256": "abc"}]}`))
+	require.Error(t, err)
+}
+
+func TestHTTPSourceCredentialsRequireHTTPS(t *testing.T) {
+	var auth []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = append(auth, r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer srv.Close()
+	client := New(srv.Client(), WithCredentials(func(host string) (*Credentials, error) {
+		return &Credentials{Token: "secret"}, nil
+	}))
+
+	p, _ := ui.NewForTesting()
+	uri, err := url.Parse(srv.URL + "/hermit/index.json#unsigned")
+	require.NoError(t, err)
+	source, err := sources.NewBackendSource(client.Backend(), uri, t.TempDir())
+	require.NoError(t, err)
+	require.Error(t, source.Sync(p, false))
+	require.Equal(t, []string{""}, auth)
+}
@@ -0,0 +1,76 @@
+package httpsource
+
+import (
+	"encoding/json"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/alecthomas/hcl"
+	"github.com/pkg/errors"
+)
+
+// Index of the manifests and package artifacts served by an HTTP source.
+//
+// Indexes ending in ".json" are JSON:
+//
+//	{
+//	  "manifests": [{"path": "protoc.hcl", "sha256": "..."}],
+//	  "artifacts": [{"path": "protoc/protoc-3.19.4-linux-amd64.zip", "sha256": "..."}]
+//	}
+//
+// Otherwise they are HCL:
+//
+//	manifest "protoc.hcl" { sha256 = "..." }
+//	artifact "protoc/protoc-3.19.4-linux-amd64.zip" { sha256 = "..." }
+//
+// Paths are relative to the index.
+type Index struct {
+	Manifests []Entry `json:"manifests" hcl:"manifest,block"`
+	Artifacts []Entry `json:"artifacts,omitempty" hcl:"artifact,block"`
+}
+
+// Entry for a file in an Index.
+type Entry struct {
+	Path   string `json:"path" hcl:"path,label"`
+	SHA256 string `json:"sha256" hcl:"sha256"`
+}
+
+// ParseIndex parses an index retrieved from "name", in JSON if "name" ends in ".json" and HCL otherwise.
+func ParseIndex(name string, data []byte) (*Index, error) {
+	index := &Index{}
+	var err error
+	if strings.HasSuffix(name, ".json") {
+		err = json.Unmarshal(data, index)
+	} else {
+		err = hcl.Unmarshal(data, index)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s: invalid index", name)
+	}
+	for _, entry := range index.Manifests {
+		if !strings.HasSuffix(entry.Path, ".hcl") {
+			return nil, errors.Errorf("%s: manifest %q must end in .hcl", name, entry.Path)
+		}
+	}
+	for _, entry := range append(index.Manifests, index.Artifacts...) {
+		if entry.SHA256 == "" {
+			return nil, errors.Errorf("%s: %q has no sha256", name, entry.Path)
+		}
+	}
+	return index, nil
+}
+
+// Name a manifest is stored under, as manifests are looked up by file name.
+func (e Entry) name() string {
+	return path.Base(e.Path)
+}
+
+// Resolve the URL of an entry relative to the index at "base".
+func (e Entry) resolve(base *url.URL) (*url.URL, error) {
+	ref, err := url.Parse(e.Path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid path %q", e.Path)
+	}
+	return base.ResolveReference(ref), nil
+}
@@ -0,0 +1,266 @@
+package hermit
+
+import (
+	"net/url"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/envars"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+	"github.com/cashapp/hermit/util"
+)
+
+// An environment can inherit from a parent environment, eg. the root of a
+// mono-repo, with "inherit" in its hermit.hcl:
+//
+//   - Packages installed in the parent are available in the child, unless the
+//     child installs a package of the same name.
+//   - The child's sources are searched before the parent's.
+//   - Environment variables configured in the child override the parent's.
+//
+// The binaries of inherited packages are linked into the child's bin
+// directory, so that activating the child makes them available. On Windows,
+// where binaries are stubs, the parent's bin directory is added to PATH
+// after the child's instead.
+
+// Open the environment "e" inherits from, if any. "seen" are the environments
+// already opened while following inheritance, to detect cycles.
+func (e *Env) openParent(seen map[string]bool, ephemeral envars.Envars) error {
+	if e.config.Inherit == "" {
+		return nil
+	}
+	dir := e.config.Inherit
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(e.envDir, dir)
+	}
+	dir = util.RealPath(dir)
+	if seen[dir] {
+		return errors.Errorf("%s: inheriting from %s creates a cycle", e.configFile, dir)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "bin", "hermit.hcl")); err != nil {
+		return errors.Errorf("%s: inherited environment %s not found", e.configFile, dir)
+	}
+	parent, err := openEnv(dir, e.state, ephemeral, e.httpClient, seen)
+	if err != nil {
+		return err
+	}
+	e.parent = parent
+	return nil
+}
+
+// Parent returns the environment this environment inherits from, or nil.
+func (e *Env) Parent() *Env {
+	return e.parent
+}
+
+// Inherited returns the packages inherited from parent environments that are
+// not overridden by a package of the same name installed in this environment.
+func (e *Env) Inherited(l *ui.UI) ([]*manifest.Package, error) {
+	if e.parent == nil {
+		return nil, nil
+	}
+	own, err := e.ListInstalledReferences()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	overridden := map[string]bool{}
+	for _, ref := range own {
+		overridden[ref.Name] = true
+	}
+	pkgs, err := e.parent.listActive(l)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	out := []*manifest.Package{}
+	for _, pkg := range pkgs {
+		if !overridden[pkg.Reference.Name] {
+			out = append(out, pkg)
+		}
+	}
+	return out, nil
+}
+
+// Packages installed in this environment, followed by the packages it inherits.
+func (e *Env) listActive(l *ui.UI) ([]*manifest.Package, error) {
+	pkgs, err := e.ListInstalled(l)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	inherited, err := e.Inherited(l)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return append(pkgs, inherited...), nil
+}
+
+// LinkInherited links the binaries of inherited packages into this
+// environment's bin directory, and removes links to binaries that are no
+// longer inherited.
+//
+// This is a no-op on platforms that use stubs.
+func (e *Env) LinkInherited(l *ui.UI) error {
+	if useExeStubs {
+		return nil
+	}
+	task := l.Task("inherit")
+	defer task.Done()
+	wanted := map[string]string{}
+	if e.parent != nil {
+		inherited, err := e.Inherited(l)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, pkg := range inherited {
+			binaries, err := e.parent.inheritableBinaries(pkg)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			for _, binary := range binaries {
+				wanted[filepath.Base(binary)] = binary
+			}
+		}
+	}
+	entries, err := os.ReadDir(e.binDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, entry := range entries {
+		path := filepath.Join(e.binDir, entry.Name())
+		target, ok := e.inheritedLinkTarget(path)
+		if !ok {
+			delete(wanted, entry.Name())
+			continue
+		}
+		if wanted[entry.Name()] == target {
+			delete(wanted, entry.Name())
+			continue
+		}
+		if err := e.unlink(task, path); err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+	}
+	for name, binary := range wanted {
+		target, err := filepath.Rel(e.binDir, binary)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if err := e.linkIntoEnv(task, target, filepath.Join(e.binDir, name)); err != nil {
+			return errors.Wrapf(err, "failed to link inherited binary %s", name)
+		}
+	}
+	return nil
+}
+
+// Returns the links of a package's binaries in this environment, or in the
+// environment this one inherits them from.
+func (e *Env) inheritableBinaries(pkg *manifest.Package) ([]string, error) {
+	if _, err := os.Lstat(e.pkgLink(pkg)); err == nil {
+		return e.LinkedBinaries(pkg)
+	}
+	if e.parent == nil {
+		return nil, nil
+	}
+	return e.parent.inheritableBinaries(pkg)
+}
+
+// If "path" is a link to a binary in the bin directory of a parent
+// environment, returns the binary it links to.
+func (e *Env) inheritedLinkTarget(path string) (string, bool) {
+	target, err := os.Readlink(path)
+	if err != nil {
+		return "", false
+	}
+	if !filepath.IsAbs(target) {
+		target = filepath.Join(e.binDir, target)
+	}
+	for parent := e.parent; parent != nil; parent = parent.parent {
+		if filepath.Dir(target) == parent.binDir {
+			return target, true
+		}
+	}
+	// Links to environments that are no longer inherited from.
+	if filepath.Dir(target) != e.binDir && filepath.Base(filepath.Dir(target)) == "bin" {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(target), "hermit.hcl")); err == nil {
+			return target, true
+		}
+	}
+	return "", false
+}
+
+// Remove links to inherited binaries that "files" would replace, as packages
+// installed in an environment override inherited ones.
+func (e *Env) unlinkInherited(task *ui.Task, files []string) error {
+	for _, file := range files {
+		link := filepath.Join(e.binDir, filepath.Base(file))
+		if _, ok := e.inheritedLinkTarget(link); !ok {
+			continue
+		}
+		if err := e.unlink(task, link); err != nil && !os.IsNotExist(err) {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Returns the source URIs of an environment, followed by those it inherits
+// that it doesn't already have.
+//
+// Sources relative to a parent environment are made absolute.
+func (e *Env) sourceURIs() []string {
+	if e.parent == nil {
+		return e.config.Sources
+	}
+	inherited := e.parent.sourceURIs()
+	if inherited == nil {
+		return e.config.Sources
+	}
+	uris := append([]string{}, e.config.Sources...)
+	have := map[string]bool{}
+	for _, uri := range uris {
+		have[uri] = true
+	}
+	for _, uri := range inherited {
+		if u, err := url.Parse(uri); err == nil && u.Scheme == "env" && u.Path != "" {
+			uri = "file://" + filepath.ToSlash(filepath.Join(e.parent.envDir, u.Path))
+		}
+		if !have[uri] {
+			have[uri] = true
+			uris = append(uris, uri)
+		}
+	}
+	return uris
+}
+
+// Environment variables configured in this environment and the environments it inherits from.
+func (e *Env) configuredEnvars() envars.Envars {
+	if e.parent == nil {
+		return e.config.Envars
+	}
+	merged := envars.Envars{}
+	for key, value := range e.parent.configuredEnvars() {
+		merged[key] = value
+	}
+	for key, value := range e.config.Envars {
+		merged[key] = value
+	}
+	return merged
+}
+
+// Operations adding the bin directories of parent environments to PATH, after this one's.
+//
+// This is only necessary on platforms that use stubs, as elsewhere inherited
+// binaries are linked into the environment.
+func (e *Env) inheritedPathEnvars() envars.Ops {
+	if !useExeStubs {
+		return nil
+	}
+	var ops envars.Ops
+	for parent := e.parent; parent != nil; parent = parent.parent {
+		// Prepended in reverse, so that nearer environments come first.
+		ops = append(envars.Ops{&envars.Prepend{Name: "PATH", Value: parent.binDir}}, ops...)
+	}
+	return ops
+}
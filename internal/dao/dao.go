@@ -17,6 +17,8 @@ const (
 	updateCheckedAtKey = "updateCheckedAt"
 	eTagKey            = "etag"
 	environmentsKey    = "environments"
+	provenanceKey      = "provenance"
+	fetchedAtKey       = "fetchedAt"
 	timeformat         = time.RFC3339
 )
 
@@ -30,6 +32,8 @@ type Package struct {
 	UsedAt          time.Time
 	Etag            string
 	UpdateCheckedAt time.Time
+	// When the package was last fetched because its channel changed, if it ever was.
+	FetchedAt time.Time
 }
 
 // Open returns a new DAO at the given state directory
@@ -85,6 +89,46 @@ func (d *DAO) GetUnusedSince(usedAt time.Time) ([]string, error) {
 	return res, nil
 }
 
+// GetPackageNames returns the names of all packages in the DB
+func (d *DAO) GetPackageNames() ([]string, error) {
+	res := []string{}
+	err := d.view(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(name []byte, _ *bolt.Bucket) error {
+			res = append(res, string(name))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res, nil
+}
+
+// GetKnownEnvironments returns the bin directories of all environments any package has been seen in
+func (d *DAO) GetKnownEnvironments() ([]string, error) {
+	seen := map[string]bool{}
+	res := []string{}
+	err := d.view(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(_ []byte, b *bolt.Bucket) error {
+			ub := b.Bucket([]byte(environmentsKey))
+			if ub == nil {
+				return nil
+			}
+			return ub.ForEach(func(k, _ []byte) error {
+				if !seen[string(k)] {
+					seen[string(k)] = true
+					res = append(res, string(k))
+				}
+				return nil
+			})
+		})
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res, nil
+}
+
 // UpdatePackageWithUsage updates the given package and records its installation directory
 func (d *DAO) UpdatePackageWithUsage(binDir string, name string, pkg *Package) error {
 	return errors.WithStack(d.update(func(tx *bolt.Tx) error {
@@ -124,12 +168,53 @@ func (d *DAO) PackageRemovedAt(name string, binDir string) error {
 			if err != nil {
 				return errors.WithStack(err)
 			}
-			return ub.Delete([]byte(binDir))
+			if err := ub.Delete([]byte(binDir)); err != nil {
+				return errors.WithStack(err)
+			}
+			if pb := b.Bucket([]byte(provenanceKey)); pb != nil {
+				return pb.Delete([]byte(binDir))
+			}
 		}
 		return nil
 	}))
 }
 
+// PutProvenance records how a package was installed in the given bin directory
+func (d *DAO) PutProvenance(name string, binDir string, provenance []byte) error {
+	return errors.WithStack(d.update(func(tx *bolt.Tx) error {
+		b, err := tx.CreateBucketIfNotExists([]byte(name))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		pb, err := b.CreateBucketIfNotExists([]byte(provenanceKey))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return pb.Put([]byte(binDir), provenance)
+	}))
+}
+
+// GetProvenance returns how a package was installed in the given bin directory, or nil if it wasn't recorded
+func (d *DAO) GetProvenance(name string, binDir string) ([]byte, error) {
+	var res []byte
+	err := d.view(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(name))
+		if b == nil {
+			return nil
+		}
+		if pb := b.Bucket([]byte(provenanceKey)); pb != nil {
+			if value := pb.Get([]byte(binDir)); value != nil {
+				res = append([]byte{}, value...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return res, nil
+}
+
 // GetKnownUsages returns a list of bin directories where this package has been seen previously
 func (d *DAO) GetKnownUsages(name string) ([]string, error) {
 	db, err := d.db()
@@ -238,6 +323,7 @@ func packageAt(b *bolt.Bucket) *Package {
 		UsedAt:          timeAt(b, usedAtKey),
 		Etag:            stringAt(b, eTagKey),
 		UpdateCheckedAt: timeAt(b, updateCheckedAtKey),
+		FetchedAt:       timeAt(b, fetchedAtKey),
 	}
 }
 
@@ -248,6 +334,12 @@ func putPackage(b *bolt.Bucket, pkg *Package) error {
 	if err := putTime(b, updateCheckedAtKey, pkg.UpdateCheckedAt); err != nil {
 		return err
 	}
+	// Only channel updates know when the package was fetched, so don't reset it otherwise.
+	if !pkg.FetchedAt.IsZero() {
+		if err := putTime(b, fetchedAtKey, pkg.FetchedAt); err != nil {
+			return err
+		}
+	}
 	return putTime(b, usedAtKey, pkg.UsedAt)
 }
 
@@ -0,0 +1,104 @@
+// Package lockfile records the exact packages an environment resolved to, so
+// that they can be reproduced on other machines.
+package lockfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/platform"
+)
+
+// Name of the lock file in an environment's bin directory.
+const Name = "hermit.lock"
+
+// ErrNotLocked is returned when a package is not present in the lock file.
+var ErrNotLocked = errors.New("not in lock file")
+
+// Entry is a package resolved for a single platform.
+type Entry struct {
+	Reference string `json:"reference"`
+	OS        string `json:"os"`
+	Arch      string `json:"arch"`
+	Source    string `json:"source"`
+	SHA256    string `json:"sha256,omitempty"`
+}
+
+// Lock is the set of locked packages.
+type Lock struct {
+	Packages []Entry `json:"packages"`
+}
+
+// Load a lock file.
+//
+// If the lock file does not exist, the returned error will match os.ErrNotExist.
+func Load(path string) (*Lock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	lock := &Lock{}
+	if err := json.Unmarshal(data, lock); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	return lock, nil
+}
+
+// Save the lock file to "path", sorted so that it produces minimal diffs.
+func (l *Lock) Save(path string) error {
+	sort.Slice(l.Packages, func(i, j int) bool {
+		a, b := l.Packages[i], l.Packages[j]
+		if a.Reference != b.Reference {
+			return a.Reference < b.Reference
+		}
+		if a.OS != b.OS {
+			return a.OS < b.OS
+		}
+		return a.Arch < b.Arch
+	})
+	w := &bytes.Buffer{}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(l); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.WriteFile(path, w.Bytes(), 0644))
+}
+
+// Lookup the entry for a package reference on a platform.
+func (l *Lock) Lookup(ref manifest.Reference, p platform.Platform) (Entry, bool) {
+	for _, entry := range l.Packages {
+		if entry.Reference == ref.String() && entry.OS == p.OS && entry.Arch == p.Arch {
+			return entry, true
+		}
+	}
+	return Entry{}, false
+}
+
+// Apply the lock to a package resolved for platform "p".
+//
+// An error is returned if the package is not locked, or if it has deviated
+// from the lock. Otherwise the package's SHA256 is set from the lock, so that
+// its download is verified against it.
+func (l *Lock) Apply(pkg *manifest.Package, p platform.Platform) error {
+	entry, ok := l.Lookup(pkg.Reference, p)
+	if !ok {
+		return errors.Wrapf(ErrNotLocked, "%s on %s", pkg, p)
+	}
+	if entry.Source != pkg.Source {
+		return errors.Errorf("%s: source %s does not match locked source %s", pkg, pkg.Source, entry.Source)
+	}
+	if entry.SHA256 == "" {
+		return nil
+	}
+	if pkg.SHA256 != "" && pkg.SHA256 != entry.SHA256 {
+		return errors.Errorf("%s: sha256 %s does not match locked sha256 %s", pkg, pkg.SHA256, entry.SHA256)
+	}
+	pkg.SHA256 = entry.SHA256
+	return nil
+}
@@ -0,0 +1,50 @@
+package lockfile
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/manifest/manifesttest"
+	"github.com/cashapp/hermit/platform"
+)
+
+func TestLockRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), Name)
+	lock := &Lock{Packages: []Entry{
+		{Reference: "go-1.21.0", OS: "linux", Arch: "amd64", Source: "https://example.com/go-linux.tgz", SHA256: "abc"},
+		{Reference: "go-1.21.0", OS: "darwin", Arch: "arm64", Source: "https://example.com/go-darwin.tgz", SHA256: "def"},
+	}}
+	require.NoError(t, lock.Save(path))
+	loaded, err := Load(path)
+	require.NoError(t, err)
+	require.Equal(t, "darwin", loaded.Packages[0].OS)
+	require.Equal(t, lock, loaded)
+
+	_, err = Load(filepath.Join(t.TempDir(), Name))
+	require.Error(t, err)
+}
+
+func TestApply(t *testing.T) {
+	linux := platform.Platform{OS: "linux", Arch: "amd64"}
+	lock := &Lock{Packages: []Entry{
+		{Reference: "go-1.21.0", OS: "linux", Arch: "amd64", Source: "https://example.com/go.tgz", SHA256: "abc"},
+	}}
+	pkg := manifesttest.NewPkgBuilder("/pkg/go-1.21.0").WithName("go").WithVersion("1.21.0").WithSource("https://example.com/go.tgz").Result()
+	require.NoError(t, lock.Apply(pkg, linux))
+	require.Equal(t, "abc", pkg.SHA256)
+
+	pkg.SHA256 = "xyz"
+	require.Error(t, lock.Apply(pkg, linux))
+
+	pkg.SHA256 = ""
+	pkg.Source = "https://example.com/other.tgz"
+	require.Error(t, lock.Apply(pkg, linux))
+
+	err := lock.Apply(pkg, platform.Platform{OS: "darwin", Arch: "arm64"})
+	require.ErrorIs(t, err, ErrNotLocked)
+
+	newer := manifesttest.NewPkgBuilder("/pkg/go-1.22.0").WithName("go").WithVersion("1.22.0").WithSource("https://example.com/go.tgz").Result()
+	require.ErrorIs(t, lock.Apply(newer, linux), ErrNotLocked)
+}
@@ -12,7 +12,9 @@ import (
 	"github.com/kballard/go-shellquote"
 	"github.com/pkg/errors"
 
+	hsandbox "github.com/cashapp/hermit/sandbox"
 	"github.com/cashapp/hermit/shell"
+	"github.com/cashapp/hermit/ui"
 	"github.com/cashapp/hermit/vfs"
 )
 
@@ -104,9 +106,52 @@ func (r *RunAction) String() string {
 	return fmt.Sprintf("%s %s", r.Command, shellquote.Join(r.Args...))
 }
 func (r *RunAction) Apply(p *Package) error { // nolint
+	cmd, err := r.command(p)
+	if err != nil {
+		return err
+	}
+	out, err := cmd.Output()
+	if err != nil {
+		return errors.Wrapf(err, "%s: failed to execute %q: %s", p, r.Command, string(out))
+	}
+	return nil
+}
+
+// Apply the action with its command only allowed to write to "writable".
+//
+// If the command can't be sandboxed on this system it fails, unless running
+// unconfined has been allowed with sandbox.AllowUnconfined.
+func (r *RunAction) applyConfined(l ui.Logger, p *Package, writable []string) error {
+	for _, path := range writable {
+		if path == "/" {
+			return r.Apply(p)
+		}
+	}
+	cmd, err := r.command(p)
+	if err != nil {
+		return err
+	}
+	out, err := hsandbox.Policy{Writable: writable}.Output(cmd)
+	var violation *hsandbox.ViolationError
+	switch {
+	case errors.Is(err, hsandbox.ErrUnsupported) || errors.Is(err, hsandbox.ErrUnavailable):
+		if !hsandbox.UnconfinedAllowed() {
+			return errors.Errorf("%s: %s: can't sandbox %q: %s, set --insecure-no-sandbox or HERMIT_INSECURE_NO_SANDBOX=true to run it unconfined", p, r.Pos, r.Command, err)
+		}
+		l.Warnf("Not sandboxing %q: %s", r.Command, err)
+		return r.Apply(p)
+	case errors.As(err, &violation):
+		return errors.Errorf("%s: %s: the sandbox stopped %q writing outside of the package, add any paths it needs to write to to \"sandbox-writable\" in its manifest: %s", p, r.Pos, r.Command, violation)
+	case err != nil:
+		return errors.Wrapf(err, "%s: failed to execute %q: %s", p, r.Command, string(out))
+	}
+	return nil
+}
+
+func (r *RunAction) command(p *Package) (*exec.Cmd, error) {
 	args, err := shellquote.Split(r.Command)
 	if err != nil {
-		return errors.Wrapf(err, "%s: invalid shell command %q", p, r.Command)
+		return nil, errors.Wrapf(err, "%s: invalid shell command %q", p, r.Command)
 	}
 	args = append(args, r.Args...)
 	cmd := exec.Command(args[0], args[1:]...)
@@ -119,12 +164,7 @@ func (r *RunAction) Apply(p *Package) error { // nolint
 	if r.Stdin != "" {
 		cmd.Stdin = strings.NewReader(r.Stdin)
 	}
-
-	out, err := cmd.Output()
-	if err != nil {
-		return errors.Wrapf(err, "%s: failed to execute %q: %s", p, r.Command, string(out))
-	}
-	return nil
+	return cmd, nil
 }
 
 // CopyAction is an action for copying
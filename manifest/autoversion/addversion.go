@@ -0,0 +1,283 @@
+package autoversion
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/hcl"
+	"github.com/gobwas/glob"
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/github"
+	hmanifest "github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/platform"
+	"github.com/cashapp/hermit/sources"
+	"github.com/cashapp/hermit/ui"
+)
+
+// GitHubReleasesClient is the GitHub API subset that we need for adding versions from releases.
+type GitHubReleasesClient interface {
+	Releases(ctx context.Context, repo string) ([]github.Release, error)
+	ProjectForURL(sourceURL string) string
+}
+
+// AddVersionOptions control which versions AddVersions adds.
+type AddVersionOptions struct {
+	// Versions to add. If empty, all releases newer than the highest version in the manifest are added.
+	Versions []string
+	// GitHub <owner>/<repo> to discover releases from. If empty, the auto-version block's github-release is
+	// used, or the repo is inferred from the source URL of the highest version.
+	Repo string
+}
+
+// AddVersions adds versions released on GitHub to the manifest at "path", returning the versions added.
+//
+// New versions are added to the version block of the highest existing version, so their platform source
+// URLs follow the same pattern. Each source is checked against the release's assets and its SHA256 is
+// recorded in the manifest's "sha256sums" attribute, from the digest GitHub provides if any, otherwise by
+// downloading it.
+func AddVersions(ctx context.Context, l *ui.UI, httpClient *http.Client, ghClient GitHubReleasesClient, path string, options AddVersionOptions) (added []string, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	manifest := &hmanifest.Manifest{}
+	if err := hcl.Unmarshal(content, manifest); err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	highestBlock, highest := manifest.HighestMatch(glob.MustCompile("*"))
+	if highestBlock == nil {
+		return nil, errors.Errorf("%s: no versions to add new versions alongside", path)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), ".hcl")
+
+	// Platforms the highest version supports, and the source URLs the new versions must match.
+	platforms := map[platform.Platform]*hmanifest.Package{}
+	for _, p := range platform.Core {
+		pkg, err := resolveManifest(l, name, content, p, highest.String())
+		if err == nil && pkg.Source != "" {
+			platforms[p] = pkg
+		}
+	}
+	if len(platforms) == 0 {
+		return nil, errors.Errorf("%s: %s does not resolve on any platform", path, highest)
+	}
+
+	repo, pattern, includePrereleases := options.Repo, "v?(.*)", false
+	if auto := highestBlock.AutoVersion; auto != nil {
+		if repo == "" {
+			repo = auto.GitHubRelease
+		}
+		if auto.VersionPattern != "" {
+			pattern = auto.VersionPattern
+		}
+		includePrereleases = auto.IncludePrereleases
+	}
+	if repo == "" {
+		for _, pkg := range platforms {
+			if repo = ghClient.ProjectForURL(pkg.Source); repo != "" {
+				break
+			}
+		}
+	}
+	if repo == "" {
+		return nil, errors.Errorf("%s: can't infer the GitHub repository from the package source, use --repo", path)
+	}
+	versionRe, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	releases, err := ghClient.Releases(ctx, repo)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	existing := map[string]bool{}
+	for _, block := range manifest.Versions {
+		for _, version := range block.Version {
+			existing[version] = true
+		}
+	}
+	byVersion := map[string]github.Release{}
+	for _, release := range releases {
+		if release.Draft || (release.Prerelease && !includePrereleases) {
+			continue
+		}
+		if groups := versionRe.FindStringSubmatch(release.TagName); len(groups) > 1 {
+			byVersion[groups[1]] = release
+		}
+	}
+	var versions []string
+	if len(options.Versions) > 0 {
+		for _, version := range options.Versions {
+			if _, ok := byVersion[version]; !ok {
+				return nil, errors.Errorf("%s: no release found for version %s", repo, version)
+			}
+			if !existing[version] {
+				versions = append(versions, version)
+			}
+		}
+	} else {
+		for version := range byVersion {
+			if !existing[version] && highest.Less(hmanifest.ParseVersion(version)) {
+				versions = append(versions, version)
+			}
+		}
+	}
+	if len(versions) == 0 {
+		return nil, nil
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return hmanifest.ParseVersion(versions[i]).Less(hmanifest.ParseVersion(versions[j]))
+	})
+
+	ast, err := hcl.ParseBytes(content)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	hclBlock := findVersionBlock(ast, highest.String())
+	if hclBlock == nil {
+		return nil, errors.Errorf("%s: version block for %s not found", path, highest)
+	}
+	hclBlock.Labels = append(hclBlock.Labels, versions...)
+	updated, err := hcl.MarshalAST(ast)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	sums := map[string]string{}
+	for _, version := range versions {
+		release := byVersion[version]
+		for _, p := range platform.Core {
+			if platforms[p] == nil {
+				continue
+			}
+			pkg, err := resolveManifest(l, name, updated, p, version)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s: %s", version, p)
+			}
+			if _, ok := sums[pkg.Source]; ok || pkg.SHA256 != "" || pkg.SHA256Source != "" {
+				continue
+			}
+			sum, err := sourceSHA256(ctx, l, httpClient, release, pkg.Source)
+			if err != nil {
+				return nil, errors.Wrapf(err, "%s: %s", version, p)
+			}
+			sums[pkg.Source] = sum
+		}
+	}
+	addSHA256Sums(ast, sums)
+	if err := hmanifest.WriteAST(path, ast); err != nil {
+		return nil, err
+	}
+	return versions, nil
+}
+
+// Resolve a version of a manifest for a platform.
+func resolveManifest(l *ui.UI, name string, content []byte, p platform.Platform, version string) (*hmanifest.Package, error) {
+	srcs := sources.New("", []sources.Source{sources.NewMemSource(name+".hcl", string(content))})
+	resolver, err := hmanifest.New(srcs, hmanifest.Config{OS: p.OS, Arch: p.Arch})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	ref := hmanifest.Reference{Name: name, Version: hmanifest.ParseVersion(version)}
+	return resolver.Resolve(l, hmanifest.ExactSelector(ref))
+}
+
+// Returns the SHA256 of a package source.
+//
+// Sources that are release assets must be attached to the release.
+func sourceSHA256(ctx context.Context, l *ui.UI, httpClient *http.Client, release github.Release, source string) (string, error) {
+	if strings.Contains(source, "/releases/download/") {
+		var asset *github.Asset
+		for i := range release.Assets {
+			if release.Assets[i].Name == path.Base(source) {
+				asset = &release.Assets[i]
+				break
+			}
+		}
+		if asset == nil {
+			return "", errors.Errorf("release %s has no asset %s", release.TagName, path.Base(source))
+		}
+		if strings.HasPrefix(asset.Digest, "sha256:") {
+			return strings.TrimPrefix(asset.Digest, "sha256:"), nil
+		}
+	}
+	task := l.Task(path.Base(source))
+	defer task.Done()
+	task.Infof("Downloading %s to compute its SHA256", source)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return "", errors.Wrap(err, source)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("%s: %s", source, resp.Status)
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, resp.Body); err != nil {
+		return "", errors.Wrap(err, source)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Find the top-level version block containing "version".
+func findVersionBlock(ast *hcl.AST, version string) *hcl.Block {
+	for _, entry := range ast.Entries {
+		if entry.Block == nil || entry.Block.Name != "version" {
+			continue
+		}
+		for _, label := range entry.Block.Labels {
+			if label == version {
+				return entry.Block
+			}
+		}
+	}
+	return nil
+}
+
+// Merge "sums" into the manifest's sha256sums attribute, creating it if necessary.
+func addSHA256Sums(ast *hcl.AST, sums map[string]string) {
+	if len(sums) == 0 {
+		return
+	}
+	var attr *hcl.Attribute
+	for _, entry := range ast.Entries {
+		if entry.Attribute != nil && entry.Attribute.Key == "sha256sums" {
+			attr = entry.Attribute
+			break
+		}
+	}
+	if attr == nil {
+		attr = &hcl.Attribute{Key: "sha256sums", Value: &hcl.Value{HaveMap: true}}
+		ast.Entries = append(ast.Entries, &hcl.Entry{Attribute: attr})
+	}
+	merged := map[string]*hcl.MapEntry{}
+	for _, entry := range attr.Value.Map {
+		if entry.Key.Str != nil {
+			merged[*entry.Key.Str] = entry
+		}
+	}
+	for url, sum := range sums {
+		url, sum := url, sum
+		merged[url] = &hcl.MapEntry{Key: &hcl.Value{Str: &url}, Value: &hcl.Value{Str: &sum}}
+	}
+	attr.Value.Map = make([]*hcl.MapEntry, 0, len(merged))
+	for _, entry := range merged {
+		attr.Value.Map = append(attr.Value.Map, entry)
+	}
+	sort.Slice(attr.Value.Map, func(i, j int) bool { return *attr.Value.Map[i].Key.Str < *attr.Value.Map[j].Key.Str })
+}
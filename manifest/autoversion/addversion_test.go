@@ -0,0 +1,87 @@
+package autoversion
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/github"
+	"github.com/cashapp/hermit/ui"
+)
+
+type testGHReleasesAPI struct{ releases []github.Release }
+
+func (t testGHReleasesAPI) Releases(ctx context.Context, repo string) ([]github.Release, error) {
+	return t.releases, nil
+}
+
+func (t testGHReleasesAPI) ProjectForURL(sourceURL string) string {
+	return strings.Join(strings.Split(strings.TrimPrefix(sourceURL, "https://github.com/"), "/")[:2], "/")
+}
+
+type bodyTransport string
+
+func (b bodyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Status: "200 OK", Body: ioutil.NopCloser(strings.NewReader(string(b)))}, nil
+}
+
+func assets(tag string, digest string) []github.Asset {
+	return []github.Asset{
+		{Name: "bar-" + tag + "-linux-amd64.tar.gz", Digest: digest},
+		{Name: "bar-" + tag + "-darwin-amd64.tar.gz"},
+		{Name: "bar-" + tag + "-darwin-arm64.tar.gz"},
+	}
+}
+
+func TestAddVersions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bar.hcl")
+	err := os.WriteFile(path, []byte(`
+description = "Bar"
+binaries = ["bar"]
+source = "https://github.com/foo/bar/releases/download/v${version}/bar-${version}-${os}-${arch}.tar.gz"
+
+version "1.0.0" {}
+`), 0600)
+	require.NoError(t, err)
+	client := testGHReleasesAPI{releases: []github.Release{
+		{TagName: "v1.2.0-rc.1", Prerelease: true, Assets: assets("1.2.0-rc.1", "")},
+		{TagName: "v1.1.0", Assets: assets("1.1.0", "sha256:1111")},
+		{TagName: "v1.0.1", Assets: assets("1.0.1", "")[:2]},
+		{TagName: "v1.0.0", Assets: assets("1.0.0", "")},
+		{TagName: "v0.9.0", Assets: assets("0.9.0", "")},
+	}}
+	httpClient := &http.Client{Transport: bodyTransport("content")}
+	l, _ := ui.NewForTesting()
+
+	_, err = AddVersions(context.Background(), l, httpClient, client, path, AddVersionOptions{})
+	require.EqualError(t, err, "1.0.1: darwin-arm64: release v1.0.1 has no asset bar-1.0.1-darwin-arm64.tar.gz")
+
+	added, err := AddVersions(context.Background(), l, httpClient, client, path, AddVersionOptions{Versions: []string{"1.1.0"}})
+	require.NoError(t, err)
+	require.Equal(t, []string{"1.1.0"}, added)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, `description = "Bar"
+binaries = ["bar"]
+source = "https://github.com/foo/bar/releases/download/v${version}/bar-${version}-${os}-${arch}.tar.gz"
+
+version "1.0.0" "1.1.0" {
+}
+
+sha256sums = {
+  "https://github.com/foo/bar/releases/download/v1.1.0/bar-1.1.0-darwin-amd64.tar.gz": "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73",
+  "https://github.com/foo/bar/releases/download/v1.1.0/bar-1.1.0-darwin-arm64.tar.gz": "ed7002b439e9ac845f22357d822bac1444730fbdb6016d3ec9432297b9ec9f73",
+  "https://github.com/foo/bar/releases/download/v1.1.0/bar-1.1.0-linux-amd64.tar.gz": "1111",
+}
+`, string(content))
+
+	added, err = AddVersions(context.Background(), l, httpClient, client, path, AddVersionOptions{})
+	require.NoError(t, err)
+	require.Empty(t, added)
+}
@@ -1,27 +1,34 @@
 package autoversion
 
 import (
+	"context"
 	"net/http"
 	"os"
-	"path/filepath"
 
 	"github.com/alecthomas/hcl"
 	"github.com/pkg/errors"
 
 	"github.com/cashapp/hermit/github"
+	"github.com/cashapp/hermit/gitlab"
 	hmanifest "github.com/cashapp/hermit/manifest"
 )
 
 // GitHubClient is the GitHub API subset that we need for auto-versioning.
 type GitHubClient interface {
-	LatestRelease(repo string) (*github.Release, error)
+	LatestRelease(ctx context.Context, repo string) (*github.Release, error)
+	ForEachRelease(ctx context.Context, repo string, fn func(github.Release) (stop bool, err error)) error
+}
+
+// GitLabClient is the GitLab API subset that we need for auto-versioning.
+type GitLabClient interface {
+	LatestRelease(ctx context.Context, project string) (*gitlab.Release, error)
 }
 
 // AutoVersion rewrites the given manifest with new version information if applicable.
 //
 // Auto-versioning configuration is defined in a "version > auto-version" block. If a new
 // version is found in the defined location then the version block's versions are updated.
-func AutoVersion(httpClient *http.Client, ghClient GitHubClient, path string) (latestVersion string, err error) {
+func AutoVersion(ctx context.Context, httpClient *http.Client, ghClient GitHubClient, glClient GitLabClient, path string) (latestVersion string, err error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return "", errors.WithStack(err)
@@ -30,16 +37,10 @@ func AutoVersion(httpClient *http.Client, ghClient GitHubClient, path string) (l
 	if err != nil {
 		return "", errors.Wrapf(err, "failed to parse auto-version block")
 	}
-	switch {
-	case autoVersionBlock == nil:
+	if autoVersionBlock == nil {
 		return "", nil
-	case autoVersionBlock.GitHubRelease != "":
-		latestVersion, err = gitHub(ghClient, autoVersionBlock)
-	case autoVersionBlock.HTML != nil:
-		latestVersion, err = htmlAutoVersion(httpClient, autoVersionBlock)
-	default:
-		return "", errors.Errorf("%s: expected either github-release or html", hclBlock.Pos)
 	}
+	latestVersion, err = LatestVersion(ctx, httpClient, ghClient, glClient, autoVersionBlock)
 	if err != nil {
 		return "", errors.Wrap(err, hclBlock.Pos.String())
 	}
@@ -57,18 +58,46 @@ func AutoVersion(httpClient *http.Client, ghClient GitHubClient, path string) (l
 
 	// Update the manifest and write it out to disk.
 	hclBlock.Labels = append(hclBlock.Labels, latestVersion)
-	content, err = hcl.MarshalAST(ast)
-	w, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
-	if err != nil {
-		return "", errors.WithStack(err)
+	return latestVersion, hmanifest.WriteAST(path, ast)
+}
+
+// GitHubRepos returns the GitHub repositories whose latest releases
+// AutoVersion will retrieve for the manifests at "paths", for use with
+// github.Client.PrefetchLatestReleases.
+//
+// Manifests that can't be read are skipped, leaving AutoVersion to report the error.
+func GitHubRepos(paths []string) []string {
+	var repos []string
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		_, _, autoVersionBlock, err := parseVersionBlockFromManifest(content)
+		if err != nil || autoVersionBlock == nil {
+			continue
+		}
+		if repo := GitHubRepo(autoVersionBlock); repo != "" {
+			repos = append(repos, repo)
+		}
 	}
-	defer w.Close() // nolint
-	defer os.Remove(w.Name())
-	_, err = w.Write(content)
-	if err != nil {
-		return "", errors.WithStack(err)
+	return repos
+}
+
+// LatestVersion returns the latest upstream version of a package, as defined by its auto-version configuration.
+//
+// An empty version is returned if no version information was found.
+func LatestVersion(ctx context.Context, httpClient *http.Client, ghClient GitHubClient, glClient GitLabClient, autoVersion *hmanifest.AutoVersionBlock) (string, error) {
+	switch {
+	case autoVersion.GitHubRelease != "":
+		return gitHub(ctx, ghClient, autoVersion)
+	case autoVersion.GitLabRelease != "":
+		return gitLab(ctx, glClient, autoVersion)
+	case autoVersion.HTML != nil:
+		return htmlAutoVersion(httpClient, autoVersion)
+	default:
+		return "", errors.Errorf("expected one of github-release, gitlab-release or html")
 	}
-	return latestVersion, errors.WithStack(os.Rename(w.Name(), path))
 }
 
 // Parse the auto-version block from a manifest, if any.
@@ -2,6 +2,7 @@ package autoversion
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"net/http"
 	"os"
@@ -13,14 +14,34 @@ import (
 	"github.com/stretchr/testify/require"
 
 	"github.com/cashapp/hermit/github"
+	"github.com/cashapp/hermit/gitlab"
 )
 
 type testGHAPI struct{}
 
-func (v testGHAPI) LatestRelease(repo string) (*github.Release, error) {
+func (v testGHAPI) LatestRelease(ctx context.Context, repo string) (*github.Release, error) {
 	return &github.Release{TagName: "v3.2.150"}, nil
 }
 
+func (v testGHAPI) ForEachRelease(ctx context.Context, repo string, fn func(github.Release) (bool, error)) error {
+	for _, release := range []github.Release{
+		{TagName: "v3.3.0-rc.2", Draft: true, Prerelease: true},
+		{TagName: "v3.3.0-rc.1", Prerelease: true},
+		{TagName: "v3.2.150"},
+	} {
+		if stop, err := fn(release); stop || err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type testGLAPI struct{}
+
+func (v testGLAPI) LatestRelease(ctx context.Context, project string) (*gitlab.Release, error) {
+	return &gitlab.Release{TagName: "v16.5.0"}, nil
+}
+
 type testHTTPClient struct {
 	path string
 }
@@ -63,7 +84,7 @@ func TestAutoVersion(t *testing.T) {
 				}
 			}
 
-			_, err = AutoVersion(hClient, ghClient, tmpFile.Name())
+			_, err = AutoVersion(context.Background(), hClient, ghClient, testGLAPI{}, tmpFile.Name())
 			require.NoError(t, err)
 
 			actualContent, err := os.ReadFile(tmpFile.Name())
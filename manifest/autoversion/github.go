@@ -1,14 +1,16 @@
 package autoversion
 
 import (
+	"context"
 	"regexp"
 
+	"github.com/cashapp/hermit/github"
 	hmanifest "github.com/cashapp/hermit/manifest"
 	"github.com/pkg/errors"
 )
 
-func gitHub(client GitHubClient, autoVersion *hmanifest.AutoVersionBlock) (string, error) {
-	release, err := client.LatestRelease(autoVersion.GitHubRelease)
+func gitHub(ctx context.Context, client GitHubClient, autoVersion *hmanifest.AutoVersionBlock) (string, error) {
+	release, err := latestGitHubRelease(ctx, client, autoVersion)
 	if err != nil {
 		return "", errors.WithStack(err)
 	}
@@ -23,3 +25,34 @@ func gitHub(client GitHubClient, autoVersion *hmanifest.AutoVersionBlock) (strin
 	latestVersion := groups[1]
 	return latestVersion, nil
 }
+
+// GitHubRepo returns the GitHub repository whose latest release is retrieved
+// with GitHubClient.LatestRelease for "autoVersion", or "" if there is none.
+func GitHubRepo(autoVersion *hmanifest.AutoVersionBlock) string {
+	if autoVersion.IncludePrereleases {
+		return ""
+	}
+	return autoVersion.GitHubRelease
+}
+
+// The latest release, which may be a pre-release if the auto-version block includes them.
+func latestGitHubRelease(ctx context.Context, client GitHubClient, autoVersion *hmanifest.AutoVersionBlock) (*github.Release, error) {
+	if !autoVersion.IncludePrereleases {
+		return client.LatestRelease(ctx, autoVersion.GitHubRelease)
+	}
+	var latest *github.Release
+	err := client.ForEachRelease(ctx, autoVersion.GitHubRelease, func(release github.Release) (bool, error) {
+		if release.Draft {
+			return false, nil
+		}
+		latest = &release
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if latest == nil {
+		return nil, errors.Errorf("%s: no releases found", autoVersion.GitHubRelease)
+	}
+	return latest, nil
+}
@@ -0,0 +1,25 @@
+package autoversion
+
+import (
+	"context"
+	"regexp"
+
+	hmanifest "github.com/cashapp/hermit/manifest"
+	"github.com/pkg/errors"
+)
+
+func gitLab(ctx context.Context, client GitLabClient, autoVersion *hmanifest.AutoVersionBlock) (string, error) {
+	release, err := client.LatestRelease(ctx, autoVersion.GitLabRelease)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	versionRe, err := regexp.Compile(autoVersion.VersionPattern)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	groups := versionRe.FindStringSubmatch(release.TagName)
+	if groups == nil {
+		return "", errors.Errorf("%s: latest release must match the pattern %s but is %s", autoVersion.GitLabRelease, autoVersion.VersionPattern, release.TagName)
+	}
+	return groups[1], nil
+}
@@ -0,0 +1,19 @@
+description = "Jenkins X CLI"
+test = "jx version"
+binaries = ["jx"]
+
+linux {
+  source = "https://github.com/jenkins-x/jx/releases/download/v${version}/jx-linux-amd64.tar.gz"
+}
+
+version "3.2.137" "3.2.140" "3.3.0-rc.1" {
+  auto-version {
+    github-release = "jenkins-x/jx"
+    include-prereleases = true
+  }
+}
+
+channel "beta" {
+  update = "24h"
+  version = "3.*-rc.*"
+}
@@ -0,0 +1,12 @@
+description = "GitLab Runner"
+binaries = ["gitlab-runner"]
+
+linux {
+  source = "https://gitlab.com/gitlab-org/gitlab-runner/-/releases/v${version}/downloads/binaries/gitlab-runner-linux-amd64"
+}
+
+version "16.4.1" "16.5.0" {
+  auto-version {
+    gitlab-release = "gitlab-org/gitlab-runner"
+  }
+}
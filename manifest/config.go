@@ -25,27 +25,41 @@ const (
 
 // A Layer contributes to the final merged manifest definition.
 type Layer struct {
-	Arch        string            `hcl:"arch,optional" help:"CPU architecture to match (amd64, 386, arm, etc.)."`
-	Binaries    []string          `hcl:"binaries,optional" help:"Relative glob from $root to individual terminal binaries."`
-	Apps        []string          `hcl:"apps,optional" help:"Relative paths to Mac .app packages to install."`
-	Rename      map[string]string `hcl:"rename,optional" help:"Rename files after unpacking to ${root}."`
-	Requires    []string          `hcl:"requires,optional" help:"Packages this one requires."`
-	RuntimeDeps []string          `hcl:"runtime-dependencies,optional" help:"Packages used internally by this package, but not installed to the target environment"`
-	Provides    []string          `hcl:"provides,optional" help:"This package provides the given virtual packages."`
-	Dest        string            `hcl:"dest,optional" help:"Override archive extraction destination for package."`
-	Files       map[string]string `hcl:"files,optional" help:"Files to load strings from to be used in the manifest."`
-	Strip       int               `hcl:"strip,optional" help:"Number of path prefix elements to strip."`
-	Root        string            `hcl:"root,optional" help:"Override root for package."`
-	Test        *string           `hcl:"test,optional" help:"Command that will test the package is operational."`
-	Env         envars.Envars     `hcl:"env,optional" help:"Environment variables to export."`
-	Vars        map[string]string `hcl:"vars,optional" help:"Set local variables used during manifest evaluation."`
-	Source      string            `hcl:"source,optional" help:"URL for source package. Valid URLs are Git repositories (using .git[#<tag>] suffix), Local Files (using file:// prefix), and Remote Files (using http:// or https:// prefix)"`
-	Mirrors     []string          `hcl:"mirrors,optional" help:"Mirrors to use if the primary source is unavailable."`
-	SHA256      string            `hcl:"sha256,optional" help:"SHA256 of source package for verification."`
-	Darwin      []*Layer          `hcl:"darwin,block" help:"Darwin-specific configuration."`
-	Linux       []*Layer          `hcl:"linux,block" help:"Linux-specific configuration."`
-	Platform    []*PlatformBlock  `hcl:"platform,block" help:"Platform-specific configuration. <attr> is a set regexes that must all match against one of CPU, OS, etc.."`
-	Triggers    []*Trigger        `hcl:"on,block" help:"Triggers to run on lifecycle events."`
+	Arch            string             `hcl:"arch,optional" help:"CPU architecture to match (amd64, 386, arm, etc.)."`
+	Binaries        []string           `hcl:"binaries,optional" help:"Relative glob from $root to individual terminal binaries."`
+	Apps            []string           `hcl:"apps,optional" help:"Relative paths to Mac .app packages to install."`
+	Rename          map[string]string  `hcl:"rename,optional" help:"Rename files after unpacking to ${root}."`
+	Requires        []string           `hcl:"requires,optional" help:"Packages this one requires."`
+	RuntimeDeps     []string           `hcl:"runtime-dependencies,optional" help:"Packages used internally by this package, but not installed to the target environment"`
+	Provides        []string           `hcl:"provides,optional" help:"This package provides the given virtual packages."`
+	Dest            string             `hcl:"dest,optional" help:"Override archive extraction destination for package."`
+	Files           map[string]string  `hcl:"files,optional" help:"Files to load strings from to be used in the manifest."`
+	Strip           int                `hcl:"strip,optional" help:"Number of path prefix elements to strip."`
+	Root            string             `hcl:"root,optional" help:"Override root for package."`
+	Test            *string            `hcl:"test,optional" help:"Command that will test the package is operational."`
+	Env             envars.Envars      `hcl:"env,optional" help:"Environment variables to export."`
+	Vars            map[string]string  `hcl:"vars,optional" help:"Set local variables used during manifest evaluation."`
+	Source          string             `hcl:"source,optional" help:"URL for source package. Valid URLs are Git repositories (using .git[#<tag>] suffix), Local Files (using file:// prefix), and Remote Files (using http:// or https:// prefix)"`
+	Mirrors         []string           `hcl:"mirrors,optional" help:"Mirrors to use if the primary source is unavailable."`
+	GitHubRelease   string             `hcl:"github-release,optional" help:"GitHub <owner>/<repo> whose release assets are matched by github-asset-pattern."`
+	GitHubTag       string             `hcl:"github-tag,optional" help:"Tag of the GitHub release to match github-asset-pattern against (default v${version})."`
+	GitHubAsset     string             `hcl:"github-asset-pattern,optional" help:"Glob, or /regex/, matching the GitHub release asset to use as the source package for the current OS and architecture, used if source is not set."`
+	Deltas          []*DeltaBlock      `hcl:"delta,block" help:"Binary patches from earlier versions of the source package, used to upgrade without downloading it in full."`
+	SHA256          string             `hcl:"sha256,optional" help:"SHA256 of source package for verification."`
+	SHA256Source    string             `hcl:"sha256-source,optional" help:"URL of a checksum file (eg. SHA256SUMS) containing the SHA256 of the source package, used if sha256 is not set, or checked against sha256 if it is signed."`
+	SHA256Signature string             `hcl:"sha256-signature,optional" help:"URL of a detached PGP or minisign signature of sha256-source."`
+	SHA256Key       string             `hcl:"sha256-key,optional" help:"PGP (ASCII armoured) or minisign public key used to verify sha256-signature."`
+	CosignSignature string             `hcl:"cosign-signature,optional" help:"URL of a keyless cosign signature of the source package, as created by \"cosign sign-blob\"."`
+	CosignCert      string             `hcl:"cosign-certificate,optional" help:"URL of the Fulcio signing certificate for cosign-signature."`
+	CosignBundle    string             `hcl:"cosign-bundle,optional" help:"URL of a cosign bundle containing the signature, signing certificate and Rekor entry of the source package, used instead of cosign-signature."`
+	CosignIdentity  string             `hcl:"cosign-identity,optional" help:"Regular expression the identity (email or URI) of the signing certificate must match."`
+	CosignIssuer    string             `hcl:"cosign-issuer,optional" help:"OIDC issuer of the signing certificate, eg. https://token.actions.githubusercontent.com."`
+	Darwin          []*Layer           `hcl:"darwin,block" help:"Darwin-specific configuration."`
+	Linux           []*Layer           `hcl:"linux,block" help:"Linux-specific configuration."`
+	Platform        []*PlatformBlock   `hcl:"platform,block" help:"Platform-specific configuration. <attr> is a set regexes that must all match against one of CPU, OS, etc.."`
+	Triggers        []*Trigger         `hcl:"on,block" help:"Triggers to run on lifecycle events."`
+	Completions     []*CompletionBlock `hcl:"completion,block" help:"Shell completion scripts for the package's commands."`
+	SandboxWritable []string           `hcl:"sandbox-writable,optional" help:"Paths outside the package that commands run on unpack, install and uninstall may write to, eg. \"${HOME}/.m2\". \"/\" disables the sandbox."`
 }
 
 func (c Layer) layers(os string, arch string) (out layers) {
@@ -87,9 +101,11 @@ func (c *Layer) match(arch string) bool {
 // AutoVersionBlock represents auto-version configuration.
 type AutoVersionBlock struct {
 	GitHubRelease string                `hcl:"github-release,optional" help:"GitHub <user>/<repo> to retrieve and update versions from the releases API."`
+	GitLabRelease string                `hcl:"gitlab-release,optional" help:"GitLab <group>/<project> to retrieve and update versions from the releases API."`
 	HTML          *HTMLAutoVersionBlock `hcl:"html,block" help:"Extract version information from a HTML URL using XPath."`
 
-	VersionPattern string `hcl:"version-pattern,optional" help:"Regex with one capture group to extract the version number from the origin." default:"v?(.*)"`
+	VersionPattern     string `hcl:"version-pattern,optional" help:"Regex with one capture group to extract the version number from the origin." default:"v?(.*)"`
+	IncludePrereleases bool   `hcl:"include-prereleases,optional" help:"Also consider GitHub pre-releases, but never drafts, when looking for the latest release."`
 }
 
 // HTMLAutoVersionBlock defines how version numbers can be extracted from HTML.
@@ -98,6 +114,21 @@ type HTMLAutoVersionBlock struct {
 	XPath string `hcl:"xpath" help:"XPath for extracting versions from HTML (see https://github.com/antchfx/htmlquery)"`
 }
 
+// DeltaBlock is a binary patch from the source package of an earlier version to this one.
+type DeltaBlock struct {
+	From   string `hcl:"from,label" help:"Version of the package the patch applies to."`
+	Source string `hcl:"source" help:"URL of the patch."`
+	Format string `hcl:"format,optional" help:"Format of the patch, bsdiff or zstd (created with \"zstd --patch-from\")." default:"bsdiff" enum:"bsdiff,zstd"`
+}
+
+// CompletionBlock is a shell completion script for a command provided by a package.
+type CompletionBlock struct {
+	Shell   string `hcl:"shell,label" help:"Shell the script is for: bash, zsh or fish."`
+	Name    string `hcl:"name,optional" help:"Command the script completes (default ${name})."`
+	File    string `hcl:"file,optional" help:"Completion script shipped with the package, relative to ${root}."`
+	Command string `hcl:"cmd,optional" help:"Command that prints the completion script, split by shellquote, used if file is not set. It is run in ${root}."`
+}
+
 // PlatformBlock matches a set of attributes describing a platform (eg. CPU, OS, etc.)
 //
 // The PlatformBlock replaces "linux" and "darwin".
@@ -116,7 +147,7 @@ type VersionBlock struct {
 // ChannelBlock is a Layer block specifying an installable channel for a package.
 type ChannelBlock struct {
 	Name    string        `hcl:"name,label" help:"Name of the channel (eg. stable, alpha, etc.)."`
-	Update  time.Duration `hcl:"update" help:"Update frequency for this channel."`
+	Update  time.Duration `hcl:"update,optional" help:"Update frequency for this channel, defaults to the manifest's update-interval."`
 	Version string        `hcl:"version,optional" help:"Use the latest version matching this version glob as the source of this channel. Empty string matches all versions"`
 	Layer
 }
@@ -143,11 +174,32 @@ func (c *ChannelBlock) layersWithReferences(os string, arch string, m *Manifest)
 // Manifest for a package.
 type Manifest struct {
 	Layer
-	Default     string         `hcl:"default,optional" help:"Default version or channel if not specified."`
-	Description string         `hcl:"description" help:"Human readable description of the package."`
-	Homepage    string         `hcl:"homepage,optional" help:"Home page."`
-	Versions    []VersionBlock `hcl:"version,block" help:"Definition of and configuration for a specific version."`
-	Channels    []ChannelBlock `hcl:"channel,block" help:"Definition of and configuration for an auto-update channel."`
+	Default        string            `hcl:"default,optional" help:"Default version or channel if not specified."`
+	Description    string            `hcl:"description" help:"Human readable description of the package."`
+	Homepage       string            `hcl:"homepage,optional" help:"Home page."`
+	OSV            *OSVBlock         `hcl:"osv,block" help:"OSV (https://osv.dev) package used to audit the package for known vulnerabilities."`
+	CPE            string            `hcl:"cpe,optional" help:"CPE 2.3 name of the package used to audit it for known vulnerabilities, eg. cpe:2.3:a:jqlang:jq. The version is filled in by Hermit."`
+	SHA256Sums     map[string]string `hcl:"sha256sums,optional" help:"SHA256 of source packages keyed by their URL, used if sha256 is not set."`
+	Versions       []VersionBlock    `hcl:"version,block" help:"Definition of and configuration for a specific version."`
+	Channels       []ChannelBlock    `hcl:"channel,block" help:"Definition of and configuration for an auto-update channel."`
+	UpdateInterval time.Duration     `hcl:"update-interval,optional" help:"Update frequency for channels that don't set \"update\", including synthesised channels (default 24h)."`
+}
+
+// The update frequency of "channel".
+func (m *Manifest) updateInterval(channel ChannelBlock) time.Duration {
+	if channel.Update != 0 {
+		return channel.Update
+	}
+	if m.UpdateInterval != 0 {
+		return m.UpdateInterval
+	}
+	return defaultUpdateInterval
+}
+
+// OSVBlock identifies a package in the OSV vulnerability database.
+type OSVBlock struct {
+	Ecosystem string `hcl:"ecosystem" help:"OSV ecosystem, eg. Go, npm, PyPI or crates.io."`
+	Name      string `hcl:"name" help:"Name of the package within the ecosystem."`
 }
 
 // Merge layers for the selected package reference, either from versions or channels.
@@ -182,7 +234,7 @@ platformsNext:
 	for _, p := range platforms {
 		lrs, _ := m.layers(ref, p.OS, p.Arch)
 		for _, l := range lrs {
-			if l.Source != "" {
+			if l.Source != "" || l.GitHubAsset != "" {
 				continue platformsNext
 			}
 		}
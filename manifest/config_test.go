@@ -270,6 +270,7 @@ func TestManifest(t *testing.T) {
 				test.expected.Root = "/tmp/hermit/pkg/" + test.pkg
 				test.expected.Dest = "/tmp/hermit/pkg/" + test.pkg
 				pkg.FS = nil
+				pkg.Manifest = ""
 				require.Equal(t,
 					repr.String(test.expected, repr.Indent("  ")),
 					repr.String(pkg, repr.Indent("  ")))
@@ -1,6 +1,7 @@
 package manifest
 
 import (
+	"context"
 	"net/http"
 	"os"
 	"regexp"
@@ -31,7 +32,7 @@ var (
 //     https://github.com/protocolbuffers/protobuf-go/releases/download/v1.27.1/protoc-gen-go.v1.27.1.darwin.amd64.tar.gz
 //
 // "version" may be specified if it cannot be inferred from the URL.
-func InferFromArtefact(p *ui.UI, httpClient *http.Client, ghClient *github.Client, url, version string) (*Manifest, error) {
+func InferFromArtefact(ctx context.Context, p *ui.UI, httpClient *http.Client, ghClient *github.Client, url, version string) (*Manifest, error) {
 	source, version, err := insertVariables(url, version, false)
 	if err != nil {
 		return nil, err
@@ -41,7 +42,7 @@ func InferFromArtefact(p *ui.UI, httpClient *http.Client, ghClient *github.Clien
 	homepage := ""
 	repoName := ghClient.ProjectForURL(url)
 	if repoName != "" {
-		repo, err := ghClient.Repo(repoName)
+		repo, err := ghClient.Repo(ctx, repoName)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
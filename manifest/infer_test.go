@@ -1,6 +1,7 @@
 package manifest
 
 import (
+	"context"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -27,7 +28,7 @@ func TestInfer(t *testing.T) {
 	}))
 	defer srv.Close()
 	p, _ := ui.NewForTesting()
-	actual, err := InferFromArtefact(p, http.DefaultClient, github.New(""), srv.URL+"/releases/download/0.1.1/pkg-0.1.1-linux-amd64.tgz", "")
+	actual, err := InferFromArtefact(context.Background(), p, http.DefaultClient, github.New(""), srv.URL+"/releases/download/0.1.1/pkg-0.1.1-linux-amd64.tgz", "")
 	require.NoError(t, err)
 	expected := &Manifest{
 		Layer: Layer{
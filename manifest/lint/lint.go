@@ -0,0 +1,342 @@
+// Package lint checks package manifests for problems that don't prevent them
+// from loading, and fixes those that are mechanical.
+package lint
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/alecthomas/hcl"
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/platform"
+	"github.com/cashapp/hermit/sources"
+	"github.com/cashapp/hermit/ui"
+)
+
+// Check identifies the kind of problem an Issue is.
+type Check string
+
+// Checks performed by Lint.
+const (
+	// The manifest doesn't match the schema, and no other checks are performed.
+	CheckSchema Check = "schema"
+	// Platform blocks or attributes that never apply.
+	CheckUnusedPlatform Check = "unused-platform"
+	// Versions whose source has no sha256 on some platform.
+	CheckMissingSHA256 Check = "missing-sha256"
+	// Versions that aren't in ascending order, or are defined more than once.
+	CheckVersionOrder Check = "version-order"
+	// Sources that can't be retrieved.
+	CheckUnreachableURL Check = "unreachable-url"
+	// Attributes or blocks that are deprecated.
+	CheckDeprecated Check = "deprecated"
+)
+
+// Issue is a problem found in a manifest.
+type Issue struct {
+	Check   Check
+	Pos     hcl.Position
+	Message string
+	// Fixed is true if the manifest was rewritten to fix the issue.
+	Fixed bool
+}
+
+func (i Issue) String() string {
+	out := fmt.Sprintf("%d:%d: %s: %s", i.Pos.Line, i.Pos.Column, i.Check, i.Message)
+	if i.Fixed {
+		out += " (fixed)"
+	}
+	return out
+}
+
+// Options control the checks Lint performs.
+type Options struct {
+	// Rewrite the manifest to fix mechanical problems.
+	Fix bool
+	// Client used to check that http(s) sources are reachable with a HEAD
+	// request. If nil, sources aren't checked.
+	HTTPClient *http.Client
+}
+
+// Lint checks the manifest at "path" for problems, returning them in the order they occur.
+//
+// Manifests are checked for every version on each of the core platforms.
+// Schema fields are deprecated by tagging them with `deprecated:"<replacement>"`,
+// in which case the fix renames them to their replacement, if any.
+func Lint(l *ui.UI, path string, options Options) ([]Issue, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := hcl.Unmarshal(content, &manifest.Manifest{}); err != nil {
+		return []Issue{{Check: CheckSchema, Message: err.Error()}}, nil
+	}
+	ast, err := hcl.ParseBytes(content)
+	if err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	name := strings.TrimSuffix(filepath.Base(path), ".hcl")
+
+	var issues []Issue
+	issues = append(issues, lintDeprecated(ast.Entries, reflect.TypeOf(manifest.Manifest{}), options.Fix)...)
+	var unused []Issue
+	ast.Entries, unused = lintUnusedPlatforms(ast.Entries, "", options.Fix)
+	issues = append(issues, unused...)
+	issues = append(issues, lintVersionOrder(ast, options.Fix)...)
+	sourceIssues, err := lintSources(l, name, content, ast, options.HTTPClient)
+	if err != nil {
+		return nil, errors.Wrap(err, path)
+	}
+	issues = append(issues, sourceIssues...)
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].Pos.Line < issues[j].Pos.Line })
+
+	for _, issue := range issues {
+		if issue.Fixed {
+			return issues, manifest.WriteAST(path, ast)
+		}
+	}
+	return issues, nil
+}
+
+// Report deprecated attributes and blocks of the schema "schema", renaming them to their replacement if "fix" is set.
+func lintDeprecated(entries []*hcl.Entry, schema reflect.Type, fix bool) (issues []Issue) {
+	fields := schemaFields(schema)
+	present := map[string]bool{}
+	for _, entry := range entries {
+		present[entry.Key()] = true
+	}
+	for _, entry := range entries {
+		field, ok := fields[entry.Key()]
+		if !ok {
+			continue
+		}
+		if replacement, ok := field.Tag.Lookup("deprecated"); ok {
+			issue := Issue{Check: CheckDeprecated, Pos: entry.Pos, Message: fmt.Sprintf("%q is deprecated", entry.Key())}
+			if _, known := fields[replacement]; known {
+				issue.Message += fmt.Sprintf(", use %q instead", replacement)
+				if fix && !present[replacement] {
+					renameEntry(entry, replacement)
+					present[replacement] = true
+					issue.Fixed = true
+				}
+			}
+			issues = append(issues, issue)
+		}
+		if entry.Block != nil {
+			issues = append(issues, lintDeprecated(entry.Block.Body, blockType(field.Type), fix)...)
+		}
+	}
+	return issues
+}
+
+func renameEntry(entry *hcl.Entry, name string) {
+	if entry.Attribute != nil {
+		entry.Attribute.Key = name
+	} else {
+		entry.Block.Name = name
+	}
+}
+
+// The fields of the struct "t" keyed by their HCL name, including those of embedded structs.
+func schemaFields(t reflect.Type) map[string]reflect.StructField {
+	out := map[string]reflect.StructField{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag, ok := field.Tag.Lookup("hcl")
+		if !ok {
+			if field.Anonymous {
+				for name, embedded := range schemaFields(field.Type) {
+					out[name] = embedded
+				}
+			}
+			continue
+		}
+		out[strings.Split(tag, ",")[0]] = field
+	}
+	return out
+}
+
+// The struct type of a block field, eg. []*Layer.
+func blockType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Slice || t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
+
+// Report platform blocks and attributes that are never applied when
+// resolving a package, removing those that have no effect if "fix" is set.
+//
+// Only the "darwin", "linux" and "platform" blocks of the manifest, its
+// versions and channels are applied, and "arch" only selects between
+// "darwin" and "linux" blocks. "block" is the platform block "entries" are
+// in, if any.
+func lintUnusedPlatforms(entries []*hcl.Entry, block string, fix bool) (kept []*hcl.Entry, issues []Issue) {
+	for _, entry := range entries {
+		switch {
+		case entry.Attribute != nil && entry.Attribute.Key == "arch" && block != "darwin" && block != "linux":
+			issues = append(issues, Issue{Check: CheckUnusedPlatform, Pos: entry.Pos, Fixed: fix,
+				Message: `"arch" only applies in "darwin" and "linux" blocks`})
+			if fix {
+				continue
+			}
+
+		case entry.Block != nil && isPlatformBlock(entry.Block.Name):
+			switch {
+			case block != "":
+				issues = append(issues, Issue{Check: CheckUnusedPlatform, Pos: entry.Pos,
+					Message: fmt.Sprintf("%q blocks are not applied inside %q blocks", entry.Block.Name, block)})
+			case len(entry.Block.Body) == 0:
+				issues = append(issues, Issue{Check: CheckUnusedPlatform, Pos: entry.Pos, Fixed: fix,
+					Message: fmt.Sprintf("empty %q block", entry.Block.Name)})
+				if fix {
+					continue
+				}
+			default:
+				var nested []Issue
+				entry.Block.Body, nested = lintUnusedPlatforms(entry.Block.Body, entry.Block.Name, fix)
+				issues = append(issues, nested...)
+			}
+
+		case entry.Block != nil && (entry.Block.Name == "version" || entry.Block.Name == "channel"):
+			var nested []Issue
+			entry.Block.Body, nested = lintUnusedPlatforms(entry.Block.Body, block, fix)
+			issues = append(issues, nested...)
+		}
+		kept = append(kept, entry)
+	}
+	return kept, issues
+}
+
+func isPlatformBlock(name string) bool {
+	return name == "darwin" || name == "linux" || name == "platform"
+}
+
+// Report version labels and blocks that aren't in ascending order, sorting them if "fix" is set.
+//
+// Blocks are ordered by their lowest version, and aren't reordered if any
+// version is defined more than once, as a later definition overrides an
+// earlier one.
+func lintVersionOrder(ast *hcl.AST, fix bool) (issues []Issue) {
+	var blocks []*hcl.Entry
+	seen := map[string]bool{}
+	duplicates := false
+	for _, entry := range ast.Entries {
+		if entry.Block == nil || entry.Block.Name != "version" {
+			continue
+		}
+		blocks = append(blocks, entry)
+		labels := entry.Block.Labels
+		for _, label := range labels {
+			if seen[label] {
+				duplicates = true
+				issues = append(issues, Issue{Check: CheckVersionOrder, Pos: entry.Pos,
+					Message: fmt.Sprintf("version %s is defined more than once", label)})
+			}
+			seen[label] = true
+		}
+		if !sort.SliceIsSorted(labels, func(i, j int) bool { return versionLess(labels[i], labels[j]) }) {
+			issues = append(issues, Issue{Check: CheckVersionOrder, Pos: entry.Pos, Fixed: fix,
+				Message: fmt.Sprintf("versions %s are not in ascending order", strings.Join(labels, ", "))})
+			if fix {
+				sort.SliceStable(labels, func(i, j int) bool { return versionLess(labels[i], labels[j]) })
+			}
+		}
+	}
+	lowest := func(entry *hcl.Entry) string {
+		out := ""
+		for _, label := range entry.Block.Labels {
+			if out == "" || versionLess(label, out) {
+				out = label
+			}
+		}
+		return out
+	}
+	less := func(i, j int) bool { return versionLess(lowest(blocks[i]), lowest(blocks[j])) }
+	if sort.SliceIsSorted(blocks, less) {
+		return issues
+	}
+	fixed := fix && !duplicates
+	for i := 1; i < len(blocks); i++ {
+		if versionLess(lowest(blocks[i]), lowest(blocks[i-1])) {
+			issues = append(issues, Issue{Check: CheckVersionOrder, Pos: blocks[i].Pos, Fixed: fixed,
+				Message: fmt.Sprintf("version %s is defined after version %s", lowest(blocks[i]), lowest(blocks[i-1]))})
+		}
+	}
+	if !fixed {
+		return issues
+	}
+	sorted := append([]*hcl.Entry(nil), blocks...)
+	sort.SliceStable(sorted, func(i, j int) bool { return versionLess(lowest(sorted[i]), lowest(sorted[j])) })
+	next := 0
+	for i, entry := range ast.Entries {
+		if entry.Block != nil && entry.Block.Name == "version" {
+			ast.Entries[i] = sorted[next]
+			next++
+		}
+	}
+	return issues
+}
+
+func versionLess(a, b string) bool {
+	return manifest.ParseVersion(a).Less(manifest.ParseVersion(b))
+}
+
+// Resolve every version and channel on each core platform, reporting
+// versions whose sources have no sha256, and sources that are unreachable
+// if "httpClient" is not nil.
+func lintSources(l *ui.UI, name string, content []byte, ast *hcl.AST, httpClient *http.Client) (issues []Issue, err error) {
+	resolvers := map[platform.Platform]*manifest.Resolver{}
+	for _, p := range platform.Core {
+		srcs := sources.New("", []sources.Source{sources.NewMemSource(name+".hcl", string(content))})
+		resolvers[p], err = manifest.New(srcs, manifest.Config{OS: p.OS, Arch: p.Arch})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	checked := map[string]bool{}
+	for _, entry := range ast.Entries {
+		if entry.Block == nil || (entry.Block.Name != "version" && entry.Block.Name != "channel") {
+			continue
+		}
+		for _, label := range entry.Block.Labels {
+			ref := manifest.Reference{Name: name, Version: manifest.ParseVersion(label)}
+			if entry.Block.Name == "channel" {
+				ref = manifest.Reference{Name: name, Channel: label}
+			}
+			for _, p := range platform.Core {
+				pkg, err := resolvers[p].Resolve(l, manifest.ExactSelector(ref))
+				// Platforms the package doesn't support are reported by "hermit manifest validate".
+				if err != nil || pkg.Source == "" {
+					continue
+				}
+				git := strings.HasSuffix(pkg.Source, ".git") || strings.Contains(pkg.Source, ".git#")
+				if !ref.IsChannel() && !git && pkg.SHA256 == "" && pkg.SHA256Source == "" && !checked["sha256:"+pkg.Source] {
+					checked["sha256:"+pkg.Source] = true
+					issues = append(issues, Issue{Check: CheckMissingSHA256, Pos: entry.Pos,
+						Message: fmt.Sprintf("%s has no sha256 for %s on %s", ref, pkg.Source, p)})
+				}
+				if httpClient == nil || checked["url:"+pkg.Source] {
+					continue
+				}
+				checked["url:"+pkg.Source] = true
+				if u, err := url.Parse(pkg.Source); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+					continue
+				}
+				if err := manifest.ValidatePackageSource(httpClient, pkg.Source); err != nil {
+					issues = append(issues, Issue{Check: CheckUnreachableURL, Pos: entry.Pos,
+						Message: fmt.Sprintf("%s: %s", ref, err)})
+				}
+			}
+		}
+	}
+	return issues, nil
+}
@@ -0,0 +1,147 @@
+package lint
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alecthomas/hcl"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/ui"
+)
+
+func TestLint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.URL.Path, "missing") {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "test.hcl")
+	err := os.WriteFile(path, []byte(`
+description = "Test"
+binaries = ["test"]
+arch = "amd64"
+source = "`+server.URL+`/test-${version}-${os}-${arch}.tar.gz"
+sha256sums = {
+  "`+server.URL+`/test-1.0.0-linux-amd64.tar.gz": "aaaa",
+  "`+server.URL+`/test-1.0.0-darwin-amd64.tar.gz": "aaaa",
+  "`+server.URL+`/test-1.0.0-darwin-arm64.tar.gz": "aaaa",
+}
+
+version "2.0.0" "1.1.0" {
+  darwin {}
+}
+
+version "1.0.0" {
+  linux {
+    arch = "amd64"
+    darwin {
+      source = "https://example.com/unused"
+    }
+  }
+}
+
+channel "missing" {
+  update = "24h"
+  source = "`+server.URL+`/missing.tar.gz"
+}
+`), 0600)
+	require.NoError(t, err)
+	p, _ := ui.NewForTesting()
+
+	issues, err := Lint(p, path, Options{HTTPClient: server.Client()})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		`4:1: unused-platform: "arch" only applies in "darwin" and "linux" blocks`,
+		`12:1: version-order: versions 2.0.0, 1.1.0 are not in ascending order`,
+		`12:1: missing-sha256: test-2.0.0 has no sha256 for ` + server.URL + `/test-2.0.0-linux-amd64.tar.gz on linux-amd64`,
+		`12:1: missing-sha256: test-2.0.0 has no sha256 for ` + server.URL + `/test-2.0.0-darwin-amd64.tar.gz on darwin-amd64`,
+		`12:1: missing-sha256: test-2.0.0 has no sha256 for ` + server.URL + `/test-2.0.0-darwin-arm64.tar.gz on darwin-arm64`,
+		`12:1: missing-sha256: test-1.1.0 has no sha256 for ` + server.URL + `/test-1.1.0-linux-amd64.tar.gz on linux-amd64`,
+		`12:1: missing-sha256: test-1.1.0 has no sha256 for ` + server.URL + `/test-1.1.0-darwin-amd64.tar.gz on darwin-amd64`,
+		`12:1: missing-sha256: test-1.1.0 has no sha256 for ` + server.URL + `/test-1.1.0-darwin-arm64.tar.gz on darwin-arm64`,
+		`13:3: unused-platform: empty "darwin" block`,
+		`16:1: version-order: version 1.0.0 is defined after version 1.1.0`,
+		`19:5: unused-platform: "darwin" blocks are not applied inside "linux" blocks`,
+		`25:1: unreachable-url: test@missing: invalid source: could not retrieve source archive from ` + server.URL + `/missing.tar.gz: 404 Not Found`,
+	}, issueStrings(issues))
+
+	issues, err = Lint(p, path, Options{Fix: true})
+	require.NoError(t, err)
+	fixed := 0
+	for _, issue := range issues {
+		if issue.Fixed {
+			fixed++
+		}
+	}
+	require.Equal(t, 4, fixed)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.NotContains(t, string(content), "darwin {\n  }")
+
+	issues, err = Lint(p, path, Options{})
+	require.NoError(t, err)
+	for _, issue := range issues {
+		require.Contains(t, []Check{CheckMissingSHA256, CheckUnusedPlatform}, issue.Check, issue.String())
+		require.False(t, issue.Fixed, issue.String())
+	}
+	require.Len(t, issues, 7)
+}
+
+func TestLintSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.hcl")
+	err := os.WriteFile(path, []byte(`
+description = "Test"
+sources = "https://example.com"
+`), 0600)
+	require.NoError(t, err)
+	p, _ := ui.NewForTesting()
+	issues, err := Lint(p, path, Options{Fix: true})
+	require.NoError(t, err)
+	require.Len(t, issues, 1)
+	require.Equal(t, CheckSchema, issues[0].Check)
+}
+
+func TestLintDeprecated(t *testing.T) {
+	type block struct {
+		Old string `hcl:"old,optional" deprecated:"new"`
+		New string `hcl:"new,optional"`
+	}
+	type schema struct {
+		Gone   string   `hcl:"gone,optional" deprecated:""`
+		Blocks []*block `hcl:"block,block"`
+	}
+	ast, err := hcl.ParseString(`
+gone = "x"
+block {
+  old = "x"
+}
+block {
+  old = "x"
+  new = "y"
+}
+`)
+	require.NoError(t, err)
+	issues := lintDeprecated(ast.Entries, reflect.TypeOf(schema{}), true)
+	require.Equal(t, []string{
+		`2:1: deprecated: "gone" is deprecated`,
+		`4:3: deprecated: "old" is deprecated, use "new" instead (fixed)`,
+		`7:3: deprecated: "old" is deprecated, use "new" instead`,
+	}, issueStrings(issues))
+	require.Equal(t, "new", ast.Entries[1].Block.Body[0].Attribute.Key)
+	require.Equal(t, "old", ast.Entries[2].Block.Body[0].Attribute.Key)
+}
+
+func issueStrings(issues []Issue) []string {
+	out := make([]string, len(issues))
+	for i, issue := range issues {
+		out[i] = issue.String()
+	}
+	return out
+}
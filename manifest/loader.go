@@ -181,14 +181,18 @@ func load(bundle fs.FS, name, filename string) *AnnotatedManifest {
 	return annotated
 }
 
+// Update frequency of channels if neither they nor their manifest set one.
+const defaultUpdateInterval = time.Hour * 24
+
 // Synthesise a "stable" channel and a channel for each major version.
 func synthesise(manifest *AnnotatedManifest) {
+	update := manifest.updateInterval(ChannelBlock{})
 	highest, version := manifest.HighestMatch(glob.MustCompile("*"))
 	if highest != nil && manifest.ChannelByName("latest") == nil {
 		vstr := version.Major().String() + ".*"
 		manifest.Channels = append(manifest.Channels, ChannelBlock{
 			Name:    "latest",
-			Update:  time.Hour * 24,
+			Update:  update,
 			Version: vstr,
 		})
 	}
@@ -224,7 +228,7 @@ func synthesise(manifest *AnnotatedManifest) {
 	for version := range channels {
 		manifest.Channels = append(manifest.Channels, ChannelBlock{
 			Name:    version,
-			Update:  time.Hour * 24,
+			Update:  update,
 			Version: version + ".*",
 		})
 	}
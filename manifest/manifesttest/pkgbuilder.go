@@ -120,6 +120,12 @@ func (b PkgBuilder) WithFS(fs fs.FS) PkgBuilder {
 	return b
 }
 
+// WithManifest sets the path of the manifest this package was resolved from.
+func (b PkgBuilder) WithManifest(path string) PkgBuilder {
+	b.result.Manifest = path
+	return b
+}
+
 // WithRequires sets the required dependencies
 func (b PkgBuilder) WithRequires(reqs ...string) PkgBuilder {
 	b.result.Requires = reqs
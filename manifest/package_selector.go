@@ -186,3 +186,44 @@ func PrefixSelector(ref Reference) Selector {
 func ParseGlob(from string) (glob.Glob, error) {
 	return glob.Compile(from)
 }
+
+type allSelector struct {
+	selectors []Selector
+}
+
+func (m allSelector) String() string {
+	parts := make([]string, 0, len(m.selectors))
+	for _, selector := range m.selectors {
+		parts = append(parts, selector.String())
+	}
+	return strings.Join(parts, " and ")
+}
+
+func (m allSelector) Matches(ref Reference) bool {
+	for _, selector := range m.selectors {
+		if !selector.Matches(ref) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m allSelector) Name() string {
+	return m.selectors[0].Name()
+}
+
+func (m allSelector) IsFullyQualified() bool {
+	for _, selector := range m.selectors {
+		if selector.IsFullyQualified() {
+			return true
+		}
+	}
+	return false
+}
+
+// AllSelector returns a selector that matches packages matched by all of the given selectors.
+//
+// The selectors must all select the same package name.
+func AllSelector(selectors ...Selector) Selector {
+	return allSelector{selectors: selectors}
+}
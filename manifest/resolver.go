@@ -21,6 +21,8 @@ import (
 	"github.com/qdm12/reprint"
 
 	"github.com/cashapp/hermit/envars"
+	"github.com/cashapp/hermit/github"
+	hsandbox "github.com/cashapp/hermit/sandbox"
 	"github.com/cashapp/hermit/sources"
 	"github.com/cashapp/hermit/ui"
 )
@@ -69,10 +71,32 @@ type ResolvedFileRef struct {
 	ToPAth   string
 }
 
+// Delta is a binary patch from the source package of an earlier version.
+type Delta struct {
+	// From is the version the patch applies to.
+	From   string
+	Source string
+	// Format is "bsdiff" or "zstd".
+	Format string
+}
+
+// Completion is a shell completion script for a command provided by a package.
+type Completion struct {
+	// Shell is "bash", "zsh" or "fish".
+	Shell string
+	Name  string
+	// Absolute path of the script, if the package ships it.
+	File string
+	// Command printing the script, if File is not set.
+	Command string
+}
+
 // Package resolved from a manifest.
 type Package struct {
 	Description          string
 	Homepage             string
+	OSV                  *OSVBlock
+	CPE                  string
 	Reference            Reference
 	Arch                 string
 	Binaries             []string
@@ -83,15 +107,27 @@ type Package struct {
 	Env                  envars.Ops
 	Source               string
 	Mirrors              []string
+	Deltas               []Delta
 	Root                 string
 	SHA256               string
+	SHA256Source         string
+	SHA256Signature      string
+	SHA256Key            string
+	CosignSignature      string
+	CosignCert           string
+	CosignBundle         string
+	CosignIdentity       string
+	CosignIssuer         string
 	Dest                 string
 	Test                 string
 	Strip                int
-	Triggers             map[Event][]Action  `json:"-"` // Triggers keyed by event.
+	Triggers             map[Event][]Action `json:"-"` // Triggers keyed by event.
+	Completions          []Completion
+	SandboxWritable      []string            // Paths outside the package that sandboxed commands may write to.
 	UpdateInterval       time.Duration       // How often should we check for updates? 0, if never
 	Files                []*ResolvedFileRef  `json:"-"`
 	FS                   fs.FS               `json:"-"` // FS the Package was loaded from.
+	Manifest             string              `json:"-"` // Path of the manifest the Package was resolved from, including the FS.
 	Warnings             []string            `json:"-"`
 	UnsupportedPlatforms []platform.Platform // Unsupported core platforms
 
@@ -108,11 +144,30 @@ func (p *Package) String() string {
 }
 
 // Trigger triggers an event in this package. Noop if the event is not defined for the package
-func (p *Package) Trigger(l ui.Logger, event Event) (messages []string, err error) {
+//
+// Commands run on unpack, install and uninstall may only write to the package, the temporary directory,
+// the paths in "writable", eg. the environment the event was triggered in, and the package's SandboxWritable.
+func (p *Package) Trigger(l ui.Logger, event Event, writable ...string) (messages []string, err error) {
 	for _, action := range p.Triggers[event] {
+		if sandboxedEvents[event] {
+			restricted, err := sandbox(p, action)
+			switch {
+			case err == nil:
+				action = restricted
+			case hsandbox.UnconfinedAllowed():
+				l.Warnf("%s: %s: %s: %s, applying it on %s anyway", p, action.position(), action, err, event)
+			default:
+				return nil, errors.Errorf("%s: %s: %s: %s, which is not allowed on %s, set --insecure-no-sandbox or HERMIT_INSECURE_NO_SANDBOX=true to apply it anyway", p, action.position(), action, err, event)
+			}
+		}
 		l.Debugf("%s", action)
 		if msg, ok := action.(*MessageAction); ok {
 			messages = append(messages, msg.Text)
+		} else if run, ok := action.(*RunAction); ok && confinedEvents[event] {
+			paths := append([]string{p.Dest, p.Root, os.TempDir()}, writable...)
+			if err := run.applyConfined(l, p, append(paths, p.SandboxWritable...)); err != nil {
+				return nil, errors.WithStack(err)
+			}
 		} else if err := action.Apply(p); err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -138,6 +193,38 @@ func (p *Package) ResolveBinaries() ([]string, error) {
 	return binaries, nil
 }
 
+// Delta returns the patch from version "from" of the package, if there is one.
+func (p *Package) Delta(from Version) (Delta, bool) {
+	for _, delta := range p.Deltas {
+		if delta.From == from.String() {
+			return delta, true
+		}
+	}
+	return Delta{}, false
+}
+
+// Deltas in more specific layers replace those from the same version in less specific ones.
+func (p *Package) addDelta(delta Delta) {
+	for i, existing := range p.Deltas {
+		if existing.From == delta.From {
+			p.Deltas[i] = delta
+			return
+		}
+	}
+	p.Deltas = append(p.Deltas, delta)
+}
+
+// Completions in more specific layers replace those for the same shell and command in less specific ones.
+func (p *Package) addCompletion(completion Completion) {
+	for i, existing := range p.Completions {
+		if existing.Shell == completion.Shell && existing.Name == completion.Name {
+			p.Completions[i] = completion
+			return
+		}
+	}
+	p.Completions = append(p.Completions, completion)
+}
+
 // LogWarnings logs possible warnings found in the package manifest
 func (p *Package) LogWarnings(l *ui.UI) {
 	task := l.Task(p.Reference.String())
@@ -287,6 +374,20 @@ func (r *Resolver) ResolveVirtual(name string) (pkgs []*Package, err error) {
 	return pkgs, nil
 }
 
+// AutoVersion returns the auto-version configuration of the package "name", or nil if it has none.
+func (r *Resolver) AutoVersion(l *ui.UI, name string) (*AutoVersionBlock, error) {
+	manifest, err := r.loader.Load(l, name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, version := range manifest.Versions {
+		if version.AutoVersion != nil {
+			return version.AutoVersion, nil
+		}
+	}
+	return nil, nil
+}
+
 // Resolve a package reference.
 //
 // Returns the highest version matching the given reference
@@ -317,7 +418,7 @@ func matchChannel(manifest *AnnotatedManifest, selector Selector) (collected Ref
 		collected = append(collected, candidate)
 		if selector.Matches(candidate) {
 			selected = candidate
-			foundUpdateInterval = ch.Update
+			foundUpdateInterval = manifest.updateInterval(ch)
 		}
 	}
 	return
@@ -370,6 +471,8 @@ func newPackage(manifest *AnnotatedManifest, config Config, selector Selector) (
 	p := &Package{
 		Description:          manifest.Description,
 		Homepage:             manifest.Homepage,
+		OSV:                  manifest.OSV,
+		CPE:                  manifest.CPE,
 		Reference:            found,
 		Root:                 "${dest}",
 		Dest:                 root,
@@ -377,6 +480,7 @@ func newPackage(manifest *AnnotatedManifest, config Config, selector Selector) (
 		UpdateInterval:       foundUpdateInterval,
 		Files:                []*ResolvedFileRef{},
 		FS:                   manifest.FS,
+		Manifest:             manifest.Path,
 		UnsupportedPlatforms: manifest.unsupported(found, platform.Core),
 	}
 
@@ -405,6 +509,7 @@ func newPackage(manifest *AnnotatedManifest, config Config, selector Selector) (
 
 	vars := map[string]string{}
 	layerEnvars := make([]envars.Envars, 0, len(layers))
+	var githubRelease, githubTag, githubAsset string
 	for _, layer := range layers {
 		if len(layer.Env) > 0 {
 			layerEnvars = append(layerEnvars, layer.Env)
@@ -418,6 +523,30 @@ func newPackage(manifest *AnnotatedManifest, config Config, selector Selector) (
 		if layer.SHA256 != "" {
 			p.SHA256 = layer.SHA256
 		}
+		if layer.SHA256Source != "" {
+			p.SHA256Source = layer.SHA256Source
+		}
+		if layer.SHA256Signature != "" {
+			p.SHA256Signature = layer.SHA256Signature
+		}
+		if layer.SHA256Key != "" {
+			p.SHA256Key = layer.SHA256Key
+		}
+		if layer.CosignSignature != "" {
+			p.CosignSignature = layer.CosignSignature
+		}
+		if layer.CosignCert != "" {
+			p.CosignCert = layer.CosignCert
+		}
+		if layer.CosignBundle != "" {
+			p.CosignBundle = layer.CosignBundle
+		}
+		if layer.CosignIdentity != "" {
+			p.CosignIdentity = layer.CosignIdentity
+		}
+		if layer.CosignIssuer != "" {
+			p.CosignIssuer = layer.CosignIssuer
+		}
 		if layer.Test != nil {
 			p.Test = *layer.Test
 		}
@@ -427,6 +556,33 @@ func newPackage(manifest *AnnotatedManifest, config Config, selector Selector) (
 		if len(layer.Mirrors) > 0 {
 			p.Mirrors = layer.Mirrors
 		}
+		if layer.GitHubRelease != "" {
+			githubRelease = layer.GitHubRelease
+		}
+		if layer.GitHubTag != "" {
+			githubTag = layer.GitHubTag
+		}
+		if layer.GitHubAsset != "" {
+			githubAsset = layer.GitHubAsset
+		}
+		for _, delta := range layer.Deltas {
+			p.addDelta(Delta{From: delta.From, Source: delta.Source, Format: delta.Format})
+		}
+		for _, completion := range layer.Completions {
+			switch completion.Shell {
+			case "bash", "zsh", "fish":
+			default:
+				return nil, errors.Errorf("%s: %s: unsupported completion shell %q, expected bash, zsh or fish", manifest.Path, found, completion.Shell)
+			}
+			if (completion.File == "") == (completion.Command == "") {
+				return nil, errors.Errorf("%s: %s: %s completion must set exactly one of file or cmd", manifest.Path, found, completion.Shell)
+			}
+			name := completion.Name
+			if name == "" {
+				name = found.Name
+			}
+			p.addCompletion(Completion{Shell: completion.Shell, Name: name, File: completion.File, Command: completion.Command})
+		}
 		if layer.Root != "" {
 			p.Root = layer.Root
 		}
@@ -445,6 +601,7 @@ func newPackage(manifest *AnnotatedManifest, config Config, selector Selector) (
 		if len(layer.Provides) != 0 {
 			p.Provides = append(p.Provides, layer.Provides...)
 		}
+		p.SandboxWritable = append(p.SandboxWritable, layer.SandboxWritable...)
 		if len(layer.Triggers) > 0 {
 			for _, trigger := range layer.Triggers {
 				p.Triggers[trigger.Event] = append(p.Triggers[trigger.Event], trigger.Ordered()...)
@@ -464,9 +621,15 @@ func newPackage(manifest *AnnotatedManifest, config Config, selector Selector) (
 	if len(p.Binaries) == 0 && len(p.Apps) == 0 {
 		return p, errors.Wrapf(ErrNoBinaries, "%s: %s", manifest.Path, found)
 	}
-	if p.Source == "" {
+	if p.Source == "" && githubAsset == "" {
 		return p, errors.Wrapf(ErrNoSource, "%s: %s", manifest.Path, found)
 	}
+	if p.Source == "" && githubRelease == "" {
+		return nil, errors.Errorf("%s: %s: github-asset-pattern requires github-release", manifest.Path, found)
+	}
+	if githubTag == "" {
+		githubTag = "v${version}"
+	}
 
 	// Expand variables.
 	//
@@ -573,10 +736,40 @@ func newPackage(manifest *AnnotatedManifest, config Config, selector Selector) (
 	for i, provides := range p.Provides {
 		p.Provides[i] = expand(provides, false)
 	}
-	p.Source = expand(p.Source, false)
+	if p.Source == "" {
+		target := platform.Platform{OS: config.OS, Arch: config.Arch}
+		p.Source = github.AssetURI(expand(githubRelease, false), expand(githubTag, false), expand(githubAsset, false), target)
+	} else {
+		p.Source = expand(p.Source, false)
+	}
+	if p.SHA256 == "" {
+		p.SHA256 = manifest.SHA256Sums[p.Source]
+	}
+	p.SHA256Source = expand(p.SHA256Source, false)
+	p.SHA256Signature = expand(p.SHA256Signature, false)
+	p.CosignSignature = expand(p.CosignSignature, false)
+	p.CosignCert = expand(p.CosignCert, false)
+	p.CosignBundle = expand(p.CosignBundle, false)
+	p.CosignIdentity = expand(p.CosignIdentity, false)
 	for i, mirror := range p.Mirrors {
 		p.Mirrors[i] = expand(mirror, false)
 	}
+	for i, delta := range p.Deltas {
+		p.Deltas[i].Source = expand(delta.Source, false)
+	}
+	for i, path := range p.SandboxWritable {
+		p.SandboxWritable[i] = expand(path, false)
+	}
+	for i, completion := range p.Completions {
+		p.Completions[i].Name = expand(completion.Name, false)
+		p.Completions[i].Command = expand(completion.Command, false)
+		if completion.File != "" {
+			p.Completions[i].File = expand(completion.File, false)
+			if !filepath.IsAbs(p.Completions[i].File) {
+				p.Completions[i].File = filepath.Join(p.Root, p.Completions[i].File)
+			}
+		}
+	}
 	for _, actions := range p.Triggers {
 		for _, action := range actions {
 			switch action := action.(type) {
@@ -683,6 +876,11 @@ func (m *Manifest) validate() []error {
 		versions = m.Versions
 	)
 
+	for _, requires := range m.Requires {
+		if _, err := ParseGlobSelector(requires); err != nil {
+			result = append(result, errors.Errorf("requires %q: %s", requires, err))
+		}
+	}
 	for _, channel := range m.Channels {
 		if channel.Version != "" {
 			g, err := ParseGlob(channel.Version)
@@ -11,6 +11,7 @@ import (
 
 	"github.com/alecthomas/hcl"
 	"github.com/alecthomas/repr"
+	"github.com/gobwas/glob"
 	"github.com/stretchr/testify/require"
 
 	"github.com/cashapp/hermit/envars"
@@ -291,6 +292,60 @@ func TestResolver_Resolve(t *testing.T) {
 			WithVersion("1.0.0").
 			WithSource("www.example.com/foo/bar").
 			Result(),
+	}, {
+		name: "SHA256 from sha256sums",
+		files: map[string]string{
+			`test.hcl`: `
+			description = ""
+			binaries = ["bin"]
+			source = "www.example.com/test-${version}.tgz"
+			sha256sums = {
+				"www.example.com/test-1.0.0.tgz": "abcd",
+			}
+
+			version "1.0.0" {}
+			`,
+		},
+		reference: "test-1.0.0",
+		wantPkg: manifesttest.NewPkgBuilder(config.State + "/pkg/test-1.0.0").
+			WithName("test").
+			WithBinaries("bin").
+			WithVersion("1.0.0").
+			WithSource("www.example.com/test-1.0.0.tgz").
+			WithSHA256("abcd").
+			Result(),
+	}, {
+		name: "Source from GitHub release asset pattern",
+		files: map[string]string{
+			`test.hcl`: `
+			description = ""
+			binaries = ["bin"]
+			github-release = "example/${name}"
+			github-asset-pattern = "test-*-${os}-*.tar.gz"
+
+			version "1.0.0" {}
+			`,
+		},
+		reference: "test-1.0.0",
+		wantPkg: manifesttest.NewPkgBuilder(config.State + "/pkg/test-1.0.0").
+			WithName("test").
+			WithBinaries("bin").
+			WithVersion("1.0.0").
+			WithSource("github-asset://example/test/v1.0.0/test-%2A-linux-%2A.tar.gz?arch=amd64&os=linux").
+			Result(),
+	}, {
+		name: "GitHub release asset pattern requires a release",
+		files: map[string]string{
+			`test.hcl`: `
+			description = ""
+			binaries = ["bin"]
+			github-asset-pattern = "test-*.tar.gz"
+
+			version "1.0.0" {}
+			`,
+		},
+		reference: "test-1.0.0",
+		wantErr:   "memory:///test.hcl: test-1.0.0: github-asset-pattern requires github-release",
 	},
 	}
 	for _, tt := range tests {
@@ -309,6 +364,7 @@ func TestResolver_Resolve(t *testing.T) {
 				}
 				if gotPkg != nil {
 					gotPkg.FS = nil
+					gotPkg.Manifest = ""
 				}
 				require.Equal(t,
 					repr.String(tt.wantPkg, repr.Indent("  "), repr.Hide(hcl.Position{})),
@@ -370,6 +426,7 @@ func TestSearchVersionsAndChannelsCoexist(t *testing.T) {
 			WithSource("www.example.com").
 			WithUpdateInterval(time.Hour * 24).
 			WithFS(ffs).
+			WithManifest("memory:///test.hcl").
 			Result(),
 		manifesttest.NewPkgBuilder(config.State + "/pkg/test@1.0").
 			WithName("test").
@@ -378,6 +435,7 @@ func TestSearchVersionsAndChannelsCoexist(t *testing.T) {
 			WithSource("www.example.com").
 			WithUpdateInterval(time.Hour * 24).
 			WithFS(ffs).
+			WithManifest("memory:///test.hcl").
 			Result(),
 		manifesttest.NewPkgBuilder(config.State + "/pkg/test@latest").
 			WithName("test").
@@ -386,6 +444,7 @@ func TestSearchVersionsAndChannelsCoexist(t *testing.T) {
 			WithSource("www.example.com").
 			WithUpdateInterval(time.Hour * 24).
 			WithFS(ffs).
+			WithManifest("memory:///test.hcl").
 			Result(),
 		manifesttest.NewPkgBuilder(config.State + "/pkg/test@stable").
 			WithName("test").
@@ -394,6 +453,7 @@ func TestSearchVersionsAndChannelsCoexist(t *testing.T) {
 			WithSource("www.example.com").
 			WithUpdateInterval(time.Hour * 24).
 			WithFS(ffs).
+			WithManifest("memory:///test.hcl").
 			Result(),
 		manifesttest.NewPkgBuilder(config.State + "/pkg/test-1.0.0").
 			WithName("test").
@@ -401,7 +461,109 @@ func TestSearchVersionsAndChannelsCoexist(t *testing.T) {
 			WithVersion("1.0.0").
 			WithSource("www.example.com").
 			WithFS(ffs).
+			WithManifest("memory:///test.hcl").
 			Result(),
 	}
 	require.Equal(t, repr.String(expected, repr.Indent("  ")), repr.String(pkgs, repr.Indent("  ")))
 }
+
+func TestManifestUpdateInterval(t *testing.T) {
+	files := map[string]string{
+		"test.hcl": `
+			description = ""
+			binaries = ["bin"]
+			update-interval = "6h"
+			version "1.0.0" {
+			  source = "www.example.com"
+			}
+			channel stable {
+			  source = "www.example.com"
+			}
+			channel nightly {
+			  source = "www.example.com"
+			  update = "1h"
+			}
+		`,
+	}
+	config := Config{
+		Env:   "/home/user/project",
+		State: "/home/user/.cache/hermit",
+		OS:    "Linux",
+		Arch:  "x86_64",
+	}
+	logger := ui.New(ui.LevelInfo, os.Stdout, os.Stderr, true, true)
+	ss := []sources.Source{}
+	for name, content := range files {
+		ss = append(ss, sources.NewMemSource(name, content))
+	}
+	l, err := New(sources.New("", ss), config)
+	require.NoError(t, err)
+	for ref, expected := range map[string]time.Duration{
+		"test@stable":  time.Hour * 6,
+		"test@nightly": time.Hour,
+		"test@latest":  time.Hour * 6,
+		"test@1.0":     time.Hour * 6,
+		"test-1.0.0":   0,
+	} {
+		pkg, err := l.Resolve(logger, ExactSelector(ParseReference(ref)))
+		require.NoError(t, err)
+		require.Equal(t, expected, pkg.UpdateInterval, ref)
+	}
+}
+
+func TestResolveCompletions(t *testing.T) {
+	resolve := func(manifest string) (*Package, error) {
+		l, err := New(sources.New("", []sources.Source{sources.NewMemSource("test.hcl", manifest)}), Config{
+			State: "/state",
+			OS:    "linux",
+			Arch:  "amd64",
+		})
+		require.NoError(t, err)
+		return l.Resolve(ui.New(ui.LevelInfo, os.Stdout, os.Stderr, true, true), ExactSelector(ParseReference("test-1.0.0")))
+	}
+	pkg, err := resolve(`
+		description = ""
+		binaries = ["bin"]
+		source = "www.example.com"
+		completion "bash" {
+		  file = "completions/test.bash"
+		}
+		completion "zsh" {
+		  cmd = "${root}/bin completion zsh"
+		}
+		version "1.0.0" {
+		  linux {
+		    completion "bash" {
+		      file = "linux/test.bash"
+		    }
+		  }
+		}
+	`)
+	require.NoError(t, err)
+	require.Equal(t, []Completion{
+		{Shell: "bash", Name: "test", File: "/state/pkg/test-1.0.0/linux/test.bash"},
+		{Shell: "zsh", Name: "test", Command: "/state/pkg/test-1.0.0/bin completion zsh"},
+	}, pkg.Completions)
+
+	_, err = resolve(`
+		description = ""
+		binaries = ["bin"]
+		source = "www.example.com"
+		completion "tcsh" {
+		  file = "test.tcsh"
+		}
+		version "1.0.0" {}
+	`)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), `unsupported completion shell "tcsh"`)
+}
+
+func TestHighestMatchPrefersReleasesOverPrereleases(t *testing.T) {
+	m := &Manifest{Versions: []VersionBlock{
+		{Version: []string{"1.0.0", "1.1.0-rc.1"}},
+	}}
+	_, highest := m.HighestMatch(glob.MustCompile("1.*"))
+	require.Equal(t, "1.0.0", highest.String())
+	_, highest = m.HighestMatch(glob.MustCompile("1.*-rc.*"))
+	require.Equal(t, "1.1.0-rc.1", highest.String())
+}
@@ -1,8 +1,12 @@
 package manifest
 
 import (
+	"io/fs"
+	"path/filepath"
 	"sort"
+	"strings"
 
+	"github.com/kballard/go-shellquote"
 	"github.com/pkg/errors"
 )
 
@@ -39,7 +43,7 @@ var eventMap = map[Event]bool{
 
 // A Trigger applied when a lifecycle event occurs.
 type Trigger struct {
-	Event Event `hcl:"event,label" help:"Event to Trigger (unpack, install, activate)."`
+	Event Event `hcl:"event,label" help:"Event to Trigger (unpack, install, uninstall, activate)."`
 
 	Run     []*RunAction     `hcl:"run,block" help:"A command to run when the event is triggered."`
 	Copy    []*CopyAction    `hcl:"copy,block" help:"A file to copy when the event is triggered."`
@@ -75,3 +79,138 @@ func (a *Trigger) Ordered() []Action {
 	})
 	return out
 }
+
+// Events whose actions are sandboxed to the package.
+//
+// These are triggered in each environment the package is installed
+// into, so their actions may only modify files within the package, and
+// may only run the package's own binaries. Other actions are rejected
+// unless unconfined actions are allowed with sandbox.AllowUnconfined.
+var sandboxedEvents = map[Event]bool{
+	EventInstall:   true,
+	EventUninstall: true,
+}
+
+// Events whose run actions are confined by the OS to writing within the
+// package, as their commands shouldn't modify the user's files.
+var confinedEvents = map[Event]bool{
+	EventUnpack:    true,
+	EventInstall:   true,
+	EventUninstall: true,
+}
+
+// Check that an action is confined to the package, returning the action to apply.
+//
+// A run action's command may be the name of one of the package's binaries,
+// in which case a copy of the action running the path to the binary is returned.
+func sandbox(p *Package, action Action) (Action, error) {
+	switch action := action.(type) {
+	case *RunAction:
+		args, err := shellquote.Split(action.Command)
+		if err != nil || len(args) == 0 {
+			return nil, errors.Errorf("invalid shell command %q", action.Command)
+		}
+		dir := action.Dir
+		if dir == "" {
+			dir = p.Root
+		}
+		if err := withinPackage(p, dir); err != nil {
+			return nil, err
+		}
+		binary := args[0]
+		if !strings.ContainsRune(binary, filepath.Separator) && !strings.ContainsRune(binary, '/') {
+			binaries, err := p.ResolveBinaries()
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			found := false
+			for _, path := range binaries {
+				if filepath.Base(path) == binary {
+					binary, found = path, true
+					break
+				}
+			}
+			if !found {
+				return nil, errors.Errorf("%s: not a binary of the package", binary)
+			}
+		} else if !filepath.IsAbs(binary) {
+			binary = filepath.Join(dir, binary)
+		}
+		if err := withinPackage(p, binary); err != nil {
+			return nil, err
+		}
+		// The action is shared by every resolution of the manifest, so it isn't modified.
+		resolved := *action
+		args[0] = binary
+		resolved.Command = shellquote.Join(args...)
+		return &resolved, nil
+	case *CopyAction:
+		if filepath.IsAbs(action.From) {
+			if err := withinPackage(p, action.From); err != nil {
+				return nil, err
+			}
+		} else if !fs.ValidPath(filepath.ToSlash(action.From)) {
+			// Relative paths are within the manifest source bundle.
+			return nil, errors.Errorf("%s: outside of the manifest source bundle", action.From)
+		}
+		return action, withinPackage(p, action.To)
+	case *ChmodAction:
+		return action, withinPackage(p, action.File)
+	case *RenameAction:
+		if err := withinPackage(p, action.From); err != nil {
+			return nil, err
+		}
+		return action, withinPackage(p, action.To)
+	case *DeleteAction:
+		for _, file := range action.Files {
+			if err := withinPackage(p, file); err != nil {
+				return nil, err
+			}
+		}
+		return action, nil
+	case *MessageAction:
+		return action, nil
+	default:
+		return nil, errors.Errorf("unsupported action %s", action)
+	}
+}
+
+// Check that a path is within the directory the package is extracted to,
+// after resolving symlinks, which could otherwise point out of the package.
+func withinPackage(p *Package, path string) error {
+	abs, err := resolvePath(path)
+	if err != nil {
+		return err
+	}
+	dest, err := resolvePath(p.Dest)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(dest, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return errors.Errorf("%s: outside of the package directory %s", path, p.Dest)
+	}
+	return nil
+}
+
+// Returns the absolute path of "path" with symlinks resolved. If it doesn't
+// exist, eg. the destination of a copy, those of its closest existing
+// ancestor are resolved.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	missing := ""
+	for {
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			return filepath.Join(resolved, missing), nil
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return filepath.Join(abs, missing), nil
+		}
+		missing = filepath.Join(filepath.Base(abs), missing)
+		abs = parent
+	}
+}
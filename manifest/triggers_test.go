@@ -0,0 +1,163 @@
+package manifest
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	hsandbox "github.com/cashapp/hermit/sandbox"
+	"github.com/cashapp/hermit/ui"
+)
+
+func TestMain(m *testing.M) {
+	// Run actions are only confined in programs that initialise the sandbox.
+	hsandbox.Init()
+	os.Exit(m.Run())
+}
+
+func TestSandbox(t *testing.T) {
+	dest := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dest, "bin"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "bin", "tool"), []byte("#!/bin/sh\n"), 0700)) // nolint: gosec
+	outside := t.TempDir()
+	require.NoError(t, os.Symlink(outside, filepath.Join(dest, "escape")))
+
+	tests := []struct {
+		name    string
+		action  Action
+		command string
+		err     string
+	}{
+		{name: "RunPackageBinary",
+			action:  &RunAction{Command: "tool --init"},
+			command: filepath.Join(dest, "bin", "tool") + " --init"},
+		{name: "RunRelativeBinary",
+			action:  &RunAction{Command: "bin/tool"},
+			command: filepath.Join(dest, "bin", "tool")},
+		{name: "RunUnknownBinary",
+			action: &RunAction{Command: "sh -c 'rm -rf /'"},
+			err:    "sh: not a binary of the package"},
+		{name: "RunSystemBinary",
+			action: &RunAction{Command: "/bin/sh"},
+			err:    "/bin/sh: outside of the package directory"},
+		{name: "RunOutsideDir",
+			action: &RunAction{Command: "tool", Dir: outside},
+			err:    outside + ": outside of the package directory"},
+		{name: "CopyFromBundle",
+			action: &CopyAction{From: "config", To: filepath.Join(dest, "config")}},
+		{name: "CopyOutside",
+			action: &CopyAction{From: "config", To: filepath.Join(outside, "config")},
+			err:    "outside of the package directory"},
+		{name: "CopyFromOutsideBundle",
+			action: &CopyAction{From: "../../etc/passwd", To: filepath.Join(dest, "passwd")},
+			err:    "../../etc/passwd: outside of the manifest source bundle"},
+		{name: "CopyFromOutside",
+			action: &CopyAction{From: "/etc/passwd", To: filepath.Join(dest, "passwd")},
+			err:    "/etc/passwd: outside of the package directory"},
+		{name: "ChmodEscape",
+			action: &ChmodAction{File: filepath.Join(dest, "..", "file"), Mode: 0700},
+			err:    "outside of the package directory"},
+		{name: "Rename",
+			action: &RenameAction{From: filepath.Join(dest, "a"), To: filepath.Join(dest, "b")}},
+		{name: "DeleteOutside",
+			action: &DeleteAction{Files: []string{filepath.Join(dest, "a"), outside}},
+			err:    "outside of the package directory"},
+		{name: "CopyThroughSymlink",
+			action: &CopyAction{From: "config", To: filepath.Join(dest, "escape", "config")},
+			err:    "outside of the package directory"},
+		{name: "ChmodThroughSymlink",
+			action: &ChmodAction{File: filepath.Join(dest, "escape"), Mode: 0700},
+			err:    "outside of the package directory"},
+		{name: "Message",
+			action: &MessageAction{Text: "Run tool --help to get started"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			pkg := &Package{Dest: dest, Root: dest, Binaries: []string{"bin/*"}}
+			original := fmt.Sprint(test.action)
+			action, err := sandbox(pkg, test.action)
+			require.Equal(t, original, fmt.Sprint(test.action), "the manifest's action was modified")
+			if test.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			if test.command != "" {
+				require.Equal(t, test.command, action.(*RunAction).Command)
+			}
+		})
+	}
+}
+
+func TestTriggerConfinesCommands(t *testing.T) {
+	_, err := hsandbox.Policy{}.Output(exec.Command("true"))
+	if errors.Is(err, hsandbox.ErrUnsupported) || errors.Is(err, hsandbox.ErrUnavailable) {
+		t.Skip(err.Error())
+	}
+	dest := t.TempDir()
+	// The temporary directory is writable, so the test writes to the working directory instead.
+	outside, err := os.MkdirTemp(".", "outside")
+	require.NoError(t, err)
+	defer os.RemoveAll(outside)
+	allowed, err := os.MkdirTemp(".", "allowed")
+	require.NoError(t, err)
+	defer os.RemoveAll(allowed)
+	outside, _ = filepath.Abs(outside)
+	allowed, _ = filepath.Abs(allowed)
+	p, _ := ui.NewForTesting()
+
+	pkg := &Package{Dest: dest, Root: dest, SandboxWritable: []string{allowed}, Triggers: map[Event][]Action{
+		EventUnpack: {
+			&RunAction{Command: "/bin/sh", Args: []string{"-c", "echo > package && echo > " + allowed + "/file"}},
+		},
+	}}
+	_, err = pkg.Trigger(p, EventUnpack)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(dest, "package"))
+	require.FileExists(t, filepath.Join(allowed, "file"))
+
+	pkg.Triggers[EventUnpack] = []Action{&RunAction{Command: "/bin/sh", Args: []string{"-c", "echo > " + outside + "/file"}}}
+	_, err = pkg.Trigger(p, EventUnpack)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "the sandbox stopped \"/bin/sh\" writing outside of the package")
+	require.Contains(t, err.Error(), outside+"/file")
+	require.NoFileExists(t, filepath.Join(outside, "file"))
+
+	// Environments pass their own directory as writable.
+	_, err = pkg.Trigger(p, EventUnpack, outside)
+	require.NoError(t, err)
+	require.FileExists(t, filepath.Join(outside, "file"))
+}
+
+func TestTriggerRejectsUnsandboxedActions(t *testing.T) {
+	dest := t.TempDir()
+	target := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(target, nil, 0600))
+	p, buf := ui.NewForTesting()
+	pkg := &Package{Dest: dest, Root: dest, Triggers: map[Event][]Action{
+		EventInstall: {&ChmodAction{File: target, Mode: 0700}},
+	}}
+	_, err := pkg.Trigger(p, EventInstall)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "outside of the package directory")
+	require.Contains(t, err.Error(), "--insecure-no-sandbox")
+	info, err := os.Stat(target)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	// Unless explicitly allowed.
+	hsandbox.AllowUnconfined(true)
+	defer hsandbox.AllowUnconfined(false)
+	_, err = pkg.Trigger(p, EventInstall)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), "outside of the package directory")
+	info, err = os.Stat(target)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0700), info.Mode().Perm())
+}
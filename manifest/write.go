@@ -0,0 +1,41 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/alecthomas/hcl"
+	"github.com/pkg/errors"
+)
+
+// WriteAST atomically replaces the manifest at "path" with "ast", preserving
+// the permissions of the existing file.
+func WriteAST(path string, ast *hcl.AST) error {
+	content, err := hcl.MarshalAST(ast)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		mode = info.Mode().Perm()
+	} else if !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	w, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer w.Close() // nolint
+	defer os.Remove(w.Name())
+	if _, err := w.Write(content); err != nil {
+		return errors.WithStack(err)
+	}
+	// CreateTemp creates the file readable only by its owner.
+	if err := w.Chmod(mode); err != nil {
+		return errors.WithStack(err)
+	}
+	if err := w.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(w.Name(), path))
+}
@@ -0,0 +1,29 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/alecthomas/hcl"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteASTPreservesPermissions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.hcl")
+	require.NoError(t, os.WriteFile(path, []byte(`description = "old"`+"\n"), 0640))
+	require.NoError(t, os.Chmod(path, 0640))
+	ast, err := hcl.ParseString(`description = "new"` + "\n")
+	require.NoError(t, err)
+	require.NoError(t, WriteAST(path, ast))
+
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `"new"`)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
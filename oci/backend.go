@@ -0,0 +1,152 @@
+package oci
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/sources"
+	"github.com/cashapp/hermit/ui"
+)
+
+// Backend returns a sources.Backend that synchronises manifests from
+// "oci://" sources.
+//
+// Each layer of the artifact that is a ".hcl" file is added to the source,
+// as are the ".hcl" files within tarball layers (eg. a directory pushed with
+// ORAS). If the source URI selects a layer with "#<title>" only that layer is
+// used.
+func (c *Client) Backend() sources.Backend {
+	return &backend{client: c}
+}
+
+type backend struct {
+	client *Client
+}
+
+func (b *backend) Resolve(uri *url.URL, sourcesDir string) (string, error) {
+	if _, err := ParseReference(uri.String()); err != nil {
+		return "", err
+	}
+	return sources.DefaultBackendDir(uri, sourcesDir), nil
+}
+
+func (b *backend) Sync(task *ui.Task, uri *url.URL, dir string) error {
+	ctx := context.Background()
+	ref, err := ParseReference(uri.String())
+	if err != nil {
+		return err
+	}
+	manifest, err := b.client.Manifest(ctx, ref)
+	if err != nil {
+		return err
+	}
+	layers := manifest.Layers
+	if ref.Title != "" {
+		layer, err := manifest.Layer(ref.Title)
+		if err != nil {
+			return errors.Wrap(err, ref.String())
+		}
+		layers = []Descriptor{layer}
+	}
+	task.Debugf("Syncing %d layers of %s", len(layers), manifest.Digest)
+
+	if err := os.MkdirAll(filepath.Dir(dir), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	tmpDir, err := os.MkdirTemp(filepath.Dir(dir), filepath.Base(dir)+".*.tmp")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.RemoveAll(tmpDir)
+	for _, layer := range layers {
+		if err := b.syncLayer(ctx, ref, layer, tmpDir); err != nil {
+			return errors.Wrapf(err, "%s: layer %s", ref, layer.Digest)
+		}
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmpDir, dir))
+}
+
+func (b *backend) syncLayer(ctx context.Context, ref Reference, layer Descriptor, dir string) error {
+	title := layer.Title()
+	tarball := isTarball(layer)
+	if !tarball && !strings.HasSuffix(title, ".hcl") {
+		return nil
+	}
+	resp, err := b.client.Blob(ctx, ref, layer, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("failed to retrieve blob: %s", resp.Status)
+	}
+	if !tarball {
+		return writeManifest(filepath.Join(dir, path.Base(title)), resp.Body)
+	}
+	var r io.Reader = resp.Body
+	if strings.Contains(layer.MediaType, "gzip") || strings.HasSuffix(title, ".gz") || strings.HasSuffix(title, ".tgz") {
+		zr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer zr.Close()
+		r = zr
+	}
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return errors.WithStack(err)
+		}
+		if hdr.Typeflag != tar.TypeReg || !strings.HasSuffix(hdr.Name, ".hcl") {
+			continue
+		}
+		// Manifests are looked up by file name, so flatten the hierarchy.
+		if err := writeManifest(filepath.Join(dir, path.Base(hdr.Name)), tr); err != nil {
+			return err
+		}
+	}
+	// Drain the body so that the blob's digest is verified.
+	_, err = io.Copy(io.Discard, resp.Body)
+	return errors.WithStack(err)
+}
+
+func isTarball(layer Descriptor) bool {
+	if layer.Annotations[unpackAnnotation] == "true" {
+		return true
+	}
+	return strings.Contains(layer.MediaType, ".tar") || strings.HasSuffix(layer.MediaType, "tar")
+}
+
+func writeManifest(path string, r io.Reader) error {
+	w, err := os.Create(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer w.Close()
+	_, err = io.Copy(w, r)
+	return errors.WithStack(err)
+}
+
+func (b *backend) Fetch(_ *url.URL, dir string) (fs.FS, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return os.DirFS(dir), nil
+}
@@ -0,0 +1,349 @@
+package oci
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// Media types accepted for artifact manifests.
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.artifact.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+// TitleAnnotation is the layer annotation ORAS records each file's name in.
+const TitleAnnotation = "org.opencontainers.image.title"
+
+// Layers with this annotation set to "true" are directories pushed by ORAS as tarballs.
+const unpackAnnotation = "io.deis.oras.content.unpack"
+
+// Descriptor of a blob in a registry.
+type Descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// Title of the blob, if any.
+func (d Descriptor) Title() string {
+	return d.Annotations[TitleAnnotation]
+}
+
+// Manifest of an artifact.
+type Manifest struct {
+	// Digest of the manifest itself.
+	Digest string
+	Layers []Descriptor
+}
+
+// Layer returns the layer with the given title, or the only layer if "title" is empty.
+func (m *Manifest) Layer(title string) (Descriptor, error) {
+	if title == "" {
+		if len(m.Layers) != 1 {
+			return Descriptor{}, errors.Errorf("artifact has %d layers, select one with #<title>", len(m.Layers))
+		}
+		return m.Layers[0], nil
+	}
+	for _, layer := range m.Layers {
+		if layer.Title() == title {
+			return layer, nil
+		}
+	}
+	return Descriptor{}, errors.Errorf("artifact has no layer titled %q", title)
+}
+
+// Option for the Client.
+type Option func(*Client)
+
+// WithCredentials sets the store registry credentials are retrieved from.
+//
+// Defaults to DockerCredentials().
+func WithCredentials(store CredentialStore) Option {
+	return func(c *Client) { c.credentials = store }
+}
+
+// Client for OCI distribution registries.
+type Client struct {
+	client      *http.Client
+	credentials CredentialStore
+
+	lock sync.Mutex
+	// Authorization header values, keyed by registry and repository.
+	auth map[string]string
+}
+
+// New creates a new registry Client.
+func New(client *http.Client, options ...Option) *Client {
+	c := &Client{
+		client:      client,
+		credentials: DockerCredentials(),
+		auth:        map[string]string{},
+	}
+	for _, option := range options {
+		option(c)
+	}
+	return c
+}
+
+// Manifest retrieves the manifest referred to by "ref".
+//
+// If "ref" is pinned to a digest the manifest is verified against it.
+func (c *Client) Manifest(ctx context.Context, ref Reference) (*Manifest, error) {
+	header := http.Header{"Accept": {strings.Join(manifestMediaTypes, ", ")}}
+	resp, err := c.get(ctx, ref, "manifests/"+ref.Version(), header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s: failed to retrieve manifest: %s", ref, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, errors.Wrap(err, ref.String())
+	}
+	sum := sha256.Sum256(data)
+	digest := "sha256:" + hex.EncodeToString(sum[:])
+	if ref.Digest != "" && ref.Digest != digest {
+		return nil, errors.Errorf("%s: manifest digest is %s", ref, digest)
+	}
+	raw := struct {
+		MediaType string       `json:"mediaType"`
+		Layers    []Descriptor `json:"layers"`
+		// OCI artifact manifests call their layers "blobs".
+		Blobs []Descriptor `json:"blobs"`
+	}{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, errors.Wrapf(err, "%s: invalid manifest", ref)
+	}
+	if strings.HasSuffix(raw.MediaType, "index.v1+json") || strings.HasSuffix(raw.MediaType, "manifest.list.v2+json") {
+		return nil, errors.Errorf("%s: image indexes are not supported", ref)
+	}
+	return &Manifest{Digest: digest, Layers: append(raw.Layers, raw.Blobs...)}, nil
+}
+
+// Blob retrieves the blob described by "desc" from the repository referred to by "ref".
+//
+// "header" is passed through to the registry, eg. to request a Range. The
+// body of a complete (200) response fails with an error on EOF if its
+// content does not match the descriptor.
+func (c *Client) Blob(ctx context.Context, ref Reference, desc Descriptor, header http.Header) (*http.Response, error) {
+	if !strings.HasPrefix(desc.Digest, "sha256:") {
+		return nil, errors.Errorf("%s: unsupported digest %q", ref, desc.Digest)
+	}
+	resp, err := c.get(ctx, ref, "blobs/"+desc.Digest, header)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusOK {
+		resp.Body = &verifyingReader{
+			ReadCloser: resp.Body,
+			name:       ref.String(),
+			digest:     desc.Digest,
+			size:       desc.Size,
+			hash:       sha256.New(),
+		}
+	}
+	return resp, nil
+}
+
+func (c *Client) get(ctx context.Context, ref Reference, path string, header http.Header) (*http.Response, error) {
+	uri := fmt.Sprintf("%s://%s/v2/%s/%s", registryScheme(ref.Registry), ref.Registry, ref.Repository, path)
+	key := ref.Registry + "/" + ref.Repository
+	do := func() (*http.Response, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, uri, nil)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		c.lock.Lock()
+		if auth := c.auth[key]; auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		c.lock.Unlock()
+		resp, err := c.client.Do(req)
+		return resp, errors.Wrap(err, ref.String())
+	}
+	resp, err := do()
+	if err != nil || resp.StatusCode != http.StatusUnauthorized {
+		return resp, err
+	}
+	challenge := resp.Header.Get("WWW-Authenticate")
+	_ = resp.Body.Close()
+	auth, err := c.authorise(ctx, ref, challenge)
+	if err != nil {
+		return nil, errors.Wrap(err, ref.String())
+	}
+	c.lock.Lock()
+	c.auth[key] = auth
+	c.lock.Unlock()
+	return do()
+}
+
+// Respond to an authentication challenge from a registry, returning the Authorization header to retry with.
+func (c *Client) authorise(ctx context.Context, ref Reference, challenge string) (string, error) {
+	creds, err := c.credentials(ref.Registry)
+	if err != nil {
+		return "", err
+	}
+	scheme, params := parseChallenge(challenge)
+	switch scheme {
+	case "basic":
+		if creds == nil {
+			return "", errors.Errorf("%s requires credentials, use \"docker login %s\"", ref.Registry, ref.Registry)
+		}
+		req := &http.Request{Header: http.Header{}}
+		req.SetBasicAuth(creds.Username, creds.Password)
+		return req.Header.Get("Authorization"), nil
+
+	case "bearer":
+		return c.token(ctx, ref, params, creds)
+
+	default:
+		return "", errors.Errorf("unsupported authentication challenge %q", challenge)
+	}
+}
+
+// Exchange credentials, if any, for a pull token.
+//
+// See https://distribution.github.io/distribution/spec/auth/token/
+func (c *Client) token(ctx context.Context, ref Reference, params map[string]string, creds *Credentials) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", errors.Errorf("invalid token realm %q", params["realm"])
+	}
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + ref.Repository + ":pull"
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	if creds != nil {
+		req.SetBasicAuth(creds.Username, creds.Password)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if creds == nil {
+			return "", errors.Errorf("token request failed: %s, use \"docker login %s\" if the repository is private", resp.Status, ref.Registry)
+		}
+		return "", errors.Errorf("token request failed: %s", resp.Status)
+	}
+	token := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", errors.Wrap(err, "invalid token response")
+	}
+	if token.Token == "" {
+		token.Token = token.AccessToken
+	}
+	if token.Token == "" {
+		return "", errors.New("token response did not include a token")
+	}
+	return "Bearer " + token.Token, nil
+}
+
+// Parse a WWW-Authenticate challenge such as
+// `Bearer realm="https://auth.example.com/token",service="example.com",scope="repository:a/b:pull"`.
+func parseChallenge(challenge string) (scheme string, params map[string]string) {
+	params = map[string]string{}
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	scheme = strings.ToLower(parts[0])
+	if len(parts) == 1 {
+		return scheme, params
+	}
+	rest := parts[1]
+	for rest != "" {
+		rest = strings.TrimLeft(rest, ", ")
+		eq := strings.Index(rest, "=")
+		if eq == -1 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end == -1 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if comma := strings.Index(rest, ","); comma != -1 {
+			value, rest = rest[:comma], rest[comma:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+	}
+	return scheme, params
+}
+
+// Registries on the loopback interface are accessed over plain HTTP, as the Docker CLI does.
+func registryScheme(registry string) string {
+	host := registry
+	if h, _, err := net.SplitHostPort(registry); err == nil {
+		host = h
+	}
+	if host == "localhost" {
+		return "http"
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsLoopback() {
+		return "http"
+	}
+	return "https"
+}
+
+// Verifies the content of a blob against its descriptor at EOF.
+type verifyingReader struct {
+	io.ReadCloser
+	name   string
+	digest string
+	size   int64
+	read   int64
+	hash   hash.Hash
+}
+
+func (v *verifyingReader) Read(p []byte) (int, error) {
+	n, err := v.ReadCloser.Read(p)
+	v.read += int64(n)
+	_, _ = v.hash.Write(p[:n])
+	if err == io.EOF {
+		if v.read != v.size {
+			return n, errors.Errorf("%s: expected %d bytes but received %d", v.name, v.size, v.read)
+		}
+		if digest := "sha256:" + hex.EncodeToString(v.hash.Sum(nil)); digest != v.digest {
+			return n, errors.Errorf("%s: digest mismatch, expected %s but received %s", v.name, v.digest, digest)
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,123 @@
+package oci
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Credentials for a registry.
+type Credentials struct {
+	Username string
+	Password string
+}
+
+// A CredentialStore looks up credentials for a registry host.
+//
+// It returns nil credentials if there are none for the registry.
+type CredentialStore func(registry string) (*Credentials, error)
+
+// The Docker CLI's config.json, as far as registry credentials are concerned.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth string `json:"auth"`
+	} `json:"auths"`
+	CredsStore  string            `json:"credsStore"`
+	CredHelpers map[string]string `json:"credHelpers"`
+}
+
+// DockerCredentials returns a CredentialStore backed by the Docker CLI
+// configuration in $DOCKER_CONFIG/config.json or ~/.docker/config.json.
+//
+// Credential helpers ("credHelpers" and "credsStore") are run as
+// "docker-credential-<helper> get", as the Docker CLI does.
+func DockerCredentials() CredentialStore {
+	return func(registry string) (*Credentials, error) {
+		dir := os.Getenv("DOCKER_CONFIG")
+		if dir == "" {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				return nil, nil // nolint: nilerr
+			}
+			dir = filepath.Join(home, ".docker")
+		}
+		return dockerCredentials(dir, registry)
+	}
+}
+
+func dockerCredentials(dir, registry string) (*Credentials, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	config := dockerConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, errors.Wrap(err, "invalid Docker config")
+	}
+	return config.credentials(registry)
+}
+
+func (d *dockerConfig) credentials(registry string) (*Credentials, error) {
+	if helper, ok := d.CredHelpers[registry]; ok {
+		return runCredentialHelper(helper, registry)
+	}
+	for host, auth := range d.Auths {
+		if normaliseRegistry(host) != registry || auth.Auth == "" {
+			continue
+		}
+		decoded, err := base64.StdEncoding.DecodeString(auth.Auth)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid Docker credentials for %s", registry)
+		}
+		parts := strings.SplitN(string(decoded), ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.Errorf("invalid Docker credentials for %s", registry)
+		}
+		return &Credentials{Username: parts[0], Password: parts[1]}, nil
+	}
+	if d.CredsStore != "" {
+		return runCredentialHelper(d.CredsStore, registry)
+	}
+	return nil, nil
+}
+
+// Keys in "auths" are sometimes full URLs, eg. "https://index.docker.io/v1/".
+func normaliseRegistry(host string) string {
+	host = strings.TrimPrefix(host, "https://")
+	host = strings.TrimPrefix(host, "http://")
+	if i := strings.Index(host, "/"); i != -1 {
+		host = host[:i]
+	}
+	return host
+}
+
+func runCredentialHelper(helper, registry string) (*Credentials, error) {
+	cmd := exec.Command("docker-credential-"+helper, "get") // nolint: gosec
+	cmd.Stdin = strings.NewReader(registry)
+	stderr := &bytes.Buffer{}
+	cmd.Stderr = stderr
+	out, err := cmd.Output()
+	if err != nil {
+		// Helpers report missing credentials on stdout rather than stderr.
+		if strings.Contains(string(out), "credentials not found") {
+			return nil, nil
+		}
+		return nil, errors.Wrapf(err, "docker-credential-%s: %s", helper, strings.TrimSpace(stderr.String()))
+	}
+	creds := struct {
+		Username string
+		Secret   string
+	}{}
+	if err := json.Unmarshal(out, &creds); err != nil {
+		return nil, errors.Wrapf(err, "docker-credential-%s: invalid response", helper)
+	}
+	return &Credentials{Username: creds.Username, Password: creds.Secret}, nil
+}
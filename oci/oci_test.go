@@ -0,0 +1,284 @@
+package oci
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/ui"
+)
+
+// A minimal registry serving a single artifact, "hermit/tools:1.0", behind token authentication.
+type testRegistry struct {
+	*httptest.Server
+	host     string
+	blobs    map[string][]byte
+	manifest []byte
+
+	lock sync.Mutex
+	// Basic auth credentials presented to the token endpoint.
+	tokenRequests []string
+}
+
+func newTestRegistry(t *testing.T, layers map[string][]byte) *testRegistry {
+	t.Helper()
+	r := &testRegistry{blobs: map[string][]byte{}}
+	descriptors := []Descriptor{}
+	for title, content := range layers {
+		digest := sha256Digest(content)
+		r.blobs[digest] = content
+		mediaType := "application/octet-stream"
+		if strings.HasSuffix(title, ".tar.gz") {
+			mediaType = "application/vnd.oci.image.layer.v1.tar+gzip"
+		}
+		descriptors = append(descriptors, Descriptor{
+			MediaType:   mediaType,
+			Digest:      digest,
+			Size:        int64(len(content)),
+			Annotations: map[string]string{TitleAnnotation: title},
+		})
+	}
+	var err error
+	r.manifest, err = json.Marshal(map[string]interface{}{
+		"schemaVersion": 2,
+		"mediaType":     "application/vnd.oci.image.manifest.v1+json",
+		"layers":        descriptors,
+	})
+	require.NoError(t, err)
+	r.Server = httptest.NewServer(http.HandlerFunc(r.serve))
+	t.Cleanup(r.Close)
+	u, err := url.Parse(r.URL)
+	require.NoError(t, err)
+	r.host = u.Host
+	return r
+}
+
+func (r *testRegistry) serve(w http.ResponseWriter, req *http.Request) {
+	if req.URL.Path == "/token" {
+		user, pass, _ := req.BasicAuth()
+		r.lock.Lock()
+		r.tokenRequests = append(r.tokenRequests, user+":"+pass+" "+req.URL.Query().Get("scope"))
+		r.lock.Unlock()
+		fmt.Fprint(w, `{"token": "secret-token"}`)
+		return
+	}
+	if req.Header.Get("Authorization") != "Bearer secret-token" {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="test",scope="repository:hermit/tools:pull"`, r.URL))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	switch {
+	case strings.HasPrefix(req.URL.Path, "/v2/hermit/tools/manifests/"):
+		w.Header().Set("Content-Type", "application/vnd.oci.image.manifest.v1+json")
+		_, _ = w.Write(r.manifest)
+	case strings.HasPrefix(req.URL.Path, "/v2/hermit/tools/blobs/"):
+		blob, ok := r.blobs[strings.TrimPrefix(req.URL.Path, "/v2/hermit/tools/blobs/")]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(blob))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func sha256Digest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func staticCredentials(registry string) (*Credentials, error) {
+	return &Credentials{Username: "user", Password: "pass"}, nil
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		uri      string
+		expected Reference
+		err      string
+	}{
+		{uri: "oci://ghcr.io/cashapp/tools:1.0#tool.tar.gz",
+			expected: Reference{Registry: "ghcr.io", Repository: "cashapp/tools", Tag: "1.0", Title: "tool.tar.gz"}},
+		{uri: "oci://localhost:5000/tools",
+			expected: Reference{Registry: "localhost:5000", Repository: "tools", Tag: "latest"}},
+		{uri: "oci://ghcr.io/tools@sha256:abcd",
+			expected: Reference{Registry: "ghcr.io", Repository: "tools", Digest: "sha256:abcd"}},
+		{uri: "oci://ghcr.io/tools@md5:abcd", err: "unsupported digest"},
+		{uri: "oci://ghcr.io", err: "expected oci://"},
+		{uri: "https://ghcr.io/tools", err: "not an oci:// URI"},
+	}
+	for _, test := range tests {
+		t.Run(test.uri, func(t *testing.T) {
+			ref, err := ParseReference(test.uri)
+			if test.err != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, test.expected, ref)
+		})
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(`Bearer realm="https://auth.example.com/token",service="example.com",scope="repository:a/b:pull,push"`)
+	require.Equal(t, "bearer", scheme)
+	require.Equal(t, map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "example.com",
+		"scope":   "repository:a/b:pull,push",
+	}, params)
+}
+
+func TestTransport(t *testing.T) {
+	content := []byte("#!/bin/sh\necho tool\n")
+	reg := newTestRegistry(t, map[string][]byte{"tool": content, "README.md": []byte("readme")})
+	client := New(http.DefaultClient, WithCredentials(staticCredentials)).Wrap(http.DefaultClient)
+	uri := "oci://" + reg.host + "/hermit/tools:1.0#tool"
+
+	resp, err := client.Head(uri)
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, int64(len(content)), resp.ContentLength)
+	require.Equal(t, `"`+sha256Digest(content)+`"`, resp.Header.Get("ETag"))
+
+	resp, err = client.Get(uri)
+	require.NoError(t, err)
+	data, err := io.ReadAll(resp.Body)
+	_ = resp.Body.Close()
+	require.NoError(t, err)
+	require.Equal(t, content, data)
+	require.Equal(t, strings.TrimPrefix(sha256Digest(content), "sha256:"), resp.Header.Get("X-Hermit-Expected-Sha256"))
+
+	// The artifact has two layers, so one must be selected.
+	resp, err = client.Get("oci://" + reg.host + "/hermit/tools:1.0")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	// Other schemes are passed through.
+	resp, err = client.Get(reg.URL + "/v2/hermit/tools/manifests/1.0")
+	require.NoError(t, err)
+	_ = resp.Body.Close()
+	require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	// The token is reused for subsequent requests.
+	require.Equal(t, []string{"user:pass repository:hermit/tools:pull"}, reg.tokenRequests)
+}
+
+func TestTransportVerifiesDigest(t *testing.T) {
+	reg := newTestRegistry(t, map[string][]byte{"tool": []byte("original")})
+	for digest := range reg.blobs {
+		reg.blobs[digest] = []byte("tampered")
+	}
+	client := New(http.DefaultClient, WithCredentials(staticCredentials)).Wrap(http.DefaultClient)
+	resp, err := client.Get("oci://" + reg.host + "/hermit/tools:1.0")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	_, err = io.ReadAll(resp.Body)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "digest mismatch")
+}
+
+func TestManifestVerifiesPinnedDigest(t *testing.T) {
+	reg := newTestRegistry(t, map[string][]byte{"tool": []byte("tool")})
+	client := New(http.DefaultClient, WithCredentials(staticCredentials))
+
+	ref, err := ParseReference("oci://" + reg.host + "/hermit/tools@" + sha256Digest(reg.manifest))
+	require.NoError(t, err)
+	manifest, err := client.Manifest(context.Background(), ref)
+	require.NoError(t, err)
+	require.Equal(t, sha256Digest(reg.manifest), manifest.Digest)
+
+	// The registry serves the same manifest regardless of the digest requested.
+	ref.Digest = sha256Digest([]byte("other"))
+	_, err = client.Manifest(context.Background(), ref)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "manifest digest is")
+}
+
+func TestBackendSync(t *testing.T) {
+	buf := &bytes.Buffer{}
+	zw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(zw)
+	for name, content := range map[string]string{"manifests/jq.hcl": "jq", "manifests/README.md": "readme"} {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: int64(len(content)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write([]byte(content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, zw.Close())
+	reg := newTestRegistry(t, map[string][]byte{
+		"protoc.hcl":         []byte("protoc"),
+		"manifests.tar.gz":   buf.Bytes(),
+		"not-a-manifest.txt": []byte("text"),
+	})
+	backend := New(http.DefaultClient, WithCredentials(staticCredentials)).Backend()
+
+	uri, err := url.Parse("oci://" + reg.host + "/hermit/tools:1.0")
+	require.NoError(t, err)
+	sourcesDir := t.TempDir()
+	dir, err := backend.Resolve(uri, sourcesDir)
+	require.NoError(t, err)
+	p, _ := ui.NewForTesting()
+	require.NoError(t, backend.Sync(p.Task("oci"), uri, dir))
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := []string{}
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.Equal(t, []string{"jq.hcl", "protoc.hcl"}, names)
+	data, err := os.ReadFile(filepath.Join(dir, "jq.hcl"))
+	require.NoError(t, err)
+	require.Equal(t, "jq", string(data))
+}
+
+func TestDockerCredentials(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(`{
+		"auths": {
+			"https://registry.example.com/v1/": {"auth": "dXNlcjpwYXNz"},
+			"invalid.example.com": {"auth": "dXNlcg=="}
+		}
+	}`), 0600)
+	require.NoError(t, err)
+
+	creds, err := dockerCredentials(dir, "registry.example.com")
+	require.NoError(t, err)
+	require.Equal(t, &Credentials{Username: "user", Password: "pass"}, creds)
+
+	_, err = dockerCredentials(dir, "invalid.example.com")
+	require.Error(t, err)
+
+	creds, err = dockerCredentials(dir, "other.example.com")
+	require.NoError(t, err)
+	require.Nil(t, creds)
+
+	creds, err = dockerCredentials(t.TempDir(), "registry.example.com")
+	require.NoError(t, err)
+	require.Nil(t, creds)
+}
@@ -0,0 +1,76 @@
+// Package oci retrieves packages and manifests stored as OCI artifacts
+// (as pushed by eg. ORAS) in an OCI distribution registry.
+package oci
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Reference to an artifact in a registry, in the form
+// "oci://<registry>/<repository>[:<tag>|@<digest>][#<title>]".
+//
+// Title selects a single layer by its "org.opencontainers.image.title"
+// annotation, ie. the file name ORAS records for each pushed file.
+type Reference struct {
+	Registry   string
+	Repository string
+	Tag        string
+	Digest     string
+	Title      string
+}
+
+// ParseReference parses an "oci://" URI.
+func ParseReference(uri string) (Reference, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return Reference{}, errors.WithStack(err)
+	}
+	if u.Scheme != "oci" {
+		return Reference{}, errors.Errorf("%s: not an oci:// URI", uri)
+	}
+	ref := Reference{Registry: u.Host, Title: u.Fragment}
+	repo := strings.Trim(u.Path, "/")
+	if i := strings.Index(repo, "@"); i != -1 {
+		ref.Digest = repo[i+1:]
+		repo = repo[:i]
+		if !strings.HasPrefix(ref.Digest, "sha256:") {
+			return Reference{}, errors.Errorf("%s: unsupported digest %q", uri, ref.Digest)
+		}
+	}
+	if i := strings.LastIndex(repo, ":"); i != -1 && !strings.Contains(repo[i:], "/") {
+		ref.Tag = repo[i+1:]
+		repo = repo[:i]
+	}
+	ref.Repository = repo
+	if ref.Registry == "" || ref.Repository == "" {
+		return Reference{}, errors.Errorf("%s: expected oci://<registry>/<repository>[:<tag>]", uri)
+	}
+	if ref.Tag == "" && ref.Digest == "" {
+		ref.Tag = "latest"
+	}
+	return ref, nil
+}
+
+// Version of the artifact to retrieve: its digest if pinned, otherwise its tag.
+func (r Reference) Version() string {
+	if r.Digest != "" {
+		return r.Digest
+	}
+	return r.Tag
+}
+
+func (r Reference) String() string {
+	out := "oci://" + r.Registry + "/" + r.Repository
+	if r.Digest != "" {
+		out += "@" + r.Digest
+	} else {
+		out += ":" + r.Tag
+	}
+	if r.Title != "" {
+		out += "#" + r.Title
+	}
+	return out
+}
@@ -0,0 +1,95 @@
+package oci
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/cashapp/hermit/cache"
+)
+
+// WithTransport returns a RoundTripper that serves GET and HEAD requests for
+// "oci://" URIs from the referenced artifact layer and passes all other
+// requests through to "transport".
+//
+// Responses carry the layer digest as their ETag, and report it to the
+// cache so that downloads are verified against the OCI descriptor.
+func (c *Client) WithTransport(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &ociTransport{client: c, rt: transport}
+}
+
+// Wrap returns a copy of "client" whose transport is wrapped with WithTransport.
+func (c *Client) Wrap(client *http.Client) *http.Client {
+	out := *client
+	out.Transport = c.WithTransport(client.Transport)
+	return &out
+}
+
+type ociTransport struct {
+	client *Client
+	rt     http.RoundTripper
+}
+
+func (o *ociTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "oci" {
+		return o.rt.RoundTrip(req)
+	}
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return respond(req, http.StatusMethodNotAllowed, nil), nil
+	}
+	ref, err := ParseReference(req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+	manifest, err := o.client.Manifest(req.Context(), ref)
+	if err != nil {
+		return nil, err
+	}
+	layer, err := manifest.Layer(ref.Title)
+	if err != nil {
+		return respond(req, http.StatusNotFound, strings.NewReader(err.Error())), nil
+	}
+	if req.Method == http.MethodHead {
+		resp := respond(req, http.StatusOK, nil)
+		resp.ContentLength = layer.Size
+		resp.Header.Set("Content-Length", strconv.FormatInt(layer.Size, 10))
+		setLayerHeaders(resp, layer)
+		return resp, nil
+	}
+	header := http.Header{}
+	if r := req.Header.Get("Range"); r != "" {
+		header.Set("Range", r)
+	}
+	resp, err := o.client.Blob(req.Context(), ref, layer, header)
+	if err != nil {
+		return nil, err
+	}
+	resp.Request = req
+	setLayerHeaders(resp, layer)
+	return resp, nil
+}
+
+func setLayerHeaders(resp *http.Response, layer Descriptor) {
+	resp.Header.Set("ETag", strconv.Quote(layer.Digest))
+	cache.SetExpectedDigest(resp, layer.Digest)
+}
+
+func respond(req *http.Request, status int, body io.Reader) *http.Response {
+	if body == nil {
+		body = http.NoBody
+	}
+	return &http.Response{
+		Status:     strconv.Itoa(status) + " " + http.StatusText(status),
+		StatusCode: status,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       io.NopCloser(body),
+		Request:    req,
+	}
+}
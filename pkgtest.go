@@ -0,0 +1,126 @@
+package hermit
+
+import (
+	"os"
+	"runtime"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/platform"
+	"github.com/cashapp/hermit/sources"
+	"github.com/cashapp/hermit/ui"
+)
+
+// PlatformTestResult is the result of testing a version of a package on one platform.
+type PlatformTestResult struct {
+	Reference manifest.Reference
+	Platform  platform.Platform
+	// Source the package was downloaded from.
+	Source string
+	// Binaries found in the unpacked package.
+	Binaries []string
+	// Tested is true if the package's test command was run.
+	Tested bool
+	// Err is the reason the package failed, if it did.
+	Err error
+}
+
+// TestManifest downloads, verifies and unpacks every version and channel of the package "name" on every
+// platform it supports, checking that its declared binaries exist.
+//
+// Packages are unpacked into a temporary directory rather than the state directory. On the native platform
+// the package's test command, if any, is also run. Platforms the package has no source for are skipped.
+func (e *Env) TestManifest(l *ui.UI, name string) ([]PlatformTestResult, error) {
+	srcs, err := e.sources(l)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	mnf, err := manifest.NewLoader(srcs).Load(l, name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// Channels that track a version glob use that version's sources, which are tested with the version.
+	refs := make([]manifest.Reference, 0, len(mnf.Versions)+len(mnf.Channels))
+	for _, version := range mnf.GetVersions() {
+		refs = append(refs, manifest.Reference{Name: name, Version: version})
+	}
+	for _, channel := range mnf.Channels {
+		if channel.Version == "" {
+			refs = append(refs, manifest.Reference{Name: name, Channel: channel.Name})
+		}
+	}
+	var results []PlatformTestResult
+	for _, ref := range refs {
+		for _, p := range platform.Core {
+			result, ok := e.testPlatform(l, srcs, ref, p)
+			if ok {
+				results = append(results, result)
+			}
+		}
+	}
+	if len(results) == 0 {
+		return nil, errors.Errorf("%s has no sources on any platform", name)
+	}
+	return results, nil
+}
+
+// Test a version of a package on a platform, returning false if the package has no source for the platform.
+func (e *Env) testPlatform(l *ui.UI, srcs *sources.Sources, ref manifest.Reference, p platform.Platform) (PlatformTestResult, bool) {
+	result := PlatformTestResult{Reference: ref, Platform: p}
+	task := l.Task(ref.String())
+	defer task.Done()
+	dir, err := os.MkdirTemp("", "hermit-manifest-test-")
+	if err != nil {
+		result.Err = errors.WithStack(err)
+		return result, true
+	}
+	defer func() {
+		if err := e.state.RemoveUnpacked(task, dir); err != nil {
+			task.Warnf("%s", err)
+		}
+	}()
+	resolver, err := manifest.New(srcs, manifest.Config{
+		Env:   e.envDir,
+		State: dir,
+		OS:    p.OS,
+		Arch:  p.Arch,
+	})
+	if err != nil {
+		result.Err = errors.WithStack(err)
+		return result, true
+	}
+	pkg, err := resolver.Resolve(l, manifest.ExactSelector(ref))
+	if errors.Is(err, manifest.ErrNoSource) {
+		return result, false
+	} else if err != nil {
+		result.Err = errors.WithStack(err)
+		return result, true
+	}
+	result.Source = pkg.Source
+	if pkg.SHA256 == "" && pkg.SHA256Source == "" {
+		task.Warnf("%s: %s has no sha256 to verify its source against", p, pkg)
+	}
+	task.Infof("Unpacking %s for %s", pkg.Source, p)
+	if err := e.state.Unpack(task, pkg); err != nil {
+		result.Err = errors.WithStack(err)
+		return result, true
+	}
+	result.Binaries, err = pkg.ResolveBinaries()
+	if err != nil {
+		result.Err = errors.WithStack(err)
+		return result, true
+	}
+	if p.OS != runtime.GOOS || p.Arch != runtime.GOARCH || pkg.Test == "" {
+		return result, true
+	}
+	// Run the test command against the package as the environment would install it.
+	native, err := e.Resolve(l, manifest.ExactSelector(ref), false)
+	if err != nil {
+		result.Err = errors.WithStack(err)
+		return result, true
+	}
+	result.Tested = true
+	result.Err = errors.WithStack(e.Test(l, native))
+	return result, true
+}
@@ -1,5 +1,11 @@
 package platform
 
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
 // Amd64 architecture
 const Amd64 = "amd64"
 
@@ -24,6 +30,15 @@ func (p Platform) String() string {
 	return p.OS + "-" + p.Arch
 }
 
+// Parse a platform in the form <os>-<arch>, as produced by Platform.String().
+func Parse(s string) (Platform, error) {
+	parts := strings.SplitN(s, "-", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return Platform{}, errors.Errorf("invalid platform %q, expected <os>-<arch>", s)
+	}
+	return Platform{OS: parts[0], Arch: parts[1]}, nil
+}
+
 // Core platforms officially supported by Hermit.
 //
 // For a package to be considered fully compliant, these platforms need to be supported
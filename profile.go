@@ -0,0 +1,131 @@
+package hermit
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/envars"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+)
+
+// ProfileConfig is a named set of packages and environment variables in an
+// environment, that is only made available when the profile is activated.
+type ProfileConfig struct {
+	Name     string        `hcl:"name,label" help:"Name of the profile, as passed to \"hermit activate --profile\"."`
+	Packages []string      `hcl:"packages,optional" help:"Packages available when the profile is active, eg. \"golangci-lint-1.55\"."`
+	Envars   envars.Envars `hcl:"env,optional" help:"Extra environment variables set when the profile is active."`
+}
+
+// SetProfiles sets the profiles that are active, returning the names that
+// are not profiles of this environment.
+//
+// Profile packages are not linked into the environment. Instead, when the
+// environment is activated their binaries are added to PATH ahead of the
+// environment's, and their environment variables are set.
+func (e *Env) SetProfiles(names []string) (unknown []string) {
+	e.profiles = nil
+	for _, name := range names {
+		if name == "" {
+			continue
+		}
+		if profile := e.profile(name); profile != nil {
+			e.profiles = append(e.profiles, profile)
+		} else {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
+
+// Profiles returns the names of the profiles defined in this environment.
+func (e *Env) Profiles() []string {
+	names := make([]string, 0, len(e.config.Profiles))
+	for _, profile := range e.config.Profiles {
+		names = append(names, profile.Name)
+	}
+	return names
+}
+
+func (e *Env) profile(name string) *ProfileConfig {
+	for _, profile := range e.config.Profiles {
+		if profile.Name == name {
+			return profile
+		}
+	}
+	return nil
+}
+
+// ProfilePackages resolves the packages of the active profiles.
+func (e *Env) ProfilePackages(l *ui.UI) ([]*manifest.Package, error) {
+	var pkgs []*manifest.Package
+	for _, profile := range e.profiles {
+		for _, pkg := range profile.Packages {
+			selector, err := manifest.ParseGlobSelector(pkg)
+			if err != nil {
+				return nil, errors.Wrapf(err, "profile %q", profile.Name)
+			}
+			resolved, err := e.Resolve(l, selector, false)
+			if err != nil {
+				return nil, errors.Wrapf(err, "profile %q", profile.Name)
+			}
+			pkgs = append(pkgs, resolved)
+		}
+	}
+	return pkgs, nil
+}
+
+// EnsureProfilePackages downloads and unpacks the packages of the active profiles if necessary.
+func (e *Env) EnsureProfilePackages(l *ui.UI) error {
+	pkgs, err := e.ProfilePackages(l)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	for _, pkg := range pkgs {
+		if err := pkg.EnsureSupported(); err != nil {
+			return errors.WithStack(err)
+		}
+		task := l.Task(pkg.Reference.String())
+		err := e.state.CacheAndUnpack(task, pkg)
+		task.Done()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+// Returns the environment variable operations for the active profiles.
+func (e *Env) profileEnvarOps(pkgs []*manifest.Package) (envars.Ops, error) {
+	if len(e.profiles) == 0 {
+		return nil, nil
+	}
+	ops := e.envarsForPackages(pkgs...)
+	seen := map[string]bool{}
+	for _, pkg := range pkgs {
+		binaries, err := pkg.ResolveBinaries()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, binary := range binaries {
+			dir := filepath.Dir(binary)
+			if !seen[dir] {
+				seen[dir] = true
+				ops = append(ops, &envars.Prepend{Name: "PATH", Value: dir})
+			}
+		}
+	}
+	names := make([]string, 0, len(e.profiles))
+	merged := envars.Envars{}
+	for _, profile := range e.profiles {
+		names = append(names, profile.Name)
+		for key, value := range profile.Envars {
+			merged[key] = value
+		}
+	}
+	ops = append(ops, envars.Infer(merged.System())...)
+	ops = append(ops, &envars.Set{Name: "HERMIT_PROFILES", Value: strings.Join(names, ",")})
+	return ops, nil
+}
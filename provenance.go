@@ -0,0 +1,143 @@
+package hermit
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/state"
+	"github.com/cashapp/hermit/ui"
+)
+
+// How a package was installed in an environment is recorded in the state
+// database: whether it was requested directly, installed as a dependency of
+// another package, or replaced another version by an upgrade or rollback,
+// along with the manifest it was resolved from and the command that
+// installed it. Why combines these records with inheritance and channel
+// updates to explain why a package is active in an environment.
+
+// Origin explains how a package came to be active in an environment.
+type Origin struct {
+	Package *manifest.Package
+	// Directory of the environment the package is installed in.
+	EnvDir string
+	// True if the package is inherited from a parent environment.
+	Inherited bool
+	// How the package was installed, or nil if that wasn't recorded.
+	Provenance *state.Provenance
+	// References of the active packages whose requirements the package satisfies.
+	RequiredBy []string
+}
+
+// Why explains how the package "name" came to be active in the environment.
+//
+// The first Origin is that of the package itself. If it was installed as a
+// dependency, or upgraded or rolled back from one, it is followed by the
+// Origins of the packages it was installed for, as long as they are still
+// installed.
+func (e *Env) Why(l *ui.UI, name string) ([]*Origin, error) {
+	active, err := e.listActive(l)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	origins := []*Origin{}
+	seen := map[string]bool{}
+	for name != "" && !seen[name] {
+		seen[name] = true
+		origin, err := e.origin(l, name, active)
+		if err != nil {
+			return nil, err
+		}
+		if origin == nil {
+			break
+		}
+		origins = append(origins, origin)
+		name = ""
+		if origin.Provenance != nil && origin.Provenance.RequiredBy != "" {
+			name = manifest.ParseReference(origin.Provenance.RequiredBy).Name
+		}
+	}
+	if len(origins) == 0 {
+		return nil, errors.Errorf("no installed package '%s' found", name)
+	}
+	return origins, nil
+}
+
+// Find the installed package "name" in this environment or those it inherits from, or nil.
+func (e *Env) origin(l *ui.UI, name string, active []*manifest.Package) (*Origin, error) {
+	for env := e; env != nil; env = env.parent {
+		refs, err := env.ListInstalledReferences()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, ref := range refs {
+			if ref.Name != name {
+				continue
+			}
+			pkg, err := env.Resolve(l, manifest.ExactSelector(ref), false)
+			if err != nil {
+				// The installed version may no longer be in the manifests.
+				pkg = &manifest.Package{Reference: ref}
+			}
+			provenance, err := e.state.Provenance(pkg, env.binDir)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			return &Origin{
+				Package:    pkg,
+				EnvDir:     env.envDir,
+				Inherited:  env != e,
+				Provenance: provenance,
+				RequiredBy: requiredBy(pkg, active),
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// The package "pkg" was recorded as installed for, if any, so that upgrades and rollbacks of dependencies can keep it.
+func (e *Env) recordedDependent(pkg *manifest.Package) string {
+	provenance, err := e.state.Provenance(pkg, e.binDir)
+	if err != nil || provenance == nil {
+		return ""
+	}
+	return provenance.RequiredBy
+}
+
+// References of the packages in "pkgs" with a requirement that "pkg" satisfies.
+func requiredBy(pkg *manifest.Package, pkgs []*manifest.Package) []string {
+	out := []string{}
+	for _, dependent := range pkgs {
+		for _, req := range dependent.Requires {
+			if satisfiesRequirement(pkg, req) {
+				out = append(out, dependent.Reference.String())
+				break
+			}
+		}
+	}
+	return out
+}
+
+func satisfiesRequirement(pkg *manifest.Package, req string) bool {
+	for _, provided := range pkg.Provides {
+		if provided == req {
+			return true
+		}
+	}
+	selector, err := manifest.ParseGlobSelector(req)
+	return err == nil && selector.Matches(pkg.Reference)
+}
+
+// Record how "pkg" was installed, for Why.
+func (e *Env) recordProvenance(l *ui.UI, pkg *manifest.Package, provenance state.Provenance) {
+	provenance.Manifest = pkg.Manifest
+	provenance.Command = strings.Join(append([]string{filepath.Base(os.Args[0])}, os.Args[1:]...), " ")
+	provenance.Time = time.Now().UTC()
+	if err := e.state.RecordProvenance(pkg, e.binDir, provenance); err != nil {
+		l.Warnf("Failed to record how %s was installed: %s", pkg, err)
+	}
+}
@@ -0,0 +1,82 @@
+package hermit_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit"
+	"github.com/cashapp/hermit/envars"
+	"github.com/cashapp/hermit/hermittest"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/state"
+)
+
+func TestWhy(t *testing.T) {
+	fixture := hermittest.NewEnvTestFixture(t, nil)
+	defer fixture.Clean()
+	parentDir := fixture.EnvDirs[0]
+	srcDir := filepath.Join(parentDir, "sources")
+	require.NoError(t, os.MkdirAll(srcDir, 0700))
+	for name, requires := range map[string]string{"app": `["lib"]`, "lib": `[]`} {
+		binary := map[string]string{"app": "darwin_exe", "lib": "linux_exe"}[name]
+		err := os.WriteFile(filepath.Join(srcDir, name+".hcl"), []byte(`
+			description = ""
+			binaries = ["`+binary+`"]
+			requires = `+requires+`
+			source = "archive/testdata/archive.tar.gz"
+			version "1.0.0" "1.1.0" {}
+		`), 0600)
+		require.NoError(t, err)
+	}
+	err := os.WriteFile(filepath.Join(parentDir, "bin", "hermit.hcl"), []byte(`sources = ["env:///sources"]`), 0600)
+	require.NoError(t, err)
+	parent, err := hermit.OpenEnv(parentDir, fixture.State, envars.Envars{}, fixture.Server.Client())
+	require.NoError(t, err)
+	app, err := parent.Resolve(fixture.P, manifest.ExactSelector(manifest.ParseReference("app-1.0.0")), false)
+	require.NoError(t, err)
+	lib, err := parent.Resolve(fixture.P, manifest.ExactSelector(manifest.ParseReference("lib-1.0.0")), false)
+	require.NoError(t, err)
+	_, err = parent.InstallDependency(fixture.P, lib, app)
+	require.NoError(t, err)
+	_, err = parent.Install(fixture.P, app)
+	require.NoError(t, err)
+
+	origins, err := parent.Why(fixture.P, "lib")
+	require.NoError(t, err)
+	require.Len(t, origins, 2)
+	require.Equal(t, "lib-1.0.0", origins[0].Package.Reference.String())
+	require.False(t, origins[0].Inherited)
+	require.Equal(t, state.ProvenanceDependency, origins[0].Provenance.Reason)
+	require.Equal(t, "app-1.0.0", origins[0].Provenance.RequiredBy)
+	require.Equal(t, []string{"app-1.0.0"}, origins[0].RequiredBy)
+	require.Contains(t, origins[0].Provenance.Manifest, "lib.hcl")
+	require.NotEmpty(t, origins[0].Provenance.Command)
+	require.Equal(t, "app-1.0.0", origins[1].Package.Reference.String())
+	require.Equal(t, state.ProvenanceDirect, origins[1].Provenance.Reason)
+
+	_, err = parent.Upgrade(fixture.P, lib)
+	require.NoError(t, err)
+
+	childDir := filepath.Join(parentDir, "child")
+	require.NoError(t, os.Mkdir(childDir, 0700))
+	err = hermit.Init(fixture.P, childDir, "", fixture.State.Root(), hermit.Config{Inherit: ".."})
+	require.NoError(t, err)
+	child, err := hermit.OpenEnv(childDir, fixture.State, envars.Envars{}, fixture.Server.Client())
+	require.NoError(t, err)
+	origins, err = child.Why(fixture.P, "lib")
+	require.NoError(t, err)
+	require.Len(t, origins, 2)
+	require.Equal(t, "lib-1.1.0", origins[0].Package.Reference.String())
+	require.True(t, origins[0].Inherited)
+	require.Equal(t, parentDir, origins[0].EnvDir)
+	require.Equal(t, state.ProvenanceUpgrade, origins[0].Provenance.Reason)
+	require.Equal(t, "lib-1.0.0", origins[0].Provenance.Replaced)
+	require.Equal(t, "app-1.0.0", origins[0].Provenance.RequiredBy)
+	require.True(t, origins[1].Inherited)
+
+	_, err = child.Why(fixture.P, "missing")
+	require.EqualError(t, err, "no installed package 'missing' found")
+}
@@ -0,0 +1,274 @@
+// Package retry retries network operations that fail transiently, eg. due to
+// flaky proxies, backing off exponentially with jitter between attempts.
+package retry
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultPolicy is used unless configured otherwise.
+var DefaultPolicy = Policy{
+	Attempts:   3,
+	MinBackoff: 500 * time.Millisecond,
+	MaxBackoff: 10 * time.Second,
+	StatusCodes: []int{
+		http.StatusRequestTimeout, http.StatusTooManyRequests, http.StatusInternalServerError,
+		http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout,
+	},
+}
+
+// Policy for retrying operations.
+type Policy struct {
+	// Maximum number of attempts, including the first. One or less disables retries.
+	Attempts int
+	// Delay before the first retry, which doubles with each subsequent retry.
+	MinBackoff time.Duration
+	// Maximum delay between attempts, including delays requested with Retry-After.
+	MaxBackoff time.Duration
+	// HTTP response statuses that are retried.
+	StatusCodes []int
+}
+
+// Validate returns an error if the policy is invalid.
+func (p Policy) Validate() error {
+	if p.MinBackoff < 0 || p.MaxBackoff < 0 {
+		return errors.Errorf("backoff must not be negative")
+	}
+	if p.MinBackoff > p.MaxBackoff {
+		return errors.Errorf("min backoff %s is greater than max backoff %s", p.MinBackoff, p.MaxBackoff)
+	}
+	for _, code := range p.StatusCodes {
+		if code < 100 || code > 599 {
+			return errors.Errorf("invalid HTTP status code %d", code)
+		}
+	}
+	return nil
+}
+
+// Retryable returns true if responses with the HTTP status "code" are retried.
+func (p Policy) Retryable(code int) bool {
+	for _, retryable := range p.StatusCodes {
+		if code == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+// Backoff returns the delay before retry "attempt" (0 based).
+//
+// The delay doubles with each attempt up to MaxBackoff, with "equal jitter"
+// applied: half of the delay is fixed and the other half is "random", which
+// must be in the range [0, 1).
+func (p Policy) Backoff(attempt int, random float64) time.Duration {
+	delay := p.MinBackoff << uint(attempt)
+	if delay > p.MaxBackoff || delay <= 0 {
+		delay = p.MaxBackoff
+	}
+	half := delay / 2
+	return half + time.Duration(random*float64(half))
+}
+
+// Retrier retries operations according to a Policy.
+//
+// The policy may be changed at any time with SetPolicy, and applies to all
+// transports wrapped by WithTransport. A nil Retrier never retries.
+type Retrier struct {
+	lock   sync.RWMutex
+	policy Policy
+	// Overridable for tests.
+	after func(d time.Duration) <-chan time.Time
+	rand  func() float64
+}
+
+// New creates a Retrier using "policy".
+func New(policy Policy) *Retrier {
+	return &Retrier{
+		policy: policy,
+		after:  time.After,
+		rand:   rand.Float64, // nolint: gosec
+	}
+}
+
+// SetPolicy replaces the policy.
+func (r *Retrier) SetPolicy(policy Policy) error {
+	if err := policy.Validate(); err != nil {
+		return err
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.policy = policy
+	return nil
+}
+
+// Policy returns the current policy.
+func (r *Retrier) Policy() Policy {
+	if r == nil {
+		return Policy{Attempts: 1}
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.policy
+}
+
+type permanentError struct{ error }
+
+func (p permanentError) Unwrap() error { return p.error }
+
+// Permanent marks "err" as not worth retrying.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err}
+}
+
+// Do calls fn until it succeeds or the policy's attempts are exhausted,
+// returning the last error.
+//
+// Errors marked with Permanent, and cancellation of ctx, are not retried.
+func (r *Retrier) Do(ctx context.Context, fn func() error) error {
+	policy := r.Policy()
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+		var perr permanentError
+		if errors.As(err, &perr) {
+			return perr.error
+		}
+		if attempt+1 >= policy.Attempts || ctx.Err() != nil {
+			return err
+		}
+		if err := r.sleep(ctx, policy.Backoff(attempt, r.rand())); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *Retrier) sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-r.after(d):
+		return nil
+	case <-ctx.Done():
+		return errors.WithStack(ctx.Err())
+	}
+}
+
+// WithTransport returns a HTTP transport that retries requests sent via
+// "transport", or http.DefaultTransport if nil, that fail with a transient
+// network error or a retryable status.
+//
+// Only idempotent requests are retried, ie. those with an idempotent method
+// or that opt in with an Idempotency-Key header, as net/http does. Requests
+// with bodies are also only retried if their body can be recreated with
+// GetBody, which is the case for bodies created from bytes or strings.
+func (r *Retrier) WithTransport(transport http.RoundTripper) http.RoundTripper {
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	return &retryTransport{retrier: r, rt: transport}
+}
+
+// Wrap returns a copy of client whose transport is wrapped with WithTransport.
+func (r *Retrier) Wrap(client *http.Client) *http.Client {
+	out := *client
+	out.Transport = r.WithTransport(client.Transport)
+	return &out
+}
+
+type retryTransport struct {
+	retrier *Retrier
+	rt      http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy := t.retrier.Policy()
+	if !idempotent(req) || (req.Body != nil && req.Body != http.NoBody && req.GetBody == nil) {
+		return t.rt.RoundTrip(req)
+	}
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			attemptReq = req.Clone(req.Context())
+			attemptReq.Body = body
+		}
+		resp, err := t.rt.RoundTrip(attemptReq)
+		last := attempt+1 >= policy.Attempts || req.Context().Err() != nil
+		var delay time.Duration
+		switch {
+		case err != nil:
+			if last || !Transient(err) {
+				return nil, err
+			}
+			delay = policy.Backoff(attempt, t.retrier.rand())
+		case policy.Retryable(resp.StatusCode) && !last:
+			delay = retryAfter(resp, policy.MaxBackoff)
+			if delay < 0 {
+				delay = policy.Backoff(attempt, t.retrier.rand())
+			}
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+			resp.Body.Close()
+		default:
+			return resp, nil
+		}
+		if err := t.retrier.sleep(req.Context(), delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Returns true if "req" can be sent more than once without further side effects.
+func idempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	_, hasKey := req.Header["Idempotency-Key"]
+	_, hasXKey := req.Header["X-Idempotency-Key"]
+	return hasKey || hasXKey
+}
+
+// Returns the delay requested by a Retry-After header in seconds, capped at "max", or -1 if there is none.
+func retryAfter(resp *http.Response, max time.Duration) time.Duration {
+	seconds, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || seconds < 0 {
+		return -1
+	}
+	delay := time.Duration(seconds) * time.Second
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// Transient returns true if "err" is a network failure worth retrying.
+//
+// Timeouts, reset or refused connections and connections closed mid-response
+// are transient, but eg. malformed requests, TLS errors or cancellation are not.
+func Transient(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var nerr net.Error
+	if errors.As(err, &nerr) && nerr.Timeout() {
+		return true
+	}
+	return errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF)
+}
@@ -0,0 +1,129 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// Returns a Retrier that records delays instead of sleeping.
+func testRetrier(policy Policy) (*Retrier, *[]time.Duration) {
+	delays := []time.Duration{}
+	r := New(policy)
+	r.rand = func() float64 { return 0.5 }
+	r.after = func(d time.Duration) <-chan time.Time {
+		delays = append(delays, d)
+		ch := make(chan time.Time, 1)
+		ch <- time.Time{}
+		return ch
+	}
+	return r, &delays
+}
+
+func TestBackoff(t *testing.T) {
+	policy := Policy{MinBackoff: time.Second, MaxBackoff: 5 * time.Second}
+	require.Equal(t, 500*time.Millisecond, policy.Backoff(0, 0))
+	require.Equal(t, 1500*time.Millisecond, policy.Backoff(1, 0.5))
+	require.Equal(t, 3750*time.Millisecond, policy.Backoff(3, 0.5))
+	require.Equal(t, 2500*time.Millisecond, policy.Backoff(62, 0))
+}
+
+func TestDo(t *testing.T) {
+	r, delays := testRetrier(Policy{Attempts: 3, MinBackoff: time.Second, MaxBackoff: 10 * time.Second})
+	calls := 0
+	err := r.Do(context.Background(), func() error {
+		calls++
+		return errors.New("flaky")
+	})
+	require.EqualError(t, err, "flaky")
+	require.Equal(t, 3, calls)
+	require.Equal(t, []time.Duration{750 * time.Millisecond, 1500 * time.Millisecond}, *delays)
+
+	calls = 0
+	err = r.Do(context.Background(), func() error {
+		calls++
+		return Permanent(errors.New("denied"))
+	})
+	require.EqualError(t, err, "denied")
+	require.Equal(t, 1, calls)
+
+	calls = 0
+	err = (*Retrier)(nil).Do(context.Background(), func() error {
+		calls++
+		return errors.New("flaky")
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, calls)
+}
+
+func TestTransport(t *testing.T) {
+	statuses := []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}
+	bodies := []string{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		status := statuses[0]
+		statuses = statuses[1:]
+		if status == http.StatusServiceUnavailable {
+			w.Header().Set("Retry-After", "3")
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	r, delays := testRetrier(Policy{Attempts: 3, MinBackoff: time.Second, MaxBackoff: 10 * time.Second, StatusCodes: []int{502, 503}})
+	client := r.Wrap(srv.Client())
+	req, err := http.NewRequest(http.MethodPut, srv.URL, strings.NewReader("body")) // nolint: noctx
+	require.NoError(t, err)
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Equal(t, []string{"body", "body", "body"}, bodies)
+	require.Equal(t, []time.Duration{3 * time.Second, 1500 * time.Millisecond}, *delays)
+
+	// Non-idempotent requests are only retried if they opt in.
+	statuses = []int{http.StatusBadGateway, http.StatusOK}
+	resp, err = client.Post(srv.URL, "text/plain", strings.NewReader("body")) // nolint: noctx
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	require.Equal(t, []int{http.StatusOK}, statuses)
+
+	statuses = []int{http.StatusBadGateway, http.StatusOK}
+	req, err = http.NewRequest(http.MethodPost, srv.URL, strings.NewReader("body")) // nolint: noctx
+	require.NoError(t, err)
+	req.Header.Set("Idempotency-Key", "key")
+	resp, err = client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.Empty(t, statuses)
+
+	// Attempts are exhausted, so the last response is returned.
+	statuses = []int{http.StatusBadGateway, http.StatusBadGateway}
+	require.NoError(t, r.SetPolicy(Policy{Attempts: 2, StatusCodes: []int{502}}))
+	resp, err = client.Get(srv.URL) // nolint: noctx
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, http.StatusBadGateway, resp.StatusCode)
+	require.Empty(t, statuses)
+
+	require.Error(t, r.SetPolicy(Policy{MinBackoff: time.Minute, MaxBackoff: time.Second}))
+	require.Error(t, r.SetPolicy(Policy{StatusCodes: []int{1000}}))
+}
+
+func TestTransient(t *testing.T) {
+	require.True(t, Transient(errors.WithStack(syscall.ECONNRESET)))
+	require.True(t, Transient(io.ErrUnexpectedEOF))
+	require.False(t, Transient(context.Canceled))
+	require.False(t, Transient(errors.New("x509: certificate signed by unknown authority")))
+}
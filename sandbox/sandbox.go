@@ -0,0 +1,134 @@
+// Package sandbox runs commands that may only write within a set of
+// directories, using the sandboxing mechanisms of the OS: sandbox-exec on
+// macOS, and user and mount namespaces on Linux.
+package sandbox
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrUnsupported is returned when commands can't be sandboxed on this platform.
+var ErrUnsupported = errors.New("sandboxing is not supported")
+
+// ErrUnavailable is returned when the sandbox could not be set up, eg. because user namespaces are disabled.
+var ErrUnavailable = errors.New("the sandbox is unavailable")
+
+// Set by Init.
+var initialised = false
+
+// Set by AllowUnconfined.
+var unconfinedAllowed = false
+
+// Environment variable passing the sandbox to Init in the sandboxed process, on platforms that use it.
+const initEnvar = "HERMIT_SANDBOX_INIT"
+
+// Policy describes what a sandboxed command may do.
+type Policy struct {
+	// Files and directories the command may write to. Paths that don't exist are ignored.
+	Writable []string
+}
+
+// ViolationError is returned when a sandboxed command fails after the sandbox denied it a write.
+type ViolationError struct {
+	Err error
+	// Writable paths of the policy.
+	Writable []string
+	// Lines of the command's standard error reporting the denied writes.
+	Denied []string
+}
+
+func (v *ViolationError) Error() string {
+	return fmt.Sprintf("%s: denied writing outside of %s:\n  %s", v.Err, strings.Join(v.Writable, ", "), strings.Join(v.Denied, "\n  "))
+}
+
+func (v *ViolationError) Unwrap() error { return v.Err }
+
+// Init must be called at the start of main by programs that sandbox commands.
+//
+// On Linux commands are sandboxed by executing the program again in new
+// namespaces, where Init confines the process before executing the command.
+// Otherwise Init does nothing.
+func Init() {
+	initialised = true
+	if config, ok := os.LookupEnv(initEnvar); ok {
+		enter(config)
+	}
+}
+
+// AllowUnconfined sets whether commands that can't be sandboxed on this
+// system may be run unconfined by callers of Output, rather than failing.
+// Package install actions that aren't restricted to the package are also
+// only applied if this is allowed.
+//
+// Defaults to false.
+func AllowUnconfined(allow bool) {
+	unconfinedAllowed = allow
+}
+
+// UnconfinedAllowed returns true if commands that can't be sandboxed may be run unconfined.
+func UnconfinedAllowed() bool {
+	return unconfinedAllowed
+}
+
+// Output runs "cmd" confined by the policy and returns its standard output, as exec.Cmd.Output does.
+//
+// "cmd" must not have been started and must not set Stderr, which is used to report violations.
+// ErrUnsupported or ErrUnavailable are returned without running "cmd" if it can't be sandboxed.
+func (p Policy) Output(cmd *exec.Cmd) ([]byte, error) {
+	if !initialised {
+		return nil, errors.Wrap(ErrUnsupported, "sandbox.Init was not called")
+	}
+	writable := p.writable()
+	sandboxed, err := command(cmd, writable)
+	if err != nil {
+		return nil, err
+	}
+	out, err := sandboxed.Output()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if reason, ok := initFailure(exitErr); ok {
+			return nil, errors.Wrap(ErrUnavailable, reason)
+		}
+		if denied := deniedLines(exitErr.Stderr); len(denied) > 0 {
+			return out, &ViolationError{Err: err, Writable: writable, Denied: denied}
+		}
+		return out, errors.WithStack(err)
+	} else if err != nil {
+		return nil, errors.Wrap(ErrUnavailable, err.Error())
+	}
+	return out, nil
+}
+
+// Absolute paths of the writable files and directories, with symlinks resolved, as the OS checks them.
+func (p Policy) writable() []string {
+	out := make([]string, 0, len(p.Writable))
+	for _, path := range p.Writable {
+		path, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(path); err == nil {
+			path = resolved
+		}
+		out = append(out, path)
+	}
+	return out
+}
+
+// Lines in the standard error of a command reporting that the sandbox denied writes.
+func deniedLines(stderr []byte) []string {
+	out := []string{}
+	for _, line := range bytes.Split(stderr, []byte("\n")) {
+		if bytes.Contains(line, []byte(deniedMessage)) {
+			out = append(out, string(bytes.TrimSpace(line)))
+		}
+	}
+	return out
+}
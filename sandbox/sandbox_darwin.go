@@ -0,0 +1,59 @@
+package sandbox
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// On macOS commands are executed by sandbox-exec, with a profile that denies
+// writes outside of the writable paths. Denied writes fail with EPERM.
+
+const deniedMessage = "Operation not permitted"
+
+const sandboxExec = "/usr/bin/sandbox-exec"
+
+// Paths that commands may always write to, as they aren't regular files.
+var unconfined = []string{"/dev"}
+
+func command(cmd *exec.Cmd, writable []string) (*exec.Cmd, error) {
+	if _, err := os.Stat(sandboxExec); err != nil {
+		return nil, errors.Wrap(ErrUnavailable, err.Error())
+	}
+	profile := &strings.Builder{}
+	fmt.Fprintln(profile, "(version 1)")
+	fmt.Fprintln(profile, "(allow default)")
+	fmt.Fprintln(profile, "(deny file-write*)")
+	fmt.Fprint(profile, "(allow file-write*")
+	for _, path := range append(writable, unconfined...) {
+		fmt.Fprintf(profile, " (subpath %s)", profileString(path))
+	}
+	fmt.Fprintln(profile, ")")
+	return &exec.Cmd{
+		Path:   sandboxExec,
+		Args:   append([]string{sandboxExec, "-p", profile.String(), cmd.Path}, cmd.Args[1:]...),
+		Env:    cmd.Env,
+		Dir:    cmd.Dir,
+		Stdin:  cmd.Stdin,
+		Stdout: cmd.Stdout,
+	}, nil
+}
+
+// sandbox-exec reports failing to apply the profile before executing the command.
+func initFailure(err *exec.ExitError) (string, bool) {
+	stderr := string(err.Stderr)
+	if !strings.HasPrefix(stderr, "sandbox-exec: ") {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(stderr, "sandbox-exec: ")), true
+}
+
+func enter(string) {}
+
+// Quote a string in the sandbox profile language.
+func profileString(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
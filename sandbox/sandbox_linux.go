@@ -0,0 +1,235 @@
+package sandbox
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/sys/unix"
+)
+
+// On Linux the program executes itself in new user and mount namespaces,
+// where Init bind mounts the writable paths onto themselves, remounts
+// everything else read-only, and drops the capabilities that would allow the
+// command to undo that before executing it. Denied writes fail with EROFS.
+
+const deniedMessage = "Read-only file system"
+
+// Exit status and message prefix of the sandboxed process if Init can't confine it.
+const (
+	initFailedStatus = 125
+	initFailedPrefix = "hermit sandbox: "
+)
+
+// Mounts that are left as they are, as their contents aren't regular files.
+var unconfined = []string{"/dev", "/proc", "/sys"}
+
+type initConfig struct {
+	Path     string   `json:"path"`
+	Dir      string   `json:"dir"`
+	Writable []string `json:"writable"`
+}
+
+func command(cmd *exec.Cmd, writable []string) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, errors.Wrap(ErrUnavailable, err.Error())
+	}
+	dir := cmd.Dir
+	if dir == "" {
+		if dir, err = os.Getwd(); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	if dir, err = filepath.Abs(dir); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	config, err := json.Marshal(initConfig{Path: cmd.Path, Dir: dir, Writable: writable})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	env := cmd.Env
+	if env == nil {
+		env = os.Environ()
+	}
+	uid, gid := os.Getuid(), os.Getgid()
+	return &exec.Cmd{
+		Path:   self,
+		Args:   cmd.Args,
+		Env:    append(env[:len(env):len(env)], initEnvar+"="+string(config)),
+		Dir:    dir,
+		Stdin:  cmd.Stdin,
+		Stdout: cmd.Stdout,
+		SysProcAttr: &syscall.SysProcAttr{
+			Cloneflags:                 syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS,
+			UidMappings:                []syscall.SysProcIDMap{{ContainerID: uid, HostID: uid, Size: 1}},
+			GidMappings:                []syscall.SysProcIDMap{{ContainerID: gid, HostID: gid, Size: 1}},
+			GidMappingsEnableSetgroups: false,
+			AmbientCaps:                []uintptr{unix.CAP_SYS_ADMIN, unix.CAP_SETPCAP},
+		},
+	}, nil
+}
+
+func initFailure(err *exec.ExitError) (string, bool) {
+	if err.ExitCode() != initFailedStatus || !bytes.HasPrefix(err.Stderr, []byte(initFailedPrefix)) {
+		return "", false
+	}
+	return strings.TrimSpace(strings.TrimPrefix(string(err.Stderr), initFailedPrefix)), true
+}
+
+// Confine the process, then execute the sandboxed command in its place.
+func enter(encoded string) {
+	// Capabilities are per thread, so they must be dropped by the thread that executes the command.
+	runtime.LockOSThread()
+	config := initConfig{}
+	if err := json.Unmarshal([]byte(encoded), &config); err != nil {
+		initFailed(errors.Wrapf(err, "invalid %s", initEnvar))
+	}
+	if err := confine(config.Writable); err != nil {
+		initFailed(err)
+	}
+	// The working directory may have been replaced by a bind mount.
+	if err := os.Chdir(config.Dir); err != nil {
+		initFailed(err)
+	}
+	env := []string{}
+	for _, envar := range os.Environ() {
+		if !strings.HasPrefix(envar, initEnvar+"=") {
+			env = append(env, envar)
+		}
+	}
+	err := syscall.Exec(config.Path, os.Args, env)
+	fmt.Fprintf(os.Stderr, "%s: %s\n", config.Path, err)
+	os.Exit(127)
+}
+
+func initFailed(err error) {
+	fmt.Fprintf(os.Stderr, "%s%s\n", initFailedPrefix, err)
+	os.Exit(initFailedStatus)
+}
+
+func confine(writable []string) error {
+	// Don't propagate the changes back to the parent namespace.
+	if err := syscall.Mount("", "/", "", syscall.MS_REC|syscall.MS_PRIVATE, ""); err != nil {
+		return errors.Wrap(err, "could not make mounts private")
+	}
+	for _, path := range writable {
+		if err := syscall.Mount(path, path, "", syscall.MS_BIND|syscall.MS_REC, ""); os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "could not bind mount %s", path)
+		}
+	}
+	mounts, err := readMounts()
+	if err != nil {
+		return err
+	}
+	skipped := append(append([]string{}, writable...), unconfined...)
+next:
+	for _, m := range mounts {
+		for _, dir := range skipped {
+			if within(m.point, dir) {
+				continue next
+			}
+		}
+		// Flags locked by the parent namespace must be kept when remounting.
+		flags := syscall.MS_BIND | syscall.MS_REMOUNT | syscall.MS_RDONLY | m.flags
+		if err := syscall.Mount("", m.point, "", uintptr(flags), ""); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "could not remount %s read-only", m.point)
+		}
+	}
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return errors.Wrap(err, "could not set no_new_privs")
+	}
+	for capability := 0; ; capability++ {
+		err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(capability), 0, 0, 0)
+		if errors.Is(err, unix.EINVAL) {
+			break
+		} else if err != nil {
+			return errors.Wrapf(err, "could not drop capability %d", capability)
+		}
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return errors.Wrap(err, "could not clear ambient capabilities")
+	}
+	// Otherwise a command executed as root in the namespace would inherit them.
+	header := unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}
+	data := [2]unix.CapUserData{}
+	if err := unix.Capget(&header, &data[0]); err != nil {
+		return errors.Wrap(err, "could not get capabilities")
+	}
+	data[0].Inheritable, data[1].Inheritable = 0, 0
+	return errors.Wrap(unix.Capset(&header, &data[0]), "could not clear inheritable capabilities")
+}
+
+type mount struct {
+	point string
+	flags int
+}
+
+// Per-mount options from /proc/self/mountinfo, and their mount flags.
+var mountOptions = map[string]int{
+	"nosuid":     syscall.MS_NOSUID,
+	"nodev":      syscall.MS_NODEV,
+	"noexec":     syscall.MS_NOEXEC,
+	"noatime":    syscall.MS_NOATIME,
+	"nodiratime": syscall.MS_NODIRATIME,
+	"relatime":   syscall.MS_RELATIME,
+}
+
+func readMounts() ([]mount, error) {
+	r, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer r.Close()
+	out := []mount{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw,errors=continue
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 {
+			continue
+		}
+		m := mount{point: unescapeMountPoint(fields[4])}
+		for _, option := range strings.Split(fields[5], ",") {
+			m.flags |= mountOptions[option]
+		}
+		out = append(out, m)
+	}
+	return out, errors.WithStack(scanner.Err())
+}
+
+// Mount points in mountinfo escape spaces, tabs, newlines and backslashes as octal, eg. "\040".
+func unescapeMountPoint(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	out := &strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+4 <= len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				out.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		out.WriteByte(s[i])
+	}
+	return out.String()
+}
+
+// Returns true if "path" is "dir" or within it.
+func within(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
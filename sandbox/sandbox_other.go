@@ -0,0 +1,21 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package sandbox
+
+import (
+	"os/exec"
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+const deniedMessage = ""
+
+func command(*exec.Cmd, []string) (*exec.Cmd, error) {
+	return nil, errors.Wrap(ErrUnsupported, runtime.GOOS)
+}
+
+func initFailure(*exec.ExitError) (string, bool) { return "", false }
+
+func enter(string) {}
@@ -0,0 +1,63 @@
+package sandbox
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMain(m *testing.M) {
+	Init()
+	os.Exit(m.Run())
+}
+
+func sandboxedOutput(t *testing.T, policy Policy, dir, script string) ([]byte, error) {
+	t.Helper()
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("sandboxing is not supported on " + runtime.GOOS)
+	}
+	cmd := exec.Command("/bin/sh", "-c", script)
+	cmd.Dir = dir
+	out, err := policy.Output(cmd)
+	if errors.Is(err, ErrUnavailable) {
+		t.Skip(err.Error())
+	}
+	return out, err
+}
+
+func TestSandboxConfinesWrites(t *testing.T) {
+	dir := t.TempDir()
+	writable := filepath.Join(dir, "writable")
+	denied := filepath.Join(dir, "denied")
+	require.NoError(t, os.Mkdir(writable, 0700))
+	require.NoError(t, os.Mkdir(denied, 0700))
+	policy := Policy{Writable: []string{writable, filepath.Join(dir, "missing")}}
+
+	out, err := sandboxedOutput(t, policy, writable, `echo ok > file && pwd`)
+	require.NoError(t, err)
+	require.Contains(t, string(out), "writable")
+	require.FileExists(t, filepath.Join(writable, "file"))
+
+	_, err = sandboxedOutput(t, policy, dir, `echo ok > writable/other && echo no > denied/file`)
+	violation := &ViolationError{}
+	require.True(t, errors.As(err, &violation), "%v", err)
+	require.Len(t, violation.Denied, 1)
+	require.Contains(t, violation.Denied[0], "denied/file")
+	require.FileExists(t, filepath.Join(writable, "other"))
+	require.NoFileExists(t, filepath.Join(denied, "file"))
+}
+
+func TestSandboxFailure(t *testing.T) {
+	_, err := sandboxedOutput(t, Policy{}, "", `echo failed >&2; exit 3`)
+	require.Error(t, err)
+	violation := &ViolationError{}
+	require.False(t, errors.As(err, &violation))
+	exitErr := &exec.ExitError{}
+	require.True(t, errors.As(err, &exitErr))
+	require.Equal(t, 3, exitErr.ExitCode())
+}
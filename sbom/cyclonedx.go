@@ -0,0 +1,81 @@
+package sbom
+
+import (
+	"time"
+)
+
+type cdxDocument struct {
+	BOMFormat    string         `json:"bomFormat"`
+	SpecVersion  string         `json:"specVersion"`
+	SerialNumber string         `json:"serialNumber"`
+	Version      int            `json:"version"`
+	Metadata     cdxMetadata    `json:"metadata"`
+	Components   []cdxComponent `json:"components"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type               string           `json:"type"`
+	BOMRef             string           `json:"bom-ref,omitempty"`
+	Name               string           `json:"name"`
+	Version            string           `json:"version,omitempty"`
+	Description        string           `json:"description,omitempty"`
+	PURL               string           `json:"purl,omitempty"`
+	Hashes             []cdxHash        `json:"hashes,omitempty"`
+	ExternalReferences []cdxExternalRef `json:"externalReferences,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxExternalRef struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+func cycloneDX(doc Document) *cdxDocument {
+	out := &cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: doc.Created.UTC().Format(time.RFC3339),
+			Tools:     cdxTools{Components: []cdxComponent{{Type: "application", Name: "hermit"}}},
+			Component: cdxComponent{Type: "application", Name: doc.Name},
+		},
+		Components: []cdxComponent{},
+	}
+	for _, pkg := range doc.Packages {
+		component := cdxComponent{
+			Type:        "application",
+			BOMRef:      pkg.Reference.String(),
+			Name:        pkg.Reference.Name,
+			Version:     packageVersion(pkg),
+			Description: pkg.Description,
+			PURL:        purl(pkg),
+		}
+		if pkg.SHA256 != "" {
+			component.Hashes = []cdxHash{{Alg: "SHA-256", Content: pkg.SHA256}}
+		}
+		if pkg.Source != "" {
+			component.ExternalReferences = append(component.ExternalReferences, cdxExternalRef{Type: "distribution", URL: pkg.Source})
+		}
+		if pkg.Homepage != "" {
+			component.ExternalReferences = append(component.ExternalReferences, cdxExternalRef{Type: "website", URL: pkg.Homepage})
+		}
+		out.Components = append(out.Components, component)
+	}
+	return out
+}
@@ -0,0 +1,90 @@
+// Package sbom generates software bills of materials for the packages installed in a Hermit environment.
+package sbom
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+)
+
+// Format of a generated SBOM.
+type Format string
+
+// Supported SBOM formats.
+const (
+	// CycloneDX 1.5 JSON.
+	CycloneDX Format = "cyclonedx"
+	// SPDX 2.3 JSON.
+	SPDX Format = "spdx"
+)
+
+// Formats lists the supported SBOM formats.
+var Formats = []Format{CycloneDX, SPDX}
+
+// Document describes the inventory to generate.
+type Document struct {
+	// Name of the inventory, eg. the environment directory.
+	Name string
+	// Created is the creation time recorded in the document.
+	Created time.Time
+	// Packages to include.
+	Packages manifest.Packages
+}
+
+// Write "doc" to "w" in the given format.
+func Write(w io.Writer, format Format, doc Document) error {
+	var out interface{}
+	switch format {
+	case CycloneDX:
+		out = cycloneDX(doc)
+	case SPDX:
+		out = spdx(doc)
+	default:
+		return errors.Errorf("unsupported SBOM format %q", format)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return errors.WithStack(enc.Encode(out))
+}
+
+// The version of a package, or its channel if it is a channel package.
+func packageVersion(pkg *manifest.Package) string {
+	return pkg.Reference.StringNoName()
+}
+
+// Package URL (https://github.com/package-url/purl-spec) for a Hermit package.
+func purl(pkg *manifest.Package) string {
+	out := "pkg:generic/" + url.PathEscape(pkg.Reference.Name)
+	if version := packageVersion(pkg); version != "" {
+		out += "@" + strings.ReplaceAll(url.PathEscape(version), "@", "%40")
+	}
+	if pkg.Source != "" {
+		out += "?download_url=" + url.QueryEscape(pkg.Source)
+	}
+	return out
+}
+
+// A random RFC 4122 version 4 UUID.
+func newUUID() string {
+	var b [16]byte
+	_, _ = rand.Read(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+var spdxIDInvalidRe = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+// An SPDX element identifier may only contain letters, numbers, "." and "-".
+func spdxID(pkg *manifest.Package) string {
+	return "SPDXRef-Package-" + spdxIDInvalidRe.ReplaceAllString(pkg.Reference.String(), "-")
+}
@@ -0,0 +1,88 @@
+package sbom
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/manifest/manifesttest"
+)
+
+func testDocument() Document {
+	pkg := manifesttest.NewPkgBuilder("/pkg/go-1.21.0").
+		WithName("go").
+		WithVersion("1.21.0").
+		WithSource("https://go.dev/dl/go1.21.0.linux-amd64.tar.gz").
+		Result()
+	pkg.SHA256 = "d0398903a16ba2232b389fb31032ddf57cac34efda306a0eebac34f0965a0742"
+	channel := manifesttest.NewPkgBuilder("/pkg/jq@stable").
+		WithName("jq").
+		WithChannel("stable").
+		WithSource("https://example.com/jq").
+		Result()
+	return Document{
+		Name:     "project",
+		Created:  time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+		Packages: manifest.Packages{pkg, channel},
+	}
+}
+
+func TestCycloneDX(t *testing.T) {
+	w := &bytes.Buffer{}
+	require.NoError(t, Write(w, CycloneDX, testDocument()))
+	doc := &cdxDocument{}
+	require.NoError(t, json.Unmarshal(w.Bytes(), doc))
+	require.Equal(t, "CycloneDX", doc.BOMFormat)
+	require.Regexp(t, `^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, doc.SerialNumber)
+	require.Equal(t, "2023-01-02T03:04:05Z", doc.Metadata.Timestamp)
+	require.Equal(t, []cdxComponent{
+		{
+			Type:    "application",
+			BOMRef:  "go-1.21.0",
+			Name:    "go",
+			Version: "1.21.0",
+			PURL:    "pkg:generic/go@1.21.0?download_url=https%3A%2F%2Fgo.dev%2Fdl%2Fgo1.21.0.linux-amd64.tar.gz",
+			Hashes:  []cdxHash{{Alg: "SHA-256", Content: "d0398903a16ba2232b389fb31032ddf57cac34efda306a0eebac34f0965a0742"}},
+			ExternalReferences: []cdxExternalRef{
+				{Type: "distribution", URL: "https://go.dev/dl/go1.21.0.linux-amd64.tar.gz"},
+			},
+		},
+		{
+			Type:    "application",
+			BOMRef:  "jq@stable",
+			Name:    "jq",
+			Version: "@stable",
+			PURL:    "pkg:generic/jq@%40stable?download_url=https%3A%2F%2Fexample.com%2Fjq",
+			ExternalReferences: []cdxExternalRef{
+				{Type: "distribution", URL: "https://example.com/jq"},
+			},
+		},
+	}, doc.Components)
+}
+
+func TestSPDX(t *testing.T) {
+	w := &bytes.Buffer{}
+	require.NoError(t, Write(w, SPDX, testDocument()))
+	doc := &spdxDocument{}
+	require.NoError(t, json.Unmarshal(w.Bytes(), doc))
+	require.Equal(t, "SPDX-2.3", doc.SPDXVersion)
+	require.Len(t, doc.Packages, 2)
+	require.Equal(t, "SPDXRef-Package-go-1.21.0", doc.Packages[0].SPDXID)
+	require.Equal(t, "https://go.dev/dl/go1.21.0.linux-amd64.tar.gz", doc.Packages[0].DownloadLocation)
+	require.Equal(t, []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: "d0398903a16ba2232b389fb31032ddf57cac34efda306a0eebac34f0965a0742"}}, doc.Packages[0].Checksums)
+	require.Equal(t, "SPDXRef-Package-jq-stable", doc.Packages[1].SPDXID)
+	require.Equal(t, "@stable", doc.Packages[1].VersionInfo)
+	require.Empty(t, doc.Packages[1].Checksums)
+	require.Equal(t, []spdxRelationship{
+		{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Package-go-1.21.0"},
+		{SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Package-jq-stable"},
+	}, doc.Relationships)
+}
+
+func TestUnsupportedFormat(t *testing.T) {
+	require.Error(t, Write(&bytes.Buffer{}, "xml", testDocument()))
+}
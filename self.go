@@ -0,0 +1,122 @@
+package hermit
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+)
+
+// The name of the package Hermit itself is distributed as.
+const hermitPackage = "hermit"
+
+// HermitReference returns the release of Hermit this environment uses, if it
+// overrides the one the bin/hermit script runs.
+//
+// An environment is either pinned to a version with PinHermit, or tracks a
+// release channel selected with SetHermitChannel.
+func (e *Env) HermitReference() (manifest.Reference, bool) {
+	switch {
+	case e.config.HermitVersion != "":
+		return manifest.Reference{Name: hermitPackage, Version: manifest.ParseVersion(e.config.HermitVersion)}, true
+	case e.config.HermitChannel != "":
+		return manifest.Reference{Name: hermitPackage, Channel: e.config.HermitChannel}, true
+	default:
+		return manifest.Reference{}, false
+	}
+}
+
+// HermitExecutable returns the path to the Hermit executable this environment
+// uses, downloading it if necessary, or "" if the environment doesn't override
+// the Hermit executable.
+func (e *Env) HermitExecutable(l *ui.UI) (string, error) {
+	ref, ok := e.HermitReference()
+	if !ok {
+		return "", nil
+	}
+	pkg, err := e.hermitPackage(l, ref)
+	if err != nil {
+		return "", err
+	}
+	return hermitBinary(pkg)
+}
+
+// PinHermit pins this environment to a version of Hermit.
+func (e *Env) PinHermit(l *ui.UI, version string) (*manifest.Package, error) {
+	pkg, err := e.hermitPackage(l, manifest.Reference{Name: hermitPackage, Version: manifest.ParseVersion(version)})
+	if err != nil {
+		return nil, err
+	}
+	e.config.HermitVersion = pkg.Reference.Version.String()
+	e.config.HermitChannel = ""
+	return pkg, e.writeConfig()
+}
+
+// SetHermitChannel switches this environment to track a Hermit release
+// channel, such as "stable" or "canary", removing any version pin.
+//
+// The channel is upgraded to its latest release.
+func (e *Env) SetHermitChannel(l *ui.UI, channel string) (*manifest.Package, error) {
+	pkg, err := e.UpgradeHermitChannel(l, channel)
+	if err != nil {
+		return nil, err
+	}
+	e.config.HermitChannel = channel
+	e.config.HermitVersion = ""
+	return pkg, e.writeConfig()
+}
+
+// UpgradeHermitChannel upgrades a Hermit release channel to its latest release.
+func (e *Env) UpgradeHermitChannel(l *ui.UI, channel string) (*manifest.Package, error) {
+	pkg, err := e.hermitPackage(l, manifest.Reference{Name: hermitPackage, Channel: channel})
+	if err != nil {
+		return nil, err
+	}
+	if err := e.state.UpgradeChannel(l.Task(pkg.Reference.String()), pkg); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return pkg, nil
+}
+
+// Resolve a release of Hermit and make sure it is downloaded.
+//
+// Releases must be signed, so that their signature is verified when they are
+// downloaded, unless signature verification is disabled. A signed checksum
+// file is verified even if the release also has an explicit sha256.
+func (e *Env) hermitPackage(l *ui.UI, ref manifest.Reference) (*manifest.Package, error) {
+	pkg, err := e.Resolve(l, manifest.ExactSelector(ref), true)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if pkg.CosignSignature == "" && pkg.CosignBundle == "" && pkg.SHA256Signature == "" {
+		if !e.state.InsecureSkipVerify() {
+			return nil, errors.Errorf("%s is not signed, use --insecure-skip-verify to use it anyway", pkg)
+		}
+		l.Task(pkg.Reference.String()).Warnf("%s is not signed", pkg)
+	}
+	if err := e.state.CacheAndUnpack(l.Task(pkg.Reference.String()), pkg); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	// Record usage so that the release isn't garbage collected while in use.
+	if err := e.state.WritePackageState(pkg, e.binDir); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return pkg, nil
+}
+
+// Returns the path to the Hermit executable in a Hermit package.
+func hermitBinary(pkg *manifest.Package) (string, error) {
+	binaries, err := pkg.ResolveBinaries()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	for _, binary := range binaries {
+		if strings.TrimSuffix(filepath.Base(binary), ".exe") == hermitPackage {
+			return binary, nil
+		}
+	}
+	return "", errors.Errorf("%s: no hermit executable found", pkg)
+}
@@ -0,0 +1,147 @@
+package hermit_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/hermittest"
+)
+
+func TestPinHermit(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadFile("archive/testdata/archive.tar.gz")
+		_, _ = w.Write(data)
+	})
+	fixture := hermittest.NewEnvTestFixture(t, handler)
+	defer fixture.Clean()
+	fixture.WithManifests(map[string]string{
+		"hermit.hcl": `
+			description = "Hermit"
+			binaries = ["hermit"]
+			on "unpack" {
+			  rename { from = "${root}/linux_exe" to = "${root}/hermit" }
+			}
+			source = "` + fixture.Server.URL + `/hermit-${version}.tar.gz"
+			version "0.38.0" "0.39.0" {}
+			channel "canary" {
+			  update = "24h"
+			  source = "` + fixture.Server.URL + `/canary.tar.gz"
+			}
+		`,
+	})
+	configFile := filepath.Join(fixture.EnvDirs[0], "bin", "hermit.hcl")
+
+	_, ok := fixture.Env.HermitReference()
+	require.False(t, ok)
+	exe, err := fixture.Env.HermitExecutable(fixture.P)
+	require.NoError(t, err)
+	require.Equal(t, "", exe)
+
+	_, err = fixture.Env.PinHermit(fixture.P, "0.38.0")
+	require.EqualError(t, err, "hermit-0.38.0 is not signed, use --insecure-skip-verify to use it anyway")
+
+	fixture.State.SetInsecureSkipVerify(true)
+	pkg, err := fixture.Env.PinHermit(fixture.P, "0.38.0")
+	require.NoError(t, err)
+	require.Equal(t, "hermit-0.38.0", pkg.Reference.String())
+	ref, ok := fixture.Env.HermitReference()
+	require.True(t, ok)
+	require.Equal(t, "hermit-0.38.0", ref.String())
+	exe, err = fixture.Env.HermitExecutable(fixture.P)
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(pkg.Root, "hermit"), exe)
+	require.FileExists(t, exe)
+	config, err := ioutil.ReadFile(configFile)
+	require.NoError(t, err)
+	require.Contains(t, string(config), `hermit-version = "0.38.0"`)
+
+	pkg, err = fixture.Env.SetHermitChannel(fixture.P, "canary")
+	require.NoError(t, err)
+	require.Equal(t, "hermit@canary", pkg.Reference.String())
+	ref, _ = fixture.Env.HermitReference()
+	require.Equal(t, "hermit@canary", ref.String())
+	config, err = ioutil.ReadFile(configFile)
+	require.NoError(t, err)
+	require.Contains(t, string(config), `hermit-channel = "canary"`)
+	require.NotContains(t, string(config), "hermit-version")
+}
+
+func TestPinHermitVerifiesSignedChecksumsWithPinnedSHA256(t *testing.T) {
+	sha := "a5a8c2021836bc43d2f76d1e68fe4e2300a38c98527c260e94603d22333996a5"
+	sums := []byte(sha + "  hermit-0.37.0.tar.gz\n" + sha + "  hermit-0.38.0.tar.gz\n" + strings.Repeat("0", 64) + "  hermit-0.39.0.tar.gz\n")
+	key, sig := minisign(t, sums)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/SHA256SUMS":
+			_, _ = w.Write(sums)
+		case "/SHA256SUMS.minisig":
+			_, _ = w.Write(sig)
+		case "/BADSUMS.minisig":
+			_, _ = w.Write([]byte("garbage"))
+		default:
+			data, _ := ioutil.ReadFile("archive/testdata/archive.tar.gz")
+			_, _ = w.Write(data)
+		}
+	})
+	fixture := hermittest.NewEnvTestFixture(t, handler)
+	defer fixture.Clean()
+	fixture.WithManifests(map[string]string{
+		"hermit.hcl": `
+			description = "Hermit"
+			binaries = ["hermit"]
+			on "unpack" {
+			  rename { from = "${root}/linux_exe" to = "${root}/hermit" }
+			}
+			source = "` + fixture.Server.URL + `/hermit-${version}.tar.gz"
+			sha256 = "` + sha + `"
+			sha256-source = "` + fixture.Server.URL + `/SHA256SUMS"
+			sha256-key = ` + fmt.Sprintf("%q", key) + `
+			version "0.37.0" {
+			  sha256-signature = "` + fixture.Server.URL + `/BADSUMS.minisig"
+			}
+			version "0.38.0" "0.39.0" {
+			  sha256-signature = "` + fixture.Server.URL + `/SHA256SUMS.minisig"
+			}
+		`,
+	})
+
+	// The signature is verified even though the sha256 is pinned.
+	_, err := fixture.Env.PinHermit(fixture.P, "0.37.0")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid minisign signature")
+
+	// As is the pinned sha256 against the signed checksum.
+	_, err = fixture.Env.PinHermit(fixture.P, "0.39.0")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "does not match the signed checksum")
+
+	pkg, err := fixture.Env.PinHermit(fixture.P, "0.38.0")
+	require.NoError(t, err)
+	require.Equal(t, sha, pkg.SHA256)
+}
+
+// Sign "data" in the minisign format, returning the public key and signature file.
+func minisign(t *testing.T, data []byte) (key string, sig []byte) {
+	t.Helper()
+	pk, sk, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keyID := []byte("hermitid")
+	key = "untrusted comment: minisign public key\n" + base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), pk...))
+	signature := ed25519.Sign(sk, data)
+	trusted := "timestamp:1600000000\tfile:SHA256SUMS"
+	global := ed25519.Sign(sk, append(append([]byte{}, signature...), trusted...))
+	sig = []byte(fmt.Sprintf("untrusted comment: signature\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), keyID...), signature...)),
+		trusted,
+		base64.StdEncoding.EncodeToString(global)))
+	return key, sig
+}
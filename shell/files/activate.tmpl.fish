@@ -0,0 +1,69 @@
+# Hermit fish activation script
+
+set -gx HERMIT_ENV {{quote .Root}}
+
+# "return" can't be used outside functions in fish, so the rest of the script is in the "else" branch.
+if set -q ACTIVE_HERMIT; and test "$ACTIVE_HERMIT" = "$HERMIT_ENV"
+  echo "This Hermit environment has already been activated. Skipping" >&2
+else
+  if set -q ACTIVE_HERMIT
+    set -gx HERMIT_CURRENT_ENV $HERMIT_ENV
+    set -gx HERMIT_ENV $ACTIVE_HERMIT
+    deactivate-hermit
+    set -gx HERMIT_ENV $HERMIT_CURRENT_ENV
+    set -e HERMIT_CURRENT_ENV
+  end
+
+  function _hermit_deactivate
+    echo "Hermit environment "($HERMIT_ENV/bin/hermit env HERMIT_ENV)" deactivated"
+    echo $HERMIT_DEACTIVATION | source
+    functions -e deactivate-hermit update_hermit_env
+    set -e ACTIVE_HERMIT
+{{- if .Completions}}
+    if set -l index (contains -i -- {{quote .Completions}}/fish $fish_complete_path)
+      set -e fish_complete_path[$index]
+    end
+{{- end}}
+{{- if ne .Prompt "none"}}
+    if functions -q _hermit_old_fish_prompt
+      functions -e fish_prompt
+      functions -c _hermit_old_fish_prompt fish_prompt
+      functions -e _hermit_old_fish_prompt
+    end
+{{- end}}
+  end
+
+  function deactivate-hermit
+    set -gx DEACTIVATED_HERMIT $HERMIT_ENV
+    _hermit_deactivate
+  end
+
+  set -e DEACTIVATED_HERMIT
+  set -gx ACTIVE_HERMIT $HERMIT_ENV
+  set -gx HERMIT_DEACTIVATION ($HERMIT_ENV/bin/hermit env --deactivate | string collect)
+  set -gx HERMIT_BIN_CHANGE (date -r $HERMIT_ENV/bin +"%s")
+{{- if .Completions}}
+  # Fish loads completions from the path when they're first needed.
+  set -g fish_complete_path {{quote .Completions}}/fish $fish_complete_path
+{{- end}}
+
+{{- if ne .Prompt "none"}}
+  if functions -q fish_prompt; and not functions -q _hermit_old_fish_prompt
+    functions -c fish_prompt _hermit_old_fish_prompt
+    function fish_prompt
+      printf '%s' {{if eq .Prompt "env"}}{{quote .EnvName}}{{end}}'🐚 '
+      _hermit_old_fish_prompt
+    end
+  end
+{{- end}}
+
+  function update_hermit_env --on-event fish_prompt
+    set -l current (date -r $HERMIT_ENV/bin +"%s")
+    test "$current" = "$HERMIT_BIN_CHANGE"; and return 0
+    set -l cur_hermit $HERMIT_ENV/bin/hermit
+    echo $HERMIT_DEACTIVATION | source
+    $cur_hermit env --activate | source
+    set -gx HERMIT_DEACTIVATION ($HERMIT_ENV/bin/hermit env --deactivate | string collect)
+    set -gx HERMIT_BIN_CHANGE $current
+  end
+end
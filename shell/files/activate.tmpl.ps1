@@ -0,0 +1,55 @@
+# Hermit PowerShell activation script
+
+$env:HERMIT_ENV = {{quote .Root}}
+
+# "return" would exit the caller of Invoke-Expression, so the rest of the script is in the "else" branch.
+if ($env:ACTIVE_HERMIT -and ($env:ACTIVE_HERMIT -eq $env:HERMIT_ENV)) {
+  [Console]::Error.WriteLine("This Hermit environment has already been activated. Skipping")
+} else {
+  if ($env:ACTIVE_HERMIT) {
+    $env:HERMIT_CURRENT_ENV = $env:HERMIT_ENV
+    $env:HERMIT_ENV = $env:ACTIVE_HERMIT
+    deactivate-hermit
+    $env:HERMIT_ENV = $env:HERMIT_CURRENT_ENV
+    Remove-Item Env:HERMIT_CURRENT_ENV
+  }
+
+  function global:_hermit_deactivate {
+    Write-Host "Hermit environment $(& (Join-Path $env:HERMIT_ENV bin/hermit.ps1) env HERMIT_ENV) deactivated"
+    $env:HERMIT_DEACTIVATION | Invoke-Expression
+    Remove-Item Function:deactivate-hermit, Function:update_hermit_env -ErrorAction SilentlyContinue
+  }
+
+  function global:deactivate-hermit {
+    $env:DEACTIVATED_HERMIT = $env:HERMIT_ENV
+    _hermit_deactivate
+  }
+
+  Remove-Item Env:DEACTIVATED_HERMIT -ErrorAction SilentlyContinue
+  $env:ACTIVE_HERMIT = $env:HERMIT_ENV
+  $env:HERMIT_DEACTIVATION = & (Join-Path $env:HERMIT_ENV bin/hermit.ps1) env --deactivate | Out-String
+  $env:HERMIT_BIN_CHANGE = (Get-Item (Join-Path $env:HERMIT_ENV bin)).LastWriteTimeUtc.Ticks
+
+  function global:update_hermit_env {
+    $current = [string](Get-Item (Join-Path $env:HERMIT_ENV bin)).LastWriteTimeUtc.Ticks
+    if ($current -eq $env:HERMIT_BIN_CHANGE) { return }
+    $curHermit = Join-Path $env:HERMIT_ENV bin/hermit.ps1
+    $env:HERMIT_DEACTIVATION | Invoke-Expression
+    & $curHermit env --activate | Out-String | Invoke-Expression
+    $env:HERMIT_DEACTIVATION = & (Join-Path $env:HERMIT_ENV bin/hermit.ps1) env --deactivate | Out-String
+    $env:HERMIT_BIN_CHANGE = $current
+  }
+
+  # PowerShell has no pre-prompt hook, so the prompt is always wrapped to update the environment.
+  if (-not (Test-Path Function:_hermit_old_prompt)) {
+    ${function:global:_hermit_old_prompt} = ${function:prompt}
+  }
+  function global:prompt {
+    if (Test-Path Function:update_hermit_env) { update_hermit_env }
+{{- if eq .Prompt "none"}}
+    _hermit_old_prompt
+{{- else}}
+    {{if eq .Prompt "env"}}{{quote .EnvName}} + {{end}}'🐚 ' + (_hermit_old_prompt)
+{{- end}}
+  }
+}
@@ -21,6 +21,18 @@ _hermit_deactivate() {
   unset -f deactivate-hermit >/dev/null 2>&1
   unset -f update_hermit_env >/dev/null 2>&1
   unset ACTIVE_HERMIT
+{{- if .Completions}}
+  unset -f _hermit_load_completions >/dev/null 2>&1
+{{- if .Bash }}
+  local completion
+  for completion in {{.Completions}}/bash/*; do
+    test -f "$completion" && complete -r "$(basename "$completion")" >/dev/null 2>&1
+  done
+{{- end}}
+{{- if .Zsh }}
+  fpath=(${fpath:#{{.Completions}}/zsh})
+{{- end}}
+{{- end}}
 
   hash -r 2>/dev/null
 
@@ -54,6 +66,29 @@ export HERMIT_BIN_CHANGE=$(date -r ${HERMIT_ENV}/bin +"%s")
 if test -n "${PS1+_}"; then export _HERMIT_OLD_PS1="${PS1}"; export PS1="{{if eq .Prompt "env"}}{{ .EnvName }}{{end}}🐚 ${PS1}"; fi
 {{- end}}
 
+{{- if .Completions }}
+_hermit_load_completions() {
+{{- if .Bash }}
+  local completion
+  for completion in {{.Completions}}/bash/*; do
+    test -f "$completion" && . "$completion"
+  done
+{{- end}}
+{{- if .Zsh }}
+  fpath=({{.Completions}}/zsh ${fpath:#{{.Completions}}/zsh})
+  # Completions can only be registered once compinit has been run.
+  (( $+functions[compdef] )) || return 0
+  local completion
+  for completion in {{.Completions}}/zsh/_*(N); do
+    unfunction ${completion:t} 2>/dev/null
+    autoload -Uz ${completion:t}
+    compdef ${completion:t} ${${completion:t}#_}
+  done
+{{- end}}
+}
+_hermit_load_completions
+{{- end}}
+
 update_hermit_env() {
   local CURRENT=$(date -r ${HERMIT_ENV}/bin +"%s")
   test "$CURRENT" = "$HERMIT_BIN_CHANGE" && return 0
@@ -62,6 +97,9 @@ update_hermit_env() {
   eval "$(${CUR_HERMIT} env --activate)"
   export HERMIT_DEACTIVATION=$(${HERMIT_ENV}/bin/hermit env --deactivate)
   export HERMIT_BIN_CHANGE=$CURRENT
+{{- if .Completions }}
+  _hermit_load_completions
+{{- end}}
 }
 
 {{- if .Bash }}
@@ -0,0 +1,27 @@
+function change_hermit_env --on-event fish_prompt
+  set -l cur $PWD
+  while test "$cur" != "/"
+    if set -q HERMIT_ENV; and command test "$cur" -ef "$HERMIT_ENV"
+      return
+    end
+    if test -f "$cur/bin/activate-hermit"
+      if set -q HERMIT_ENV; and functions -q _hermit_deactivate
+        _hermit_deactivate
+      end
+      if not command test "$cur" -ef "$DEACTIVATED_HERMIT"
+        if $HOME/bin/hermit --quiet validate env "$cur"
+          "$cur/bin/hermit" activate "$cur" | source
+          echo "Hermit environment "($HERMIT_ENV/bin/hermit env HERMIT_ENV)" activated"
+        end
+      end
+      return
+    end
+    set cur (dirname "$cur")
+  end
+  set -e DEACTIVATED_HERMIT
+  if set -q HERMIT_ENV; and functions -q _hermit_deactivate
+    _hermit_deactivate
+  end
+end
+
+complete -c hermit -f -a '(env COMP_LINE=(commandline -cp) $HOME/bin/hermit)'
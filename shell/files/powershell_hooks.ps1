@@ -0,0 +1,41 @@
+function global:change_hermit_env {
+  $cur = (Get-Location).ProviderPath
+  while ($cur) {
+    if ($env:HERMIT_ENV -and ($cur -eq $env:HERMIT_ENV)) {
+      return
+    }
+    if (Test-Path (Join-Path $cur bin/activate-hermit.ps1)) {
+      if ($env:HERMIT_ENV -and (Test-Path Function:_hermit_deactivate)) {
+        _hermit_deactivate
+      }
+      if ($cur -ne $env:DEACTIVATED_HERMIT) {
+        hermit --quiet validate env $cur
+        if ($LASTEXITCODE -eq 0) {
+          & (Join-Path $cur bin/hermit.ps1) activate $cur | Out-String | Invoke-Expression
+          Write-Host "Hermit environment $(& (Join-Path $env:HERMIT_ENV bin/hermit.ps1) env HERMIT_ENV) activated"
+        }
+      }
+      return
+    }
+    $cur = Split-Path -Parent $cur
+  }
+  Remove-Item Env:DEACTIVATED_HERMIT -ErrorAction SilentlyContinue
+  if ($env:HERMIT_ENV -and (Test-Path Function:_hermit_deactivate)) {
+    _hermit_deactivate
+  }
+}
+
+if (-not (Test-Path Function:_hermit_hooks_old_prompt)) {
+  ${function:global:_hermit_hooks_old_prompt} = ${function:prompt}
+}
+function global:prompt {
+  change_hermit_env
+  _hermit_hooks_old_prompt
+}
+
+Register-ArgumentCompleter -Native -CommandName hermit -ScriptBlock {
+  param($wordToComplete, $commandAst, $cursorPosition)
+  $env:COMP_LINE = $commandAst.ToString()
+  hermit | ForEach-Object { [System.Management.Automation.CompletionResult]::new($_, $_, 'ParameterValue', $_) }
+  Remove-Item Env:COMP_LINE
+}
@@ -0,0 +1,110 @@
+package shell
+
+import (
+	_ "embed" // Embedding files.
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/envars"
+)
+
+var (
+	//go:embed files/activate.tmpl.fish
+	fishActivationScript     string
+	fishActivationScriptTmpl = template.Must(template.New("activation").
+					Funcs(template.FuncMap{"quote": fishQuote}).
+					Parse(fishActivationScript))
+
+	//go:embed files/fish_hooks.fish
+	fishShellHooks string
+)
+
+// Fish represents the fish shell
+type Fish struct{}
+
+var _ Shell = &Fish{}
+
+func (sh *Fish) Name() string { return "fish" } // nolint: golint
+
+func (sh *Fish) ActivationScript(w io.Writer, config ActivationConfig) error { // nolint: golint
+	err := fishActivationScriptTmpl.Execute(w, &posixActivationContext{
+		ActivationConfig: config,
+		EnvName:          filepath.Base(config.Root),
+		Shell:            "fish",
+	})
+	return errors.WithStack(err)
+}
+
+func (sh *Fish) ActivationHooksInstallation() (path, script string, err error) { // nolint: golint
+	dir, err := xdgConfigHome()
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	fileName := filepath.Join(dir, "fish", "config.fish")
+	return fileName, `test -x $HOME/bin/hermit; and $HOME/bin/hermit shell-hooks --print --fish | source`, nil
+}
+
+func (sh *Fish) ActivationHooksCode() (script string, err error) { // nolint: golint
+	return fishShellHooks, nil
+}
+
+func (sh *Fish) ApplyEnvars(w io.Writer, env envars.Envars) error { // nolint: golint
+	for _, key := range sortedKeys(env) {
+		value := env[key]
+		switch {
+		case value == "":
+			fmt.Fprintf(w, "set -e %s\n", key)
+		// fish treats variables ending in PATH as lists.
+		case strings.HasSuffix(key, "PATH"):
+			fmt.Fprintf(w, "set -gx %s (string split -- : %s)\n", key, fishQuote(value))
+		default:
+			fmt.Fprintf(w, "set -gx %s %s\n", key, fishQuote(value))
+		}
+	}
+	return nil
+}
+
+func (sh *Fish) DeactivationScript(w io.Writer) error { // nolint: golint
+	_, err := fmt.Fprint(w, `
+if functions -q _hermit_old_fish_prompt
+  functions -e fish_prompt
+  functions -c _hermit_old_fish_prompt fish_prompt
+  functions -e _hermit_old_fish_prompt
+end
+set -e ACTIVE_HERMIT
+`)
+	return errors.WithStack(err)
+}
+
+// Quote a word with single quotes for fish, in which only \ and ' are escaped.
+func fishQuote(word string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(word) + "'"
+}
+
+func sortedKeys(env envars.Envars) []string {
+	keys := make([]string, 0, len(env))
+	for key := range env {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Returns $XDG_CONFIG_HOME, or its default of ~/.config, regardless of OS.
+func xdgConfigHome() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return filepath.Join(home, ".config"), nil
+}
@@ -0,0 +1,79 @@
+package shell
+
+import (
+	_ "embed" // Embedding files.
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/envars"
+)
+
+//go:embed files/nu_hooks.nu
+var nushellCommonHooks string
+
+var nushellShellHooks = `
+$env.config = ($env.config | upsert hooks.pre_prompt (
+  ($env.config.hooks?.pre_prompt? | default []) | append {|| _hermit_change_env; _hermit_update_env }
+))
+`
+
+// Nushell represents nushell.
+//
+// nushell can't evaluate code generated at runtime, so Hermit instead outputs
+// environment changes as JSON records that are applied by functions installed
+// with the shell hooks. The hooks are also required to activate environments.
+type Nushell struct{}
+
+var _ Shell = &Nushell{}
+
+func (sh *Nushell) Name() string { return "nu" } // nolint: golint
+
+func (sh *Nushell) ActivationScript(w io.Writer, config ActivationConfig) error { // nolint: golint
+	state := map[string]interface{}{
+		"HERMIT_ENV":         config.Root,
+		"ACTIVE_HERMIT":      config.Root,
+		"DEACTIVATED_HERMIT": nil,
+	}
+	switch config.Prompt {
+	case "env":
+		state["_HERMIT_PROMPT"] = filepath.Base(config.Root)
+	case "short":
+		state["_HERMIT_PROMPT"] = ""
+	}
+	return errors.WithStack(json.NewEncoder(w).Encode(state))
+}
+
+func (sh *Nushell) ActivationHooksInstallation() (path, script string, err error) { // nolint: golint
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	fileName := filepath.Join(dir, "nushell", "config.nu")
+	// The hooks are installed directly, as nushell can only source files that exist when it starts.
+	script, err = sh.ActivationHooksCode()
+	return fileName, script, errors.WithStack(err)
+}
+
+func (sh *Nushell) ActivationHooksCode() (script string, err error) { // nolint: golint
+	return nushellCommonHooks + nushellShellHooks, nil
+}
+
+func (sh *Nushell) ApplyEnvars(w io.Writer, env envars.Envars) error { // nolint: golint
+	changes := make(map[string]interface{}, len(env))
+	for key, value := range env {
+		if value == "" {
+			changes[key] = nil
+		} else {
+			changes[key] = value
+		}
+	}
+	return errors.WithStack(json.NewEncoder(w).Encode(changes))
+}
+
+func (sh *Nushell) DeactivationScript(w io.Writer) error { // nolint: golint
+	return errors.WithStack(json.NewEncoder(w).Encode(map[string]interface{}{"ACTIVE_HERMIT": nil}))
+}
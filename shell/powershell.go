@@ -0,0 +1,103 @@
+package shell
+
+import (
+	_ "embed" // Embedding files.
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"text/template"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/envars"
+)
+
+var (
+	//go:embed files/activate.tmpl.ps1
+	powershellActivationScript     string
+	powershellActivationScriptTmpl = template.Must(template.New("activation").
+					Funcs(template.FuncMap{"quote": powershellQuote}).
+					Parse(powershellActivationScript))
+
+	//go:embed files/powershell_hooks.ps1
+	powershellShellHooks string
+)
+
+// PowerShell represents both Windows PowerShell and PowerShell Core.
+//
+// Environments are activated with bin/activate-hermit.ps1, and Hermit is run
+// through bin/hermit.ps1.
+type PowerShell struct{}
+
+var _ Shell = &PowerShell{}
+
+func (sh *PowerShell) Name() string { return "powershell" } // nolint: golint
+
+func (sh *PowerShell) ActivationScript(w io.Writer, config ActivationConfig) error { // nolint: golint
+	err := powershellActivationScriptTmpl.Execute(w, &posixActivationContext{
+		ActivationConfig: config,
+		EnvName:          filepath.Base(config.Root),
+		Shell:            "powershell",
+	})
+	return errors.WithStack(err)
+}
+
+func (sh *PowerShell) ActivationHooksInstallation() (path, script string, err error) { // nolint: golint
+	fileName, err := powershellProfile()
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	return fileName, `if (Get-Command hermit -ErrorAction SilentlyContinue) { hermit shell-hooks --print --powershell | Out-String | Invoke-Expression }`, nil
+}
+
+func (sh *PowerShell) ActivationHooksCode() (script string, err error) { // nolint: golint
+	return powershellShellHooks, nil
+}
+
+func (sh *PowerShell) ApplyEnvars(w io.Writer, env envars.Envars) error { // nolint: golint
+	for _, key := range sortedKeys(env) {
+		value := env[key]
+		if value == "" {
+			fmt.Fprintf(w, "Remove-Item -LiteralPath Env:%s -ErrorAction SilentlyContinue\n", key)
+		} else {
+			fmt.Fprintf(w, "${env:%s} = %s\n", key, powershellQuote(value))
+		}
+	}
+	return nil
+}
+
+func (sh *PowerShell) DeactivationScript(w io.Writer) error { // nolint: golint
+	_, err := fmt.Fprint(w, `
+if (Test-Path Function:_hermit_old_prompt) {
+  ${function:global:prompt} = ${function:_hermit_old_prompt}
+  Remove-Item Function:_hermit_old_prompt
+}
+Remove-Item -LiteralPath Env:ACTIVE_HERMIT -ErrorAction SilentlyContinue
+`)
+	return errors.WithStack(err)
+}
+
+// Quote a word with single quotes for PowerShell, in which only ' is escaped, by doubling it.
+func powershellQuote(word string) string {
+	return "'" + strings.ReplaceAll(word, "'", "''") + "'"
+}
+
+// Returns the path of $PROFILE for the current user in PowerShell Core.
+func powershellProfile() (string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	dir := filepath.Join(home, "Documents", "PowerShell")
+	if runtime.GOOS != "windows" {
+		configDir, err := xdgConfigHome()
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		dir = filepath.Join(configDir, "powershell")
+	}
+	return filepath.Join(dir, "Microsoft.PowerShell_profile.ps1"), nil
+}
@@ -6,6 +6,8 @@ import (
 	"os"
 	"os/user"
 	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/mitchellh/go-ps"
 	"github.com/pkg/errors"
@@ -22,6 +24,9 @@ type ActivationConfig struct {
 	Root   string
 	Prompt string
 	Env    envars.Envars
+	// Directory with "bash", "zsh" and "fish" subdirectories of package
+	// completion scripts, if any. Other shells ignore it.
+	Completions string
 }
 
 // Shell abstracts shell specific functionality
@@ -45,6 +50,11 @@ var (
 	shells = map[string]Shell{
 		"zsh":  &Zsh{},
 		"bash": &Bash{},
+		"fish": &Fish{},
+		"nu":   &Nushell{},
+		// Both Windows PowerShell and PowerShell Core.
+		"powershell": &PowerShell{},
+		"pwsh":       &PowerShell{},
 	}
 )
 
@@ -94,7 +104,7 @@ func Detect() (Shell, error) {
 		if err != nil || process == nil {
 			break
 		}
-		name := filepath.Base(process.Executable())
+		name := strings.TrimSuffix(filepath.Base(process.Executable()), ".exe")
 		shell, ok := shells[name]
 		if ok {
 			return shell, nil
@@ -105,6 +115,11 @@ func Detect() (Shell, error) {
 		}
 	}
 
+	// There's no password database on Windows, so assume PowerShell.
+	if runtime.GOOS == "windows" {
+		return shells["powershell"], nil
+	}
+
 	// Next, try to pull the shell from the user's password entry.
 	u, err := user.Current()
 	if err != nil {
@@ -0,0 +1,135 @@
+package shell
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/envars"
+)
+
+func TestApplyEnvarsOutput(t *testing.T) {
+	env := envars.Envars{"GOBIN": `/it's/a\path`, "PATH": "/env/bin:/bin", "OLD": ""}
+	tests := []struct {
+		shell    Shell
+		expected string
+	}{
+		{&Fish{}, `set -gx GOBIN '/it\'s/a\\path'
+set -e OLD
+set -gx PATH (string split -- : '/env/bin:/bin')
+`},
+		{&Nushell{}, `{"GOBIN":"/it's/a\\path","OLD":null,"PATH":"/env/bin:/bin"}
+`},
+		{&PowerShell{}, `${env:GOBIN} = '/it''s/a\path'
+Remove-Item -LiteralPath Env:OLD -ErrorAction SilentlyContinue
+${env:PATH} = '/env/bin:/bin'
+`},
+	}
+	for _, test := range tests {
+		t.Run(test.shell.Name(), func(t *testing.T) {
+			w := &bytes.Buffer{}
+			require.NoError(t, test.shell.ApplyEnvars(w, env))
+			require.Equal(t, test.expected, w.String())
+		})
+	}
+}
+
+// Apply envars in each shell that is installed, and check the resulting environment.
+func TestApplyEnvarsRoundTrip(t *testing.T) {
+	changes := envars.Envars{
+		"HERMIT_TEST_SET":   `it's a "value" with $dollars, \backslashes and` + "\nnewlines",
+		"HERMIT_TEST_PATH":  "/env/bin:/bin",
+		"HERMIT_TEST_UNSET": "",
+	}
+	tests := []struct {
+		shell Shell
+		args  func(script string) []string
+	}{
+		{&Bash{}, func(script string) []string { return []string{"bash", "--norc", "-c", script + "\nenv -0"} }},
+		{&Zsh{}, func(script string) []string { return []string{"zsh", "-f", "-c", script + "\nenv -0"} }},
+		{&Fish{}, func(script string) []string { return []string{"fish", "--no-config", "-c", script + "\nenv -0"} }},
+		{&Nushell{}, func(script string) []string {
+			return []string{"nu", "-n", "-c", nushellCommonHooks + "\n_hermit_apply ($env.HERMIT_TEST_CHANGES | _hermit_records)\n^env -0"}
+		}},
+		{&PowerShell{}, func(script string) []string {
+			return []string{"pwsh", "-NoProfile", "-NonInteractive", "-Command", script + "\nenv -0"}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.shell.Name(), func(t *testing.T) {
+			w := &bytes.Buffer{}
+			require.NoError(t, test.shell.ApplyEnvars(w, changes))
+			args := test.args(w.String())
+			if _, err := exec.LookPath(args[0]); err != nil {
+				t.Skipf("%s is not installed", args[0])
+			}
+			cmd := exec.Command(args[0], args[1:]...) // nolint: gosec
+			cmd.Env = append(os.Environ(), "HERMIT_TEST_UNSET=old", "HERMIT_TEST_CHANGES="+w.String())
+			out, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(out))
+			actual := envars.Envars{}
+			for _, envar := range strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00") {
+				parts := strings.SplitN(envar, "=", 2)
+				if len(parts) == 2 {
+					actual[parts[0]] = parts[1]
+				}
+			}
+			require.Equal(t, changes["HERMIT_TEST_SET"], actual["HERMIT_TEST_SET"])
+			require.Equal(t, changes["HERMIT_TEST_PATH"], actual["HERMIT_TEST_PATH"])
+			require.NotContains(t, actual, "HERMIT_TEST_UNSET")
+		})
+	}
+}
+
+// Activate an environment in each shell that is installed, and check that package completions are loaded.
+func TestActivationCompletions(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(root, "bin"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "bin", "hermit"), []byte("#!/bin/sh\n"), 0700)) // nolint: gosec
+	completions := t.TempDir()
+	scripts := map[string]string{
+		"bash/tool":      "complete -W 'one two' tool\n",
+		"zsh/_tool":      "#compdef tool\n_arguments '1: :(one two)'\n",
+		"fish/tool.fish": "complete -c tool -a 'one two'\n",
+	}
+	for path, script := range scripts {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(completions, path)), 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(completions, path), []byte(script), 0600))
+	}
+	tests := []struct {
+		shell Shell
+		args  func(script string) []string
+	}{
+		{&Bash{}, func(script string) []string {
+			return []string{"bash", "--norc", "-c", script + "\ncomplete -p tool"}
+		}},
+		{&Zsh{}, func(script string) []string {
+			return []string{"zsh", "-f", "-c", "autoload -Uz compinit && compinit -u\n" + script + "\necho $_comps[tool]"}
+		}},
+		{&Fish{}, func(script string) []string {
+			return []string{"fish", "--no-config", "-c", script + "\ncomplete -C 'tool '"}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.shell.Name(), func(t *testing.T) {
+			w := &bytes.Buffer{}
+			err := test.shell.ActivationScript(w, ActivationConfig{Root: root, Prompt: "none", Completions: completions})
+			require.NoError(t, err)
+			require.Contains(t, w.String(), completions)
+			args := test.args(w.String())
+			if _, err := exec.LookPath(args[0]); err != nil {
+				t.Skipf("%s is not installed", args[0])
+			}
+			cmd := exec.Command(args[0], args[1:]...) // nolint: gosec
+			cmd.Env = append(os.Environ(), "HOME="+t.TempDir())
+			out, err := cmd.Output()
+			require.NoError(t, err, string(out))
+			require.Contains(t, string(out), map[string]string{"bash": "tool", "zsh": "_tool", "fish": "one"}[test.shell.Name()])
+		})
+	}
+}
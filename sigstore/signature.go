@@ -0,0 +1,102 @@
+// Package sigstore verifies keyless Sigstore signatures created by
+// "cosign sign-blob".
+//
+// A keyless signature is made with a short-lived certificate issued by
+// Fulcio to an OIDC identity, eg. a GitHub Actions workflow, and recorded in
+// the Rekor transparency log. Verification checks the signature, that the
+// certificate chains to a trusted Fulcio root and was issued to the expected
+// identity, and that Rekor recorded the signature while the certificate was
+// valid.
+package sigstore
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+
+	"github.com/pkg/errors"
+)
+
+// Signature of an artifact.
+type Signature struct {
+	// Signature of the SHA256 digest of the artifact.
+	Signature []byte
+	// Certificate of the signing key.
+	Certificate *x509.Certificate
+	// Rekor log entry of the signature. If nil it is looked up in Rekor.
+	Entry *LogEntry
+}
+
+// LogEntry is a Rekor transparency log entry.
+type LogEntry struct {
+	// Body of the entry, a base64 encoded "hashedrekord".
+	Body           string `json:"body"`
+	IntegratedTime int64  `json:"integratedTime"`
+	LogID          string `json:"logID"`
+	LogIndex       int64  `json:"logIndex"`
+	// SignedEntryTimestamp is Rekor's signature over the above fields.
+	SignedEntryTimestamp []byte `json:"-"`
+}
+
+// ParseSignature parses a signature as written by "cosign sign-blob --output-signature".
+func ParseSignature(data []byte) ([]byte, error) {
+	sig, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(data)))
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid signature")
+	}
+	return sig, nil
+}
+
+// ParseCertificate parses a PEM certificate, optionally base64 encoded as
+// written by "cosign sign-blob --output-certificate".
+func ParseCertificate(data []byte) (*x509.Certificate, error) {
+	data = bytes.TrimSpace(data)
+	if !bytes.HasPrefix(data, []byte("-----BEGIN")) {
+		decoded, err := base64.StdEncoding.DecodeString(string(data))
+		if err != nil {
+			return nil, errors.Wrap(err, "invalid certificate")
+		}
+		data = decoded
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("invalid certificate: no PEM certificate found")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	return cert, errors.Wrap(err, "invalid certificate")
+}
+
+// ParseBundle parses a bundle as written by "cosign sign-blob --bundle".
+func ParseBundle(data []byte) (*Signature, error) {
+	bundle := struct {
+		Base64Signature string `json:"base64Signature"`
+		Cert            string `json:"cert"`
+		RekorBundle     *struct {
+			SignedEntryTimestamp []byte   `json:"SignedEntryTimestamp"`
+			Payload              LogEntry `json:"Payload"`
+		} `json:"rekorBundle"`
+	}{}
+	if err := json.Unmarshal(data, &bundle); err != nil {
+		return nil, errors.Wrap(err, "invalid cosign bundle")
+	}
+	if bundle.Base64Signature == "" || bundle.Cert == "" {
+		return nil, errors.New("invalid cosign bundle: expected a signature and certificate")
+	}
+	sig, err := ParseSignature([]byte(bundle.Base64Signature))
+	if err != nil {
+		return nil, err
+	}
+	cert, err := ParseCertificate([]byte(bundle.Cert))
+	if err != nil {
+		return nil, err
+	}
+	out := &Signature{Signature: sig, Certificate: cert}
+	if bundle.RekorBundle != nil {
+		entry := bundle.RekorBundle.Payload
+		entry.SignedEntryTimestamp = bundle.RekorBundle.SignedEntryTimestamp
+		out.Entry = &entry
+	}
+	return out, nil
+}
@@ -0,0 +1,277 @@
+package sigstore
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// A fake Sigstore instance: a Fulcio CA and a Rekor log, with a single signed artifact.
+type testSigstore struct {
+	*httptest.Server
+	artifact string
+	sig      *Signature
+	bundle   []byte
+	rekorKey *ecdsa.PrivateKey
+	// PEM encoded trust roots.
+	fulcioPEM, rekorPEM []byte
+
+	lock     sync.Mutex
+	requests []string
+}
+
+func newTestSigstore(t *testing.T, subject string) *testSigstore {
+	t.Helper()
+	now := time.Now()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-fulcio"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+
+	// Keyless certificates are only valid for a few minutes.
+	signingKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	issuer, err := asn1.Marshal("https://token.example.com")
+	require.NoError(t, err)
+	leafDER, err := x509.CreateCertificate(rand.Reader, &x509.Certificate{
+		SerialNumber:    big.NewInt(2),
+		NotBefore:       now.Add(-time.Minute),
+		NotAfter:        now.Add(time.Minute * 10),
+		EmailAddresses:  []string{subject},
+		KeyUsage:        x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+		ExtraExtensions: []pkix.Extension{{Id: oidIssuerV2, Value: issuer}},
+	}, ca, &signingKey.PublicKey, caKey)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(leafDER)
+	require.NoError(t, err)
+	leafPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: leafDER})
+
+	artifact := filepath.Join(t.TempDir(), "tool.tar.gz")
+	require.NoError(t, os.WriteFile(artifact, []byte("tool"), 0600))
+	digest := sha256.Sum256([]byte("tool"))
+	signature, err := ecdsa.SignASN1(rand.Reader, signingKey, digest[:])
+	require.NoError(t, err)
+
+	rekorKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rekorDER, err := x509.MarshalPKIXPublicKey(&rekorKey.PublicKey)
+	require.NoError(t, err)
+	logID := sha256.Sum256(rekorDER)
+	body, err := json.Marshal(map[string]interface{}{
+		"apiVersion": "0.0.1",
+		"kind":       "hashedrekord",
+		"spec": map[string]interface{}{
+			"signature": map[string]interface{}{
+				"content":   signature,
+				"publicKey": map[string]interface{}{"content": leafPEM},
+			},
+			"data": map[string]interface{}{
+				"hash": map[string]string{"algorithm": "sha256", "value": hex.EncodeToString(digest[:])},
+			},
+		},
+	})
+	require.NoError(t, err)
+	entry := &LogEntry{
+		Body:           base64.StdEncoding.EncodeToString(body),
+		IntegratedTime: now.Unix(),
+		LogID:          hex.EncodeToString(logID[:]),
+		LogIndex:       42,
+	}
+	s := &testSigstore{
+		artifact:  artifact,
+		sig:       &Signature{Signature: signature, Certificate: leaf, Entry: entry},
+		rekorKey:  rekorKey,
+		fulcioPEM: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: caDER}),
+		rekorPEM:  pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rekorDER}),
+	}
+	s.signEntry(t, entry)
+	s.bundle, err = json.Marshal(map[string]interface{}{
+		"base64Signature": base64.StdEncoding.EncodeToString(signature),
+		"cert":            base64.StdEncoding.EncodeToString(leafPEM),
+		"rekorBundle": map[string]interface{}{
+			"SignedEntryTimestamp": entry.SignedEntryTimestamp,
+			"Payload":              entry,
+		},
+	})
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/index/retrieve", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode([]string{"unrelated", "entry"})
+	})
+	mux.HandleFunc("/api/v1/log/entries/unrelated", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"unrelated": map[string]interface{}{
+			"body": base64.StdEncoding.EncodeToString([]byte(`{"kind": "hashedrekord"}`)),
+		}})
+	})
+	mux.HandleFunc("/api/v1/log/entries/entry", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"entry": map[string]interface{}{
+			"body":           entry.Body,
+			"integratedTime": entry.IntegratedTime,
+			"logID":          entry.LogID,
+			"logIndex":       entry.LogIndex,
+			"verification":   map[string]interface{}{"signedEntryTimestamp": entry.SignedEntryTimestamp},
+		}})
+	})
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.lock.Lock()
+		s.requests = append(s.requests, r.URL.Path)
+		s.lock.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Create Rekor's signed entry timestamp for "entry".
+func (s *testSigstore) signEntry(t *testing.T, entry *LogEntry) {
+	t.Helper()
+	payload, err := json.Marshal(entry)
+	require.NoError(t, err)
+	digest := sha256.Sum256(payload)
+	entry.SignedEntryTimestamp, err = ecdsa.SignASN1(rand.Reader, s.rekorKey, digest[:])
+	require.NoError(t, err)
+}
+
+func (s *testSigstore) verifier(options ...Option) *Verifier {
+	return New(http.DefaultClient, append([]Option{WithFulcioRoots(s.fulcioPEM), WithRekorPublicKey(s.rekorPEM), WithRekorURL(s.URL)}, options...)...)
+}
+
+var testIdentity = Identity{Subject: `.*@example\.com`, Issuer: "https://token.example.com"}
+
+func TestVerifyBundle(t *testing.T) {
+	s := newTestSigstore(t, "release@example.com")
+	sig, err := ParseBundle(s.bundle)
+	require.NoError(t, err)
+	// Bundles include the log entry, so they are verified without the network.
+	s.Close()
+	err = s.verifier().Verify(context.Background(), s.artifact, sig, testIdentity)
+	require.NoError(t, err)
+
+	// Roots other than those configured aren't trusted.
+	other := newTestSigstore(t, "release@example.com")
+	err = s.verifier(WithFulcioRoots(other.fulcioPEM)).Verify(context.Background(), s.artifact, sig, testIdentity)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "certificate signed by unknown authority")
+	err = s.verifier(WithRekorPublicKey(other.rekorPEM)).Verify(context.Background(), s.artifact, sig, testIdentity)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "untrusted log")
+}
+
+func TestDefaultTrustRoots(t *testing.T) {
+	v := New(http.DefaultClient)
+	roots, intermediates, err := v.fulcioRoots()
+	require.NoError(t, err)
+	require.NotNil(t, roots)
+	require.NotNil(t, intermediates)
+	key, err := v.rekorPublicKey()
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(key)
+	require.NoError(t, err)
+	// The log ID of the public Rekor instance.
+	logID := sha256.Sum256(der)
+	require.Equal(t, "c0d23d6ad406973f9559f3ba2d1ca01f84147d8ffc5b8445c224f98b9591801d", hex.EncodeToString(logID[:]))
+}
+
+func TestVerifyLooksUpRekorEntry(t *testing.T) {
+	s := newTestSigstore(t, "release@example.com")
+	sig := *s.sig
+	sig.Entry = nil
+	err := s.verifier().Verify(context.Background(), s.artifact, &sig, testIdentity)
+	require.NoError(t, err)
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	require.Contains(t, s.requests, "/api/v1/log/entries/entry")
+}
+
+func TestVerifyFailures(t *testing.T) {
+	s := newTestSigstore(t, "release@example.com")
+	tests := []struct {
+		name     string
+		mutate   func(sig *Signature, identity *Identity)
+		artifact string
+		err      string
+	}{
+		{name: "WrongIdentity", mutate: func(_ *Signature, identity *Identity) { identity.Subject = "other@example.com" },
+			err: `certificate identity release@example.com does not match "other@example.com"`},
+		{name: "PartialIdentityMatch", mutate: func(_ *Signature, identity *Identity) { identity.Subject = "release" },
+			err: "does not match"},
+		{name: "WrongIssuer", mutate: func(_ *Signature, identity *Identity) { identity.Issuer = "https://evil.example.com" },
+			err: "certificate issuer"},
+		{name: "MissingIdentity", mutate: func(_ *Signature, identity *Identity) { identity.Subject = "" },
+			err: "an identity and issuer are required"},
+		{name: "TamperedArtifact", artifact: "tampered",
+			err: "invalid signature"},
+		{name: "NotLogged", mutate: func(sig *Signature, _ *Identity) {
+			entry := *sig.Entry
+			entry.SignedEntryTimestamp = []byte("invalid")
+			sig.Entry = &entry
+		}, err: "invalid Rekor signed entry timestamp"},
+		{name: "LoggedOutsideCertificateValidity", mutate: func(sig *Signature, _ *Identity) {
+			entry := *sig.Entry
+			entry.IntegratedTime = time.Now().Add(time.Hour).Unix()
+			s.signEntry(t, &entry)
+			sig.Entry = &entry
+		}, err: "certificate has expired or is not yet valid"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sig := *s.sig
+			identity := testIdentity
+			if test.mutate != nil {
+				test.mutate(&sig, &identity)
+			}
+			artifact := s.artifact
+			if test.artifact != "" {
+				artifact = filepath.Join(t.TempDir(), "artifact")
+				require.NoError(t, os.WriteFile(artifact, []byte(test.artifact), 0600))
+			}
+			err := s.verifier().Verify(context.Background(), artifact, &sig, identity)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), test.err)
+		})
+	}
+}
+
+func TestParseCertificate(t *testing.T) {
+	s := newTestSigstore(t, "release@example.com")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.sig.Certificate.Raw})
+	for _, data := range [][]byte{certPEM, []byte(base64.StdEncoding.EncodeToString(certPEM))} {
+		cert, err := ParseCertificate(data)
+		require.NoError(t, err)
+		require.True(t, cert.Equal(s.sig.Certificate))
+	}
+	_, err := ParseCertificate([]byte("invalid"))
+	require.Error(t, err)
+}
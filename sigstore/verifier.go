@@ -0,0 +1,387 @@
+package sigstore
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	_ "embed" // Trust roots.
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRekorURL is the Rekor log of the public Sigstore instance.
+const DefaultRekorURL = "https://rekor.sigstore.dev"
+
+// Trust roots of the public Sigstore instance, which are shipped with Hermit
+// rather than retrieved, so that a mirror or proxy can't substitute its own.
+var (
+	//go:embed files/fulcio.pem
+	defaultFulcioRoots []byte
+	//go:embed files/rekor.pem
+	defaultRekorPublicKey []byte
+)
+
+// ErrVerificationFailed is returned when a signature is invalid.
+var ErrVerificationFailed = errors.New("signature verification failed")
+
+// Fulcio certificate extensions recording the OIDC issuer of the identity.
+var (
+	oidIssuer   = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 1}
+	oidIssuerV2 = asn1.ObjectIdentifier{1, 3, 6, 1, 4, 1, 57264, 1, 8}
+)
+
+// Identity that a signing certificate must have been issued to.
+type Identity struct {
+	// Subject is a regular expression matched against the whole email
+	// address or URI the certificate was issued to.
+	Subject string
+	// Issuer is the OIDC issuer of the identity.
+	Issuer string
+}
+
+// Option for the Verifier.
+type Option func(*Verifier)
+
+// WithFulcioRoots trusts the PEM encoded Fulcio CA certificates in "data"
+// instead of those of the public Sigstore instance. Self-signed certificates
+// are roots, and the others intermediates.
+func WithFulcioRoots(data []byte) Option {
+	return func(v *Verifier) { v.fulcioPEM = data }
+}
+
+// WithRekorURL sets the base URL of the Rekor instance to look up log entries in.
+func WithRekorURL(url string) Option {
+	return func(v *Verifier) { v.rekorURL = strings.TrimSuffix(url, "/") }
+}
+
+// WithRekorPublicKey trusts the PEM encoded Rekor public key in "data"
+// instead of that of the public Sigstore instance.
+func WithRekorPublicKey(data []byte) Option {
+	return func(v *Verifier) { v.rekorPEM = data }
+}
+
+// Verifier of keyless Sigstore signatures.
+//
+// "client" is only used to look up entries in Rekor, which are verified
+// against the trusted Rekor public key.
+type Verifier struct {
+	client    *http.Client
+	rekorURL  string
+	fulcioPEM []byte
+	rekorPEM  []byte
+
+	lock          sync.Mutex
+	roots         *x509.CertPool
+	intermediates *x509.CertPool
+	rekorKey      crypto.PublicKey
+}
+
+// New creates a new Verifier.
+func New(client *http.Client, options ...Option) *Verifier {
+	v := &Verifier{
+		client:    client,
+		rekorURL:  DefaultRekorURL,
+		fulcioPEM: defaultFulcioRoots,
+		rekorPEM:  defaultRekorPublicKey,
+	}
+	for _, option := range options {
+		option(v)
+	}
+	return v
+}
+
+// Verify that "sig" is a valid signature of the file at "path" by "identity".
+func (v *Verifier) Verify(ctx context.Context, path string, sig *Signature, identity Identity) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer f.Close() // nolint: gosec
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return errors.WithStack(err)
+	}
+	digest := h.Sum(nil)
+
+	if err := verifyDigest(sig.Certificate.PublicKey, digest, sig.Signature); err != nil {
+		return err
+	}
+	if err := checkIdentity(sig.Certificate, identity); err != nil {
+		return err
+	}
+	entry := sig.Entry
+	if entry == nil {
+		entry, err = v.lookupEntry(ctx, digest, sig)
+		if err != nil {
+			return err
+		}
+	} else if err := checkEntryBody(entry, digest, sig); err != nil {
+		return err
+	}
+	if err := v.verifyEntry(entry); err != nil {
+		return err
+	}
+	// The certificate is short-lived, so it must have been valid when the signature was logged.
+	roots, intermediates, err := v.fulcioRoots()
+	if err != nil {
+		return err
+	}
+	_, err = sig.Certificate.Verify(x509.VerifyOptions{
+		Roots:         roots,
+		Intermediates: intermediates,
+		CurrentTime:   time.Unix(entry.IntegratedTime, 0),
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageCodeSigning},
+	})
+	if err != nil {
+		return errors.Wrap(ErrVerificationFailed, err.Error())
+	}
+	return nil
+}
+
+func verifyDigest(key crypto.PublicKey, digest, sig []byte) error {
+	switch key := key.(type) {
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(key, digest, sig) {
+			return errors.Wrap(ErrVerificationFailed, "invalid signature")
+		}
+	case *rsa.PublicKey:
+		if err := rsa.VerifyPKCS1v15(key, crypto.SHA256, digest, sig); err != nil {
+			return errors.Wrap(ErrVerificationFailed, "invalid signature")
+		}
+	default:
+		return errors.Errorf("unsupported signing key type %T", key)
+	}
+	return nil
+}
+
+func checkIdentity(cert *x509.Certificate, identity Identity) error {
+	if identity.Subject == "" || identity.Issuer == "" {
+		return errors.New("an identity and issuer are required to verify keyless signatures")
+	}
+	re, err := regexp.Compile("^(?:" + identity.Subject + ")$")
+	if err != nil {
+		return errors.Wrap(err, "invalid identity")
+	}
+	subjects := append([]string{}, cert.EmailAddresses...)
+	for _, uri := range cert.URIs {
+		subjects = append(subjects, uri.String())
+	}
+	matched := false
+	for _, subject := range subjects {
+		if re.MatchString(subject) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return errors.Wrapf(ErrVerificationFailed, "certificate identity %s does not match %q", strings.Join(subjects, ", "), identity.Subject)
+	}
+	issuer := certificateIssuer(cert)
+	if issuer != identity.Issuer {
+		return errors.Wrapf(ErrVerificationFailed, "certificate issuer %q does not match %q", issuer, identity.Issuer)
+	}
+	return nil
+}
+
+func certificateIssuer(cert *x509.Certificate) string {
+	for _, ext := range cert.Extensions {
+		switch {
+		case ext.Id.Equal(oidIssuerV2):
+			var issuer string
+			if _, err := asn1.Unmarshal(ext.Value, &issuer); err == nil {
+				return issuer
+			}
+		case ext.Id.Equal(oidIssuer):
+			return string(ext.Value)
+		}
+	}
+	return ""
+}
+
+// Look up the log entry for a signature in Rekor.
+func (v *Verifier) lookupEntry(ctx context.Context, digest []byte, sig *Signature) (*LogEntry, error) {
+	query, err := json.Marshal(map[string]string{"hash": "sha256:" + hex.EncodeToString(digest)})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	uuids := []string{}
+	if err := v.request(ctx, http.MethodPost, v.rekorURL+"/api/v1/index/retrieve", query, &uuids); err != nil {
+		return nil, errors.Wrap(err, "Rekor search failed")
+	}
+	for _, uuid := range uuids {
+		entries := map[string]struct {
+			LogEntry
+			Verification struct {
+				SignedEntryTimestamp []byte `json:"signedEntryTimestamp"`
+			} `json:"verification"`
+		}{}
+		if err := v.request(ctx, http.MethodGet, v.rekorURL+"/api/v1/log/entries/"+uuid, nil, &entries); err != nil {
+			return nil, errors.Wrap(err, "Rekor lookup failed")
+		}
+		for _, entry := range entries {
+			out := entry.LogEntry
+			out.SignedEntryTimestamp = entry.Verification.SignedEntryTimestamp
+			if checkEntryBody(&out, digest, sig) == nil {
+				return &out, nil
+			}
+		}
+	}
+	return nil, errors.Wrap(ErrVerificationFailed, "signature not found in the Rekor transparency log")
+}
+
+// Check that a log entry records "sig" over "digest".
+func checkEntryBody(entry *LogEntry, digest []byte, sig *Signature) error {
+	data, err := base64.StdEncoding.DecodeString(entry.Body)
+	if err != nil {
+		return errors.Wrap(err, "invalid Rekor entry")
+	}
+	body := struct {
+		Kind string `json:"kind"`
+		Spec struct {
+			Signature struct {
+				Content   []byte `json:"content"`
+				PublicKey struct {
+					Content []byte `json:"content"`
+				} `json:"publicKey"`
+			} `json:"signature"`
+			Data struct {
+				Hash struct {
+					Algorithm string `json:"algorithm"`
+					Value     string `json:"value"`
+				} `json:"hash"`
+			} `json:"data"`
+		} `json:"spec"`
+	}{}
+	if err := json.Unmarshal(data, &body); err != nil {
+		return errors.Wrap(err, "invalid Rekor entry")
+	}
+	if body.Kind != "hashedrekord" {
+		return errors.Errorf("unsupported Rekor entry kind %q", body.Kind)
+	}
+	if body.Spec.Data.Hash.Algorithm != "sha256" || body.Spec.Data.Hash.Value != hex.EncodeToString(digest) {
+		return errors.Wrap(ErrVerificationFailed, "Rekor entry is for a different artifact")
+	}
+	if !bytes.Equal(body.Spec.Signature.Content, sig.Signature) {
+		return errors.Wrap(ErrVerificationFailed, "Rekor entry is for a different signature")
+	}
+	cert, err := ParseCertificate(body.Spec.Signature.PublicKey.Content)
+	if err != nil || !cert.Equal(sig.Certificate) {
+		return errors.Wrap(ErrVerificationFailed, "Rekor entry is for a different certificate")
+	}
+	return nil
+}
+
+// Verify Rekor's signed entry timestamp, its promise to include the entry in the log.
+func (v *Verifier) verifyEntry(entry *LogEntry) error {
+	key, err := v.rekorPublicKey()
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	logID := sha256.Sum256(der)
+	if entry.LogID != hex.EncodeToString(logID[:]) {
+		return errors.Wrapf(ErrVerificationFailed, "Rekor entry is from an untrusted log %s", entry.LogID)
+	}
+	// RFC 8785 canonical JSON, with keys in lexicographic order.
+	payload, err := json.Marshal(struct {
+		Body           string `json:"body"`
+		IntegratedTime int64  `json:"integratedTime"`
+		LogID          string `json:"logID"`
+		LogIndex       int64  `json:"logIndex"`
+	}{entry.Body, entry.IntegratedTime, entry.LogID, entry.LogIndex})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	digest := sha256.Sum256(payload)
+	if err := verifyDigest(key, digest[:], entry.SignedEntryTimestamp); err != nil {
+		return errors.Wrap(ErrVerificationFailed, "invalid Rekor signed entry timestamp")
+	}
+	return nil
+}
+
+func (v *Verifier) rekorPublicKey() (crypto.PublicKey, error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.rekorKey != nil {
+		return v.rekorKey, nil
+	}
+	block, _ := pem.Decode(v.rekorPEM)
+	if block == nil {
+		return nil, errors.New("invalid Rekor public key")
+	}
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid Rekor public key")
+	}
+	v.rekorKey = key
+	return key, nil
+}
+
+func (v *Verifier) fulcioRoots() (roots, intermediates *x509.CertPool, err error) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+	if v.roots != nil {
+		return v.roots, v.intermediates, nil
+	}
+	roots, intermediates = x509.NewCertPool(), x509.NewCertPool()
+	for rest := v.fulcioPEM; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "invalid Fulcio root")
+		}
+		if cert.CheckSignatureFrom(cert) == nil {
+			roots.AddCert(cert)
+		} else {
+			intermediates.AddCert(cert)
+		}
+	}
+	if roots.Equal(x509.NewCertPool()) {
+		return nil, nil, errors.New("no trusted Fulcio roots")
+	}
+	v.roots, v.intermediates = roots, intermediates
+	return roots, intermediates, nil
+}
+
+func (v *Verifier) request(ctx context.Context, method, url string, body []byte, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("%s %s: %s", method, url, resp.Status)
+	}
+	return errors.Wrapf(json.NewDecoder(resp.Body).Decode(out), "%s %s", method, url)
+}
@@ -0,0 +1,192 @@
+package hermit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/envars"
+	"github.com/cashapp/hermit/manifest"
+)
+
+// Executing a package binary through its stub resolves the package and its
+// dependencies from the manifests, which is slow for tools that are run
+// often, eg. from git hooks. Exec therefore records the binary it executed
+// and the environment it executed it with in a snapshot, which ExecSnapshot
+// returns for later executions of the same stub.
+//
+// A snapshot is keyed by a hash of everything the execution depended on:
+// the hermit.hcl and bin directory of the environment and those it inherits
+// from, which identify the installed packages, and the inherited environment
+// variables. It also expires when a channel package it executes or depends
+// on is due an update check, and after at most execSnapshotMaxAge, so that
+// manifest changes, Hermit updates and package usage are eventually picked up.
+
+// Maximum time an exec snapshot is used for.
+const execSnapshotMaxAge = time.Hour
+
+// Environment variables that shells change between commands, which are not
+// part of the snapshot key and are taken from the current environment.
+var volatileEnvars = map[string]bool{"PWD": true, "OLDPWD": true, "SHLVL": true, "_": true}
+
+type execSnapshot struct {
+	Key    string `json:"key"`
+	Binary string `json:"binary"`
+	// Variables set or changed in the inherited environment, which may be empty.
+	Env envars.Envars `json:"env"`
+	// Variables removed from the inherited environment.
+	Unset []string `json:"unset,omitempty"`
+	// Directories of the packages executed and depended on.
+	Roots   []string  `json:"roots"`
+	Expires time.Time `json:"expires"`
+}
+
+// ExecSnapshot returns the binary that Exec last executed for the stub
+// "link", and the environment to execute it with, if the snapshot Exec
+// recorded is still valid.
+func (e *Env) ExecSnapshot(link string) (binary string, env []string, ok bool) {
+	path, err := e.execSnapshotPath(link)
+	if err != nil {
+		return "", nil, false
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, false
+	}
+	snapshot := &execSnapshot{}
+	if err := json.Unmarshal(data, snapshot); err != nil || time.Now().After(snapshot.Expires) {
+		return "", nil, false
+	}
+	key, err := e.execSnapshotKey(link)
+	if err != nil || key != snapshot.Key {
+		return "", nil, false
+	}
+	// The packages may have been garbage collected since.
+	for _, path := range append(snapshot.Roots, snapshot.Binary) {
+		if _, err := os.Stat(path); err != nil {
+			return "", nil, false
+		}
+	}
+	system := envars.Parse(os.Environ())
+	for name, value := range snapshot.Env {
+		system[name] = value
+	}
+	for _, name := range snapshot.Unset {
+		delete(system, name)
+	}
+	return snapshot.Binary, system.System(), true
+}
+
+// Record that the stub "link" executes "binary" with the environment "env",
+// after resolving "pkgs".
+func (e *Env) writeExecSnapshot(link, binary string, env []string, pkgs []*manifest.Package) error {
+	path, err := e.execSnapshotPath(link)
+	if err != nil {
+		return err
+	}
+	key, err := e.execSnapshotKey(link)
+	if err != nil {
+		return err
+	}
+	expires := time.Now().Add(execSnapshotMaxAge)
+	roots := make([]string, 0, len(pkgs))
+	for _, pkg := range pkgs {
+		roots = append(roots, pkg.Root)
+		if pkg.UpdateInterval == 0 {
+			continue
+		}
+		if due := pkg.UpdatedAt.Add(pkg.UpdateInterval); due.Before(expires) {
+			expires = due
+		}
+	}
+	// Record the difference to the inherited environment, which is part of the key.
+	system, changed, unset := envars.Parse(os.Environ()), envars.Envars{}, []string{}
+	executed := envars.Parse(env)
+	for name, value := range executed {
+		if old, ok := system[name]; !ok || old != value {
+			changed[name] = value
+		}
+	}
+	for name := range system {
+		if _, ok := executed[name]; !ok {
+			unset = append(unset, name)
+		}
+	}
+	sort.Strings(unset)
+	data, err := json.Marshal(&execSnapshot{Key: key, Binary: binary, Env: changed, Unset: unset, Roots: roots, Expires: expires})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	w, err := os.CreateTemp(dir, filepath.Base(path)+".*")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer os.Remove(w.Name()) // nolint: errcheck
+	if _, err := w.Write(data); err != nil {
+		_ = w.Close()
+		return errors.WithStack(err)
+	}
+	if err := w.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(w.Name(), path))
+}
+
+// Snapshots are stored in the download cache, so that "hermit clean --cache" removes them.
+func (e *Env) execSnapshotPath(link string) (string, error) {
+	link, err := filepath.Abs(link)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	sum := sha256.Sum256([]byte(link))
+	return filepath.Join(e.state.Root(), "cache", "exec-snapshots", hex.EncodeToString(sum[:16])+".json"), nil
+}
+
+func (e *Env) execSnapshotKey(link string) (string, error) {
+	link, err := filepath.Abs(link)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00", link)
+	for env := e; env != nil; env = env.parent {
+		config, err := os.ReadFile(env.configFile)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		fmt.Fprintf(h, "%s\x00%s\x00", env.envDir, config)
+		entries, err := os.ReadDir(env.binDir)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		for _, entry := range entries {
+			fmt.Fprintf(h, "%s\x00", entry.Name())
+		}
+	}
+	system := os.Environ()
+	sort.Strings(system)
+	for _, envar := range system {
+		if !volatileEnvars[strings.SplitN(envar, "=", 2)[0]] {
+			fmt.Fprintf(h, "%s\x00", envar)
+		}
+	}
+	for _, op := range e.ephemeralEnvars {
+		fmt.Fprintf(h, "%s\x00", op)
+	}
+	for _, profile := range e.profiles {
+		fmt.Fprintf(h, "%s\x00", profile.Name)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
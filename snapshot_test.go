@@ -0,0 +1,72 @@
+package hermit_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/envars"
+	"github.com/cashapp/hermit/hermittest"
+	"github.com/cashapp/hermit/manifest/manifesttest"
+)
+
+func TestExecSnapshot(t *testing.T) {
+	fixture := hermittest.NewEnvTestFixture(t, nil)
+	defer fixture.Clean()
+	binDir := filepath.Join(fixture.EnvDirs[0], "bin")
+	pkg := manifesttest.NewPkgBuilder(fixture.RootDir()).
+		WithName("test").
+		WithVersion("1").
+		WithSource("archive/testdata/archive.tar.gz").
+		WithBinaries("darwin_exe", "linux_exe").
+		Result()
+	_, err := fixture.Env.Install(fixture.P, pkg)
+	require.NoError(t, err)
+	link := filepath.Join(binDir, "linux_exe")
+	binary := filepath.Join(pkg.Root, "linux_exe")
+
+	_, _, ok := fixture.Env.ExecSnapshot(link)
+	require.False(t, ok)
+
+	t.Setenv("TEST_SNAPSHOT_REMOVED", "1")
+	executed := envars.Parse(os.Environ())
+	executed["TEST_SNAPSHOT"] = "1"
+	executed["TEST_SNAPSHOT_EMPTY"] = ""
+	delete(executed, "TEST_SNAPSHOT_REMOVED")
+	err = fixture.Env.WriteExecSnapshot(link, binary, executed.System(), pkg)
+	require.NoError(t, err)
+	snapshotBinary, env, ok := fixture.Env.ExecSnapshot(link)
+	require.True(t, ok)
+	require.Equal(t, binary, snapshotBinary)
+	require.Equal(t, executed.System(), env)
+
+	// Changing the environment's configuration invalidates the snapshot.
+	config := filepath.Join(binDir, "hermit.hcl")
+	data, err := ioutil.ReadFile(config)
+	require.NoError(t, err)
+	require.NoError(t, ioutil.WriteFile(config, append(data, []byte("\nenv = {\"FOO\": \"bar\"}\n")...), 0600))
+	_, _, ok = fixture.Env.ExecSnapshot(link)
+	require.False(t, ok)
+
+	// As does installing or uninstalling packages.
+	err = fixture.Env.WriteExecSnapshot(link, binary, os.Environ(), pkg)
+	require.NoError(t, err)
+	_, _, ok = fixture.Env.ExecSnapshot(link)
+	require.True(t, ok)
+	_, err = fixture.Env.Uninstall(fixture.P, pkg)
+	require.NoError(t, err)
+	_, _, ok = fixture.Env.ExecSnapshot(link)
+	require.False(t, ok)
+
+	// Snapshots expire when a channel package is due an update check.
+	pkg.UpdateInterval = time.Hour
+	pkg.UpdatedAt = time.Now().Add(-2 * time.Hour)
+	err = fixture.Env.WriteExecSnapshot(link, binary, os.Environ(), pkg)
+	require.NoError(t, err)
+	_, _, ok = fixture.Env.ExecSnapshot(link)
+	require.False(t, ok)
+}
@@ -0,0 +1,133 @@
+package sources
+
+import (
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/ui"
+	"github.com/cashapp/hermit/util"
+)
+
+// Backend retrieves manifests for sources with a particular URI scheme, eg.
+// "s3://bucket/manifests" or "oci://registry/manifests".
+//
+// Backends are registered with Register, typically from an init() function in
+// a custom build of Hermit.
+type Backend interface {
+	// Resolve validates "uri" and returns the directory below "sourcesDir"
+	// that its manifests will be synchronised into.
+	Resolve(uri *url.URL, sourcesDir string) (dir string, err error)
+	// Sync manifests for "uri" from their origin into "dir".
+	//
+	// Sync is called at most every SyncFrequency unless a sync is forced,
+	// and must leave "dir" intact if it fails.
+	Sync(task *ui.Task, uri *url.URL, dir string) error
+	// Fetch returns the synchronised manifests in "dir".
+	Fetch(uri *url.URL, dir string) (fs.FS, error)
+}
+
+var (
+	backendsLock sync.RWMutex
+	backends     = map[string]Backend{}
+)
+
+// Register a Backend for sources with the URI scheme "scheme".
+//
+// Registering a scheme twice, or one of the built-in "env" or "file"
+// schemes, panics.
+func Register(scheme string, backend Backend) {
+	backendsLock.Lock()
+	defer backendsLock.Unlock()
+	if scheme == "env" || scheme == "file" {
+		panic("sources: can't override built-in scheme " + scheme)
+	}
+	if _, ok := backends[scheme]; ok {
+		panic("sources: backend already registered for scheme " + scheme)
+	}
+	backends[scheme] = backend
+}
+
+// Schemes returns the URI schemes of all registered backends.
+func Schemes() []string {
+	backendsLock.RLock()
+	defer backendsLock.RUnlock()
+	out := make([]string, 0, len(backends))
+	for scheme := range backends {
+		out = append(out, scheme)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func backendForScheme(scheme string) Backend {
+	backendsLock.RLock()
+	defer backendsLock.RUnlock()
+	return backends[scheme]
+}
+
+// DefaultBackendDir is a directory below "sourcesDir" unique to "uri", for use by Backend.Resolve.
+func DefaultBackendDir(uri *url.URL, sourcesDir string) string {
+	return filepath.Join(sourcesDir, util.Hash(uri.String()))
+}
+
+// BackendSource is a Source whose manifests are retrieved by a registered Backend.
+type BackendSource struct {
+	backend Backend
+	uri     *url.URL
+	dir     string
+}
+
+// NewBackendSource returns a new BackendSource.
+func NewBackendSource(backend Backend, uri *url.URL, sourcesDir string) (*BackendSource, error) {
+	dir, err := backend.Resolve(uri, sourcesDir)
+	if err != nil {
+		return nil, errors.Wrap(err, uri.String())
+	}
+	return &BackendSource{backend: backend, uri: uri, dir: dir}, nil
+}
+
+func (s *BackendSource) Sync(p *ui.UI, force bool) error { // nolint: golint
+	task := p.Task(s.URI())
+	defer task.Done()
+	info, _ := os.Stat(s.dir)
+	if info != nil && !force && time.Since(info.ModTime()) < SyncFrequency {
+		task.Debugf("Sync skipped, updated within the last %s", SyncFrequency)
+		return nil
+	}
+	if err := s.backend.Sync(task, s.uri, s.dir); err != nil {
+		// As with Git sources, a stale copy is better than nothing.
+		if info != nil {
+			task.Warnf("sync failed: %s", err)
+			return nil
+		}
+		return errors.Wrapf(err, "%s: sync failed", s.URI())
+	}
+	now := time.Now()
+	return errors.WithStack(os.Chtimes(s.dir, now, now))
+}
+
+func (s *BackendSource) URI() string { // nolint: golint
+	return s.uri.String()
+}
+
+func (s *BackendSource) Bundle() fs.FS { // nolint: golint
+	bundle, err := s.backend.Fetch(s.uri, s.dir)
+	if err != nil {
+		return &uriFS{uri: s.URI(), FS: errorFS{errors.Wrap(err, s.URI())}}
+	}
+	return &uriFS{uri: s.URI(), FS: bundle}
+}
+
+// An fs.FS that always fails.
+type errorFS struct{ err error }
+
+func (e errorFS) Open(name string) (fs.File, error) {
+	return nil, &fs.PathError{Op: "open", Path: name, Err: e.err}
+}
@@ -0,0 +1,73 @@
+package sources
+
+import (
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/ui"
+)
+
+type testBackend struct {
+	syncs   int
+	content string
+	err     error
+}
+
+func (b *testBackend) Resolve(uri *url.URL, sourcesDir string) (string, error) {
+	if uri.Host == "" {
+		return "", errors.New("missing host")
+	}
+	return DefaultBackendDir(uri, sourcesDir), nil
+}
+
+func (b *testBackend) Sync(task *ui.Task, uri *url.URL, dir string) error {
+	b.syncs++
+	if b.err != nil {
+		return b.err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "test.hcl"), []byte(b.content), 0600)
+}
+
+func (b *testBackend) Fetch(uri *url.URL, dir string) (fs.FS, error) {
+	return os.DirFS(dir), nil
+}
+
+func TestRegisteredBackend(t *testing.T) {
+	backend := &testBackend{content: "first"}
+	Register("testbackend", backend)
+	require.Contains(t, Schemes(), "testbackend")
+	require.Panics(t, func() { Register("testbackend", backend) })
+
+	p, _ := ui.NewForTesting()
+	dir := t.TempDir()
+	_, err := ForURIs(p, dir, "", []string{"testbackend:///path"})
+	require.Error(t, err)
+
+	srcs, err := ForURIs(p, dir, "", []string{"testbackend://host/path"})
+	require.NoError(t, err)
+	require.Equal(t, []string{"testbackend://host/path"}, srcs.Sources())
+	require.NoError(t, srcs.Sync(p, false))
+	data, err := fs.ReadFile(srcs.Bundles()[0], "test.hcl")
+	require.NoError(t, err)
+	require.Equal(t, "first", string(data))
+
+	// Recently synced sources are not synced again unless forced, and failed syncs keep the old manifests.
+	source := srcs.sources[0]
+	require.NoError(t, source.Sync(p, false))
+	require.Equal(t, 1, backend.syncs)
+	backend.err = errors.New("unavailable")
+	require.NoError(t, source.Sync(p, true))
+	require.Equal(t, 2, backend.syncs)
+	data, err = fs.ReadFile(source.Bundle(), "test.hcl")
+	require.NoError(t, err)
+	require.Equal(t, "first", string(data))
+}
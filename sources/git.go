@@ -1,21 +1,43 @@
 package sources
 
 import (
-	"github.com/cashapp/hermit/ui"
-	"github.com/cashapp/hermit/util"
-	"github.com/pkg/errors"
+	"context"
 	"io/fs"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/retry"
+	"github.com/cashapp/hermit/ui"
+	"github.com/cashapp/hermit/util"
 )
 
+// Output of git indicating a network failure worth retrying, as opposed to
+// eg. an authentication failure, a missing repository or a bad ref.
+var transientGitErrors = []string{
+	"Could not resolve host",
+	"Failed to connect",
+	"Connection timed out",
+	"Operation timed out",
+	"Connection reset",
+	"Connection refused",
+	"early EOF",
+	"the remote end hung up unexpectedly",
+	"RPC failed",
+	"The requested URL returned error: 5",
+}
+
 // GitSource is a new Source based on a git repo
 type GitSource struct {
 	fs        *uriFS
 	sourceDir string
 	path      string
+	retrier   *retry.Retrier
+	ctx       context.Context
 }
 
 // NewGitSource returns a new GitSource
@@ -25,7 +47,7 @@ func NewGitSource(uri string, sourceDir string) *GitSource {
 	return &GitSource{&uriFS{
 		uri: uri,
 		FS:  os.DirFS(path),
-	}, sourceDir, path}
+	}, sourceDir, path, nil, context.Background()}
 }
 
 func (s *GitSource) Sync(p *ui.UI, force bool) error { // nolint: golint
@@ -37,7 +59,9 @@ func (s *GitSource) Sync(p *ui.UI, force bool) error { // nolint: golint
 			return errors.WithStack(err)
 		}
 
-		err = syncGit(task, s.sourceDir, s.fs.uri, s.path)
+		err = s.retrier.Do(s.ctx, func() error {
+			return syncGit(task, s.sourceDir, s.fs.uri, s.path)
+		})
 		// If the sync failed while the repo had already been cloned, log a warning
 		// If the repo has not yet been cloned, fail.
 		if err != nil {
@@ -94,8 +118,8 @@ func syncGit(b *ui.Task, dir, source, finalDest string) (err error) {
 		return errors.WithStack(err)
 	}
 	defer os.RemoveAll(dest)
-	if err = util.RunInDir(b, dest, "git", "clone", "--depth=1", source, dest); err != nil {
-		return errors.WithStack(err)
+	if err = cloneGit(b, dest, source); err != nil {
+		return err
 	}
 	// And finally, rename it into place.
 	if err = os.Rename(dest, finalDest); err != nil && !os.IsExist(err) { // Prevent races.
@@ -104,3 +128,32 @@ func syncGit(b *ui.Task, dir, source, finalDest string) (err error) {
 
 	return nil
 }
+
+// Clone "source" into "dest", marking failures other than transient network
+// errors as permanent so that they are not retried.
+func cloneGit(b *ui.Task, dest, source string) error {
+	cmd, out := util.Command(b, "git", "clone", "--depth=1", source, dest)
+	cmd.Dir = dest
+	err := cmd.Run()
+	if err == nil {
+		return nil
+	}
+	// log.Write() goes to debug, so only dump the logs at error if we haven't already.
+	if !b.WillLog(ui.LevelDebug) {
+		b.Errorf("%s", out.String())
+	}
+	err = errors.Wrapf(err, "git clone --depth=1 %s failed", source)
+	if !transientGitError(out.String()) {
+		return retry.Permanent(err)
+	}
+	return err
+}
+
+func transientGitError(output string) bool {
+	for _, msg := range transientGitErrors {
+		if strings.Contains(output, msg) {
+			return true
+		}
+	}
+	return false
+}
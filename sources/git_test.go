@@ -0,0 +1,45 @@
+package sources
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/retry"
+	"github.com/cashapp/hermit/ui"
+)
+
+func TestGitSourceDoesNotRetryPermanentFailures(t *testing.T) {
+	p, _ := ui.NewForTesting()
+	dir := t.TempDir()
+	source := NewGitSource(filepath.Join(dir, "missing"), filepath.Join(dir, "sources"))
+	source.retrier = retry.New(retry.Policy{Attempts: 3, MinBackoff: time.Minute, MaxBackoff: time.Minute})
+	start := time.Now()
+	err := source.Sync(p, true)
+	require.Error(t, err)
+	require.Less(t, time.Since(start), 30*time.Second)
+}
+
+func TestGitSourceSyncIsCancellable(t *testing.T) {
+	p, _ := ui.NewForTesting()
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ss := New(dir, []Source{NewGitSource("https://localhost:1/repo.git", filepath.Join(dir, "sources"))})
+	ss.SetRetrier(retry.New(retry.Policy{Attempts: 3, MinBackoff: time.Minute, MaxBackoff: time.Minute}))
+	ss.SetContext(ctx)
+	start := time.Now()
+	err := ss.Sync(p, true)
+	require.Error(t, err)
+	require.Less(t, time.Since(start), 30*time.Second)
+}
+
+func TestTransientGitError(t *testing.T) {
+	require.True(t, transientGitError("fatal: unable to access 'https://example.com/repo.git/': Could not resolve host: example.com"))
+	require.True(t, transientGitError("error: RPC failed; curl 56 GnuTLS recv error (-9)\nfatal: early EOF"))
+	require.False(t, transientGitError("remote: Repository not found.\nfatal: repository 'https://example.com/repo.git/' not found"))
+	require.False(t, transientGitError("fatal: Authentication failed for 'https://example.com/repo.git/'"))
+}
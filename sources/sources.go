@@ -1,6 +1,7 @@
 package sources
 
 import (
+	"context"
 	"io/fs"
 	"net/url"
 	"os"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/pkg/errors"
 
+	"github.com/cashapp/hermit/retry"
 	"github.com/cashapp/hermit/ui"
 )
 
@@ -31,6 +33,7 @@ type Sources struct {
 	sources        []Source
 	dir            string
 	isSynchronised bool // Keep track if the sources have been synchronised to avoid double synchronisation
+	offline        bool
 }
 
 // New returns a new set of sources
@@ -51,6 +54,31 @@ func (s *Sources) Add(source Source) {
 	s.sources = append(s.sources, source)
 }
 
+// SetOffline disables synchronisation, so that only manifests already present locally are used.
+func (s *Sources) SetOffline(offline bool) {
+	s.offline = offline
+}
+
+// SetRetrier retries git sources that fail to synchronise according to its policy.
+//
+// Other remote sources are retried by the HTTP client of their backend.
+func (s *Sources) SetRetrier(retrier *retry.Retrier) {
+	for _, source := range s.sources {
+		if git, ok := source.(*GitSource); ok {
+			git.retrier = retrier
+		}
+	}
+}
+
+// SetContext cancels synchronisation of git sources, including any retries, when ctx is cancelled.
+func (s *Sources) SetContext(ctx context.Context) {
+	for _, source := range s.sources {
+		if git, ok := source.(*GitSource); ok {
+			git.ctx = ctx
+		}
+	}
+}
+
 // Sync synchronises manifests from remote repos.
 // Will be synced at most every SyncFrequency unless "force" is true.
 // A Sources set can only be synchronised once. Following calls will not have any effect.
@@ -58,6 +86,10 @@ func (s *Sources) Sync(p *ui.UI, force bool) error {
 	if s.isSynchronised {
 		return nil
 	}
+	if s.offline {
+		p.Debugf("Offline, not synchronising manifest sources")
+		return nil
+	}
 	s.isSynchronised = true
 	for _, source := range s.sources {
 		err := source.Sync(p, force)
@@ -121,6 +153,9 @@ func getSource(b *ui.UI, source, dir, env string) (Source, error) {
 		candidate = os.DirFS(uri.Path)
 
 	default:
+		if backend := backendForScheme(uri.Scheme); backend != nil {
+			return NewBackendSource(backend, uri, dir)
+		}
 		return nil, errors.Errorf("unsupported source %q", source)
 	}
 	if info, err := os.Stat(checkDir); err == nil {
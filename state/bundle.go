@@ -0,0 +1,216 @@
+package state
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+)
+
+// Top level directories in a bundle.
+const (
+	bundleCacheDir   = "cache"
+	bundleSourcesDir = "sources"
+)
+
+// ExportBundle writes a gzipped tarball to "w" containing the cached sources
+// of "pkgs", downloading them if necessary, along with all synchronised
+// manifest sources.
+//
+// Importing the bundle with ImportBundle allows the packages to be installed
+// offline.
+func (s *State) ExportBundle(l *ui.UI, pkgs []*manifest.Package, w io.Writer) error {
+	paths := map[string]bool{}
+	for _, pkg := range pkgs {
+		if pkg.Source == "/" {
+			continue
+		}
+		task := l.Task(pkg.Reference.String())
+		path, err := s.fetch(task, pkg)
+		if err == nil && (pkg.CosignSignature != "" || pkg.CosignBundle != "") {
+			_, _, err = s.downloadSignature(task, pkg)
+		}
+		task.Done()
+		if err != nil {
+			return errors.Wrap(err, pkg.String())
+		}
+		paths[path] = true
+		for _, uri := range []string{pkg.SHA256Source, pkg.SHA256Signature, pkg.CosignSignature, pkg.CosignCert, pkg.CosignBundle} {
+			if uri != "" {
+				paths[s.cache.Path("", uri)] = true
+			}
+		}
+	}
+	// Sigstore trust material, so that cosign bundles can be verified offline.
+	trusted, _ := filepath.Glob(filepath.Join(s.cache.Root(), "sigstore", "*"))
+	for _, path := range trusted {
+		paths[path] = true
+	}
+	gw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gw)
+	for path := range paths {
+		// Local file sources are not cached, and are assumed to be present wherever the bundle is used.
+		rel, err := filepath.Rel(s.cache.Root(), path)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		if err := addToBundle(tw, path, bundleCacheDir+"/"+filepath.ToSlash(rel)); err != nil {
+			return err
+		}
+	}
+	if _, err := os.Stat(s.sourcesDir); err == nil {
+		if err := addToBundle(tw, s.sourcesDir, bundleSourcesDir); err != nil {
+			return err
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(gw.Close())
+}
+
+// Recursively add "src" to the tarball as "name".
+func addToBundle(tw *tar.Writer, src, name string) error {
+	return filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return errors.WithStack(err)
+			}
+		} else if !info.Mode().IsRegular() && !info.IsDir() {
+			return nil
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return errors.Wrap(err, file)
+		}
+		header.Name = path.Join(name, filepath.ToSlash(rel))
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			return errors.Wrap(err, file)
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer f.Close() // nolint: gosec
+		_, err = io.Copy(tw, f)
+		return errors.Wrap(err, file)
+	})
+}
+
+// ImportBundle created by ExportBundle into the cache and manifest sources.
+//
+// Cached artifacts that already exist are left untouched, while manifest
+// sources are replaced by those in the bundle.
+func (s *State) ImportBundle(l *ui.UI, r io.Reader) error {
+	gr, err := gzip.NewReader(r)
+	if err != nil {
+		return errors.Wrap(err, "invalid bundle")
+	}
+	defer gr.Close()
+	tr := tar.NewReader(gr)
+	replaced := false
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return errors.Wrap(err, "invalid bundle")
+		}
+		name := path.Clean(header.Name)
+		parts := strings.SplitN(name, "/", 2)
+		var root string
+		switch parts[0] {
+		case bundleCacheDir:
+			root = s.cache.Root()
+		case bundleSourcesDir:
+			root = s.sourcesDir
+			if !replaced {
+				replaced = true
+				if err := os.RemoveAll(s.sourcesDir); err != nil {
+					return errors.WithStack(err)
+				}
+			}
+		default:
+			return errors.Errorf("invalid bundle entry %q", header.Name)
+		}
+		rel := ""
+		if len(parts) == 2 {
+			rel = parts[1]
+		}
+		if rel == ".." || strings.HasPrefix(rel, "../") || path.IsAbs(rel) {
+			return errors.Errorf("invalid bundle entry %q", header.Name)
+		}
+		dest := filepath.Join(root, filepath.FromSlash(rel))
+		l.Tracef("Importing %s", dest)
+		if err := importBundleEntry(tr, header, root, dest); err != nil {
+			return errors.Wrap(err, header.Name)
+		}
+	}
+}
+
+func importBundleEntry(tr *tar.Reader, header *tar.Header, root, dest string) error {
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return errors.WithStack(os.MkdirAll(dest, 0700))
+
+	case tar.TypeSymlink:
+		target, err := filepath.Rel(root, filepath.Join(filepath.Dir(dest), header.Linkname))
+		if filepath.IsAbs(header.Linkname) || err != nil || target == ".." || strings.HasPrefix(target, ".."+string(filepath.Separator)) {
+			return errors.Errorf("symlink target %q escapes bundle", header.Linkname)
+		}
+		if _, err := os.Lstat(dest); err == nil {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+			return errors.WithStack(err)
+		}
+		return errors.WithStack(os.Symlink(header.Linkname, dest))
+
+	case tar.TypeReg:
+		if _, err := os.Stat(dest); err == nil {
+			return nil
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+			return errors.WithStack(err)
+		}
+		tmp := dest + ".importing"
+		f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode)&0700|0600)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		_, err = io.Copy(f, tr) // nolint: gosec
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(tmp)
+			return errors.WithStack(err)
+		}
+		return errors.WithStack(os.Rename(tmp, dest))
+
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,67 @@
+package state
+
+import (
+	"bytes"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/checksums"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+)
+
+// Resolve the SHA256 of a package from its checksum file, if it has one but no explicit SHA256.
+//
+// Checksum files and signatures are downloaded through the cache, so they
+// are only retrieved once. If the checksum file is signed, the signature must
+// be valid, and an explicit SHA256 must match the signed checksum.
+func (s *State) resolveSHA256(b *ui.Task, p *manifest.Package) error {
+	if p.SHA256Signature != "" && p.SHA256Source == "" {
+		return errors.Errorf("%s: sha256-signature requires sha256-source", p)
+	}
+	if p.SHA256Source == "" || (p.SHA256 != "" && p.SHA256Signature == "") {
+		return nil
+	}
+	data, err := s.download(b, p.SHA256Source)
+	if err != nil {
+		return errors.Wrap(err, "could not retrieve checksums")
+	}
+	if p.SHA256Signature != "" {
+		if p.SHA256Key == "" {
+			return errors.Errorf("%s: sha256-signature requires sha256-key", p)
+		}
+		sig, err := s.download(b, p.SHA256Signature)
+		if err != nil {
+			return errors.Wrap(err, "could not retrieve checksum signature")
+		}
+		if err := checksums.VerifySignature(data, sig, p.SHA256Key); err != nil {
+			// Don't trust the cached copies next time around.
+			_ = s.cache.Evict(b, "", p.SHA256Source)
+			_ = s.cache.Evict(b, "", p.SHA256Signature)
+			return errors.Wrap(err, p.SHA256Source)
+		}
+	}
+	sums, err := checksums.Parse(bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, p.SHA256Source)
+	}
+	sha, err := sums.Lookup(p.Source)
+	if err != nil {
+		return errors.Wrap(err, p.SHA256Source)
+	}
+	if p.SHA256 != "" && p.SHA256 != sha {
+		return errors.Errorf("%s: sha256 %s does not match the signed checksum %s in %s", p, p.SHA256, sha, p.SHA256Source)
+	}
+	p.SHA256 = sha
+	return nil
+}
+
+func (s *State) download(b *ui.Task, uri string) ([]byte, error) {
+	path, _, err := s.cache.Download(b, "", uri)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	data, err := os.ReadFile(path)
+	return data, errors.WithStack(err)
+}
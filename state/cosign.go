@@ -0,0 +1,80 @@
+package state
+
+import (
+	"context"
+	"os"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/sigstore"
+	"github.com/cashapp/hermit/ui"
+)
+
+// Verify the cosign signature of a package's downloaded source at "path", if it has one.
+//
+// Signatures, certificates and bundles are downloaded through the cache.
+func (s *State) verifySignature(b *ui.Task, p *manifest.Package, path string) error {
+	if p.CosignSignature == "" && p.CosignBundle == "" {
+		return nil
+	}
+	if s.skipVerify {
+		b.Warnf("%s: skipping cosign signature verification", p)
+		return nil
+	}
+	if info, err := os.Stat(path); err != nil {
+		return errors.WithStack(err)
+	} else if info.IsDir() {
+		return errors.Errorf("%s: cosign signatures can only be verified for files", p)
+	}
+	sig, uris, err := s.downloadSignature(b, p)
+	if err == nil {
+		identity := sigstore.Identity{Subject: p.CosignIdentity, Issuer: p.CosignIssuer}
+		err = s.config.Sigstore.Verify(context.Background(), path, sig, identity)
+	}
+	if err != nil {
+		// Don't trust the cached copies next time around.
+		for _, uri := range uris {
+			_ = s.cache.Evict(b, "", uri)
+		}
+		if errors.Is(err, sigstore.ErrVerificationFailed) {
+			_ = s.cache.Evict(b, p.SHA256, p.Source)
+		}
+		return errors.Wrapf(err, "%s: cosign verification failed, use --insecure-skip-verify to install anyway", p)
+	}
+	b.Debugf("Verified cosign signature of %s", p)
+	return nil
+}
+
+func (s *State) downloadSignature(b *ui.Task, p *manifest.Package) (sig *sigstore.Signature, uris []string, err error) {
+	if p.CosignBundle != "" {
+		uris = []string{p.CosignBundle}
+		data, err := s.download(b, p.CosignBundle)
+		if err != nil {
+			return nil, uris, errors.Wrap(err, "could not retrieve cosign bundle")
+		}
+		sig, err = sigstore.ParseBundle(data)
+		return sig, uris, err
+	}
+	if p.CosignCert == "" {
+		return nil, nil, errors.New("cosign-signature requires cosign-certificate")
+	}
+	uris = []string{p.CosignSignature, p.CosignCert}
+	data, err := s.download(b, p.CosignSignature)
+	if err != nil {
+		return nil, uris, errors.Wrap(err, "could not retrieve cosign signature")
+	}
+	signature, err := sigstore.ParseSignature(data)
+	if err != nil {
+		return nil, uris, err
+	}
+	data, err = s.download(b, p.CosignCert)
+	if err != nil {
+		return nil, uris, errors.Wrap(err, "could not retrieve cosign certificate")
+	}
+	cert, err := sigstore.ParseCertificate(data)
+	if err != nil {
+		return nil, uris, err
+	}
+	return &sigstore.Signature{Signature: signature, Certificate: cert}, uris, nil
+}
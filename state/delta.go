@@ -0,0 +1,86 @@
+package state
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/delta"
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+)
+
+// FetchDelta populates the cache with the source of "to" by patching the
+// cached source of "from", if "to" has a delta from that version.
+//
+// It is not an error if there is no usable delta, in which case the source of
+// "to" will be downloaded in full when it is installed. An error is returned
+// only if a delta was attempted and failed, and should be treated as a
+// warning.
+func (s *State) FetchDelta(b *ui.Task, from, to *manifest.Package) error {
+	d, ok := to.Delta(from.Reference.Version)
+	if !ok || s.offline {
+		return nil
+	}
+	if err := s.resolveSHA256(b, to); err != nil {
+		return errors.WithStack(err)
+	}
+	// Without a checksum there's no way to tell if the patch produced the right result.
+	if to.SHA256 == "" {
+		b.Debugf("Not using delta from %s, %s has no sha256", from, to)
+		return nil
+	}
+	if s.isCached(to) {
+		return nil
+	}
+	if err := s.resolveSHA256(b, from); err != nil {
+		return errors.WithStack(err)
+	}
+	if !s.isCached(from) {
+		b.Debugf("Not using delta from %s, it is not cached", from)
+		return nil
+	}
+	task := b.SubTask("delta")
+	task.Infof("Patching %s from %s", to, from)
+	patch, _, err := s.cache.Download(task, "", d.Source)
+	if err != nil {
+		return errors.Wrap(err, "could not retrieve patch")
+	}
+	// The patch is of no further use once applied.
+	defer s.cache.Evict(task, "", d.Source) // nolint: errcheck
+
+	dest := s.cache.Path(to.SHA256, to.Source)
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	tmp := dest + ".delta"
+	defer os.Remove(tmp) // nolint: errcheck
+	if err := delta.Apply(d.Format, s.cache.Path(from.SHA256, from.Source), patch, tmp); err != nil {
+		return errors.Wrap(err, d.Source)
+	}
+	sum, err := fileSHA256(tmp)
+	if err != nil {
+		return err
+	}
+	if sum != to.SHA256 {
+		return errors.Errorf("%s: patched source has sha256 %s but should have been %s", d.Source, sum, to.SHA256)
+	}
+	return errors.WithStack(os.Rename(tmp, dest))
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer f.Close() // nolint: gosec
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
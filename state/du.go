@@ -0,0 +1,80 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+)
+
+// PackageDiskUsage is the disk space used by a package.
+type PackageDiskUsage struct {
+	// Size of the extracted package, in bytes.
+	Extracted int64
+	// True if the package is extracted into the shared state directory rather than into an environment.
+	Shared bool
+	// Size of the package's download in the cache, in bytes.
+	Download int64
+	// Number of environments the package is known to be installed in.
+	Environments int
+}
+
+// DiskUsage returns the disk space used by a package.
+func (s *State) DiskUsage(b *ui.Task, p *manifest.Package) (PackageDiskUsage, error) {
+	usage := PackageDiskUsage{}
+	if err := s.resolveSHA256(b, p); err != nil {
+		return usage, errors.WithStack(err)
+	}
+	var err error
+	// Packages with a source of "/" have nothing to extract.
+	if p.Source != "/" {
+		if usage.Extracted, err = DiskUsage(p.Dest); err != nil {
+			return usage, errors.WithStack(err)
+		}
+	}
+	usage.Shared = isWithin(s.root, p.Dest)
+	if usage.Download, err = DiskUsage(s.cache.Path(p.SHA256, p.Source)); err != nil {
+		return usage, errors.WithStack(err)
+	}
+	binDirs, err := s.dao.GetKnownUsages(p.Reference.String())
+	if err != nil {
+		return usage, errors.WithStack(err)
+	}
+	for _, binDir := range binDirs {
+		exists, err := doesPackageExistAt(p.Reference.String(), binDir)
+		if err != nil {
+			return usage, errors.WithStack(err)
+		}
+		if exists {
+			usage.Environments++
+		}
+	}
+	return usage, nil
+}
+
+// DiskUsage returns the total size of the regular files under path, which need not exist.
+func DiskUsage(path string) (int64, error) {
+	var size int64
+	err := filepath.Walk(path, func(path string, info os.FileInfo, err error) error {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, errors.WithStack(err)
+}
+
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,242 @@
+package state
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+)
+
+// GCOptions control what GC removes.
+type GCOptions struct {
+	// Packages and downloads that have not been used for this long are removed.
+	UnusedFor time.Duration
+	// Report what would be removed without removing anything.
+	DryRun bool
+}
+
+// GCReport describes what GC removed, or would have removed in a dry run.
+type GCReport struct {
+	// Packages that were removed.
+	Packages []string
+	// Number of downloads removed from the cache.
+	Downloads int
+	// Disk space reclaimed, in bytes.
+	Reclaimed int64
+}
+
+// GC clears packages that have not been used for the given duration and are not referred to in any environment,
+// along with downloads that are older than it.
+func (s *State) GC(p *ui.UI, options GCOptions, pkgResolver func(b *ui.UI, selector manifest.Selector, syncOnMissing bool) (*manifest.Package, error)) (*GCReport, error) {
+	lock, err := s.acquireLock(p)
+	if err != nil {
+		return nil, err
+	}
+	defer lock.Release(p)
+
+	report := &GCReport{}
+	cutoff := time.Now().UTC().Add(-options.UnusedFor)
+	names, err := s.dao.GetPackageNames()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	tracked := map[string]bool{}
+	for _, name := range names {
+		tracked[name] = true
+	}
+
+	unused, err := s.dao.GetUnusedSince(cutoff)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for _, name := range unused {
+		task := p.Task(name)
+		binDirs, err := s.dao.GetKnownUsages(name)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		inUse := false
+		for _, binDir := range binDirs {
+			exists, err := doesPackageExistAt(name, binDir)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+			if exists {
+				inUse = true
+				continue
+			}
+			if options.DryRun {
+				continue
+			}
+			err = s.dao.PackageRemovedAt(name, binDir)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+		if inUse {
+			continue
+		}
+
+		delete(tracked, name)
+		if !options.DryRun {
+			task.Infof("Clearing %s", name)
+			err = s.dao.DeletePackage(name)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+		pkg, err := pkgResolver(p, manifest.ExactSelector(manifest.ParseReference(name)), false)
+		// This can occur if a package was at some point installed and tracked
+		// by the DB but now no longer exists in the manifests. Its files will
+		// be removed below along with any other untracked package.
+		if errors.Is(err, manifest.ErrUnknownPackage) {
+			continue
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if err = s.gcRemove(task, options, report, filepath.Join(s.binaryDir, pkg.Reference.String()), pkg.Dest); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		report.Packages = append(report.Packages, name)
+		tracked[name] = true // Don't visit it again as an untracked package.
+	}
+
+	if err := s.gcUntrackedPackages(p, options, report, cutoff, tracked); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := s.gcDownloads(p, options, report, cutoff); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return report, nil
+}
+
+// Remove extracted packages that are unknown to the DB and not referenced by any known environment.
+func (s *State) gcUntrackedPackages(p *ui.UI, options GCOptions, report *GCReport, cutoff time.Time, tracked map[string]bool) error {
+	referenced, err := s.referencedPackages()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	entries, err := os.ReadDir(s.pkgDir)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if strings.HasPrefix(name, "hermit@") || tracked[name] || referenced[name] {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if info.ModTime().After(cutoff) {
+			continue
+		}
+		task := p.Task(name)
+		if !options.DryRun {
+			task.Infof("Clearing untracked package %s", name)
+		}
+		if err := s.gcRemove(task, options, report, filepath.Join(s.binaryDir, name), filepath.Join(s.pkgDir, name)); err != nil {
+			return errors.WithStack(err)
+		}
+		report.Packages = append(report.Packages, name)
+	}
+	return nil
+}
+
+// Returns the set of packages installed in any environment known to the DB.
+func (s *State) referencedPackages() (map[string]bool, error) {
+	binDirs, err := s.dao.GetKnownEnvironments()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	referenced := map[string]bool{}
+	for _, binDir := range binDirs {
+		links, err := filepath.Glob(filepath.Join(binDir, ".*.pkg"))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		for _, link := range links {
+			referenced[strings.TrimSuffix(strings.TrimPrefix(filepath.Base(link), "."), ".pkg")] = true
+		}
+	}
+	return referenced, nil
+}
+
+// Remove downloads that were last modified before cutoff.
+//
+// Downloads are stored in the cache as <prefix>/<hash>-<name>, where prefix
+// is the first two characters of the hash. Anything else in the cache, such
+// as signature verification trust material, is left alone.
+func (s *State) gcDownloads(p *ui.UI, options GCOptions, report *GCReport, cutoff time.Time) error {
+	task := p.Task("cache")
+	prefixes, err := os.ReadDir(s.cacheDir)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	for _, prefix := range prefixes {
+		if !prefix.IsDir() || len(prefix.Name()) != 2 {
+			continue
+		}
+		dir := filepath.Join(s.cacheDir, prefix.Name())
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		for _, entry := range entries {
+			// Locks are removed along with their download.
+			if strings.HasSuffix(entry.Name(), ".lock") {
+				continue
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			if info.ModTime().After(cutoff) {
+				continue
+			}
+			task.Debugf("Clearing download %s", entry.Name())
+			path := filepath.Join(dir, entry.Name())
+			if err := s.gcRemove(task, options, report, path, path+".lock"); err != nil {
+				return errors.WithStack(err)
+			}
+			report.Downloads++
+		}
+	}
+	return nil
+}
+
+// Remove paths, adding their size to the report.
+func (s *State) gcRemove(task *ui.Task, options GCOptions, report *GCReport, paths ...string) error {
+	for _, path := range paths {
+		size, err := DiskUsage(path)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		report.Reclaimed += size
+		if options.DryRun {
+			continue
+		}
+		if err := s.removeRecursive(task, path); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	return nil
+}
+
+func doesPackageExistAt(name string, binDir string) (bool, error) {
+	file := filepath.Join(binDir, "."+name+".pkg")
+	_, err := os.Stat(file)
+	if err != nil && !os.IsNotExist(err) {
+		return false, errors.WithStack(err)
+	} else if err == nil {
+		return true, nil
+	}
+	return false, nil
+}
@@ -0,0 +1,142 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+	"github.com/cashapp/hermit/util"
+)
+
+// DefaultLockTimeout is how long to wait for a lock on the state held by another process.
+const DefaultLockTimeout = 30 * time.Second
+
+// Lock on the state held by a process.
+type Lock struct {
+	// Name of what is locked, either "state" for the whole state, or a package reference.
+	Name string
+	Path string
+	// Holder of the lock, if it is held exclusively and its holder is known.
+	Holder *util.LockHolder
+}
+
+// SetLockTimeout sets how long to wait for locks held by other processes before failing.
+func (s *State) SetLockTimeout(timeout time.Duration) {
+	s.lockTimeout = timeout
+}
+
+// Locks lists the locks currently held on the state directory at "stateDir".
+//
+// Operations on a single package hold the state lock shared, and the lock of
+// the package exclusively. Operations on the whole state, such as garbage
+// collection, hold the state lock exclusively.
+func Locks(stateDir string) ([]Lock, error) {
+	candidates := []Lock{{Name: "state", Path: filepath.Join(stateDir, ".lock")}}
+	entries, err := os.ReadDir(filepath.Join(stateDir, "locks"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.WithStack(err)
+	}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".lock") {
+			continue
+		}
+		candidates = append(candidates, Lock{
+			Name: strings.TrimSuffix(entry.Name(), ".lock"),
+			Path: filepath.Join(stateDir, "locks", entry.Name()),
+		})
+	}
+	var locks []Lock
+	for _, lock := range candidates {
+		holder, held, err := util.ReadLockHolder(lock.Path)
+		if err != nil {
+			return nil, errors.Wrap(err, lock.Path)
+		}
+		if held {
+			lock.Holder = holder
+			locks = append(locks, lock)
+		}
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Name < locks[j].Name })
+	return locks, nil
+}
+
+// Acquire the state lock exclusively, for operations that affect every package.
+func (s *State) acquireLock(log ui.Logger) (*util.FileLock, error) {
+	return s.acquire(log, s.lock, s.lock.Acquire)
+}
+
+// Acquire the state lock shared, for operations that don't conflict with each other.
+func (s *State) acquireSharedLock(log ui.Logger) (*util.FileLock, error) {
+	return s.acquire(log, s.lock, s.lock.AcquireShared)
+}
+
+// Lock a package against concurrent modification, returning a function that releases the lock.
+//
+// The state lock is also held shared, so that operations on different packages can proceed
+// concurrently, but not alongside operations on the whole state. The package lock is not
+// reentrant, even for the same goroutine.
+func (s *State) lockPackage(log ui.Logger, p *manifest.Package) (func(), error) {
+	stateLock, err := s.acquireSharedLock(log)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(s.locksDir, 0700); err != nil {
+		stateLock.Release(log)
+		return nil, errors.WithStack(err)
+	}
+	name := p.Reference.String()
+	s.pkgLocksMu.Lock()
+	lock, ok := s.pkgLocks[name]
+	if !ok {
+		lock = &packageLock{
+			held: make(chan struct{}, 1),
+			file: util.NewLock(filepath.Join(s.locksDir, name+".lock"), 100*time.Millisecond),
+		}
+		s.pkgLocks[name] = lock
+	}
+	s.pkgLocksMu.Unlock()
+	// The file lock is shared by every goroutine in this process, so exclude the others first.
+	ctx, cancel := context.WithTimeout(context.Background(), s.lockTimeout)
+	select {
+	case lock.held <- struct{}{}:
+		cancel()
+	case <-ctx.Done():
+		cancel()
+		stateLock.Release(log)
+		return nil, errors.New("failed to acquire lock: timeout while waiting for the lock")
+	}
+	if _, err := s.acquire(log, lock.file, lock.file.Acquire); err != nil {
+		<-lock.held
+		stateLock.Release(log)
+		return nil, err
+	}
+	return func() {
+		lock.file.Release(log)
+		<-lock.held
+		stateLock.Release(log)
+	}, nil
+}
+
+// Lock on a package, held by at most one goroutine of one process.
+type packageLock struct {
+	held chan struct{}
+	file *util.FileLock
+}
+
+func (s *State) acquire(log ui.Logger, lock *util.FileLock, acquire func(context.Context, ui.Logger) error) (*util.FileLock, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.lockTimeout)
+	err := acquire(ctx, log)
+	cancel()
+	if err != nil {
+		return nil, fmt.Errorf("failed to acquire lock: %w", err)
+	}
+	return lock, nil
+}
@@ -0,0 +1,79 @@
+package state
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+)
+
+// ProvenanceReason is why a package was installed in an environment.
+type ProvenanceReason string
+
+// Reasons a package was installed.
+const (
+	// The package was requested explicitly, eg. with "hermit install jq".
+	ProvenanceDirect ProvenanceReason = "direct"
+	// The package was installed to satisfy the requirements of another package.
+	ProvenanceDependency ProvenanceReason = "dependency"
+	// The package replaced an older version with "hermit upgrade".
+	ProvenanceUpgrade ProvenanceReason = "upgrade"
+	// The package replaced a newer version with "hermit rollback".
+	ProvenanceRollback ProvenanceReason = "rollback"
+)
+
+// Provenance records how a package was installed in an environment.
+type Provenance struct {
+	Reason ProvenanceReason `json:"reason"`
+	// Reference of the package that required it, for dependencies and for upgrades and rollbacks of them.
+	RequiredBy string `json:"requiredBy,omitempty"`
+	// Reference of the version of the package it replaced, if any.
+	Replaced string `json:"replaced,omitempty"`
+	// Path of the manifest the package was resolved from.
+	Manifest string `json:"manifest,omitempty"`
+	// Command line that installed it.
+	Command string    `json:"command,omitempty"`
+	Time    time.Time `json:"time"`
+	// When a new release of a channel package was last fetched, if that happened after it was installed.
+	//
+	// This is not recorded per environment, as channel packages are shared between environments.
+	ChannelUpdatedAt time.Time `json:"-"`
+}
+
+// RecordProvenance records how a package was installed in the bin directory "binDir".
+func (s *State) RecordProvenance(pkg *manifest.Package, binDir string, provenance Provenance) error {
+	data, err := json.Marshal(provenance)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(s.dao.PutProvenance(pkg.Reference.String(), binDir, data))
+}
+
+// Provenance returns how a package was installed in the bin directory
+// "binDir", or nil if that wasn't recorded, eg. because the package was
+// installed by an older version of Hermit.
+func (s *State) Provenance(pkg *manifest.Package, binDir string) (*Provenance, error) {
+	data, err := s.dao.GetProvenance(pkg.Reference.String(), binDir)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if data == nil {
+		return nil, nil
+	}
+	provenance := &Provenance{}
+	if err := json.Unmarshal(data, provenance); err != nil {
+		return nil, errors.Wrapf(err, "invalid provenance for %s", pkg)
+	}
+	if pkg.Reference.IsChannel() {
+		dbInfo, err := s.dao.GetPackage(pkg.Reference.String())
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if dbInfo != nil && dbInfo.FetchedAt.After(provenance.Time) {
+			provenance.ChannelUpdatedAt = dbInfo.FetchedAt
+		}
+	}
+	return provenance, nil
+}
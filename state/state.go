@@ -2,21 +2,28 @@ package state
 
 import (
 	"context"
-	"fmt"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"regexp"
 	"runtime"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
+	multierror "go.uber.org/multierr"
 
 	"github.com/cashapp/hermit/archive"
 	"github.com/cashapp/hermit/cache"
+	"github.com/cashapp/hermit/events"
 	"github.com/cashapp/hermit/internal/dao"
 	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/retry"
+	"github.com/cashapp/hermit/sigstore"
 	"github.com/cashapp/hermit/sources"
 	"github.com/cashapp/hermit/ui"
 	"github.com/cashapp/hermit/util"
@@ -48,6 +55,12 @@ type Config struct {
 	AutoMirrors []AutoMirror
 	// Builtin sources.
 	Builtin *sources.BuiltInSource
+	// Verifier for cosign signatures of packages. Defaults to one using the public Sigstore instance.
+	Sigstore *sigstore.Verifier
+	// Events of package operations, for applications embedding Hermit. Defaults to a Bus with no handlers.
+	Events *events.Bus
+	// Retrier for syncing git manifest sources. Nil disables retries.
+	Retrier *retry.Retrier
 }
 
 // State is the global hermit state shared between all local environments
@@ -60,8 +73,15 @@ type State struct {
 	config      Config
 	autoMirrors []precompiledAutoMirror
 	cache       *cache.Cache
+	offline     bool
+	skipVerify  bool
 	dao         *dao.DAO
 	lock        *util.FileLock
+	lockTimeout time.Duration
+	locksDir    string // Path to per-package lock files.
+
+	pkgLocksMu sync.Mutex
+	pkgLocks   map[string]*packageLock
 }
 
 // Open the global Hermit state.
@@ -81,6 +101,21 @@ func Open(stateDir string, config Config, cache *cache.Cache) (*State, error) {
 		config.Sources = DefaultSources
 	}
 
+	if config.Sigstore == nil {
+		// Rekor entries are verified against the built-in trust roots, so the client needn't be trusted.
+		config.Sigstore = sigstore.New(http.DefaultClient)
+	}
+
+	if config.Events == nil {
+		config.Events = events.New()
+	}
+	if cache != nil {
+		bus := config.Events
+		cache.SetProgress(func(uri string, downloaded, total int64) {
+			bus.EmitDownloadProgress(events.DownloadProgress{URL: uri, Downloaded: downloaded, Total: total})
+		})
+	}
+
 	autoMirrors, err := validateAndCompileAutoMirrors(config)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -97,6 +132,9 @@ func Open(stateDir string, config Config, cache *cache.Cache) (*State, error) {
 		pkgDir:      pkgDir,
 		cache:       cache,
 		lock:        util.NewLock(filepath.Join(stateDir, ".lock"), 1*time.Second),
+		lockTimeout: DefaultLockTimeout,
+		locksDir:    filepath.Join(stateDir, "locks"),
+		pkgLocks:    map[string]*packageLock{},
 	}
 	return s, nil
 }
@@ -163,6 +201,38 @@ func (s *State) Config() Config {
 	return s.config
 }
 
+// Events returns the bus that package operations are reported to.
+func (s *State) Events() *events.Bus {
+	return s.config.Events
+}
+
+// SetOffline prevents the state from accessing the network, so that only
+// previously synchronised manifests and cached packages are used.
+func (s *State) SetOffline(offline bool) {
+	s.offline = offline
+	s.cache.SetOffline(offline)
+}
+
+// SetInsecureSkipVerify installs packages without verifying their cosign signatures.
+func (s *State) SetInsecureSkipVerify(skip bool) {
+	s.skipVerify = skip
+}
+
+// InsecureSkipVerify returns true if packages are installed without verifying their signatures.
+func (s *State) InsecureSkipVerify() bool {
+	return s.skipVerify
+}
+
+// Context returns the context that network operations of the state are cancelled with.
+func (s *State) Context() context.Context {
+	return s.cache.Context()
+}
+
+// Offline returns true if the state may not access the network.
+func (s *State) Offline() bool {
+	return s.offline
+}
+
 // SourcesDir returns the global directory for manifests
 func (s *State) SourcesDir() string {
 	return s.sourcesDir
@@ -202,19 +272,12 @@ func (s *State) Sources(l *ui.UI) (*sources.Sources, error) {
 		return nil, errors.WithStack(err)
 	}
 	ss.Prepend(s.config.Builtin)
+	ss.SetOffline(s.offline)
+	ss.SetRetrier(s.config.Retrier)
+	ss.SetContext(s.Context())
 	return ss, nil
 }
 
-func (s *State) acquireLock(log ui.Logger) (*util.FileLock, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	err := s.lock.Acquire(ctx, log)
-	cancel()
-	if err != nil {
-		return nil, fmt.Errorf("failed to acquire lock: %w", err)
-	}
-	return s.lock, nil
-}
-
 // ReadPackageState updates the package fields from the global database
 func (s *State) ReadPackageState(pkg *manifest.Package) {
 	if _, err := os.Stat(pkg.Root); err == nil {
@@ -257,12 +320,6 @@ func (s *State) removeRecursive(b *ui.Task, dest string) error {
 	}
 
 	task := b.SubTask("remove")
-	lock, err := s.acquireLock(b)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	defer lock.Release(b)
-
 	task.Debugf("chmod -R +w %s", dest)
 	_ = filepath.Walk(dest, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -288,12 +345,16 @@ func (s *State) CacheAndUnpack(b *ui.Task, p *manifest.Package) error {
 		return nil
 	}
 
-	lock, err := s.acquireLock(b)
+	release, err := s.lockPackage(b, p)
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	defer lock.Release(b)
+	defer release()
+	return s.cacheAndUnpack(b, p)
+}
 
+// CacheAndUnpack with the package lock held.
+func (s *State) cacheAndUnpack(b *ui.Task, p *manifest.Package) error {
 	if !s.isExtracted(p) {
 		if err := s.extract(b, p); err != nil {
 			return errors.WithStack(err)
@@ -309,6 +370,34 @@ func (s *State) CacheAndUnpack(b *ui.Task, p *manifest.Package) error {
 	return nil
 }
 
+// Unpack downloads a package, verifying its checksum and signature, and extracts it into its Dest.
+//
+// Unlike CacheAndUnpack, the package is always extracted and its binaries are not linked, so its Dest
+// may be outside the state directory.
+func (s *State) Unpack(b *ui.Task, p *manifest.Package) error {
+	if p.Source == "/" {
+		return nil
+	}
+	lock, err := s.acquireSharedLock(b)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer lock.Release(b)
+	return s.extract(b, p)
+}
+
+// RemoveUnpacked removes a directory that packages were unpacked into with Unpack.
+//
+// Unpacked packages are read-only, so they can't be removed with os.RemoveAll.
+func (s *State) RemoveUnpacked(b *ui.Task, dir string) error {
+	lock, err := s.acquireSharedLock(b)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer lock.Release(b)
+	return s.removeRecursive(b, dir)
+}
+
 func (s *State) linkBinaries(p *manifest.Package) error {
 	dir := filepath.Join(s.binaryDir, p.Reference.String())
 	if err := os.MkdirAll(dir, 0700); err != nil {
@@ -329,22 +418,97 @@ func (s *State) linkBinaries(p *manifest.Package) error {
 	return nil
 }
 
-func (s *State) extract(b *ui.Task, p *manifest.Package) error {
+// DownloadAll downloads the sources of "pkgs" into the cache, at most "parallelism" at a time.
+//
+// Packages that are already extracted are skipped. The state lock is not
+// held while downloading, so CacheAndUnpack must still be called to extract
+// each package.
+func (s *State) DownloadAll(l *ui.UI, pkgs []*manifest.Package, parallelism int) error {
+	if parallelism < 1 {
+		parallelism = 1
+	}
 	var (
-		path string
-		etag string
-		err  error
+		wg    sync.WaitGroup
+		lock  sync.Mutex
+		errs  error
+		slots = make(chan struct{}, parallelism)
 	)
-
-	if !s.isCached(p) {
-		mirrors := append(p.Mirrors, s.generateMirrors(p.Source)...)
-		path, etag, err = s.cache.Download(b, p.SHA256, p.Source, mirrors...)
-		p.ETag = etag
-		if err != nil {
-			return errors.WithStack(err)
+	for _, pkg := range pkgs {
+		if pkg.Source == "/" || pkg.EnsureSupported() != nil || s.isExtracted(pkg) {
+			continue
 		}
-	} else {
-		path = s.cache.Path(p.SHA256, p.Source)
+		pkg := pkg
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			task := l.Task(pkg.Reference.String())
+			defer task.Done()
+			if _, err := s.fetch(task, pkg); err != nil {
+				lock.Lock()
+				errs = multierror.Append(errs, errors.Wrap(err, pkg.String()))
+				lock.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errs
+}
+
+// Digest returns the SHA256 of a package's source, downloading it into the
+// cache if the SHA256 is not otherwise known.
+//
+// An empty digest is returned for sources that are not files, eg. Git repositories.
+func (s *State) Digest(b *ui.Task, p *manifest.Package) (string, error) {
+	if p.Source == "/" {
+		return "", nil
+	}
+	if p.SHA256 != "" {
+		return p.SHA256, nil
+	}
+	path, err := s.fetch(b, p)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	defer f.Close() // nolint: gosec
+	if info, err := f.Stat(); err != nil {
+		return "", errors.WithStack(err)
+	} else if info.IsDir() {
+		return "", nil
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", errors.WithStack(err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Download the source of a package into the cache if it is not already cached, returning its path.
+func (s *State) fetch(b *ui.Task, p *manifest.Package) (string, error) {
+	if err := s.resolveSHA256(b, p); err != nil {
+		return "", errors.WithStack(err)
+	}
+	if s.isCached(p) {
+		return s.cache.Path(p.SHA256, p.Source), nil
+	}
+	mirrors := append(p.Mirrors, s.generateMirrors(p.Source)...)
+	path, etag, err := s.cache.Download(b, p.SHA256, p.Source, mirrors...)
+	p.ETag = etag
+	return path, errors.WithStack(err)
+}
+
+func (s *State) extract(b *ui.Task, p *manifest.Package) error {
+	path, err := s.fetch(b, p)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := s.verifySignature(b, p, path); err != nil {
+		return errors.WithStack(err)
 	}
 
 	finalise, err := archive.Extract(b, path, p)
@@ -446,8 +610,13 @@ func (s *State) UpgradeChannel(b *ui.Task, pkg *manifest.Package) error {
 	}
 
 	name := pkg.Reference.String()
+	if s.offline {
+		b.Debugf("Offline, not checking for updates to %s", name)
+		return nil
+	}
 	mirrors := append(pkg.Mirrors, s.generateMirrors(pkg.Source)...)
 
+	var fetchedAt time.Time
 	etag, err := s.cache.ETag(b, pkg.Source, mirrors...)
 	if err != nil {
 		b.Warnf("Could not check updates for %s. Skipping update. Error: %s", name, err)
@@ -455,13 +624,21 @@ func (s *State) UpgradeChannel(b *ui.Task, pkg *manifest.Package) error {
 		b.Warnf("No ETag found for %s. Skipping update.", name)
 	} else if etag != pkg.ETag {
 		b.Infof("Fetching a new version for %s", name)
-		if err := s.evictPackage(b, pkg); err != nil {
+		// Hold the package lock across eviction and unpacking, so that other processes don't use it in between.
+		release, err := s.lockPackage(b, pkg)
+		if err != nil {
 			return errors.WithStack(err)
 		}
-		if err := s.CacheAndUnpack(b, pkg); err != nil {
+		err = s.evictPackage(b, pkg)
+		if err == nil {
+			err = s.cacheAndUnpack(b, pkg)
+		}
+		release()
+		if err != nil {
 			return errors.WithStack(err)
 		}
 		etag = pkg.ETag
+		fetchedAt = time.Now()
 	} else {
 		b.Infof("No updated required")
 	}
@@ -475,75 +652,11 @@ func (s *State) UpgradeChannel(b *ui.Task, pkg *manifest.Package) error {
 		UsedAt:          time.Now(),
 		Etag:            etag,
 		UpdateCheckedAt: time.Now(),
+		FetchedAt:       fetchedAt,
 	}
 	return errors.WithStack(s.dao.UpdatePackage(name, dpkg))
 }
 
-// GC clears packages that have not been used for the given duration and are not referred to in any environment
-func (s *State) GC(p *ui.UI, age time.Duration, pkgResolver func(b *ui.UI, selector manifest.Selector, syncOnMissing bool) (*manifest.Package, error)) error {
-	lock, err := s.acquireLock(p)
-	if err != nil {
-		return err
-	}
-	defer lock.Release(p)
-
-	err = s.CleanCache(p)
-	if err != nil {
-		return errors.WithStack(err)
-	}
-
-	unused, err := s.dao.GetUnusedSince(time.Now().UTC().Add(-age))
-	if err != nil {
-		return errors.WithStack(err)
-	}
-	for _, name := range unused {
-		task := p.Task(name)
-		binDirs, err := s.dao.GetKnownUsages(name)
-		if err != nil {
-			return errors.WithStack(err)
-		}
-		inUse := false
-		for _, binDir := range binDirs {
-			exists, err := doesPackageExistAt(name, binDir)
-			if err != nil {
-				return errors.WithStack(err)
-			}
-			if exists {
-				inUse = true
-				continue
-			}
-			err = s.dao.PackageRemovedAt(name, binDir)
-			if err != nil {
-				return errors.WithStack(err)
-			}
-		}
-		if inUse {
-			continue
-		}
-
-		task.Infof("Clearing %s", name)
-		err = s.dao.DeletePackage(name)
-		if err != nil {
-			return errors.WithStack(err)
-		}
-		pkg, err := pkgResolver(p, manifest.ExactSelector(manifest.ParseReference(name)), false)
-		// This can occur if a package was at some point installed and tracked
-		// by the DB but now no longer exists in the manifests.
-		if errors.Is(err, manifest.ErrUnknownPackage) {
-			// TODO: Save paths to on-disk resources to the DB and remove them here as well
-			continue
-		}
-		if err != nil {
-			return errors.WithStack(err)
-		}
-
-		if err = s.removePackage(task, pkg); err != nil {
-			return errors.WithStack(err)
-		}
-	}
-	return nil
-}
-
 func (s *State) removePackage(task *ui.Task, pkg *manifest.Package) error {
 	err := s.removeRecursive(task, filepath.Join(s.binaryDir, pkg.Reference.String()))
 	if err != nil {
@@ -557,13 +670,11 @@ func (s *State) removePackage(task *ui.Task, pkg *manifest.Package) error {
 	return nil
 }
 
+// Evict a package from the cache and remove it, with the package lock held.
 func (s *State) evictPackage(b *ui.Task, pkg *manifest.Package) error {
-	lock, err := s.acquireLock(b)
-	if err != nil {
+	if err := s.resolveSHA256(b, pkg); err != nil {
 		return errors.WithStack(err)
 	}
-	defer lock.Release(b)
-
 	if err := s.cache.Evict(b, pkg.SHA256, pkg.Source); err != nil {
 		return errors.WithStack(err)
 	}
@@ -587,14 +698,3 @@ func (s *State) generateMirrors(url string) (mirrors []string) {
 	}
 	return
 }
-
-func doesPackageExistAt(name string, binDir string) (bool, error) {
-	file := filepath.Join(binDir, "."+name+".pkg")
-	_, err := os.Stat(file)
-	if err != nil && !os.IsNotExist(err) {
-		return false, errors.WithStack(err)
-	} else if err == nil {
-		return true, nil
-	}
-	return false, nil
-}
@@ -1,17 +1,27 @@
 package state_test
 
 import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/cashapp/hermit/cache"
 	"github.com/cashapp/hermit/manifest"
 	"github.com/cashapp/hermit/manifest/manifesttest"
+	"github.com/cashapp/hermit/state"
 	"github.com/cashapp/hermit/ui"
+	"github.com/cashapp/hermit/util"
 )
 
 func TestCacheAndUnpackDownloadsOnlyWhenNeeded(t *testing.T) {
@@ -98,3 +108,302 @@ func TestCacheAndUnpackCreatesBinarySymlinks(t *testing.T) {
 	require.FileExists(t, filepath.Join(state.BinaryDir(), pkg.Reference.String(), "darwin_exe"))
 	require.FileExists(t, filepath.Join(state.BinaryDir(), pkg.Reference.String(), "linux_exe"))
 }
+
+func TestCacheAndUnpackResolvesSHA256FromChecksumFile(t *testing.T) {
+	sha := "a5a8c2021836bc43d2f76d1e68fe4e2300a38c98527c260e94603d22333996a5"
+	fixture := NewStateTestFixture(t).
+		WithHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/SHA256SUMS":
+				_, _ = io.WriteString(w, sha+"  archive.tar.gz\n")
+			case "/BADSUMS":
+				_, _ = io.WriteString(w, strings.Repeat("0", 64)+"  archive.tar.gz\n")
+			default:
+				http.ServeFile(w, r, "../archive/testdata/archive.tar.gz")
+			}
+		}))
+	defer fixture.Clean()
+	state := fixture.State()
+
+	log, _ := ui.NewForTesting()
+	pkg := manifesttest.NewPkgBuilder(state.PkgDir()).WithSource(fixture.Server.URL + "/archive.tar.gz").Result()
+	pkg.SHA256Source = fixture.Server.URL + "/BADSUMS"
+	err := state.CacheAndUnpack(log.Task("test"), pkg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "should have been "+strings.Repeat("0", 64))
+
+	pkg = manifesttest.NewPkgBuilder(state.PkgDir()).WithSource(fixture.Server.URL + "/archive.tar.gz").Result()
+	pkg.SHA256Source = fixture.Server.URL + "/SHA256SUMS"
+	require.NoError(t, state.CacheAndUnpack(log.Task("test"), pkg))
+	require.Equal(t, sha, pkg.SHA256)
+}
+
+func TestCacheAndUnpackVerifiesCosignSignature(t *testing.T) {
+	fixture := NewStateTestFixture(t).
+		WithHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/archive.tar.gz.bundle":
+				_, _ = io.WriteString(w, `{"base64Signature": "", "cert": ""}`)
+			default:
+				http.ServeFile(w, r, "../archive/testdata/archive.tar.gz")
+			}
+		}))
+	defer fixture.Clean()
+	state := fixture.State()
+
+	log, _ := ui.NewForTesting()
+	pkg := manifesttest.NewPkgBuilder(state.PkgDir()).WithSource(fixture.Server.URL + "/archive.tar.gz").Result()
+	pkg.CosignBundle = fixture.Server.URL + "/archive.tar.gz.bundle"
+	err := state.CacheAndUnpack(log.Task("test"), pkg)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cosign verification failed, use --insecure-skip-verify to install anyway")
+	require.NoDirExists(t, pkg.Root)
+
+	state.SetInsecureSkipVerify(true)
+	require.NoError(t, state.CacheAndUnpack(log.Task("test"), pkg))
+}
+
+func TestDownloadAllCoalescesDuplicateSources(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		calls = map[string]int{}
+	)
+	fixture := NewStateTestFixture(t).
+		WithHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			calls[r.URL.Path]++
+			lock.Unlock()
+			http.ServeFile(w, r, "../archive/testdata/archive.tar.gz")
+		}))
+	defer fixture.Clean()
+	state := fixture.State()
+
+	log, _ := ui.NewForTesting()
+	pkgs := []*manifest.Package{}
+	for _, name := range []string{"a", "b", "c"} {
+		source := "/shared.tar.gz"
+		if name == "c" {
+			source = "/other.tar.gz"
+		}
+		pkgs = append(pkgs, manifesttest.NewPkgBuilder(filepath.Join(state.PkgDir(), name)).
+			WithName(name).
+			WithSource(fixture.Server.URL+source).
+			Result())
+	}
+	require.NoError(t, state.DownloadAll(log, pkgs, 3))
+	require.Equal(t, map[string]int{"/shared.tar.gz": 1, "/other.tar.gz": 1}, calls)
+
+	for _, pkg := range pkgs {
+		require.NoError(t, state.CacheAndUnpack(log.Task(pkg.String()), pkg))
+	}
+	require.Equal(t, map[string]int{"/shared.tar.gz": 1, "/other.tar.gz": 1}, calls)
+}
+
+func TestBundleInstallsOffline(t *testing.T) {
+	calls := 0
+	exporter := NewStateTestFixture(t).
+		WithHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			http.ServeFile(w, r, "../archive/testdata/archive.tar.gz")
+		}))
+	defer exporter.Clean()
+	source := exporter.State()
+	require.NoError(t, os.MkdirAll(filepath.Join(source.SourcesDir(), "repo"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(source.SourcesDir(), "repo", "test.hcl"), []byte(`description = ""`), 0600))
+
+	log, _ := ui.NewForTesting()
+	pkg := manifesttest.NewPkgBuilder(filepath.Join(source.PkgDir(), "test")).WithSource(exporter.Server.URL + "/test.tar.gz").Result()
+	bundle := &bytes.Buffer{}
+	require.NoError(t, source.ExportBundle(log, []*manifest.Package{pkg}, bundle))
+	require.Equal(t, 1, calls)
+
+	importer := NewStateTestFixture(t)
+	defer importer.Clean()
+	dest := importer.State()
+	dest.SetOffline(true)
+	require.NoError(t, dest.ImportBundle(log, bundle))
+	data, err := os.ReadFile(filepath.Join(dest.SourcesDir(), "repo", "test.hcl"))
+	require.NoError(t, err)
+	require.Equal(t, `description = ""`, string(data))
+
+	pkg = manifesttest.NewPkgBuilder(filepath.Join(dest.PkgDir(), "test")).WithSource(exporter.Server.URL + "/test.tar.gz").Result()
+	require.NoError(t, dest.CacheAndUnpack(log.Task("test"), pkg))
+	require.Equal(t, 1, calls)
+
+	missing := manifesttest.NewPkgBuilder(filepath.Join(dest.PkgDir(), "missing")).WithName("missing").WithSource(exporter.Server.URL + "/missing.tar.gz").Result()
+	err = dest.CacheAndUnpack(log.Task("missing"), missing)
+	require.ErrorIs(t, err, cache.ErrOffline)
+	require.Equal(t, 1, calls)
+}
+
+func TestFetchDeltaPatchesCachedSource(t *testing.T) {
+	var (
+		lock  sync.Mutex
+		calls = map[string]int{}
+	)
+	files := map[string]string{
+		"/old.txt":     "../delta/testdata/old.txt",
+		"/new.txt":     "../delta/testdata/new.txt",
+		"/patch":       "../delta/testdata/old-to-new.bsdiff",
+		"/wrong-patch": "../delta/testdata/old-to-new.bsdiff",
+	}
+	fixture := NewStateTestFixture(t).
+		WithHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			calls[r.URL.Path]++
+			lock.Unlock()
+			http.ServeFile(w, r, files[r.URL.Path])
+		}))
+	defer fixture.Clean()
+	state := fixture.State()
+	log, _ := ui.NewForTesting()
+
+	from := manifesttest.NewPkgBuilder(filepath.Join(state.PkgDir(), "test-1.0.0")).
+		WithVersion("1.0.0").
+		WithSource(fixture.Server.URL + "/old.txt").
+		WithSHA256(fileSHA256(t, "../delta/testdata/old.txt")).
+		Result()
+	require.NoError(t, state.DownloadAll(log, []*manifest.Package{from}, 1))
+
+	to := manifesttest.NewPkgBuilder(filepath.Join(state.PkgDir(), "test-1.1.0")).
+		WithVersion("1.1.0").
+		WithSource(fixture.Server.URL + "/new.txt").
+		WithSHA256(fileSHA256(t, "../delta/testdata/new.txt")).
+		Result()
+	to.Deltas = []manifest.Delta{{From: "1.0.0", Source: fixture.Server.URL + "/patch", Format: "bsdiff"}}
+	require.NoError(t, state.FetchDelta(log.Task("test"), from, to))
+	require.NoError(t, state.DownloadAll(log, []*manifest.Package{to}, 1))
+	require.Equal(t, map[string]int{"/old.txt": 1, "/patch": 1}, calls)
+
+	// A patch that doesn't produce the expected source is rejected, and the source is downloaded in full.
+	other := manifesttest.NewPkgBuilder(filepath.Join(state.PkgDir(), "test-1.2.0")).
+		WithVersion("1.2.0").
+		WithSource(fixture.Server.URL + "/old.txt?v=1.2.0").
+		WithSHA256(fileSHA256(t, "../delta/testdata/old.txt")).
+		Result()
+	other.Deltas = []manifest.Delta{{From: "1.0.0", Source: fixture.Server.URL + "/wrong-patch", Format: "bsdiff"}}
+	err := state.FetchDelta(log.Task("test"), from, other)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "patched source has sha256")
+	require.NoError(t, state.DownloadAll(log, []*manifest.Package{other}, 1))
+	require.Equal(t, map[string]int{"/old.txt": 2, "/patch": 1, "/wrong-patch": 1}, calls)
+}
+
+func fileSHA256(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestDiskUsage(t *testing.T) {
+	fixture := NewStateTestFixture(t).
+		WithHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, "../archive/testdata/archive.tar.gz")
+		}))
+	defer fixture.Clean()
+	state := fixture.State()
+	log, _ := ui.NewForTesting()
+
+	pkg := manifesttest.NewPkgBuilder(filepath.Join(state.PkgDir(), "test")).WithSource(fixture.Server.URL + "/archive.tar.gz").Result()
+	require.NoError(t, state.CacheAndUnpack(log.Task("test"), pkg))
+	info, err := os.Stat("../archive/testdata/archive.tar.gz")
+	require.NoError(t, err)
+	usage, err := state.DiskUsage(log.Task("test"), pkg)
+	require.NoError(t, err)
+	require.True(t, usage.Shared)
+	require.Equal(t, info.Size(), usage.Download)
+	require.Greater(t, usage.Extracted, int64(0))
+
+	// Packages extracted outside the state directory are not shared.
+	dest := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dest, "bin"), []byte("local"), 0600))
+	local := manifesttest.NewPkgBuilder(dest).WithSource(fixture.Server.URL + "/local.tar.gz").Result()
+	usage, err = state.DiskUsage(log.Task("local"), local)
+	require.NoError(t, err)
+	require.False(t, usage.Shared)
+	require.Equal(t, int64(len("local")), usage.Extracted)
+	require.Equal(t, int64(0), usage.Download)
+}
+
+func TestCacheAndUnpackWaitsForPackageLock(t *testing.T) {
+	fixture := NewStateTestFixture(t).
+		WithHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, "../archive/testdata/archive.tar.gz")
+		}))
+	defer fixture.Clean()
+	sta := fixture.State()
+	sta.SetLockTimeout(50 * time.Millisecond)
+
+	log, _ := ui.NewForTesting()
+	pkg := manifesttest.NewPkgBuilder(sta.PkgDir()).WithSource(fixture.Server.URL).Result()
+
+	// Another process holding the package's lock.
+	path := filepath.Join(sta.Root(), "locks", pkg.Reference.String()+".lock")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	other := util.NewLock(path, time.Millisecond)
+	require.NoError(t, other.Acquire(context.Background(), log))
+
+	locks, err := state.Locks(sta.Root())
+	require.NoError(t, err)
+	require.Len(t, locks, 1)
+	require.Equal(t, pkg.Reference.String(), locks[0].Name)
+	require.NotNil(t, locks[0].Holder)
+	require.Equal(t, os.Getpid(), locks[0].Holder.PID)
+
+	err = sta.CacheAndUnpack(log.Task("test"), pkg)
+	require.EqualError(t, err, "failed to acquire lock: timeout while waiting for the lock")
+
+	other.Release(log)
+	require.NoError(t, sta.CacheAndUnpack(log.Task("test"), pkg))
+	locks, err = state.Locks(sta.Root())
+	require.NoError(t, err)
+	require.Empty(t, locks)
+}
+
+func TestCacheAndUnpackLocksPackageWithinProcess(t *testing.T) {
+	var (
+		lock   sync.Mutex
+		calls  int
+		active int
+		most   int
+	)
+	fixture := NewStateTestFixture(t).
+		WithHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			lock.Lock()
+			calls++
+			active++
+			if active > most {
+				most = active
+			}
+			lock.Unlock()
+			time.Sleep(50 * time.Millisecond)
+			http.ServeFile(w, r, "../archive/testdata/archive.tar.gz")
+			lock.Lock()
+			active--
+			lock.Unlock()
+		}))
+	defer fixture.Clean()
+	sta := fixture.State()
+
+	log, _ := ui.NewForTesting()
+	source := fixture.Server.URL
+	wg := sync.WaitGroup{}
+	errs := make(chan error, 4)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			pkg := manifesttest.NewPkgBuilder(sta.PkgDir()).WithSource(source).Result()
+			errs <- sta.CacheAndUnpack(log.Task("test"), pkg)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1, most)
+	require.Equal(t, 1, calls)
+}
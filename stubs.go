@@ -0,0 +1,182 @@
+package hermit
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+	"github.com/cashapp/hermit/ui"
+	"github.com/cashapp/hermit/util"
+)
+
+// Creating symlinks on Windows requires elevated privileges, so there package
+// binaries are linked into the environment as "<binary>.exe" stubs instead.
+//
+// Stubs are hard links to, or copies of, the Hermit executable, which
+// executes the corresponding package binary when run as a stub. The package
+// link ".<pkg>.pkg" is then a regular file listing the package's binaries,
+// one per line.
+//
+// Only package links are added to git, as stubs are recreated by "hermit install".
+var useExeStubs = runtime.GOOS == "windows"
+
+// The Hermit executable that stubs are created from.
+var stubSource = os.Executable
+
+// IsExeStub returns true if "executable" is a stub for a package binary.
+//
+// This is always false on platforms that use symlinks.
+func IsExeStub(executable string) bool {
+	if !useExeStubs {
+		return false
+	}
+	_, _, err := findStubPackageLink(executable)
+	return err == nil
+}
+
+// RestoreStubs recreates the stubs for the binaries of an installed package.
+//
+// This is a no-op on platforms that use symlinks.
+func (e *Env) RestoreStubs(l *ui.UI, pkg *manifest.Package) error {
+	if !useExeStubs {
+		return nil
+	}
+	files, err := pkg.ResolveBinaries()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	task := l.Task(pkg.Reference.String()).SubProgress("link", len(files))
+	defer task.Done()
+	return e.linkStubs(task, pkg, files)
+}
+
+// Returns the name of the stub for a package binary.
+func stubName(binary string) string {
+	name := filepath.Base(binary)
+	if strings.EqualFold(filepath.Ext(name), ".exe") {
+		return name
+	}
+	return name + ".exe"
+}
+
+// Write the package link for "pkg" and a stub for each of its binaries.
+func (e *Env) linkStubs(task *ui.Task, pkg *manifest.Package, files []string) error {
+	pkgLink := e.pkgLink(pkg)
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, filepath.Base(file))
+	}
+	task.Debugf("Writing %s", pkgLink)
+	if err := ioutil.WriteFile(pkgLink, []byte(strings.Join(names, "\n")+"\n"), 0600); err != nil {
+		return errors.Wrapf(err, "failed to create package link %s", util.RelPathCWD(pkgLink))
+	}
+	if e.useGit {
+		if err := util.RunInDir(task, e.envDir, "git", "add", "-f", pkgLink); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	for _, name := range names {
+		task.Add(1)
+		stub := filepath.Join(e.binDir, stubName(name))
+		if err := writeStub(task, stub); err != nil {
+			return errors.Wrapf(err, "failed to create binary stub %s", util.RelPathCWD(stub))
+		}
+	}
+	return nil
+}
+
+// Create a stub at "path", as a hard link to Hermit if possible.
+func writeStub(task *ui.Task, path string) error {
+	source, err := stubSource()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return errors.WithStack(err)
+	}
+	task.Debugf("ln %q %q", source, path)
+	if err := os.Link(source, path); err == nil {
+		return nil
+	}
+	// Hard links can't cross volumes, so fall back to a copy.
+	task.Debugf("cp %q %q", source, path)
+	src, err := os.Open(source)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer src.Close() // nolint: gosec
+	dest, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0700)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := io.Copy(dest, src); err != nil {
+		_ = dest.Close()
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(dest.Close())
+}
+
+// Returns the binaries listed in a package link written by linkStubs.
+func readStubPackageLink(pkgLink string) ([]string, error) {
+	data, err := ioutil.ReadFile(pkgLink)
+	if err != nil {
+		return nil, err
+	}
+	binaries := []string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			binaries = append(binaries, line)
+		}
+	}
+	return binaries, nil
+}
+
+// Returns the stubs of the binaries of an installed package.
+func (e *Env) linkedStubs(pkg *manifest.Package) ([]string, error) {
+	binaries, err := readStubPackageLink(e.pkgLink(pkg))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	stubs := make([]string, 0, len(binaries))
+	for _, binary := range binaries {
+		stubs = append(stubs, filepath.Join(e.binDir, stubName(binary)))
+	}
+	return stubs, nil
+}
+
+// Find the package link listing the binary that "executable" is a stub for.
+//
+// "binary" is the path the binary would have been linked to were symlinks
+// available, ie. without any added ".exe" extension.
+func findStubPackageLink(executable string) (pkgLink, binary string, err error) {
+	executable, err = filepath.Abs(executable)
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	binDir := filepath.Dir(executable)
+	name := filepath.Base(executable)
+	pkgLinks, err := filepath.Glob(filepath.Join(binDir, ".*.pkg"))
+	if err != nil {
+		return "", "", errors.WithStack(err)
+	}
+	for _, pkgLink := range pkgLinks {
+		binaries, err := readStubPackageLink(pkgLink)
+		if err != nil {
+			continue
+		}
+		for _, binary := range binaries {
+			if strings.EqualFold(stubName(binary), name) {
+				return pkgLink, filepath.Join(binDir, binary), nil
+			}
+		}
+	}
+	return "", "", errors.Errorf("%s: not a Hermit binary stub", executable)
+}
@@ -0,0 +1,213 @@
+// Package telemetry records the package operations performed in Hermit environments.
+//
+// Telemetry is opt-in. Events are appended to a local log as JSON lines, and
+// may also be pushed to an HTTP endpoint, eg. one run by a platform team to find
+// out which tools and versions developers install. Events contain nothing but
+// the operation, the package name and version, and the OS and architecture.
+package telemetry
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/cashapp/hermit/manifest"
+)
+
+// Operation performed on a package.
+type Operation string
+
+// Operations that are recorded.
+const (
+	Install   Operation = "install"
+	Upgrade   Operation = "upgrade"
+	Uninstall Operation = "uninstall"
+)
+
+// Event is a package operation, as pushed to the telemetry endpoint.
+type Event struct {
+	Operation Operation `json:"event"`
+	Package   string    `json:"package"`
+	// Version of the package, or "@<channel>" for channels.
+	Version string `json:"version"`
+	OS      string `json:"os"`
+	Arch    string `json:"arch"`
+}
+
+// NewEvent creates an Event for an operation on the package "ref" on this platform.
+func NewEvent(operation Operation, ref manifest.Reference) Event {
+	return Event{
+		Operation: operation,
+		Package:   ref.Name,
+		Version:   ref.StringNoName(),
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+	}
+}
+
+// LogEntry is an Event as recorded in the local log.
+type LogEntry struct {
+	Time time.Time `json:"time"`
+	Event
+}
+
+// Recorder records events to a local log, and queues them to be pushed to an endpoint.
+//
+// A nil Recorder records nothing.
+type Recorder struct {
+	path     string
+	endpoint string
+	client   *http.Client
+
+	lock    sync.Mutex
+	pending []Event
+}
+
+// New creates a Recorder that logs events to the file at "path".
+//
+// If "endpoint" is not empty, events are also pushed to it by Push.
+func New(path, endpoint string, client *http.Client) *Recorder {
+	return &Recorder{path: path, endpoint: endpoint, client: client}
+}
+
+// Record an event.
+func (r *Recorder) Record(event Event) error {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.endpoint != "" {
+		r.pending = append(r.pending, event)
+	}
+	data, err := json.Marshal(LogEntry{Time: time.Now().UTC(), Event: event})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	w, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		_ = w.Close()
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(w.Close())
+}
+
+// Push the events recorded since the last push to the endpoint, if any.
+//
+// Events are POSTed as a JSON document {"events": [...]}. Events that fail to
+// be pushed are only kept in the local log.
+func (r *Recorder) Push(ctx context.Context) error {
+	if r == nil {
+		return nil
+	}
+	r.lock.Lock()
+	events := r.pending
+	r.pending = nil
+	r.lock.Unlock()
+	if len(events) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(struct {
+		Events []Event `json:"events"`
+	}{events})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(data))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, r.endpoint)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.Errorf("%s: %s", r.endpoint, resp.Status)
+	}
+	return nil
+}
+
+// ReadLog reads the entries of the local log at "path".
+func ReadLog(path string) ([]LogEntry, error) {
+	r, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer r.Close()
+	entries := []LogEntry{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		entry := LogEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, errors.Wrapf(err, "%s:%d", path, line)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, errors.WithStack(scanner.Err())
+}
+
+// WriteMetrics writes counters of the logged events to "w", in the Prometheus text exposition format.
+func WriteMetrics(w io.Writer, entries []LogEntry) error {
+	counts := map[Event]int{}
+	for _, entry := range entries {
+		counts[entry.Event]++
+	}
+	events := make([]Event, 0, len(counts))
+	for event := range counts {
+		events = append(events, event)
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return metricLabels(events[i]) < metricLabels(events[j])
+	})
+	out := &strings.Builder{}
+	fmt.Fprintln(out, "# HELP hermit_package_events_total Package operations performed in Hermit environments.")
+	fmt.Fprintln(out, "# TYPE hermit_package_events_total counter")
+	for _, event := range events {
+		fmt.Fprintf(out, "hermit_package_events_total{%s} %d\n", metricLabels(event), counts[event])
+	}
+	_, err := io.WriteString(w, out.String())
+	return errors.WithStack(err)
+}
+
+func metricLabels(event Event) string {
+	labels := []string{
+		"package=" + quoteLabel(event.Package),
+		"version=" + quoteLabel(event.Version),
+		"event=" + quoteLabel(string(event.Operation)),
+		"os=" + quoteLabel(event.OS),
+		"arch=" + quoteLabel(event.Arch),
+	}
+	return strings.Join(labels, ",")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func quoteLabel(value string) string {
+	return `"` + labelEscaper.Replace(value) + `"`
+}
@@ -0,0 +1,56 @@
+package telemetry
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/cashapp/hermit/manifest"
+)
+
+func TestRecorder(t *testing.T) {
+	var pushed []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, _ := ioutil.ReadAll(r.Body)
+		pushed = append(pushed, string(data))
+	}))
+	defer server.Close()
+	path := filepath.Join(t.TempDir(), "telemetry.jsonl")
+
+	recorder := New(path, server.URL, server.Client())
+	install := Event{Operation: Install, Package: "go", Version: "1.21.0", OS: "linux", Arch: "amd64"}
+	require.NoError(t, recorder.Record(install))
+	require.NoError(t, recorder.Record(NewEvent(Uninstall, manifest.ParseReference("protoc@stable"))))
+	require.NoError(t, recorder.Push(context.Background()))
+	require.NoError(t, recorder.Push(context.Background()))
+	require.Len(t, pushed, 1)
+	doc := struct{ Events []map[string]string }{}
+	require.NoError(t, json.Unmarshal([]byte(pushed[0]), &doc))
+	require.Equal(t, map[string]string{"event": "install", "package": "go", "version": "1.21.0", "os": "linux", "arch": "amd64"}, doc.Events[0])
+	require.Equal(t, "@stable", doc.Events[1]["version"])
+
+	require.NoError(t, recorder.Record(install))
+	entries, err := ReadLog(path)
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+	require.Equal(t, install, entries[0].Event)
+	require.False(t, entries[0].Time.IsZero())
+
+	out := &strings.Builder{}
+	require.NoError(t, WriteMetrics(out, []LogEntry{entries[0], entries[2]}))
+	require.Equal(t, `# HELP hermit_package_events_total Package operations performed in Hermit environments.
+# TYPE hermit_package_events_total counter
+hermit_package_events_total{package="go",version="1.21.0",event="install",os="linux",arch="amd64"} 2
+`, out.String())
+
+	var disabled *Recorder
+	require.NoError(t, disabled.Record(install))
+	require.NoError(t, disabled.Push(context.Background()))
+}
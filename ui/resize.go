@@ -0,0 +1,21 @@
+//go:build !windows
+// +build !windows
+
+package ui
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// Call fn whenever the terminal is resized.
+func notifyResize(fn func()) {
+	winch := make(chan os.Signal, 1)
+	go func() {
+		for range winch {
+			fn()
+		}
+	}()
+	signal.Notify(winch, syscall.SIGWINCH)
+}
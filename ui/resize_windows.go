@@ -0,0 +1,4 @@
+package ui
+
+// Windows has no SIGWINCH, so the width is only determined at startup.
+func notifyResize(fn func()) {}
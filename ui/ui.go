@@ -22,9 +22,7 @@ import (
 	"hash/fnv"
 	"io"
 	"os"
-	"os/signal"
 	"strings"
-	"syscall"
 
 	"github.com/pkg/errors"
 
@@ -85,13 +83,7 @@ func New(level Level, stdout, stderr SyncWriter, stdoutIsTTY, stderrIsTTY bool)
 		logf: w.logf,
 	}
 	w.updateWidth()
-	winch := make(chan os.Signal, 1)
-	go func() {
-		for range winch {
-			w.updateWidth()
-		}
-	}()
-	signal.Notify(winch, syscall.SIGWINCH)
+	notifyResize(w.updateWidth)
 	return w
 }
 
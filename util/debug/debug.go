@@ -12,6 +12,7 @@ var Flags struct {
 	KeepLogs        bool `hcl:"keeplogs,optional" help:"Don't clear logs after executing.'"`
 	AlwaysCheckSelf bool `hcl:"alwayscheckself,optional" help:"Always check if Hermit itself needs updating."`
 	FailHTTP        bool `hcl:"failhttp,optional" help:"Always fail HTTP requests."`
+	NoExecSnapshots bool `hcl:"noexecsnapshots,optional" help:"Always resolve packages when executing binaries, ignoring exec snapshots."`
 }
 
 func init() {
@@ -0,0 +1,19 @@
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"syscall"
+
+	"github.com/pkg/errors"
+)
+
+// FreeSpace returns the number of bytes available to unprivileged users on the filesystem containing "dir".
+func FreeSpace(dir string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, errors.Wrap(err, dir)
+	}
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil // nolint: unconvert
+}
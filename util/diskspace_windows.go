@@ -0,0 +1,10 @@
+package util
+
+import (
+	"github.com/pkg/errors"
+)
+
+// FreeSpace is not supported on Windows.
+func FreeSpace(dir string) (uint64, error) {
+	return 0, errors.Errorf("%s: free space unavailable on windows", dir)
+}
@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package util
+
+import (
+	"syscall"
+)
+
+// Exec replaces the current process with "binary".
+//
+// "args" includes the name of the binary, as with os.Args.
+func Exec(binary string, args []string, env []string) error {
+	return syscall.Exec(binary, args, env)
+}
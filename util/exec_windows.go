@@ -0,0 +1,30 @@
+package util
+
+import (
+	"os"
+	"os/exec"
+
+	"github.com/pkg/errors"
+)
+
+// Exec runs "binary" to completion then exits with its exit code, as Windows
+// can't replace the current process.
+//
+// "args" includes the name of the binary, as with os.Args.
+func Exec(binary string, args []string, env []string) error {
+	cmd := exec.Command(binary, args[1:]...)
+	cmd.Env = env
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		os.Exit(exitErr.ExitCode())
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	os.Exit(0)
+	return nil
+}
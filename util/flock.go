@@ -2,6 +2,11 @@ package util
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gofrs/flock"
@@ -12,43 +17,84 @@ import (
 
 // FileLock abstracts away the file locking mechanism.
 // One FileLock corresponds to a one file on disk.
-// This does not support multi-threading. Use only from within one go routine.
+//
+// A FileLock may be used from multiple goroutines, which share the lock held by
+// the process, so it does not exclude goroutines from each other.
 type FileLock struct {
+	mu            sync.Mutex
 	lock          *flock.Flock
 	file          string
 	lockCount     int
+	exclusive     bool
 	checkInterval time.Duration
 }
 
+// LockHolder describes the process holding an exclusive lock.
+type LockHolder struct {
+	PID     int       `json:"pid"`
+	Command string    `json:"command"`
+	Since   time.Time `json:"since"`
+}
+
+func (h *LockHolder) String() string {
+	return fmt.Sprintf("pid %d (%s) since %s", h.PID, h.Command, h.Since.Format(time.RFC3339))
+}
+
 // NewLock creates a new file lock.
 func NewLock(file string, checkInterval time.Duration) *FileLock {
 	return &FileLock{file: file, checkInterval: checkInterval}
 }
 
-// Acquire takes the lock. For every Acquire, Release needs to be called later.
-// Returns immediately if this process already holds the lock.
+// Acquire takes the lock exclusively. For every Acquire, Release needs to be called later.
+// Returns immediately if this process already holds the lock exclusively,
+// and fails if it holds the lock shared, as upgrading could deadlock.
+//
+// The holder of an exclusive lock is recorded alongside the lock file, see ReadLockHolder.
 func (l *FileLock) Acquire(ctx context.Context, log ui.Logger) error {
+	return l.acquire(ctx, log, true)
+}
+
+// AcquireShared takes the lock shared with other processes, but not with
+// exclusive holders. For every AcquireShared, Release needs to be called later.
+// Returns immediately if this process already holds the lock, in either mode.
+func (l *FileLock) AcquireShared(ctx context.Context, log ui.Logger) error {
+	return l.acquire(ctx, log, false)
+}
+
+func (l *FileLock) acquire(ctx context.Context, log ui.Logger, exclusive bool) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.lock != nil && exclusive && !l.exclusive {
+		return errors.Errorf("the lock at %s is held shared by this process and can't be acquired exclusively", l.file)
+	}
 	if l.lock == nil {
 		lock := flock.New(l.file)
-		gotLock, err := lock.TryLock()
+		try := lock.TryRLock
+		if exclusive {
+			try = lock.TryLock
+		}
+		gotLock, err := try()
 		if err != nil {
 			return errors.WithStack(err)
 		}
 		if !gotLock {
-			log.Warnf("%s", "Waiting for a lock at "+l.file)
+			msg := "Waiting for a lock at " + l.file
+			if holder := readHolderFile(l.file); holder != nil {
+				msg += " held by " + holder.String()
+			}
+			log.Warnf("%s", msg)
 			ticker := time.NewTicker(l.checkInterval)
 			defer ticker.Stop()
+		wait:
 			for {
 				select {
 				case <-ticker.C:
-					gotLock, err := lock.TryLock()
+					gotLock, err := try()
 					if err != nil {
 						return errors.WithStack(err)
 					}
 					if gotLock {
-						l.lock = lock
-						l.lockCount = 1
-						return nil
+						break wait
 					}
 				case <-ctx.Done():
 					return errors.New("timeout while waiting for the lock")
@@ -57,6 +103,13 @@ func (l *FileLock) Acquire(ctx context.Context, log ui.Logger) error {
 		}
 		l.lock = lock
 		l.lockCount = 0
+		l.exclusive = exclusive
+		if exclusive {
+			l.writeHolder(log)
+		} else {
+			// There can't be an exclusive holder, so any recorded holder is stale.
+			_ = os.Remove(holderFile(l.file))
+		}
 	}
 	l.lockCount++
 	return nil
@@ -65,8 +118,13 @@ func (l *FileLock) Acquire(ctx context.Context, log ui.Logger) error {
 // Release releases the lock. If there is an error while releasing,
 // the error is logged
 func (l *FileLock) Release(log ui.Logger) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
 	l.lockCount--
 	if l.lockCount <= 0 {
+		if l.exclusive {
+			_ = os.Remove(holderFile(l.file))
+		}
 		// If the release fails, log an error but allow the execution to continue
 		if err := l.lock.Unlock(); err != nil {
 			log.Errorf("%s", err.Error())
@@ -74,3 +132,50 @@ func (l *FileLock) Release(log ui.Logger) {
 		l.lock = nil
 	}
 }
+
+// Record this process as the holder of the lock. Failing to do so is not fatal.
+func (l *FileLock) writeHolder(log ui.Logger) {
+	holder := &LockHolder{PID: os.Getpid(), Command: strings.Join(os.Args, " "), Since: time.Now().UTC()}
+	data, err := json.Marshal(holder)
+	if err == nil {
+		err = os.WriteFile(holderFile(l.file), data, 0600)
+	}
+	if err != nil {
+		log.Debugf("could not record lock holder for %s: %s", l.file, err)
+	}
+}
+
+// ReadLockHolder checks whether the lock at "file" is held by another process.
+//
+// If the lock is held exclusively its holder is returned. The holder is nil
+// if the lock is only held shared, or its holder could not be determined.
+func ReadLockHolder(file string) (holder *LockHolder, held bool, err error) {
+	if _, err := os.Stat(file); os.IsNotExist(err) {
+		return nil, false, nil
+	}
+	lock := flock.New(file)
+	gotLock, err := lock.TryLock()
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	if gotLock {
+		return nil, false, errors.WithStack(lock.Unlock())
+	}
+	return readHolderFile(file), true, nil
+}
+
+func readHolderFile(file string) *LockHolder {
+	data, err := os.ReadFile(holderFile(file))
+	if err != nil {
+		return nil
+	}
+	holder := &LockHolder{}
+	if err := json.Unmarshal(data, holder); err != nil {
+		return nil
+	}
+	return holder
+}
+
+func holderFile(file string) string {
+	return file + ".holder"
+}
@@ -94,3 +94,55 @@ func TestFileLockProceed(t *testing.T) {
 	require.Empty(t, logger1buf.String())
 	require.Contains(t, logger2buf.String(), "Waiting for a lock at "+file)
 }
+
+// Test that shared locks don't exclude each other, but do exclude exclusive locks
+func TestFileLockShared(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lock")
+	logger, _ := ui.NewForTesting()
+
+	lock1 := NewLock(file, 5*time.Millisecond)
+	require.NoError(t, lock1.AcquireShared(context.Background(), logger))
+	lock2 := NewLock(file, 5*time.Millisecond)
+	require.NoError(t, lock2.AcquireShared(context.Background(), logger))
+
+	holder, held, err := ReadLockHolder(file)
+	require.NoError(t, err)
+	require.True(t, held)
+	require.Nil(t, holder)
+
+	timeoutCtx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	lock3 := NewLock(file, 5*time.Millisecond)
+	require.Error(t, lock3.Acquire(timeoutCtx, logger))
+
+	lock1.Release(logger)
+	lock2.Release(logger)
+	require.NoError(t, lock3.Acquire(context.Background(), logger))
+
+	holder, held, err = ReadLockHolder(file)
+	require.NoError(t, err)
+	require.True(t, held)
+	require.Equal(t, os.Getpid(), holder.PID)
+
+	lock3.Release(logger)
+	_, held, err = ReadLockHolder(file)
+	require.NoError(t, err)
+	require.False(t, held)
+}
+
+// Test that a lock held shared by this process can't be acquired exclusively
+func TestFileLockSharedUpgrade(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "lock")
+	logger, _ := ui.NewForTesting()
+
+	lock := NewLock(file, time.Millisecond)
+	require.NoError(t, lock.AcquireShared(context.Background(), logger))
+	err := lock.Acquire(context.Background(), logger)
+	require.EqualError(t, err, "the lock at "+file+" is held shared by this process and can't be acquired exclusively")
+	lock.Release(logger)
+
+	require.NoError(t, lock.Acquire(context.Background(), logger))
+	require.NoError(t, lock.AcquireShared(context.Background(), logger))
+	lock.Release(logger)
+	lock.Release(logger)
+}
@@ -0,0 +1,98 @@
+package util
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// NetrcEntry is the login and password of a machine in a netrc file.
+type NetrcEntry struct {
+	Login    string
+	Password string
+	// Default is true if this is the file's "default" entry rather than one for the machine.
+	Default bool
+}
+
+// NetrcPath returns the path of the user's netrc file, $NETRC or
+// ~/.netrc (~/_netrc on Windows), or "" if it can't be determined.
+func NetrcPath() string {
+	if path := os.Getenv("NETRC"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	name := ".netrc"
+	if runtime.GOOS == "windows" {
+		name = "_netrc"
+	}
+	return filepath.Join(home, name)
+}
+
+// Netrc returns the entry for "host" in the netrc file at "path", as for ParseNetrc.
+//
+// A missing file has no entries.
+func Netrc(path, host string) (*NetrcEntry, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return ParseNetrc(string(data), host), nil
+}
+
+// ParseNetrc finds the entry for "host" in the content of a netrc file,
+// falling back to its "default" entry. Returns nil if there is neither.
+//
+// Macro definitions are not supported.
+func ParseNetrc(data, host string) *NetrcEntry {
+	var (
+		found    *NetrcEntry
+		fallback *NetrcEntry
+		current  *NetrcEntry
+	)
+	fields := strings.Fields(data)
+	for i := 0; i < len(fields); i++ {
+		value := ""
+		if i+1 < len(fields) {
+			value = fields[i+1]
+		}
+		switch fields[i] {
+		case "machine":
+			current = nil
+			if value == host && found == nil {
+				found = &NetrcEntry{}
+				current = found
+			}
+			i++
+		case "default":
+			current = nil
+			if fallback == nil {
+				fallback = &NetrcEntry{Default: true}
+				current = fallback
+			}
+		case "login":
+			if current != nil {
+				current.Login = value
+			}
+			i++
+		case "password":
+			if current != nil {
+				current.Password = value
+			}
+			i++
+		case "account":
+			i++
+		}
+	}
+	if found != nil {
+		return found
+	}
+	return fallback
+}
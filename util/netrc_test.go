@@ -0,0 +1,21 @@
+package util
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNetrc(t *testing.T) {
+	netrc := strings.Join([]string{
+		"machine other.example.com login other password wrong",
+		"machine packages.example.com",
+		"  login hermit",
+		"  password secret",
+		"default login anonymous password guest",
+	}, "\n")
+	require.Equal(t, &NetrcEntry{Login: "hermit", Password: "secret"}, ParseNetrc(netrc, "packages.example.com"))
+	require.Equal(t, &NetrcEntry{Login: "anonymous", Password: "guest", Default: true}, ParseNetrc(netrc, "unknown.example.com"))
+	require.Nil(t, ParseNetrc("machine other.example.com login other", "packages.example.com"))
+}